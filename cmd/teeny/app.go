@@ -0,0 +1,851 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/archive"
+	"github.com/rcliao/teeny-orchestrator/pkg/attach"
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
+	"github.com/rcliao/teeny-orchestrator/pkg/builtin"
+	"github.com/rcliao/teeny-orchestrator/pkg/channels/github"
+	"github.com/rcliao/teeny-orchestrator/pkg/config"
+	ctxpkg "github.com/rcliao/teeny-orchestrator/pkg/context"
+	"github.com/rcliao/teeny-orchestrator/pkg/cost"
+	"github.com/rcliao/teeny-orchestrator/pkg/eval"
+	"github.com/rcliao/teeny-orchestrator/pkg/guard"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/memory"
+	"github.com/rcliao/teeny-orchestrator/pkg/metrics"
+	"github.com/rcliao/teeny-orchestrator/pkg/notify"
+	"github.com/rcliao/teeny-orchestrator/pkg/pgstore"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/queue"
+	"github.com/rcliao/teeny-orchestrator/pkg/rag"
+	"github.com/rcliao/teeny-orchestrator/pkg/redact"
+	"github.com/rcliao/teeny-orchestrator/pkg/scheduler"
+	"github.com/rcliao/teeny-orchestrator/pkg/server"
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+	"github.com/rcliao/teeny-orchestrator/pkg/session/redisstore"
+	"github.com/rcliao/teeny-orchestrator/pkg/skills"
+	"github.com/rcliao/teeny-orchestrator/pkg/summarize"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
+)
+
+// app wires the orchestrator components together from a Config.
+type app struct {
+	cfg         *config.Config
+	opts        globalOptions
+	provider    provider.Provider
+	registry    *toolreg.Registry
+	builder     *ctxpkg.Builder
+	sessions    *session.Manager
+	recorder    *eval.SQLiteRecorder
+	memory      *memory.Store // nil when learnings go to the agent-memory binary
+	eval        *eval.Client
+	metrics     *metrics.Metrics
+	pricing     *cost.Table
+	models      *provider.Catalog
+	runs        *loop.Runs         // Runs submitted over HTTP
+	queue       *queue.Queue       // Bounds concurrent runs in the daemon; nil elsewhere
+	transcripts *transcript.Writer // nil when transcripts are off
+	postgres    *pgstore.DB        // nil unless transcripts or job history go to postgres
+	audit       *audit.Log         // nil when the audit log is off
+	guard       *guard.Guard       // nil when no guardrails are configured
+	budget      *cost.Tracker      // nil when no budget is configured
+	store       *scheduler.Store   // Daemon jobs file; nil if not configured
+
+	name   string    // Agent this app runs as ("" = the default agent)
+	agents *agentSet // Every agent by name, once loadAgents has run
+}
+
+// agentSet holds the daemon's agents by name. Reloading the config swaps
+// in new ones; runs in progress keep the agent they started with.
+type agentSet struct {
+	mu     sync.RWMutex
+	byName map[string]*app
+}
+
+// all returns every agent.
+func (s *agentSet) all() []*app {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Collect(maps.Values(s.byName))
+}
+
+// newApp loads configuration and constructs all components.
+func newApp(opts globalOptions) (*app, error) {
+	cfg, err := opts.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if redactor != nil {
+		log.SetOutput(redactor.Writer(log.Writer()))
+	}
+
+	p, err := newProvider(cfg.Provider)
+	if err != nil {
+		return nil, err
+	}
+	workspace := config.ExpandHome(cfg.Workspace)
+
+	m := metrics.New()
+	var store *scheduler.Store
+	if cfg.Daemon != "" {
+		store = scheduler.NewStore(config.ExpandHome(cfg.Daemon))
+	}
+	reg, err := newRegistry(cfg, "", workspace, m, store)
+	if err != nil {
+		return nil, err
+	}
+	models := provider.DefaultCatalog().With(cfg.Provider.Models)
+	builder, err := newBuilder(cfg, opts, workspace, reg, models)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := openSessions(cfg, redactor)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &app{
+		cfg:      cfg,
+		opts:     opts,
+		provider: p,
+		registry: reg,
+		builder:  builder,
+		sessions: sessions,
+		eval:     eval.NewClient(eval.DefaultConfig()),
+		metrics:  m,
+		pricing:  cost.FromCatalog(models).With(cfg.Cost.Pricing),
+		models:   models,
+		runs:     loop.NewRuns(time.Hour),
+		store:    store,
+	}
+
+	if cfg.Postgres.Transcripts || cfg.Postgres.History {
+		if a.postgres, err = pgstore.Open(context.Background(), cfg.Postgres.DSN()); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case cfg.Postgres.Transcripts:
+		a.transcripts = transcript.NewStore(a.postgres.Transcripts())
+		a.transcripts.SetRedactor(redactor)
+	case cfg.Loop.Transcripts != "":
+		a.transcripts = transcript.New(config.ExpandHome(cfg.Loop.Transcripts))
+		a.transcripts.SetRedactor(redactor)
+	}
+	if cfg.Audit != "" {
+		if a.audit, err = audit.Open(config.ExpandHome(cfg.Audit)); err != nil {
+			return nil, err
+		}
+		a.audit.SetRedactor(redactor)
+	}
+	if a.budget, err = a.newBudget(); err != nil {
+		return nil, err
+	}
+	if a.budget != nil {
+		a.provider = provider.Chain(a.provider, cost.Track(a.pricing, a.budget))
+	}
+	a.guard = newGuard(cfg.Guard, a.provider, workspace)
+
+	judge := p
+	if jc := cfg.Eval.Judge; jc.Provider != "" {
+		judge, err = provider.NewFromConfig(provider.Config{
+			Name:    jc.Provider,
+			APIKey:  os.Getenv(jc.APIKeyEnv),
+			Model:   jc.Model,
+			BaseURL: jc.BaseURL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("eval.judge: %w", err)
+		}
+	}
+	a.eval.UseJudge(judge, cfg.Eval.Judge.Model)
+
+	if cfg.Eval.DB != "" {
+		rec, err := eval.OpenSQLiteRecorder(config.ExpandHome(cfg.Eval.DB))
+		if err != nil {
+			return nil, err
+		}
+		a.recorder = rec
+		a.eval.UseCallStore(rec)
+		a.sessions.SetUsage(sessionUsage(rec))
+	}
+	if cfg.Eval.Memory != "" {
+		mem, err := memory.Open(config.ExpandHome(cfg.Eval.Memory))
+		if err != nil {
+			a.close()
+			return nil, err
+		}
+		a.memory = mem
+		if err := useEmbedder(mem, cfg.Embedding); err != nil {
+			a.close()
+			return nil, err
+		}
+		a.eval.UseMemoryStore(mem)
+	}
+
+	return a, nil
+}
+
+// loadAgents builds the named agents from config. Each is a copy of a with
+// the agent's own provider, tools, and workspace; sessions, metrics, eval
+// storage, the budget, the queue, and run tracking are shared. Call it
+// after setting a.queue.
+func (a *app) loadAgents() error {
+	a.agents = &agentSet{byName: map[string]*app{"": a}}
+	for name := range a.cfg.Agents {
+		ag, err := a.newAgent(name)
+		if err != nil {
+			return fmt.Errorf("agent %s: %w", name, err)
+		}
+		a.agents.byName[name] = ag
+	}
+	return nil
+}
+
+// reload re-reads the config file and replaces every agent with one built
+// from it: providers, tools, prompt builders, guardrails, and the budget
+// are new. Sessions, the queue, run tracking, metrics, logs, eval storage,
+// and everything else set up at startup are kept. It returns the new
+// config.
+func (a *app) reload() (*config.Config, error) {
+	cfg, err := a.opts.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	base := *a
+	base.cfg = cfg
+	if base.budget, err = base.newBudget(); err != nil {
+		return nil, err
+	}
+	agents := make(map[string]*app)
+	for _, name := range append([]string{""}, slices.Collect(maps.Keys(cfg.Agents))...) {
+		ag, err := base.newAgent(name)
+		if err != nil {
+			return nil, fmt.Errorf("agent %s: %w", name, err)
+		}
+		agents[name] = ag
+	}
+	a.agents.mu.Lock()
+	a.agents.byName = agents
+	a.agents.mu.Unlock()
+	return cfg, nil
+}
+
+func (a *app) newAgent(name string) (*app, error) {
+	cfg, err := a.cfg.Agent(name)
+	if err != nil {
+		return nil, err
+	}
+	ag := *a
+	ag.cfg, ag.name = cfg, name
+	workspace := config.ExpandHome(cfg.Workspace)
+	if ag.provider, err = newProvider(cfg.Provider); err != nil {
+		return nil, err
+	}
+	if ag.registry, err = newRegistry(cfg, name, workspace, a.metrics, a.store); err != nil {
+		return nil, err
+	}
+	ag.models = provider.DefaultCatalog().With(cfg.Provider.Models)
+	ag.pricing = cost.FromCatalog(ag.models).With(cfg.Cost.Pricing)
+	if ag.builder, err = newBuilder(cfg, a.opts, workspace, ag.registry, ag.models); err != nil {
+		return nil, err
+	}
+	if ag.budget != nil {
+		ag.provider = provider.Chain(ag.provider, cost.Track(ag.pricing, ag.budget))
+	}
+	ag.guard = newGuard(cfg.Guard, ag.provider, workspace)
+	return &ag, nil
+}
+
+// agent returns the named agent ("" = the default agent) as currently
+// configured.
+func (a *app) agent(name string) (*app, error) {
+	if a.agents == nil {
+		if name == a.name {
+			return a, nil
+		}
+	} else {
+		a.agents.mu.RLock()
+		ag, ok := a.agents.byName[name]
+		a.agents.mu.RUnlock()
+		if ok {
+			return ag, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", server.ErrUnknownAgent, name)
+}
+
+// agentFor returns the agent a session belongs to: the named agent with
+// the longest session prefix the key starts with, or the default agent.
+func (a *app) agentFor(sessionKey string) *app {
+	owner, longest := a, -1
+	for _, ag := range a.agents.all() {
+		if prefix := ag.cfg.AgentPrefix(ag.name); len(prefix) > longest && strings.HasPrefix(sessionKey, prefix) {
+			owner, longest = ag, len(prefix)
+		}
+	}
+	return owner
+}
+
+// newProvider builds the LLM provider from pc, wrapped in a router when
+// routes are configured.
+func newProvider(pc config.ProviderConfig) (provider.Provider, error) {
+	apiKey := ""
+	if pc.APIKeyEnv != "" {
+		apiKey = os.Getenv(pc.APIKeyEnv)
+	}
+	var client *http.Client
+	if hc := pc.HTTP; !hc.IsZero() {
+		timeout, err := hc.TimeoutDuration()
+		if err != nil {
+			return nil, err
+		}
+		client, err = provider.NewHTTPClient(provider.HTTPConfig{Proxy: hc.Proxy, Timeout: timeout, CAFile: hc.CAFile})
+		if err != nil {
+			return nil, err
+		}
+	}
+	retry, err := pc.Retry.Parse()
+	if err != nil {
+		return nil, err
+	}
+	cache, err := pc.Cache.Parse()
+	if err != nil {
+		return nil, err
+	}
+	p, err := provider.NewFromConfig(provider.Config{
+		Name:       pc.Name,
+		APIKey:     apiKey,
+		Model:      pc.Model,
+		BaseURL:    pc.BaseURL,
+		APIVersion: pc.APIVersion,
+		Thinking:   pc.Thinking,
+		HTTPClient: client,
+		Headers:    pc.Headers,
+		Cache:      cache,
+		Retry:      retry,
+		Limits:     pc.Limits,
+		Log:        pc.Log,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pc.Routes) > 0 {
+		var rules []provider.Rule
+		for _, r := range pc.Routes {
+			rules = append(rules, provider.Rule{
+				Name:           r.Name,
+				MinPromptChars: r.MinPromptChars,
+				MaxPromptChars: r.MaxPromptChars,
+				Intents:        r.Intents,
+				CostTier:       r.CostTier,
+				Route:          provider.Route{Model: r.Model},
+			})
+		}
+		p = provider.NewRouter(provider.Route{Provider: p}, rules...)
+	}
+	return p, nil
+}
+
+// newRegistry discovers tools and registers the enabled built-ins for the
+// named agent ("" = default), which runs in workspace.
+func newRegistry(cfg *config.Config, agent, workspace string, m *metrics.Metrics, store *scheduler.Store) (*toolreg.Registry, error) {
+	reg := toolreg.NewRegistry(time.Duration(cfg.Tools.Timeout) * time.Second)
+	reg.SetMetrics(m)
+	reg.SetLimits(cfg.Tools.Limits)
+	for name, l := range cfg.Tools.ToolLimits {
+		reg.SetToolLimits(name, l)
+	}
+	reg.SetPassEnv(cfg.Tools.PassEnv)
+	reg.SetWorkspace(workspace, cfg.Tools.Jail)
+	paths := toolreg.NewPaths(cfg.Tools.Paths, workspace)
+	reg.SetPaths(paths)
+	dryRun, _ := toolreg.ParseDryRun(cfg.Tools.DryRun) // Checked by config.Load
+	reg.SetDryRun(dryRun)
+	secrets, err := newSecrets(cfg.Tools.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	reg.UseSecrets(secrets)
+	var toolDirs []string
+	for _, dir := range cfg.Tools.Path {
+		toolDirs = append(toolDirs, config.ExpandHome(dir))
+	}
+	if err := reg.Discover(toolDirs); err != nil {
+		return nil, fmt.Errorf("discover tools: %w", err)
+	}
+	if cfg.Tools.Shell.Enabled {
+		shellCfg := builtin.DefaultShellConfig()
+		shellCfg.WorkDir = workspace
+		shellCfg.AllowedCommands = cfg.Tools.Shell.AllowedCommands
+		shellCfg.Paths = paths
+		shellCfg.Offline = cfg.Tools.Shell.Offline
+		if cfg.Tools.Shell.EnvWhitelist != nil {
+			shellCfg.EnvWhitelist = cfg.Tools.Shell.EnvWhitelist
+		}
+		if cfg.Tools.Shell.MaxOutputBytes > 0 {
+			shellCfg.MaxOutputBytes = cfg.Tools.Shell.MaxOutputBytes
+		}
+		if err := reg.Register(builtin.Shell(shellCfg)); err != nil {
+			return nil, err
+		}
+	}
+
+	if fc := cfg.Tools.FS; fc.Enabled {
+		patchCfg := builtin.PatchConfig{Root: workspace, BackupDir: config.ExpandHome(fc.BackupDir), Paths: paths}
+		if err := reg.Register(builtin.Patch(patchCfg)); err != nil {
+			return nil, err
+		}
+	}
+
+	if cc := cfg.Tools.Code; cc.Enabled {
+		timeout, _ := cc.TimeoutDuration()
+		codeCfg := builtin.CodeConfig{
+			Runtime:     cc.Runtime,
+			Images:      cc.Images,
+			CPUs:        cc.CPUs,
+			Memory:      cc.Memory,
+			Timeout:     timeout,
+			Network:     cc.Network,
+			ArtifactDir: config.ExpandHome(cc.ArtifactDir),
+		}
+		if cc.MountWorkspace {
+			codeCfg.Workspace = workspace
+		}
+		if err := reg.Register(builtin.Code(codeCfg)); err != nil {
+			return nil, err
+		}
+	}
+
+	if sc := cfg.Tools.Schedule; sc.Enabled {
+		if store == nil {
+			return nil, fmt.Errorf("tools.schedule needs a daemon jobs file (daemon in config)")
+		}
+		schedCfg := builtin.ScheduleConfig{Store: store, MaxJobs: sc.MaxJobs, Agent: agent}
+		if sc.MinInterval != "" {
+			var err error
+			if schedCfg.MinInterval, err = time.ParseDuration(sc.MinInterval); err != nil {
+				return nil, fmt.Errorf("tools.schedule.min_interval: %w", err)
+			}
+		}
+		if err := reg.Register(builtin.Schedule(schedCfg)); err != nil {
+			return nil, err
+		}
+	}
+
+	if tc := cfg.Tools.GitHub; tc.Enabled {
+		client, err := newGitHubClient(cmp.Or(tc.TokenEnv, cfg.Channels.GitHub.TokenEnv), cmp.Or(tc.APIURL, cfg.Channels.GitHub.APIURL))
+		if err != nil {
+			return nil, fmt.Errorf("tools.github: %w", err)
+		}
+		if err := reg.Register(builtin.GitHub(client)); err != nil {
+			return nil, err
+		}
+	}
+	return reg, nil
+}
+
+// newBuilder creates the system prompt builder for workspace.
+func newBuilder(cfg *config.Config, opts globalOptions, workspace string, reg *toolreg.Registry, models *provider.Catalog) (*ctxpkg.Builder, error) {
+	ctxCfg := ctxpkg.DefaultConfig()
+	ctxCfg.Identity = opts.system
+	if len(cfg.Context.Bootstrap) > 0 {
+		ctxCfg.Bootstrap = cfg.Context.Bootstrap
+	}
+	ctxCfg.TreeDepth = cfg.Context.TreeDepth
+	if cfg.Context.TreeMaxEntries > 0 {
+		ctxCfg.TreeMaxEntries = cfg.Context.TreeMaxEntries
+	}
+	if cfg.RAG.TopK > 0 {
+		ctxCfg.RetrievalTopK = cfg.RAG.TopK
+	}
+	if cfg.RAG.MaxTokens > 0 {
+		ctxCfg.RetrievalMaxTokens = cfg.RAG.MaxTokens
+	}
+	ctxCfg.MaxTools = cfg.Context.MaxTools
+	ctxCfg.HistoryMessages = cfg.Context.HistoryMessages
+	ctxCfg.HistoryTokens = cfg.Context.HistoryTokens
+	ctxCfg.MaxOutputTokens = cfg.Loop.Sampling.MaxTokens
+	builder := ctxpkg.NewBuilder(workspace, ctxCfg, reg)
+	switch cfg.Context.ToolRanking {
+	case "", "keyword":
+	case "embedding":
+		emb, err := newEmbedder(cfg.Embedding)
+		if err != nil {
+			return nil, err
+		}
+		if emb == nil {
+			return nil, fmt.Errorf("context.tool_ranking: embedding ranking requires an embedding provider (embedding.provider)")
+		}
+		builder.UseToolRanker(ctxpkg.NewEmbeddingRanker(emb))
+	default:
+		return nil, fmt.Errorf("context.tool_ranking: unknown ranking %q (supported: keyword, embedding)", cfg.Context.ToolRanking)
+	}
+	skillsDir := filepath.Join(workspace, "skills")
+	if cfg.Context.Skills != "" {
+		skillsDir = config.ExpandHome(cfg.Context.Skills)
+	}
+	skillList, err := skills.Load(skillsDir)
+	if err != nil {
+		return nil, err
+	}
+	builder.UseSkills(skillList)
+	if info, ok := models.Lookup(cfg.Provider.Model); ok {
+		builder.UseModel(info)
+	}
+	if cfg.RAG.Enabled {
+		emb, err := newEmbedder(cfg.Embedding)
+		if err != nil {
+			return nil, err
+		}
+		if emb == nil {
+			return nil, fmt.Errorf("rag: requires an embedding provider (embedding.provider)")
+		}
+		builder.UseRetriever(rag.New(workspace, emb, rag.Config{
+			Include: cfg.RAG.Include,
+			Cache:   config.ExpandHome(cfg.RAG.Index),
+		}))
+	}
+	return builder, nil
+}
+
+// newEmbedder builds the configured embedder, or returns nil if none is
+// configured.
+func newEmbedder(ec config.EmbeddingConfig) (provider.Embedder, error) {
+	if ec.Provider == "" {
+		return nil, nil
+	}
+	emb, err := provider.NewEmbedder(provider.EmbedConfig{
+		Name:    ec.Provider,
+		APIKey:  os.Getenv(ec.APIKeyEnv),
+		Model:   ec.Model,
+		BaseURL: ec.BaseURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("embedding: %w", err)
+	}
+	return emb, nil
+}
+
+// newGitHubClient creates a GitHub API client with the token in tokenEnv.
+func newGitHubClient(tokenEnv, apiURL string) (*github.Client, error) {
+	if tokenEnv == "" {
+		return nil, fmt.Errorf("token_env is not set")
+	}
+	token := os.Getenv(tokenEnv)
+	if token == "" {
+		return nil, fmt.Errorf("%s is not set", tokenEnv)
+	}
+	return github.NewClient(token, apiURL), nil
+}
+
+// newSecrets chains the configured secret sources in order.
+func newSecrets(sc config.SecretsConfig) (toolreg.SecretProvider, error) {
+	var chain toolreg.ChainSecrets
+	for _, src := range sc.Sources {
+		switch src {
+		case "env":
+			chain = append(chain, toolreg.EnvSecrets{Prefix: sc.EnvPrefix})
+		case "file":
+			chain = append(chain, toolreg.FileSecrets{Dir: config.ExpandHome(sc.Dir)})
+		case "keyring":
+			chain = append(chain, toolreg.KeyringSecrets{Service: sc.Service})
+		default:
+			return nil, fmt.Errorf("tools.secrets: unknown source %q (want env, file, or keyring)", src)
+		}
+	}
+	return chain, nil
+}
+
+// useEmbedder enables semantic recall on mem when an embedding provider is
+// configured.
+func useEmbedder(mem *memory.Store, ec config.EmbeddingConfig) error {
+	emb, err := newEmbedder(ec)
+	if emb != nil {
+		mem.UseEmbedder(emb)
+	}
+	return err
+}
+
+// newBudget builds the spend tracker from config, alerting the budget's
+// notify targets when a limit is hit. It returns nil if no limit is set.
+func (a *app) newBudget() (*cost.Tracker, error) {
+	bc := a.cfg.Cost.Budget
+	var budgets []cost.Budget
+	if bc.Daily > 0 {
+		budgets = append(budgets, cost.Budget{Name: "daily", Limit: bc.Daily, Window: 24 * time.Hour})
+	}
+	if bc.Weekly > 0 {
+		budgets = append(budgets, cost.Budget{Name: "weekly", Limit: bc.Weekly, Window: 7 * 24 * time.Hour})
+	}
+	if len(budgets) == 0 {
+		return nil, nil
+	}
+	tracker, err := cost.NewTracker(config.ExpandHome(bc.Ledger), budgets...)
+	if err != nil {
+		return nil, err
+	}
+	tracker.OnExceeded(func(e *cost.ExceededError) {
+		action := "refusing runs"
+		if bc.Downgrade != "" {
+			action = "switching to " + bc.Downgrade
+		}
+		msg := fmt.Sprintf("%v; %s", e, action)
+		log.Printf("[budget] %s", msg)
+		if len(bc.Notify) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		r := notify.Result{Job: e.Budget.Name + " budget", Output: msg, Time: time.Now()}
+		if err := a.notifier().Deliver(ctx, bc.Notify, r); err != nil {
+			log.Printf("[budget] notify: %v", err)
+		}
+	})
+	return tracker, nil
+}
+
+// newRedactor builds the secret filter from config, also masking the
+// values of the secret env vars it names. It returns nil when redaction is
+// disabled.
+func newRedactor(cfg *config.Config) (*redact.Redactor, error) {
+	if cfg.Redact.Disabled {
+		return nil, nil
+	}
+	r, err := redact.New(cfg.Redact.Patterns...)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range cfg.SecretEnvs() {
+		r.AddValues(os.Getenv(name))
+	}
+	return r, nil
+}
+
+// newGuard builds the guardrails from config, in order: rules, the
+// denylist, the injection screen, then the classifiers (the only ones that
+// cost an LLM call). It returns nil when none are configured.
+func newGuard(gc config.GuardConfig, p provider.Provider, workspace string) *guard.Guard {
+	if gc.IsZero() {
+		return nil
+	}
+	rules, _ := guard.Rules(gc.Rules...) // Checked by config.Load
+	deny := gc.Deny
+	deny.Dir = workspace
+	var classifier guard.Guardrail
+	if cc := gc.Classifier; cc.Enabled {
+		classifier = &guard.Classifier{Provider: p, Model: cc.Model, Policy: cc.Policy, Targets: cc.Targets}
+	}
+	var screen, injection guard.Guardrail
+	if ic := gc.Injection; ic.Screen {
+		screen = guard.Injection{Action: ic.Action, Tools: ic.Tools}
+	}
+	if ic := gc.Injection; ic.Classifier {
+		injection = &guard.Classifier{Provider: p, Model: gc.Classifier.Model, Targets: []string{guard.ToolResult}, Tools: ic.Tools}
+	}
+	return guard.New(rules, deny, screen, classifier, injection)
+}
+
+// sessionUsage reads session token counts from the eval call store.
+func sessionUsage(rec *eval.SQLiteRecorder) session.UsageFunc {
+	return func(key string) (session.Usage, error) {
+		t, err := rec.SessionTotals(context.Background(), key)
+		return session.Usage{Calls: t.Calls, PromptTokens: t.PromptTokens, CompletionTokens: t.CompletionTokens, CostUSD: t.Cost}, err
+	}
+}
+
+// openSessions creates the session manager on the configured store, with
+// encryption if configured.
+func openSessions(cfg *config.Config, redactor *redact.Redactor) (*session.Manager, error) {
+	opts := []session.Option{session.WithRedactor(redactor)}
+	if cfg.Session.Encrypt {
+		key, err := session.LoadKey(cfg.Session.KeyEnv)
+		if err != nil {
+			return nil, err
+		}
+		c, err := session.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, session.WithCipher(c))
+	}
+	if cfg.Archive.Sessions.Enabled {
+		opts = append(opts, session.WithArchive(&archive.Sessions{Bucket: newBucket(cfg), Prefix: cfg.Archive.Prefix}))
+	}
+	switch cfg.Session.Store {
+	case config.SessionStoreRedis:
+	case config.SessionStorePostgres:
+		store, err := pgstore.OpenSessions(context.Background(), cfg.Postgres.DSN())
+		if err != nil {
+			return nil, err
+		}
+		return session.NewManagerWithStore(store, opts...), nil
+	default:
+		return session.NewManager(config.ExpandHome(cfg.Session.Dir), opts...), nil
+	}
+	r := cfg.Session.Redis
+	ttl, _ := r.TTLDuration() // Checked by config.Load
+	password := ""
+	if r.PasswordEnv != "" {
+		password = os.Getenv(r.PasswordEnv)
+	}
+	store, err := redisstore.Open(r.URL, password, redisstore.Options{Prefix: r.Prefix, TTL: ttl})
+	if err != nil {
+		return nil, err
+	}
+	return session.NewManagerWithStore(store, opts...), nil
+}
+
+// loadLearnings injects learnings related to query into the system prompt.
+// An empty query uses the default learnings topic.
+func (a *app) loadLearnings(ctx context.Context, query string) {
+	topic := query
+	if topic == "" {
+		topic = ctxpkg.DefaultConfig().LearningsTopic
+	}
+	if learnings, _ := a.eval.BuildLearningContext(ctx, topic, 10); learnings != "" {
+		a.builder.SetLearnings(learnings)
+	}
+}
+
+// newLoop creates an agent loop bound to a session key. Named agents keep
+// their sessions apart by prefixing the key.
+func (a *app) newLoop(sessionKey string) *loop.AgentLoop {
+	sessionKey = a.sessionKey(sessionKey)
+	cfg := loop.DefaultConfig()
+	cfg.SessionKey = sessionKey
+	cfg.Verbose = a.opts.verbose
+	if a.cfg.Loop.MaxIterations > 0 {
+		cfg.MaxIterations = a.cfg.Loop.MaxIterations
+	}
+	if a.opts.maxIterations > 0 {
+		cfg.MaxIterations = a.opts.maxIterations
+	}
+	if a.cfg.Loop.MaxToolOutput > 0 {
+		cfg.MaxToolOutput = a.cfg.Loop.MaxToolOutput
+	}
+	if a.cfg.Loop.RepeatLimit > 0 {
+		cfg.RepeatLimit = a.cfg.Loop.RepeatLimit
+	}
+	if a.cfg.Loop.ArgRetries > 0 {
+		cfg.ArgRetries = a.cfg.Loop.ArgRetries
+	}
+	if a.cfg.Loop.MaxContinues > 0 {
+		cfg.MaxContinues = a.cfg.Loop.MaxContinues
+	}
+	cfg.SummarizeToolOutput = a.cfg.Loop.SummarizeToolOutput
+	cfg.Checkpoint = a.cfg.Loop.Checkpoint
+	cfg.ReflectionEnabled = a.cfg.Loop.Reflection
+	cfg.ReflectionModel = a.cfg.Loop.ReflectionModel
+	cfg.Sampling = a.cfg.Loop.Sampling
+	cfg.Thinking = a.cfg.Loop.Thinking
+	if d, _ := a.cfg.Loop.AskTimeoutDuration(); d > 0 { // Checked by config.Load
+		cfg.AskTimeout = d
+	}
+	if a.cfg.Loop.ExtractLearnings {
+		cfg.Learnings = a.eval
+	}
+	if a.recorder != nil {
+		cfg.Recorder = a.recorder
+	}
+	cfg.Metrics = a.metrics
+	cfg.Pricing = a.pricing
+	cfg.Models = a.models
+	cfg.Runs = a.runs
+	cfg.Queue = a.queue
+	cfg.Transcripts = a.transcripts
+	cfg.Audit = a.audit
+	cfg.Guard = a.guard
+	cfg.WrapToolResults = a.cfg.Guard.Injection.Wrap
+	cfg.Budget = a.budget
+	cfg.BudgetModel = a.cfg.Cost.Budget.Downgrade
+	cfg.Permissions, _ = a.cfg.Permissions.Profile(sessionKey, "") // Names checked by config.Load
+	if cc := a.cfg.Session.Compaction; cc.Strategy != "" {
+		cfg.Summarizer = a.summarizer()
+		if cc.AfterMessages > 0 {
+			cfg.CompactAfter = cc.AfterMessages
+		}
+		if cc.KeepLast > 0 {
+			cfg.CompactKeep = cc.KeepLast
+		}
+	}
+	return loop.New(a.provider, a.registry, a.builder, a.sessions, cfg)
+}
+
+// summarizer returns the compaction strategy configured in
+// session.compaction, or nil if there is none.
+func (a *app) summarizer() session.Summarizer {
+	cc := a.cfg.Session.Compaction
+	switch cc.Strategy {
+	case config.CompactLLM:
+		return &summarize.LLM{Provider: a.provider, Model: cc.Model, MaxChars: cc.MaxChars, Weighted: cc.Weighted}
+	case config.CompactRolling:
+		// Each run's chunk gets a quarter of the summary, so a few stay
+		chunk := cmp.Or(cc.MaxChars, summarize.DefaultMaxChars) / 4
+		return &summarize.Rolling{Chunk: &summarize.LLM{Provider: a.provider, Model: cc.Model, MaxChars: chunk, Weighted: cc.Weighted}, MaxChars: cc.MaxChars}
+	case config.CompactExtractive:
+		return &summarize.Extractive{MaxChars: cc.MaxChars, Weighted: cc.Weighted}
+	}
+	return nil
+}
+
+// sessionKey returns key with the agent's session prefix, adding it if
+// key doesn't already have it.
+func (a *app) sessionKey(key string) string {
+	if prefix := a.cfg.AgentPrefix(a.name); !strings.HasPrefix(key, prefix) {
+		return prefix + key
+	}
+	return key
+}
+
+// attachments returns the loader for files attached to prompts.
+func (a *app) attachments() *attach.Loader {
+	ac := a.cfg.Attach
+	return attach.New(attach.Config{
+		MaxBytes:  ac.MaxBytes,
+		MaxText:   ac.MaxText,
+		CacheDir:  config.ExpandHome(ac.Cache),
+		PDFToText: ac.PDFToText,
+	})
+}
+
+// runOptions returns per-run overrides from flags, tagged with intent.
+func (a *app) runOptions(intent string) loop.RunOptions {
+	return loop.RunOptions{Model: a.opts.model, Intent: intent}
+}
+
+// close releases resources held by the app.
+func (a *app) close() {
+	a.sessions.Close()
+	if a.recorder != nil {
+		a.recorder.Close()
+	}
+	if a.memory != nil {
+		a.memory.Close()
+	}
+	a.audit.Close()
+	if a.postgres != nil {
+		a.postgres.Close()
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/archive"
+	"github.com/rcliao/teeny-orchestrator/pkg/config"
+)
+
+func newArchiveCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "archive",
+		Short: "Ship transcripts and sessions to object storage",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "ship",
+		Short: "Upload finished transcripts now, as the daemon does hourly",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(opts.configPath)
+			if err != nil {
+				return err
+			}
+			if !cfg.Archive.Transcripts.Enabled {
+				return fmt.Errorf("transcript archiving is off (set archive.transcripts.enabled in config)")
+			}
+			shipped, err := transcriptArchive(cfg).Ship(cmd.Context(), time.Now())
+			fmt.Fprintf(cmd.OutOrStdout(), "shipped %d transcripts to s3://%s/%s\n", len(shipped), cfg.Archive.S3.Bucket, cfg.Archive.Prefix)
+			return err
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "lifecycle",
+		Short: "Apply the configured lifecycle rules to the bucket, as the daemon does at startup",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(opts.configPath)
+			if err != nil {
+				return err
+			}
+			if !cfg.Archive.Enabled() {
+				return fmt.Errorf("archiving is off (set archive.transcripts or archive.sessions in config)")
+			}
+			rules := lifecycleRules(cfg)
+			if err := newBucket(cfg).SetLifecycle(cmd.Context(), rules); err != nil {
+				return err
+			}
+			for _, r := range rules {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %s* to %s after %d days, expire after %d days\n",
+					r.ID, r.Prefix, r.StorageClass, r.TransitionDays, r.ExpireDays)
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// newBucket returns the archive bucket, with credentials from the
+// configured env vars.
+func newBucket(cfg *config.Config) *archive.Bucket {
+	s := cfg.Archive.S3
+	return &archive.Bucket{
+		Name:         s.Bucket,
+		Region:       s.Region,
+		Endpoint:     s.Endpoint,
+		PathStyle:    s.PathStyle,
+		AccessKey:    os.Getenv(s.AccessKeyEnv),
+		SecretKey:    os.Getenv(s.SecretKeyEnv),
+		SessionToken: os.Getenv(s.SessionTokenEnv),
+	}
+}
+
+// transcriptArchive ships from loop.transcripts to the bucket.
+func transcriptArchive(cfg *config.Config) *archive.Transcripts {
+	after, _ := cfg.Archive.Transcripts.AfterDuration() // Checked by config.Load
+	return &archive.Transcripts{
+		Bucket: newBucket(cfg),
+		Prefix: cfg.Archive.Prefix,
+		Dir:    config.ExpandHome(cfg.Loop.Transcripts),
+		After:  after,
+	}
+}
+
+// lifecycleRules returns a bucket rule for each kind of data archived.
+func lifecycleRules(cfg *config.Config) []archive.Rule {
+	var rules []archive.Rule
+	for _, t := range []struct {
+		name   string
+		target config.ArchiveTarget
+	}{{"transcripts", cfg.Archive.Transcripts}, {"sessions", cfg.Archive.Sessions}} {
+		if !t.target.Enabled {
+			continue
+		}
+		rules = append(rules, archive.Rule{
+			ID:             "teeny-" + t.name,
+			Prefix:         cfg.Archive.Prefix + t.name + "/",
+			TransitionDays: t.target.TransitionDays,
+			StorageClass:   t.target.StorageClass,
+			ExpireDays:     t.target.ExpireDays,
+		})
+	}
+	return rules
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
+	"github.com/rcliao/teeny-orchestrator/pkg/config"
+)
+
+func newAuditCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Check the audit log",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "verify [file]",
+		Short: "Check that no audit record was changed, removed, or reordered",
+		Long: "Verify walks the audit log's hash chain and prints the number of records and the\n" +
+			"hash of the last one. Keep that hash somewhere else: records removed from the end\n" +
+			"can only be noticed by comparing it with a later run.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := ""
+			if len(args) == 1 {
+				path = args[0]
+			} else {
+				cfg, err := config.Load(opts.configPath)
+				if err != nil {
+					return err
+				}
+				if cfg.Audit == "" {
+					return fmt.Errorf("the audit log is disabled (audit is empty in config)")
+				}
+				path = config.ExpandHome(cfg.Audit)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			n, head, err := audit.Verify(f)
+			if err != nil {
+				return fmt.Errorf("%s: %w (%d records verified before it)", path, err, n)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: %d records, chain intact, head %s\n", path, n, head)
+			return nil
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,838 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
+	"github.com/rcliao/teeny-orchestrator/pkg/channels/email"
+	"github.com/rcliao/teeny-orchestrator/pkg/channels/github"
+	"github.com/rcliao/teeny-orchestrator/pkg/channels/slack"
+	"github.com/rcliao/teeny-orchestrator/pkg/config"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/notify"
+	"github.com/rcliao/teeny-orchestrator/pkg/pgstore"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/queue"
+	"github.com/rcliao/teeny-orchestrator/pkg/scheduler"
+	"github.com/rcliao/teeny-orchestrator/pkg/server"
+	"github.com/rcliao/teeny-orchestrator/pkg/service"
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+	"github.com/rcliao/teeny-orchestrator/pkg/trigger"
+)
+
+func newDaemonCmd(opts *globalOptions) *cobra.Command {
+	var detach bool
+	var pidFile, logFile string
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run scheduled jobs from config",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if detach {
+				pid, err := service.Detach(detachedArgs(os.Args[1:]), config.ExpandHome(logFile))
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "teeny daemon started (pid %d), logging to %s\n", pid, logFile)
+				return nil
+			}
+
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+
+			if pidFile == "" {
+				if pidFile, err = a.cfg.PidFile(); err != nil {
+					return err
+				}
+			}
+			if pidFile != "" {
+				remove, err := service.WritePIDFile(config.ExpandHome(pidFile))
+				if err != nil {
+					return err
+				}
+				defer remove()
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			// Runs outlive ctx: on a signal the daemon stops taking new
+			// runs, then drains the ones in progress before cancelling them.
+			// The cause tells the loop to keep their checkpoints.
+			runCtx, cancelRuns := context.WithCancelCause(context.WithoutCancel(cmd.Context()))
+			defer cancelRuns(loop.ErrShutdown)
+
+			// Slack, email, GitHub, webhooks, triggers, API runs, and jobs all share one queue,
+			// whichever agent they run as.
+			a.queue = queue.New(a.cfg.Queue.MaxRuns)
+			if err := a.loadAgents(); err != nil {
+				return err
+			}
+			for _, ag := range a.agents.all() {
+				ag.loadLearnings(ctx, "")
+			}
+			if len(a.cfg.Agents) > 0 {
+				log.Printf("[daemon] serving %d named agents", len(a.cfg.Agents))
+			}
+			if a.cfg.Loop.Checkpoint {
+				a.resumeRuns(runCtx)
+			}
+			// Jobs in the daemon file come from the store, which also picks
+			// up jobs added while running (e.g. by the schedule tool).
+			sched := scheduler.New(a.cfg.Jobs, a.runJob, opts.verbose)
+			sched.SetMetrics(a.metrics)
+			sched.SetNotifier(a.notifier())
+			if a.store != nil {
+				sched.SetStore(a.store)
+			}
+			switch {
+			case a.cfg.Postgres.History:
+				sched.SetHistory(a.postgres.History())
+			case a.cfg.History != "":
+				history, err := scheduler.NewFileHistory(config.ExpandHome(a.cfg.History))
+				if err != nil {
+					return err
+				}
+				sched.SetHistory(history)
+			}
+			sched.Start(runCtx)
+			log.Printf("[daemon] started with %d jobs", len(sched.Jobs()))
+
+			reload := a.reloader(sched)
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			defer signal.Stop(hup)
+			go func() {
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-hup:
+						reload(ctx)
+					}
+				}
+			}()
+
+			var services []func(context.Context) error
+			if a.cfg.Channels.GitHub.Enabled && a.cfg.Server.Listen == "" {
+				return fmt.Errorf("channels.github needs server.listen to receive webhooks")
+			}
+			if listen := a.cfg.Server.Listen; listen != "" {
+				srv := server.New(listen)
+				tokens, err := apiTokens(a.cfg.Server.Tokens)
+				if err != nil {
+					return err
+				}
+				srv.RequireTokens(tokens...)
+				if len(tokens) == 0 && !loopback(listen) {
+					log.Printf("[daemon] warning: %s is reachable from other hosts and server.tokens is empty, so the API is open to them", listen)
+				}
+				srv.Handle("GET /metrics", a.metrics.Handler())
+				srv.Handle("GET /v1/jobs/history", server.RequireSchedule(sched.HistoryHandler()))
+				srv.Handle("GET /v1/jobs/{name}/history", server.RequireSchedule(sched.HistoryHandler()))
+				srv.Handle("POST /v1/reload", server.Reload(reload))
+				questions := server.NewQuestions()
+				srv.Handle("GET /v1/questions", questions)
+				srv.Handle("POST /v1/questions/{id}", questions)
+				runs := server.NewRuns(a.submitRun(runCtx, questions), a.runs)
+				srv.Handle("POST /v1/runs", runs)
+				srv.Handle("GET /v1/runs", runs)
+				srv.Handle("GET /v1/runs/{id}", runs)
+				completions := server.NewCompletions(a.chatCompletion, slices.Sorted(maps.Keys(a.cfg.Agents))...)
+				srv.Handle("GET /v1/models", completions)
+				srv.Handle("POST /v1/chat/completions", completions)
+				if gc := a.cfg.Channels.GitHub; gc.Enabled {
+					adapter, err := a.githubAdapter(runCtx, opts.verbose)
+					if err != nil {
+						return err
+					}
+					srv.Handle("POST /v1/github", adapter)
+					srv.Signed("/v1/github")
+					log.Printf("[daemon] answering GitHub mentions of @%s", gc.Bot)
+				}
+				if len(a.cfg.Hooks) > 0 {
+					hooks, err := newHooks(runCtx, a, questions, opts.verbose)
+					if err != nil {
+						return err
+					}
+					srv.Handle("POST /v1/hooks/{name}", hooks)
+					for _, h := range a.cfg.Hooks {
+						if h.SecretEnv != "" {
+							srv.Signed("/v1/hooks/" + h.Name)
+						}
+					}
+				}
+				log.Printf("[daemon] serving HTTP on %s", listen)
+				services = append(services, srv.Run)
+			}
+			if sc := a.cfg.Channels.Slack; sc.Enabled {
+				adapter := slack.New(slack.Config{
+					AppToken: os.Getenv(sc.AppTokenEnv),
+					BotToken: os.Getenv(sc.BotTokenEnv),
+					Progress: sc.Progress,
+					Verbose:  opts.verbose,
+				}, a.runChannel(runCtx, "slack", func(ctx context.Context) string {
+					channel, _ := slack.ChannelFrom(ctx)
+					return sc.Agents[channel]
+				}))
+				log.Printf("[daemon] connecting to Slack")
+				services = append(services, adapter.Run)
+			}
+			if ec := a.cfg.Channels.Email; ec.Enabled {
+				adapter, err := a.emailAdapter(runCtx, opts.verbose)
+				if err != nil {
+					return err
+				}
+				log.Printf("[daemon] polling %s for email", ec.IMAPHost)
+				services = append(services, adapter.Run)
+			}
+			if len(a.cfg.Triggers) > 0 {
+				watcher, err := newTriggers(runCtx, a, opts.verbose)
+				if err != nil {
+					return err
+				}
+				log.Printf("[daemon] watching files for %d triggers", len(a.cfg.Triggers))
+				services = append(services, watcher.Run)
+			}
+			if len(a.cfg.Session.Retention) > 0 {
+				policies, _ := a.cfg.Session.RetentionPolicies() // Checked by config.Load
+				log.Printf("[daemon] applying %d session retention policies", len(policies))
+				services = append(services, func(ctx context.Context) error { return a.pruneSessions(ctx, policies) })
+			}
+			if a.cfg.Archive.Enabled() {
+				log.Printf("[daemon] archiving to s3://%s/%s", a.cfg.Archive.S3.Bucket, a.cfg.Archive.Prefix)
+				services = append(services, a.shipArchive)
+			}
+
+			service.Notify(service.Ready)
+			go service.RunWatchdog(ctx)
+			err = runServices(ctx, services)
+			service.Notify(service.Stopping)
+			a.drain(sched, cancelRuns)
+			log.Printf("[daemon] stopped")
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&detach, "detach", false, "Run in the background, detached from the terminal")
+	cmd.Flags().StringVar(&pidFile, "pid-file", "", "Write the daemon's PID here (default: pid_file in the daemon jobs file)")
+	cmd.Flags().StringVar(&logFile, "log", "~/.teeny-claw/daemon.log", "Log file with --detach")
+	return cmd
+}
+
+// detachedArgs returns the command line for the detached daemon: ours
+// without --detach.
+func detachedArgs(args []string) []string {
+	return slices.DeleteFunc(slices.Clone(args), func(arg string) bool {
+		return arg == "--detach" || strings.HasPrefix(arg, "--detach=")
+	})
+}
+
+// drainGrace is how long drain lets cancelled runs wind down.
+const drainGrace = 5 * time.Second
+
+// drain finishes the daemon's runs once its services have stopped taking
+// new ones. It waits up to queue.drain for jobs and runs in progress, then
+// cancels the rest, which resume from their last checkpoint at the next
+// start if loop.checkpoint is set. Sessions are saved last.
+func (a *app) drain(sched *scheduler.Scheduler, cancelRuns context.CancelCauseFunc) {
+	timeout, _ := a.cfg.Queue.DrainDuration() // Checked by config.Load
+	if st := a.queue.Stats(); st.Running+st.Waiting > 0 {
+		log.Printf("[daemon] waiting up to %s for %d runs to finish", timeout, st.Running+st.Waiting)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := sched.Drain(ctx)
+	if err == nil {
+		err = a.queue.Wait(ctx)
+	}
+	sched.Stop()
+	cancelRuns(loop.ErrShutdown)
+	if err != nil {
+		log.Printf("[daemon] runs still going after %s, cancelling them", timeout)
+		grace, cancel := context.WithTimeout(context.Background(), drainGrace)
+		defer cancel()
+		a.queue.Wait(grace)
+	}
+	if err := a.sessions.SaveAll(); err != nil {
+		log.Printf("[daemon] save sessions: %v", err)
+	}
+}
+
+// reloader returns a server.ReloadFunc that applies the config file again:
+// agents are rebuilt (see app.reload) and sched gets the config's jobs.
+// Runs in progress finish with the config they started with. Reloads are
+// serialized, and one that fails leaves the daemon as it was.
+func (a *app) reloader(sched *scheduler.Scheduler) server.ReloadFunc {
+	var mu sync.Mutex
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		service.Notify(service.Reloading)
+		defer service.Notify(service.Ready)
+		cfg, err := a.reload()
+		if err != nil {
+			log.Printf("[daemon] reload: %v", err)
+			return err
+		}
+		for _, ag := range a.agents.all() {
+			ag.loadLearnings(ctx, "")
+		}
+		sched.SetJobs(cfg.Jobs)
+		log.Printf("[daemon] reloaded config: %d agents, %d jobs", len(cfg.Agents)+1, len(sched.Jobs()))
+		return nil
+	}
+}
+
+// runJob is the scheduler.RunFunc backed by a fresh loop per session.
+// Runs are tagged with the "scheduled" intent for model routing, and use
+// the job's agent, permission profile, and sampling settings if it has
+// them.
+func (a *app) runJob(ctx context.Context, sessionKey, prompt string) (string, error) {
+	if job, ok := scheduler.JobFrom(ctx); ok {
+		ag, err := a.agent(job.Agent)
+		if err != nil {
+			return "", fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		if ag != a {
+			return ag.runJob(ctx, sessionKey, prompt)
+		}
+	}
+	var usage provider.Usage
+	var usd float64
+	opts := a.runOptions("scheduled")
+	if job, ok := scheduler.JobFrom(ctx); ok {
+		ctx = audit.WithActor(ctx, "job:"+job.Name)
+		if job.Profile != "" {
+			perms, err := a.cfg.Permissions.Profile(sessionKey, job.Profile)
+			if err != nil {
+				return "", fmt.Errorf("job %s: %w", job.Name, err)
+			}
+			opts.Permissions = perms
+		}
+		if job.Sampling != nil {
+			opts.Sampling = *job.Sampling
+		}
+	}
+	opts.Usage = &usage
+	opts.Cost = &usd
+	result, err := a.newLoop(sessionKey).RunWith(ctx, prompt, opts)
+	scheduler.ReportUsage(ctx, usage.PromptTokens, usage.CompletionTokens, usd)
+	return result, err
+}
+
+// resumeRuns finishes, in the background, runs that a crash or restart cut
+// short. Each runs as the agent its session belongs to. Results are only
+// logged: whoever started the run is no longer waiting for it.
+func (a *app) resumeRuns(ctx context.Context) {
+	for _, key := range a.sessions.Checkpointed() {
+		ag := a.agentFor(key)
+		log.Printf("[daemon] resuming unfinished run in %s", key)
+		go func() {
+			result, err := ag.newLoop(key).ResumeWith(audit.WithActor(ctx, "resume"), ag.runOptions(""))
+			if err != nil {
+				log.Printf("[daemon] resumed run in %s failed: %v", key, err)
+				return
+			}
+			log.Printf("[daemon] resumed run in %s finished: %s", key, oneLine(result, 200))
+		}()
+	}
+}
+
+// submitRun returns a server.SubmitFunc that starts runs in the
+// background as the requested agent, bounded by ctx and tagged with the
+// "api" intent. Questions the model asks wait in questions until answered
+// over HTTP.
+func (a *app) submitRun(ctx context.Context, questions *server.Questions) server.SubmitFunc {
+	return func(req context.Context, agent, sessionKey, prompt string) (string, error) {
+		ag, err := a.agent(agent)
+		if err != nil {
+			return "", err
+		}
+		sessionKey = ag.sessionKey(sessionKey)
+		opts, err := ag.apiOptions(req, sessionKey, "api")
+		if err != nil {
+			return "", err
+		}
+		opts.Ask = func(ctx context.Context, question string) (string, error) {
+			return questions.Ask(ctx, sessionKey, question)
+		}
+		return ag.newLoop(sessionKey).SubmitWith(audit.WithActor(ctx, apiActor(req)), prompt, opts)
+	}
+}
+
+// apiOptions returns the options for a run requested over the API in
+// sessionKey, limited to what the request's token allows: its sessions,
+// its permission profile, and the schedule tool only if it may schedule.
+func (a *app) apiOptions(req context.Context, sessionKey, intent string) (loop.RunOptions, error) {
+	opts := a.runOptions(intent)
+	tok, ok := server.TokenFrom(req)
+	if !ok {
+		return opts, nil
+	}
+	if err := server.Authorize(req, sessionKey); err != nil {
+		return opts, fmt.Errorf("token %s: session %s: %w", tok.Name, sessionKey, err)
+	}
+	perms, err := a.cfg.Permissions.Profile(sessionKey, tok.Profile) // Names checked by config.Load
+	if err != nil {
+		return opts, err
+	}
+	if !tok.Schedule {
+		p := toolreg.Profile{Name: "token " + tok.Name}
+		if perms != nil {
+			p = *perms
+		}
+		p.Deny = append(slices.Clone(p.Deny), "schedule")
+		perms = &p
+	}
+	opts.Permissions = perms
+	return opts, nil
+}
+
+// apiActor names who made an API request in the audit log: its token, or
+// just "api" when the server takes no tokens.
+func apiActor(req context.Context) string {
+	if tok, ok := server.TokenFrom(req); ok {
+		return "token:" + tok.Name
+	}
+	return "api"
+}
+
+// apiTokens reads each configured token from its environment variable.
+func apiTokens(configs []config.TokenConfig) ([]server.Token, error) {
+	var tokens []server.Token
+	for _, tc := range configs {
+		secret := os.Getenv(tc.TokenEnv)
+		if secret == "" {
+			return nil, fmt.Errorf("server token %s: %s is not set", tc.Name, tc.TokenEnv)
+		}
+		tokens = append(tokens, server.Token{
+			Name:     tc.Name,
+			Secret:   secret,
+			Sessions: tc.Sessions,
+			Profile:  tc.Profile,
+			Schedule: tc.Schedule,
+			Reload:   tc.Reload,
+		})
+	}
+	return tokens, nil
+}
+
+// loopback reports whether addr listens only on the local host.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// chatCompletion is the server.ChatFunc behind the OpenAI-compatible API.
+// Runs are tagged with the "openai" intent; chat UIs have no way to answer
+// questions, so the model can't ask any. A stateless run gets a throwaway
+// session, seeded with history and deleted when the run ends.
+func (a *app) chatCompletion(ctx context.Context, agent, sessionKey string, history []provider.Message, prompt string, onEvent func(loop.Event)) (string, provider.Usage, error) {
+	ag, err := a.agent(agent)
+	if err != nil {
+		return "", provider.Usage{}, err
+	}
+	stateless := sessionKey == ""
+	if stateless {
+		b := make([]byte, 8)
+		rand.Read(b)
+		sessionKey = "chat-" + hex.EncodeToString(b)
+	}
+	sessionKey = ag.sessionKey(sessionKey)
+	opts, err := ag.apiOptions(ctx, sessionKey, "openai")
+	if err != nil {
+		return "", provider.Usage{}, err
+	}
+	if stateless {
+		defer ag.sessions.Delete(sessionKey)
+		for _, m := range history {
+			ag.sessions.AddMessage(sessionKey, m)
+		}
+	}
+	var usage provider.Usage
+	opts.OnEvent = onEvent
+	opts.Usage = &usage
+	result, err := ag.newLoop(sessionKey).RunWith(audit.WithActor(ctx, apiActor(ctx)), prompt, opts)
+	return result, usage, err
+}
+
+// notifier builds the result deliverer from config.
+func (a *app) notifier() *notify.Notifier {
+	return notify.New(a.smtpConfig())
+}
+
+// smtpConfig returns the notify.smtp mail server, with its password.
+func (a *app) smtpConfig() notify.SMTPConfig {
+	sc := a.cfg.Notify.SMTP
+	return notify.SMTPConfig{
+		Host:     sc.Host,
+		Port:     sc.Port,
+		Username: sc.Username,
+		Password: os.Getenv(sc.PasswordEnv),
+		From:     sc.From,
+	}
+}
+
+// runChannel returns a run function for chat channels, tagged with the
+// channel name as intent. route names the agent that answers a run. Runs
+// are cancelled with runs rather than with the channel, so they can finish
+// while the daemon drains.
+func (a *app) runChannel(runs context.Context, intent string, route func(context.Context) string) func(ctx context.Context, sessionKey, prompt string, onEvent func(loop.Event), ask loop.AskFunc) (string, error) {
+	return func(ctx context.Context, sessionKey, prompt string, onEvent func(loop.Event), ask loop.AskFunc) (string, error) {
+		ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		defer context.AfterFunc(runs, cancel)()
+		defer cancel()
+		ag, err := a.agent(route(ctx))
+		if err != nil {
+			return "", err
+		}
+		opts := ag.runOptions(intent)
+		opts.OnEvent = onEvent
+		opts.Ask = ask
+		return ag.newLoop(sessionKey).RunWith(ctx, prompt, opts)
+	}
+}
+
+// emailAdapter builds the email channel from config. Replies go through
+// the notify.smtp server.
+func (a *app) emailAdapter(runs context.Context, verbose bool) (*email.Adapter, error) {
+	ec := a.cfg.Channels.Email
+	poll, err := ec.PollDuration()
+	if err != nil {
+		return nil, err
+	}
+	port := ec.IMAPPort
+	if port == 0 {
+		port = 993
+	}
+	return email.New(email.Config{
+		IMAPAddr:    net.JoinHostPort(ec.IMAPHost, strconv.Itoa(port)),
+		Insecure:    ec.Insecure,
+		Username:    ec.Username,
+		Password:    os.Getenv(ec.PasswordEnv),
+		Mailbox:     ec.Mailbox,
+		Poll:        poll,
+		Allow:       ec.Allow,
+		AuthServID:  ec.AuthServID,
+		NoAuthCheck: ec.NoAuthCheck,
+		SMTP:        a.smtpConfig(),
+		Verbose:     verbose,
+	}, a.runChannel(runs, "email", func(context.Context) string { return ec.Agent })), nil
+}
+
+// githubAdapter builds the GitHub channel from config.
+func (a *app) githubAdapter(runs context.Context, verbose bool) (*github.Adapter, error) {
+	gc := a.cfg.Channels.GitHub
+	if gc.Bot == "" {
+		return nil, fmt.Errorf("channels.github.bot is not set")
+	}
+	client, err := newGitHubClient(gc.TokenEnv, gc.APIURL)
+	if err != nil {
+		return nil, fmt.Errorf("channels.github: %w", err)
+	}
+	cfg := github.Config{Bot: gc.Bot, Repos: gc.Repos, Associations: gc.Associations, Secret: os.Getenv(gc.SecretEnv), Verbose: verbose}
+	if cfg.Secret == "" {
+		return nil, fmt.Errorf("channels.github: %s is not set", gc.SecretEnv)
+	}
+	return github.New(cfg, client, a.runChannel(runs, "github", func(context.Context) string { return gc.Agent })), nil
+}
+
+// newHooks builds the webhook handler from config. Secrets are read from
+// each hook's secret_env. Questions the model asks during a hook run wait
+// in questions until answered over HTTP.
+func newHooks(ctx context.Context, a *app, questions *server.Questions, verbose bool) (*server.Hooks, error) {
+	var hooks []server.Hook
+	for _, h := range a.cfg.Hooks {
+		hook := server.Hook{Name: h.Name, Session: h.Session, Prompt: h.Prompt, Unsigned: h.Unsigned, Events: h.Events, Agent: h.Agent}
+		if h.SecretEnv != "" {
+			if hook.Secret = os.Getenv(h.SecretEnv); hook.Secret == "" {
+				return nil, fmt.Errorf("hook %s: %s is not set", h.Name, h.SecretEnv)
+			}
+		}
+		hooks = append(hooks, hook)
+	}
+	run := func(ctx context.Context, sessionKey, prompt string) (string, error) {
+		hook, _ := server.HookFrom(ctx)
+		ag, err := a.agent(hook.Agent)
+		if err != nil {
+			return "", err
+		}
+		ctx = audit.WithActor(ctx, "hook:"+hook.Name)
+		opts := ag.runOptions("webhook")
+		opts.Ask = func(ctx context.Context, question string) (string, error) {
+			return questions.Ask(ctx, sessionKey, question)
+		}
+		return ag.newLoop(sessionKey).RunWith(ctx, prompt, opts)
+	}
+	return server.NewHooks(ctx, run, verbose, hooks...)
+}
+
+// newTriggers builds the file watcher from config. Nobody waits on a
+// trigger run, so, like jobs, they cannot ask questions.
+func newTriggers(ctx context.Context, a *app, verbose bool) (*trigger.Watcher, error) {
+	var triggers []trigger.Trigger
+	for _, t := range a.cfg.Triggers {
+		debounce, err := t.DebounceDuration()
+		if err != nil {
+			return nil, err
+		}
+		var paths []string
+		for _, p := range t.Paths {
+			paths = append(paths, config.ExpandHome(p))
+		}
+		triggers = append(triggers, trigger.Trigger{
+			Name:     t.Name,
+			Paths:    paths,
+			Events:   t.Events,
+			Session:  t.Session,
+			Prompt:   t.Prompt,
+			Debounce: debounce,
+			Agent:    t.Agent,
+		})
+	}
+	run := func(ctx context.Context, sessionKey, prompt string) (string, error) {
+		t, _ := trigger.From(ctx)
+		ag, err := a.agent(t.Agent)
+		if err != nil {
+			return "", err
+		}
+		ctx = audit.WithActor(ctx, "trigger:"+t.Name)
+		return ag.newLoop(sessionKey).RunWith(ctx, prompt, ag.runOptions("trigger"))
+	}
+	return trigger.New(ctx, run, verbose, triggers...)
+}
+
+// pruneInterval is how often the daemon applies session retention.
+const pruneInterval = time.Hour
+
+// pruneSessions archives and deletes idle sessions by policy, at startup
+// and then every pruneInterval, until ctx is done.
+func (a *app) pruneSessions(ctx context.Context, policies []session.Retention) error {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		res, err := a.sessions.Prune(policies, time.Now())
+		if err != nil {
+			log.Printf("[daemon] session retention: %v", err)
+		}
+		if len(res.Archived) > 0 || len(res.Deleted) > 0 {
+			log.Printf("[daemon] session retention: archived %d sessions, deleted %d", len(res.Archived), len(res.Deleted))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// shipArchive applies the bucket's lifecycle rules, then ships finished
+// transcripts at startup and every pruneInterval, until ctx is done.
+// Failures are logged and retried on the next round.
+func (a *app) shipArchive(ctx context.Context) error {
+	if err := newBucket(a.cfg).SetLifecycle(ctx, lifecycleRules(a.cfg)); err != nil {
+		log.Printf("[daemon] archive lifecycle: %v", err)
+	}
+	if !a.cfg.Archive.Transcripts.Enabled {
+		return nil
+	}
+	transcripts := transcriptArchive(a.cfg)
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		shipped, err := transcripts.Ship(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[daemon] archive: %v", err)
+		}
+		if len(shipped) > 0 {
+			log.Printf("[daemon] archive: shipped %d transcripts", len(shipped))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// oneLine flattens s to a single line of at most max runes.
+func oneLine(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
+
+// runServices runs each service until ctx is done or one fails, then
+// cancels the rest and returns the first error.
+func runServices(ctx context.Context, services []func(context.Context) error) error {
+	if len(services) == 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errc := make(chan error, len(services))
+	for _, svc := range services {
+		go func() { errc <- svc(ctx) }()
+	}
+
+	var first error
+	for range services {
+		if err := <-errc; err != nil && first == nil {
+			first = err
+			cancel()
+		}
+	}
+	return first
+}
+
+func newJobCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "job",
+		Short: "Inspect and trigger daemon jobs",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List configured daemon jobs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(opts.configPath)
+			if err != nil {
+				return err
+			}
+			jobs, err := cfg.AllJobs()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSCHEDULE\tSESSION\tENABLED")
+			for _, j := range jobs {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%v\n", j.Name, j.Schedule, j.Session, j.Enabled)
+			}
+			return w.Flush()
+		},
+	})
+
+	var limit int
+	historyCmd := &cobra.Command{
+		Use:   "history [name]",
+		Short: "Show recent daemon job runs",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(opts.configPath)
+			if err != nil {
+				return err
+			}
+			var history scheduler.HistoryStore
+			switch {
+			case cfg.Postgres.History:
+				db, err := pgstore.Open(cmd.Context(), cfg.Postgres.DSN())
+				if err != nil {
+					return err
+				}
+				defer db.Close()
+				history = db.History()
+			case cfg.History == "":
+				return fmt.Errorf("job history is disabled (history is empty in config)")
+			default:
+				if history, err = scheduler.NewFileHistory(config.ExpandHome(cfg.History)); err != nil {
+					return err
+				}
+			}
+			var job string
+			if len(args) == 1 {
+				job = args[0]
+			}
+			runs, err := history.List(job, limit)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "JOB\tSTARTED\tDURATION\tTOKENS\tCOST\tRESULT")
+			for _, r := range runs {
+				result := r.Result
+				if r.Error != "" {
+					result = "error: " + r.Error
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t$%.4f\t%s\n", r.Job, r.Start.Local().Format("2006-01-02 15:04:05"),
+					time.Duration(r.DurationMs)*time.Millisecond, r.InputTokens+r.OutputTokens, r.CostUSD, oneLine(result, 60))
+			}
+			return w.Flush()
+		},
+	}
+	historyCmd.Flags().IntVarP(&limit, "limit", "n", 20, "Maximum runs to show")
+	cmd.AddCommand(historyCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "run <name>",
+		Short: "Trigger a specific job immediately",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+
+			jobs, err := a.cfg.AllJobs()
+			if err != nil {
+				return err
+			}
+			for _, j := range jobs {
+				if j.Name != args[0] {
+					continue
+				}
+				if err := a.loadAgents(); err != nil {
+					return err
+				}
+				ag, err := a.agent(j.Agent)
+				if err != nil {
+					return err
+				}
+				ctx := cmd.Context()
+				ag.loadLearnings(ctx, j.Prompt)
+				result, err := a.runJob(scheduler.WithJob(ctx, j), j.Session, j.Prompt)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), result)
+				return nil
+			}
+			return fmt.Errorf("unknown job: %s", args[0])
+		},
+	})
+
+	return cmd
+}
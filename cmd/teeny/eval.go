@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/eval"
+)
+
+func newEvalCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "eval",
+		Short: "Grade runs and track scores over time",
+	}
+
+	var rubricPath, rubricName, runID string
+	var criteria []string
+	scoreCmd := &cobra.Command{
+		Use:   "score <session>",
+		Short: "Have the judge model grade a session against a rubric",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rubric := eval.Rubric{Name: rubricName, Criteria: criteria}
+			if rubricPath != "" {
+				data, err := os.ReadFile(rubricPath)
+				if err != nil {
+					return err
+				}
+				if err := json.Unmarshal(data, &rubric); err != nil {
+					return fmt.Errorf("rubric %s: %w", rubricPath, err)
+				}
+			}
+			if len(rubric.Criteria) == 0 {
+				return fmt.Errorf("no criteria (pass --rubric or --criterion)")
+			}
+
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+
+			msgs := a.sessions.GetHistory(args[0])
+			if msgs == nil {
+				return fmt.Errorf("unknown session: %s", args[0])
+			}
+			t := eval.Transcript{Session: args[0], Messages: msgs}
+			if runID != "" {
+				if t = t.Run(runID); t.Messages == nil {
+					return fmt.Errorf("session %s has no messages from run %s", args[0], runID)
+				}
+			}
+			s, err := a.eval.Score(cmd.Context(), t, rubric)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Score: %.2f (judge %s)\n", s.Score, s.Model)
+			for _, c := range s.Criteria {
+				fmt.Fprintf(out, "  %2d/10  %s — %s\n", c.Score, c.Criterion, c.Reason)
+			}
+			if s.Summary != "" {
+				fmt.Fprintf(out, "%s\n", s.Summary)
+			}
+			return nil
+		},
+	}
+	scoreCmd.Flags().StringVar(&rubricPath, "rubric", "", "Rubric JSON file ({\"name\": ..., \"criteria\": [...]})")
+	scoreCmd.Flags().StringVar(&rubricName, "name", "default", "Rubric name when using --criterion")
+	scoreCmd.Flags().StringArrayVar(&criteria, "criterion", nil, "Criterion to grade (repeatable)")
+	scoreCmd.Flags().StringVar(&runID, "run", "", "Grade only the messages of this run (see sessions show --meta)")
+	cmd.AddCommand(scoreCmd)
+
+	var limit int
+	scoresCmd := &cobra.Command{
+		Use:   "scores [rubric]",
+		Short: "List stored scores, newest first",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+
+			var rubric string
+			if len(args) == 1 {
+				rubric = args[0]
+			}
+			scores, err := a.eval.Scores(cmd.Context(), rubric, limit)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "CREATED\tRUBRIC\tSESSION\tSCORE\tJUDGE")
+			for _, s := range scores {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\t%s\n", s.CreatedAt, s.Rubric, s.Session, s.Score, s.Model)
+			}
+			return w.Flush()
+		},
+	}
+	scoresCmd.Flags().IntVarP(&limit, "limit", "n", 20, "Maximum scores to show")
+	cmd.AddCommand(scoresCmd)
+
+	var asJSON bool
+	benchCmd := &cobra.Command{
+		Use:   "bench <dir>",
+		Short: "Run a directory of benchmark cases and report pass/fail",
+		Long: `Runs every *.json case in dir through the agent loop, each in a fresh
+session, and checks the output. A case looks like:
+
+  {"prompt": "What is 2+2?", "exact": "4"}
+  {"prompt": "Greet me", "regex": "(?i)hello"}
+  {"prompt": "Explain channels", "criteria": ["Accurate", "Under 100 words"], "min_score": 0.8}
+
+Use --config and --model to compare providers or system prompts. Exits
+non-zero if any case fails.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cases, err := eval.LoadCases(args[0])
+			if err != nil {
+				return err
+			}
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+
+			run := func(ctx context.Context, session, prompt string) (string, error) {
+				return a.newLoop(session).RunWith(ctx, prompt, a.runOptions("bench"))
+			}
+			report := a.eval.Bench(cmd.Context(), cases, run)
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				report.WriteText(cmd.OutOrStdout())
+			}
+			if report.Failed > 0 {
+				return fmt.Errorf("%d of %d cases failed", report.Failed, len(cases))
+			}
+			return nil
+		},
+	}
+	benchCmd.Flags().BoolVar(&asJSON, "json", false, "Print the report as JSON")
+	cmd.AddCommand(benchCmd)
+
+	return cmd
+}
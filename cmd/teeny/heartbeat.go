@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+const heartbeatPrompt = `Review the orchestrator's recent activity and extract learnings that will
+make future runs more effective (better tool use, better prompts, fewer wasted tokens).
+Only include learnings that are new compared to the existing ones.
+
+%s
+
+## Existing Learnings
+
+%s`
+
+var heartbeatSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"learnings": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		},
+	},
+	"required": []string{"learnings"},
+}
+
+func newHeartbeatCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "heartbeat",
+		Short: "Run one self-review cycle (analyze call patterns, store learnings)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+
+			ctx := cmd.Context()
+			review, err := a.eval.BuildReviewSummary(ctx)
+			if err != nil {
+				return err
+			}
+			existing, _ := a.eval.BuildLearningContext(ctx, "orchestrator learnings", 20)
+			if existing == "" {
+				existing = "(none)"
+			}
+
+			var out struct {
+				Learnings []string `json:"learnings"`
+			}
+			prompt := fmt.Sprintf(heartbeatPrompt, review, existing)
+			al := a.newLoop(opts.sessionKey("heartbeat"))
+			if err := al.RunStructuredWith(ctx, prompt, heartbeatSchema, &out, a.runOptions("heartbeat")); err != nil {
+				return err
+			}
+
+			for _, l := range out.Learnings {
+				if err := a.eval.StoreLearning(ctx, l, []string{"orchestrator", "heartbeat"}); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "- %s\n", l)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Stored %d learnings\n", len(out.Learnings))
+			return nil
+		},
+	}
+}
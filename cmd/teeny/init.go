@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/config"
+	"github.com/rcliao/teeny-orchestrator/pkg/scheduler"
+)
+
+const defaultAgentsMD = `# AGENTS.md
+
+Describe how the agent should work in this workspace: conventions,
+preferred tools, and anything it should always keep in mind.
+`
+
+func newInitCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "init",
+		Short: "Create config directory and default config",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			root := filepath.Join(home, ".teeny-claw")
+			for _, dir := range []string{"workspace", "sessions", "tools"} {
+				if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+					return err
+				}
+			}
+
+			files := map[string]any{
+				"config.json": config.Default(),
+				"daemon.json": scheduler.DaemonConfig{Jobs: []scheduler.Job{}},
+			}
+			for name, v := range files {
+				data, _ := json.MarshalIndent(v, "", "  ")
+				if err := writeIfMissing(filepath.Join(root, name), append(data, '\n')); err != nil {
+					return err
+				}
+			}
+			if err := writeIfMissing(filepath.Join(root, "workspace", "AGENTS.md"), []byte(defaultAgentsMD)); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Initialized %s\n", root)
+			return nil
+		},
+	}
+}
+
+// writeIfMissing writes data to path unless the file already exists.
+func writeIfMissing(path string, data []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,101 @@
+// Command teeny is the teeny-orchestrator CLI.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
+	"github.com/rcliao/teeny-orchestrator/pkg/config"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// globalOptions holds flags shared by all subcommands.
+type globalOptions struct {
+	configPath    string
+	session       string
+	verbose       bool
+	maxIterations int
+	system        string
+	model         string
+	dryRun        string
+}
+
+func main() {
+	// Runs started from the command line are audited as the local user;
+	// the daemon names each run's own trigger instead
+	actor := "cli"
+	if u, err := user.Current(); err == nil {
+		actor += ":" + u.Username
+	}
+	if err := newRootCmd().ExecuteContext(audit.WithActor(context.Background(), actor)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &globalOptions{}
+
+	root := &cobra.Command{
+		Use:           "teeny",
+		Short:         "A lightweight autonomous agent runtime",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&opts.configPath, "config", config.DefaultPath, "Config file path (.json, .yaml, or .toml)")
+	flags.StringVarP(&opts.session, "session", "s", "", "Session name (default: generates one)")
+	flags.BoolVarP(&opts.verbose, "verbose", "v", false, "Verbose logging")
+	flags.IntVar(&opts.maxIterations, "max-iterations", 0, "Max tool-call loops (default from config, 20)")
+	flags.StringVar(&opts.system, "system", "", "Override system prompt")
+	flags.StringVar(&opts.model, "model", "", "Model override for this run")
+	flags.StringVar(&opts.dryRun, "dry-run", "", `Describe tool calls instead of running them: "all", or "writes" to still run read-only tools`)
+	flags.Lookup("dry-run").NoOptDefVal = string(toolreg.DryRunAll)
+
+	root.AddCommand(
+		newInitCmd(),
+		newRunCmd(opts),
+		newChatCmd(opts),
+		newDaemonCmd(opts),
+		newJobCmd(opts),
+		newHeartbeatCmd(opts),
+		newEvalCmd(opts),
+		newMemoryCmd(opts),
+		newSessionsCmd(opts),
+		newToolsCmd(opts),
+		newAuditCmd(opts),
+		newReplayCmd(opts),
+		newArchiveCmd(opts),
+	)
+	return root
+}
+
+// loadConfig loads the config file and applies the flags that override it.
+func (o *globalOptions) loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(o.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	if o.dryRun != "" {
+		if _, err := toolreg.ParseDryRun(o.dryRun); err != nil {
+			return nil, fmt.Errorf("--dry-run: %w", err)
+		}
+		cfg.Tools.DryRun = o.dryRun
+	}
+	return cfg, nil
+}
+
+// sessionKey returns the --session flag or a generated key.
+func (o *globalOptions) sessionKey(prefix string) string {
+	if o.session != "" {
+		return o.session
+	}
+	return prefix + "-" + time.Now().Format("20060102-150405")
+}
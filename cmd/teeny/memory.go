@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/config"
+	"github.com/rcliao/teeny-orchestrator/pkg/memory"
+)
+
+func newMemoryCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "memory",
+		Short: "Manage stored learnings",
+	}
+
+	// withStore opens the configured memory store for the duration of fn.
+	withStore := func(fn func(*memory.Store) error) error {
+		cfg, err := config.Load(opts.configPath)
+		if err != nil {
+			return err
+		}
+		if cfg.Eval.Memory == "" {
+			return fmt.Errorf("no memory store configured (set eval.memory in config)")
+		}
+		store, err := memory.Open(config.ExpandHome(cfg.Eval.Memory))
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		if err := useEmbedder(store, cfg.Embedding); err != nil {
+			return err
+		}
+		return fn(store)
+	}
+	parseID := func(s string) (int64, error) {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid memory id %q", s)
+		}
+		return id, nil
+	}
+
+	var tags []string
+	addCmd := &cobra.Command{
+		Use:   "add <text>",
+		Short: "Store a learning",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s *memory.Store) error {
+				id, err := s.Add(cmd.Context(), strings.Join(args, " "), tags)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Stored memory %d\n", id)
+				return nil
+			})
+		},
+	}
+	addCmd.Flags().StringSliceVarP(&tags, "tag", "t", nil, "Tag (repeatable or comma-separated)")
+	cmd.AddCommand(addCmd)
+
+	var limit int
+	searchCmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Find learnings related to a query, best match first",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withStore(func(s *memory.Store) error {
+				found, err := s.Recall(cmd.Context(), strings.Join(args, " "), limit)
+				if err != nil {
+					return err
+				}
+				for _, m := range found {
+					fmt.Fprintf(cmd.OutOrStdout(), "%d\t%s", m.ID, m.Content)
+					if len(m.Tags) > 0 {
+						fmt.Fprintf(cmd.OutOrStdout(), " [%s]", strings.Join(m.Tags, ","))
+					}
+					fmt.Fprintln(cmd.OutOrStdout())
+				}
+				return nil
+			})
+		},
+	}
+	searchCmd.Flags().IntVarP(&limit, "limit", "n", 10, "Maximum results")
+	cmd.AddCommand(searchCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "tag <id> <tag>...",
+		Short: "Add tags to a learning",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			return withStore(func(s *memory.Store) error {
+				return s.Tag(cmd.Context(), id, args[1:]...)
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a learning",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := parseID(args[0])
+			if err != nil {
+				return err
+			}
+			return withStore(func(s *memory.Store) error {
+				return s.Delete(cmd.Context(), id)
+			})
+		},
+	})
+
+	return cmd
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/config"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/pgstore"
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
+)
+
+func newReplayCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "replay <transcript.jsonl | run ID>",
+		Short: "Re-run a recorded run with its recorded LLM replies and tool results",
+		Long: "Replay drives the loop through a run from loop.transcripts again, answering each\n" +
+			"LLM call and tool call from the recording, so nothing is sent or executed. It\n" +
+			"prints the tool calls as the replayed run makes them, then its answer, and fails\n" +
+			"if the run no longer makes the recorded calls. With postgres.transcripts, pass the\n" +
+			"run ID instead of a file; with archive.transcripts, a shipped run's ID or former\n" +
+			"path. Use -v to see the loop's log.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+			entries, err := readTranscript(cmd.Context(), cfg, args[0])
+			if err != nil {
+				return err
+			}
+			lc := loop.DefaultConfig()
+			lc.Verbose = opts.verbose
+			if cfg.Loop.MaxIterations > 0 {
+				lc.MaxIterations = cfg.Loop.MaxIterations
+			}
+			if opts.maxIterations > 0 {
+				lc.MaxIterations = opts.maxIterations
+			}
+			if cfg.Loop.RepeatLimit > 0 {
+				lc.RepeatLimit = cfg.Loop.RepeatLimit
+			}
+			if cfg.Loop.ArgRetries > 0 {
+				lc.ArgRetries = cfg.Loop.ArgRetries
+			}
+			if cfg.Loop.MaxContinues > 0 {
+				lc.MaxContinues = cfg.Loop.MaxContinues
+			}
+			lc.ReflectionEnabled = cfg.Loop.Reflection
+			lc.ReflectionModel = cfg.Loop.ReflectionModel
+
+			out := cmd.OutOrStdout()
+			answer, err := loop.Replay(cmd.Context(), entries, lc, loop.RunOptions{OnEvent: func(e loop.Event) {
+				if e.Type == loop.EventToolEnd {
+					fmt.Fprintf(out, "[%d] %s(%s)\n    → %s\n", e.Iteration, e.ToolCall.Name, e.ToolCall.Arguments, oneLine(e.Result, 200))
+				}
+			}})
+			var div *loop.DivergenceError
+			if errors.As(err, &div) {
+				return err
+			}
+			if err != nil {
+				fmt.Fprintf(out, "\nThe run failed, as recorded: %v\n", err)
+				return nil
+			}
+			fmt.Fprintf(out, "\n%s\n", answer)
+			return nil
+		},
+	}
+}
+
+// readTranscript loads a transcript file or, when no such file exists, a
+// run's transcript from the database (postgres.transcripts) or the archive
+// bucket (archive.transcripts).
+func readTranscript(ctx context.Context, cfg *config.Config, arg string) ([]transcript.Entry, error) {
+	if _, err := os.Stat(arg); err != nil && cfg.Archive.Transcripts.Enabled && !cfg.Postgres.Transcripts {
+		// A run ID, or the path of a transcript shipped since
+		run := strings.TrimSuffix(filepath.Base(arg), ".jsonl")
+		entries, err := transcriptArchive(cfg).Fetch(ctx, run)
+		if err == nil && entries == nil {
+			err = fmt.Errorf("no transcript file or archived run %s", run)
+		}
+		return entries, err
+	}
+	if _, err := os.Stat(arg); err == nil || !cfg.Postgres.Transcripts {
+		return transcript.Read(arg)
+	}
+	db, err := pgstore.Open(ctx, cfg.Postgres.DSN())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	entries, err := db.Transcripts().Entries(ctx, arg)
+	if err == nil && len(entries) == 0 {
+		err = fmt.Errorf("no transcript file or run %s", arg)
+	}
+	return entries, err
+}
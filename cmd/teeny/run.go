@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func newRunCmd(opts *globalOptions) *cobra.Command {
+	var images, files []string
+	var tags map[string]string
+	cmd := &cobra.Command{
+		Use:   "run <prompt>",
+		Short: "One-shot: run prompt, print result, exit",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prompt := strings.Join(args, " ")
+			if prompt == "" && !isTerminal(os.Stdin) {
+				data, err := io.ReadAll(cmd.InOrStdin())
+				if err != nil {
+					return err
+				}
+				prompt = strings.TrimSpace(string(data))
+			}
+			if prompt == "" {
+				return fmt.Errorf("no message provided (pass a prompt or pipe one on stdin)")
+			}
+
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+
+			ctx := cmd.Context()
+			runOpts := a.runOptions("")
+			for _, src := range images {
+				img, err := provider.LoadImage(src)
+				if err != nil {
+					return err
+				}
+				runOpts.Images = append(runOpts.Images, img)
+			}
+			loader := a.attachments()
+			for _, path := range files {
+				doc, err := loader.Load(ctx, path)
+				if err != nil {
+					return err
+				}
+				runOpts.Documents = append(runOpts.Documents, doc)
+			}
+
+			a.loadLearnings(ctx, prompt)
+			var usd float64
+			runOpts.Cost = &usd
+			runOpts.Tags = tags
+			if isTerminal(os.Stdin) {
+				runOpts.Ask = askTerminal(cmd)
+			}
+			result, err := a.newLoop(opts.sessionKey("run")).RunWith(ctx, prompt, runOpts)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), result)
+			if opts.verbose {
+				fmt.Fprintf(cmd.ErrOrStderr(), "cost: $%.4f\n", usd)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&images, "image", nil, "Attach an image file or URL to the prompt (repeatable)")
+	cmd.Flags().StringArrayVar(&files, "file", nil, "Attach a PDF or text file to the prompt (repeatable)")
+	cmd.Flags().StringToStringVar(&tags, "tag", nil, "Label the run's messages in the session, as key=value (repeatable)")
+	return cmd
+}
+
+func newChatCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "chat",
+		Short: "Interactive REPL with session persistence",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+
+			ctx := cmd.Context()
+			a.loadLearnings(ctx, "")
+			key := opts.sessionKey("chat")
+			al := a.newLoop(key)
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Session %s. Type \"exit\" to quit.\n", key)
+			// Lines typed mid-run steer it; piped input is queued instead.
+			interactive := isTerminal(os.Stdin)
+			if interactive {
+				fmt.Fprintln(out, "While a run is in progress, type to steer it or press Ctrl-C to interrupt it.")
+			}
+			var pending []string
+			// Questions from user.ask take the next typed line as the answer.
+			questions := make(chan question)
+			var asking *question
+
+			// Read input in the background so a run can be steered.
+			lines := make(chan string)
+			go func() {
+				defer close(lines)
+				scanner := bufio.NewScanner(cmd.InOrStdin())
+				scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, os.Interrupt)
+			defer signal.Stop(sigs)
+
+			for {
+				fmt.Fprint(out, "> ")
+				var line string
+				if len(pending) > 0 {
+					line, pending = pending[0], pending[1:]
+				} else {
+					if lines == nil {
+						fmt.Fprintln(out)
+						return nil
+					}
+					select {
+					case l, ok := <-lines:
+						if !ok {
+							fmt.Fprintln(out)
+							return nil
+						}
+						line = l
+					case <-sigs:
+						fmt.Fprintln(out)
+						return nil
+					}
+				}
+				line = strings.TrimSpace(line)
+				switch line {
+				case "":
+					continue
+				case "exit", "quit":
+					return nil
+				}
+
+				type runResult struct {
+					text string
+					err  error
+				}
+				done := make(chan runResult, 1)
+				runOpts := a.runOptions("")
+				if interactive {
+					runOpts.Ask = func(ctx context.Context, q string) (string, error) {
+						reply := make(chan string, 1)
+						select {
+						case questions <- question{text: q, reply: reply}:
+						case <-ctx.Done():
+							return "", ctx.Err()
+						}
+						select {
+						case answer := <-reply:
+							return answer, nil
+						case <-ctx.Done():
+							return "", ctx.Err()
+						}
+					}
+				}
+				go func() {
+					text, err := al.RunWith(ctx, line, runOpts)
+					done <- runResult{text, err}
+				}()
+
+			wait:
+				for {
+					select {
+					case res := <-done:
+						switch {
+						case errors.Is(res.err, loop.ErrInterrupted):
+							fmt.Fprintln(out, "[interrupted]")
+						case res.err != nil:
+							fmt.Fprintln(cmd.ErrOrStderr(), "Error:", res.err)
+						default:
+							fmt.Fprintln(out, res.text)
+						}
+						asking = nil
+						break wait
+					case q := <-questions:
+						fmt.Fprintf(out, "? %s\n", q.text)
+						asking = &q
+					case <-sigs:
+						al.Interrupt(key)
+					case l, ok := <-lines:
+						if !ok {
+							lines = nil
+							continue
+						}
+						if !interactive {
+							pending = append(pending, l)
+							continue
+						}
+						if asking != nil {
+							asking.reply <- strings.TrimSpace(l)
+							asking = nil
+							continue
+						}
+						if steer := strings.TrimSpace(l); steer != "" && al.Steer(key, steer) {
+							fmt.Fprintln(out, "[steering queued]")
+						}
+					}
+				}
+			}
+		},
+	}
+}
+
+// question is a user.ask call waiting for the next line typed in chat.
+type question struct {
+	text  string
+	reply chan string
+}
+
+// askTerminal answers user.ask by prompting on stderr and reading a line
+// from stdin.
+func askTerminal(cmd *cobra.Command) loop.AskFunc {
+	in := bufio.NewReader(cmd.InOrStdin())
+	return func(ctx context.Context, q string) (string, error) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "? %s\n> ", q)
+		answer, err := in.ReadString('\n')
+		if err != nil && answer == "" {
+			return "", fmt.Errorf("read answer: %w", err)
+		}
+		return strings.TrimSpace(answer), nil
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
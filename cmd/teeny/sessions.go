@@ -0,0 +1,342 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/config"
+	"github.com/rcliao/teeny-orchestrator/pkg/eval"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+)
+
+func newSessionsCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "Inspect stored sessions",
+	}
+
+	manager := func() (*session.Manager, error) {
+		cfg, err := config.Load(opts.configPath)
+		if err != nil {
+			return nil, err
+		}
+		return openSessions(cfg, nil)
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List sessions, most recent first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := manager()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tMESSAGES\tCOST\tUPDATED\tPARENT")
+			for _, s := range m.List() {
+				fmt.Fprintf(w, "%s\t%d\t$%.4f\t%s\t%s\n", s.Key, s.Messages, s.CostUSD, s.Updated.Format("2006-01-02 15:04"), s.Parent)
+			}
+			return w.Flush()
+		},
+	})
+
+	var showMeta bool
+	showCmd := &cobra.Command{
+		Use:   "show <key>",
+		Short: "Print a session's messages",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := manager()
+			if err != nil {
+				return err
+			}
+			history := m.GetHistory(args[0])
+			if history == nil {
+				return fmt.Errorf("unknown session: %s", args[0])
+			}
+			out := cmd.OutOrStdout()
+			if summary := m.GetSummary(args[0]); summary != "" {
+				fmt.Fprintf(out, "[summary]\n%s\n\n", summary)
+			}
+			for _, msg := range history {
+				fmt.Fprintf(out, "[%s]", msg.Role)
+				for _, tc := range msg.ToolCalls {
+					fmt.Fprintf(out, " %s(%s)", tc.Name, tc.Arguments)
+				}
+				if showMeta && msg.Meta != nil {
+					fmt.Fprintf(out, " %s", formatMeta(msg.Meta))
+				}
+				fmt.Fprintf(out, "\n%s\n\n", msg.Content)
+			}
+			return nil
+		},
+	}
+	showCmd.Flags().BoolVar(&showMeta, "meta", false, "Show when each message was added, by which run, model, and channel, its cost, and its tags")
+	cmd.AddCommand(showCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "search <query>",
+		Short: "Find messages containing all query terms",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := manager()
+			if err != nil {
+				return err
+			}
+			matches := m.Search(strings.Join(args, " "))
+			if len(matches) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "No matches")
+				return nil
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\t#\tROLE\tSNIPPET")
+			for _, match := range matches {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", match.Key, match.Index, match.Role, match.Snippet)
+			}
+			return w.Flush()
+		},
+	})
+
+	var forkAt int
+	forkCmd := &cobra.Command{
+		Use:   "fork <src> <new>",
+		Short: "Copy a session (or its first --at messages) into a new session",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := manager()
+			if err != nil {
+				return err
+			}
+			at := forkAt
+			if at < 0 {
+				at = m.MessageCount(args[0])
+			}
+			if err := m.Fork(args[0], args[1], at); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Forked %s at message %d into %s\n", args[0], at, args[1])
+			return nil
+		},
+	}
+	forkCmd.Flags().IntVar(&forkAt, "at", -1, "Number of messages to keep (default: all)")
+	cmd.AddCommand(forkCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "resume <key>",
+		Short: "Finish a run that was cut short (needs loop.checkpoint)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+			if err := a.loadAgents(); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			ag := a.agentFor(args[0])
+			ag.loadLearnings(ctx, "")
+			runOpts := ag.runOptions("")
+			if isTerminal(os.Stdin) {
+				runOpts.Ask = askTerminal(cmd)
+			}
+			result, err := ag.newLoop(args[0]).ResumeWith(ctx, runOpts)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), result)
+			return nil
+		},
+	})
+
+	var compactKeep int
+	compactCmd := &cobra.Command{
+		Use:   "compact <key>",
+		Short: "Fold a session's older messages into its summary now, by session.compaction",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+			s := a.summarizer()
+			if s == nil {
+				return fmt.Errorf("no session.compaction.strategy is configured")
+			}
+			keep := compactKeep
+			if keep < 0 {
+				keep = cmp.Or(a.cfg.Session.Compaction.KeepLast, loop.DefaultConfig().CompactKeep)
+			}
+			before := a.sessions.MessageCount(args[0])
+			ok, err := a.sessions.Compact(cmd.Context(), args[0], s, keep)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Fprintln(cmd.ErrOrStderr(), "Nothing to compact")
+				return nil
+			}
+			if err := a.sessions.Save(args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "compacted %d of %d messages\n", before-a.sessions.MessageCount(args[0]), before)
+			return nil
+		},
+	}
+	compactCmd.Flags().IntVar(&compactKeep, "keep", -1, "Recent messages to keep (default: session.compaction.keep_last)")
+	cmd.AddCommand(compactCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete <key>",
+		Short: "Delete a session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := manager()
+			if err != nil {
+				return err
+			}
+			return m.Delete(args[0])
+		},
+	})
+
+	var asJSON bool
+	statsCmd := &cobra.Command{
+		Use:   "stats [key]",
+		Short: "Show message counts, tokens, and cost per session, most expensive first",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(opts.configPath)
+			if err != nil {
+				return err
+			}
+			m, err := openSessions(cfg, nil)
+			if err != nil {
+				return err
+			}
+			if cfg.Eval.DB != "" {
+				rec, err := eval.OpenSQLiteRecorder(config.ExpandHome(cfg.Eval.DB))
+				if err != nil {
+					return err
+				}
+				defer rec.Close()
+				m.SetUsage(sessionUsage(rec))
+			}
+
+			keys := args
+			if len(keys) == 0 {
+				for _, info := range m.List() {
+					keys = append(keys, info.Key)
+				}
+			}
+			var stats []session.Stats
+			for _, key := range keys {
+				st, err := m.Stats(key)
+				if err != nil {
+					return err
+				}
+				stats = append(stats, st)
+			}
+			slices.SortStableFunc(stats, func(a, b session.Stats) int { return cmp.Compare(b.CostUSD, a.CostUSD) })
+
+			out := cmd.OutOrStdout()
+			if asJSON {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(stats)
+			}
+			w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tMESSAGES\tUSER\tASSISTANT\tTOOL CALLS\tLLM CALLS\tPROMPT TOKENS\tCOMPLETION TOKENS\tCOST")
+			for _, st := range stats {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t$%.4f\n", st.Key, st.Messages, st.ByRole["user"], st.ByRole["assistant"],
+					st.ToolCalls, st.Calls, st.PromptTokens, st.CompletionTokens, st.CostUSD)
+			}
+			return w.Flush()
+		},
+	}
+	statsCmd.Flags().BoolVar(&asJSON, "json", false, "Print the stats as JSON")
+	cmd.AddCommand(statsCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "prune",
+		Short: "Archive and delete idle sessions now, by session.retention",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(opts.configPath)
+			if err != nil {
+				return err
+			}
+			policies, err := cfg.Session.RetentionPolicies()
+			if err != nil {
+				return err
+			}
+			if len(policies) == 0 {
+				return fmt.Errorf("no session.retention policies are configured")
+			}
+			m, err := openSessions(cfg, nil)
+			if err != nil {
+				return err
+			}
+			res, err := m.Prune(policies, time.Now())
+			out := cmd.OutOrStdout()
+			for _, key := range res.Archived {
+				fmt.Fprintf(out, "archived %s\n", key)
+			}
+			for _, key := range res.Deleted {
+				fmt.Fprintf(out, "deleted  %s\n", key)
+			}
+			return err
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "restore <key>",
+		Short: "Move an archived session back",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := manager()
+			if err != nil {
+				return err
+			}
+			return m.Restore(args[0])
+		},
+	})
+
+	return cmd
+}
+
+// formatMeta renders message metadata for sessions show, e.g.
+// "(2026-01-02 15:04:05 run=abc slack claude-sonnet $0.0123 ticket=T-1)".
+func formatMeta(m *provider.Meta) string {
+	parts := []string{m.Time.Format("2006-01-02 15:04:05")}
+	if m.RunID != "" {
+		parts = append(parts, "run="+m.RunID)
+	}
+	if m.Channel != "" {
+		parts = append(parts, m.Channel)
+	}
+	if m.Model != "" {
+		parts = append(parts, m.Model)
+	}
+	if m.CostUSD > 0 {
+		parts = append(parts, fmt.Sprintf("$%.4f", m.CostUSD))
+	}
+	for _, k := range slices.Sorted(maps.Keys(m.Tags)) {
+		parts = append(parts, k+"="+m.Tags[k])
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
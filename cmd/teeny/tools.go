@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func newToolsCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tools",
+		Short: "Inspect available tools",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List discovered tool commands",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := newApp(*opts)
+			if err != nil {
+				return err
+			}
+			defer a.close()
+
+			defs := a.registry.ToToolDefs()
+			sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "TOOL\tDESCRIPTION")
+			for _, d := range defs {
+				fmt.Fprintf(w, "%s\t%s\n", d.Name, d.Description)
+			}
+			return w.Flush()
+		},
+	})
+
+	return cmd
+}
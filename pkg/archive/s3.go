@@ -0,0 +1,382 @@
+// Package archive ships data a long-running daemon would otherwise keep on
+// local disk forever to S3-compatible object storage: finished run
+// transcripts (Transcripts) and archived sessions (Sessions). Bucket
+// lifecycle rules (SetLifecycle) then move old objects to cheaper storage
+// and expire them.
+package archive
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultRegion is the region a Bucket signs for when none is set.
+const DefaultRegion = "us-east-1"
+
+// Bucket is an S3 bucket, on AWS or any service speaking its API, such as
+// MinIO or R2. Requests are signed with AWS Signature Version 4.
+type Bucket struct {
+	Name         string
+	Region       string // Default DefaultRegion
+	Endpoint     string // Service URL (default https://s3.<region>.amazonaws.com)
+	PathStyle    bool   // Address the bucket as <endpoint>/<bucket> rather than <bucket>.<endpoint host>
+	AccessKey    string
+	SecretKey    string
+	SessionToken string       // For temporary credentials
+	Client       *http.Client // Default one with a one-minute timeout
+
+	now func() time.Time // For tests
+}
+
+// Object is a listed object.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Put stores data under key.
+func (b *Bucket) Put(ctx context.Context, key string, data []byte) error {
+	return b.PutMeta(ctx, key, data, nil)
+}
+
+// PutMeta stores data under key with user metadata, which Meta returns.
+// Metadata names are case-insensitive.
+func (b *Bucket) PutMeta(ctx context.Context, key string, data []byte, meta map[string]string) error {
+	header := http.Header{}
+	for k, v := range meta {
+		header.Set("X-Amz-Meta-"+k, v)
+	}
+	resp, err := b.do(ctx, http.MethodPut, key, nil, data, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Meta returns the user metadata of the object stored under key, by
+// lowercase name, or nil if there is no such object.
+func (b *Bucket) Meta(ctx context.Context, key string) (map[string]string, error) {
+	resp, err := b.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	meta := make(map[string]string)
+	for k, v := range resp.Header {
+		if name, ok := strings.CutPrefix(strings.ToLower(k), "x-amz-meta-"); ok && len(v) > 0 {
+			meta[name] = v[0]
+		}
+	}
+	return meta, nil
+}
+
+// Get returns the object stored under key, or nil if there is none.
+func (b *Bucket) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: get %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// Delete removes the object stored under key, if any.
+func (b *Bucket) Delete(ctx context.Context, key string) error {
+	resp, err := b.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List returns the objects whose keys start with prefix, in key order.
+func (b *Bucket) List(ctx context.Context, prefix string) ([]Object, error) {
+	var out []Object
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := b.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: list %s: %w", prefix, err)
+		}
+		for _, c := range page.Contents {
+			out = append(out, Object{Key: c.Key, Size: c.Size, LastModified: c.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return out, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// Rule is a lifecycle rule for the objects whose keys start with Prefix.
+type Rule struct {
+	ID             string
+	Prefix         string
+	TransitionDays int    // Days after creation to move objects to StorageClass (0 = never)
+	StorageClass   string // e.g. GLACIER or STANDARD_IA
+	ExpireDays     int    // Days after creation to delete objects (0 = never)
+}
+
+// SetLifecycle replaces the bucket's lifecycle configuration with rules.
+// It needs the s3:PutLifecycleConfiguration permission, and replaces any
+// rules set by other means, so give teeny a bucket of its own.
+func (b *Bucket) SetLifecycle(ctx context.Context, rules []Rule) error {
+	type transition struct {
+		Days         int
+		StorageClass string
+	}
+	type expiration struct {
+		Days int
+	}
+	type rule struct {
+		ID         string
+		Filter     struct{ Prefix string }
+		Status     string
+		Transition *transition `xml:",omitempty"`
+		Expiration *expiration `xml:",omitempty"`
+	}
+	var cfg struct {
+		XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LifecycleConfiguration"`
+		Rules   []rule   `xml:"Rule"`
+	}
+	for _, r := range rules {
+		x := rule{ID: r.ID, Status: "Enabled"}
+		x.Filter.Prefix = r.Prefix
+		if r.TransitionDays > 0 {
+			x.Transition = &transition{Days: r.TransitionDays, StorageClass: r.StorageClass}
+		}
+		if r.ExpireDays > 0 {
+			x.Expiration = &expiration{Days: r.ExpireDays}
+		}
+		if x.Transition != nil || x.Expiration != nil {
+			cfg.Rules = append(cfg.Rules, x)
+		}
+	}
+
+	var resp *http.Response
+	var err error
+	if len(cfg.Rules) == 0 {
+		resp, err = b.do(ctx, http.MethodDelete, "", url.Values{"lifecycle": {""}}, nil, nil)
+	} else {
+		body, merr := xml.Marshal(cfg)
+		if merr != nil {
+			return merr
+		}
+		sum := md5.Sum(body)
+		header := http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])}}
+		resp, err = b.do(ctx, http.MethodPut, "", url.Values{"lifecycle": {""}}, body, header)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for key (or the bucket, if ""), returning the
+// response if it succeeded or, for a GET or HEAD, was a 404.
+func (b *Bucket) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	req, err := b.request(ctx, method, key, query, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	b.sign(req, body)
+
+	client := b.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %s %s: %w", method, cmp.Or(key, b.Name), err)
+	}
+	if resp.StatusCode < 300 || ((method == http.MethodGet || method == http.MethodHead) && key != "" && resp.StatusCode == http.StatusNotFound) {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var e struct{ Code, Message string }
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return nil, fmt.Errorf("s3: %s %s: %s: %s", method, cmp.Or(key, b.Name), e.Code, e.Message)
+	}
+	return nil, fmt.Errorf("s3: %s %s: %s", method, cmp.Or(key, b.Name), resp.Status)
+}
+
+var defaultClient = &http.Client{Timeout: time.Minute}
+
+// request builds an unsigned request.
+func (b *Bucket) request(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Request, error) {
+	region := cmp.Or(b.Region, DefaultRegion)
+	endpoint := cmp.Or(b.Endpoint, "https://s3."+region+".amazonaws.com")
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: endpoint: %w", err)
+	}
+	p := "/" + key
+	if b.PathStyle {
+		p = "/" + b.Name + p
+	} else {
+		u.Host = b.Name + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + p
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	return req, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req, signing the host and
+// every header already set.
+func (b *Bucket) sign(req *http.Request, body []byte) {
+	now := time.Now
+	if b.now != nil {
+		now = b.now
+	}
+	t := now().UTC()
+	stamp := t.Format("20060102T150405Z")
+	date := stamp[:8]
+	region := cmp.Or(b.Region, DefaultRegion)
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if b.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signed,
+		payload,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+b.SecretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+b.AccessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes q sorted by key, as SigV4 wants it.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, escape(k)+"="+escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escapePath escapes each segment of p, keeping the slashes.
+func escapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = escape(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+// escape percent-encodes every byte but the unreserved characters of RFC
+// 3986, as SigV4 requires.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+)
+
+// Sessions is a session.Archive in a bucket, for session.WithArchive.
+// Each archived session is an object under Prefix + "sessions/", holding
+// what the session manager archived: gzipped JSON (".json.gz"), or that
+// encrypted (".json.gz.enc") if sessions are. The session's last update
+// is kept in the object's metadata.
+type Sessions struct {
+	Bucket *Bucket
+	Prefix string
+}
+
+var _ session.Archive = (*Sessions)(nil)
+
+const (
+	sessionExt          = ".json.gz"
+	encryptedSessionExt = ".json.gz.enc"
+
+	updatedMeta = "updated" // Metadata holding the session's last update
+)
+
+// gzipMagic starts every gzip stream; encrypted archives don't.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func (s *Sessions) key(name, ext string) string {
+	return s.Prefix + "sessions/" + name + ext
+}
+
+func (s *Sessions) Archive(name string, data []byte, updated time.Time) error {
+	ext := sessionExt
+	if !bytes.HasPrefix(data, gzipMagic) {
+		ext = encryptedSessionExt
+	}
+	meta := map[string]string{updatedMeta: updated.UTC().Format(time.RFC3339Nano)}
+	return s.Bucket.PutMeta(context.Background(), s.key(name, ext), data, meta)
+}
+
+func (s *Sessions) Archived(name string) ([]byte, error) {
+	for _, ext := range []string{encryptedSessionExt, sessionExt} {
+		data, err := s.Bucket.Get(context.Background(), s.key(name, ext))
+		if data != nil || err != nil {
+			return data, err
+		}
+	}
+	return nil, nil
+}
+
+// Archives reports the last update kept with each archive, or when it was
+// stored for objects without one.
+func (s *Sessions) Archives() (map[string]time.Time, error) {
+	ctx := context.Background()
+	objects, err := s.Bucket.List(ctx, s.Prefix+"sessions/")
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]time.Time, len(objects))
+	for _, o := range objects {
+		name, ok := sessionName(strings.TrimPrefix(o.Key, s.Prefix+"sessions/"))
+		if !ok {
+			continue
+		}
+		out[name] = o.LastModified
+		meta, err := s.Bucket.Meta(ctx, o.Key)
+		if err != nil {
+			return nil, err
+		}
+		if updated, err := time.Parse(time.RFC3339Nano, meta[updatedMeta]); err == nil {
+			out[name] = updated
+		}
+	}
+	return out, nil
+}
+
+// sessionName returns the name of the session in an archive object.
+func sessionName(file string) (string, bool) {
+	for _, ext := range []string{encryptedSessionExt, sessionExt} {
+		if name, ok := strings.CutSuffix(file, ext); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (s *Sessions) DeleteArchive(name string) error {
+	for _, ext := range []string{sessionExt, encryptedSessionExt} {
+		if err := s.Bucket.Delete(context.Background(), s.key(name, ext)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
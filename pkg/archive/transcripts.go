@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
+)
+
+// DefaultAfter is how long a finished transcript stays on disk by default.
+const DefaultAfter = time.Hour
+
+// Transcripts ships the transcript files of finished runs from Dir to a
+// bucket, under Prefix + "transcripts/YYYY/MM/DD/<run>.jsonl.gz" by the
+// day the run started, and removes them from disk.
+type Transcripts struct {
+	Bucket *Bucket
+	Prefix string
+	Dir    string
+	After  time.Duration // How long after its last write a finished transcript is shipped (default DefaultAfter)
+}
+
+// key returns the object key of run, whose ID starts with its start time.
+func (t *Transcripts) key(run string) string {
+	day := "unknown"
+	if ts, err := time.Parse("20060102", run[:min(len(run), 8)]); err == nil {
+		day = ts.Format("2006/01/02")
+	}
+	return t.Prefix + "transcripts/" + day + "/" + run + ".jsonl.gz"
+}
+
+// Ship uploads the transcripts that finished and haven't been written to
+// for After as of now, returning the IDs of the runs shipped. A run that
+// never finished, e.g. because the daemon died mid-run, stays on disk.
+func (t *Transcripts) Ship(ctx context.Context, now time.Time) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(t.Dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	after := cmp.Or(t.After, DefaultAfter)
+	var shipped []string
+	var errs []error
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return shipped, err
+		}
+		info, err := os.Stat(path)
+		if err != nil || now.Sub(info.ModTime()) < after {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !finished(data) {
+			continue
+		}
+		run := strings.TrimSuffix(filepath.Base(path), ".jsonl")
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := t.Bucket.Put(ctx, t.key(run), buf.Bytes()); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		shipped = append(shipped, run)
+	}
+	return shipped, errors.Join(errs...)
+}
+
+// finished reports whether the last entry of a transcript ends the run.
+func finished(data []byte) bool {
+	data = bytes.TrimRight(data, "\n")
+	last := data[bytes.LastIndexByte(data, '\n')+1:]
+	var e struct{ Type string }
+	return json.Unmarshal(last, &e) == nil && e.Type == transcript.TypeEnd
+}
+
+// Fetch returns the entries of a shipped run, or nil if it isn't in the
+// bucket.
+func (t *Transcripts) Fetch(ctx context.Context, run string) ([]transcript.Entry, error) {
+	data, err := t.Bucket.Get(ctx, t.key(run))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("archive: transcript %s: %w", run, err)
+	}
+	var entries []transcript.Entry
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e transcript.Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("archive: transcript %s: %w", run, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("archive: transcript %s: %w", run, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,124 @@
+// Package attach loads files for attaching to a user message.
+//
+// PDFs are sent to providers that read them natively (Anthropic document
+// blocks) as-is, and their text is extracted with pdftotext for the rest.
+// Extracted text is cached by content hash, so attaching the same PDF again
+// skips the extraction.
+package attach
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// Config for a Loader.
+type Config struct {
+	MaxBytes  int64  // Largest file accepted (default 10 MB)
+	MaxText   int    // Text beyond this many bytes is truncated (default 256 KB)
+	CacheDir  string // Where extracted PDF text is cached ("" = no cache)
+	PDFToText string // pdftotext binary (default "pdftotext")
+}
+
+// Loader turns files into provider.Documents.
+type Loader struct {
+	cfg Config
+}
+
+// New creates a loader, filling in defaults.
+func New(cfg Config) *Loader {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 10 << 20
+	}
+	if cfg.MaxText <= 0 {
+		cfg.MaxText = 256 << 10
+	}
+	if cfg.PDFToText == "" {
+		cfg.PDFToText = "pdftotext"
+	}
+	return &Loader{cfg: cfg}
+}
+
+// Load reads a PDF or UTF-8 text file. A PDF whose text can't be extracted
+// is still attached; providers without native PDF support then get the
+// file itself.
+func (l *Loader) Load(ctx context.Context, path string) (provider.Document, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return provider.Document{}, fmt.Errorf("attach: %w", err)
+	}
+	if info.Size() > l.cfg.MaxBytes {
+		return provider.Document{}, fmt.Errorf("attach: %s is %d bytes, over the %d byte limit", path, info.Size(), l.cfg.MaxBytes)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return provider.Document{}, fmt.Errorf("attach: %w", err)
+	}
+
+	doc := provider.Document{Name: filepath.Base(path)}
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		doc.MediaType = provider.MediaTypePDF
+		doc.Data = base64.StdEncoding.EncodeToString(data)
+		text, err := l.extract(ctx, data)
+		if err != nil {
+			log.Printf("[attach] extract text from %s: %v", path, err)
+		}
+		doc.Text = l.truncate(text)
+	case utf8.Valid(data) && !bytes.ContainsRune(data, 0):
+		doc.MediaType = provider.MediaTypeText
+		doc.Text = l.truncate(string(data))
+	default:
+		return provider.Document{}, fmt.Errorf("attach: %s is neither a PDF nor a UTF-8 text file", path)
+	}
+	return doc, nil
+}
+
+// extract returns a PDF's text, from the cache when it has been seen.
+func (l *Loader) extract(ctx context.Context, pdf []byte) (string, error) {
+	sum := sha256.Sum256(pdf)
+	var cached string
+	if l.cfg.CacheDir != "" {
+		cached = filepath.Join(l.cfg.CacheDir, hex.EncodeToString(sum[:])+".txt")
+		if text, err := os.ReadFile(cached); err == nil {
+			return string(text), nil
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, l.cfg.PDFToText, "-layout", "-q", "-", "-")
+	cmd.Stdin = bytes.NewReader(pdf)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w: %s", l.cfg.PDFToText, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if cached != "" {
+		if err := os.MkdirAll(l.cfg.CacheDir, 0700); err != nil {
+			log.Printf("[attach] cache: %v", err)
+		} else if err := os.WriteFile(cached, stdout.Bytes(), 0600); err != nil {
+			log.Printf("[attach] cache: %v", err)
+		}
+	}
+	return stdout.String(), nil
+}
+
+// truncate caps text at MaxText bytes, noting how much was cut.
+func (l *Loader) truncate(text string) string {
+	if len(text) <= l.cfg.MaxText {
+		return text
+	}
+	kept := strings.ToValidUTF8(text[:l.cfg.MaxText], "")
+	return kept + fmt.Sprintf("\n[... truncated: %d of %d bytes shown]", len(kept), len(text))
+}
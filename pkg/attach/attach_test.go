@@ -0,0 +1,97 @@
+package attach
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// fakePDFToText writes a pdftotext stand-in that counts its runs in a file.
+func fakePDFToText(t *testing.T, dir string) (bin, runs string) {
+	t.Helper()
+	bin = filepath.Join(dir, "pdftotext")
+	runs = filepath.Join(dir, "runs")
+	script := "#!/bin/sh\necho run >> " + runs + "\necho 'Quarterly report'\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return bin, runs
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	bin, runs := fakePDFToText(t, dir)
+	files := map[string]string{
+		"report.pdf": "%PDF-1.7\n...",
+		"notes.md":   "# Notes\nship it",
+		"long.txt":   strings.Repeat("x", 100),
+		"blob.bin":   "\x00\x01\x02",
+	}
+	for name, data := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+	}
+	l := New(Config{MaxText: 50, CacheDir: filepath.Join(dir, "cache"), PDFToText: bin})
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		file      string
+		mediaType string
+		text      string // Prefix of Document.Text
+		err       string
+	}{
+		{"pdf", "report.pdf", provider.MediaTypePDF, "Quarterly report", ""},
+		{"text", "notes.md", provider.MediaTypeText, "# Notes\nship it", ""},
+		{"truncated", "long.txt", provider.MediaTypeText, strings.Repeat("x", 50) + "\n[... truncated: 50 of 100 bytes shown]", ""},
+		{"binary", "blob.bin", "", "", "neither a PDF nor"},
+		{"missing", "nope.txt", "", "", "no such file"},
+	}
+	for _, tt := range tests {
+		doc, err := l.Load(ctx, filepath.Join(dir, tt.file))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if doc.Name != tt.file || doc.MediaType != tt.mediaType || !strings.HasPrefix(doc.Text, tt.text) {
+			t.Errorf("%s: doc = %+v", tt.name, doc)
+		}
+		if (tt.mediaType == provider.MediaTypePDF) != (doc.Data != "") {
+			t.Errorf("%s: data = %q", tt.name, doc.Data)
+		}
+	}
+
+	// The second load of the same PDF comes from the cache.
+	if _, err := l.Load(ctx, filepath.Join(dir, "report.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(runs); strings.Count(string(data), "run") != 1 {
+		t.Errorf("pdftotext ran %d times, want 1", strings.Count(string(data), "run"))
+	}
+}
+
+func TestLoadLimits(t *testing.T) {
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big.txt")
+	os.WriteFile(big, []byte(strings.Repeat("a", 2048)), 0644)
+	if _, err := New(Config{MaxBytes: 1024}).Load(context.Background(), big); err == nil || !strings.Contains(err.Error(), "over the 1024 byte limit") {
+		t.Errorf("err = %v", err)
+	}
+
+	// Without pdftotext the PDF is still attached, just without text.
+	pdf := filepath.Join(dir, "scan.pdf")
+	os.WriteFile(pdf, []byte("%PDF-1.4"), 0644)
+	doc, err := New(Config{PDFToText: filepath.Join(dir, "missing")}).Load(context.Background(), pdf)
+	if err != nil || doc.Data == "" || doc.Text != "" {
+		t.Errorf("doc = %+v, err = %v", doc, err)
+	}
+}
@@ -0,0 +1,268 @@
+// Package audit keeps an append-only, tamper-evident log of what agent runs
+// did: who started them and through which channel, the tools they ran with
+// what arguments, and what they cost. Each line holds the SHA-256 of the
+// line before it, so editing or deleting a record breaks the chain.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/redact"
+)
+
+// Record types, in the order a run writes them.
+const (
+	TypeStart = "run_start" // A run began; Actor, Channel, Session, and Prompt are set
+	TypeTool  = "tool"      // A tool ran; Tool, Arguments, ExitCode, and Error are set
+	TypeEnd   = "run_end"   // The run finished; Error, Usage, and Cost are set
+)
+
+// maxField caps prompts and tool arguments, in bytes, so records stay small.
+const maxField = 4096
+
+// Record is one line of the audit log.
+type Record struct {
+	Seq        int64           `json:"seq"`
+	Time       time.Time       `json:"time"`
+	Type       string          `json:"type"`
+	Run        string          `json:"run"`               // Ties a run's records together; the transcript ID when transcripts are on
+	Session    string          `json:"session,omitempty"` // Session key
+	Channel    string          `json:"channel,omitempty"` // The run's intent, e.g. "slack", "webhook", "scheduled"
+	Actor      string          `json:"actor,omitempty"`   // Who started the run, e.g. "token:ops" or "hook:deploy"
+	Prompt     string          `json:"prompt,omitempty"`
+	Tool       string          `json:"tool,omitempty"`
+	Arguments  string          `json:"arguments,omitempty"`
+	ExitCode   int             `json:"exit_code,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Usage      *provider.Usage `json:"usage,omitempty"`
+	Cost       float64         `json:"cost_usd,omitempty"`
+	DurationMs int64           `json:"duration_ms,omitempty"`
+	Prev       string          `json:"prev"` // SHA-256 of the previous line, hex ("" for the first record)
+}
+
+type actorCtx struct{}
+
+// WithActor records who is starting the runs made with the returned
+// context.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorCtx{}, actor)
+}
+
+// ActorFrom returns the actor set with WithActor, or "".
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorCtx{}).(string)
+	return actor
+}
+
+// Log appends records to an audit file. A nil Log records nothing. Write
+// errors are logged, never returned, so a full disk doesn't fail runs.
+type Log struct {
+	path     string
+	redactor *redact.Redactor
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Open opens the audit log at path for appending, creating it and its
+// directory if needed.
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	return &Log{path: path, f: f}, nil
+}
+
+// SetRedactor masks secrets in prompts, arguments, and errors written from
+// now on.
+func (l *Log) SetRedactor(r *redact.Redactor) {
+	if l != nil {
+		l.redactor = r
+	}
+}
+
+// Close closes the file.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Start records a run beginning in session through channel and returns its
+// handle. The actor comes from ctx (see WithActor). runID is the run's
+// transcript ID, or "" to make one up.
+func (l *Log) Start(ctx context.Context, runID, session, channel, prompt string) *Run {
+	if l == nil {
+		return nil
+	}
+	if runID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		runID = hex.EncodeToString(b)
+	}
+	r := &Run{log: l, id: runID, start: time.Now()}
+	l.append(Record{Type: TypeStart, Run: runID, Session: session, Channel: channel, Actor: ActorFrom(ctx), Prompt: l.field(prompt)})
+	return r
+}
+
+// Run is the audit trail of one run. Its methods do nothing on a nil Run.
+type Run struct {
+	log   *Log
+	id    string
+	start time.Time
+}
+
+// Tool records a tool call that took d.
+func (r *Run) Tool(tc provider.ToolCall, exitCode int, d time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	rec := Record{Type: TypeTool, Run: r.id, Tool: tc.Name, Arguments: r.log.field(tc.Arguments), ExitCode: exitCode, DurationMs: d.Milliseconds()}
+	if err != nil {
+		rec.Error = r.log.field(err.Error())
+	}
+	r.log.append(rec)
+}
+
+// End records the run's outcome, token usage, and cost.
+func (r *Run) End(usage provider.Usage, usd float64, err error) {
+	if r == nil {
+		return
+	}
+	rec := Record{Type: TypeEnd, Run: r.id, Usage: &usage, Cost: usd, DurationMs: time.Since(r.start).Milliseconds()}
+	if err != nil {
+		rec.Error = r.log.field(err.Error())
+	}
+	r.log.append(rec)
+}
+
+// field redacts s and caps its length.
+func (l *Log) field(s string) string {
+	s = l.redactor.String(s)
+	if len(s) > maxField {
+		s = s[:maxField] + "…"
+	}
+	return s
+}
+
+// append chains rec to the last line of the file and writes it. The last
+// line is read again each time under an exclusive lock on the file, so
+// other processes appending to it (e.g. the CLI next to the daemon) don't
+// break the chain.
+func (l *Log) append(rec Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := lockFile(l.f); err != nil {
+		log.Printf("[audit] %s: lock: %v", l.path, err)
+		return
+	}
+	defer unlockFile(l.f)
+
+	last, err := lastLine(l.f)
+	if err != nil {
+		log.Printf("[audit] %s: %v", l.path, err)
+		return
+	}
+	if len(last) > 0 {
+		var prev Record
+		if err := json.Unmarshal(last, &prev); err != nil {
+			log.Printf("[audit] %s: last record: %v", l.path, err)
+			return
+		}
+		rec.Seq = prev.Seq + 1
+		rec.Prev = hash(last)
+	} else {
+		rec.Seq = 1
+	}
+	rec.Time = time.Now().UTC()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("[audit] %v", err)
+		return
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		log.Printf("[audit] %s: %v", l.path, err)
+		return
+	}
+	if err := l.f.Sync(); err != nil {
+		log.Printf("[audit] %s: %v", l.path, err)
+	}
+}
+
+// lastLine returns the file's last line without its newline, or nil if the
+// file is empty.
+func lastLine(f *os.File) ([]byte, error) {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil || end == 0 {
+		return nil, err
+	}
+	const chunk = 8192
+	var tail []byte
+	for pos := end; pos > 0; {
+		n := min(int64(chunk), pos)
+		pos -= n
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, pos); err != nil {
+			return nil, err
+		}
+		tail = append(buf, tail...)
+		if i := bytes.LastIndexByte(bytes.TrimSuffix(tail, []byte("\n")), '\n'); i >= 0 {
+			return bytes.TrimSuffix(tail[i+1:], []byte("\n")), nil
+		}
+	}
+	return bytes.TrimSuffix(tail, []byte("\n")), nil
+}
+
+func hash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify checks the chain of an audit log: every record's prev must be the
+// hash of the line before it, and sequence numbers must count up from 1.
+// It returns the number of records and the hash of the last line. Keep the
+// hash somewhere else to detect records removed from the end later.
+func Verify(r io.Reader) (records int, head string, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return records, head, fmt.Errorf("audit: line %d: %w", records+1, err)
+		}
+		if rec.Prev != head {
+			return records, head, fmt.Errorf("audit: line %d: chain broken: prev is %q, want %q", records+1, rec.Prev, head)
+		}
+		if rec.Seq != int64(records+1) {
+			return records, head, fmt.Errorf("audit: line %d: seq is %d, want %d", records+1, rec.Seq, records+1)
+		}
+		records++
+		head = hash(line)
+	}
+	if err := sc.Err(); err != nil {
+		return records, head, fmt.Errorf("audit: %w", err)
+	}
+	return records, head, nil
+}
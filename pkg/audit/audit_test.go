@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/redact"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := redact.New()
+	r.AddValues("hunter2-password")
+	l.SetRedactor(r)
+
+	ctx := WithActor(context.Background(), "token:ops")
+	run := l.Start(ctx, "run1", "main", "api", "deploy with hunter2-password")
+	run.Tool(provider.ToolCall{Name: "shell.run", Arguments: `{"cmd":"make deploy"}`}, 2, time.Second, errors.New("exit status 2"))
+	run.End(provider.Usage{PromptTokens: 100, CompletionTokens: 20}, 0.05, nil)
+	l.Close()
+
+	// A second writer continues the same chain
+	l2, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2.Start(context.Background(), "", "other", "scheduled", "nightly").End(provider.Usage{}, 0, errors.New("budget exceeded"))
+	l2.Close()
+
+	data, _ := os.ReadFile(path)
+	n, head, err := Verify(bytes.NewReader(data))
+	if err != nil || n != 5 || head == "" {
+		t.Fatalf("Verify = %d, %q, %v", n, head, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var recs []Record
+	for _, line := range lines {
+		var rec Record
+		json.Unmarshal([]byte(line), &rec)
+		recs = append(recs, rec)
+	}
+	if s := recs[0]; s.Type != TypeStart || s.Actor != "token:ops" || s.Channel != "api" || s.Run != "run1" || strings.Contains(s.Prompt, "hunter2") {
+		t.Errorf("start = %+v", s)
+	}
+	if tool := recs[1]; tool.Tool != "shell.run" || tool.ExitCode != 2 || tool.Error == "" || tool.Run != "run1" {
+		t.Errorf("tool = %+v", tool)
+	}
+	if end := recs[2]; end.Type != TypeEnd || end.Cost != 0.05 || end.Usage.PromptTokens != 100 {
+		t.Errorf("end = %+v", end)
+	}
+	if recs[3].Run == "" || recs[3].Run != recs[4].Run {
+		t.Errorf("generated run IDs = %q, %q", recs[3].Run, recs[4].Run)
+	}
+
+	tests := []struct {
+		name   string
+		lines  []string
+		wantAt string
+	}{
+		{"edited", replace(lines, 1, strings.Replace(lines[1], `"exit_code":2`, `"exit_code":0`, 1)), "line 3"},
+		{"deleted", append(append([]string{}, lines[:1]...), lines[2:]...), "line 2"},
+		{"reordered", []string{lines[1], lines[0]}, "line 1"},
+	}
+	for _, tt := range tests {
+		_, _, err := Verify(strings.NewReader(strings.Join(tt.lines, "\n") + "\n"))
+		if err == nil || !strings.Contains(err.Error(), tt.wantAt) {
+			t.Errorf("%s: err = %v, want one at %s", tt.name, err, tt.wantAt)
+		}
+	}
+}
+
+func TestLogConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	var wg sync.WaitGroup
+	for w := range 4 {
+		// Each writer has its own file handle, as separate processes do
+		l, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 25 {
+				l.Start(context.Background(), "", fmt.Sprint("s", w), "cli", "hi").End(provider.Usage{}, 0, nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, _ := os.ReadFile(path)
+	if n, _, err := Verify(bytes.NewReader(data)); err != nil || n != 200 {
+		t.Fatalf("Verify = %d, %v", n, err)
+	}
+}
+
+func replace(lines []string, i int, line string) []string {
+	out := append([]string{}, lines...)
+	out[i] = line
+	return out
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	run := l.Start(context.Background(), "", "main", "", "hi")
+	run.Tool(provider.ToolCall{Name: "x"}, 0, 0, nil)
+	run.End(provider.Usage{}, 0, nil)
+	if err := l.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package audit
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable: processes appending to
+// the same log may fork its chain, though appends in one process don't.
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
@@ -0,0 +1,273 @@
+package builtin
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// CodeConfig controls the code.run sandbox.
+type CodeConfig struct {
+	Runtime          string            // Container CLI: "docker" or "podman" (default "docker")
+	Images           map[string]string // Image per language; merged over DefaultCodeImages
+	CPUs             string            // --cpus limit (default "1")
+	Memory           string            // --memory limit (default "512m")
+	Timeout          time.Duration     // Longest a snippet may run (default 60s)
+	Network          bool              // Give snippets network access (default: none)
+	Workspace        string            // Mounted read-only at /workspace ("" = not mounted)
+	ArtifactDir      string            // Files a snippet writes to /work are copied to <ArtifactDir>/<time>/ ("" = discarded)
+	MaxOutputBytes   int               // Cap on returned output (default 65536)
+	MaxArtifactBytes int64             // Cap on artifacts kept per run (default 10 MiB)
+}
+
+// DefaultCodeImages are the images code.run uses unless CodeConfig.Images
+// overrides them.
+var DefaultCodeImages = map[string]string{
+	"python": "python:3.12-slim",
+	"go":     "golang:1.23-alpine",
+	"node":   "node:22-alpine",
+}
+
+// codeFiles maps each language to its source file and the command that
+// runs it inside the container.
+var codeFiles = map[string]struct {
+	file string
+	cmd  []string
+}{
+	"python": {"main.py", []string{"python", "main.py"}},
+	"go":     {"main.go", []string{"go", "run", "main.go"}},
+	"node":   {"main.js", []string{"node", "main.js"}},
+}
+
+// Code returns the "code" tool manifest with a single "run" command. Each
+// snippet runs in a new container with no network, a read-only root file
+// system, and CPU, memory, process, and time limits; the container is
+// removed afterwards.
+func Code(cfg CodeConfig) *toolreg.ToolManifest {
+	cfg.Runtime = cmp.Or(cfg.Runtime, "docker")
+	cfg.CPUs = cmp.Or(cfg.CPUs, "1")
+	cfg.Memory = cmp.Or(cfg.Memory, "512m")
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+	if cfg.MaxOutputBytes <= 0 {
+		cfg.MaxOutputBytes = 64 * 1024
+	}
+	if cfg.MaxArtifactBytes <= 0 {
+		cfg.MaxArtifactBytes = 10 << 20
+	}
+	images := map[string]string{}
+	for lang, image := range DefaultCodeImages {
+		images[lang] = cmp.Or(cfg.Images[lang], image)
+	}
+	cfg.Images = images
+
+	c := &codeRunner{cfg: cfg, now: time.Now}
+	langs := []any{"python", "go", "node"}
+	desc := "Run a Python, Go, or Node.js program in a throwaway sandbox and return its output. " +
+		"The working directory is /work; files the program writes there are kept as artifacts. "
+	if cfg.Workspace != "" {
+		desc += "The workspace is mounted read-only at /workspace. "
+	}
+	if !cfg.Network {
+		desc += "There is no network access, so only the standard library and packages preinstalled in the image are available."
+	}
+	return &toolreg.ToolManifest{
+		Name:        "code",
+		Description: "Run code in an isolated container",
+		Network:     cfg.Network,
+		Commands: map[string]toolreg.CommandDef{
+			"run": {
+				Description: strings.TrimSpace(desc),
+				Parameters: map[string]toolreg.ParameterDef{
+					"language": {Type: "string", Description: "Language of the program", Required: true, Enum: langs},
+					"code":     {Type: "string", Description: "Complete program source; Go programs need package main and func main", Required: true},
+					"timeout":  {Type: "integer", Description: fmt.Sprintf("Seconds to allow (default and maximum %d)", int(cfg.Timeout.Seconds()))},
+				},
+				// Leave room for the container to start and be removed.
+				Timeout: int(cfg.Timeout.Seconds()) + 30,
+				Handler: c.run,
+			},
+		},
+	}
+}
+
+type codeRunner struct {
+	cfg CodeConfig
+	now func() time.Time
+}
+
+func (c *codeRunner) run(ctx context.Context, args map[string]any) (toolreg.ToolResult, error) {
+	lang, _ := args["language"].(string)
+	code, _ := args["code"].(string)
+	src, ok := codeFiles[lang]
+	if !ok {
+		return toolreg.ToolResult{}, fmt.Errorf("code.run: unsupported language %q", lang)
+	}
+	if strings.TrimSpace(code) == "" {
+		return toolreg.ToolResult{}, fmt.Errorf("code.run: code is empty")
+	}
+	timeout := c.cfg.Timeout
+	if secs, _ := args["timeout"].(float64); secs > 0 {
+		timeout = min(timeout, time.Duration(secs)*time.Second)
+	}
+
+	dir, err := os.MkdirTemp("", "teeny-code-")
+	if err != nil {
+		return toolreg.ToolResult{}, fmt.Errorf("code.run: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	// The container runs as our user, so it can write here.
+	if err := os.Chmod(dir, 0o755); err != nil {
+		return toolreg.ToolResult{}, fmt.Errorf("code.run: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, src.file), []byte(code), 0o644); err != nil {
+		return toolreg.ToolResult{}, fmt.Errorf("code.run: %w", err)
+	}
+
+	var id [6]byte
+	rand.Read(id[:])
+	name := "teeny-code-" + hex.EncodeToString(id[:])
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(runCtx, c.cfg.Runtime, c.args(name, dir, lang)...)
+	// Killing the CLI leaves the container running, so remove it too.
+	cmd.Cancel = func() error {
+		exec.Command(c.cfg.Runtime, "rm", "-f", name).Run()
+		return cmd.Process.Kill()
+	}
+	cmd.WaitDelay = 5 * time.Second
+	stdout := &cappedBuffer{max: c.cfg.MaxOutputBytes}
+	stderr := &cappedBuffer{max: c.cfg.MaxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	start := time.Now()
+	runErr := cmd.Run()
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	// Stdout ends with the exit status and the artifacts, so the model
+	// sees them whether the program worked or not.
+	res := toolreg.ToolResult{Stderr: stderr.String()}
+	var b strings.Builder
+	b.WriteString(stdout.String())
+	if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	var failed error
+	var exitErr *exec.ExitError
+	switch {
+	case runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil:
+		fmt.Fprintf(&b, "[timed out after %s]\n", timeout)
+		res.ExitCode = -1
+		failed = fmt.Errorf("code.run: timed out after %s", timeout)
+	case ctx.Err() != nil:
+		res.Stdout, res.ExitCode = b.String(), -1
+		return res, ctx.Err()
+	case errors.As(runErr, &exitErr):
+		fmt.Fprintf(&b, "[exit status %d after %s]\n", exitErr.ExitCode(), elapsed)
+		res.ExitCode = exitErr.ExitCode()
+		failed = fmt.Errorf("code.run: program exited with code %d", res.ExitCode)
+	case runErr != nil:
+		return toolreg.ToolResult{}, fmt.Errorf("code.run: start %s: %w", c.cfg.Runtime, runErr)
+	default:
+		fmt.Fprintf(&b, "[exit status 0 after %s]\n", elapsed)
+	}
+
+	saved, err := c.saveArtifacts(dir, src.file)
+	if err != nil {
+		fmt.Fprintf(&b, "[artifacts not saved: %v]\n", err)
+	}
+	if len(saved) > 0 {
+		b.WriteString("Artifacts:\n")
+		for _, s := range saved {
+			b.WriteString(s + "\n")
+		}
+	}
+	res.Stdout = b.String()
+	return res, failed
+}
+
+// args returns the container CLI arguments that run lang's source file
+// in dir.
+func (c *codeRunner) args(name, dir, lang string) []string {
+	args := []string{
+		"run", "--rm", "--name", name,
+		"--cpus", c.cfg.CPUs, "--memory", c.cfg.Memory, "--pids-limit", "256",
+		"--read-only", "--tmpfs", "/tmp:rw,exec,size=256m",
+		"--cap-drop", "ALL", "--security-opt", "no-new-privileges",
+		"--user", strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()),
+		"--env", "HOME=/tmp", "--env", "GOCACHE=/tmp/go-cache", "--env", "GOPATH=/tmp/go",
+		"--volume", dir + ":/work:rw", "--workdir", "/work",
+	}
+	if !c.cfg.Network {
+		args = append(args, "--network", "none")
+	}
+	if c.cfg.Workspace != "" {
+		args = append(args, "--volume", c.cfg.Workspace+":/workspace:ro")
+	}
+	args = append(args, c.cfg.Images[lang])
+	return append(args, codeFiles[lang].cmd...)
+}
+
+// saveArtifacts copies the files a run left in dir, other than its source,
+// to a new directory under ArtifactDir and describes each one.
+func (c *codeRunner) saveArtifacts(dir, source string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && path != filepath.Join(dir, source) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	if c.cfg.ArtifactDir == "" {
+		return []string{fmt.Sprintf("(%d files discarded; no artifact directory is configured)", len(files))}, nil
+	}
+	slices.Sort(files)
+	dst := filepath.Join(c.cfg.ArtifactDir, c.now().Format("20060102-150405.000000"))
+	var saved []string
+	var total int64
+	for _, path := range files {
+		rel, _ := filepath.Rel(dir, path)
+		info, err := os.Stat(path)
+		if err != nil {
+			return saved, err
+		}
+		if total+info.Size() > c.cfg.MaxArtifactBytes {
+			saved = append(saved, fmt.Sprintf("%s (%d bytes, skipped: over the %d byte artifact limit)", rel, info.Size(), c.cfg.MaxArtifactBytes))
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return saved, err
+		}
+		out := filepath.Join(dst, rel)
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			return saved, err
+		}
+		if err := os.WriteFile(out, data, 0o644); err != nil {
+			return saved, err
+		}
+		total += info.Size()
+		saved = append(saved, fmt.Sprintf("%s (%d bytes)", out, info.Size()))
+	}
+	return saved, nil
+}
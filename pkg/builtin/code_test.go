@@ -0,0 +1,90 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// fakeRuntime stands in for docker: it logs its arguments, then runs the
+// "program" by looking at the source it finds in the /work mount.
+const fakeRuntime = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/calls"
+[ "$1" = rm ] && exit 0
+while [ $# -gt 0 ]; do
+	[ "$1" = --volume ] && case "$2" in *:/work:rw) work="${2%:/work:rw}";; esac
+	last="$1"
+	shift
+done
+grep -q sleep "$work"/main.* && exec sleep 10
+grep -q fail "$work"/main.* && { echo boom >&2; exit 3; }
+echo "ran $last"
+echo "a,b" > "$work/result.csv"
+`
+
+func runCode(t *testing.T, cfg CodeConfig, args map[string]any) (toolreg.ToolResult, string, error) {
+	t.Helper()
+	bin := t.TempDir()
+	cfg.Runtime = filepath.Join(bin, "docker")
+	if err := os.WriteFile(cfg.Runtime, []byte(fakeRuntime), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	reg := toolreg.NewRegistry(5 * time.Second)
+	reg.Register(Code(cfg))
+	raw, _ := json.Marshal(args)
+	res, err := reg.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "code.run", Arguments: string(raw)})
+	calls, _ := os.ReadFile(filepath.Join(bin, "calls"))
+	return res, string(calls), err
+}
+
+func TestCodeRun(t *testing.T) {
+	artifacts := t.TempDir()
+	res, calls, err := runCode(t, CodeConfig{ArtifactDir: artifacts, Workspace: "/ws"}, map[string]any{"language": "python", "code": "print(1)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := res.Stdout
+	if !strings.HasPrefix(out, "ran main.py\n[exit status 0 after") || res.ExitCode != 0 {
+		t.Errorf("output = %q, exit code %d", out, res.ExitCode)
+	}
+	saved, _ := filepath.Glob(filepath.Join(artifacts, "*", "result.csv"))
+	if len(saved) != 1 || !strings.Contains(out, saved[0]+" (4 bytes)") {
+		t.Errorf("artifacts = %v, output = %q", saved, out)
+	}
+	for _, want := range []string{"run --rm", "--network none", "--memory 512m", "--read-only", "--volume /ws:/workspace:ro", "python:3.12-slim python main.py"} {
+		if !strings.Contains(calls, want) {
+			t.Errorf("runtime args missing %q: %s", want, calls)
+		}
+	}
+}
+
+func TestCodeRunFailures(t *testing.T) {
+	res, _, err := runCode(t, CodeConfig{}, map[string]any{"language": "go", "code": "fail()"})
+	if err == nil || !strings.Contains(err.Error(), "exited with code 3") || res.ExitCode != 3 {
+		t.Errorf("failed run: err = %v, exit code %d", err, res.ExitCode)
+	}
+	if res.Stderr != "boom\n" || !strings.HasPrefix(res.Stdout, "[exit status 3") {
+		t.Errorf("failed run stdout = %q, stderr = %q", res.Stdout, res.Stderr)
+	}
+	res, _, err = runCode(t, CodeConfig{}, map[string]any{"language": "node", "code": "console.log(1)"})
+	if err != nil || !strings.Contains(res.Stdout, "(1 files discarded; no artifact directory is configured)") {
+		t.Errorf("run without an artifact dir = %q, %v", res.Stdout, err)
+	}
+
+	res, calls, err := runCode(t, CodeConfig{}, map[string]any{"language": "python", "code": "time.sleep(60)", "timeout": 1})
+	if err == nil || !strings.Contains(res.Stdout, "[timed out after 1s]") || res.ExitCode != -1 {
+		t.Errorf("timed out run = %+v, %v", res, err)
+	}
+	lines := strings.Split(strings.TrimSpace(calls), "\n")
+	if !slices.ContainsFunc(lines, func(l string) bool { return strings.HasPrefix(l, "rm -f teeny-code-") }) {
+		t.Errorf("container not removed after timeout: %s", calls)
+	}
+}
@@ -0,0 +1,129 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/channels/github"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// GitHub returns the "github" tool manifest, which reads pull request
+// diffs and posts reviews and comments through client.
+func GitHub(client *github.Client) *toolreg.ToolManifest {
+	g := &githubTool{client: client}
+	pr := map[string]toolreg.ParameterDef{
+		"repo":   {Type: "string", Description: "Repository as \"owner/name\"", Required: true},
+		"number": {Type: "integer", Description: "Pull request or issue number", Required: true},
+	}
+	with := func(extra map[string]toolreg.ParameterDef) map[string]toolreg.ParameterDef {
+		params := maps.Clone(pr)
+		maps.Copy(params, extra)
+		return params
+	}
+	return &toolreg.ToolManifest{
+		Name:        "github",
+		Description: "Read GitHub pull requests and post reviews and comments",
+		Network:     true,
+		Commands: map[string]toolreg.CommandDef{
+			"pr_diff": {
+				Description: "Get a pull request's unified diff",
+				Parameters:  pr,
+				ReadOnly:    true,
+				Handler:     toolreg.TextHandler(g.prDiff),
+			},
+			"review": {
+				Description: "Submit a review on a pull request, optionally with inline comments",
+				Parameters: with(map[string]toolreg.ParameterDef{
+					"event": {Type: "string", Description: "Review verdict", Required: true, Enum: []any{github.EventComment, github.EventApprove, github.EventRequestChanges}},
+					"body":  {Type: "string", Description: "Review summary (Markdown)"},
+					"comments": {Type: "array", Description: "Inline comments on changed lines", Items: &toolreg.ParameterDef{
+						Type: "object",
+						Properties: map[string]toolreg.ParameterDef{
+							"path": {Type: "string", Description: "File path in the repository", Required: true},
+							"line": {Type: "integer", Description: "Line number in the new version of the file", Required: true},
+							"body": {Type: "string", Description: "Comment (Markdown)", Required: true},
+						},
+					}},
+				}),
+				Handler: toolreg.TextHandler(g.review),
+			},
+			"comment": {
+				Description: "Post a comment on an issue or pull request",
+				Parameters: with(map[string]toolreg.ParameterDef{
+					"body": {Type: "string", Description: "Comment (Markdown)", Required: true},
+				}),
+				Handler: toolreg.TextHandler(g.comment),
+			},
+		},
+	}
+}
+
+type githubTool struct {
+	client *github.Client
+}
+
+// prArgs reads the repo and number arguments every command takes.
+func prArgs(args map[string]any) (string, int, error) {
+	repo, _ := args["repo"].(string)
+	number, _ := args["number"].(float64)
+	if owner, name, ok := strings.Cut(repo, "/"); !ok || owner == "" || name == "" || number < 1 {
+		return "", 0, fmt.Errorf("github: repo (\"owner/name\") and number are required")
+	}
+	return repo, int(number), nil
+}
+
+func (g *githubTool) prDiff(ctx context.Context, args map[string]any) (string, error) {
+	repo, number, err := prArgs(args)
+	if err != nil {
+		return "", err
+	}
+	return g.client.PullDiff(ctx, repo, number)
+}
+
+func (g *githubTool) review(ctx context.Context, args map[string]any) (string, error) {
+	repo, number, err := prArgs(args)
+	if err != nil {
+		return "", err
+	}
+	event, _ := args["event"].(string)
+	body, _ := args["body"].(string)
+	raw, _ := args["comments"].([]any)
+	var comments []github.ReviewComment
+	for i, r := range raw {
+		c, _ := r.(map[string]any)
+		path, _ := c["path"].(string)
+		line, _ := c["line"].(float64)
+		text, _ := c["body"].(string)
+		if path == "" || line < 1 || text == "" {
+			return "", fmt.Errorf("github: comment %d needs a path, line, and body", i+1)
+		}
+		comments = append(comments, github.ReviewComment{Path: path, Line: int(line), Body: text})
+	}
+	if event != github.EventApprove && body == "" && len(comments) == 0 {
+		return "", fmt.Errorf("github: a %s review needs a body or comments", event)
+	}
+	url, err := g.client.Review(ctx, repo, number, event, body, comments)
+	if err != nil {
+		return "", err
+	}
+	return "Review submitted: " + url, nil
+}
+
+func (g *githubTool) comment(ctx context.Context, args map[string]any) (string, error) {
+	repo, number, err := prArgs(args)
+	if err != nil {
+		return "", err
+	}
+	body, _ := args["body"].(string)
+	if strings.TrimSpace(body) == "" {
+		return "", fmt.Errorf("github: body is required")
+	}
+	url, err := g.client.Comment(ctx, repo, number, body)
+	if err != nil {
+		return "", err
+	}
+	return "Comment posted: " + url, nil
+}
@@ -0,0 +1,59 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/channels/github"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func TestGitHubTool(t *testing.T) {
+	var review struct {
+		Event    string                 `json:"event"`
+		Comments []github.ReviewComment `json:"comments"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/acme/app/pulls/7":
+			io.WriteString(w, "+added line\n")
+		case "POST /repos/acme/app/pulls/7/reviews":
+			json.NewDecoder(r.Body).Decode(&review)
+			io.WriteString(w, `{"html_url":"https://github.com/acme/app/pull/7#review-1"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	reg := toolreg.NewRegistry(5 * time.Second)
+	reg.Register(GitHub(github.NewClient("tok", srv.URL)))
+	call := func(cmd, args string) (string, error) {
+		res, err := reg.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "github." + cmd, Arguments: args})
+		return res.Stdout, err
+	}
+
+	if out, err := call("pr_diff", `{"repo":"acme/app","number":7}`); err != nil || out != "+added line\n" {
+		t.Errorf("pr_diff = %q, %v", out, err)
+	}
+	out, err := call("review", `{"repo":"acme/app","number":7,"event":"REQUEST_CHANGES","comments":[{"path":"main.go","line":3,"body":"Handle the error"}]}`)
+	if err != nil || !strings.Contains(out, "#review-1") {
+		t.Errorf("review = %q, %v", out, err)
+	}
+	if review.Event != "REQUEST_CHANGES" || len(review.Comments) != 1 || review.Comments[0] != (github.ReviewComment{Path: "main.go", Line: 3, Body: "Handle the error"}) {
+		t.Errorf("review sent = %+v", review)
+	}
+
+	if _, err := call("review", `{"repo":"acme/app","number":7,"event":"COMMENT"}`); err == nil {
+		t.Error("expected error for an empty comment review")
+	}
+	if _, err := call("pr_diff", `{"repo":"app","number":7}`); err == nil {
+		t.Error("expected error for a repo without an owner")
+	}
+}
@@ -0,0 +1,608 @@
+package builtin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// PatchConfig controls what the fs.apply_patch tool may edit.
+type PatchConfig struct {
+	Root      string         // Paths are relative to, and must stay inside, this directory (default: current dir)
+	BackupDir string         // Originals are copied to <BackupDir>/<time>/<path> before a change ("" = no backups)
+	Paths     *toolreg.Paths // Files the patch may change, besides staying in Root (nil = any)
+}
+
+// Patch returns the "fs" tool manifest with an "apply_patch" command. A
+// patch is a unified diff or search/replace blocks. Every change is
+// checked and every new file version staged before any file is replaced,
+// and if replacing one fails the others are put back, so a patch applies
+// completely or not at all. Each file is replaced atomically, but the
+// patch as a whole isn't: a reader may see some files patched and others
+// not yet.
+func Patch(cfg PatchConfig) *toolreg.ToolManifest {
+	p := &patcher{cfg: cfg, now: time.Now}
+	return &toolreg.ToolManifest{
+		Name:        "fs",
+		Description: "Edit files in the workspace",
+		Commands: map[string]toolreg.CommandDef{
+			"apply_patch": {
+				Description: "Edit files with a unified diff (--- a/path, +++ b/path, @@ hunks) or with search/replace blocks: " +
+					"the file path on its own line, then <<<<<<< SEARCH, the exact lines to replace, =======, the new lines, >>>>>>> REPLACE. " +
+					"Prefer this to rewriting whole files. Nothing is written unless every change applies cleanly",
+				Parameters: map[string]toolreg.ParameterDef{
+					"patch":   {Type: "string", Description: "Unified diff or search/replace blocks; paths are relative to the workspace", Required: true},
+					"dry_run": {Type: "boolean", Description: "Only check that the patch applies"},
+				},
+				Handler: toolreg.TextHandler(p.apply),
+			},
+		},
+	}
+}
+
+type patcher struct {
+	cfg PatchConfig
+	now func() time.Time
+}
+
+// change is one file's part of a patch.
+type change struct {
+	path   string
+	create bool // Diff from /dev/null
+	remove bool // Diff to /dev/null
+	hunks  []*hunk
+	blocks []block
+}
+
+type hunk struct {
+	oldStart int // 1-based line the hunk claims to start at (0 = unknown)
+	insert   bool
+	lines    []hunkLine
+	noEOL    bool // "\ No newline at end of file" follows the hunk's last new line
+}
+
+type hunkLine struct {
+	kind byte // ' ', '-', or '+'
+	text string
+}
+
+type block struct {
+	search, replace string
+}
+
+// fileState is a file as the patch leaves it.
+type fileState struct {
+	rel, path string
+	existed   bool
+	orig      string
+	mode      fs.FileMode
+	exists    bool
+	content   string
+}
+
+func (p *patcher) apply(ctx context.Context, args map[string]any) (string, error) {
+	text, _ := args["patch"].(string)
+	dryRun, _ := args["dry_run"].(bool)
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("fs.apply_patch: patch is empty")
+	}
+	var changes []*change
+	var err error
+	if strings.Contains(text, "<<<<<<< SEARCH") {
+		changes, err = parseBlocks(text)
+	} else {
+		changes, err = parseUnified(text)
+	}
+	if err != nil {
+		return "", fmt.Errorf("fs.apply_patch: %w", err)
+	}
+	if len(changes) == 0 {
+		return "", fmt.Errorf("fs.apply_patch: no file changes found in the patch")
+	}
+
+	root, err := realPath(p.cfg.Root)
+	if err != nil {
+		return "", fmt.Errorf("fs.apply_patch: %w", err)
+	}
+	// Apply everything in memory first, so a bad hunk writes nothing.
+	var files []*fileState
+	byPath := map[string]*fileState{}
+	for _, c := range changes {
+		f, err := load(root, c.path)
+		if err != nil {
+			return "", fmt.Errorf("fs.apply_patch: %w", err)
+		}
+		if err := p.cfg.Paths.CanWrite(f.path); err != nil {
+			return "", fmt.Errorf("fs.apply_patch: %w", err)
+		}
+		if seen, ok := byPath[f.path]; ok {
+			f = seen // Changed earlier in the patch
+		} else {
+			byPath[f.path] = f
+			files = append(files, f)
+		}
+		if err := c.applyTo(f); err != nil {
+			return "", fmt.Errorf("fs.apply_patch: %s: %w", c.path, err)
+		}
+	}
+
+	var b strings.Builder
+	if dryRun {
+		b.WriteString("The patch applies cleanly (dry run, nothing written):\n")
+	} else {
+		backup := ""
+		if p.cfg.BackupDir != "" {
+			backup = filepath.Join(p.cfg.BackupDir, p.now().Format("20060102-150405.000000"))
+		}
+		changed, err := writeAll(files, backup)
+		if err != nil {
+			return "", fmt.Errorf("fs.apply_patch: %w", err)
+		}
+		if backup != "" {
+			fmt.Fprintf(&b, "Patched %d files; originals are in %s:\n", changed, backup)
+		} else {
+			fmt.Fprintf(&b, "Patched %d files:\n", changed)
+		}
+	}
+	for _, f := range files {
+		status := "M"
+		switch {
+		case !f.existed && f.exists:
+			status = "A"
+		case f.existed && !f.exists:
+			status = "D"
+		case f.orig == f.content:
+			status = "="
+		}
+		fmt.Fprintf(&b, "%s %s\n", status, f.rel)
+	}
+	return b.String(), nil
+}
+
+// load reads the file at rel, which must resolve inside root.
+func load(root, rel string) (*fileState, error) {
+	path := rel
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	real, err := realPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if !within(root, real) {
+		return nil, fmt.Errorf("%s is outside the workspace", rel)
+	}
+	if r, err := filepath.Rel(root, real); err == nil {
+		rel = r
+	}
+	f := &fileState{rel: rel, path: real, mode: 0o644}
+	info, err := os.Stat(real)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return f, nil
+	case err != nil:
+		return nil, err
+	case !info.Mode().IsRegular():
+		return nil, fmt.Errorf("%s is not a regular file", rel)
+	}
+	data, err := os.ReadFile(real)
+	if err != nil {
+		return nil, err
+	}
+	f.existed, f.exists, f.mode = true, true, info.Mode().Perm()
+	f.orig, f.content = string(data), string(data)
+	return f, nil
+}
+
+// realPath makes path absolute and follows symlinks in its longest
+// existing prefix, so a path through a symlinked directory can't escape.
+func realPath(path string) (string, error) {
+	if path == "" {
+		path = "."
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if dir == filepath.Dir(dir) {
+			return abs, nil
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+	}
+}
+
+// changed reports whether the patch changes f.
+func (f *fileState) changed() bool {
+	return f.existed != f.exists || f.orig != f.content
+}
+
+// writeAll writes the files the patch changes and returns how many. Every
+// new version is staged in a temporary file, after copying the original
+// to backup, before any file is replaced; if a replacement then fails,
+// the files already replaced are put back as they were.
+func writeAll(files []*fileState, backup string) (int, error) {
+	var changed []*fileState
+	var staged []string
+	defer func() {
+		for _, tmp := range staged {
+			if tmp != "" {
+				os.Remove(tmp) // No-op once renamed
+			}
+		}
+	}()
+	for _, f := range files {
+		if !f.changed() {
+			continue
+		}
+		tmp, err := f.stage(backup)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", f.rel, err)
+		}
+		changed = append(changed, f)
+		staged = append(staged, tmp)
+	}
+	for i, f := range changed {
+		var err error
+		if staged[i] == "" {
+			err = os.Remove(f.path)
+		} else {
+			err = os.Rename(staged[i], f.path)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", f.rel, err)
+			for _, done := range changed[:i] {
+				if rerr := done.restore(); rerr != nil {
+					err = errors.Join(err, fmt.Errorf("restoring %s: %w", done.rel, rerr))
+				}
+			}
+			return 0, err
+		}
+	}
+	return len(changed), nil
+}
+
+// stage copies f's original to backup and writes its new version to a
+// temporary file beside it, whose path it returns. A file the patch
+// deletes has no new version, and its path is "".
+func (f *fileState) stage(backup string) (string, error) {
+	if f.existed && backup != "" {
+		dst := filepath.Join(backup, f.rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+			return "", fmt.Errorf("backup: %w", err)
+		}
+		if err := os.WriteFile(dst, []byte(f.orig), f.mode); err != nil {
+			return "", fmt.Errorf("backup: %w", err)
+		}
+	}
+	if !f.exists {
+		return "", nil
+	}
+	return tempFile(f.path, f.content, f.mode)
+}
+
+// restore puts back the file as it was before the patch.
+func (f *fileState) restore() error {
+	if !f.existed {
+		return os.Remove(f.path)
+	}
+	tmp, err := tempFile(f.path, f.orig, f.mode)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// tempFile writes content to a new temporary file in path's directory,
+// to be renamed over path, and returns its name.
+func tempFile(path, content string, mode fs.FileMode) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.WriteString(content)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+func (c *change) applyTo(f *fileState) error {
+	switch {
+	case c.create && f.exists:
+		return errors.New("the patch creates it, but it already exists")
+	case !c.create && !f.exists && len(c.hunks) > 0:
+		return errors.New("no such file")
+	}
+	if len(c.hunks) > 0 || c.create {
+		content, err := applyHunks(f.content, c.hunks)
+		if err != nil {
+			return err
+		}
+		f.content, f.exists = content, true
+	}
+	if c.remove {
+		if f.content != "" {
+			return errors.New("the patch deletes it, but doesn't remove all of its lines")
+		}
+		f.exists = false
+	}
+	for i, b := range c.blocks {
+		if err := f.replace(b); err != nil {
+			return fmt.Errorf("block %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// replace applies one search/replace block.
+func (f *fileState) replace(b block) error {
+	if b.search == "" {
+		if f.exists {
+			return errors.New("SEARCH is empty; that only creates new files")
+		}
+		f.content, f.exists = b.replace+"\n", true
+		return nil
+	}
+	if !f.exists {
+		return errors.New("no such file")
+	}
+	search, replace := b.search, b.replace
+	if strings.Contains(f.content, "\r\n") {
+		search = strings.ReplaceAll(search, "\n", "\r\n")
+		replace = strings.ReplaceAll(replace, "\n", "\r\n")
+	}
+	switch n := strings.Count(f.content, search); n {
+	case 0:
+		return errors.New("SEARCH text not found; it must match the file exactly, including indentation")
+	case 1:
+		f.content = strings.Replace(f.content, search, replace, 1)
+		return nil
+	default:
+		return fmt.Errorf("SEARCH text matches %d places; include more surrounding lines so it matches one", n)
+	}
+}
+
+// applyHunks applies unified diff hunks to content. Each hunk must match
+// exactly, though it may have moved from the line its header names.
+func applyHunks(content string, hunks []*hunk) (string, error) {
+	crlf := strings.Contains(content, "\r\n")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	finalNL := content == "" || strings.HasSuffix(content, "\n")
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	var out []string
+	pos, offset := 0, 0
+	for i, h := range hunks {
+		var before, after []string
+		for _, l := range h.lines {
+			if l.kind != '+' {
+				before = append(before, l.text)
+			}
+			if l.kind != '-' {
+				after = append(after, l.text)
+			}
+		}
+		want := pos
+		if h.oldStart > 0 {
+			want = h.oldStart - 1 + offset
+			if h.insert {
+				want++
+			}
+		}
+		at := findLines(lines, before, pos, want)
+		if at < 0 {
+			where := ""
+			if h.oldStart > 0 {
+				where = " at line " + strconv.Itoa(h.oldStart)
+			}
+			return "", fmt.Errorf("hunk %d does not apply%s: its context and removed lines don't match the file", i+1, where)
+		}
+		out = append(out, lines[pos:at]...)
+		out = append(out, after...)
+		pos = at + len(before)
+		if h.oldStart > 0 {
+			offset = at - (want - offset)
+		}
+		if pos == len(lines) {
+			finalNL = !h.noEOL
+		}
+	}
+	out = append(out, lines[pos:]...)
+
+	result := strings.Join(out, "\n")
+	if len(out) > 0 && finalNL {
+		result += "\n"
+	}
+	if crlf {
+		result = strings.ReplaceAll(result, "\n", "\r\n")
+	}
+	return result, nil
+}
+
+// findLines returns the index at or after from where lines continues with
+// want, choosing the match nearest near. Trailing whitespace is ignored if
+// there is no exact match. It returns -1 if want isn't there.
+func findLines(lines, want []string, from, near int) int {
+	if len(want) == 0 {
+		return min(max(near, from), len(lines))
+	}
+	for _, eq := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+	} {
+		best := -1
+		for i := from; i+len(want) <= len(lines); i++ {
+			match := true
+			for j := range want {
+				if !eq(lines[i+j], want[j]) {
+					match = false
+					break
+				}
+			}
+			if match && (best < 0 || absDiff(i, near) < absDiff(best, near)) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	return -1
+}
+
+func absDiff(a, b int) int {
+	if a < b {
+		return b - a
+	}
+	return a - b
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,\d+)? @@`)
+
+// parseUnified parses a unified diff, as from diff -u or git diff. Hunk
+// line counts are not trusted: a hunk runs until the next header.
+func parseUnified(text string) ([]*change, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var changes []*change
+	var cur *change
+	var h *hunk
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			from, to := diffPath(line[4:], "a/"), diffPath(lines[i+1][4:], "b/")
+			i++
+			cur, h = &change{path: to}, nil
+			switch {
+			case from == "" && to == "":
+				return nil, fmt.Errorf("line %d: both paths are /dev/null", i)
+			case from == "":
+				cur.create = true
+			case to == "":
+				cur.path, cur.remove = from, true
+			case from != to:
+				return nil, fmt.Errorf("line %d: renaming %s to %s is not supported", i, from, to)
+			}
+			changes = append(changes, cur)
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk before any --- / +++ file header", i+1)
+			}
+			h = &hunk{}
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				h.oldStart, _ = strconv.Atoi(m[1])
+				h.insert = m[2] == "0"
+			}
+			cur.hunks = append(cur.hunks, h)
+		case h == nil:
+			// diff --git, index, and other lines between hunks
+		case strings.HasPrefix(line, `\`):
+			if n := len(h.lines); n > 0 && h.lines[n-1].kind != '-' {
+				h.noEOL = true
+			}
+		case line == "":
+			h.lines = append(h.lines, hunkLine{' ', ""}) // Context whose leading space was lost
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			h.lines = append(h.lines, hunkLine{line[0], line[1:]})
+		default:
+			h = nil
+		}
+	}
+	for _, c := range changes {
+		for _, h := range c.hunks {
+			// Blank lines after a hunk are usually separators, not context.
+			for n := len(h.lines); n > 0 && h.lines[n-1] == (hunkLine{' ', ""}); n-- {
+				h.lines = h.lines[:n-1]
+			}
+			if len(h.lines) == 0 {
+				return nil, fmt.Errorf("%s: empty hunk", c.path)
+			}
+		}
+		if len(c.hunks) == 0 && !c.create {
+			return nil, fmt.Errorf("%s: no hunks", c.path)
+		}
+	}
+	return changes, nil
+}
+
+// diffPath cleans a --- or +++ path: it drops a trailing timestamp and
+// git's a/ or b/ prefix, and maps /dev/null to "".
+func diffPath(s, prefix string) string {
+	s, _, _ = strings.Cut(s, "\t")
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(s, prefix)
+}
+
+// parseBlocks parses search/replace blocks. Each block follows a line
+// naming its file; fence lines (```) are ignored.
+func parseBlocks(text string) ([]*change, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var changes []*change
+	path := ""
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(trimmed, "<<<<<<< SEARCH") {
+			if trimmed != "" && !strings.HasPrefix(trimmed, "```") {
+				path = trimmed
+			}
+			continue
+		}
+		if path == "" {
+			return nil, fmt.Errorf("line %d: SEARCH block without a file path before it", i+1)
+		}
+		var search, replace []string
+		j := i + 1
+		for ; j < len(lines) && strings.TrimSpace(lines[j]) != "======="; j++ {
+			search = append(search, lines[j])
+		}
+		k := j + 1
+		for ; k < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[k]), ">>>>>>> REPLACE"); k++ {
+			replace = append(replace, lines[k])
+		}
+		if k >= len(lines) {
+			return nil, fmt.Errorf("line %d: SEARCH block for %s is missing ======= or >>>>>>> REPLACE", i+1, path)
+		}
+		b := block{search: strings.Join(search, "\n"), replace: strings.Join(replace, "\n")}
+		if n := len(changes); n > 0 && changes[n-1].path == path {
+			changes[n-1].blocks = append(changes[n-1].blocks, b)
+		} else {
+			changes = append(changes, &change{path: path, blocks: []block{b}})
+		}
+		i = k
+	}
+	return changes, nil
+}
@@ -0,0 +1,219 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func newPatchRegistry(t *testing.T) (reg *toolreg.Registry, root, backups string) {
+	t.Helper()
+	root, backups = t.TempDir(), t.TempDir()
+	reg = toolreg.NewRegistry(5 * time.Second)
+	reg.Register(Patch(PatchConfig{Root: root, BackupDir: backups}))
+	return reg, root, backups
+}
+
+func applyPatch(reg *toolreg.Registry, patch string, dryRun bool) (string, error) {
+	args, _ := json.Marshal(map[string]any{"patch": patch, "dry_run": dryRun})
+	res, err := reg.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "fs.apply_patch", Arguments: string(args)})
+	return res.Stdout, err
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+const mainGo = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"
+
+func TestApplyUnifiedDiff(t *testing.T) {
+	reg, root, backups := newPatchRegistry(t)
+	writeFile(t, filepath.Join(root, "main.go"), mainGo)
+	writeFile(t, filepath.Join(root, "old.txt"), "bye\n")
+
+	// The hunk header is off by two lines, as model-written diffs often are.
+	patch := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -7,3 +7,4 @@
+ func main() {
+-	fmt.Println("hello")
++	fmt.Println("hello, world")
++	fmt.Println("again")
+ }
+--- /dev/null
++++ b/docs/new.md
+@@ -0,0 +1,2 @@
++# New
++text
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+	out, err := applyPatch(reg, patch, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Patched 3 files", "M main.go", "A docs/new.md", "D old.txt"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	want := strings.Replace(mainGo, "\tfmt.Println(\"hello\")\n", "\tfmt.Println(\"hello, world\")\n\tfmt.Println(\"again\")\n", 1)
+	if got := readFile(t, filepath.Join(root, "main.go")); got != want {
+		t.Errorf("main.go =\n%s", got)
+	}
+	if got := readFile(t, filepath.Join(root, "docs/new.md")); got != "# New\ntext\n" {
+		t.Errorf("new.md = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("old.txt not deleted: %v", err)
+	}
+
+	saved, _ := filepath.Glob(filepath.Join(backups, "*", "main.go"))
+	if len(saved) != 1 || readFile(t, saved[0]) != mainGo {
+		t.Errorf("backups = %v", saved)
+	}
+}
+
+func TestApplySearchReplace(t *testing.T) {
+	reg, root, _ := newPatchRegistry(t)
+	writeFile(t, filepath.Join(root, "main.go"), strings.ReplaceAll(mainGo, "\n", "\r\n"))
+
+	patch := "main.go\n```go\n<<<<<<< SEARCH\n\tfmt.Println(\"hello\")\n=======\n\tfmt.Println(\"hi\")\n>>>>>>> REPLACE\n```\n\n" +
+		"notes.txt\n<<<<<<< SEARCH\n=======\nremember the milk\n>>>>>>> REPLACE\n"
+	if _, err := applyPatch(reg, patch, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(root, "main.go")); !strings.Contains(got, "\tfmt.Println(\"hi\")\r\n") {
+		t.Errorf("main.go = %q", got)
+	}
+	if got := readFile(t, filepath.Join(root, "notes.txt")); got != "remember the milk\n" {
+		t.Errorf("notes.txt = %q", got)
+	}
+}
+
+func TestApplyPatchIsAllOrNothing(t *testing.T) {
+	reg, root, _ := newPatchRegistry(t)
+	writeFile(t, filepath.Join(root, "a.txt"), "one\ntwo\n")
+	writeFile(t, filepath.Join(root, "b.txt"), "three\n")
+
+	patch := "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n" +
+		"--- a/b.txt\n+++ b/b.txt\n@@ -1 +1 @@\n-four\n+FOUR\n"
+	_, err := applyPatch(reg, patch, false)
+	if err == nil || !strings.Contains(err.Error(), "b.txt: hunk 1 does not apply at line 1") {
+		t.Errorf("err = %v", err)
+	}
+	if got := readFile(t, filepath.Join(root, "a.txt")); got != "one\ntwo\n" {
+		t.Errorf("a.txt changed: %q", got)
+	}
+
+	// A dry run checks without writing.
+	out, err := applyPatch(reg, "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n", true)
+	if err != nil || !strings.Contains(out, "dry run") || readFile(t, filepath.Join(root, "a.txt")) != "one\ntwo\n" {
+		t.Errorf("dry run = %q, %v", out, err)
+	}
+}
+
+func TestWriteAllRollsBack(t *testing.T) {
+	root := t.TempDir()
+	a := filepath.Join(root, "a.txt")
+	writeFile(t, a, "old\n")
+	// b is a directory, so replacing it fails after a is replaced
+	b := filepath.Join(root, "b")
+	writeFile(t, filepath.Join(b, "keep"), "")
+	same := filepath.Join(root, "same.txt")
+	writeFile(t, same, "same\n")
+
+	files := []*fileState{
+		{rel: "a.txt", path: a, existed: true, exists: true, orig: "old\n", content: "new\n", mode: 0o644},
+		{rel: "same.txt", path: same, existed: true, exists: true, orig: "same\n", content: "same\n", mode: 0o644},
+		{rel: "b", path: b, exists: true, content: "x\n", mode: 0o644},
+	}
+	if _, err := writeAll(files, ""); err == nil {
+		t.Fatal("replacing a directory succeeded")
+	}
+	if got := readFile(t, a); got != "old\n" {
+		t.Errorf("a.txt = %q after a failed patch", got)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 3 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	// Files the patch leaves as they were aren't counted
+	if n, err := writeAll(files[:2], ""); n != 1 || err != nil {
+		t.Errorf("writeAll = %d, %v", n, err)
+	}
+}
+
+func TestApplyPatchRejects(t *testing.T) {
+	reg, root, _ := newPatchRegistry(t)
+	writeFile(t, filepath.Join(root, "dup.txt"), "x\nx\n")
+	outside := t.TempDir()
+	os.Symlink(outside, filepath.Join(root, "link"))
+
+	tests := []struct{ name, patch, want string }{
+		{"escape", "--- /dev/null\n+++ b/../evil.txt\n@@ -0,0 +1 @@\n+pwned\n", "outside the workspace"},
+		{"symlink escape", "link/evil.txt\n<<<<<<< SEARCH\n=======\npwned\n>>>>>>> REPLACE\n", "outside the workspace"},
+		{"ambiguous search", "dup.txt\n<<<<<<< SEARCH\nx\n=======\ny\n>>>>>>> REPLACE\n", "matches 2 places"},
+		{"missing search", "dup.txt\n<<<<<<< SEARCH\nz\n=======\ny\n>>>>>>> REPLACE\n", "not found"},
+		{"unterminated block", "dup.txt\n<<<<<<< SEARCH\nx\n=======\ny\n", "missing"},
+		{"create existing", "--- /dev/null\n+++ b/dup.txt\n@@ -0,0 +1 @@\n+x\n", "already exists"},
+		{"not a diff", "please change x to y", "no file changes"},
+	}
+	for _, tt := range tests {
+		if _, err := applyPatch(reg, tt.patch, false); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil.txt")); err == nil {
+		t.Error("wrote outside the workspace")
+	}
+}
+
+func TestApplyHunksNoNewline(t *testing.T) {
+	got, err := applyHunks("a\nb", []*hunk{{oldStart: 2, lines: []hunkLine{{'-', "b"}, {'+', "c"}}}})
+	if err != nil || got != "a\nc\n" {
+		t.Errorf("applyHunks = %q, %v", got, err)
+	}
+	got, err = applyHunks("a\nb\n", []*hunk{{oldStart: 2, noEOL: true, lines: []hunkLine{{'-', "b"}, {'+', "c"}}}})
+	if err != nil || got != "a\nc" {
+		t.Errorf("applyHunks with no newline = %q, %v", got, err)
+	}
+}
+
+func TestApplyPatch_Paths(t *testing.T) {
+	root := t.TempDir()
+	reg := toolreg.NewRegistry(5 * time.Second)
+	reg.Register(Patch(PatchConfig{Root: root, Paths: toolreg.NewPaths(toolreg.PathPolicy{Deny: []string{".env"}}, root)}))
+	writeFile(t, filepath.Join(root, ".env"), "TOKEN=x\n")
+
+	patch := "--- a/.env\n+++ b/.env\n@@ -1 +1 @@\n-TOKEN=x\n+TOKEN=y\n"
+	if _, err := applyPatch(reg, patch, false); err == nil || !strings.Contains(err.Error(), "path not allowed") {
+		t.Fatalf("err = %v, want a path error", err)
+	}
+	if got := readFile(t, filepath.Join(root, ".env")); got != "TOKEN=x\n" {
+		t.Errorf(".env = %q", got)
+	}
+}
@@ -0,0 +1,202 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/scheduler"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// createdByAgent marks jobs made with the schedule tool. The tool can only
+// list and cancel these, never jobs the user configured.
+const createdByAgent = "agent"
+
+// ScheduleConfig controls what the schedule tool may do.
+type ScheduleConfig struct {
+	Store       *scheduler.Store // Where jobs are saved; the daemon picks them up
+	MaxJobs     int              // Enabled agent jobs allowed at once (default 10)
+	MinInterval time.Duration    // Shortest allowed gap for recurring jobs (default 15m)
+	Agent       string           // Named agent the jobs run as ("" = the default agent)
+}
+
+// Schedule returns the "schedule" tool manifest, which lets the agent set
+// reminders and recurring tasks for itself. Jobs run in the daemon.
+func Schedule(cfg ScheduleConfig) *toolreg.ToolManifest {
+	if cfg.MaxJobs <= 0 {
+		cfg.MaxJobs = 10
+	}
+	if cfg.MinInterval <= 0 {
+		cfg.MinInterval = 15 * time.Minute
+	}
+	s := &schedule{cfg: cfg, now: time.Now}
+	return &toolreg.ToolManifest{
+		Name:        "schedule",
+		Description: "Schedule future or recurring runs of yourself",
+		Commands: map[string]toolreg.CommandDef{
+			"create": {
+				Description: "Schedule a prompt to run later, once or on a recurring schedule",
+				Parameters: map[string]toolreg.ParameterDef{
+					"name":     {Type: "string", Description: "Unique job name, e.g. \"check-deploy\"", Required: true},
+					"schedule": {Type: "string", Description: "\"@at 2026-03-01T09:00:00Z\" (once), \"@every 2h\", \"@daily\", or a cron expression", Required: true},
+					"prompt":   {Type: "string", Description: "What to do when the job runs; write it as an instruction to yourself", Required: true},
+					"session":  {Type: "string", Description: "Session to run in (default: this conversation)"},
+				},
+				Handler: toolreg.TextHandler(s.create),
+			},
+			"list": {
+				Description: "List jobs you have scheduled",
+				Parameters:  map[string]toolreg.ParameterDef{},
+				ReadOnly:    true,
+				Handler:     toolreg.TextHandler(s.list),
+			},
+			"cancel": {
+				Description: "Cancel a job you scheduled",
+				Parameters: map[string]toolreg.ParameterDef{
+					"name": {Type: "string", Description: "Job name", Required: true},
+				},
+				Handler: toolreg.TextHandler(s.cancel),
+			},
+		},
+	}
+}
+
+type schedule struct {
+	cfg ScheduleConfig
+	now func() time.Time
+}
+
+func (s *schedule) create(ctx context.Context, args map[string]any) (string, error) {
+	name, _ := args["name"].(string)
+	spec, _ := args["schedule"].(string)
+	prompt, _ := args["prompt"].(string)
+	session, _ := args["session"].(string)
+	name, spec = strings.TrimSpace(name), strings.TrimSpace(spec)
+	if name == "" || spec == "" || strings.TrimSpace(prompt) == "" {
+		return "", fmt.Errorf("schedule: name, schedule, and prompt are required")
+	}
+	if session == "" {
+		session = toolreg.SessionKey(ctx)
+	}
+	if session == "" {
+		return "", fmt.Errorf("schedule: no session; pass one explicitly")
+	}
+
+	sched, err := scheduler.ParseSchedule(spec)
+	if err != nil {
+		return "", fmt.Errorf("schedule: %w", err)
+	}
+	now := s.now()
+	first := sched.Next(now)
+	if first.IsZero() {
+		return "", fmt.Errorf("schedule: %q never fires (is the time in the past?)", spec)
+	}
+	if tooFrequent(sched, first, s.cfg.MinInterval) {
+		return "", fmt.Errorf("schedule: recurring jobs must be at least %s apart", s.cfg.MinInterval)
+	}
+
+	job := scheduler.Job{
+		Name:      name,
+		Schedule:  spec,
+		Prompt:    prompt,
+		Session:   session,
+		Enabled:   true,
+		CreatedBy: createdByAgent,
+		Agent:     s.cfg.Agent,
+	}
+	if p := toolreg.ProfileFrom(ctx); p != nil {
+		job.Profile = p.Name // The job can't do more than the session that created it
+	}
+	// Count and insert under the store's lock so concurrent creates can't
+	// both slip under the limit.
+	err = s.cfg.Store.AddIf(job, func(jobs []scheduler.Job) error {
+		active := 0
+		for _, j := range jobs {
+			if j.CreatedBy == createdByAgent && j.Enabled {
+				active++
+			}
+		}
+		if active >= s.cfg.MaxJobs {
+			return fmt.Errorf("schedule: limit of %d scheduled jobs reached; cancel one first", s.cfg.MaxJobs)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Scheduled %q in session %s; first run %s", name, session, first.Format(time.RFC3339)), nil
+}
+
+// Bounds for tooFrequent: a year covers every cron pattern (days of week,
+// months, leap days), and the fire cap keeps a permissive spec cheap.
+const (
+	frequencyWindow = 366 * 24 * time.Hour
+	frequencyFires  = 20000
+)
+
+// tooFrequent reports whether any two consecutive fire times of sched,
+// starting at first, are closer than min. Checking only the first gap
+// isn't enough: "0,30-59 9 * * *" fires at 9:00 and 9:30, then every
+// minute until 10:00.
+func tooFrequent(sched scheduler.Schedule, first time.Time, min time.Duration) bool {
+	end := first.Add(frequencyWindow)
+	prev := first
+	for i := 0; i < frequencyFires; i++ {
+		next := sched.Next(prev)
+		if next.IsZero() || next.After(end) {
+			return false
+		}
+		if next.Sub(prev) < min {
+			return true
+		}
+		prev = next
+	}
+	return false
+}
+
+func (s *schedule) list(ctx context.Context, args map[string]any) (string, error) {
+	jobs, err := s.agentJobs()
+	if err != nil {
+		return "", err
+	}
+	if len(jobs) == 0 {
+		return "No scheduled jobs.", nil
+	}
+	var b strings.Builder
+	for _, j := range jobs {
+		status := "active"
+		if !j.Enabled {
+			status = "done"
+		}
+		fmt.Fprintf(&b, "- %s [%s] %s (session %s): %s\n", j.Name, status, j.Schedule, j.Session, j.Prompt)
+	}
+	return b.String(), nil
+}
+
+func (s *schedule) cancel(ctx context.Context, args map[string]any) (string, error) {
+	name, _ := args["name"].(string)
+	removed, err := s.cfg.Store.Remove(name, func(j scheduler.Job) bool { return j.CreatedBy == createdByAgent })
+	if err != nil {
+		return "", err
+	}
+	if !removed {
+		return "", fmt.Errorf("schedule: no job %q that you scheduled", name)
+	}
+	return fmt.Sprintf("Cancelled %q", name), nil
+}
+
+func (s *schedule) agentJobs() ([]scheduler.Job, error) {
+	all, err := s.cfg.Store.Jobs()
+	if err != nil {
+		return nil, err
+	}
+	var jobs []scheduler.Job
+	for _, j := range all {
+		if j.CreatedBy == createdByAgent {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs, nil
+}
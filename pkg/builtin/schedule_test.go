@@ -0,0 +1,130 @@
+package builtin
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/scheduler"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func newScheduleRegistry(t *testing.T, cfg ScheduleConfig) (*toolreg.Registry, *scheduler.Store) {
+	t.Helper()
+	if cfg.Store == nil {
+		cfg.Store = scheduler.NewStore(filepath.Join(t.TempDir(), "daemon.json"))
+	}
+	reg := toolreg.NewRegistry(5 * time.Second)
+	reg.Register(Schedule(cfg))
+	return reg, cfg.Store
+}
+
+func callSchedule(reg *toolreg.Registry, cmd, args string) (string, error) {
+	ctx := toolreg.WithSessionKey(context.Background(), "chat-1")
+	res, err := reg.Execute(ctx, provider.ToolCall{ID: "1", Name: "schedule." + cmd, Arguments: args})
+	return res.Stdout, err
+}
+
+func TestScheduleCreateListCancel(t *testing.T) {
+	reg, store := newScheduleRegistry(t, ScheduleConfig{})
+	when := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	out, err := callSchedule(reg, "create", `{"name":"check-deploy","schedule":"@at `+when+`","prompt":"Check the deploy finished"}`)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !strings.Contains(out, "session chat-1") {
+		t.Errorf("create = %q", out)
+	}
+
+	jobs, _ := store.Jobs()
+	if len(jobs) != 1 || jobs[0].Session != "chat-1" || jobs[0].CreatedBy != "agent" || !jobs[0].Enabled {
+		t.Fatalf("stored jobs = %+v", jobs)
+	}
+
+	// User-configured jobs in the same file are invisible to the tool.
+	store.Add(scheduler.Job{Name: "user-job", Schedule: "@daily", Enabled: true})
+
+	out, err = callSchedule(reg, "list", `{}`)
+	if err != nil || !strings.Contains(out, "check-deploy [active]") || strings.Contains(out, "user-job") {
+		t.Errorf("list = %q, %v", out, err)
+	}
+	if _, err := callSchedule(reg, "cancel", `{"name":"user-job"}`); err == nil {
+		t.Error("expected error cancelling a user job")
+	}
+	if _, err := callSchedule(reg, "cancel", `{"name":"check-deploy"}`); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if out, _ := callSchedule(reg, "list", `{}`); out != "No scheduled jobs." {
+		t.Errorf("list after cancel = %q", out)
+	}
+}
+
+func TestScheduleCreateLimits(t *testing.T) {
+	reg, _ := newScheduleRegistry(t, ScheduleConfig{MaxJobs: 1, MinInterval: time.Hour})
+
+	tests := []struct {
+		args string
+		want string
+	}{
+		{`{"name":"fast","schedule":"@every 5m","prompt":"p"}`, "at least 1h0m0s apart"},
+		{`{"name":"cron","schedule":"*/10 * * * *","prompt":"p"}`, "at least"},
+		{`{"name":"past","schedule":"@at 2020-01-01T00:00:00Z","prompt":"p"}`, "never fires"},
+		{`{"name":"bad","schedule":"sometimes","prompt":"p"}`, "unsupported schedule"},
+	}
+	for _, tt := range tests {
+		if _, err := callSchedule(reg, "create", tt.args); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("create %s: err = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+
+	if _, err := callSchedule(reg, "create", `{"name":"a","schedule":"@daily","prompt":"p"}`); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := callSchedule(reg, "create", `{"name":"b","schedule":"@daily","prompt":"p"}`); err == nil || !strings.Contains(err.Error(), "limit of 1") {
+		t.Errorf("expected job limit error, got %v", err)
+	}
+	if _, err := callSchedule(reg, "create", `{"name":"a","schedule":"@weekly","prompt":"p"}`); err == nil {
+		t.Error("expected error for duplicate name")
+	}
+}
+
+func TestTooFrequent(t *testing.T) {
+	first := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want bool
+	}{
+		{"0 9 * * *", false},
+		{"0,30 9 * * *", false},
+		{"0,30-59 9 * * *", true}, // 9:00, 9:30, then every minute
+		{"0 9 * * 1", false},
+		{"0 9 29 2 *", false}, // fires once in the window
+	}
+	for _, tt := range tests {
+		sched, err := scheduler.ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		if got := tooFrequent(sched, first, 15*time.Minute); got != tt.want {
+			t.Errorf("tooFrequent(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleCreateKeepsProfileAndAgent(t *testing.T) {
+	reg, store := newScheduleRegistry(t, ScheduleConfig{Agent: "home"})
+	ctx := toolreg.WithSessionKey(context.Background(), "chat-1")
+	ctx = toolreg.WithProfile(ctx, &toolreg.Profile{Name: "limited", Allow: []string{"schedule.*"}})
+
+	_, err := reg.Execute(ctx, provider.ToolCall{ID: "1", Name: "schedule.create", Arguments: `{"name":"n","schedule":"@daily","prompt":"p","session":"admin"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ := store.Jobs(); len(jobs) != 1 || jobs[0].Profile != "limited" || jobs[0].Agent != "home" {
+		t.Errorf("stored jobs = %+v", jobs)
+	}
+}
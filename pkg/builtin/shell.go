@@ -0,0 +1,302 @@
+// Package builtin provides native tools that run in-process instead of
+// through an external binary manifest.
+package builtin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// ShellConfig controls what the shell tool may do.
+type ShellConfig struct {
+	AllowedCommands []string       // Programs that may run (empty = any)
+	WorkDir         string         // Jail root; commands run here or below (default: current dir)
+	EnvWhitelist    []string       // Env vars passed through (default: PATH, HOME, LANG)
+	MaxOutputBytes  int            // Cap on returned output (default 65536)
+	Paths           *toolreg.Paths // Files commands may touch (nil = any; see checkPaths)
+	Offline         bool           // The allowed commands can't reach the network, so network policies don't apply
+}
+
+// DefaultShellConfig returns sensible defaults.
+func DefaultShellConfig() ShellConfig {
+	return ShellConfig{
+		EnvWhitelist:   []string{"PATH", "HOME", "LANG"},
+		MaxOutputBytes: 64 * 1024,
+	}
+}
+
+// Shell returns the "shell" tool manifest with a single "run" command.
+// Commands are split into arguments and executed directly, without a shell,
+// so pipes, redirection, and command chaining are rejected.
+func Shell(cfg ShellConfig) *toolreg.ToolManifest {
+	if cfg.MaxOutputBytes <= 0 {
+		cfg.MaxOutputBytes = 64 * 1024
+	}
+	if cfg.EnvWhitelist == nil {
+		cfg.EnvWhitelist = DefaultShellConfig().EnvWhitelist
+	}
+	s := &shell{cfg: cfg}
+	return &toolreg.ToolManifest{
+		Name:        "shell",
+		Description: "Run shell commands in the workspace",
+		Network:     !cfg.Offline, // Any program might, e.g. curl or git push
+		Commands: map[string]toolreg.CommandDef{
+			"run": {
+				Description: "Run a single command (no pipes, redirection, or chaining) and return its output",
+				Parameters: map[string]toolreg.ParameterDef{
+					"command": {Type: "string", Description: "Command line to run, e.g. \"git status --short\"", Required: true},
+					"workdir": {Type: "string", Description: "Working directory relative to the workspace root"},
+				},
+				Handler: s.run,
+			},
+		},
+	}
+}
+
+type shell struct {
+	cfg ShellConfig
+}
+
+func (s *shell) run(ctx context.Context, args map[string]any) (toolreg.ToolResult, error) {
+	line, _ := args["command"].(string)
+	argv, err := splitCommand(line)
+	if err != nil {
+		return toolreg.ToolResult{}, err
+	}
+	if len(argv) == 0 {
+		return toolreg.ToolResult{}, fmt.Errorf("shell: empty command")
+	}
+	if len(s.cfg.AllowedCommands) > 0 && !slices.Contains(s.cfg.AllowedCommands, argv[0]) {
+		return toolreg.ToolResult{}, fmt.Errorf("shell: command %q not allowed (allowed: %s)", argv[0], strings.Join(s.cfg.AllowedCommands, ", "))
+	}
+
+	rel, _ := args["workdir"].(string)
+	dir, err := s.resolveDir(rel)
+	if err != nil {
+		return toolreg.ToolResult{}, err
+	}
+	if err := s.checkPaths(dir, argv); err != nil {
+		return toolreg.ToolResult{}, fmt.Errorf("shell: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Env = filterEnv(os.Environ(), s.cfg.EnvWhitelist)
+
+	stdout := &cappedBuffer{max: s.cfg.MaxOutputBytes}
+	stderr := &cappedBuffer{max: s.cfg.MaxOutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	runErr := cmd.Run()
+	res := toolreg.ToolResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(runErr, &exitErr) && exitErr.ExitCode() > 0:
+		res.ExitCode = exitErr.ExitCode()
+		return res, fmt.Errorf("shell.run: %s exited with code %d", argv[0], res.ExitCode)
+	case runErr != nil:
+		res.ExitCode = -1
+		return res, fmt.Errorf("shell.run: %w", runErr)
+	}
+	return res, nil
+}
+
+// resolveDir resolves rel against the jail root and rejects escapes.
+func (s *shell) resolveDir(rel string) (string, error) {
+	root := s.cfg.WorkDir
+	if root == "" {
+		root = "."
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("shell: resolve workdir: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	if rel == "" {
+		return root, nil
+	}
+
+	dir := rel
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	if !within(root, dir) {
+		return "", fmt.Errorf("shell: workdir %q is outside %s", rel, root)
+	}
+	return dir, nil
+}
+
+// Commands that write the files they are given: every path argument, or
+// only the last (the destination).
+var (
+	writesAll  = []string{"rm", "rmdir", "unlink", "shred", "mv", "mkdir", "touch", "truncate", "tee", "chmod", "chown", "chgrp"}
+	writesLast = []string{"cp", "ln", "install", "rsync"}
+)
+
+// gitReadOnly are git subcommands that leave the repository alone.
+var gitReadOnly = []string{"status", "log", "diff", "show", "blame", "grep", "ls-files", "ls-tree", "rev-parse", "describe", "shortlog", "cat-file"}
+
+// checkPaths holds a command to the path policy, as far as its arguments
+// tell: the working directory and every argument, read as a path relative
+// to it, must be readable. Commands known to write files must be able to
+// write their targets, and git commands other than read-only ones must be
+// able to write the repository (the working directory, or -C). A program
+// can still reach files its arguments don't name, so keep allowed_commands
+// short too.
+func (s *shell) checkPaths(dir string, argv []string) error {
+	p := s.cfg.Paths
+	if p == nil {
+		return nil
+	}
+	if err := p.CanRead(dir); err != nil {
+		return err
+	}
+	prog := filepath.Base(argv[0])
+	repo, sub := dir, "" // For git: the repository and subcommand
+	var paths []string
+	for i := 1; i < len(argv); i++ {
+		arg := argv[i]
+		if prog == "git" && sub == "" {
+			switch {
+			case arg == "-C" && i+1 < len(argv):
+				repo = argv[i+1]
+				if !filepath.IsAbs(repo) {
+					repo = filepath.Join(dir, repo)
+				}
+			case !strings.HasPrefix(arg, "-") && argv[i-1] != "-C":
+				sub = arg
+			}
+		}
+		if strings.HasPrefix(arg, "-") {
+			_, v, ok := strings.Cut(arg, "=")
+			if !ok || v == "" {
+				continue
+			}
+			arg = v
+		}
+		if !filepath.IsAbs(arg) {
+			arg = filepath.Join(dir, arg)
+		}
+		if err := p.CanRead(arg); err != nil {
+			return err
+		}
+		paths = append(paths, arg)
+	}
+	switch {
+	case prog == "git" && !slices.Contains(gitReadOnly, sub):
+		return p.CanWrite(repo)
+	case slices.Contains(writesAll, prog):
+		for _, path := range paths {
+			if err := p.CanWrite(path); err != nil {
+				return err
+			}
+		}
+	case slices.Contains(writesLast, prog) && len(paths) > 0:
+		return p.CanWrite(paths[len(paths)-1])
+	}
+	return nil
+}
+
+// within reports whether path is root or below it.
+func within(root, path string) bool {
+	r, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return r == "." || (r != ".." && !strings.HasPrefix(r, ".."+string(filepath.Separator)))
+}
+
+// splitCommand splits a command line into arguments, honouring single and
+// double quotes. Shell control characters outside quotes are rejected.
+func splitCommand(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case strings.ContainsRune(";|&<>`$", r):
+			return nil, fmt.Errorf("shell: %q is not supported (commands run without a shell)", r)
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("shell: unterminated quote")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+func filterEnv(environ, allowed []string) []string {
+	var out []string
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if slices.Contains(allowed, name) {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// cappedBuffer keeps the first max bytes written and notes any overflow.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated int
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	room := c.max - c.buf.Len()
+	if room <= 0 {
+		c.truncated += len(p)
+		return len(p), nil
+	}
+	if len(p) > room {
+		c.buf.Write(p[:room])
+		c.truncated += len(p) - room
+		return len(p), nil
+	}
+	return c.buf.Write(p)
+}
+
+func (c *cappedBuffer) String() string {
+	if c.truncated == 0 {
+		return c.buf.String()
+	}
+	return fmt.Sprintf("%s\n\n[... %d bytes truncated]", c.buf.String(), c.truncated)
+}
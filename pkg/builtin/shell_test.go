@@ -0,0 +1,158 @@
+package builtin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func runShell(t *testing.T, cfg ShellConfig, args string) (string, error) {
+	t.Helper()
+	reg := toolreg.NewRegistry(5 * time.Second)
+	reg.Register(Shell(cfg))
+	res, err := reg.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "shell.run", Arguments: args})
+	return res.Stdout, err
+}
+
+func TestShellRun(t *testing.T) {
+	out, err := runShell(t, DefaultShellConfig(), `{"command":"echo 'hello world'"}`)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if out != "hello world\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestShellRun_AllowedCommands(t *testing.T) {
+	cfg := DefaultShellConfig()
+	cfg.AllowedCommands = []string{"echo"}
+	if _, err := runShell(t, cfg, `{"command":"ls"}`); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("expected not-allowed error, got %v", err)
+	}
+}
+
+func TestShellRun_RejectsShellSyntax(t *testing.T) {
+	for _, cmd := range []string{"echo hi; rm -rf x", "cat a | grep b", "echo $HOME", "echo hi > out"} {
+		if _, err := runShell(t, DefaultShellConfig(), `{"command":"`+cmd+`"}`); err == nil {
+			t.Errorf("%q: expected error", cmd)
+		}
+	}
+}
+
+func TestShellRun_WorkDirJail(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	cfg := DefaultShellConfig()
+	cfg.WorkDir = root
+
+	out, err := runShell(t, cfg, `{"command":"pwd","workdir":"sub"}`)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(out), "sub") {
+		t.Errorf("pwd = %q", out)
+	}
+
+	if _, err := runShell(t, cfg, `{"command":"pwd","workdir":"../.."}`); err == nil || !strings.Contains(err.Error(), "outside") {
+		t.Fatalf("expected jail error, got %v", err)
+	}
+}
+
+func TestShellRun_Failure(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.txt"), "a\n")
+	cfg := DefaultShellConfig()
+	cfg.WorkDir = root
+	reg := toolreg.NewRegistry(5 * time.Second)
+	reg.Register(Shell(cfg))
+
+	res, err := reg.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "shell.run", Arguments: `{"command":"ls a.txt missing.txt"}`})
+	if err == nil || !strings.Contains(err.Error(), "ls exited with code") {
+		t.Fatalf("err = %v", err)
+	}
+	if res.ExitCode <= 0 || res.Stdout != "a.txt\n" || !strings.Contains(res.Stderr, "missing.txt") {
+		t.Errorf("result = %+v", res)
+	}
+
+	res, err = reg.Execute(context.Background(), provider.ToolCall{ID: "2", Name: "shell.run", Arguments: `{"command":"no-such-program"}`})
+	if err == nil || res.ExitCode != -1 {
+		t.Errorf("missing program: %+v, %v", res, err)
+	}
+}
+
+func TestShellRun_Paths(t *testing.T) {
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	outside, _ := filepath.EvalSymlinks(t.TempDir())
+	writeFile(t, filepath.Join(root, ".env"), "TOKEN=x\n")
+	writeFile(t, filepath.Join(root, "a.txt"), "a\n")
+	cfg := DefaultShellConfig()
+	cfg.WorkDir = root
+	cfg.Paths = toolreg.NewPaths(toolreg.PathPolicy{Deny: []string{".env"}}, root)
+
+	if out, err := runShell(t, cfg, `{"command":"cat a.txt"}`); err != nil || out != "a\n" {
+		t.Errorf("cat a.txt = %q, %v", out, err)
+	}
+	for _, cmd := range []string{
+		"cat .env",
+		"grep --file=.env a.txt",
+		"cp a.txt " + outside + "/a.txt",
+		"touch " + outside + "/b.txt",
+		"git -C " + outside + " commit -m x",
+	} {
+		if _, err := runShell(t, cfg, `{"command":"`+cmd+`"}`); err == nil || !strings.Contains(err.Error(), "path not allowed") {
+			t.Errorf("%q: err = %v, want a path error", cmd, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "a.txt")); err == nil {
+		t.Error("cp wrote outside the workspace")
+	}
+	// Copying from outside in is a read there and a write here
+	writeFile(t, filepath.Join(outside, "c.txt"), "c\n")
+	if _, err := runShell(t, cfg, `{"command":"cp `+outside+`/c.txt c.txt"}`); err != nil {
+		t.Errorf("cp in: %v", err)
+	}
+}
+
+func TestShellRun_EnvWhitelist(t *testing.T) {
+	t.Setenv("TEENY_SECRET", "s3cret")
+	out, err := runShell(t, DefaultShellConfig(), `{"command":"env"}`)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if strings.Contains(out, "TEENY_SECRET") {
+		t.Error("non-whitelisted env var leaked")
+	}
+}
+
+func TestShellRun_OutputCap(t *testing.T) {
+	cfg := DefaultShellConfig()
+	cfg.MaxOutputBytes = 5
+	out, err := runShell(t, cfg, `{"command":"echo 0123456789"}`)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !strings.HasPrefix(out, "01234") || !strings.Contains(out, "truncated") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	args, err := splitCommand(`git commit -m "fix: a bug" --author='A B'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"git", "commit", "-m", "fix: a bug", "--author=A B"}
+	if strings.Join(args, "|") != strings.Join(want, "|") {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+	if _, err := splitCommand(`echo "open`); err == nil {
+		t.Error("expected unterminated quote error")
+	}
+}
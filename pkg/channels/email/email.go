@@ -0,0 +1,483 @@
+// Package email lets people email the agent. It polls an IMAP mailbox for
+// unread mail, runs each message as a prompt, and replies over SMTP.
+//
+// Each sender's email thread maps to one session, so replying to the
+// agent's answer continues the same conversation. Threads are followed
+// through the References and In-Reply-To headers.
+//
+// Only senders in Config.Allow are answered, and only when the receiving
+// server vouches for the sender: the topmost Authentication-Results header
+// must report a DMARC pass, or a DKIM pass for the From domain.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/notify"
+)
+
+// DefaultPoll is how often the mailbox is checked.
+const DefaultPoll = time.Minute
+
+// Config for the email adapter.
+type Config struct {
+	IMAPAddr      string // host:port of the IMAP server
+	Insecure      bool   // Plain-text IMAP instead of TLS, for local servers
+	Username      string
+	Password      string
+	Mailbox       string            // Default "INBOX"
+	Poll          time.Duration     // Default DefaultPoll
+	Allow         []string          // Senders that may start runs: addresses or "@domain" (required)
+	AuthServID    string            // If set, Authentication-Results must come from this server
+	NoAuthCheck   bool              // Accept mail without passing Authentication-Results, for servers that add none
+	SMTP          notify.SMTPConfig // Server replies are sent through; From is the agent's address
+	SessionPrefix string            // Session keys are "<prefix>:<sender>:<thread id>" (default "email")
+	Verbose       bool
+}
+
+// Runner runs a prompt in a session, reporting progress to onEvent. ask
+// emails a question to the user in the session's thread.
+type Runner func(ctx context.Context, sessionKey, prompt string, onEvent func(loop.Event), ask loop.AskFunc) (string, error)
+
+// sendMailFunc matches smtp.SendMail.
+type sendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// Adapter polls a mailbox and answers new mail with agent runs.
+type Adapter struct {
+	cfg      Config
+	run      Runner
+	sendMail sendMailFunc
+
+	mu        sync.Mutex
+	questions map[string]pendingQuestion // Pending user.ask answers per session
+}
+
+// pendingQuestion is a user.ask waiting for the run's sender to reply.
+type pendingQuestion struct {
+	from  string
+	reply chan string
+}
+
+// New creates an adapter. Call Run to start polling.
+func New(cfg Config, run Runner) *Adapter {
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	if cfg.Poll <= 0 {
+		cfg.Poll = DefaultPoll
+	}
+	if cfg.SMTP.Port == 0 {
+		cfg.SMTP.Port = 587
+	}
+	if cfg.SessionPrefix == "" {
+		cfg.SessionPrefix = "email"
+	}
+	return &Adapter{cfg: cfg, run: run, sendMail: smtp.SendMail, questions: make(map[string]pendingQuestion)}
+}
+
+// Run polls the mailbox until ctx is cancelled. A failure on the first
+// poll, such as a wrong password, is returned; later ones are logged and
+// retried at the next poll.
+func (a *Adapter) Run(ctx context.Context) error {
+	if a.cfg.IMAPAddr == "" || a.cfg.Username == "" {
+		return errors.New("email: imap address and username are required")
+	}
+	if a.cfg.SMTP.Host == "" || a.cfg.SMTP.From == "" {
+		return errors.New("email: smtp host and from address are required")
+	}
+	if len(a.cfg.Allow) == 0 {
+		return errors.New("email: allow is required; without it anyone could run the agent")
+	}
+	if err := a.poll(ctx); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	ticker := time.NewTicker(a.cfg.Poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := a.poll(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("[email] poll: %v", err)
+			}
+		}
+	}
+}
+
+// poll handles every unread message in the mailbox. Messages are marked
+// seen before they run, so a crash mid-run doesn't answer them twice.
+func (a *Adapter) poll(ctx context.Context) error {
+	c, err := dialIMAP(ctx, a.cfg.IMAPAddr, a.cfg.Insecure)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	if err := c.login(a.cfg.Username, a.cfg.Password); err != nil {
+		return err
+	}
+	if err := c.selectMailbox(a.cfg.Mailbox); err != nil {
+		return err
+	}
+	uids, err := c.unseen()
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		raw, err := c.fetch(uid)
+		if err != nil {
+			return err
+		}
+		if err := c.markSeen(uid); err != nil {
+			return err
+		}
+		a.dispatch(ctx, raw)
+	}
+	return c.logout()
+}
+
+// message is the part of an email the adapter uses.
+type message struct {
+	from       string // Sender address, lowercased
+	subject    string
+	id         string   // Message-ID, with angle brackets
+	references []string // Thread ancestors, oldest first
+	body       string   // Plain-text body without quoted replies
+	automatic  bool     // Auto-replies and list mail, which must not be answered
+	authResult string   // Topmost Authentication-Results header
+}
+
+// thread returns the ID of the message that started m's thread.
+func (m *message) thread() string {
+	if len(m.references) > 0 {
+		return m.references[0]
+	}
+	return m.id
+}
+
+// dispatch starts a run for a new message, or hands it to a question
+// waiting in its thread.
+func (a *Adapter) dispatch(ctx context.Context, raw []byte) {
+	m, err := parseMessage(raw)
+	if err != nil {
+		log.Printf("[email] skipping message: %v", err)
+		return
+	}
+	if m.automatic || strings.EqualFold(m.from, bareAddress(a.cfg.SMTP.From)) {
+		return
+	}
+	if !a.allowed(m.from) {
+		if a.cfg.Verbose {
+			log.Printf("[email] ignoring mail from %s", m.from)
+		}
+		return
+	}
+	if !a.cfg.NoAuthCheck && !authenticated(m.authResult, a.cfg.AuthServID, m.from) {
+		log.Printf("[email] ignoring mail claiming to be from %s: the sender isn't authenticated", m.from)
+		return
+	}
+	if m.body == "" {
+		return
+	}
+	if a.answer(a.SessionKey(m.from, m.thread()), m.from, m.body) {
+		return
+	}
+	go a.handle(ctx, m)
+}
+
+// handle runs the message in its thread's session and replies with the
+// result. A run in progress when Run returns still finishes and replies;
+// the Runner decides when to give up on it.
+func (a *Adapter) handle(ctx context.Context, m *message) {
+	ctx = context.WithoutCancel(ctx)
+	key := a.SessionKey(m.from, m.thread())
+	if a.cfg.Verbose {
+		log.Printf("[email] %s from %s: %s", key, m.from, m.subject)
+	}
+
+	ask := func(ctx context.Context, question string) (string, error) {
+		reply := make(chan string, 1)
+		a.mu.Lock()
+		a.questions[key] = pendingQuestion{from: m.from, reply: reply}
+		a.mu.Unlock()
+		defer func() {
+			a.mu.Lock()
+			delete(a.questions, key)
+			a.mu.Unlock()
+		}()
+		if err := a.reply(m, question+"\n\nReply to this email to answer."); err != nil {
+			return "", fmt.Errorf("email: send question: %w", err)
+		}
+		select {
+		case answer := <-reply:
+			return answer, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	prompt := m.body
+	if m.subject != "" && len(m.references) == 0 {
+		prompt = "Subject: " + m.subject + "\n\n" + prompt
+	}
+	result, err := a.run(audit.WithActor(ctx, "email:"+m.from), key, prompt, nil, ask)
+	if err != nil {
+		result = "The run failed: " + err.Error()
+	}
+	if err := a.reply(m, result); err != nil {
+		log.Printf("[email] reply to %s: %v", m.from, err)
+	}
+}
+
+// answer hands text from the sender from to a question waiting in the
+// session, reporting whether there was one. Only the sender whose mail
+// started the run may answer.
+func (a *Adapter) answer(key, from, text string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	q, ok := a.questions[key]
+	if !ok || q.from != from {
+		return false
+	}
+	delete(a.questions, key)
+	q.reply <- text
+	return true
+}
+
+// reply sends body to m's sender, threaded under m.
+func (a *Adapter) reply(m *message, body string) error {
+	subject := m.subject
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+	refs := append(slices.Clone(m.references), m.id)
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", a.cfg.SMTP.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: %s\r\n", newMessageID(a.cfg.SMTP.From))
+	if m.id != "" {
+		fmt.Fprintf(&msg, "In-Reply-To: %s\r\n", m.id)
+		fmt.Fprintf(&msg, "References: %s\r\n", strings.Join(refs, " "))
+	}
+	msg.WriteString("Auto-Submitted: auto-replied\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	io.WriteString(qp, body)
+	qp.Close()
+
+	var auth smtp.Auth
+	if a.cfg.SMTP.Username != "" {
+		auth = smtp.PlainAuth("", a.cfg.SMTP.Username, a.cfg.SMTP.Password, a.cfg.SMTP.Host)
+	}
+	addr := a.cfg.SMTP.Host + ":" + strconv.Itoa(a.cfg.SMTP.Port)
+	return a.sendMail(addr, auth, bareAddress(a.cfg.SMTP.From), []string{m.from}, []byte(msg.String()))
+}
+
+// allowed reports whether Allow lets from start runs.
+func (a *Adapter) allowed(from string) bool {
+	for _, allow := range a.cfg.Allow {
+		allow = strings.ToLower(allow)
+		if allow == from || strings.HasPrefix(allow, "@") && strings.HasSuffix(from, allow) {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionKey maps a sender's email thread, named by the Message-ID of its
+// first message, to a session key. The sender is part of the key, so
+// mail that names someone else's thread in its References can't join
+// their session.
+func (a *Adapter) SessionKey(from, thread string) string {
+	return a.cfg.SessionPrefix + ":" + unsafeKeyChars.ReplaceAllString(from, "-") + ":" +
+		unsafeKeyChars.ReplaceAllString(strings.Trim(thread, "<>"), "-")
+}
+
+// authenticated reports whether the Authentication-Results header result,
+// from the server authServID if that is set, shows that mail from the
+// address from really comes from its domain: a DMARC pass for it, or a
+// DKIM pass with a signing domain aligned with it.
+func authenticated(result, authServID, from string) bool {
+	_, domain, ok := strings.Cut(from, "@")
+	if !ok || result == "" {
+		return false
+	}
+	clauses := strings.Split(headerComments.ReplaceAllString(result, ""), ";")
+	if id, _, _ := strings.Cut(strings.TrimSpace(clauses[0]), " "); authServID != "" && !strings.EqualFold(id, authServID) {
+		return false
+	}
+	for _, clause := range clauses[1:] {
+		fields := strings.Fields(strings.ToLower(clause))
+		if len(fields) == 0 {
+			continue
+		}
+		var property string
+		switch fields[0] {
+		case "dmarc=pass":
+			property = "header.from="
+		case "dkim=pass":
+			property = "header.d="
+		default:
+			continue
+		}
+		for _, f := range fields[1:] {
+			if d, ok := strings.CutPrefix(f, property); ok && (d == domain || strings.HasSuffix(domain, "."+d)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headerComments are the parenthesized comments in a header.
+var headerComments = regexp.MustCompile(`\([^)]*\)`)
+
+// unsafeKeyChars are Message-ID characters that don't belong in a session
+// key, which also names the session's file.
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9.@_-]+`)
+
+func parseMessage(raw []byte) (*message, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	h := msg.Header
+	from, err := mail.ParseAddress(h.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(h.Get("Subject"))
+	if err != nil {
+		subject = h.Get("Subject")
+	}
+	m := &message{
+		from:    strings.ToLower(from.Address),
+		subject: strings.TrimSpace(subject),
+		id:      strings.TrimSpace(h.Get("Message-ID")),
+	}
+	m.references = strings.Fields(h.Get("References"))
+	if len(m.references) == 0 {
+		m.references = strings.Fields(h.Get("In-Reply-To"))
+	}
+	auto := strings.ToLower(h.Get("Auto-Submitted"))
+	precedence := strings.ToLower(h.Get("Precedence"))
+	m.automatic = auto != "" && auto != "no" || precedence == "bulk" || precedence == "list" || precedence == "junk"
+	if results := h["Authentication-Results"]; len(results) > 0 {
+		m.authResult = results[0] // Added last, by the receiving server
+	}
+
+	body, err := textBody(h.Get("Content-Type"), h.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	m.body = stripQuoted(body)
+	return m, nil
+}
+
+// textBody returns the first text/plain part of a message body.
+func textBody(contentType, encoding string, body io.Reader) (string, error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := textBody(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return "", err
+			}
+			if text != "" {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+	switch strings.ToLower(encoding) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	b, err := io.ReadAll(body)
+	return string(b), err
+}
+
+// stripQuoted drops the quoted message a reply ends with: "> " lines and
+// the "On ..., X wrote:" line before them.
+func stripQuoted(body string) string {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, ">") {
+			continue
+		}
+		kept := lines[:i]
+		for len(kept) > 0 && strings.TrimSpace(kept[len(kept)-1]) == "" {
+			kept = kept[:len(kept)-1]
+		}
+		if len(kept) > 0 && strings.HasSuffix(strings.TrimSpace(kept[len(kept)-1]), "wrote:") {
+			kept = kept[:len(kept)-1]
+		}
+		if text := strings.TrimSpace(strings.Join(kept, "\n")); text != "" {
+			return text
+		}
+		break
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// bareAddress returns the address in "Name <addr>", or addr unchanged.
+func bareAddress(addr string) string {
+	if a, err := mail.ParseAddress(addr); err == nil {
+		return a.Address
+	}
+	return addr
+}
+
+func newMessageID(from string) string {
+	domain := "localhost"
+	if _, d, ok := strings.Cut(bareAddress(from), "@"); ok {
+		domain = d
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,314 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/notify"
+)
+
+// authHeader is the header a receiving server adds to mail from
+// example.com that passed its checks.
+const authHeader = "Authentication-Results: mx.example.com; dkim=pass (good signature) header.d=example.com header.s=s1; dmarc=pass header.from=example.com\r\n"
+
+const firstMail = authHeader +
+	"From: Ann <Ann@example.com>\r\n" +
+	"To: agent@example.com\r\n" +
+	"Subject: Weekly report\r\n" +
+	"Message-ID: <m1@example.com>\r\n" +
+	"\r\n" +
+	"Summarize last week's commits.\r\n"
+
+// fakeIMAP serves one mailbox to each connection, and records the
+// commands it got.
+type fakeIMAP struct {
+	ln       net.Listener
+	messages map[string]string // UID → raw message
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newFakeIMAP(t *testing.T, messages map[string]string) *fakeIMAP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeIMAP{ln: ln, messages: messages}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeIMAP) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprint(conn, "* OK fake IMAP ready\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+		f.mu.Lock()
+		f.commands = append(f.commands, command)
+		f.mu.Unlock()
+		switch {
+		case strings.HasPrefix(command, "LOGIN"):
+			if command != `LOGIN "agent" "p\"w"` {
+				fmt.Fprintf(conn, "%s NO bad credentials\r\n", tag)
+				continue
+			}
+		case command == "UID SEARCH UNSEEN":
+			var uids []string
+			for uid := range f.messages {
+				uids = append(uids, uid)
+			}
+			fmt.Fprintf(conn, "* SEARCH %s\r\n", strings.Join(uids, " "))
+		case strings.HasPrefix(command, "UID FETCH"):
+			uid := strings.Fields(command)[2]
+			msg := f.messages[uid]
+			fmt.Fprintf(conn, "* 1 FETCH (UID %s BODY[] {%d}\r\n%s)\r\n", uid, len(msg), msg)
+		case command == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE\r\n%s OK done\r\n", tag)
+			return
+		}
+		fmt.Fprintf(conn, "%s OK done\r\n", tag)
+	}
+}
+
+type sent struct {
+	to  []string
+	msg string
+}
+
+func newTestAdapter(cfg Config, run Runner) (*Adapter, chan sent) {
+	cfg.SMTP = notify.SMTPConfig{Host: "smtp.example.com", From: "Agent <agent@example.com>"}
+	if cfg.Allow == nil {
+		cfg.Allow = []string{"@example.com"}
+	}
+	a := New(cfg, run)
+	mails := make(chan sent, 4)
+	a.sendMail = func(_ string, _ smtp.Auth, _ string, to []string, msg []byte) error {
+		mails <- sent{to, string(msg)}
+		return nil
+	}
+	return a, mails
+}
+
+func receive(t *testing.T, mails chan sent) sent {
+	t.Helper()
+	select {
+	case m := <-mails:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("no email sent")
+		return sent{}
+	}
+}
+
+func TestPollRunsAndReplies(t *testing.T) {
+	imap := newFakeIMAP(t, map[string]string{"7": firstMail})
+	var gotKey, gotPrompt, gotActor string
+	a, mails := newTestAdapter(Config{IMAPAddr: imap.ln.Addr().String(), Insecure: true, Username: "agent", Password: `p"w`},
+		func(ctx context.Context, key, prompt string, _ func(loop.Event), _ loop.AskFunc) (string, error) {
+			gotKey, gotPrompt, gotActor = key, prompt, audit.ActorFrom(ctx)
+			return "12 commits, all green.", nil
+		})
+
+	if err := a.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	reply := receive(t, mails)
+
+	if gotKey != "email:ann@example.com:m1@example.com" || gotPrompt != "Subject: Weekly report\n\nSummarize last week's commits." || gotActor != "email:ann@example.com" {
+		t.Errorf("run(%q, %q) by %q", gotKey, gotPrompt, gotActor)
+	}
+	if len(reply.to) != 1 || reply.to[0] != "ann@example.com" {
+		t.Errorf("to = %v", reply.to)
+	}
+	for _, want := range []string{"Subject: Re: Weekly report\r\n", "In-Reply-To: <m1@example.com>\r\n", "References: <m1@example.com>\r\n", "12 commits, all green."} {
+		if !strings.Contains(reply.msg, want) {
+			t.Errorf("reply missing %q:\n%s", want, reply.msg)
+		}
+	}
+	imap.mu.Lock()
+	defer imap.mu.Unlock()
+	if !strings.Contains(strings.Join(imap.commands, "\n"), `UID STORE 7 +FLAGS.SILENT (\Seen)`) {
+		t.Errorf("message not marked seen: %q", imap.commands)
+	}
+}
+
+func TestPollBadLogin(t *testing.T) {
+	imap := newFakeIMAP(t, nil)
+	a, _ := newTestAdapter(Config{IMAPAddr: imap.ln.Addr().String(), Insecure: true, Username: "agent", Password: "wrong"}, nil)
+	if err := a.poll(context.Background()); err == nil || !strings.Contains(err.Error(), "bad credentials") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestReplyContinuesThread(t *testing.T) {
+	a, mails := newTestAdapter(Config{}, func(_ context.Context, key, prompt string, _ func(loop.Event), _ loop.AskFunc) (string, error) {
+		if key != "email:ann@example.com:m1@example.com" || prompt != "And the week before?" {
+			t.Errorf("run(%q, %q)", key, prompt)
+		}
+		return "9 commits.", nil
+	})
+	a.dispatch(context.Background(), []byte(authHeader+"From: ann@example.com\r\n"+
+		"Subject: Re: Weekly report\r\n"+
+		"Message-ID: <m3@example.com>\r\n"+
+		"In-Reply-To: <r2@example.com>\r\n"+
+		"References: <m1@example.com> <r2@example.com>\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Transfer-Encoding: quoted-printable\r\n"+
+		"\r\n"+
+		"And the week=20before?\r\n"+
+		"\r\n"+
+		"On Mon, Agent wrote:\r\n"+
+		"> 12 commits, all green.\r\n"))
+
+	reply := receive(t, mails)
+	if !strings.Contains(reply.msg, "Subject: Re: Weekly report\r\n") || !strings.Contains(reply.msg, "References: <m1@example.com> <r2@example.com> <m3@example.com>\r\n") {
+		t.Errorf("reply:\n%s", reply.msg)
+	}
+}
+
+func TestAskWaitsForReply(t *testing.T) {
+	answers := make(chan string, 1)
+	a, mails := newTestAdapter(Config{}, func(ctx context.Context, key, _ string, _ func(loop.Event), ask loop.AskFunc) (string, error) {
+		if strings.Contains(key, "bob@") {
+			return "A run of bob's own", nil
+		}
+		answer, err := ask(ctx, "Which repo?")
+		answers <- answer
+		return "done", err
+	})
+	a.dispatch(context.Background(), []byte(firstMail))
+
+	question := receive(t, mails)
+	if !strings.Contains(question.msg, "Which repo?") {
+		t.Fatalf("question:\n%s", question.msg)
+	}
+	// Someone else in the thread can't answer for the sender; their mail
+	// starts a run of its own
+	a.dispatch(context.Background(), []byte(authHeader+"From: bob@example.com\r\nMessage-ID: <b1@example.com>\r\nReferences: <m1@example.com> <q@example.com>\r\n\r\nThe web one\r\n"))
+	a.dispatch(context.Background(), []byte(authHeader+"From: ann@example.com\r\nMessage-ID: <m2@example.com>\r\nReferences: <m1@example.com> <q@example.com>\r\n\r\nThe api one\r\n"))
+	select {
+	case answer := <-answers:
+		if answer != "The api one" {
+			t.Errorf("answer = %q", answer)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("question not answered")
+	}
+	receive(t, mails) // The runs' results
+	receive(t, mails)
+}
+
+func TestDispatchSkips(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"not allowed", strings.Replace(firstMail, "Ann@example.com", "eve@evil.example", 1)},
+		{"unauthenticated", strings.TrimPrefix(firstMail, authHeader)},
+		{"failed dkim", strings.Replace(firstMail, authHeader, "Authentication-Results: mx.example.com; dkim=fail header.d=example.com; dmarc=fail header.from=example.com\r\n", 1)},
+		{"signed by another domain", strings.Replace(firstMail, authHeader, "Authentication-Results: mx.example.com; dkim=pass header.d=evil.example\r\n", 1)},
+		{"auto reply", "Auto-Submitted: auto-replied\r\n" + firstMail},
+		{"list mail", "Precedence: bulk\r\n" + firstMail},
+		{"from ourselves", strings.Replace(firstMail, "Ann <Ann@example.com>", "agent@example.com", 1)},
+		{"empty body", strings.TrimSuffix(firstMail, "Summarize last week's commits.\r\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := make(chan string, 1)
+			a, _ := newTestAdapter(Config{Allow: []string{"@Example.com"}}, func(_ context.Context, key, _ string, _ func(loop.Event), _ loop.AskFunc) (string, error) {
+				runs <- key
+				return "", nil
+			})
+			a.dispatch(context.Background(), []byte(tt.raw))
+			select {
+			case key := <-runs:
+				t.Errorf("ran %s", key)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestTextBodyMultipart(t *testing.T) {
+	raw := "From: ann@example.com\r\n" +
+		"Message-ID: <m1@example.com>\r\n" +
+		"Content-Type: multipart/alternative; boundary=XX\r\n" +
+		"\r\n" +
+		"--XX\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"UGluZyB0aGUgc2VydmVy\r\n" +
+		"--XX\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<p>Ping the server</p>\r\n" +
+		"--XX--\r\n"
+	m, err := parseMessage([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.body != "Ping the server" {
+		t.Errorf("body = %q", m.body)
+	}
+}
+
+func TestSessionKey(t *testing.T) {
+	a := New(Config{}, nil)
+	if got := a.SessionKey("ann+x@example.com", "<CA+b/c=d@mail.example.com>"); got != "email:ann-x@example.com:CA-b-c-d@mail.example.com" {
+		t.Errorf("SessionKey = %q", got)
+	}
+}
+
+func TestAuthenticated(t *testing.T) {
+	tests := []struct {
+		result, authServID, from string
+		want                     bool
+	}{
+		{"mx.example.com; dmarc=pass header.from=example.com", "", "ann@example.com", true},
+		{"mx.example.com; dkim=pass header.d=example.com", "", "ann@mail.example.com", true},
+		{"mx.example.com; dkim=pass header.d=mail.example.com", "", "ann@example.com", false},
+		{"mx.example.com; spf=pass smtp.mailfrom=example.com", "", "ann@example.com", false},
+		{"mx.example.com; dmarc=pass header.from=example.com", "mx.example.com", "ann@example.com", true},
+		{"evil.example; dmarc=pass header.from=example.com", "mx.example.com", "ann@example.com", false},
+		{"mx.example.com; dmarc=pass (p=none) header.from=example.com", "", "ann@example.com", true},
+		{"", "", "ann@example.com", false},
+	}
+	for _, tt := range tests {
+		if got := authenticated(tt.result, tt.authServID, tt.from); got != tt.want {
+			t.Errorf("authenticated(%q, %q, %q) = %v", tt.result, tt.authServID, tt.from, got)
+		}
+	}
+}
+
+func TestRunRequiresAllow(t *testing.T) {
+	a, _ := newTestAdapter(Config{IMAPAddr: "localhost:993", Username: "agent", Allow: []string{}}, nil)
+	if err := a.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "allow") {
+		t.Errorf("err = %v", err)
+	}
+}
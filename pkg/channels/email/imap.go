@@ -0,0 +1,202 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// imapTimeout bounds one poll: connect, fetch, and log out.
+	imapTimeout = 2 * time.Minute
+	// maxLiteral caps the size of a fetched message.
+	maxLiteral = 25 << 20
+)
+
+// imapClient speaks just enough IMAP4rev1 (RFC 3501) to read new mail:
+// LOGIN, SELECT, UID SEARCH, UID FETCH, UID STORE, and LOGOUT.
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+	stop func() bool
+}
+
+// imapResponse is one server response. Literals ({n} followed by n bytes)
+// are cut out of line and kept in order in literals.
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+// dialIMAP connects to addr over TLS, or plain TCP if insecure, and reads
+// the server greeting. The connection closes when ctx is done.
+func dialIMAP(ctx context.Context, addr string, insecure bool) (*imapClient, error) {
+	d := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if insecure {
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&tls.Dialer{NetDialer: d}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("imap: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(imapTimeout))
+	c := &imapClient{conn: conn, r: bufio.NewReader(conn), stop: context.AfterFunc(ctx, func() { conn.Close() })}
+
+	greeting, err := c.read()
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("imap: greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting.line, "* OK") && !strings.HasPrefix(greeting.line, "* PREAUTH") {
+		c.close()
+		return nil, fmt.Errorf("imap: greeting: %s", greeting.line)
+	}
+	return c, nil
+}
+
+func (c *imapClient) close() error {
+	c.stop()
+	return c.conn.Close()
+}
+
+// cmd sends a command and returns its untagged responses, with the "* "
+// prefix removed. A NO or BAD completion is an error.
+func (c *imapClient) cmd(format string, args ...any) ([]imapResponse, error) {
+	c.tag++
+	tag := "A" + strconv.Itoa(c.tag)
+	command := fmt.Sprintf(format, args...)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+		return nil, fmt.Errorf("imap: %w", err)
+	}
+	verb, _, _ := strings.Cut(command, " ")
+	var untagged []imapResponse
+	for {
+		resp, err := c.read()
+		if err != nil {
+			return nil, fmt.Errorf("imap: %s: %w", verb, err)
+		}
+		if status, ok := strings.CutPrefix(resp.line, tag+" "); ok {
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("imap: %s: %s", verb, status)
+			}
+			return untagged, nil
+		}
+		if line, ok := strings.CutPrefix(resp.line, "* "); ok {
+			resp.line = line
+			untagged = append(untagged, resp)
+		}
+	}
+}
+
+func (c *imapClient) read() (imapResponse, error) {
+	var resp imapResponse
+	var b strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		b.WriteString(line)
+		n, ok := literalSize(line)
+		if !ok {
+			resp.line = b.String()
+			return resp, nil
+		}
+		if n > maxLiteral {
+			return resp, fmt.Errorf("literal of %d bytes is too large", n)
+		}
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(c.r, lit); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, lit)
+	}
+}
+
+// literalSize reports the size of the literal announced at the end of
+// line, as in "* 1 FETCH (BODY[] {342}".
+func literalSize(line string) (int, bool) {
+	if !strings.HasSuffix(line, "}") {
+		return 0, false
+	}
+	i := strings.LastIndexByte(line, '{')
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(line[i+1:len(line)-1], "+"))
+	return n, err == nil && n >= 0
+}
+
+func (c *imapClient) login(username, password string) error {
+	_, err := c.cmd("LOGIN %s %s", quote(username), quote(password))
+	return err
+}
+
+func (c *imapClient) selectMailbox(name string) error {
+	_, err := c.cmd("SELECT %s", quote(name))
+	return err
+}
+
+// unseen returns the UIDs of messages without the \Seen flag.
+func (c *imapClient) unseen() ([]uint32, error) {
+	resps, err := c.cmd("UID SEARCH UNSEEN")
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, r := range resps {
+		fields := strings.Fields(r.line)
+		if len(fields) == 0 || fields[0] != "SEARCH" {
+			continue
+		}
+		for _, f := range fields[1:] {
+			uid, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("imap: SEARCH: bad uid %q", f)
+			}
+			uids = append(uids, uint32(uid))
+		}
+	}
+	return uids, nil
+}
+
+// fetch returns a message's raw RFC 5322 text without marking it seen.
+func (c *imapClient) fetch(uid uint32) ([]byte, error) {
+	resps, err := c.cmd("UID FETCH %d BODY.PEEK[]", uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resps {
+		if strings.Contains(r.line, "FETCH") && len(r.literals) > 0 {
+			return r.literals[0], nil
+		}
+	}
+	return nil, errors.New("imap: FETCH: no message body")
+}
+
+func (c *imapClient) markSeen(uid uint32) error {
+	_, err := c.cmd(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+func (c *imapClient) logout() error {
+	_, err := c.cmd("LOGOUT")
+	return err
+}
+
+// quote makes s an IMAP quoted string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,140 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the REST API of github.com.
+const DefaultAPIURL = "https://api.github.com"
+
+// Client calls the parts of the GitHub REST API the adapter and the
+// github tools use.
+type Client struct {
+	token   string
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient creates a client that authenticates with token. apiURL is
+// DefaultAPIURL when empty; GitHub Enterprise uses https://<host>/api/v3.
+func NewClient(token, apiURL string) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Client{token: token, baseURL: strings.TrimSuffix(apiURL, "/"), http: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Issue is an issue or pull request, as webhooks send it.
+type Issue struct {
+	Number      int    `json:"number"`
+	Title       string `json:"title"`
+	Body        string `json:"body"`
+	URL         string `json:"html_url"`
+	PullRequest *struct {
+		URL string `json:"url"`
+	} `json:"pull_request,omitempty"` // Set on pull requests
+}
+
+// ReviewComment is an inline comment on one line of a pull request's
+// changed file.
+type ReviewComment struct {
+	Path string `json:"path"`
+	Line int    `json:"line"` // Line in the new version of the file
+	Body string `json:"body"`
+}
+
+// Review events.
+const (
+	EventComment        = "COMMENT"
+	EventApprove        = "APPROVE"
+	EventRequestChanges = "REQUEST_CHANGES"
+)
+
+// PullDiff returns a pull request's unified diff. repo is "owner/name".
+func (c *Client) PullDiff(ctx context.Context, repo string, number int) (string, error) {
+	var diff bytes.Buffer
+	if err := c.do(ctx, "GET", fmt.Sprintf("/repos/%s/pulls/%d", repo, number), "application/vnd.github.diff", nil, &diff); err != nil {
+		return "", err
+	}
+	return diff.String(), nil
+}
+
+// Comment posts a comment on an issue or pull request and returns its URL.
+func (c *Client) Comment(ctx context.Context, repo string, number int, body string) (string, error) {
+	var out struct {
+		URL string `json:"html_url"`
+	}
+	err := c.do(ctx, "POST", fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number), "", map[string]string{"body": body}, &out)
+	return out.URL, err
+}
+
+// Review submits a pull request review and returns its URL. event is one
+// of the Event constants.
+func (c *Client) Review(ctx context.Context, repo string, number int, event, body string, comments []ReviewComment) (string, error) {
+	req := struct {
+		Event    string          `json:"event"`
+		Body     string          `json:"body,omitempty"`
+		Comments []ReviewComment `json:"comments,omitempty"`
+	}{event, body, comments}
+	var out struct {
+		URL string `json:"html_url"`
+	}
+	err := c.do(ctx, "POST", fmt.Sprintf("/repos/%s/pulls/%d/reviews", repo, number), "", req, &out)
+	return out.URL, err
+}
+
+// do sends a request. A *bytes.Buffer out receives the raw body; anything
+// else is decoded from JSON.
+func (c *Client) do(ctx context.Context, method, path, accept string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("github: %w", err)
+	}
+	if accept == "" {
+		accept = "application/vnd.github+json"
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("github: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+		return fmt.Errorf("github: %s %s: %s %s", method, path, resp.Status, e.Message)
+	}
+	if buf, ok := out.(*bytes.Buffer); ok {
+		_, err = buf.ReadFrom(resp.Body)
+	} else if out != nil {
+		err = json.NewDecoder(resp.Body).Decode(out)
+	}
+	if err != nil {
+		return fmt.Errorf("github: %s %s: %w", method, path, err)
+	}
+	return nil
+}
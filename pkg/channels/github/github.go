@@ -0,0 +1,267 @@
+// Package github answers GitHub issue and pull request comments that
+// mention the bot.
+//
+// GitHub delivers issue_comment webhooks to the adapter. A comment that
+// mentions the bot starts a run with the issue, and for pull requests the
+// diff, in the prompt, and the answer is posted back as a comment. Each
+// issue or pull request maps to one session, so later mentions continue
+// the same conversation.
+package github
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+)
+
+const (
+	// maxBody caps webhook payload size.
+	maxBody = 5 << 20
+	// maxDiff caps how much of a pull request's diff goes in the prompt.
+	maxDiff = 30 << 10
+)
+
+// defaultAssociations are the commenters trusted to start runs when the
+// config doesn't say: people with write access to the repo, not anyone
+// who can comment on it.
+var defaultAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// Config for the GitHub adapter.
+type Config struct {
+	Bot           string   // Login that comments mention, without the @
+	Secret        string   // Webhook secret; deliveries without a valid signature are refused
+	Repos         []string // "owner/name" repos to answer in (empty = any)
+	Associations  []string // Author associations that may start runs (default OWNER, MEMBER, COLLABORATOR)
+	SessionPrefix string   // Session keys are "<prefix>:<owner>:<name>:<number>" (default "github")
+	Verbose       bool
+}
+
+// Runner runs a prompt in a session, reporting progress to onEvent. ask
+// posts a question to the user as a comment.
+type Runner func(ctx context.Context, sessionKey, prompt string, onEvent func(loop.Event), ask loop.AskFunc) (string, error)
+
+// commenter is the subset of the REST API the adapter uses.
+type commenter interface {
+	PullDiff(ctx context.Context, repo string, number int) (string, error)
+	Comment(ctx context.Context, repo string, number int, body string) (string, error)
+}
+
+// Adapter serves GitHub webhooks and answers mentions with agent runs.
+type Adapter struct {
+	cfg     Config
+	api     commenter
+	run     Runner
+	mention *regexp.Regexp
+
+	mu        sync.Mutex
+	questions map[string]pendingQuestion // Pending user.ask questions per session
+}
+
+// pendingQuestion waits for an answer from the commenter whose run asked it.
+type pendingQuestion struct {
+	login string
+	reply chan string
+}
+
+// New creates an adapter that talks to GitHub through client. Mount it
+// where GitHub delivers webhooks.
+func New(cfg Config, client *Client, run Runner) *Adapter {
+	if cfg.SessionPrefix == "" {
+		cfg.SessionPrefix = "github"
+	}
+	if len(cfg.Associations) == 0 {
+		cfg.Associations = defaultAssociations
+	}
+	return &Adapter{
+		cfg:       cfg,
+		api:       client,
+		run:       run,
+		mention:   regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(cfg.Bot) + `\b`),
+		questions: make(map[string]pendingQuestion),
+	}
+}
+
+// commentEvent is the part of an issue_comment webhook the adapter uses.
+type commentEvent struct {
+	Action  string `json:"action"`
+	Issue   Issue  `json:"issue"`
+	Comment struct {
+		Body              string `json:"body"`
+		User              user   `json:"user"`
+		AuthorAssociation string `json:"author_association"` // The author's relation to the repo, e.g. "OWNER" or "NONE"
+	} `json:"comment"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+type user struct {
+	Login string `json:"login"`
+	Type  string `json:"type"` // "User" or "Bot"
+}
+
+// ServeHTTP accepts issue_comment webhooks. Comments that mention the bot
+// get 202 Accepted with the session key, and the run continues in the
+// background; other deliveries get 204.
+func (a *Adapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxBody {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !validSignature(a.cfg.Secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("X-GitHub-Event") != "issue_comment" {
+		w.WriteHeader(http.StatusNoContent) // Including the ping sent when the webhook is created
+		return
+	}
+	var ev commentEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		http.Error(w, "payload must be JSON", http.StatusBadRequest)
+		return
+	}
+
+	repo := ev.Repository.FullName
+	author := ev.Comment.User
+	switch {
+	case ev.Action != "created",
+		author.Type == "Bot" || strings.EqualFold(author.Login, a.cfg.Bot),
+		len(a.cfg.Repos) > 0 && !slices.ContainsFunc(a.cfg.Repos, func(r string) bool { return strings.EqualFold(r, repo) }),
+		!slices.ContainsFunc(a.cfg.Associations, func(as string) bool { return strings.EqualFold(as, ev.Comment.AuthorAssociation) }),
+		!a.mention.MatchString(ev.Comment.Body):
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	text := strings.TrimSpace(a.mention.ReplaceAllString(ev.Comment.Body, ""))
+	key := a.SessionKey(repo, ev.Issue.Number)
+	if !a.answer(key, author.Login, text) {
+		go a.handle(context.WithoutCancel(r.Context()), repo, ev.Issue, author.Login, text)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"session": key})
+}
+
+// handle runs a mention in the issue's session and posts the result as a
+// comment.
+func (a *Adapter) handle(ctx context.Context, repo string, issue Issue, login, text string) {
+	key := a.SessionKey(repo, issue.Number)
+	if a.cfg.Verbose {
+		log.Printf("[github] %s: @%s: %s", key, login, text)
+	}
+
+	var diff string
+	if issue.PullRequest != nil {
+		var err error
+		if diff, err = a.api.PullDiff(ctx, repo, issue.Number); err != nil {
+			log.Printf("[github] %s: %v", key, err)
+		}
+	}
+
+	ask := func(ctx context.Context, question string) (string, error) {
+		reply := make(chan string, 1)
+		a.mu.Lock()
+		a.questions[key] = pendingQuestion{login: login, reply: reply}
+		a.mu.Unlock()
+		defer func() {
+			a.mu.Lock()
+			delete(a.questions, key)
+			a.mu.Unlock()
+		}()
+		if _, err := a.api.Comment(ctx, repo, issue.Number, fmt.Sprintf("@%s %s\n\n_Mention me to answer._", login, question)); err != nil {
+			return "", fmt.Errorf("github: post question: %w", err)
+		}
+		select {
+		case answer := <-reply:
+			return answer, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	result, err := a.run(audit.WithActor(ctx, "github:"+login), key, prompt(repo, issue, login, text, diff), nil, ask)
+	if err != nil {
+		result = ":warning: The run failed: " + err.Error()
+	}
+	if _, err := a.api.Comment(ctx, repo, issue.Number, result); err != nil {
+		log.Printf("[github] comment on %s#%d: %v", repo, issue.Number, err)
+	}
+}
+
+// prompt puts a comment in the context of its issue or pull request.
+func prompt(repo string, issue Issue, login, text, diff string) string {
+	kind := "issue"
+	if issue.PullRequest != nil {
+		kind = "pull request"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "@%s commented on %s %s#%d %q:\n\n%s\n", login, kind, repo, issue.Number, issue.Title, text)
+	if body := strings.TrimSpace(issue.Body); body != "" {
+		fmt.Fprintf(&b, "\nThe %s's description:\n\n%s\n", kind, body)
+	}
+	if diff != "" {
+		note := ""
+		if len(diff) > maxDiff {
+			diff, note = diff[:maxDiff], fmt.Sprintf("\n(Diff truncated at %d bytes.)", maxDiff)
+		}
+		fmt.Fprintf(&b, "\nThe diff:\n\n```diff\n%s\n```%s\n", strings.TrimRight(diff, "\n"), note)
+	}
+	b.WriteString("\nYour reply will be posted as a comment.")
+	return b.String()
+}
+
+// answer hands text to a question waiting in the session, reporting
+// whether there was one. Only the commenter whose run asked may answer;
+// anyone else's mention starts a run of its own.
+func (a *Adapter) answer(key, login, text string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	q, ok := a.questions[key]
+	if !ok || !strings.EqualFold(q.login, login) {
+		return false
+	}
+	delete(a.questions, key)
+	q.reply <- text
+	return true
+}
+
+// SessionKey maps an issue or pull request to a session key.
+func (a *Adapter) SessionKey(repo string, number int) string {
+	return a.cfg.SessionPrefix + ":" + strings.ReplaceAll(repo, "/", ":") + ":" + strconv.Itoa(number)
+}
+
+// validSignature checks a "sha256=<hex>" HMAC of body. Nothing is valid
+// without a secret.
+func validSignature(secret string, body []byte, sig string) bool {
+	if secret == "" {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha256="))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
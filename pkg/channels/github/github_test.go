@@ -0,0 +1,223 @@
+package github
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+)
+
+type comment struct {
+	repo   string
+	number int
+	body   string
+}
+
+// fakeAPI serves a fixed diff and records comments.
+type fakeAPI struct {
+	comments chan comment
+}
+
+func (f *fakeAPI) PullDiff(_ context.Context, repo string, number int) (string, error) {
+	return "--- a/main.go\n+++ b/main.go\n+fmt.Println(\"hi\")\n", nil
+}
+
+func (f *fakeAPI) Comment(_ context.Context, repo string, number int, body string) (string, error) {
+	f.comments <- comment{repo, number, body}
+	return "", nil
+}
+
+func newTestAdapter(cfg Config, run Runner) (*Adapter, *fakeAPI) {
+	cfg.Bot = "teeny-bot"
+	a := New(cfg, nil, run)
+	api := &fakeAPI{comments: make(chan comment, 4)}
+	a.api = api
+	return a, api
+}
+
+func deliver(t *testing.T, a *Adapter, event, secret, body string) int {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/v1/github", strings.NewReader(body))
+	req.Header.Set("X-GitHub-Event", event)
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func commentPayload(login, body string, pr bool) string {
+	ev := map[string]any{
+		"action":     "created",
+		"repository": map[string]any{"full_name": "acme/app"},
+		"issue":      map[string]any{"number": 12, "title": "Add greeting", "body": "Prints hi on start."},
+		"comment":    map[string]any{"body": body, "user": map[string]any{"login": login, "type": "User"}, "author_association": "MEMBER"},
+	}
+	if pr {
+		ev["issue"].(map[string]any)["pull_request"] = map[string]any{"url": "https://api.github.com/repos/acme/app/pulls/12"}
+	}
+	b, _ := json.Marshal(ev)
+	return string(b)
+}
+
+func receive(t *testing.T, api *fakeAPI) comment {
+	t.Helper()
+	select {
+	case c := <-api.comments:
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("no comment posted")
+		return comment{}
+	}
+}
+
+func TestMentionRunsAndComments(t *testing.T) {
+	var gotKey, gotPrompt, gotActor string
+	a, api := newTestAdapter(Config{Secret: "s3cret"}, func(ctx context.Context, key, prompt string, _ func(loop.Event), _ loop.AskFunc) (string, error) {
+		gotKey, gotPrompt, gotActor = key, prompt, audit.ActorFrom(ctx)
+		return "Looks good to me.", nil
+	})
+
+	if code := deliver(t, a, "issue_comment", "s3cret", commentPayload("ann", "@Teeny-Bot please review", true)); code != http.StatusAccepted {
+		t.Fatalf("status = %d", code)
+	}
+	c := receive(t, api)
+
+	if c.repo != "acme/app" || c.number != 12 || c.body != "Looks good to me." {
+		t.Errorf("comment = %+v", c)
+	}
+	if gotKey != "github:acme:app:12" || gotActor != "github:ann" {
+		t.Errorf("run in %q by %q", gotKey, gotActor)
+	}
+	for _, want := range []string{`@ann commented on pull request acme/app#12 "Add greeting":`, "please review", "Prints hi on start.", "```diff\n--- a/main.go"} {
+		if !strings.Contains(gotPrompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, gotPrompt)
+		}
+	}
+}
+
+func TestIgnoredDeliveries(t *testing.T) {
+	a, _ := newTestAdapter(Config{Secret: "s3cret", Repos: []string{"acme/app"}}, func(context.Context, string, string, func(loop.Event), loop.AskFunc) (string, error) {
+		t.Error("unexpected run")
+		return "", nil
+	})
+	other := strings.Replace(commentPayload("ann", "@teeny-bot hi", false), "acme/app", "acme/other", 1)
+	edited := strings.Replace(commentPayload("ann", "@teeny-bot hi", false), `"created"`, `"edited"`, 1)
+	outsider := strings.Replace(commentPayload("eve", "@teeny-bot hi", false), `"MEMBER"`, `"NONE"`, 1)
+
+	tests := []struct {
+		name, event, secret, body string
+		want                      int
+	}{
+		{"bad signature", "issue_comment", "wrong", commentPayload("ann", "@teeny-bot hi", false), http.StatusUnauthorized},
+		{"ping", "ping", "s3cret", `{"zen":"hi"}`, http.StatusNoContent},
+		{"no mention", "issue_comment", "s3cret", commentPayload("ann", "@teeny-bottle hi", false), http.StatusNoContent},
+		{"own comment", "issue_comment", "s3cret", commentPayload("teeny-bot", "@teeny-bot hi", false), http.StatusNoContent},
+		{"other repo", "issue_comment", "s3cret", other, http.StatusNoContent},
+		{"edited", "issue_comment", "s3cret", edited, http.StatusNoContent},
+		{"outsider", "issue_comment", "s3cret", outsider, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if code := deliver(t, a, tt.event, tt.secret, tt.body); code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, code, tt.want)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestUnsignedRefused(t *testing.T) {
+	a, _ := newTestAdapter(Config{}, func(context.Context, string, string, func(loop.Event), loop.AskFunc) (string, error) {
+		t.Error("unexpected run")
+		return "", nil
+	})
+	if code := deliver(t, a, "issue_comment", "", commentPayload("ann", "@teeny-bot hi", false)); code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", code)
+	}
+}
+
+func TestAskWaitsForMention(t *testing.T) {
+	answers := make(chan string, 1)
+	a, api := newTestAdapter(Config{Secret: "s3cret"}, func(ctx context.Context, _, prompt string, _ func(loop.Event), ask loop.AskFunc) (string, error) {
+		if !strings.Contains(prompt, "deploy it") {
+			return "separate run", nil
+		}
+		answer, err := ask(ctx, "Which branch?")
+		answers <- answer
+		return "done", err
+	})
+	deliver(t, a, "issue_comment", "s3cret", commentPayload("ann", "@teeny-bot deploy it", false))
+	if c := receive(t, api); !strings.Contains(c.body, "@ann Which branch?") {
+		t.Fatalf("question = %q", c.body)
+	}
+
+	// Someone else's mention doesn't answer ann's question.
+	deliver(t, a, "issue_comment", "s3cret", commentPayload("bob", "@teeny-bot prod", false))
+	if c := receive(t, api); c.body != "separate run" {
+		t.Fatalf("bob's mention answered with %q", c.body)
+	}
+
+	deliver(t, a, "issue_comment", "s3cret", commentPayload("ann", "@teeny-bot main", false))
+	select {
+	case answer := <-answers:
+		if answer != "main" {
+			t.Errorf("answer = %q", answer)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("question not answered")
+	}
+	receive(t, api) // The run's result
+}
+
+func TestClient(t *testing.T) {
+	var reviewed map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/acme/app/pulls/12":
+			if r.Header.Get("Accept") != "application/vnd.github.diff" {
+				t.Errorf("Accept = %q", r.Header.Get("Accept"))
+			}
+			io.WriteString(w, "diff --git a/x b/x\n")
+		case "POST /repos/acme/app/pulls/12/reviews":
+			json.NewDecoder(r.Body).Decode(&reviewed)
+			io.WriteString(w, `{"html_url":"https://github.com/acme/app/pull/12#review-1"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	c := NewClient("tok", srv.URL+"/")
+
+	diff, err := c.PullDiff(context.Background(), "acme/app", 12)
+	if err != nil || diff != "diff --git a/x b/x\n" {
+		t.Errorf("PullDiff = %q, %v", diff, err)
+	}
+	url, err := c.Review(context.Background(), "acme/app", 12, EventRequestChanges, "See inline.", []ReviewComment{{Path: "x", Line: 3, Body: "typo"}})
+	if err != nil || !strings.HasSuffix(url, "#review-1") {
+		t.Errorf("Review = %q, %v", url, err)
+	}
+	if reviewed["event"] != "REQUEST_CHANGES" || len(reviewed["comments"].([]any)) != 1 {
+		t.Errorf("review payload = %v", reviewed)
+	}
+
+	_, err = NewClient("bad", srv.URL).PullDiff(context.Background(), "acme/app", 12)
+	if err == nil || !strings.Contains(err.Error(), "Bad credentials") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+// Package slack connects the orchestrator to Slack over Socket Mode.
+//
+// Each Slack thread maps to one session, so follow-up messages in a thread
+// continue the same conversation. The bot replies when mentioned in a
+// channel and to every direct message.
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+)
+
+// Config for the Slack adapter.
+type Config struct {
+	AppToken      string // xapp-... token with connections:write (Socket Mode)
+	BotToken      string // xoxb-... token with chat:write, app_mentions:read, im:history
+	SessionPrefix string // Session keys are "<prefix>:<channel>:<thread ts>" (default "slack")
+	Progress      bool   // Post a status message in the thread while tools run
+	Verbose       bool
+}
+
+// Runner runs a prompt in a session, reporting progress to onEvent. ask
+// puts a question to the user in the session's thread.
+type Runner func(ctx context.Context, sessionKey, prompt string, onEvent func(loop.Event), ask loop.AskFunc) (string, error)
+
+// poster is the subset of the Slack Web API the adapter uses.
+type poster interface {
+	PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error)
+	UpdateMessageContext(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error)
+}
+
+// Adapter receives Slack events and answers them with agent runs.
+type Adapter struct {
+	cfg   Config
+	api   poster
+	run   Runner
+	botID string // Our own user ID, to ignore our messages
+
+	mu        sync.Mutex
+	threads   map[string]*threadLock     // Serializes runs per session, while any are running or waiting
+	questions map[string]pendingQuestion // Pending user.ask answers per session
+}
+
+// threadLock serializes the runs in a thread. It is dropped once no run
+// holds or waits for it.
+type threadLock struct {
+	sync.Mutex
+	users int // Runs holding or waiting for the lock
+}
+
+// pendingQuestion is a user.ask waiting for the user whose message
+// started the run.
+type pendingQuestion struct {
+	user  string
+	reply chan string
+}
+
+// New creates an adapter. Call Run to connect.
+func New(cfg Config, run Runner) *Adapter {
+	if cfg.SessionPrefix == "" {
+		cfg.SessionPrefix = "slack"
+	}
+	return &Adapter{
+		cfg:       cfg,
+		run:       run,
+		threads:   make(map[string]*threadLock),
+		questions: make(map[string]pendingQuestion),
+	}
+}
+
+// Run connects via Socket Mode and handles events until ctx is cancelled.
+func (a *Adapter) Run(ctx context.Context) error {
+	if a.cfg.AppToken == "" || a.cfg.BotToken == "" {
+		return fmt.Errorf("slack: app and bot tokens are required")
+	}
+	api := slack.New(a.cfg.BotToken, slack.OptionAppLevelToken(a.cfg.AppToken))
+	auth, err := api.AuthTestContext(ctx)
+	if err != nil {
+		return fmt.Errorf("slack: auth test: %w", err)
+	}
+	a.api = api
+	a.botID = auth.UserID
+
+	client := socketmode.New(api)
+	go a.consume(ctx, client)
+	if err := client.RunContext(ctx); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	return nil
+}
+
+func (a *Adapter) consume(ctx context.Context, client *socketmode.Client) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-client.Events:
+			if !ok {
+				return
+			}
+			if evt.Type != socketmode.EventTypeEventsAPI {
+				continue
+			}
+			if evt.Request != nil {
+				client.Ack(*evt.Request)
+			}
+			if api, ok := evt.Data.(slackevents.EventsAPIEvent); ok {
+				a.dispatch(ctx, api.InnerEvent.Data)
+			}
+		}
+	}
+}
+
+// dispatch starts a run for messages addressed to the bot.
+func (a *Adapter) dispatch(ctx context.Context, data any) {
+	var user, channel, text, ts, threadTS string
+	switch ev := data.(type) {
+	case *slackevents.AppMentionEvent:
+		if ev.BotID != "" || ev.User == a.botID {
+			return
+		}
+		user, channel, text, ts, threadTS = ev.User, ev.Channel, ev.Text, ev.TimeStamp, ev.ThreadTimeStamp
+	case *slackevents.MessageEvent:
+		// Channel messages arrive as app_mention; only DMs are handled here.
+		if !ev.IsIM() || ev.SubType != "" || ev.BotID != "" || ev.User == a.botID {
+			return
+		}
+		user, channel, text, ts, threadTS = ev.User, ev.Channel, ev.Text, ev.TimeStamp, ev.ThreadTimeStamp
+	default:
+		return
+	}
+
+	prompt := stripMentions(text)
+	if prompt == "" {
+		return
+	}
+	if threadTS == "" {
+		threadTS = ts
+	}
+	if a.answer(a.SessionKey(channel, threadTS), user, prompt) {
+		return
+	}
+	go a.handle(ctx, user, channel, threadTS, prompt)
+}
+
+// handle runs prompt from user in the thread's session and posts the
+// result. A run in progress when Run returns still finishes and posts its
+// answer; the Runner decides when to give up on it.
+func (a *Adapter) handle(ctx context.Context, user, channel, threadTS, prompt string) {
+	ctx = context.WithoutCancel(ctx)
+	key := a.SessionKey(channel, threadTS)
+	defer a.lockThread(key)()
+
+	if a.cfg.Verbose {
+		log.Printf("[slack] %s: %s", key, prompt)
+	}
+
+	var status progress
+	onEvent := func(e loop.Event) {
+		if a.cfg.Progress && e.Type == loop.EventToolStart {
+			status.tools++
+			status.update(ctx, a.api, channel, threadTS, fmt.Sprintf(":hammer_and_wrench: Running `%s`…", e.ToolCall.Name))
+		}
+	}
+
+	runCtx := audit.WithActor(context.WithValue(ctx, channelKey{}, channel), "slack:"+user)
+	result, err := a.run(runCtx, key, prompt, onEvent, a.asker(channel, threadTS, key, user))
+	if err != nil {
+		result = fmt.Sprintf(":warning: %s", err)
+	}
+	if status.ts != "" {
+		status.update(ctx, a.api, channel, threadTS, fmt.Sprintf(":white_check_mark: Done (%d tool calls)", status.tools))
+	}
+	if _, _, err := a.api.PostMessageContext(ctx, channel, slack.MsgOptionText(result, false), slack.MsgOptionTS(threadTS)); err != nil {
+		log.Printf("[slack] post to %s: %v", channel, err)
+	}
+}
+
+// asker posts a question in the thread and waits for user's next message
+// there, which dispatch routes to it instead of starting a new run.
+// Messages from anyone else in the thread start runs as usual, which wait
+// for this one.
+func (a *Adapter) asker(channel, threadTS, key, user string) loop.AskFunc {
+	return func(ctx context.Context, question string) (string, error) {
+		reply := make(chan string, 1)
+		a.mu.Lock()
+		a.questions[key] = pendingQuestion{user: user, reply: reply}
+		a.mu.Unlock()
+		defer func() {
+			a.mu.Lock()
+			delete(a.questions, key)
+			a.mu.Unlock()
+		}()
+
+		text := ":question: " + question
+		if !strings.HasPrefix(channel, "D") {
+			text += "\n_Mention me in this thread to answer._" // Only mentions reach us outside DMs
+		}
+		if _, _, err := a.api.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(threadTS)); err != nil {
+			return "", fmt.Errorf("slack: post question: %w", err)
+		}
+		select {
+		case answer := <-reply:
+			return answer, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// answer hands text from user to a question waiting in the session,
+// reporting whether there was one for them.
+func (a *Adapter) answer(key, user, text string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	q, ok := a.questions[key]
+	if !ok || q.user != user {
+		return false
+	}
+	delete(a.questions, key)
+	q.reply <- text
+	return true
+}
+
+type channelKey struct{}
+
+// ChannelFrom returns the Slack channel ID a Runner call was started
+// from. It reports false outside a Slack run.
+func ChannelFrom(ctx context.Context) (string, bool) {
+	channel, ok := ctx.Value(channelKey{}).(string)
+	return channel, ok
+}
+
+// SessionKey maps a Slack thread to a session key.
+func (a *Adapter) SessionKey(channel, threadTS string) string {
+	return a.cfg.SessionPrefix + ":" + channel + ":" + threadTS
+}
+
+// lockThread waits for the runs ahead of it in the session to finish and
+// returns the function that lets the next one go.
+func (a *Adapter) lockThread(key string) (unlock func()) {
+	a.mu.Lock()
+	l, ok := a.threads[key]
+	if !ok {
+		l = &threadLock{}
+		a.threads[key] = l
+	}
+	l.users++
+	a.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if l.users--; l.users == 0 {
+			delete(a.threads, key)
+		}
+	}
+}
+
+// progress is a single thread message that is edited as tools run.
+type progress struct {
+	ts    string
+	tools int
+}
+
+func (p *progress) update(ctx context.Context, api poster, channel, threadTS, text string) {
+	if p.ts == "" {
+		_, ts, err := api.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(threadTS))
+		if err != nil {
+			log.Printf("[slack] post progress: %v", err)
+			return
+		}
+		p.ts = ts
+		return
+	}
+	if _, _, _, err := api.UpdateMessageContext(ctx, channel, p.ts, slack.MsgOptionText(text, false)); err != nil {
+		log.Printf("[slack] update progress: %v", err)
+	}
+}
+
+var mentionRe = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+// stripMentions removes <@U123> user mentions from text.
+func stripMentions(text string) string {
+	return strings.TrimSpace(mentionRe.ReplaceAllString(text, ""))
+}
@@ -0,0 +1,251 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+type post struct {
+	channel, ts string
+	update      bool
+}
+
+// fakeAPI records posts and updates.
+type fakeAPI struct {
+	mu    sync.Mutex
+	posts []post
+}
+
+func (f *fakeAPI) PostMessageContext(_ context.Context, channel string, _ ...slack.MsgOption) (string, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.posts = append(f.posts, post{channel: channel})
+	return channel, "status-ts", nil
+}
+
+func (f *fakeAPI) UpdateMessageContext(_ context.Context, channel, ts string, _ ...slack.MsgOption) (string, string, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.posts = append(f.posts, post{channel: channel, ts: ts, update: true})
+	return channel, ts, "", nil
+}
+
+func TestHandle(t *testing.T) {
+	api := &fakeAPI{}
+	var gotKey, gotPrompt, gotChannel, gotActor string
+	a := New(Config{Progress: true}, func(ctx context.Context, key, prompt string, onEvent func(loop.Event), _ loop.AskFunc) (string, error) {
+		gotKey, gotPrompt = key, prompt
+		gotChannel, _ = ChannelFrom(ctx)
+		gotActor = audit.ActorFrom(ctx)
+		onEvent(loop.Event{Type: loop.EventToolStart, ToolCall: provider.ToolCall{Name: "git.status"}})
+		onEvent(loop.Event{Type: loop.EventToolEnd})
+		onEvent(loop.Event{Type: loop.EventToolStart, ToolCall: provider.ToolCall{Name: "git.diff"}})
+		return "all clean", nil
+	})
+	a.api = api
+
+	a.handle(context.Background(), "U1", "C1", "111.222", "check the repo")
+
+	if gotKey != "slack:C1:111.222" || gotPrompt != "check the repo" || gotChannel != "C1" || gotActor != "slack:U1" {
+		t.Errorf("run(%q, %q) in %q by %q", gotKey, gotPrompt, gotChannel, gotActor)
+	}
+	// Progress post, update for the second tool, final "done" update, result post.
+	want := []post{{channel: "C1"}, {channel: "C1", ts: "status-ts", update: true}, {channel: "C1", ts: "status-ts", update: true}, {channel: "C1"}}
+	if len(api.posts) != len(want) {
+		t.Fatalf("posts = %+v", api.posts)
+	}
+	for i := range want {
+		if api.posts[i] != want[i] {
+			t.Errorf("post %d = %+v, want %+v", i, api.posts[i], want[i])
+		}
+	}
+}
+
+func TestHandleError(t *testing.T) {
+	api := &fakeAPI{}
+	a := New(Config{}, func(context.Context, string, string, func(loop.Event), loop.AskFunc) (string, error) {
+		return "", errors.New("provider down")
+	})
+	a.api = api
+
+	a.handle(context.Background(), "U1", "D1", "1.0", "hi")
+	if len(api.posts) != 1 {
+		t.Fatalf("expected only the error reply, got %+v", api.posts)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	prompts := make(chan string, 4)
+	a := New(Config{SessionPrefix: "team"}, func(_ context.Context, key, prompt string, _ func(loop.Event), _ loop.AskFunc) (string, error) {
+		prompts <- key + " " + prompt
+		return "ok", nil
+	})
+	a.api = &fakeAPI{}
+	a.botID = "UBOT"
+	ctx := context.Background()
+
+	a.dispatch(ctx, &slackevents.AppMentionEvent{User: "U1", Channel: "C1", Text: "<@UBOT> deploy status?", TimeStamp: "5.0"})
+	a.dispatch(ctx, &slackevents.MessageEvent{User: "U1", Channel: "D1", ChannelType: "im", Text: "follow up", TimeStamp: "7.0", ThreadTimeStamp: "6.0"})
+	// Ignored: own messages, bot messages, non-DM channel messages, empty prompts.
+	a.dispatch(ctx, &slackevents.AppMentionEvent{User: "UBOT", Channel: "C1", Text: "hi"})
+	a.dispatch(ctx, &slackevents.MessageEvent{User: "U2", BotID: "B1", Channel: "D1", ChannelType: "im", Text: "hi"})
+	a.dispatch(ctx, &slackevents.MessageEvent{User: "U1", Channel: "C1", ChannelType: "channel", Text: "chatter"})
+	a.dispatch(ctx, &slackevents.AppMentionEvent{User: "U1", Channel: "C1", Text: "<@UBOT>"})
+
+	got := map[string]bool{}
+	for range 2 {
+		select {
+		case p := <-prompts:
+			got[p] = true
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for runs")
+		}
+	}
+	if !got["team:C1:5.0 deploy status?"] || !got["team:D1:6.0 follow up"] {
+		t.Errorf("runs = %v", got)
+	}
+	select {
+	case p := <-prompts:
+		t.Errorf("unexpected run: %s", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStripMentions(t *testing.T) {
+	if got := stripMentions("<@U123ABC>  summarize <@U999> notes "); got != "summarize  notes" {
+		t.Errorf("stripMentions = %q", got)
+	}
+}
+
+func TestAskRoutesThreadReply(t *testing.T) {
+	prompts := make(chan string, 1)
+	a := New(Config{}, func(_ context.Context, _, prompt string, _ func(loop.Event), _ loop.AskFunc) (string, error) {
+		prompts <- prompt
+		return "ok", nil
+	})
+	api := &fakeAPI{}
+	a.api = api
+	a.botID = "UBOT"
+	ctx := context.Background()
+
+	answers := make(chan string, 1)
+	go func() {
+		answer, _ := a.asker("D1", "6.0", a.SessionKey("D1", "6.0"), "U1")(ctx, "Which branch?")
+		answers <- answer
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		a.mu.Lock()
+		_, waiting := a.questions[a.SessionKey("D1", "6.0")]
+		a.mu.Unlock()
+		if waiting || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	a.dispatch(ctx, &slackevents.MessageEvent{User: "U1", Channel: "D1", ChannelType: "im", Text: "main", TimeStamp: "7.0", ThreadTimeStamp: "6.0"})
+	select {
+	case answer := <-answers:
+		if answer != "main" {
+			t.Errorf("answer = %q", answer)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("question was not answered")
+	}
+	select {
+	case p := <-prompts:
+		t.Errorf("answer started a run with %q", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(api.posts) != 1 {
+		t.Errorf("posts = %+v, want the question", api.posts)
+	}
+
+	// With nothing pending, the next message starts a run again.
+	a.dispatch(ctx, &slackevents.MessageEvent{User: "U1", Channel: "D1", ChannelType: "im", Text: "thanks", TimeStamp: "8.0", ThreadTimeStamp: "6.0"})
+	select {
+	case p := <-prompts:
+		if p != "thanks" {
+			t.Errorf("prompt = %q", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("follow-up did not start a run")
+	}
+
+	// Finished threads don't keep their locks.
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		a.mu.Lock()
+		n := len(a.threads)
+		a.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("threads = %d after runs finished, want 0", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAskIgnoresOtherUsers(t *testing.T) {
+	prompts := make(chan string, 1)
+	a := New(Config{}, func(_ context.Context, _, prompt string, _ func(loop.Event), _ loop.AskFunc) (string, error) {
+		prompts <- prompt
+		return "ok", nil
+	})
+	a.api = &fakeAPI{}
+	a.botID = "UBOT"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key := a.SessionKey("C1", "6.0")
+	answers := make(chan string, 1)
+	go func() {
+		answer, _ := a.asker("C1", "6.0", key, "U1")(ctx, "Which branch?")
+		answers <- answer
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		a.mu.Lock()
+		_, waiting := a.questions[key]
+		a.mu.Unlock()
+		if waiting || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Someone else in the thread starts a run instead of answering.
+	a.dispatch(ctx, &slackevents.AppMentionEvent{User: "U2", Channel: "C1", Text: "<@UBOT> release", TimeStamp: "7.0", ThreadTimeStamp: "6.0"})
+	select {
+	case p := <-prompts:
+		if p != "release" {
+			t.Errorf("prompt = %q", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("another user's reply did not start a run")
+	}
+	select {
+	case answer := <-answers:
+		t.Fatalf("another user answered with %q", answer)
+	default:
+	}
+	a.mu.Lock()
+	_, waiting := a.questions[key]
+	a.mu.Unlock()
+	if !waiting {
+		t.Error("question no longer pending")
+	}
+}
@@ -0,0 +1,1299 @@
+// Package config loads the orchestrator's single configuration file.
+// JSON, YAML, and TOML are supported (chosen by file extension), and
+// TEENY_* environment variables override file values.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/cost"
+	"github.com/rcliao/teeny-orchestrator/pkg/guard"
+	"github.com/rcliao/teeny-orchestrator/pkg/notify"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/redact"
+	"github.com/rcliao/teeny-orchestrator/pkg/scheduler"
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// DefaultPath is where the CLI looks for configuration.
+const DefaultPath = "~/.teeny-claw/config.json"
+
+// Config is the full orchestrator configuration.
+type Config struct {
+	Workspace   string            `json:"workspace"`
+	Provider    ProviderConfig    `json:"provider"`
+	Tools       ToolsConfig       `json:"tools"`
+	Session     SessionConfig     `json:"session"`
+	Loop        LoopConfig        `json:"loop"`
+	Eval        EvalConfig        `json:"eval"`
+	Jobs        []scheduler.Job   `json:"jobs,omitempty"`
+	Daemon      string            `json:"daemon,omitempty"`  // Optional extra jobs file (daemon.json)
+	History     string            `json:"history,omitempty"` // Job run history (JSON Lines)
+	Audit       string            `json:"audit,omitempty"`   // Hash-chained log of who started each run, its tool calls, and its cost (empty = off)
+	Postgres    PostgresConfig    `json:"postgres"`          // Shared database for sessions, transcripts, and job history
+	Archive     ArchiveConfig     `json:"archive"`           // Ship finished transcripts and archived sessions to object storage
+	Server      ServerConfig      `json:"server"`
+	Queue       QueueConfig       `json:"queue"`
+	Channels    ChannelsConfig    `json:"channels"`
+	Hooks       []HookConfig      `json:"hooks,omitempty"`    // Served at POST /v1/hooks/{name}
+	Triggers    []TriggerConfig   `json:"triggers,omitempty"` // File changes that start daemon runs
+	Notify      NotifyConfig      `json:"notify"`
+	Cost        CostConfig        `json:"cost"`
+	Embedding   EmbeddingConfig   `json:"embedding"`
+	RAG         RAGConfig         `json:"rag"`
+	Context     ContextConfig     `json:"context"`
+	Permissions PermissionsConfig `json:"permissions"`
+	Attach      AttachConfig      `json:"attach"`
+	Redact      RedactConfig      `json:"redact"`
+	Guard       GuardConfig       `json:"guard"`
+
+	Agents map[string]AgentConfig `json:"agents,omitempty"` // Named agents the daemon serves besides the default one
+}
+
+// ProviderConfig selects the LLM backend.
+type ProviderConfig struct {
+	Name       string                        `json:"name"`
+	Model      string                        `json:"model"`
+	APIKeyEnv  string                        `json:"api_key_env"`
+	BaseURL    string                        `json:"base_url"`
+	APIVersion string                        `json:"api_version,omitempty"` // Azure OpenAI only
+	Routes     []RouteConfig                 `json:"routes,omitempty"`      // Model routing rules, first match wins
+	Thinking   int                           `json:"thinking,omitempty"`    // Anthropic extended thinking budget in tokens (0 = off)
+	HTTP       HTTPConfig                    `json:"http"`                  // Proxy, timeout, and CA for API requests
+	Headers    map[string]string             `json:"headers,omitempty"`     // Extra headers sent with every API request
+	Limits     provider.Limits               `json:"limits"`                // Requests/min, tokens/min, and max in flight, shared by all runs
+	Retry      RetryConfig                   `json:"retry"`                 // Resend rate-limited and failed requests
+	Cache      CacheConfig                   `json:"cache"`                 // Answer identical requests from memory
+	Log        bool                          `json:"log,omitempty"`         // Log every API call's model, tokens, and latency
+	Models     map[string]provider.ModelInfo `json:"models,omitempty"`      // Context window, limits, and prices by model name or prefix, added to the built-in catalog
+}
+
+// RetryConfig resends API requests that fail with rate limits, server
+// errors, or network errors.
+type RetryConfig struct {
+	Attempts int    `json:"attempts,omitempty"` // Extra attempts after a failure (0 = no retries)
+	Backoff  string `json:"backoff,omitempty"`  // First delay, doubled each attempt (default "1s")
+}
+
+// Parse converts the config for provider.Retry.
+func (r RetryConfig) Parse() (provider.RetryConfig, error) {
+	out := provider.RetryConfig{Attempts: r.Attempts}
+	if r.Backoff != "" {
+		d, err := time.ParseDuration(r.Backoff)
+		if err != nil {
+			return out, fmt.Errorf("config: provider.retry.backoff: %w", err)
+		}
+		out.Backoff = d
+	}
+	return out, nil
+}
+
+// CacheConfig keeps responses in memory for identical requests, such as
+// repeated heartbeat prompts.
+type CacheConfig struct {
+	Size int    `json:"size,omitempty"` // Responses kept (0 = no cache)
+	TTL  string `json:"ttl,omitempty"`  // How long a response is reused, e.g. "10m" (default: until evicted)
+}
+
+// Parse converts the config for provider.Cache.
+func (c CacheConfig) Parse() (provider.CacheConfig, error) {
+	out := provider.CacheConfig{Size: c.Size}
+	if c.TTL != "" {
+		d, err := time.ParseDuration(c.TTL)
+		if err != nil {
+			return out, fmt.Errorf("config: provider.cache.ttl: %w", err)
+		}
+		out.TTL = d
+	}
+	return out, nil
+}
+
+// useProviderDefaults replaces the default Anthropic model and key
+// variable with the chosen provider's when another one is chosen: a
+// preset's own defaults, or none for openai and azure.
+func (p *ProviderConfig) useProviderDefaults() {
+	def := Default().Provider
+	if p.Name == def.Name || p.Name == "claude" {
+		return
+	}
+	preset := provider.Presets[p.Name]
+	if p.Model == def.Model {
+		p.Model = preset.Model
+	}
+	if p.APIKeyEnv == def.APIKeyEnv {
+		p.APIKeyEnv = preset.APIKeyEnv
+	}
+}
+
+// HTTPConfig configures the HTTP client used for provider API requests.
+type HTTPConfig struct {
+	Proxy   string `json:"proxy,omitempty"`   // Proxy URL (default: HTTPS_PROXY from the environment)
+	Timeout string `json:"timeout,omitempty"` // Whole-request timeout, e.g. "5m" (default: none)
+	CAFile  string `json:"ca_file,omitempty"` // Extra PEM certificates to trust
+}
+
+// IsZero reports whether no HTTP settings are configured.
+func (h HTTPConfig) IsZero() bool {
+	return h == HTTPConfig{}
+}
+
+// TimeoutDuration parses Timeout, returning 0 when it is unset.
+func (h HTTPConfig) TimeoutDuration() (time.Duration, error) {
+	if h.Timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(h.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("config: provider.http.timeout: %w", err)
+	}
+	return d, nil
+}
+
+// RouteConfig picks a model for requests matching all set conditions.
+type RouteConfig struct {
+	Name           string   `json:"name,omitempty"`
+	Model          string   `json:"model"`
+	Intents        []string `json:"intents,omitempty"`
+	MinPromptChars int      `json:"min_prompt_chars,omitempty"`
+	MaxPromptChars int      `json:"max_prompt_chars,omitempty"`
+	CostTier       string   `json:"cost_tier,omitempty"`
+}
+
+// ToolsConfig controls tool discovery and execution.
+type ToolsConfig struct {
+	Path       []string                  `json:"path"`
+	Timeout    int                       `json:"timeout"` // Seconds
+	Shell      ShellConfig               `json:"shell"`
+	Schedule   ScheduleToolConfig        `json:"schedule"`
+	GitHub     GitHubToolConfig          `json:"github"`
+	FS         FSToolConfig              `json:"fs"`
+	Code       CodeToolConfig            `json:"code"`
+	Limits     toolreg.Limits            `json:"limits"`                // Shared by all tool calls
+	ToolLimits map[string]toolreg.Limits `json:"tool_limits,omitempty"` // Per tool name, overrides manifests
+	PassEnv    []string                  `json:"pass_env,omitempty"`    // Parent env vars every tool receives besides PATH, HOME, LANG, TMPDIR
+	Secrets    SecretsConfig             `json:"secrets"`
+	Jail       bool                      `json:"jail,omitempty"`    // Refuse tool workdirs outside the workspace
+	Paths      toolreg.PathPolicy        `json:"paths"`             // Files the built-in tools may read and write, passed to manifest tools via env
+	DryRun     string                    `json:"dry_run,omitempty"` // "all" or "writes": describe tool calls instead of running them
+}
+
+// SecretsConfig controls how ${SECRET:name} references in tool manifest env
+// values are resolved.
+type SecretsConfig struct {
+	Sources   []string `json:"sources,omitempty"`    // Tried in order: "env", "file", "keyring"
+	EnvPrefix string   `json:"env_prefix,omitempty"` // Prepended to the upper-cased name by "env"
+	Dir       string   `json:"dir,omitempty"`        // One file per secret, read by "file"
+	Service   string   `json:"service,omitempty"`    // Keyring service name used by "keyring"
+}
+
+// PermissionsConfig assigns tool permission profiles to sessions. A job's
+// profile field overrides the profile of its session.
+type PermissionsConfig struct {
+	Profiles map[string]toolreg.Profile `json:"profiles,omitempty"`
+	Sessions map[string]string          `json:"sessions,omitempty"` // Session key or glob → profile name
+	Default  string                     `json:"default,omitempty"`  // Profile for unmatched sessions ("" = unrestricted)
+}
+
+// Profile returns the named profile or, if name is empty, the profile for
+// session: an exact key in Sessions, then the first matching glob in sorted
+// order, then Default. It returns nil when no profile applies.
+func (p PermissionsConfig) Profile(session, name string) (*toolreg.Profile, error) {
+	if name == "" {
+		name = p.sessionProfile(session)
+	}
+	if name == "" {
+		return nil, nil
+	}
+	prof, ok := p.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("permissions: unknown profile %q", name)
+	}
+	prof.Name = name
+	return &prof, nil
+}
+
+func (p PermissionsConfig) sessionProfile(session string) string {
+	if name, ok := p.Sessions[session]; ok {
+		return name
+	}
+	patterns := make([]string, 0, len(p.Sessions))
+	for pattern := range p.Sessions {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, session); ok {
+			return p.Sessions[pattern]
+		}
+	}
+	return p.Default
+}
+
+// validate checks that every profile referenced by a session mapping or the
+// default exists.
+func (p PermissionsConfig) validate() error {
+	for name, prof := range p.Profiles {
+		if err := prof.Validate(); err != nil {
+			return fmt.Errorf("config: permissions.profiles.%s.%w", name, err)
+		}
+	}
+	names := []string{p.Default}
+	for _, name := range p.Sessions {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if _, err := p.Profile("", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScheduleToolConfig enables the built-in schedule tool, which saves jobs
+// to the Daemon file.
+type ScheduleToolConfig struct {
+	Enabled     bool   `json:"enabled"`
+	MaxJobs     int    `json:"max_jobs,omitempty"`     // Active agent jobs allowed (default 10)
+	MinInterval string `json:"min_interval,omitempty"` // Shortest recurring gap (default "15m")
+}
+
+// GitHubToolConfig enables the built-in github tools (pr_diff, review,
+// comment).
+type GitHubToolConfig struct {
+	Enabled  bool   `json:"enabled"`
+	TokenEnv string `json:"token_env,omitempty"` // Env var with the API token (default: channels.github.token_env)
+	APIURL   string `json:"api_url,omitempty"`   // Default: channels.github.api_url, else https://api.github.com
+}
+
+// FSToolConfig enables the built-in fs.apply_patch tool, which edits files
+// in the workspace.
+type FSToolConfig struct {
+	Enabled   bool   `json:"enabled"`
+	BackupDir string `json:"backup_dir,omitempty"` // Originals are copied here before each patch (default ~/.teeny-claw/backups)
+}
+
+// CodeToolConfig enables the built-in code.run tool, which runs Python,
+// Go, and Node.js snippets in throwaway containers.
+type CodeToolConfig struct {
+	Enabled        bool              `json:"enabled"`
+	Runtime        string            `json:"runtime,omitempty"`         // "docker" (default) or "podman"
+	Images         map[string]string `json:"images,omitempty"`          // Per language ("python", "go", "node"); overrides the default images
+	CPUs           string            `json:"cpus,omitempty"`            // Default "1"
+	Memory         string            `json:"memory,omitempty"`          // Default "512m"
+	Timeout        string            `json:"timeout,omitempty"`         // Longest a snippet may run (default "60s")
+	Network        bool              `json:"network,omitempty"`         // Allow network access (default: none)
+	MountWorkspace bool              `json:"mount_workspace,omitempty"` // Mount the workspace read-only at /workspace
+	ArtifactDir    string            `json:"artifact_dir,omitempty"`    // Where files a snippet writes are kept (default ~/.teeny-claw/artifacts)
+}
+
+// TimeoutDuration parses Timeout, returning 0 (the tool default) when it
+// is unset.
+func (c CodeToolConfig) TimeoutDuration() (time.Duration, error) {
+	if c.Timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("config: tools.code.timeout: %w", err)
+	}
+	return d, nil
+}
+
+// ShellConfig enables the built-in shell.run tool.
+type ShellConfig struct {
+	Enabled         bool     `json:"enabled"`
+	AllowedCommands []string `json:"allowed_commands,omitempty"`
+	EnvWhitelist    []string `json:"env_whitelist,omitempty"`
+	MaxOutputBytes  int      `json:"max_output_bytes,omitempty"`
+	Offline         bool     `json:"offline,omitempty"` // Vouch that allowed_commands can't reach the network, so network: deny profiles keep shell.run
+}
+
+// SessionConfig controls session persistence.
+type SessionConfig struct {
+	Dir     string      `json:"dir"`
+	Store   string      `json:"store,omitempty"`   // SessionStoreFile or SessionStoreRedis (default file, in Dir)
+	Redis   RedisConfig `json:"redis"`             // For the redis store
+	Encrypt bool        `json:"encrypt,omitempty"` // AES-GCM encrypt stored sessions
+	KeyEnv  string      `json:"key_env,omitempty"` // Env var holding the base64 key (falls back to the OS keyring)
+
+	Retention  []RetentionConfig `json:"retention,omitempty"` // Archive and delete idle sessions, applied by the daemon
+	Compaction CompactionConfig  `json:"compaction"`          // Fold old history into the session summary
+}
+
+// Session stores for SessionConfig.Store.
+const (
+	SessionStoreFile     = "file"     // Files in session.dir, shared by processes on one host
+	SessionStoreRedis    = "redis"    // Redis, shared by daemon replicas on many hosts
+	SessionStorePostgres = "postgres" // The postgres database, shared and queryable
+)
+
+// RedisConfig locates the Redis server sessions are kept on.
+type RedisConfig struct {
+	URL         string `json:"url,omitempty"`          // e.g. redis://host:6379/0
+	PasswordEnv string `json:"password_env,omitempty"` // Env var holding the password, instead of putting it in the URL
+	Prefix      string `json:"prefix,omitempty"`       // Key prefix, to share a server (default "teeny:")
+	TTL         string `json:"ttl,omitempty"`          // Sessions expire this long after their last change, e.g. "720h" (default: never)
+}
+
+// TTLDuration parses TTL, returning 0 when it is unset.
+func (r RedisConfig) TTLDuration() (time.Duration, error) {
+	if r.TTL == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(r.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("config: session.redis.ttl: %w", err)
+	}
+	return d, nil
+}
+
+func (s SessionConfig) validate() error {
+	switch s.Store {
+	case "", SessionStoreFile:
+	case SessionStoreRedis:
+		if s.Redis.URL == "" {
+			return fmt.Errorf("config: session.redis.url is required for the redis store")
+		}
+	case SessionStorePostgres:
+	default:
+		return fmt.Errorf("config: session.store: %q must be file, redis, or postgres", s.Store)
+	}
+	if _, err := s.Redis.TTLDuration(); err != nil {
+		return err
+	}
+	return s.Compaction.validate()
+}
+
+// PostgresConfig locates a Postgres database that sessions (with
+// session.store "postgres"), transcripts, and job history can be kept in.
+// Its schema is created and migrated on first use.
+type PostgresConfig struct {
+	URL         string `json:"url,omitempty"`         // e.g. postgres://teeny@db.internal:5432/teeny
+	URLEnv      string `json:"url_env,omitempty"`     // Env var holding the URL instead, when it has a password
+	Transcripts bool   `json:"transcripts,omitempty"` // Record run transcripts here instead of in loop.transcripts
+	History     bool   `json:"history,omitempty"`     // Record job runs here instead of in history
+}
+
+// DSN returns the database URL, from URLEnv if it is set.
+func (p PostgresConfig) DSN() string {
+	if p.URLEnv != "" {
+		return os.Getenv(p.URLEnv)
+	}
+	return p.URL
+}
+
+func (c *Config) validatePostgres() error {
+	if c.Session.Store != SessionStorePostgres && !c.Postgres.Transcripts && !c.Postgres.History {
+		return nil
+	}
+	if c.Postgres.URL == "" && c.Postgres.URLEnv == "" {
+		return fmt.Errorf("config: postgres.url or postgres.url_env is required to keep data in postgres")
+	}
+	return nil
+}
+
+// ArchiveConfig ships data off local disk to an S3-compatible bucket: the
+// daemon uploads finished transcripts from loop.transcripts, and session
+// retention archives sessions to the bucket rather than session.dir.
+type ArchiveConfig struct {
+	S3          S3Config      `json:"s3"`
+	Prefix      string        `json:"prefix,omitempty"` // Prepended to every object key (default "teeny/")
+	Transcripts ArchiveTarget `json:"transcripts"`
+	Sessions    ArchiveTarget `json:"sessions"`
+}
+
+// S3Config locates the bucket. Credentials are read from env vars.
+type S3Config struct {
+	Bucket          string `json:"bucket,omitempty"`
+	Region          string `json:"region,omitempty"`            // Default us-east-1
+	Endpoint        string `json:"endpoint,omitempty"`          // For other services, e.g. http://minio:9000 (default AWS)
+	PathStyle       bool   `json:"path_style,omitempty"`        // Address the bucket in the path, as MinIO needs
+	AccessKeyEnv    string `json:"access_key_env,omitempty"`    // Default AWS_ACCESS_KEY_ID
+	SecretKeyEnv    string `json:"secret_key_env,omitempty"`    // Default AWS_SECRET_ACCESS_KEY
+	SessionTokenEnv string `json:"session_token_env,omitempty"` // Default AWS_SESSION_TOKEN
+}
+
+// ArchiveTarget configures what is archived of one kind of data, and the
+// bucket lifecycle rule for it. Lifecycle days count from upload.
+type ArchiveTarget struct {
+	Enabled        bool   `json:"enabled,omitempty"`
+	After          string `json:"after,omitempty"`           // Transcripts: idle time before a finished one is shipped (default "1h")
+	TransitionDays int    `json:"transition_days,omitempty"` // Days before objects move to StorageClass (0 = never)
+	StorageClass   string `json:"storage_class,omitempty"`   // Default GLACIER
+	ExpireDays     int    `json:"expire_days,omitempty"`     // Days before objects are deleted (0 = never)
+}
+
+// AfterDuration parses After, returning 0 when it is unset.
+func (t ArchiveTarget) AfterDuration() (time.Duration, error) {
+	if t.After == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(t.After)
+	if err != nil {
+		return 0, fmt.Errorf("config: archive.transcripts.after: %w", err)
+	}
+	return d, nil
+}
+
+// Enabled reports whether anything is archived.
+func (a ArchiveConfig) Enabled() bool {
+	return a.Transcripts.Enabled || a.Sessions.Enabled
+}
+
+func (c *Config) validateArchive() error {
+	a := c.Archive
+	if !a.Enabled() {
+		return nil
+	}
+	if a.S3.Bucket == "" {
+		return fmt.Errorf("config: archive.s3.bucket is required to archive")
+	}
+	if a.Transcripts.Enabled && c.Loop.Transcripts == "" {
+		return fmt.Errorf("config: archive.transcripts needs loop.transcripts, the directory to ship from")
+	}
+	if _, err := a.Transcripts.AfterDuration(); err != nil {
+		return err
+	}
+	for _, t := range []struct {
+		name string
+		ArchiveTarget
+	}{{"transcripts", a.Transcripts}, {"sessions", a.Sessions}} {
+		name := t.name
+		if t.TransitionDays < 0 || t.ExpireDays < 0 {
+			return fmt.Errorf("config: archive.%s: lifecycle days can't be negative", name)
+		}
+		if t.ExpireDays > 0 && t.ExpireDays <= t.TransitionDays {
+			return fmt.Errorf("config: archive.%s: expire_days must be after transition_days", name)
+		}
+	}
+	return nil
+}
+
+// Compaction strategies for CompactionConfig.Strategy.
+const (
+	CompactLLM        = "llm"        // The model rewrites the summary with the old messages folded in
+	CompactRolling    = "rolling"    // The model summarizes only the old messages, appended to the summary
+	CompactExtractive = "extractive" // A line from each old message, without a model
+)
+
+// CompactionConfig folds a session's older messages into its summary once
+// it grows past AfterMessages, after a run ends.
+type CompactionConfig struct {
+	Strategy      string `json:"strategy,omitempty"`       // CompactLLM, CompactRolling, or CompactExtractive ("" = never compact)
+	Weighted      bool   `json:"weighted,omitempty"`       // Keep decisions and tool outcomes over small talk when space runs out
+	AfterMessages int    `json:"after_messages,omitempty"` // Messages in a session before it is compacted (default 200)
+	KeepLast      int    `json:"keep_last,omitempty"`      // Recent messages kept verbatim (default 40)
+	MaxChars      int    `json:"max_chars,omitempty"`      // Summary length (default 4000)
+	Model         string `json:"model,omitempty"`          // Model for llm and rolling (default: the provider's)
+}
+
+func (c CompactionConfig) validate() error {
+	switch c.Strategy {
+	case "", CompactLLM, CompactRolling, CompactExtractive:
+	default:
+		return fmt.Errorf("config: session.compaction.strategy: %q must be llm, rolling, or extractive", c.Strategy)
+	}
+	if c.AfterMessages < 0 || c.KeepLast < 0 || c.MaxChars < 0 {
+		return fmt.Errorf("config: session.compaction: counts can't be negative")
+	}
+	if c.AfterMessages > 0 && c.KeepLast >= c.AfterMessages {
+		return fmt.Errorf("config: session.compaction: keep_last must be less than after_messages")
+	}
+	return nil
+}
+
+// RetentionConfig is how long sessions whose keys start with Prefix are
+// kept once idle. The policy with the longest matching prefix applies.
+type RetentionConfig struct {
+	Prefix           string `json:"prefix,omitempty"`             // Session key prefix (empty = every session)
+	ArchiveAfterDays int    `json:"archive_after_days,omitempty"` // Compress into the archive after this many idle days (0 = never)
+	DeleteAfterDays  int    `json:"delete_after_days,omitempty"`  // Delete, archived or not, after this many idle days (0 = never)
+}
+
+// RetentionPolicies converts Retention for session.Manager.Prune.
+func (s SessionConfig) RetentionPolicies() ([]session.Retention, error) {
+	const day = 24 * time.Hour
+	seen := make(map[string]bool)
+	var out []session.Retention
+	for _, r := range s.Retention {
+		switch {
+		case seen[r.Prefix]:
+			return nil, fmt.Errorf("config: session.retention: duplicate prefix %q", r.Prefix)
+		case r.ArchiveAfterDays < 0 || r.DeleteAfterDays < 0:
+			return nil, fmt.Errorf("config: session.retention %q: days can't be negative", r.Prefix)
+		case r.DeleteAfterDays > 0 && r.ArchiveAfterDays >= r.DeleteAfterDays:
+			return nil, fmt.Errorf("config: session.retention %q: archive_after_days must be less than delete_after_days", r.Prefix)
+		}
+		seen[r.Prefix] = true
+		out = append(out, session.Retention{
+			Prefix:       r.Prefix,
+			ArchiveAfter: time.Duration(r.ArchiveAfterDays) * day,
+			DeleteAfter:  time.Duration(r.DeleteAfterDays) * day,
+		})
+	}
+	return out, nil
+}
+
+// LoopConfig controls the agent loop.
+type LoopConfig struct {
+	MaxIterations       int    `json:"max_iterations"`
+	MaxToolOutput       int    `json:"max_tool_output,omitempty"`       // Bytes per tool result (default 32768)
+	SummarizeToolOutput bool   `json:"summarize_tool_output,omitempty"` // Summarize instead of truncating
+	ExtractLearnings    bool   `json:"extract_learnings,omitempty"`     // Store learnings from each run in agent-memory
+	AskTimeout          string `json:"ask_timeout,omitempty"`           // How long user.ask waits for an answer (default "10m")
+	RepeatLimit         int    `json:"repeat_limit,omitempty"`          // Identical tool calls in a row before the model is warned, then stopped (default 3)
+	ArgRetries          int    `json:"arg_retries,omitempty"`           // Tool calls in a row with malformed arguments before the run fails (default 3)
+	MaxContinues        int    `json:"max_continues,omitempty"`         // Times an answer cut off by max_tokens is continued (default 3)
+	Transcripts         string `json:"transcripts,omitempty"`           // Directory for a JSONL transcript of every run (empty = off)
+	Checkpoint          bool   `json:"checkpoint,omitempty"`            // Save runs after every step; the daemon resumes unfinished ones at startup
+	Reflection          bool   `json:"reflection,omitempty"`            // Check each answer against the request and tool results before replying
+	ReflectionModel     string `json:"reflection_model,omitempty"`      // Model for that check (default: the run's model)
+
+	Sampling provider.Sampling `json:"sampling"`           // Max tokens, temperature, top_p, stop, and seed for every run
+	Thinking string            `json:"thinking,omitempty"` // Extended thinking: "log" or "save" (default: dropped after the run)
+}
+
+// AskTimeoutDuration parses AskTimeout, returning 0 when it is unset.
+func (l LoopConfig) AskTimeoutDuration() (time.Duration, error) {
+	if l.AskTimeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(l.AskTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("config: loop.ask_timeout: %w", err)
+	}
+	return d, nil
+}
+
+// EvalConfig controls call capture.
+type EvalConfig struct {
+	DB     string      `json:"db"`     // SQLite call database
+	Memory string      `json:"memory"` // SQLite learning store ("" = use the agent-memory binary)
+	Judge  JudgeConfig `json:"judge"`
+}
+
+// JudgeConfig picks the model that grades runs (`teeny eval score`).
+type JudgeConfig struct {
+	Provider  string `json:"provider,omitempty"` // Default: the main provider
+	Model     string `json:"model,omitempty"`    // Default: the provider's model
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+	BaseURL   string `json:"base_url,omitempty"`
+}
+
+// EmbeddingConfig picks the model that embeds text for semantic recall and
+// document retrieval.
+type EmbeddingConfig struct {
+	Provider  string `json:"provider,omitempty"` // "openai" or "ollama" ("" = keyword search only)
+	Model     string `json:"model,omitempty"`    // Default: the provider's default embedding model
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+	BaseURL   string `json:"base_url,omitempty"`
+}
+
+// ContextConfig controls what goes into the system prompt.
+type ContextConfig struct {
+	Skills         string   `json:"skills,omitempty"`           // Skills directory (default <workspace>/skills)
+	Bootstrap      []string `json:"bootstrap,omitempty"`        // Workspace files or globs, highest priority first (default AGENTS.md, SOUL.md, USER.md, IDENTITY.md, TOOLS.md)
+	TreeDepth      int      `json:"tree_depth"`                 // Levels of the workspace file tree in the prompt (0 = none)
+	TreeMaxEntries int      `json:"tree_max_entries,omitempty"` // Entry limit for the file tree (default 200)
+	MaxTools       int      `json:"max_tools,omitempty"`        // Tools offered per message, most relevant first (0 = all)
+	ToolRanking    string   `json:"tool_ranking,omitempty"`     // "keyword" (default) or "embedding"
+
+	HistoryMessages int `json:"history_messages,omitempty"` // Most recent session messages sent with each prompt (0 = all that fit)
+	HistoryTokens   int `json:"history_tokens,omitempty"`   // Token budget for session history per prompt (0 = the model's context window)
+}
+
+// RAGConfig controls retrieval of workspace documents into the system prompt.
+// It requires an embedding provider.
+type RAGConfig struct {
+	Enabled   bool     `json:"enabled,omitempty"`
+	Include   []string `json:"include,omitempty"`    // Globs relative to the workspace (default **/*.md, **/*.txt)
+	TopK      int      `json:"top_k,omitempty"`      // Passages per message (default 4)
+	MaxTokens int      `json:"max_tokens,omitempty"` // Token budget for passages (default 2000)
+	Index     string   `json:"index"`                // Cache of chunks and vectors
+}
+
+// AttachConfig controls files attached to prompts with run --file.
+type AttachConfig struct {
+	MaxBytes  int64  `json:"max_bytes,omitempty"` // Largest file accepted (default 10 MB)
+	MaxText   int    `json:"max_text,omitempty"`  // Text kept per file, in bytes (default 256 KB)
+	Cache     string `json:"cache"`               // Extracted PDF text, by content hash
+	PDFToText string `json:"pdftotext,omitempty"` // Text extractor binary (default "pdftotext")
+}
+
+// ServerConfig controls the daemon's HTTP endpoint.
+type ServerConfig struct {
+	Listen string        `json:"listen,omitempty"` // e.g. "127.0.0.1:9090" (empty = no HTTP server)
+	Tokens []TokenConfig `json:"tokens,omitempty"` // Bearer tokens the API requires (none = open, for localhost only)
+}
+
+// TokenConfig is a bearer token for the daemon's API and what it may do.
+type TokenConfig struct {
+	Name     string   `json:"name"`
+	TokenEnv string   `json:"token_env"`          // Environment variable holding the token
+	Sessions []string `json:"sessions,omitempty"` // Session keys or globs, agent prefix included, it may use (empty = all)
+	Profile  string   `json:"profile,omitempty"`  // Permission profile for its runs ("" = the session's)
+	Schedule bool     `json:"schedule,omitempty"` // May read job history and use the schedule tool
+	Reload   bool     `json:"reload,omitempty"`   // May reload the daemon's config (POST /v1/reload)
+}
+
+// validate checks that each token has a name and env var, and names a
+// profile that exists.
+func (s ServerConfig) validate(perms PermissionsConfig) error {
+	seen := make(map[string]bool)
+	for _, t := range s.Tokens {
+		if t.Name == "" || t.TokenEnv == "" {
+			return fmt.Errorf("config: server.tokens: each token needs a name and token_env")
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("config: server.tokens: duplicate token %q", t.Name)
+		}
+		seen[t.Name] = true
+		for _, pattern := range t.Sessions {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("config: server.tokens %s: session %q: %w", t.Name, pattern, err)
+			}
+		}
+		if t.Profile != "" {
+			if _, err := perms.Profile("", t.Profile); err != nil {
+				return fmt.Errorf("config: server.tokens %s: %w", t.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// QueueConfig bounds the daemon's concurrent runs. Runs on one session
+// always wait for each other.
+type QueueConfig struct {
+	MaxRuns int    `json:"max_runs,omitempty"` // Runs at once across channels, hooks, API, and jobs (default 4, -1 = unlimited)
+	Drain   string `json:"drain,omitempty"`    // How long shutdown waits for runs in progress before cancelling them (default "30s")
+}
+
+// DefaultDrain is how long the daemon waits for runs when it shuts down.
+const DefaultDrain = 30 * time.Second
+
+// DrainDuration parses Drain, returning DefaultDrain when it is unset.
+func (q QueueConfig) DrainDuration() (time.Duration, error) {
+	if q.Drain == "" {
+		return DefaultDrain, nil
+	}
+	d, err := time.ParseDuration(q.Drain)
+	if err != nil {
+		return 0, fmt.Errorf("config: queue.drain: %w", err)
+	}
+	return d, nil
+}
+
+// RedactConfig masks secrets in logs, transcripts, and saved sessions.
+// The built-in patterns (redact.Builtin) and the values of the secret env
+// vars named in this config are always masked unless Disabled.
+type RedactConfig struct {
+	Disabled bool     `json:"disabled,omitempty"`
+	Patterns []string `json:"patterns,omitempty"` // Extra regexps; with a capture group only the group is masked
+}
+
+// SecretEnvs returns the env vars the config reads secrets from.
+func (c *Config) SecretEnvs() []string {
+	names := []string{c.Provider.APIKeyEnv, c.Session.KeyEnv, c.Session.Redis.PasswordEnv, c.Postgres.URLEnv, c.Notify.SMTP.PasswordEnv,
+		c.Channels.Slack.AppTokenEnv, c.Channels.Slack.BotTokenEnv, c.Channels.Email.PasswordEnv,
+		c.Channels.GitHub.TokenEnv, c.Channels.GitHub.SecretEnv, c.Tools.GitHub.TokenEnv}
+	if c.Archive.Enabled() {
+		names = append(names, c.Archive.S3.AccessKeyEnv, c.Archive.S3.SecretKeyEnv, c.Archive.S3.SessionTokenEnv)
+	}
+	for _, h := range c.Hooks {
+		names = append(names, h.SecretEnv)
+	}
+	for _, t := range c.Server.Tokens {
+		names = append(names, t.TokenEnv)
+	}
+	for name := range c.Agents {
+		if ac, err := c.Agent(name); err == nil {
+			names = append(names, ac.Provider.APIKeyEnv)
+		}
+	}
+	return slices.DeleteFunc(names, func(n string) bool { return n == "" })
+}
+
+// GuardConfig sets content policies checked on answers, on tool
+// arguments before the tools run, and on tool results before the model
+// reads them.
+type GuardConfig struct {
+	Rules      []guard.Rule     `json:"rules,omitempty"`
+	Deny       guard.Denylist   `json:"deny"` // Relative paths are resolved against the workspace
+	Classifier ClassifierConfig `json:"classifier"`
+	Injection  InjectionConfig  `json:"injection"`
+}
+
+// IsZero reports whether no guardrail is configured.
+func (g GuardConfig) IsZero() bool {
+	return len(g.Rules) == 0 && len(g.Deny.Paths) == 0 && len(g.Deny.Commands) == 0 && !g.Classifier.Enabled &&
+		!g.Injection.Screen && !g.Injection.Classifier
+}
+
+// ClassifierConfig has a model check content against a policy.
+type ClassifierConfig struct {
+	Enabled bool     `json:"enabled,omitempty"`
+	Model   string   `json:"model,omitempty"`   // Default: provider.model
+	Policy  string   `json:"policy,omitempty"`  // What to flag (default guard.DefaultPolicy)
+	Targets []string `json:"targets,omitempty"` // "output" and/or "tool" (default both)
+}
+
+// InjectionConfig defends against prompt injections in tool results, such
+// as a fetched page telling the agent to ignore its instructions.
+type InjectionConfig struct {
+	Wrap       bool     `json:"wrap,omitempty"`       // Mark tool results as untrusted data for the model
+	Screen     bool     `json:"screen,omitempty"`     // Check tool results for injection phrasing (guard.Injection)
+	Classifier bool     `json:"classifier,omitempty"` // Also ask a model, guard.classifier.model, about every tool result
+	Action     string   `json:"action,omitempty"`     // What a screen hit does: "quarantine" (default), "block", or "warn"
+	Tools      []string `json:"tools,omitempty"`      // Tool name globs screened (default all)
+}
+
+func (g GuardConfig) validate() error {
+	if _, err := guard.Rules(g.Rules...); err != nil {
+		return err
+	}
+	for _, t := range g.Classifier.Targets {
+		if t != guard.Output && t != guard.ToolArgs {
+			return fmt.Errorf("guard.classifier.targets: %q must be output or tool", t)
+		}
+	}
+	switch g.Injection.Action {
+	case "", guard.Quarantine, guard.Block, guard.Warn:
+	default:
+		return fmt.Errorf("guard.injection.action: %q must be quarantine, block, or warn", g.Injection.Action)
+	}
+	return nil
+}
+
+// AgentConfig declares a named agent. It runs with the top-level config
+// except for the fields set here. Provider and Tools are merged field by
+// field over their top-level values, so {"provider": {"model": "..."}}
+// only changes the model; naming a different provider starts from that
+// provider's defaults instead.
+type AgentConfig struct {
+	Workspace     string          `json:"workspace,omitempty"`
+	Provider      json.RawMessage `json:"provider,omitempty"`
+	Tools         json.RawMessage `json:"tools,omitempty"`
+	SessionPrefix string          `json:"session_prefix,omitempty"` // Prepended to the agent's session keys (default "<name>:")
+}
+
+// Agent returns the config the named agent runs with. An empty name is
+// the default agent, c itself.
+func (c *Config) Agent(name string) (*Config, error) {
+	if name == "" {
+		return c, nil
+	}
+	ac, ok := c.Agents[name]
+	if !ok {
+		return nil, fmt.Errorf("config: unknown agent %q", name)
+	}
+	out := *c
+	if ac.Workspace != "" {
+		out.Workspace = ac.Workspace
+	}
+	if len(ac.Provider) > 0 {
+		var named struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(ac.Provider, &named); err != nil {
+			return nil, fmt.Errorf("config: agents.%s.provider: %w", name, err)
+		}
+		base := c.Provider
+		if named.Name != "" && named.Name != c.Provider.Name {
+			base = Default().Provider
+		}
+		if err := overlay(base, ac.Provider, &out.Provider); err != nil {
+			return nil, fmt.Errorf("config: agents.%s.provider: %w", name, err)
+		}
+		out.Provider.useProviderDefaults()
+	}
+	if len(ac.Tools) > 0 {
+		if err := overlay(c.Tools, ac.Tools, &out.Tools); err != nil {
+			return nil, fmt.Errorf("config: agents.%s.tools: %w", name, err)
+		}
+	}
+	return &out, nil
+}
+
+// AgentPrefix returns the session key prefix of the named agent: "" for
+// the default agent, otherwise its session_prefix or "<name>:".
+func (c *Config) AgentPrefix(name string) string {
+	if name == "" {
+		return ""
+	}
+	if p := c.Agents[name].SessionPrefix; p != "" {
+		return p
+	}
+	return name + ":"
+}
+
+// overlay decodes patch over a deep copy of base into out, so maps and
+// slices in base are never modified.
+func overlay[T any](base T, patch json.RawMessage, out *T) error {
+	data, err := json.Marshal(base)
+	if err != nil {
+		return err
+	}
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(patch, &v); err != nil {
+		return err
+	}
+	*out = v
+	return nil
+}
+
+// validateHooks checks that each hook is signed, or says it needn't be.
+func (c *Config) validateHooks() error {
+	for _, h := range c.Hooks {
+		if h.SecretEnv == "" && !h.Unsigned {
+			return fmt.Errorf("config: hook %s: set secret_env, or unsigned to accept unsigned requests", h.Name)
+		}
+	}
+	return nil
+}
+
+// validateChannels checks that enabled channels can tell who is writing.
+func (c *Config) validateChannels() error {
+	if gc := c.Channels.GitHub; gc.Enabled && gc.SecretEnv == "" {
+		return fmt.Errorf("config: channels.github.secret_env must be set; unsigned deliveries could start runs as anyone")
+	}
+	if ec := c.Channels.Email; ec.Enabled && len(ec.Allow) == 0 {
+		return fmt.Errorf("config: channels.email.allow must list the senders that may run the agent")
+	}
+	return nil
+}
+
+// validateAgents checks that each agent's config is usable and that
+// hooks, jobs, and channels only name agents that exist.
+func (c *Config) validateAgents() error {
+	known := func(name string) bool {
+		_, ok := c.Agents[name]
+		return name == "" || ok
+	}
+	for _, h := range c.Hooks {
+		if !known(h.Agent) {
+			return fmt.Errorf("config: hook %s: unknown agent %q", h.Name, h.Agent)
+		}
+	}
+	for _, t := range c.Triggers {
+		if !known(t.Agent) {
+			return fmt.Errorf("config: trigger %s: unknown agent %q", t.Name, t.Agent)
+		}
+	}
+	for _, j := range c.Jobs {
+		if !known(j.Agent) {
+			return fmt.Errorf("config: job %s: unknown agent %q", j.Name, j.Agent)
+		}
+	}
+	for channel, name := range c.Channels.Slack.Agents {
+		if !known(name) {
+			return fmt.Errorf("config: channels.slack.agents.%s: unknown agent %q", channel, name)
+		}
+	}
+	if !known(c.Channels.Email.Agent) {
+		return fmt.Errorf("config: channels.email.agent: unknown agent %q", c.Channels.Email.Agent)
+	}
+	if !known(c.Channels.GitHub.Agent) {
+		return fmt.Errorf("config: channels.github.agent: unknown agent %q", c.Channels.GitHub.Agent)
+	}
+	for name := range c.Agents {
+		if name == "" {
+			return fmt.Errorf("config: agents: name must not be empty")
+		}
+		ac, err := c.Agent(name)
+		if err != nil {
+			return err
+		}
+		if _, err := ac.Provider.HTTP.TimeoutDuration(); err != nil {
+			return fmt.Errorf("agents.%s: %w", name, err)
+		}
+		if _, err := ac.Provider.Retry.Parse(); err != nil {
+			return fmt.Errorf("agents.%s: %w", name, err)
+		}
+		if _, err := ac.Provider.Cache.Parse(); err != nil {
+			return fmt.Errorf("agents.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// NotifyConfig configures result delivery for jobs' notify targets.
+type NotifyConfig struct {
+	SMTP SMTPConfig `json:"smtp"`
+}
+
+// CostConfig controls spend tracking.
+type CostConfig struct {
+	Pricing map[string]cost.Price `json:"pricing,omitempty"` // USD per 1M tokens by model or prefix; overrides built-ins
+	Budget  BudgetConfig          `json:"budget"`
+}
+
+// BudgetConfig caps spend across all sessions over rolling windows.
+type BudgetConfig struct {
+	Daily     float64         `json:"daily,omitempty"`     // USD per rolling 24h (0 = no limit)
+	Weekly    float64         `json:"weekly,omitempty"`    // USD per rolling 7 days (0 = no limit)
+	Ledger    string          `json:"ledger,omitempty"`    // Spend log shared by all teeny processes (JSON Lines)
+	Downgrade string          `json:"downgrade,omitempty"` // Model to switch to when over budget ("" = refuse runs)
+	Notify    []notify.Target `json:"notify,omitempty"`    // Alerted once per window when a budget is hit
+}
+
+// SMTPConfig is the mail server used for email targets.
+type SMTPConfig struct {
+	Host        string `json:"host,omitempty"`
+	Port        int    `json:"port,omitempty"` // Default 587
+	Username    string `json:"username,omitempty"`
+	PasswordEnv string `json:"password_env,omitempty"` // Env var holding the password
+	From        string `json:"from,omitempty"`
+}
+
+// HookConfig maps an inbound webhook to an agent run. Session and Prompt
+// are Go templates rendered with the decoded JSON payload.
+type HookConfig struct {
+	Name      string   `json:"name"`
+	Session   string   `json:"session,omitempty"` // Default "hook-<name>"
+	Prompt    string   `json:"prompt"`
+	SecretEnv string   `json:"secret_env,omitempty"` // Env var with the HMAC-SHA256 secret; required unless Unsigned
+	Unsigned  bool     `json:"unsigned,omitempty"`   // Accept requests without a signature from anyone who can reach the server
+	Events    []string `json:"events,omitempty"`     // Accepted X-GitHub-Event values
+	Agent     string   `json:"agent,omitempty"`      // Named agent that runs the hook (default: the default agent)
+}
+
+// TriggerConfig runs a prompt when watched files change. Session and
+// Prompt are Go templates rendered with the trigger's Name and the
+// changed Files.
+type TriggerConfig struct {
+	Name     string   `json:"name"`
+	Paths    []string `json:"paths"`             // Files, directories, or globs (the glob only in the last element)
+	Events   []string `json:"events,omitempty"`  // create, write, remove, rename (default create and write)
+	Session  string   `json:"session,omitempty"` // Default "trigger-<name>"
+	Prompt   string   `json:"prompt"`
+	Debounce string   `json:"debounce,omitempty"` // Quiet period that batches changes into one run (default 2s)
+	Agent    string   `json:"agent,omitempty"`    // Named agent that runs the trigger (default: the default agent)
+}
+
+// DebounceDuration parses Debounce, returning 0 (the trigger default)
+// when it is unset.
+func (t TriggerConfig) DebounceDuration() (time.Duration, error) {
+	if t.Debounce == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(t.Debounce)
+	if err != nil {
+		return 0, fmt.Errorf("config: trigger %s: debounce: %w", t.Name, err)
+	}
+	return d, nil
+}
+
+// ChannelsConfig enables chat integrations in the daemon.
+type ChannelsConfig struct {
+	Slack  SlackConfig  `json:"slack"`
+	Email  EmailConfig  `json:"email"`
+	GitHub GitHubConfig `json:"github"`
+}
+
+// SlackConfig connects the daemon to Slack over Socket Mode.
+type SlackConfig struct {
+	Enabled     bool   `json:"enabled"`
+	AppTokenEnv string `json:"app_token_env,omitempty"` // Env var with the xapp- token
+	BotTokenEnv string `json:"bot_token_env,omitempty"` // Env var with the xoxb- token
+	Progress    bool   `json:"progress,omitempty"`      // Post tool progress in the thread
+
+	Agents map[string]string `json:"agents,omitempty"` // Channel ID → named agent answering there (default: the default agent)
+}
+
+// EmailConfig lets people email the agent. The daemon polls an IMAP
+// mailbox and replies through notify.smtp.
+type EmailConfig struct {
+	Enabled     bool     `json:"enabled"`
+	IMAPHost    string   `json:"imap_host,omitempty"`
+	IMAPPort    int      `json:"imap_port,omitempty"` // Default 993
+	Insecure    bool     `json:"insecure,omitempty"`  // Plain-text IMAP instead of TLS (local servers only)
+	Username    string   `json:"username,omitempty"`
+	PasswordEnv string   `json:"password_env,omitempty"`  // Env var holding the IMAP password
+	Mailbox     string   `json:"mailbox,omitempty"`       // Default "INBOX"
+	Poll        string   `json:"poll,omitempty"`          // How often to check for mail (default 1m)
+	Allow       []string `json:"allow,omitempty"`         // Senders that may start runs: addresses or "@domain" (required)
+	AuthServID  string   `json:"auth_serv_id,omitempty"`  // Only trust Authentication-Results from this server (default: the topmost header)
+	NoAuthCheck bool     `json:"no_auth_check,omitempty"` // Accept mail the receiving server didn't authenticate (servers that add no Authentication-Results)
+	Agent       string   `json:"agent,omitempty"`         // Named agent answering email (default: the default agent)
+}
+
+// PollDuration parses Poll, returning 0 (the adapter default) when it is
+// unset.
+func (e EmailConfig) PollDuration() (time.Duration, error) {
+	if e.Poll == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(e.Poll)
+	if err != nil {
+		return 0, fmt.Errorf("config: channels.email.poll: %w", err)
+	}
+	return d, nil
+}
+
+// GitHubConfig answers GitHub issue and pull request comments that mention
+// Bot. GitHub delivers issue_comment webhooks to POST /v1/github.
+type GitHubConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Bot       string   `json:"bot"`                  // Login that comments mention, e.g. "teeny-bot"
+	TokenEnv  string   `json:"token_env,omitempty"`  // Env var with a token that can read pull requests and write comments
+	SecretEnv string   `json:"secret_env,omitempty"` // Env var with the webhook secret (required)
+	APIURL    string   `json:"api_url,omitempty"`    // Default https://api.github.com
+	Repos     []string `json:"repos,omitempty"`      // "owner/name" repos to answer in (empty = any)
+	Agent     string   `json:"agent,omitempty"`      // Named agent answering comments (default: the default agent)
+
+	Associations []string `json:"associations,omitempty"` // Commenter associations that may start runs (default OWNER, MEMBER, COLLABORATOR)
+}
+
+// Default returns the configuration written by `teeny init`.
+func Default() Config {
+	return Config{
+		Workspace: "~/.teeny-claw/workspace",
+		Provider: ProviderConfig{
+			Name:      "anthropic",
+			Model:     "claude-sonnet-4-20250514",
+			APIKeyEnv: "ANTHROPIC_API_KEY",
+		},
+		Tools: ToolsConfig{
+			Path:    []string{"~/.teeny-claw/tools"},
+			Timeout: 30,
+			Secrets: SecretsConfig{
+				Sources: []string{"env", "file"},
+				Dir:     "~/.teeny-claw/secrets",
+				Service: "teeny-claw",
+			},
+			FS:   FSToolConfig{BackupDir: "~/.teeny-claw/backups"},
+			Code: CodeToolConfig{ArtifactDir: "~/.teeny-claw/artifacts"},
+		},
+		Session: SessionConfig{Dir: "~/.teeny-claw/sessions", KeyEnv: "TEENY_SESSION_KEY"},
+		Loop:    LoopConfig{MaxIterations: 20},
+		Eval:    EvalConfig{DB: "~/.teeny-claw/eval.db"},
+		Daemon:  "~/.teeny-claw/daemon.json",
+		History: "~/.teeny-claw/history.jsonl",
+		Cost:    CostConfig{Budget: BudgetConfig{Ledger: "~/.teeny-claw/spend.jsonl"}},
+		RAG:     RAGConfig{Index: "~/.teeny-claw/rag.json"},
+		Attach:  AttachConfig{Cache: "~/.teeny-claw/cache/documents"},
+		Context: ContextConfig{TreeDepth: 3, TreeMaxEntries: 200},
+		Archive: ArchiveConfig{
+			S3: S3Config{
+				AccessKeyEnv:    "AWS_ACCESS_KEY_ID",
+				SecretKeyEnv:    "AWS_SECRET_ACCESS_KEY",
+				SessionTokenEnv: "AWS_SESSION_TOKEN",
+			},
+			Prefix:      "teeny/",
+			Transcripts: ArchiveTarget{StorageClass: "GLACIER"},
+			Sessions:    ArchiveTarget{StorageClass: "GLACIER"},
+		},
+		Channels: ChannelsConfig{Slack: SlackConfig{
+			AppTokenEnv: "SLACK_APP_TOKEN",
+			BotTokenEnv: "SLACK_BOT_TOKEN",
+			Progress:    true,
+		}},
+	}
+}
+
+// Load reads the config file at path, falling back to defaults if it is
+// missing. Fields absent from the file keep their default values.
+// Environment overrides are applied last.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	data, err := os.ReadFile(ExpandHome(path))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := decode(path, data, &cfg); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(os.Getenv); err != nil {
+		return nil, err
+	}
+	cfg.Provider.useProviderDefaults()
+	if err := cfg.Permissions.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Server.validate(cfg.Permissions); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Loop.AskTimeoutDuration(); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Session.RetentionPolicies(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Session.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validatePostgres(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateArchive(); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Queue.DrainDuration(); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Channels.Email.PollDuration(); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Tools.Code.TimeoutDuration(); err != nil {
+		return nil, err
+	}
+	if _, err := toolreg.ParseDryRun(cfg.Tools.DryRun); err != nil {
+		return nil, fmt.Errorf("config: tools.dry_run: %w", err)
+	}
+	if err := cfg.Tools.Paths.Validate(); err != nil {
+		return nil, fmt.Errorf("config: tools.paths.%w", err)
+	}
+	for _, t := range cfg.Triggers {
+		if _, err := t.DebounceDuration(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := cfg.Provider.HTTP.TimeoutDuration(); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Provider.Retry.Parse(); err != nil {
+		return nil, err
+	}
+	if _, err := cfg.Provider.Cache.Parse(); err != nil {
+		return nil, err
+	}
+	if _, err := redact.New(cfg.Redact.Patterns...); err != nil {
+		return nil, err
+	}
+	if err := cfg.Guard.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateHooks(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateChannels(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateAgents(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// decode parses data by file extension. YAML and TOML are normalized
+// through JSON so every struct only needs json tags.
+func decode(path string, data []byte, cfg *Config) error {
+	var generic map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &generic); err != nil {
+			return err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &generic); err != nil {
+			return err
+		}
+	default:
+		return json.Unmarshal(data, cfg)
+	}
+	normalized, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(normalized, cfg)
+}
+
+// applyEnv overrides fields from TEENY_* environment variables.
+func (c *Config) applyEnv(getenv func(string) string) error {
+	strs := map[string]*string{
+		"TEENY_WORKSPACE":   &c.Workspace,
+		"TEENY_PROVIDER":    &c.Provider.Name,
+		"TEENY_MODEL":       &c.Provider.Model,
+		"TEENY_API_KEY_ENV": &c.Provider.APIKeyEnv,
+		"TEENY_BASE_URL":    &c.Provider.BaseURL,
+		"TEENY_SESSION_DIR": &c.Session.Dir,
+		"TEENY_EVAL_DB":     &c.Eval.DB,
+		"TEENY_MEMORY_DB":   &c.Eval.Memory,
+		"TEENY_LISTEN":      &c.Server.Listen,
+	}
+	for name, field := range strs {
+		if v := getenv(name); v != "" {
+			*field = v
+		}
+	}
+
+	ints := map[string]*int{
+		"TEENY_TOOLS_TIMEOUT":  &c.Tools.Timeout,
+		"TEENY_MAX_ITERATIONS": &c.Loop.MaxIterations,
+	}
+	for name, field := range ints {
+		if v := getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*field = n
+		}
+	}
+
+	if v := getenv("TEENY_TOOLS_PATH"); v != "" {
+		c.Tools.Path = filepath.SplitList(v)
+	}
+	return nil
+}
+
+// AllJobs returns jobs declared in the config plus any from the Daemon file.
+func (c *Config) AllJobs() ([]scheduler.Job, error) {
+	jobs := append([]scheduler.Job(nil), c.Jobs...)
+	if c.Daemon == "" {
+		return jobs, nil
+	}
+	dcfg, err := scheduler.LoadDaemonConfig(ExpandHome(c.Daemon))
+	if os.IsNotExist(err) {
+		return jobs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load daemon config: %w", err)
+	}
+	return append(jobs, dcfg.Jobs...), nil
+}
+
+// PidFile returns the daemon's PID file, pid_file in the Daemon file, or
+// "" if none is set.
+func (c *Config) PidFile() (string, error) {
+	if c.Daemon == "" {
+		return "", nil
+	}
+	dcfg, err := scheduler.LoadDaemonConfig(ExpandHome(c.Daemon))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("load daemon config: %w", err)
+	}
+	return ExpandHome(dcfg.PidFile), nil
+}
+
+// ExpandHome replaces a leading "~" with the user's home directory.
+func ExpandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, path[1:])
+	}
+	return path
+}
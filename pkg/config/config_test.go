@@ -0,0 +1,587 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/scheduler"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func TestLoad_MissingFileUsesDefaults(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), "nope.json"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Provider.Name != "anthropic" || cfg.Tools.Timeout != 30 || cfg.Loop.MaxIterations != 20 {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoad_JSONPartialOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"provider": {"name": "openai", "model": "gpt-4o"}}`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Provider.Name != "openai" || cfg.Provider.Model != "gpt-4o" {
+		t.Errorf("provider not overridden: %+v", cfg.Provider)
+	}
+	if cfg.Session.Dir != "~/.teeny-claw/sessions" {
+		t.Errorf("unset fields should keep defaults, got %q", cfg.Session.Dir)
+	}
+}
+
+func TestLoad_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+workspace: /work
+provider:
+  name: openai
+  api_key_env: MY_KEY
+loop:
+  max_iterations: 5
+jobs:
+  - name: nightly
+    schedule: "0 2 * * *"
+    prompt: Summarize the day
+    session: nightly
+    enabled: true
+`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Workspace != "/work" || cfg.Provider.APIKeyEnv != "MY_KEY" || cfg.Loop.MaxIterations != 5 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if len(cfg.Jobs) != 1 || cfg.Jobs[0].Schedule != "0 2 * * *" || !cfg.Jobs[0].Enabled {
+		t.Errorf("unexpected jobs: %+v", cfg.Jobs)
+	}
+}
+
+func TestLoad_TOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	os.WriteFile(path, []byte(`
+workspace = "/work"
+
+[tools]
+path = ["/a", "/b"]
+timeout = 10
+
+[[jobs]]
+name = "hourly"
+schedule = "@every 1h"
+prompt = "ping"
+`), 0644)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.Tools.Path) != 2 || cfg.Tools.Timeout != 10 {
+		t.Errorf("unexpected tools: %+v", cfg.Tools)
+	}
+	if len(cfg.Jobs) != 1 || cfg.Jobs[0].Name != "hourly" {
+		t.Errorf("unexpected jobs: %+v", cfg.Jobs)
+	}
+}
+
+func TestLoad_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("provider: [unclosed"), 0644)
+	if _, err := Load(path); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := Default()
+	env := map[string]string{
+		"TEENY_MODEL":          "gpt-4o-mini",
+		"TEENY_MAX_ITERATIONS": "7",
+		"TEENY_TOOLS_PATH":     "/x" + string(os.PathListSeparator) + "/y",
+	}
+	if err := cfg.applyEnv(func(k string) string { return env[k] }); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if cfg.Provider.Model != "gpt-4o-mini" || cfg.Loop.MaxIterations != 7 || len(cfg.Tools.Path) != 2 {
+		t.Errorf("env not applied: %+v", cfg)
+	}
+
+	env["TEENY_MAX_ITERATIONS"] = "many"
+	if err := cfg.applyEnv(func(k string) string { return env[k] }); err == nil {
+		t.Error("expected error for non-numeric override")
+	}
+}
+
+func TestAllJobs_MergesDaemonFile(t *testing.T) {
+	dir := t.TempDir()
+	daemon := filepath.Join(dir, "daemon.json")
+	os.WriteFile(daemon, []byte(`{"jobs":[{"name":"legacy","schedule":"@every 1h"}]}`), 0644)
+
+	cfg := Default()
+	cfg.Jobs = []scheduler.Job{{Name: "inline", Schedule: "@every 5m"}}
+	cfg.Daemon = daemon
+	jobs, err := cfg.AllJobs()
+	if err != nil {
+		t.Fatalf("AllJobs: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].Name != "inline" || jobs[1].Name != "legacy" {
+		t.Errorf("unexpected jobs: %+v", jobs)
+	}
+
+	cfg.Daemon = filepath.Join(dir, "missing.json")
+	if jobs, err := cfg.AllJobs(); err != nil || len(jobs) != 1 {
+		t.Errorf("missing daemon file should be ignored: %v %v", jobs, err)
+	}
+}
+
+func TestPidFile(t *testing.T) {
+	dir := t.TempDir()
+	daemon := filepath.Join(dir, "daemon.json")
+	os.WriteFile(daemon, []byte(`{"pid_file":"/run/teeny/teeny.pid","jobs":[]}`), 0644)
+
+	cfg := Default()
+	cfg.Daemon = daemon
+	if path, err := cfg.PidFile(); err != nil || path != "/run/teeny/teeny.pid" {
+		t.Errorf("PidFile = %q, %v", path, err)
+	}
+	cfg.Daemon = filepath.Join(dir, "missing.json")
+	if path, err := cfg.PidFile(); err != nil || path != "" {
+		t.Errorf("missing daemon file: %q, %v", path, err)
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	if got := ExpandHome("~/x"); got != filepath.Join(home, "x") {
+		t.Errorf("ExpandHome(~/x) = %q", got)
+	}
+	if got := ExpandHome("/abs"); got != "/abs" {
+		t.Errorf("ExpandHome(/abs) = %q", got)
+	}
+}
+
+func TestPermissionsProfile(t *testing.T) {
+	p := PermissionsConfig{
+		Profiles: map[string]toolreg.Profile{
+			"readonly": {ReadOnly: true},
+			"nightly":  {Deny: []string{"deploy"}},
+		},
+		Sessions: map[string]string{"cron-*": "nightly", "cron-special": "readonly"},
+		Default:  "readonly",
+	}
+	tests := []struct {
+		session, name string
+		want          string // Profile name, "" for none
+		wantErr       bool
+	}{
+		{"cron-special", "", "readonly", false},
+		{"cron-digest", "", "nightly", false},
+		{"main", "", "readonly", false},
+		{"main", "nightly", "nightly", false},
+		{"main", "missing", "", true},
+	}
+	for _, tt := range tests {
+		got, err := p.Profile(tt.session, tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s/%s: expected error", tt.session, tt.name)
+			}
+			continue
+		}
+		if err != nil || got == nil || got.Name != tt.want {
+			t.Errorf("%s/%s: got %+v, %v; want %s", tt.session, tt.name, got, err, tt.want)
+		}
+	}
+
+	if got, _ := (PermissionsConfig{}).Profile("main", ""); got != nil {
+		t.Errorf("no config: got %+v, want nil", got)
+	}
+}
+
+func TestLoad_UnknownProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"permissions": {"sessions": {"main": "nope"}}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), `unknown profile "nope"`) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoad_InvalidAskTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"loop": {"ask_timeout": "soon"}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "loop.ask_timeout") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoad_InvalidDrain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"queue": {"drain": "a while"}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "queue.drain") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoad_InvalidTrigger(t *testing.T) {
+	tests := []struct{ config, want string }{
+		{`{"triggers": [{"name": "inbox", "paths": ["/tmp"], "prompt": "p", "debounce": "soon"}]}`, "trigger inbox: debounce"},
+		{`{"triggers": [{"name": "inbox", "paths": ["/tmp"], "prompt": "p", "agent": "ghost"}]}`, `trigger inbox: unknown agent "ghost"`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		os.WriteFile(path, []byte(tt.config), 0644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("err = %v, want %q", err, tt.want)
+		}
+	}
+}
+
+func TestLoad_InvalidEmail(t *testing.T) {
+	tests := []struct{ config, want string }{
+		{`{"channels": {"email": {"poll": "often"}}}`, "channels.email.poll"},
+		{`{"channels": {"email": {"agent": "ghost"}}}`, `channels.email.agent: unknown agent "ghost"`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		os.WriteFile(path, []byte(tt.config), 0644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("err = %v, want %q", err, tt.want)
+		}
+	}
+}
+
+func TestLoad_InvalidHTTPTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"provider": {"http": {"timeout": "5"}}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "provider.http.timeout") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoad_InvalidCodeTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"tools": {"code": {"enabled": true, "timeout": "a while"}}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "tools.code.timeout") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestSessionRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"session": {"retention": [
+		{"archive_after_days": 30, "delete_after_days": 365},
+		{"prefix": "slack:", "delete_after_days": 7}
+	]}}`), 0644)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies, _ := cfg.Session.RetentionPolicies()
+	if len(policies) != 2 || policies[0].ArchiveAfter != 30*24*time.Hour || policies[1].Prefix != "slack:" || policies[1].DeleteAfter != 7*24*time.Hour {
+		t.Errorf("policies = %+v", policies)
+	}
+
+	for _, bad := range []string{
+		`[{"archive_after_days": 30, "delete_after_days": 30}]`,
+		`[{"prefix": "a", "delete_after_days": -1}]`,
+		`[{"prefix": "a", "delete_after_days": 1}, {"prefix": "a", "delete_after_days": 2}]`,
+	} {
+		os.WriteFile(path, []byte(`{"session": {"retention": `+bad+`}}`), 0644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "session.retention") {
+			t.Errorf("%s: err = %v", bad, err)
+		}
+	}
+}
+
+func TestLoad_InvalidCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for _, bad := range []string{
+		`{"strategy": "abstractive"}`,
+		`{"strategy": "llm", "after_messages": 40, "keep_last": 40}`,
+		`{"strategy": "extractive", "max_chars": -1}`,
+	} {
+		os.WriteFile(path, []byte(`{"session": {"compaction": `+bad+`}}`), 0644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "session.compaction") {
+			t.Errorf("%s: err = %v", bad, err)
+		}
+	}
+}
+
+func TestLoad_InvalidSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for bad, want := range map[string]string{
+		`{"store": "s3"}`:    "session.store",
+		`{"store": "redis"}`: "session.redis.url",
+		`{"store": "redis", "redis": {"url": "redis://r", "ttl": "30d"}}`: "session.redis.ttl",
+	} {
+		os.WriteFile(path, []byte(`{"session": `+bad+`}`), 0644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v", bad, err)
+		}
+	}
+}
+
+func TestLoad_PostgresNeedsURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for _, bad := range []string{
+		`{"session": {"store": "postgres"}}`,
+		`{"postgres": {"history": true}}`,
+	} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "postgres.url") {
+			t.Errorf("%s: err = %v", bad, err)
+		}
+	}
+	os.WriteFile(path, []byte(`{"session": {"store": "postgres"}, "postgres": {"url_env": "DB_URL"}}`), 0644)
+	if _, err := Load(path); err != nil {
+		t.Errorf("with url_env: %v", err)
+	}
+}
+
+func TestLoad_InvalidArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	for bad, want := range map[string]string{
+		`{"archive": {"sessions": {"enabled": true}}}`:                                                                 "archive.s3.bucket",
+		`{"archive": {"s3": {"bucket": "b"}, "transcripts": {"enabled": true}}}`:                                       "loop.transcripts",
+		`{"archive": {"s3": {"bucket": "b"}, "sessions": {"enabled": true, "expire_days": -1}}}`:                       "negative",
+		`{"archive": {"s3": {"bucket": "b"}, "sessions": {"enabled": true, "transition_days": 30, "expire_days": 7}}}`: "expire_days",
+	} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v", bad, err)
+		}
+	}
+	os.WriteFile(path, []byte(`{"loop": {"transcripts": "/tmp/t"}, "archive": {"s3": {"bucket": "b"}, "transcripts": {"enabled": true}}}`), 0644)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(cfg.SecretEnvs(), "AWS_SECRET_ACCESS_KEY") {
+		t.Errorf("SecretEnvs = %v", cfg.SecretEnvs())
+	}
+}
+
+func TestLoad_InvalidInjectionAction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"guard": {"injection": {"screen": true, "action": "rewrite"}}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "guard.injection.action") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoad_InvalidDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"tools": {"dry_run": "yes"}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "tools.dry_run") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoad_InvalidNetworkPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"permissions": {"profiles": {"airgap": {"network": "off"}}}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "permissions.profiles.airgap.network") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoad_InvalidPaths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"tools": {"paths": {"deny": ["~/.ssh", "[abc"]}}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "tools.paths.deny") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoad_InvalidRetryBackoff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"provider": {"retry": {"attempts": 2, "backoff": "fast"}}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "provider.retry.backoff") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoad_OtherProviderUsesItsDefaults(t *testing.T) {
+	tests := []struct {
+		config             string
+		wantModel, wantKey string
+	}{
+		{`{"provider": {"name": "groq"}}`, "llama-3.3-70b-versatile", "GROQ_API_KEY"},
+		{`{"provider": {"name": "groq", "model": "llama-3.1-8b-instant"}}`, "llama-3.1-8b-instant", "GROQ_API_KEY"},
+		{`{"provider": {"name": "openai"}}`, "", ""},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		os.WriteFile(path, []byte(tt.config), 0644)
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Provider.Model != tt.wantModel || cfg.Provider.APIKeyEnv != tt.wantKey {
+			t.Errorf("%s: provider = %+v, want model %q and api_key_env %q", tt.config, cfg.Provider, tt.wantModel, tt.wantKey)
+		}
+	}
+}
+
+func TestLoad_InvalidRedactPattern(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"redact": {"patterns": ["token=(["]}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "redact") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestLoad_InvalidGuard(t *testing.T) {
+	tests := []struct {
+		name, json string
+	}{
+		{"rule action", `{"guard": {"rules": [{"name": "x", "pattern": "x", "action": "delete"}]}}`},
+		{"classifier target", `{"guard": {"classifier": {"enabled": true, "targets": ["input"]}}}`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		os.WriteFile(path, []byte(tt.json), 0644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "guard") {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestAgent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{
+		"provider": {"retry": {"attempts": 2}, "headers": {"X-Team": "a"}},
+		"tools": {"timeout": 60, "shell": {"enabled": true}},
+		"agents": {
+			"coder": {"workspace": "/src", "provider": {"model": "claude-opus-4", "headers": {"X-Agent": "coder"}}},
+			"home": {"provider": {"name": "ollama"}, "tools": {"shell": {"enabled": false}}, "session_prefix": "ha/"}
+		}
+	}`), 0644)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coder, err := cfg.Agent("coder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coder.Workspace != "/src" || coder.Provider.Model != "claude-opus-4" || coder.Provider.Retry.Attempts != 2 {
+		t.Errorf("coder = %+v", coder.Provider)
+	}
+	if coder.Provider.Headers["X-Team"] != "a" || coder.Provider.Headers["X-Agent"] != "coder" {
+		t.Errorf("coder headers = %v", coder.Provider.Headers)
+	}
+	if _, ok := cfg.Provider.Headers["X-Agent"]; ok || cfg.Provider.Model != Default().Provider.Model {
+		t.Errorf("agent changed the top-level provider: %+v", cfg.Provider)
+	}
+
+	home, err := cfg.Agent("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A different provider starts fresh rather than inheriting Anthropic settings.
+	if home.Provider.Name != "ollama" || home.Provider.Model != "" || home.Provider.APIKeyEnv != "" || home.Provider.Retry.Attempts != 0 {
+		t.Errorf("home = %+v", home.Provider)
+	}
+	if home.Tools.Shell.Enabled || home.Tools.Timeout != 60 || home.Workspace != cfg.Workspace {
+		t.Errorf("home tools = %+v, workspace %s", home.Tools, home.Workspace)
+	}
+	if !cfg.Tools.Shell.Enabled {
+		t.Error("agent changed the top-level tools")
+	}
+
+	if def, _ := cfg.Agent(""); def != cfg {
+		t.Error(`Agent("") is not the top-level config`)
+	}
+	if _, err := cfg.Agent("nope"); err == nil {
+		t.Error("unknown agent: no error")
+	}
+	for name, want := range map[string]string{"": "", "coder": "coder:", "home": "ha/"} {
+		if got := cfg.AgentPrefix(name); got != want {
+			t.Errorf("AgentPrefix(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLoad_InvalidAgent(t *testing.T) {
+	tests := []struct {
+		name, json string
+	}{
+		{"provider", `{"agents": {"a": {"provider": {"retry": {"backoff": "soon"}}}}}`},
+		{"hook", `{"hooks": [{"name": "gh", "prompt": "x", "secret_env": "S", "agent": "nope"}]}`},
+		{"job", `{"jobs": [{"name": "daily", "schedule": "@daily", "prompt": "x", "agent": "nope"}]}`},
+		{"slack channel", `{"channels": {"slack": {"agents": {"C1": "nope"}}}}`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		os.WriteFile(path, []byte(tt.json), 0644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "agent") {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestLoad_UnsignedHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"hooks": [{"name": "gh", "prompt": "x"}]}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "hook gh: set secret_env") {
+		t.Errorf("err = %v", err)
+	}
+	os.WriteFile(path, []byte(`{"hooks": [{"name": "gh", "prompt": "x", "unsigned": true}]}`), 0644)
+	if _, err := Load(path); err != nil {
+		t.Errorf("unsigned hook: %v", err)
+	}
+}
+
+func TestLoad_GitHubChannelNeedsSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"channels": {"github": {"enabled": true, "bot": "teeny-bot"}}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "channels.github.secret_env") {
+		t.Errorf("err = %v", err)
+	}
+	os.WriteFile(path, []byte(`{"channels": {"github": {"enabled": true, "bot": "teeny-bot", "secret_env": "GH_SECRET"}}}`), 0644)
+	if _, err := Load(path); err != nil {
+		t.Errorf("signed channel: %v", err)
+	}
+}
+
+func TestLoad_EmailChannelNeedsAllow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"channels": {"email": {"enabled": true, "imap_host": "imap.example.com"}}}`), 0644)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "channels.email.allow") {
+		t.Errorf("err = %v", err)
+	}
+	os.WriteFile(path, []byte(`{"channels": {"email": {"enabled": true, "imap_host": "imap.example.com", "allow": ["@example.com"]}}}`), 0644)
+	if _, err := Load(path); err != nil {
+		t.Errorf("email with allow: %v", err)
+	}
+}
+
+func TestLoad_InvalidToken(t *testing.T) {
+	tests := []struct {
+		name, json string
+	}{
+		{"no env", `{"server": {"tokens": [{"name": "ops"}]}}`},
+		{"duplicate", `{"server": {"tokens": [{"name": "ops", "token_env": "A"}, {"name": "ops", "token_env": "B"}]}}`},
+		{"bad glob", `{"server": {"tokens": [{"name": "ops", "token_env": "A", "sessions": ["["]}]}}`},
+		{"unknown profile", `{"server": {"tokens": [{"name": "ops", "token_env": "A", "profile": "nope"}]}}`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		os.WriteFile(path, []byte(tt.json), 0644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "server.tokens") {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
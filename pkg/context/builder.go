@@ -2,41 +2,79 @@
 package context
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/skills"
 	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
 )
 
 // Config controls context construction limits.
 type Config struct {
-	BootstrapMaxChars      int    // Per-file cap (default 20000)
-	BootstrapTotalMaxChars int    // Total cap across all files (default 24000)
-	LearningsMaxChars      int    // Max chars for injected learnings (default 4000)
-	LearningsTopic         string // Topic for learning queries (default "orchestrator learnings")
+	Bootstrap              []string // Files or globs relative to the workspace, highest priority first (default DefaultBootstrap)
+	BootstrapMaxChars      int      // Per-file cap (default 20000)
+	BootstrapTotalMaxChars int      // Total cap across all files (default 24000)
+	TreeDepth              int      // Levels of the workspace file tree to list (default 3; 0 = no tree)
+	TreeMaxEntries         int      // Max entries in the file tree (default 200)
+	LearningsMaxChars      int      // Max chars for injected learnings (default 4000)
+	LearningsTopic         string   // Topic for learning queries (default "orchestrator learnings")
+	Identity               string   // Replaces the built-in identity section if set
+	RetrievalTopK          int      // Passages retrieved per user message (default 4)
+	RetrievalMaxTokens     int      // Token budget for retrieved passages (default 2000)
+	MaxTools               int      // Tools offered per user message, most relevant first (0 = all)
+	HistoryMessages        int      // Most recent history messages sent with each prompt (0 = all that fit)
+	HistoryTokens          int      // Token budget for history sent with each prompt (0 = the model's context window)
+	MaxOutputTokens        int      // The configured max_tokens; the window keeps room for this or the model's output limit, whichever is smaller (0 = the model's)
 }
 
 // DefaultConfig returns sensible defaults.
 func DefaultConfig() Config {
 	return Config{
+		Bootstrap:              slices.Clone(DefaultBootstrap),
 		BootstrapMaxChars:      20000,
 		BootstrapTotalMaxChars: 24000,
+		TreeDepth:              3,
+		TreeMaxEntries:         200,
 		LearningsMaxChars:      4000,
 		LearningsTopic:         "orchestrator learnings",
+		RetrievalTopK:          4,
+		RetrievalMaxTokens:     2000,
 	}
 }
 
+// DefaultBootstrap is the bootstrap file list used when none is configured.
+var DefaultBootstrap = []string{"AGENTS.md", "SOUL.md", "USER.md", "IDENTITY.md", "TOOLS.md"}
+
+// Passage is a piece of a workspace document.
+type Passage struct {
+	Source string // Where it came from, e.g. "docs/setup.md:10-42"
+	Text   string
+}
+
+// Retriever finds workspace passages relevant to a message, best first.
+type Retriever interface {
+	Retrieve(ctx context.Context, query string, limit int) ([]Passage, error)
+}
+
 // Builder constructs LLM context.
 type Builder struct {
 	workspace string
 	cfg       Config
 	registry  *toolreg.Registry
-	learnings string // Pre-fetched learnings to inject into system prompt
+	learnings string    // Pre-fetched learnings to inject into system prompt
+	retriever Retriever // Optional document retrieval per user message
+	skills    []*skills.Skill
+	ranker    ToolRanker         // Ranks tools when MaxTools is set; nil means keywords
+	model     provider.ModelInfo // History is fitted to its context window (zero = no limit)
 }
 
 // NewBuilder creates a context builder for a workspace.
@@ -48,9 +86,37 @@ func NewBuilder(workspace string, cfg Config, registry *toolreg.Registry) *Build
 	}
 }
 
+// UseRetriever adds passages relevant to each user message to the system
+// prompt.
+func (b *Builder) UseRetriever(r Retriever) {
+	b.retriever = r
+}
+
+// UseSkills sets the skills that can be loaded for matching user messages.
+func (b *Builder) UseSkills(list []*skills.Skill) {
+	b.skills = list
+}
+
+// UseModel fits history into info's context window, leaving room for its
+// output, or for MaxOutputTokens if that is smaller. The oldest messages
+// are dropped first.
+func (b *Builder) UseModel(info provider.ModelInfo) {
+	b.model = info
+}
+
+// MatchSkill returns the skill for userMessage, or nil if none matches.
+func (b *Builder) MatchSkill(userMessage string) *skills.Skill {
+	return skills.Match(b.skills, userMessage)
+}
+
 // BuildMessages constructs the full message list for an LLM call.
-func (b *Builder) BuildMessages(history []provider.Message, summary string, userMessage string) []provider.Message {
-	systemPrompt := b.BuildSystemPrompt(summary)
+func (b *Builder) BuildMessages(ctx context.Context, history []provider.Message, summary string, userMessage string) []provider.Message {
+	var tools []provider.ToolDef
+	if b.registry != nil {
+		tools = b.SelectTools(ctx, userMessage, b.registry.ToToolDefs())
+	}
+	systemPrompt := b.buildSystemPrompt(summary, b.retrieve(ctx, userMessage), b.MatchSkill(userMessage), tools)
+	history = b.fitHistory(history, estimateTokens(systemPrompt)+estimateTokens(userMessage))
 
 	var messages []provider.Message
 	messages = append(messages, provider.Message{Role: "system", Content: systemPrompt})
@@ -61,75 +127,77 @@ func (b *Builder) BuildMessages(history []provider.Message, summary string, user
 
 // BuildSystemPrompt assembles the system prompt from all sources.
 func (b *Builder) BuildSystemPrompt(summary string) string {
-	var parts []string
-
-	// Identity
-	parts = append(parts, b.buildIdentity())
-
-	// Bootstrap files
-	if bootstrap := b.loadBootstrapFiles(); bootstrap != "" {
-		parts = append(parts, bootstrap)
+	var tools []provider.ToolDef
+	if b.registry != nil {
+		tools = b.registry.ToToolDefs()
 	}
+	return b.buildSystemPrompt(summary, "", nil, tools)
+}
 
-	// Tool summaries
-	if toolSummary := b.buildToolSummary(); toolSummary != "" {
-		parts = append(parts, toolSummary)
+func (b *Builder) buildSystemPrompt(summary, documents string, skill *skills.Skill, tools []provider.ToolDef) string {
+	learnings := b.learnings
+	if len(learnings) > b.cfg.LearningsMaxChars {
+		learnings = learnings[:b.cfg.LearningsMaxChars] + "\n\n[... truncated]"
 	}
-
-	// Learnings from eval data
-	if b.learnings != "" {
-		learnings := b.learnings
-		if len(learnings) > b.cfg.LearningsMaxChars {
-			learnings = learnings[:b.cfg.LearningsMaxChars] + "\n\n[... truncated]"
-		}
-		parts = append(parts, learnings)
+	absWorkspace, _ := filepath.Abs(b.workspace)
+	data := PromptData{
+		Identity:  b.cfg.Identity,
+		Time:      time.Now().Format("2006-01-02 15:04 (Monday)"),
+		Runtime:   fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version()),
+		Workspace: absWorkspace,
+		Bootstrap: b.loadBootstrapFiles(),
+		Tree:      b.buildTree(),
+		Learnings: learnings,
+		Documents: documents,
+		Tools:     tools,
+		Summary:   summary,
 	}
-
-	// Conversation summary
-	if summary != "" {
-		parts = append(parts, "## Previous Conversation Summary\n\n"+summary)
+	if skill != nil {
+		data.Skill = fmt.Sprintf("# Skill: %s\n\n%s", skill.Name, skill.Body)
 	}
-
-	return strings.Join(parts, "\n\n---\n\n")
+	return b.renderPrompt(data)
 }
 
-func (b *Builder) buildIdentity() string {
-	now := time.Now().Format("2006-01-02 15:04 (Monday)")
-	absWorkspace, _ := filepath.Abs(b.workspace)
-	return fmt.Sprintf(`# teeny-orchestrator
-
-You are an autonomous AI agent powered by teeny-claw tools.
-
-## Current Time
-%s
-
-## Runtime
-%s %s, Go %s
-
-## Workspace
-%s
+// bootstrapFiles expands the configured bootstrap patterns into workspace
+// file paths, in priority order. Matches of one glob are sorted by name, and
+// a file matched by several patterns is loaded once, at its first position.
+func (b *Builder) bootstrapFiles() []string {
+	patterns := b.cfg.Bootstrap
+	if patterns == nil {
+		patterns = DefaultBootstrap
+	}
 
-## Important Rules
-1. Use tools to perform actions. Do not pretend to execute commands.
-2. Record important decisions and learnings to agent-memory.
-3. When done with a task, mark it complete via todo-mgmt if applicable.`,
-		now, runtime.GOOS, runtime.GOARCH, runtime.Version(), absWorkspace)
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(b.workspace, pattern))
+		if err != nil {
+			log.Printf("[context] bad bootstrap pattern %q: %v", pattern, err)
+			continue
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			rel, err := filepath.Rel(b.workspace, m)
+			if err != nil || seen[rel] {
+				continue
+			}
+			if info, err := os.Stat(m); err != nil || info.IsDir() {
+				continue
+			}
+			seen[rel] = true
+			files = append(files, rel)
+		}
+	}
+	return files
 }
 
 // loadBootstrapFiles reads workspace config files with budget management.
+// Files later in the priority order are truncated or dropped first.
 func (b *Builder) loadBootstrapFiles() string {
-	files := []string{
-		"AGENTS.md",
-		"SOUL.md",
-		"USER.md",
-		"IDENTITY.md",
-		"TOOLS.md",
-	}
-
 	var parts []string
 	totalChars := 0
 
-	for _, filename := range files {
+	for _, filename := range b.bootstrapFiles() {
 		if totalChars >= b.cfg.BootstrapTotalMaxChars {
 			break
 		}
@@ -152,7 +220,7 @@ func (b *Builder) loadBootstrapFiles() string {
 			content = content[:remaining] + "\n\n[... truncated]"
 		}
 
-		parts = append(parts, fmt.Sprintf("## %s\n\n%s", filename, content))
+		parts = append(parts, fmt.Sprintf("## %s\n\n%s", filepath.ToSlash(filename), content))
 		totalChars += len(content)
 	}
 
@@ -162,25 +230,92 @@ func (b *Builder) loadBootstrapFiles() string {
 	return "# Workspace Context\n\n" + strings.Join(parts, "\n\n")
 }
 
-// SetLearnings sets pre-fetched learnings to inject into the system prompt.
-func (b *Builder) SetLearnings(learnings string) {
-	b.learnings = learnings
-}
-
-func (b *Builder) buildToolSummary() string {
-	if b.registry == nil {
+// retrieve formats passages relevant to query, stopping before the token
+// budget is exceeded. Retrieval errors are logged and leave the prompt
+// without documents.
+func (b *Builder) retrieve(ctx context.Context, query string) string {
+	if b.retriever == nil || b.cfg.RetrievalTopK <= 0 || strings.TrimSpace(query) == "" {
 		return ""
 	}
-
-	defs := b.registry.ToToolDefs()
-	if len(defs) == 0 {
+	passages, err := b.retriever.Retrieve(ctx, query, b.cfg.RetrievalTopK)
+	if err != nil {
+		log.Printf("[context] retrieval failed: %v", err)
 		return ""
 	}
 
 	var sb strings.Builder
-	sb.WriteString("## Available Tools\n\nYou MUST use tools to perform actions.\n\n")
-	for _, d := range defs {
-		sb.WriteString(fmt.Sprintf("- **%s**: %s\n", d.Name, d.Description))
+	tokens := 0
+	for _, p := range passages {
+		section := fmt.Sprintf("### %s\n\n%s\n\n", p.Source, strings.TrimSpace(p.Text))
+		n := estimateTokens(section)
+		if b.cfg.RetrievalMaxTokens > 0 && tokens+n > b.cfg.RetrievalMaxTokens {
+			break
+		}
+		sb.WriteString(section)
+		tokens += n
+	}
+	if sb.Len() == 0 {
+		return ""
 	}
-	return sb.String()
+	return "# Relevant Workspace Documents\n\n" + strings.TrimSpace(sb.String())
+}
+
+// fitHistory drops the oldest messages of history beyond the HistoryMessages
+// and HistoryTokens limits, or that don't fit in the model's context window
+// next to used tokens of prompt. It cuts only before a user message, so tool
+// calls stay with their results. The session keeps what is dropped.
+func (b *Builder) fitHistory(history []provider.Message, used int) []provider.Message {
+	cut := 0
+	if n := b.cfg.HistoryMessages; n > 0 && len(history) > n {
+		cut = len(history) - n
+	}
+	budget, limited, window := 0, false, false
+	if b.model.ContextWindow > 0 {
+		reserve := b.model.MaxOutput
+		if t := b.cfg.MaxOutputTokens; t > 0 && (reserve <= 0 || t < reserve) {
+			reserve = t
+		}
+		budget, limited, window = b.model.ContextWindow-reserve-used, true, true
+	}
+	if t := b.cfg.HistoryTokens; t > 0 && (!limited || t < budget) {
+		budget, limited, window = t, true, false
+	}
+	overflowed := false
+	if limited {
+		for i := len(history) - 1; i >= cut; i-- {
+			budget -= messageTokens(history[i])
+			if budget < 0 {
+				cut, overflowed = i+1, true
+				break
+			}
+		}
+	}
+	for cut < len(history) && history[cut].Role != "user" {
+		cut++
+	}
+	// The configured limits apply every turn; only the window is worth a log
+	if window && overflowed {
+		log.Printf("[context] dropped %d of %d history messages to fit the %d-token context window",
+			cut, len(history), b.model.ContextWindow)
+	}
+	return history[cut:]
+}
+
+// messageTokens estimates the tokens of a message's text and tool calls.
+func messageTokens(m provider.Message) int {
+	n := estimateTokens(m.Content)
+	for _, tc := range m.ToolCalls {
+		n += estimateTokens(tc.Name) + estimateTokens(tc.Arguments)
+	}
+	return n
+}
+
+// estimateTokens approximates a token count at four characters per token.
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// SetLearnings sets pre-fetched learnings to inject into the system prompt.
+func (b *Builder) SetLearnings(learnings string) {
+	b.learnings = learnings
 }
@@ -1,6 +1,8 @@
 package context
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -18,7 +20,7 @@ func TestBuildMessagesStructure(t *testing.T) {
 		{Role: "user", Content: "prev"},
 		{Role: "assistant", Content: "prev-reply"},
 	}
-	msgs := b.BuildMessages(history, "", "hello")
+	msgs := b.BuildMessages(t.Context(), history, "", "hello")
 
 	if len(msgs) != 4 { // system + 2 history + user
 		t.Fatalf("expected 4 messages, got %d", len(msgs))
@@ -54,6 +56,56 @@ func TestBootstrapFileLoading(t *testing.T) {
 	}
 }
 
+func TestBootstrapGlobs(t *testing.T) {
+	workspace := t.TempDir()
+	os.MkdirAll(filepath.Join(workspace, "docs", "guides"), 0755)
+	os.MkdirAll(filepath.Join(workspace, ".agent"), 0755)
+	os.WriteFile(filepath.Join(workspace, "AGENTS.md"), []byte("agents file"), 0644)
+	os.WriteFile(filepath.Join(workspace, "docs", "b.md"), []byte("docs b"), 0644)
+	os.WriteFile(filepath.Join(workspace, "docs", "a.md"), []byte("docs a"), 0644)
+	os.WriteFile(filepath.Join(workspace, "docs", "guides", "deep.md"), []byte("too deep"), 0644)
+	os.WriteFile(filepath.Join(workspace, ".agent", "rules.md"), []byte("agent rules"), 0644)
+
+	cfg := DefaultConfig()
+	cfg.Bootstrap = []string{".agent/*.md", "docs/*.md", "docs/a.md", "[", "missing.md"}
+	prompt := NewBuilder(workspace, cfg, nil).BuildSystemPrompt("")
+
+	var order []int
+	for _, s := range []string{"## .agent/rules.md", "## docs/a.md", "## docs/b.md"} {
+		i := strings.Index(prompt, s)
+		if i < 0 {
+			t.Fatalf("%q missing from prompt:\n%s", s, prompt)
+		}
+		order = append(order, i)
+	}
+	if !(order[0] < order[1] && order[1] < order[2]) {
+		t.Errorf("files out of priority order: %v", order)
+	}
+	if strings.Count(prompt, "docs a") != 1 {
+		t.Error("file matched twice should be loaded once")
+	}
+	if strings.Contains(prompt, "agents file") || strings.Contains(prompt, "too deep") {
+		t.Error("unlisted files loaded")
+	}
+}
+
+func TestBootstrapPriorityBudget(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "low.md"), []byte(strings.Repeat("l", 80)), 0644)
+	os.WriteFile(filepath.Join(workspace, "high.md"), []byte(strings.Repeat("h", 80)), 0644)
+
+	cfg := DefaultConfig()
+	cfg.Bootstrap = []string{"high.md", "low.md"}
+	cfg.BootstrapTotalMaxChars = 100
+	prompt := NewBuilder(workspace, cfg, nil).BuildSystemPrompt("")
+	if !strings.Contains(prompt, strings.Repeat("h", 80)) {
+		t.Error("high-priority file should be loaded whole")
+	}
+	if strings.Contains(prompt, strings.Repeat("l", 21)) {
+		t.Error("low-priority file should be cut to the remaining budget")
+	}
+}
+
 func TestBootstrapFileTruncation(t *testing.T) {
 	workspace := t.TempDir()
 	bigContent := strings.Repeat("x", 30000)
@@ -125,3 +177,143 @@ func TestNoBootstrapFiles(t *testing.T) {
 		t.Fatal("identity missing")
 	}
 }
+
+func TestIdentityOverride(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Identity = "You are a pirate."
+	b := NewBuilder(t.TempDir(), cfg, nil)
+	prompt := b.BuildSystemPrompt("")
+	if !strings.HasPrefix(prompt, "You are a pirate.") {
+		t.Fatalf("identity override not applied: %q", prompt)
+	}
+	if strings.Contains(prompt, "# teeny-orchestrator") {
+		t.Fatal("built-in identity should be replaced")
+	}
+}
+
+type stubRetriever struct {
+	passages []Passage
+	err      error
+	query    string
+}
+
+func (r *stubRetriever) Retrieve(_ context.Context, query string, limit int) ([]Passage, error) {
+	r.query = query
+	return r.passages[:min(limit, len(r.passages))], r.err
+}
+
+func TestRetrievedDocuments(t *testing.T) {
+	r := &stubRetriever{passages: []Passage{
+		{Source: "docs/deploy.md:1-3", Text: "Deploy with make ship."},
+		{Source: "docs/big.md:1-90", Text: strings.Repeat("filler ", 100)},
+		{Source: "docs/small.md:4-5", Text: "Never reached."},
+	}}
+	cfg := DefaultConfig()
+	cfg.RetrievalMaxTokens = 50
+	b := NewBuilder(t.TempDir(), cfg, nil)
+	b.UseRetriever(r)
+
+	msgs := b.BuildMessages(t.Context(), nil, "", "how do I deploy?")
+	system := msgs[0].Content
+	if r.query != "how do I deploy?" {
+		t.Errorf("retriever query = %q", r.query)
+	}
+	if !strings.Contains(system, "### docs/deploy.md:1-3\n\nDeploy with make ship.") {
+		t.Errorf("passage missing from system prompt:\n%s", system)
+	}
+	// The second passage would exceed the budget; later ones are not used.
+	if strings.Contains(system, "filler") || strings.Contains(system, "Never reached") {
+		t.Error("passages beyond the token budget were included")
+	}
+	if strings.Contains(b.BuildSystemPrompt(""), "Deploy with make ship") {
+		t.Error("BuildSystemPrompt should not retrieve")
+	}
+
+	r.err = errors.New("index unavailable")
+	msgs = b.BuildMessages(t.Context(), nil, "", "how do I deploy?")
+	if strings.Contains(msgs[0].Content, "Relevant Workspace Documents") {
+		t.Error("documents section present after retrieval error")
+	}
+}
+
+func TestBuildMessagesFitsContextWindow(t *testing.T) {
+	b := NewBuilder(t.TempDir(), DefaultConfig(), nil)
+	prompt := estimateTokens(b.BuildSystemPrompt("")) + estimateTokens("now")
+	turn := strings.Repeat("x", 400) // 100 tokens
+	history := []provider.Message{
+		{Role: "user", Content: turn},
+		{Role: "assistant", ToolCalls: []provider.ToolCall{{ID: "1", Name: "echo.run", Arguments: turn}}},
+		{Role: "tool", ToolCallID: "1", Content: turn},
+		{Role: "assistant", Content: turn},
+		{Role: "user", Content: turn},
+		{Role: "assistant", Content: turn},
+	}
+	// Room for the last four messages, but the cut moves forward to the
+	// next user message so the tool result isn't orphaned.
+	b.UseModel(provider.ModelInfo{ContextWindow: prompt + 1000 + 450, MaxOutput: 1000})
+	msgs := b.BuildMessages(t.Context(), history, "", "now")
+	if len(msgs) != 4 || msgs[1].Role != "user" || msgs[2].Role != "assistant" {
+		t.Errorf("got %d messages: %+v", len(msgs), msgs)
+	}
+
+	// A smaller configured max_tokens leaves more room for history.
+	cfg := DefaultConfig()
+	cfg.MaxOutputTokens = 550
+	b = NewBuilder(b.workspace, cfg, nil)
+	b.UseModel(provider.ModelInfo{ContextWindow: prompt + 1000 + 450, MaxOutput: 1000})
+	if msgs := b.BuildMessages(t.Context(), history, "", "now"); len(msgs) != 8 {
+		t.Errorf("with max_tokens 550: %d messages, want 8", len(msgs))
+	}
+
+	b.UseModel(provider.ModelInfo{})
+	if msgs := b.BuildMessages(t.Context(), history, "", "now"); len(msgs) != 8 {
+		t.Errorf("without a window: %d messages, want 8", len(msgs))
+	}
+}
+
+func TestBuildMessagesHistoryLimits(t *testing.T) {
+	turn := strings.Repeat("x", 400) // 100 tokens
+	history := []provider.Message{
+		{Role: "user", Content: "1" + turn},
+		{Role: "assistant", Content: turn},
+		{Role: "user", Content: "2" + turn},
+		{Role: "assistant", ToolCalls: []provider.ToolCall{{ID: "1", Name: "echo.run", Arguments: turn}}},
+		{Role: "tool", ToolCallID: "1", Content: turn},
+		{Role: "assistant", Content: turn},
+		{Role: "user", Content: "3" + turn},
+		{Role: "assistant", Content: turn},
+	}
+	tests := []struct {
+		name     string
+		messages int
+		tokens   int
+		window   int
+		want     int // History messages kept
+	}{
+		{"no limits", 0, 0, 0, 8},
+		{"last messages", 2, 0, 0, 2},
+		{"cut moves to a user message", 4, 0, 0, 2},
+		{"token budget", 0, 450, 0, 2},
+		{"both limits", 6, 350, 0, 2},
+		{"window tighter than tokens", 0, 10000, 250, 2},
+		{"tokens tighter than window", 0, 250, 100000, 2},
+		{"everything", 8, 10000, 0, 8},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.HistoryMessages, cfg.HistoryTokens = tt.messages, tt.tokens
+		b := NewBuilder(t.TempDir(), cfg, nil)
+		if tt.window > 0 {
+			prompt := estimateTokens(b.BuildSystemPrompt("")) + estimateTokens("now")
+			b.UseModel(provider.ModelInfo{ContextWindow: prompt + tt.window})
+		}
+		msgs := b.BuildMessages(t.Context(), history, "", "now")
+		if got := len(msgs) - 2; got != tt.want {
+			t.Errorf("%s: kept %d history messages, want %d", tt.name, got, tt.want)
+			continue
+		}
+		if tt.want > 0 && msgs[1].Role != "user" {
+			t.Errorf("%s: history starts with a %s message", tt.name, msgs[1].Role)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package context
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// PromptTemplateFile is the workspace file that, if present, replaces the
+// built-in system prompt template.
+const PromptTemplateFile = "PROMPT.tmpl"
+
+// PromptData is what the system prompt template is executed with.
+type PromptData struct {
+	Identity  string             // Config.Identity (the --system flag); empty for the built-in identity
+	Time      string             // e.g. "2025-06-02 15:04 (Monday)"
+	Runtime   string             // e.g. "linux amd64, Go go1.25.0"
+	Workspace string             // Absolute workspace path
+	Tools     []provider.ToolDef // Registered tools
+	Bootstrap string             // "# Workspace Context" section from bootstrap files
+	Tree      string             // "# Workspace Files" section listing the workspace
+	Skill     string             // Guidance from the skill matching the current message
+	Learnings string             // Injected learnings, already truncated
+	Documents string             // Passages retrieved for the current message
+	Summary   string             // Summary of earlier conversation
+}
+
+// DefaultPromptTemplate assembles the built-in system prompt. Sections are
+// separated by horizontal rules and left out when empty.
+const DefaultPromptTemplate = `{{if .Identity}}{{.Identity}}{{else}}# teeny-orchestrator
+
+You are an autonomous AI agent powered by teeny-claw tools.
+
+## Current Time
+{{.Time}}
+
+## Runtime
+{{.Runtime}}
+
+## Workspace
+{{.Workspace}}
+
+## Important Rules
+1. Use tools to perform actions. Do not pretend to execute commands.
+2. Record important decisions and learnings to agent-memory.
+3. When done with a task, mark it complete via todo-mgmt if applicable.{{end}}
+{{- with .Bootstrap}}
+
+---
+
+{{.}}{{end}}
+{{- with .Tree}}
+
+---
+
+{{.}}{{end}}
+{{- with .Tools}}
+
+---
+
+## Available Tools
+
+You MUST use tools to perform actions.
+
+{{range .}}- **{{.Name}}**: {{.Description}}
+{{end}}{{end}}
+{{- with .Skill}}
+
+---
+
+{{.}}{{end}}
+{{- with .Learnings}}
+
+---
+
+{{.}}{{end}}
+{{- with .Documents}}
+
+---
+
+{{.}}{{end}}
+{{- with .Summary}}
+
+---
+
+## Previous Conversation Summary
+
+{{.}}{{end}}`
+
+var defaultPrompt = template.Must(template.New("prompt").Parse(DefaultPromptTemplate))
+
+// renderPrompt executes the workspace's PROMPT.tmpl, or the built-in
+// template if there is none. A template that fails to parse or execute is
+// logged and the built-in one is used instead.
+func (b *Builder) renderPrompt(data PromptData) string {
+	tmpl, err := b.loadPromptTemplate()
+	if err != nil {
+		log.Printf("[context] %v; using the built-in prompt", err)
+	}
+	var sb strings.Builder
+	if tmpl != nil {
+		err := tmpl.Execute(&sb, data)
+		if err == nil {
+			return sb.String()
+		}
+		log.Printf("[context] execute %s: %v; using the built-in prompt", PromptTemplateFile, err)
+		sb.Reset()
+	}
+	defaultPrompt.Execute(&sb, data)
+	return sb.String()
+}
+
+// loadPromptTemplate parses the workspace's PROMPT.tmpl. It returns nil if
+// the file does not exist.
+func (b *Builder) loadPromptTemplate() (*template.Template, error) {
+	data, err := os.ReadFile(filepath.Join(b.workspace, PromptTemplateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", PromptTemplateFile, err)
+	}
+	tmpl, err := template.New(PromptTemplateFile).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", PromptTemplateFile, err)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,90 @@
+package context
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/skills"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func TestWorkspacePromptTemplate(t *testing.T) {
+	workspace := t.TempDir()
+	tmpl := `You are a release bot in {{.Workspace}} at {{.Time}}.
+Tools:{{range .Tools}} {{.Name}}{{end}}
+{{with .Learnings}}Remember: {{.}}{{end}}
+{{with .Summary}}So far: {{.}}{{end}}`
+	os.WriteFile(filepath.Join(workspace, PromptTemplateFile), []byte(tmpl), 0644)
+
+	reg := toolreg.NewRegistry(0)
+	reg.Register(&toolreg.ToolManifest{
+		Name:     "git",
+		Binary:   "git",
+		Commands: map[string]toolreg.CommandDef{"status": {Description: "show status"}},
+	})
+	b := NewBuilder(workspace, DefaultConfig(), reg)
+	b.SetLearnings("tag before pushing")
+	prompt := b.BuildSystemPrompt("shipped v1")
+
+	abs, _ := filepath.Abs(workspace)
+	for _, want := range []string{
+		"You are a release bot in " + abs,
+		"Tools: git.status",
+		"Remember: tag before pushing",
+		"So far: shipped v1",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt missing %q:\n%s", want, prompt)
+		}
+	}
+	if strings.Contains(prompt, "# teeny-orchestrator") {
+		t.Error("built-in identity should be replaced by the template")
+	}
+}
+
+func TestSkillSection(t *testing.T) {
+	reg := toolreg.NewRegistry(0)
+	for _, name := range []string{"git", "shell"} {
+		reg.Register(&toolreg.ToolManifest{
+			Name:     name,
+			Binary:   name,
+			Commands: map[string]toolreg.CommandDef{"run": {Description: "run " + name}},
+		})
+	}
+	b := NewBuilder(t.TempDir(), DefaultConfig(), reg)
+	b.UseSkills([]*skills.Skill{{Name: "release", Triggers: []string{"release"}, Body: "Bump, then tag.", Tools: []string{"git.*"}}})
+
+	prompt := b.BuildMessages(t.Context(), nil, "", "cut a release")[0].Content
+	if !strings.Contains(prompt, "# Skill: release\n\nBump, then tag.") {
+		t.Errorf("skill section missing:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "shell.run") || !strings.Contains(prompt, "git.run") {
+		t.Error("tool summary should follow the skill allowlist")
+	}
+
+	prompt = b.BuildMessages(t.Context(), nil, "", "hello")[0].Content
+	if strings.Contains(prompt, "# Skill:") || !strings.Contains(prompt, "shell.run") {
+		t.Error("unmatched message should get the base prompt")
+	}
+}
+
+func TestBrokenPromptTemplateFallsBack(t *testing.T) {
+	tests := []struct {
+		name, tmpl string
+	}{
+		{"parse error", "{{if .Time}}unclosed"},
+		{"unknown field", "{{.Nope}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			os.WriteFile(filepath.Join(workspace, PromptTemplateFile), []byte(tt.tmpl), 0644)
+			prompt := NewBuilder(workspace, DefaultConfig(), nil).BuildSystemPrompt("")
+			if !strings.HasPrefix(prompt, "# teeny-orchestrator") {
+				t.Errorf("expected built-in prompt, got %q", prompt)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package context
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// ToolRanker scores tools by relevance to a user message. Higher is more
+// relevant; scores are only compared with each other.
+type ToolRanker interface {
+	Rank(ctx context.Context, message string, defs []provider.ToolDef) ([]float64, error)
+}
+
+// UseToolRanker sets how tools are ranked when Config.MaxTools is set. The
+// default is KeywordRanker.
+func (b *Builder) UseToolRanker(r ToolRanker) {
+	b.ranker = r
+}
+
+// SelectTools narrows defs to the tools permitted by the profile in ctx
+// (see toolreg.WithProfile), then to those allowed by the skill matching
+// userMessage and, when Config.MaxTools is set, to the MaxTools most
+// relevant to it. The result keeps the order of defs.
+func (b *Builder) SelectTools(ctx context.Context, userMessage string, defs []provider.ToolDef) []provider.ToolDef {
+	if b.registry != nil && toolreg.ProfileFrom(ctx) != nil {
+		var permitted []provider.ToolDef
+		for _, d := range defs {
+			if b.registry.Permitted(ctx, d.Name) == nil {
+				permitted = append(permitted, d)
+			}
+		}
+		defs = permitted
+	}
+	defs = b.MatchSkill(userMessage).FilterTools(defs)
+	if b.cfg.MaxTools <= 0 || len(defs) <= b.cfg.MaxTools {
+		return defs
+	}
+
+	var ranker ToolRanker = KeywordRanker{}
+	if b.ranker != nil {
+		ranker = b.ranker
+	}
+	scores, err := ranker.Rank(ctx, userMessage, defs)
+	if err != nil {
+		log.Printf("[context] tool ranking failed, using keywords: %v", err)
+		scores, _ = KeywordRanker{}.Rank(ctx, userMessage, defs)
+	}
+
+	order := make([]int, len(defs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	keep := order[:b.cfg.MaxTools]
+	sort.Ints(keep)
+
+	out := make([]provider.ToolDef, len(keep))
+	for i, idx := range keep {
+		out[i] = defs[idx]
+	}
+	return out
+}
+
+// KeywordRanker scores a tool by the message words found in its name
+// (weighted double) and description.
+type KeywordRanker struct{}
+
+func (KeywordRanker) Rank(_ context.Context, message string, defs []provider.ToolDef) ([]float64, error) {
+	words := keywords(message)
+	scores := make([]float64, len(defs))
+	for i, d := range defs {
+		name, desc := keywords(d.Name), keywords(d.Description)
+		for w := range words {
+			if name[w] {
+				scores[i] += 2
+			}
+			if desc[w] {
+				scores[i]++
+			}
+		}
+	}
+	return scores, nil
+}
+
+// stopwords are too common to signal relevance.
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "then": true, "than": true,
+	"that": true, "this": true, "what": true, "from": true, "into": true, "are": true,
+	"was": true, "you": true, "your": true, "can": true, "how": true, "please": true,
+}
+
+// keywords returns the distinct lowercase words of text, ignoring
+// stopwords, words under three letters, and a trailing plural "s".
+func keywords(text string) map[string]bool {
+	out := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(w) > 3 {
+			w = strings.TrimSuffix(w, "s")
+		}
+		if len(w) >= 3 && !stopwords[w] {
+			out[w] = true
+		}
+	}
+	return out
+}
+
+// EmbeddingRanker scores tools by cosine similarity between the message and
+// each tool's name and description. Tool vectors are cached, as is the
+// last message's, since the prompt and the request rank the same message.
+type EmbeddingRanker struct {
+	embedder provider.Embedder
+
+	mu       sync.Mutex
+	cache    map[string][]float32 // Tool text → vector
+	query    string
+	queryVec []float32
+}
+
+// NewEmbeddingRanker creates a ranker that uses e.
+func NewEmbeddingRanker(e provider.Embedder) *EmbeddingRanker {
+	return &EmbeddingRanker{embedder: e, cache: make(map[string][]float32)}
+}
+
+func (r *EmbeddingRanker) Rank(ctx context.Context, message string, defs []provider.ToolDef) ([]float64, error) {
+	texts := make([]string, len(defs))
+	for i, d := range defs {
+		texts[i] = d.Name + ": " + d.Description
+	}
+
+	// Embed the message and any tools not seen before in one request.
+	r.mu.Lock()
+	var batch []string
+	qv := r.queryVec
+	if message != r.query || qv == nil {
+		batch = append(batch, message)
+	}
+	newQuery := len(batch)
+	for _, t := range texts {
+		if _, ok := r.cache[t]; !ok && !slices.Contains(batch[newQuery:], t) {
+			batch = append(batch, t)
+		}
+	}
+	r.mu.Unlock()
+
+	var vecs [][]float32
+	if len(batch) > 0 {
+		var err error
+		if vecs, err = r.embedder.Embed(ctx, batch); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if newQuery == 1 {
+		qv = vecs[0]
+		r.query, r.queryVec = message, qv
+	}
+	for i, t := range batch[newQuery:] {
+		r.cache[t] = vecs[newQuery+i]
+	}
+	scores := make([]float64, len(defs))
+	for i, t := range texts {
+		scores[i] = provider.Cosine(qv, r.cache[t])
+	}
+	return scores, nil
+}
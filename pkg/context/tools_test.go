@@ -0,0 +1,125 @@
+package context
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/skills"
+)
+
+var testTools = []provider.ToolDef{
+	{Name: "calendar.list", Description: "List upcoming calendar events"},
+	{Name: "git.commit", Description: "Record changes to the repository"},
+	{Name: "git.status", Description: "Show the working tree status"},
+	{Name: "mail.send", Description: "Send an email message"},
+	{Name: "weather.get", Description: "Get the weather forecast for a city"},
+}
+
+func toolNames(defs []provider.ToolDef) string {
+	var names []string
+	for _, d := range defs {
+		names = append(names, d.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestSelectTools_Keyword(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxTools = 2
+	b := NewBuilder(t.TempDir(), cfg, nil)
+
+	tests := []struct {
+		message, want string
+	}{
+		{"commit my changes, then check the status", "git.commit,git.status"},
+		{"what's the weather in Paris? then email it to me", "mail.send,weather.get"},
+		{"send the calendar events", "calendar.list,mail.send"},
+		{"hello", "calendar.list,git.commit"}, // No signal: registry order
+	}
+	for _, tt := range tests {
+		if got := toolNames(b.SelectTools(t.Context(), tt.message, testTools)); got != tt.want {
+			t.Errorf("SelectTools(%q) = %s, want %s", tt.message, got, tt.want)
+		}
+	}
+
+	cfg.MaxTools = 0
+	if got := NewBuilder(t.TempDir(), cfg, nil).SelectTools(t.Context(), "hello", testTools); len(got) != len(testTools) {
+		t.Errorf("MaxTools 0 should keep all tools, got %d", len(got))
+	}
+}
+
+func TestSelectTools_SkillFirst(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxTools = 1
+	b := NewBuilder(t.TempDir(), cfg, nil)
+	b.UseSkills([]*skills.Skill{{Name: "release", Tools: []string{"git.*"}, Body: "Tag it."}})
+	if got := toolNames(b.SelectTools(t.Context(), "/release and email everyone", testTools)); got != "git.commit" {
+		t.Errorf("SelectTools = %s, want a git tool only", got)
+	}
+}
+
+// axisEmbedder maps texts containing a keyword onto that keyword's axis.
+type axisEmbedder struct {
+	axes  []string
+	calls int
+	fail  bool
+}
+
+func (e *axisEmbedder) Model() string { return "fake:axes" }
+
+func (e *axisEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	if e.fail {
+		return nil, errors.New("down")
+	}
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		v := make([]float32, len(e.axes)+1)
+		v[len(e.axes)] = 0.1 // Keeps unrelated texts non-zero
+		for a, word := range e.axes {
+			if strings.Contains(strings.ToLower(t), word) {
+				v[a] = 1
+			}
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func TestSelectTools_Embedding(t *testing.T) {
+	// "umbrella" shares no words with any tool; only the embedding links it
+	// to the weather tool.
+	e := &axisEmbedder{axes: []string{"umbrella"}}
+	cfg := DefaultConfig()
+	cfg.MaxTools = 1
+	b := NewBuilder(t.TempDir(), cfg, nil)
+	tools := append([]provider.ToolDef(nil), testTools...)
+	tools[4].Description += " (umbrella advice)"
+	b.UseToolRanker(NewEmbeddingRanker(e))
+
+	if got := toolNames(b.SelectTools(t.Context(), "do I need an umbrella?", tools)); got != "weather.get" {
+		t.Errorf("SelectTools = %s, want weather.get", got)
+	}
+	b.SelectTools(t.Context(), "do I need an umbrella?", tools)
+	if e.calls != 1 {
+		t.Errorf("embed calls = %d; tool and query vectors should be cached", e.calls)
+	}
+
+	e.fail = true
+	if got := toolNames(b.SelectTools(t.Context(), "send an email", tools)); got != "mail.send" {
+		t.Errorf("fallback SelectTools = %s, want mail.send", got)
+	}
+}
+
+func TestToolSummaryFollowsSelection(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxTools = 1
+	b := NewBuilder(t.TempDir(), cfg, nil)
+	prompt := b.buildSystemPrompt("", "", nil, b.SelectTools(t.Context(), "check git status", testTools))
+	if !strings.Contains(prompt, "git.status") || strings.Contains(prompt, "mail.send") {
+		t.Errorf("tool summary should list only selected tools:\n%s", prompt)
+	}
+}
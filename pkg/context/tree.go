@@ -0,0 +1,179 @@
+package context
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// treeNode is a workspace entry chosen for the tree section.
+type treeNode struct {
+	name     string
+	dir      bool
+	children []*treeNode
+}
+
+// buildTree lists the workspace breadth-first, so a low entry limit still
+// shows every top-level entry before any nested ones. Paths matched by the
+// workspace .gitignore, and .git itself, are left out.
+func (b *Builder) buildTree() string {
+	if b.cfg.TreeDepth <= 0 {
+		return ""
+	}
+	rules := loadGitignore(filepath.Join(b.workspace, ".gitignore"))
+
+	type pending struct {
+		node  *treeNode
+		rel   string
+		depth int
+	}
+	root := &treeNode{dir: true}
+	queue := []pending{{root, "", 0}}
+	count, truncated := 0, false
+	for len(queue) > 0 && !truncated {
+		p := queue[0]
+		queue = queue[1:]
+		entries, err := os.ReadDir(filepath.Join(b.workspace, p.rel))
+		if err != nil {
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].IsDir() != entries[j].IsDir() {
+				return entries[i].IsDir()
+			}
+			return entries[i].Name() < entries[j].Name()
+		})
+		for _, e := range entries {
+			rel := path.Join(p.rel, e.Name())
+			if e.Name() == ".git" || rules.ignored(rel, e.IsDir()) {
+				continue
+			}
+			if b.cfg.TreeMaxEntries > 0 && count >= b.cfg.TreeMaxEntries {
+				truncated = true
+				break
+			}
+			n := &treeNode{name: e.Name(), dir: e.IsDir()}
+			p.node.children = append(p.node.children, n)
+			count++
+			if n.dir && p.depth+1 < b.cfg.TreeDepth {
+				queue = append(queue, pending{n, rel, p.depth + 1})
+			}
+		}
+	}
+	if count == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Workspace Files\n\n```\n")
+	var render func(n *treeNode, indent string)
+	render = func(n *treeNode, indent string) {
+		for _, c := range n.children {
+			sb.WriteString(indent + c.name)
+			if c.dir {
+				sb.WriteString("/")
+			}
+			sb.WriteString("\n")
+			render(c, indent+"  ")
+		}
+	}
+	render(root, "")
+	sb.WriteString("```")
+	if truncated {
+		fmt.Fprintf(&sb, "\n\n[... truncated at %d entries]", b.cfg.TreeMaxEntries)
+	}
+	return sb.String()
+}
+
+// ignoreRule is one .gitignore pattern.
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // Contains a slash, so it matches from the workspace root
+}
+
+type ignoreRules []ignoreRule
+
+// loadGitignore parses a .gitignore file. A missing file yields no rules.
+func loadGitignore(file string) ignoreRules {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules ignoreRules
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var r ignoreRule
+		if r.negate = strings.HasPrefix(line, "!"); r.negate {
+			line = line[1:]
+		}
+		if r.dirOnly = strings.HasSuffix(line, "/"); r.dirOnly {
+			line = strings.TrimSuffix(line, "/")
+		}
+		r.anchored = strings.Contains(line, "/")
+		r.pattern = strings.TrimPrefix(line, "/")
+		if r.pattern != "" {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// ignored reports whether rel is ignored. As in git, the last matching
+// rule decides.
+func (rules ignoreRules) ignored(rel string, dir bool) bool {
+	ignored := false
+	for _, r := range rules {
+		if r.dirOnly && !dir {
+			continue
+		}
+		var match bool
+		if r.anchored {
+			match = matchAnchored(r.pattern, rel)
+		} else {
+			match, _ = path.Match(r.pattern, path.Base(rel))
+		}
+		if match {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// matchAnchored matches a root-relative pattern, where a leading "**/"
+// matches at any depth and a trailing "/**" matches everything inside.
+func matchAnchored(pattern, rel string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if matchAnchored(prefix, dir) {
+				return true
+			}
+		}
+		return false
+	}
+	if rest, ok := strings.CutPrefix(pattern, "**/"); ok {
+		for {
+			if ok, _ := path.Match(rest, rel); ok {
+				return true
+			}
+			i := strings.IndexByte(rel, '/')
+			if i < 0 {
+				return false
+			}
+			rel = rel[i+1:]
+		}
+	}
+	ok, _ := path.Match(pattern, rel)
+	return ok
+}
@@ -0,0 +1,96 @@
+package context
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func makeTree(t *testing.T, files ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(root, f)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestBuildTree(t *testing.T) {
+	root := makeTree(t,
+		"README.md", "go.mod", "cmd/teeny/main.go", "pkg/a/deep/x.go", "pkg/a/a.go",
+		".git/HEAD", "bin/teeny", "debug.log", "logs/keep.log", "node_modules/x/index.js",
+	)
+	os.WriteFile(filepath.Join(root, ".gitignore"), []byte("# build output\n/bin/\n*.log\n!keep.log\nnode_modules/\n"), 0644)
+
+	cfg := DefaultConfig()
+	b := NewBuilder(root, cfg, nil)
+	want := "# Workspace Files\n\n```\n" +
+		"cmd/\n  teeny/\n    main.go\n" +
+		"logs/\n  keep.log\n" +
+		"pkg/\n  a/\n    deep/\n    a.go\n" +
+		".gitignore\nREADME.md\ngo.mod\n```"
+	if got := b.buildTree(); got != want {
+		t.Errorf("tree =\n%s\nwant\n%s", got, want)
+	}
+	if !strings.Contains(b.BuildSystemPrompt(""), "# Workspace Files") {
+		t.Error("tree missing from system prompt")
+	}
+
+	cfg.TreeDepth = 0
+	if got := NewBuilder(root, cfg, nil).buildTree(); got != "" {
+		t.Errorf("tree with depth 0 = %q", got)
+	}
+}
+
+func TestBuildTree_EntryLimit(t *testing.T) {
+	root := makeTree(t, "a/1.txt", "a/2.txt", "b/1.txt", "c.txt")
+	cfg := DefaultConfig()
+	cfg.TreeMaxEntries = 4
+	got := NewBuilder(root, cfg, nil).buildTree()
+	// Breadth-first: every top-level entry is listed before nested ones.
+	if !strings.Contains(got, "a/\n  1.txt\nb/\nc.txt\n") || strings.Contains(got, "2.txt") {
+		t.Errorf("tree =\n%s", got)
+	}
+	if !strings.HasSuffix(got, "[... truncated at 4 entries]") {
+		t.Errorf("missing truncation marker:\n%s", got)
+	}
+
+	if got := NewBuilder(t.TempDir(), DefaultConfig(), nil).buildTree(); got != "" {
+		t.Errorf("empty workspace tree = %q", got)
+	}
+}
+
+func TestGitignoreRules(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, ".gitignore")
+	os.WriteFile(file, []byte("build/\n/docs/*.pdf\n**/tmp\nout/**\n*.o\n!main.o\n"), 0644)
+	rules := loadGitignore(file)
+
+	tests := []struct {
+		rel  string
+		dir  bool
+		want bool
+	}{
+		{"build", true, true},
+		{"build", false, false}, // Directory-only rule
+		{"src/build", true, true},
+		{"docs/a.pdf", false, true},
+		{"src/docs/a.pdf", false, false}, // Anchored to the root
+		{"tmp", true, true},
+		{"a/b/tmp", false, true},
+		{"out", true, false}, // "out/**" matches inside only
+		{"out/x", false, true},
+		{"lib/x.o", false, true},
+		{"main.o", false, false}, // Negated
+	}
+	for _, tt := range tests {
+		if got := rules.ignored(tt.rel, tt.dir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.rel, tt.dir, got, tt.want)
+		}
+	}
+}
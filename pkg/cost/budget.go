@@ -0,0 +1,224 @@
+package cost
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// Budget caps spend over a rolling window.
+type Budget struct {
+	Name   string        // Shown in errors, e.g. "daily"
+	Limit  float64       // USD
+	Window time.Duration // e.g. 24h for a daily budget
+}
+
+// ExceededError is returned by Tracker.Check when a budget is spent.
+type ExceededError struct {
+	Budget Budget
+	Spent  float64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("cost: %s budget of $%.2f exceeded ($%.2f spent in the last %s)",
+		e.Budget.Name, e.Budget.Limit, e.Spent, e.Budget.Window)
+}
+
+// spend is one ledger entry.
+type spend struct {
+	Time time.Time `json:"time"`
+	USD  float64   `json:"usd"`
+}
+
+// Tracker records spend and enforces budgets across all sessions. With a
+// ledger file, spend is shared by every process using the same file, so
+// the daemon and CLI runs draw from one budget.
+type Tracker struct {
+	mu        sync.Mutex
+	path      string  // JSON Lines ledger; "" keeps spend in memory
+	entries   []spend // In-memory ledger when path is ""
+	budgets   []Budget
+	onExceed  func(*ExceededError)
+	notified  map[string]time.Time // Budget name -> when it was last reported
+	now       func() time.Time
+	maxWindow time.Duration
+}
+
+// NewTracker enforces budgets, keeping the ledger in path ("" for memory
+// only) and creating parent directories.
+func NewTracker(path string, budgets ...Budget) (*Tracker, error) {
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("cost: ledger dir: %w", err)
+		}
+	}
+	t := &Tracker{path: path, budgets: budgets, notified: make(map[string]time.Time), now: time.Now}
+	for _, b := range budgets {
+		t.maxWindow = max(t.maxWindow, b.Window)
+	}
+	return t, nil
+}
+
+// OnExceeded sets fn to be called when a budget is first found exceeded,
+// at most once per budget window.
+func (t *Tracker) OnExceeded(fn func(*ExceededError)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onExceed = fn
+}
+
+// Record adds usd to the ledger.
+func (t *Tracker) Record(usd float64) error {
+	if t == nil || usd <= 0 {
+		return nil
+	}
+	e := spend{Time: t.now(), USD: usd}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.path == "" {
+		t.entries = append(t.entries, e)
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(t.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("cost: ledger: %w", err)
+	}
+	_, err = file.Write(append(line, '\n'))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Spent returns the USD recorded in the last window.
+func (t *Tracker) Spent(window time.Duration) (float64, error) {
+	if t == nil {
+		return 0, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries, err := t.load(window)
+	if err != nil {
+		return 0, err
+	}
+	return sum(entries, t.now().Add(-window)), nil
+}
+
+// Check returns an *ExceededError for the first budget whose window spend
+// has reached its limit, and nil if all budgets have room. Ledger read
+// errors are returned as-is.
+func (t *Tracker) Check() error {
+	if t == nil || len(t.budgets) == 0 {
+		return nil
+	}
+	t.mu.Lock()
+	entries, err := t.load(t.maxWindow)
+	if err != nil {
+		t.mu.Unlock()
+		return err
+	}
+	now := t.now()
+	var exceeded *ExceededError
+	for _, b := range t.budgets {
+		if spent := sum(entries, now.Add(-b.Window)); spent >= b.Limit {
+			exceeded = &ExceededError{Budget: b, Spent: spent}
+			break
+		}
+	}
+	var notify func(*ExceededError)
+	if exceeded != nil {
+		last, seen := t.notified[exceeded.Budget.Name]
+		if !seen || now.Sub(last) >= exceeded.Budget.Window {
+			t.notified[exceeded.Budget.Name] = now
+			notify = t.onExceed
+		}
+	}
+	t.mu.Unlock()
+
+	if exceeded == nil {
+		return nil
+	}
+	if notify != nil {
+		notify(exceeded)
+	}
+	return exceeded
+}
+
+// load returns ledger entries from the last window. Callers hold t.mu.
+func (t *Tracker) load(window time.Duration) ([]spend, error) {
+	cutoff := t.now().Add(-window)
+	if t.path == "" {
+		var entries []spend
+		for _, e := range t.entries {
+			if e.Time.After(cutoff) {
+				entries = append(entries, e)
+			}
+		}
+		return entries, nil
+	}
+
+	file, err := os.Open(t.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cost: ledger: %w", err)
+	}
+	defer file.Close()
+
+	var entries []spend
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		var e spend
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue // Skip a torn last line
+		}
+		if e.Time.After(cutoff) {
+			entries = append(entries, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("cost: ledger: %w", err)
+	}
+	return entries, nil
+}
+
+func sum(entries []spend, since time.Time) float64 {
+	total := 0.0
+	for _, e := range entries {
+		if e.Time.After(since) {
+			total += e.USD
+		}
+	}
+	return total
+}
+
+// Track records the cost of every call through the provider in t, priced
+// by prices. Wrapping the provider rather than recording in the loop also
+// counts calls made outside a run, such as output summaries.
+func Track(prices *Table, t *Tracker) provider.Middleware {
+	return provider.Observe(func(_ context.Context, req provider.ChatRequest, resp *provider.ChatResponse, err error) {
+		if err != nil {
+			return
+		}
+		model := resp.Model
+		if model == "" {
+			model = req.Model
+		}
+		if err := t.Record(prices.Cost(model, resp.Usage)); err != nil {
+			log.Printf("[budget] %v", err)
+		}
+	})
+}
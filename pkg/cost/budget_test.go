@@ -0,0 +1,95 @@
+package cost
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+)
+
+func TestTrackerCheck(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr, err := NewTracker("", Budget{Name: "daily", Limit: 5, Window: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.now = func() time.Time { return now }
+
+	var alerts []*ExceededError
+	tr.OnExceeded(func(e *ExceededError) { alerts = append(alerts, e) })
+
+	tr.Record(3)
+	if err := tr.Check(); err != nil {
+		t.Fatalf("under budget: %v", err)
+	}
+	now = now.Add(time.Hour)
+	tr.Record(2.5)
+	var exceeded *ExceededError
+	if err := tr.Check(); !errors.As(err, &exceeded) || exceeded.Spent != 5.5 {
+		t.Fatalf("Check = %v, want exceeded with $5.50", err)
+	}
+	tr.Check()
+	if len(alerts) != 1 {
+		t.Errorf("alerts = %d, want 1 per window", len(alerts))
+	}
+
+	// The first $3 rolls out of the window.
+	now = now.Add(23*time.Hour + time.Minute)
+	if err := tr.Check(); err != nil {
+		t.Errorf("after window: %v", err)
+	}
+	if spent, _ := tr.Spent(24 * time.Hour); spent != 2.5 {
+		t.Errorf("Spent = %v, want 2.5", spent)
+	}
+}
+
+func TestTrackerLedgerShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "spend.jsonl")
+	budget := Budget{Name: "weekly", Limit: 1, Window: 7 * 24 * time.Hour}
+	a, err := NewTracker(path, budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewTracker(path, budget)
+
+	a.Record(0.6)
+	if err := b.Check(); err != nil {
+		t.Fatalf("under budget: %v", err)
+	}
+	b.Record(0.5)
+	if err := a.Check(); err == nil {
+		t.Error("spend from another tracker not counted")
+	}
+}
+
+func TestTrackerNil(t *testing.T) {
+	var tr *Tracker
+	if err := tr.Record(1); err != nil {
+		t.Error(err)
+	}
+	if err := tr.Check(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	tracker, err := NewTracker("", Budget{Name: "daily", Limit: 100, Window: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prices := New(map[string]Price{"big": {Input: 2}})
+	p := provider.Chain(providertest.New(
+		providertest.Respond(&provider.ChatResponse{Model: "big", Usage: provider.Usage{PromptTokens: 1_000_000}}),
+		providertest.Fail(errors.New("down")),
+	), Track(prices, tracker))
+
+	p.Chat(context.Background(), provider.ChatRequest{})
+	p.Chat(context.Background(), provider.ChatRequest{})
+	if spent, _ := tracker.Spent(24 * time.Hour); spent != 2 {
+		t.Errorf("spent = %v, want 2", spent)
+	}
+}
@@ -0,0 +1,91 @@
+// Package cost estimates the dollar cost of LLM calls from per-model
+// token prices.
+package cost
+
+import (
+	"strings"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// Price is the USD cost per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Table maps models to prices.
+type Table struct {
+	prices map[string]Price
+}
+
+// Default returns a table with the prices in provider.DefaultCatalog.
+func Default() *Table {
+	return FromCatalog(provider.DefaultCatalog())
+}
+
+// FromCatalog returns a table with the prices of every priced model in c.
+// Override or extend them with Table.With.
+func FromCatalog(c *provider.Catalog) *Table {
+	prices := make(map[string]Price)
+	for model, info := range c.All() {
+		if info.InputPrice > 0 || info.OutputPrice > 0 {
+			prices[model] = Price{Input: info.InputPrice, Output: info.OutputPrice}
+		}
+	}
+	return New(prices)
+}
+
+// New returns a table with only the given prices.
+func New(prices map[string]Price) *Table {
+	t := &Table{prices: make(map[string]Price, len(prices))}
+	for model, p := range prices {
+		t.prices[model] = p
+	}
+	return t
+}
+
+// With returns a copy of t with overrides added or replacing entries.
+func (t *Table) With(overrides map[string]Price) *Table {
+	out := New(t.prices)
+	for model, p := range overrides {
+		out.prices[model] = p
+	}
+	return out
+}
+
+// Lookup finds the price for model. An exact match wins; otherwise the
+// longest key that prefixes the model is used, so dated names such as
+// "claude-sonnet-4-20250514" match "claude-sonnet-4". A router prefix like
+// "openai/" is ignored.
+func (t *Table) Lookup(model string) (Price, bool) {
+	if t == nil {
+		return Price{}, false
+	}
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	if p, ok := t.prices[model]; ok {
+		return p, true
+	}
+	best := ""
+	for key := range t.prices {
+		if strings.HasPrefix(model, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return t.prices[best], true
+}
+
+// Cost returns the USD cost of usage on model, or 0 if the model has no
+// price.
+func (t *Table) Cost(model string, u provider.Usage) float64 {
+	p, ok := t.Lookup(model)
+	if !ok {
+		return 0
+	}
+	return (float64(u.PromptTokens)*p.Input + float64(u.CompletionTokens)*p.Output) / 1e6
+}
@@ -0,0 +1,61 @@
+package cost
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func TestLookup(t *testing.T) {
+	table := Default()
+	tests := []struct {
+		model string
+		want  Price
+		ok    bool
+	}{
+		{"gpt-4o", Price{2.5, 10}, true},
+		{"gpt-4o-mini-2024-07-18", Price{0.15, 0.6}, true}, // Longest prefix wins over gpt-4o
+		{"claude-sonnet-4-20250514", Price{3, 15}, true},
+		{"claude-3-5-haiku-latest", Price{0.8, 4}, true},
+		{"openai/gpt-4.1-mini", Price{0.4, 1.6}, true},
+		{"o1-mini", Price{1.1, 4.4}, true},
+		{"llama3", Price{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := table.Lookup(tt.model)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Lookup(%q) = %v, %v; want %v, %v", tt.model, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	table := Default()
+	got := table.Cost("claude-sonnet-4-20250514", provider.Usage{PromptTokens: 10_000, CompletionTokens: 2_000})
+	if want := 0.03 + 0.03; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Cost = %v, want %v", got, want)
+	}
+	if got := table.Cost("unknown-model", provider.Usage{PromptTokens: 1000}); got != 0 {
+		t.Errorf("unknown model cost = %v", got)
+	}
+	var nilTable *Table
+	if got := nilTable.Cost("gpt-4o", provider.Usage{PromptTokens: 1000}); got != 0 {
+		t.Errorf("nil table cost = %v", got)
+	}
+}
+
+func TestWith(t *testing.T) {
+	base := Default()
+	custom := base.With(map[string]Price{"gpt-4o": {Input: 1, Output: 2}, "llama3": {Input: 0, Output: 0.1}})
+
+	if p, _ := custom.Lookup("gpt-4o"); p != (Price{1, 2}) {
+		t.Errorf("override = %v", p)
+	}
+	if _, ok := custom.Lookup("llama3:8b"); !ok {
+		t.Error("added model not found")
+	}
+	if p, _ := base.Lookup("gpt-4o"); p != (Price{2.5, 10}) {
+		t.Errorf("With modified the base table: %v", p)
+	}
+}
@@ -0,0 +1,166 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// defaultMinScore is the judge score a case needs to pass.
+const defaultMinScore = 0.7
+
+// Case is one benchmark prompt and the behavior expected from it. Every
+// check that is set must pass.
+type Case struct {
+	Name     string   `json:"name"` // Default: the file name without extension
+	Prompt   string   `json:"prompt"`
+	Exact    string   `json:"exact,omitempty"`     // Output must equal this (surrounding whitespace ignored)
+	Regex    string   `json:"regex,omitempty"`     // Output must match this
+	Criteria []string `json:"criteria,omitempty"`  // Judge-scored rubric
+	MinScore float64  `json:"min_score,omitempty"` // Judge score needed to pass (default 0.7)
+}
+
+// LoadCases reads every *.json case in dir, sorted by file name.
+func LoadCases(dir string) ([]Case, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var cases []Case
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var c Case
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("eval: case %s: %w", path, err)
+		}
+		if c.Name == "" {
+			c.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		if c.Prompt == "" {
+			return nil, fmt.Errorf("eval: case %s: prompt is required", path)
+		}
+		if c.Exact == "" && c.Regex == "" && len(c.Criteria) == 0 {
+			return nil, fmt.Errorf("eval: case %s: set exact, regex, or criteria", path)
+		}
+		if c.Regex != "" {
+			if _, err := regexp.Compile(c.Regex); err != nil {
+				return nil, fmt.Errorf("eval: case %s: %w", path, err)
+			}
+		}
+		cases = append(cases, c)
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("eval: no *.json cases in %s", dir)
+	}
+	return cases, nil
+}
+
+// RunFunc runs prompt in session and returns the final answer.
+type RunFunc func(ctx context.Context, session, prompt string) (string, error)
+
+// CaseResult is the outcome of one case.
+type CaseResult struct {
+	Name     string        `json:"name"`
+	Pass     bool          `json:"pass"`
+	Output   string        `json:"output"`
+	Score    *float64      `json:"score,omitempty"` // Judge score, for cases with criteria
+	Failures []string      `json:"failures,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Report is the outcome of a benchmark.
+type Report struct {
+	Results []CaseResult `json:"results"`
+	Passed  int          `json:"passed"`
+	Failed  int          `json:"failed"`
+}
+
+// Bench runs each case through run in a fresh session and checks its
+// output. Cases with criteria are graded by the judge (see UseJudge), and
+// their scores are stored under the rubric "bench:<case name>" so they can
+// be compared across runs.
+func (c *Client) Bench(ctx context.Context, cases []Case, run RunFunc) *Report {
+	report := &Report{}
+	stamp := time.Now().Format("20060102-150405")
+	for _, tc := range cases {
+		r := c.runCase(ctx, tc, run, "bench-"+tc.Name+"-"+stamp)
+		if r.Pass {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, r)
+	}
+	return report
+}
+
+func (c *Client) runCase(ctx context.Context, tc Case, run RunFunc, session string) CaseResult {
+	start := time.Now()
+	out, err := run(ctx, session, tc.Prompt)
+	r := CaseResult{Name: tc.Name, Output: out, Duration: time.Since(start)}
+	if err != nil {
+		r.Failures = append(r.Failures, "run: "+err.Error())
+		return r
+	}
+
+	if tc.Exact != "" && strings.TrimSpace(out) != strings.TrimSpace(tc.Exact) {
+		r.Failures = append(r.Failures, fmt.Sprintf("output is not %q", tc.Exact))
+	}
+	if tc.Regex != "" && !regexp.MustCompile(tc.Regex).MatchString(out) {
+		r.Failures = append(r.Failures, fmt.Sprintf("output does not match /%s/", tc.Regex))
+	}
+	if len(tc.Criteria) > 0 {
+		transcript := Transcript{Session: session, Messages: []provider.Message{
+			{Role: "user", Content: tc.Prompt},
+			{Role: "assistant", Content: out},
+		}}
+		s, err := c.Score(ctx, transcript, Rubric{Name: "bench:" + tc.Name, Criteria: tc.Criteria})
+		need := tc.MinScore
+		if need <= 0 {
+			need = defaultMinScore
+		}
+		switch {
+		case s == nil:
+			r.Failures = append(r.Failures, "judge: "+err.Error())
+		case s.Score < need:
+			r.Score = &s.Score
+			r.Failures = append(r.Failures, fmt.Sprintf("judge score %.2f below %.2f: %s", s.Score, need, s.Summary))
+		default:
+			r.Score = &s.Score
+		}
+	}
+	r.Pass = len(r.Failures) == 0
+	return r
+}
+
+// WriteText prints one line per case and a summary.
+func (r *Report) WriteText(w io.Writer) {
+	for _, res := range r.Results {
+		status := "PASS"
+		if !res.Pass {
+			status = "FAIL"
+		}
+		line := fmt.Sprintf("%s  %s (%s)", status, res.Name, res.Duration.Round(time.Millisecond))
+		if res.Score != nil {
+			line += fmt.Sprintf(" score %.2f", *res.Score)
+		}
+		fmt.Fprintln(w, line)
+		for _, f := range res.Failures {
+			fmt.Fprintf(w, "      %s\n", f)
+		}
+	}
+	fmt.Fprintf(w, "\n%d passed, %d failed\n", r.Passed, r.Failed)
+}
@@ -0,0 +1,98 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeCase(t *testing.T, dir, name, body string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadCases(t *testing.T) {
+	dir := t.TempDir()
+	writeCase(t, dir, "b-math.json", `{"prompt": "2+2?", "exact": "4"}`)
+	writeCase(t, dir, "a-greet.json", `{"name": "greet", "prompt": "hi", "regex": "(?i)hello"}`)
+	writeCase(t, dir, "notes.txt", `ignored`)
+
+	cases, err := LoadCases(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cases) != 2 || cases[0].Name != "greet" || cases[1].Name != "b-math" {
+		t.Errorf("cases = %+v", cases)
+	}
+
+	for name, body := range map[string]string{
+		"no-check.json":  `{"prompt": "x"}`,
+		"no-prompt.json": `{"exact": "x"}`,
+		"bad-re.json":    `{"prompt": "x", "regex": "("}`,
+	} {
+		bad := t.TempDir()
+		writeCase(t, bad, name, body)
+		if _, err := LoadCases(bad); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := LoadCases(t.TempDir()); err == nil {
+		t.Error("expected error for an empty directory")
+	}
+}
+
+func TestBench(t *testing.T) {
+	outputs := map[string]string{
+		"2+2?":       " 4\n",
+		"greet me":   "Hi there",
+		"explain go": "Go is a language.",
+		"crash":      "",
+	}
+	run := func(_ context.Context, session, prompt string) (string, error) {
+		if !strings.HasPrefix(session, "bench-") {
+			t.Errorf("session = %q", session)
+		}
+		if prompt == "crash" {
+			return "", errors.New("provider down")
+		}
+		return outputs[prompt], nil
+	}
+	c := NewClient(DefaultConfig())
+	c.UseJudge(&judgeProvider{reply: `{"criteria":[{"criterion":"clear","score":6,"reason":"terse"}],"summary":"too short"}`}, "")
+
+	report := c.Bench(context.Background(), []Case{
+		{Name: "math", Prompt: "2+2?", Exact: "4"},
+		{Name: "greet", Prompt: "greet me", Regex: "(?i)hello"},
+		{Name: "explain", Prompt: "explain go", Criteria: []string{"clear"}, MinScore: 0.5},
+		{Name: "explain-strict", Prompt: "explain go", Criteria: []string{"clear"}},
+		{Name: "crash", Prompt: "crash", Exact: "x"},
+	}, run)
+
+	pass := map[string]bool{}
+	for _, r := range report.Results {
+		pass[r.Name] = r.Pass
+	}
+	want := map[string]bool{"math": true, "greet": false, "explain": true, "explain-strict": false, "crash": false}
+	for name, w := range want {
+		if pass[name] != w {
+			t.Errorf("%s pass = %v, want %v", name, pass[name], w)
+		}
+	}
+	if report.Passed != 2 || report.Failed != 3 {
+		t.Errorf("passed %d, failed %d", report.Passed, report.Failed)
+	}
+
+	var buf bytes.Buffer
+	report.WriteText(&buf)
+	for _, s := range []string{"PASS  math", "FAIL  greet", "does not match", "score 0.60", "provider down", "2 passed, 3 failed"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("report missing %q:\n%s", s, buf.String())
+		}
+	}
+}
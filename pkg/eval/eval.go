@@ -10,6 +10,9 @@ import (
 	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/memory"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
 )
 
 // Record represents a token-eval capture record.
@@ -18,6 +21,8 @@ type Record struct {
 	Provider         string  `json:"provider"`
 	Model            string  `json:"model"`
 	Intent           string  `json:"intent"`
+	Session          string  `json:"session,omitempty"`
+	Iteration        int     `json:"iteration,omitempty"`
 	PromptTokens     int     `json:"prompt_tokens"`
 	CompletionTokens int     `json:"completion_tokens"`
 	TotalTokens      int     `json:"total_tokens"`
@@ -50,7 +55,11 @@ func DefaultConfig() Config {
 
 // Client provides eval data access.
 type Client struct {
-	cfg Config
+	cfg        Config
+	calls      *SQLiteRecorder   // Native call store; nil means query token-eval
+	memory     *memory.Store     // Native learning store; nil means use agent-memory
+	judge      provider.Provider // Grades runs in Score; nil disables scoring
+	judgeModel string
 }
 
 // NewClient creates an eval client.
@@ -58,8 +67,25 @@ func NewClient(cfg Config) *Client {
 	return &Client{cfg: cfg}
 }
 
-// QueryRecentCalls fetches recent token-eval records.
+// UseCallStore makes the client read call records from a native SQLite store
+// instead of the token-eval binary.
+func (c *Client) UseCallStore(store *SQLiteRecorder) {
+	c.calls = store
+}
+
+// UseMemoryStore makes the client read and write learnings in a native
+// memory store instead of the agent-memory binary.
+func (c *Client) UseMemoryStore(store *memory.Store) {
+	c.memory = store
+}
+
+// QueryRecentCalls fetches recent call records.
 func (c *Client) QueryRecentCalls(ctx context.Context, limit int) ([]Record, error) {
+	if c.calls != nil {
+		since := time.Now().Add(-time.Duration(c.cfg.LookbackHours) * time.Hour)
+		return c.calls.Recent(ctx, since, limit)
+	}
+
 	binary := c.cfg.TokenEvalBinary
 	if _, err := exec.LookPath(binary); err != nil {
 		return nil, fmt.Errorf("token-eval not found: %w", err)
@@ -89,8 +115,21 @@ func (c *Client) QueryRecentCalls(ctx context.Context, limit int) ([]Record, err
 	return records, nil
 }
 
-// QueryLearnings fetches stored learnings from agent-memory.
+// QueryLearnings fetches stored learnings from the memory store or
+// agent-memory. The memory store ranks by meaning when it has an embedder.
 func (c *Client) QueryLearnings(ctx context.Context, query string, limit int) ([]Learning, error) {
+	if c.memory != nil {
+		found, err := c.memory.Recall(ctx, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		learnings := make([]Learning, len(found))
+		for i, m := range found {
+			learnings[i] = Learning{ID: fmt.Sprintf("%d", m.ID), Content: m.Content, Tags: strings.Join(m.Tags, ",")}
+		}
+		return learnings, nil
+	}
+
 	binary := c.cfg.AgentMemoryBinary
 	if _, err := exec.LookPath(binary); err != nil {
 		return nil, fmt.Errorf("agent-memory not found: %w", err)
@@ -118,8 +157,13 @@ func (c *Client) QueryLearnings(ctx context.Context, query string, limit int) ([
 	return learnings, nil
 }
 
-// StoreLearning saves a learning to agent-memory.
+// StoreLearning saves a learning to the memory store or agent-memory.
 func (c *Client) StoreLearning(ctx context.Context, content string, tags []string) error {
+	if c.memory != nil {
+		_, err := c.memory.Add(ctx, content, tags)
+		return err
+	}
+
 	binary := c.cfg.AgentMemoryBinary
 	if _, err := exec.LookPath(binary); err != nil {
 		return fmt.Errorf("agent-memory not found: %w", err)
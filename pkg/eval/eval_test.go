@@ -1,7 +1,12 @@
 package eval
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/memory"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -66,3 +71,119 @@ func TestStoreLearning_MissingBinary(t *testing.T) {
 		t.Error("expected error for missing binary")
 	}
 }
+
+func TestLearnings_UseMemoryStore(t *testing.T) {
+	store, err := memory.Open(filepath.Join(t.TempDir(), "memory.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+
+	cfg := DefaultConfig()
+	cfg.AgentMemoryBinary = "nonexistent-binary-xyz"
+	c := NewClient(cfg)
+	c.UseMemoryStore(store)
+
+	if err := c.StoreLearning(t.Context(), "Check CI before merging", []string{"orchestrator", "heartbeat"}); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	learnings, err := c.QueryLearnings(t.Context(), "orchestrator learnings", 5)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(learnings) != 1 || learnings[0].Tags != "orchestrator,heartbeat" {
+		t.Errorf("learnings = %+v", learnings)
+	}
+	result, _ := c.BuildLearningContext(t.Context(), "orchestrator learnings", 5)
+	if !strings.Contains(result, "- Check CI before merging [tags: orchestrator,heartbeat]") {
+		t.Errorf("context = %q", result)
+	}
+}
+
+func TestSQLiteRecorder_RecordAndRecent(t *testing.T) {
+	rec, err := OpenSQLiteRecorder(filepath.Join(t.TempDir(), "calls.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rec.Close()
+
+	ctx := t.Context()
+	for i := 1; i <= 3; i++ {
+		err := rec.Record(ctx, Record{
+			Provider:         "anthropic",
+			Model:            "claude",
+			Intent:           "test",
+			Session:          "s1",
+			Iteration:        i,
+			PromptTokens:     10 * i,
+			CompletionTokens: i,
+		})
+		if err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	records, err := rec.Recent(ctx, time.Now().Add(-time.Hour), 2)
+	if err != nil {
+		t.Fatalf("recent: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if records[0].Iteration != 3 || records[0].TotalTokens != 33 {
+		t.Errorf("unexpected newest record: %+v", records[0])
+	}
+}
+
+func TestSQLiteRecorder_SessionTotals(t *testing.T) {
+	rec, err := OpenSQLiteRecorder(filepath.Join(t.TempDir(), "calls.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rec.Close()
+
+	ctx := t.Context()
+	rec.Record(ctx, Record{Provider: "openai", Session: "s1", PromptTokens: 100, CompletionTokens: 10, Cost: 0.5})
+	rec.Record(ctx, Record{Provider: "openai", Session: "s1", PromptTokens: 200, CompletionTokens: 20, Cost: 0.25})
+	rec.Record(ctx, Record{Provider: "openai", Session: "s2", PromptTokens: 1000})
+
+	got, err := rec.SessionTotals(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Totals{Calls: 2, PromptTokens: 300, CompletionTokens: 30, Cost: 0.75}); got != want {
+		t.Errorf("s1 totals = %+v, want %+v", got, want)
+	}
+	if got, err := rec.SessionTotals(ctx, "none"); err != nil || got != (Totals{}) {
+		t.Errorf("unknown session totals = %+v, %v", got, err)
+	}
+}
+
+func TestQueryRecentCalls_UsesCallStore(t *testing.T) {
+	rec, err := OpenSQLiteRecorder(filepath.Join(t.TempDir(), "calls.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rec.Close()
+	rec.Record(t.Context(), Record{Provider: "openai", PromptTokens: 5, CompletionTokens: 5})
+
+	cfg := DefaultConfig()
+	cfg.TokenEvalBinary = "nonexistent-binary-xyz"
+	c := NewClient(cfg)
+	c.UseCallStore(rec)
+
+	summary, err := c.BuildReviewSummary(t.Context())
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if !strings.Contains(summary, "Total calls**: 1") {
+		t.Errorf("unexpected summary: %s", summary)
+	}
+}
+
+func TestExecRecorder_MissingBinary(t *testing.T) {
+	r := NewExecRecorder("nonexistent-binary-xyz")
+	if err := r.Record(t.Context(), Record{Provider: "x"}); err != nil {
+		t.Errorf("missing binary should be a no-op, got %v", err)
+	}
+}
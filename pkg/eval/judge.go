@@ -0,0 +1,180 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// Rubric is what a judge grades a run against.
+type Rubric struct {
+	Name     string   `json:"name"`     // Groups scores so they can be compared across prompt changes
+	Criteria []string `json:"criteria"` // Each graded 0-10
+}
+
+// Transcript is a run to be graded.
+type Transcript struct {
+	Session  string
+	Messages []provider.Message
+}
+
+// Run returns the part of t added by one run, going by the run ID in each
+// message's metadata (see provider.Meta).
+func (t Transcript) Run(id string) Transcript {
+	out := Transcript{Session: t.Session}
+	for _, m := range t.Messages {
+		if m.Meta != nil && m.Meta.RunID == id {
+			out.Messages = append(out.Messages, m)
+		}
+	}
+	return out
+}
+
+// CriterionScore is the judge's grade for one criterion.
+type CriterionScore struct {
+	Criterion string `json:"criterion"`
+	Score     int    `json:"score"` // 0-10
+	Reason    string `json:"reason"`
+}
+
+// Score is a judge's grade for a run.
+type Score struct {
+	ID        string           `json:"id,omitempty"`
+	Session   string           `json:"session"`
+	Rubric    string           `json:"rubric"`
+	Score     float64          `json:"score"` // Mean criterion score, scaled to 0-1
+	Criteria  []CriterionScore `json:"criteria"`
+	Summary   string           `json:"summary,omitempty"`
+	Model     string           `json:"model"` // Judge model
+	CreatedAt string           `json:"created_at"`
+}
+
+const judgePrompt = `You are grading an AI assistant's run against a rubric.
+Score each criterion from 0 (not met at all) to 10 (fully met) and give a
+one-sentence reason. Judge only what the transcript shows.
+
+## Criteria
+
+%s
+## Transcript
+
+%s`
+
+var judgeSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"criteria": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"criterion": map[string]any{"type": "string"},
+					"score":     map[string]any{"type": "integer", "minimum": 0, "maximum": 10},
+					"reason":    map[string]any{"type": "string"},
+				},
+				"required": []string{"criterion", "score", "reason"},
+			},
+		},
+		"summary": map[string]any{"type": "string"},
+	},
+	"required": []string{"criteria", "summary"},
+}
+
+// UseJudge sets the provider and model that Score asks for grades. A
+// cheaper model than the one being graded is usually enough.
+func (c *Client) UseJudge(p provider.Provider, model string) {
+	c.judge = p
+	c.judgeModel = model
+}
+
+// Score asks the judge to grade t against rubric. With a call store
+// configured, the score is saved alongside the session's call records.
+func (c *Client) Score(ctx context.Context, t Transcript, rubric Rubric) (*Score, error) {
+	if c.judge == nil {
+		return nil, fmt.Errorf("eval: no judge provider configured")
+	}
+	if len(rubric.Criteria) == 0 {
+		return nil, fmt.Errorf("eval: rubric %q has no criteria", rubric.Name)
+	}
+
+	var criteria strings.Builder
+	for i, cr := range rubric.Criteria {
+		fmt.Fprintf(&criteria, "%d. %s\n", i+1, cr)
+	}
+	resp, err := c.judge.Chat(ctx, provider.ChatRequest{
+		Model:          c.judgeModel,
+		Messages:       []provider.Message{{Role: "user", Content: fmt.Sprintf(judgePrompt, criteria.String(), formatTranscript(t.Messages))}},
+		ResponseFormat: provider.FormatJSONSchema,
+		ResponseSchema: judgeSchema,
+		Intent:         "judge",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("eval: judge: %w", err)
+	}
+
+	var out struct {
+		Criteria []CriterionScore `json:"criteria"`
+		Summary  string           `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(resp.Content), &out); err != nil {
+		return nil, fmt.Errorf("eval: decode judge response: %w", err)
+	}
+	if len(out.Criteria) == 0 {
+		return nil, fmt.Errorf("eval: judge returned no criteria scores")
+	}
+
+	total := 0
+	for i := range out.Criteria {
+		out.Criteria[i].Score = min(max(out.Criteria[i].Score, 0), 10)
+		total += out.Criteria[i].Score
+	}
+	model := resp.Model
+	if model == "" {
+		model = c.judgeModel
+	}
+	s := &Score{
+		Session:   t.Session,
+		Rubric:    rubric.Name,
+		Score:     float64(total) / float64(10*len(out.Criteria)),
+		Criteria:  out.Criteria,
+		Summary:   out.Summary,
+		Model:     model,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if c.calls != nil {
+		if err := c.calls.RecordScore(ctx, s); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// Scores returns up to limit stored scores for rubric ("" for all), newest
+// first. It needs a call store.
+func (c *Client) Scores(ctx context.Context, rubric string, limit int) ([]Score, error) {
+	if c.calls == nil {
+		return nil, fmt.Errorf("eval: scores need a call database (eval.db in config)")
+	}
+	return c.calls.Scores(ctx, rubric, limit)
+}
+
+// formatTranscript renders messages as plain text for the judge. Tool
+// results are trimmed to keep the prompt small.
+func formatTranscript(msgs []provider.Message) string {
+	var b strings.Builder
+	for _, m := range msgs {
+		content := m.Content
+		if m.Role == "tool" && len(content) > 2000 {
+			content = content[:2000] + "..."
+		}
+		fmt.Fprintf(&b, "[%s] %s\n", m.Role, content)
+		for _, tc := range m.ToolCalls {
+			fmt.Fprintf(&b, "[tool call] %s(%s)\n", tc.Name, tc.Arguments)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package eval
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+type judgeProvider struct {
+	reply string
+	req   provider.ChatRequest
+}
+
+func (j *judgeProvider) Name() string { return "judge" }
+
+func (j *judgeProvider) Chat(_ context.Context, req provider.ChatRequest) (*provider.ChatResponse, error) {
+	j.req = req
+	return &provider.ChatResponse{Content: j.reply, Model: "cheap-judge"}, nil
+}
+
+func TestScore(t *testing.T) {
+	rec, err := OpenSQLiteRecorder(filepath.Join(t.TempDir(), "calls.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rec.Close()
+
+	jp := &judgeProvider{reply: `{"criteria":[
+		{"criterion":"answers the question","score":8,"reason":"mostly"},
+		{"criterion":"uses tools sparingly","score":14,"reason":"out of range"}
+	],"summary":"good run"}`}
+	c := NewClient(DefaultConfig())
+	c.UseCallStore(rec)
+	c.UseJudge(jp, "small")
+
+	transcript := Transcript{Session: "s1", Messages: []provider.Message{
+		{Role: "user", Content: "What's in README?"},
+		{Role: "assistant", ToolCalls: []provider.ToolCall{{Name: "fs.read", Arguments: `{"path":"README.md"}`}}},
+		{Role: "tool", Content: "# teeny"},
+		{Role: "assistant", Content: "A heading."},
+	}}
+	rubric := Rubric{Name: "readme", Criteria: []string{"answers the question", "uses tools sparingly"}}
+
+	s, err := c.Score(t.Context(), transcript, rubric)
+	if err != nil {
+		t.Fatalf("score: %v", err)
+	}
+	if s.Score != 0.9 || s.Criteria[1].Score != 10 || s.Model != "cheap-judge" || s.ID == "" {
+		t.Errorf("score = %+v", s)
+	}
+	prompt := jp.req.Messages[0].Content
+	if jp.req.Model != "small" || !strings.Contains(prompt, "2. uses tools sparingly") || !strings.Contains(prompt, "[tool call] fs.read") {
+		t.Errorf("judge request = %+v", jp.req)
+	}
+
+	stored, err := c.Scores(t.Context(), "readme", 10)
+	if err != nil {
+		t.Fatalf("scores: %v", err)
+	}
+	if len(stored) != 1 || stored[0].Session != "s1" || stored[0].Score != 0.9 || len(stored[0].Criteria) != 2 {
+		t.Errorf("stored = %+v", stored)
+	}
+	if other, _ := c.Scores(t.Context(), "other", 10); len(other) != 0 {
+		t.Errorf("rubric filter returned %+v", other)
+	}
+}
+
+func TestScoreErrors(t *testing.T) {
+	c := NewClient(DefaultConfig())
+	rubric := Rubric{Name: "r", Criteria: []string{"x"}}
+	if _, err := c.Score(t.Context(), Transcript{}, rubric); err == nil {
+		t.Error("expected error without a judge")
+	}
+	c.UseJudge(&judgeProvider{reply: "not json"}, "")
+	if _, err := c.Score(t.Context(), Transcript{}, rubric); err == nil {
+		t.Error("expected error for a malformed judge reply")
+	}
+	if _, err := c.Score(t.Context(), Transcript{}, Rubric{Name: "empty"}); err == nil {
+		t.Error("expected error for a rubric without criteria")
+	}
+}
+
+func TestTranscriptRun(t *testing.T) {
+	tr := Transcript{Session: "s1", Messages: []provider.Message{
+		{Role: "user", Content: "old"},
+		{Role: "user", Content: "first", Meta: &provider.Meta{RunID: "r1"}},
+		{Role: "user", Content: "second", Meta: &provider.Meta{RunID: "r2"}},
+		{Role: "assistant", Content: "done", Meta: &provider.Meta{RunID: "r1"}},
+	}}
+	got := tr.Run("r1")
+	if got.Session != "s1" || len(got.Messages) != 2 || got.Messages[0].Content != "first" || got.Messages[1].Content != "done" {
+		t.Errorf("Run(r1) = %+v", got)
+	}
+	if got := tr.Run("r3"); got.Messages != nil {
+		t.Errorf("Run(r3) = %+v", got)
+	}
+}
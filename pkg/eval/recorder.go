@@ -0,0 +1,54 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Recorder captures LLM call records.
+type Recorder interface {
+	Record(ctx context.Context, r Record) error
+}
+
+// ExecRecorder records calls by shelling out to the token-eval binary.
+// It is a no-op when the binary is not installed.
+type ExecRecorder struct {
+	binary string
+}
+
+// NewExecRecorder creates a recorder backed by the token-eval CLI.
+// binary defaults to "token-eval" if empty.
+func NewExecRecorder(binary string) *ExecRecorder {
+	if binary == "" {
+		binary = "token-eval"
+	}
+	return &ExecRecorder{binary: binary}
+}
+
+// Record runs `token-eval record` for the call.
+func (e *ExecRecorder) Record(ctx context.Context, r Record) error {
+	if _, err := exec.LookPath(e.binary); err != nil {
+		return nil
+	}
+
+	args := []string{
+		"record",
+		"--provider", r.Provider,
+		"--prompt-tokens", fmt.Sprintf("%d", r.PromptTokens),
+		"--completion-tokens", fmt.Sprintf("%d", r.CompletionTokens),
+		"--intent", r.Intent,
+	}
+	if r.Model != "" {
+		args = append(args, "--model", r.Model)
+	}
+
+	cmd := exec.CommandContext(ctx, e.binary, args...)
+	// Provide minimal JSON on stdin
+	input := map[string]any{"session": r.Session, "iteration": r.Iteration}
+	data, _ := json.Marshal(input)
+	cmd.Stdin = strings.NewReader(string(data))
+	return cmd.Run()
+}
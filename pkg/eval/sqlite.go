@@ -0,0 +1,186 @@
+package eval
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // pure-Go SQLite driver
+)
+
+const callsSchema = `
+CREATE TABLE IF NOT EXISTS calls (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	provider          TEXT    NOT NULL,
+	model             TEXT    NOT NULL DEFAULT '',
+	intent            TEXT    NOT NULL DEFAULT '',
+	session           TEXT    NOT NULL DEFAULT '',
+	iteration         INTEGER NOT NULL DEFAULT 0,
+	prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	cost              REAL    NOT NULL DEFAULT 0,
+	created_at        TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS calls_created_at ON calls(created_at);
+CREATE INDEX IF NOT EXISTS calls_session ON calls(session);
+
+CREATE TABLE IF NOT EXISTS scores (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	session    TEXT    NOT NULL DEFAULT '',
+	rubric     TEXT    NOT NULL DEFAULT '',
+	score      REAL    NOT NULL,
+	criteria   TEXT    NOT NULL DEFAULT '[]',
+	summary    TEXT    NOT NULL DEFAULT '',
+	model      TEXT    NOT NULL DEFAULT '',
+	created_at TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS scores_rubric ON scores(rubric, created_at);
+`
+
+// SQLiteRecorder stores call records in a local SQLite database.
+// It needs no external binaries and is safe for concurrent use.
+type SQLiteRecorder struct {
+	db *sql.DB
+}
+
+// OpenSQLiteRecorder opens (or creates) a call database at path.
+func OpenSQLiteRecorder(path string) (*SQLiteRecorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("eval: create db dir: %w", err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("eval: open db: %w", err)
+	}
+	db.SetMaxOpenConns(1) // SQLite serializes writers anyway
+	if _, err := db.Exec(callsSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("eval: init schema: %w", err)
+	}
+	return &SQLiteRecorder{db: db}, nil
+}
+
+// Record inserts a call record. CreatedAt defaults to now.
+func (s *SQLiteRecorder) Record(ctx context.Context, r Record) error {
+	created := r.CreatedAt
+	if created == "" {
+		created = time.Now().UTC().Format(time.RFC3339)
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO calls (provider, model, intent, session, iteration, prompt_tokens, completion_tokens, cost, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Provider, r.Model, r.Intent, r.Session, r.Iteration,
+		r.PromptTokens, r.CompletionTokens, r.Cost, created)
+	if err != nil {
+		return fmt.Errorf("eval: insert call: %w", err)
+	}
+	return nil
+}
+
+// Recent returns up to limit records created at or after since, newest first.
+func (s *SQLiteRecorder) Recent(ctx context.Context, since time.Time, limit int) ([]Record, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, provider, model, intent, session, iteration, prompt_tokens, completion_tokens, cost, created_at
+		 FROM calls WHERE created_at >= ? ORDER BY created_at DESC, id DESC LIMIT ?`,
+		since.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return nil, fmt.Errorf("eval: query calls: %w", err)
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var r Record
+		var id int64
+		if err := rows.Scan(&id, &r.Provider, &r.Model, &r.Intent, &r.Session, &r.Iteration,
+			&r.PromptTokens, &r.CompletionTokens, &r.Cost, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("eval: scan call: %w", err)
+		}
+		r.ID = fmt.Sprintf("%d", id)
+		r.TotalTokens = r.PromptTokens + r.CompletionTokens
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// Totals sums the calls recorded for one session.
+type Totals struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// SessionTotals returns the totals of every call recorded for session.
+func (s *SQLiteRecorder) SessionTotals(ctx context.Context, session string) (Totals, error) {
+	var t Totals
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost), 0)
+		 FROM calls WHERE session = ?`, session).
+		Scan(&t.Calls, &t.PromptTokens, &t.CompletionTokens, &t.Cost)
+	if err != nil {
+		return Totals{}, fmt.Errorf("eval: query session totals: %w", err)
+	}
+	return t, nil
+}
+
+// RecordScore inserts a judge score and sets its ID. CreatedAt defaults
+// to now.
+func (s *SQLiteRecorder) RecordScore(ctx context.Context, sc *Score) error {
+	if sc.CreatedAt == "" {
+		sc.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	criteria, err := json.Marshal(sc.Criteria)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO scores (session, rubric, score, criteria, summary, model, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		sc.Session, sc.Rubric, sc.Score, string(criteria), sc.Summary, sc.Model, sc.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("eval: insert score: %w", err)
+	}
+	if id, err := res.LastInsertId(); err == nil {
+		sc.ID = fmt.Sprintf("%d", id)
+	}
+	return nil
+}
+
+// Scores returns up to limit scores for rubric ("" for all), newest first.
+func (s *SQLiteRecorder) Scores(ctx context.Context, rubric string, limit int) ([]Score, error) {
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, session, rubric, score, criteria, summary, model, created_at
+		 FROM scores WHERE ? = '' OR rubric = ? ORDER BY created_at DESC, id DESC LIMIT ?`,
+		rubric, rubric, limit)
+	if err != nil {
+		return nil, fmt.Errorf("eval: query scores: %w", err)
+	}
+	defer rows.Close()
+
+	var scores []Score
+	for rows.Next() {
+		var sc Score
+		var id int64
+		var criteria string
+		if err := rows.Scan(&id, &sc.Session, &sc.Rubric, &sc.Score, &criteria, &sc.Summary, &sc.Model, &sc.CreatedAt); err != nil {
+			return nil, fmt.Errorf("eval: scan score: %w", err)
+		}
+		sc.ID = fmt.Sprintf("%d", id)
+		json.Unmarshal([]byte(criteria), &sc.Criteria)
+		scores = append(scores, sc)
+	}
+	return scores, rows.Err()
+}
+
+// Close releases the database handle.
+func (s *SQLiteRecorder) Close() error {
+	return s.db.Close()
+}
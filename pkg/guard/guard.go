@@ -0,0 +1,180 @@
+// Package guard checks the model's answers and its tool arguments against
+// content policies before they take effect, and tool results for prompt
+// injections before the model reads them. Guardrails can let content
+// through with a warning, block it, rewrite it, or quarantine a tool
+// result.
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrBlocked is wrapped by errors for content a guardrail blocked.
+var ErrBlocked = errors.New("blocked by guardrail")
+
+// Actions in a Verdict.
+const (
+	Allow      = ""           // Let the content through
+	Warn       = "warn"       // Log it and let it through
+	Block      = "block"      // Stop the answer, tool call, or run
+	Rewrite    = "rewrite"    // Replace the content with Verdict.Text
+	Quarantine = "quarantine" // Withhold a tool result from the model; blocks other content
+)
+
+// Targets a guardrail inspects.
+const (
+	Output     = "output" // The model's final answer
+	ToolArgs   = "tool"   // A tool call's JSON arguments, before it runs
+	ToolResult = "result" // A tool's output, before the model reads it
+)
+
+// Input is the content being checked.
+type Input struct {
+	Target  string // Output, ToolArgs, or ToolResult
+	Session string
+	Tool    string // Tool name (ToolArgs, ToolResult)
+	Text    string // The answer, the tool call's JSON arguments, or its output
+}
+
+// Verdict is a guardrail's decision.
+type Verdict struct {
+	Action string // Allow, Warn, Block, Rewrite, or Quarantine
+	Rule   string // What decided, for logs and error messages
+	Reason string
+	Text   string // Replacement content (Rewrite)
+}
+
+// Guardrail decides what happens to content.
+type Guardrail interface {
+	Check(ctx context.Context, in Input) (Verdict, error)
+}
+
+// Func adapts a function to a Guardrail.
+type Func func(ctx context.Context, in Input) (Verdict, error)
+
+func (f Func) Check(ctx context.Context, in Input) (Verdict, error) { return f(ctx, in) }
+
+// Guard runs guardrails in order. A nil Guard allows everything.
+type Guard struct {
+	rails []Guardrail
+}
+
+// New returns a Guard running rails in order. Nil rails are skipped.
+func New(rails ...Guardrail) *Guard {
+	g := &Guard{}
+	for _, r := range rails {
+		if r != nil {
+			g.rails = append(g.rails, r)
+		}
+	}
+	return g
+}
+
+// Check runs every guardrail on in. A rewrite hands the new text to the
+// guardrails after it, and the first block or quarantine stops the check.
+// Warnings are logged. The result is Block, Quarantine (only for a
+// ToolResult), Rewrite with the final text, or Allow.
+//
+// A guardrail that fails blocks the content: an unattended run is better
+// stopped than let through unchecked.
+func (g *Guard) Check(ctx context.Context, in Input) Verdict {
+	if g == nil {
+		return Verdict{}
+	}
+	rewritten := Verdict{}
+	for _, r := range g.rails {
+		v, err := r.Check(ctx, in)
+		if err != nil {
+			v = Verdict{Action: Block, Rule: v.Rule, Reason: fmt.Sprintf("guardrail failed: %v", err)}
+			log.Printf("[guard] %s: blocked: %s", describe(in, v), v.Reason)
+			return v
+		}
+		switch v.Action {
+		case Allow:
+		case Warn:
+			log.Printf("[guard] %s: %s", describe(in, v), v.Reason)
+		case Rewrite:
+			log.Printf("[guard] %s: rewritten: %s", describe(in, v), v.Reason)
+			in.Text = v.Text
+			rewritten = Verdict{Action: Rewrite, Rule: v.Rule, Reason: v.Reason, Text: v.Text}
+		case Block:
+			log.Printf("[guard] %s: blocked: %s", describe(in, v), v.Reason)
+			return v
+		case Quarantine:
+			if in.Target != ToolResult {
+				v.Action = Block
+				log.Printf("[guard] %s: blocked: %s", describe(in, v), v.Reason)
+				return v
+			}
+			log.Printf("[guard] %s: quarantined: %s", describe(in, v), v.Reason)
+			return v
+		default:
+			return Verdict{Action: Block, Rule: v.Rule, Reason: fmt.Sprintf("unknown action %q", v.Action)}
+		}
+	}
+	return rewritten
+}
+
+// Err returns the error for a Block verdict.
+func (v Verdict) Err() error {
+	if v.Rule == "" {
+		return fmt.Errorf("%w: %s", ErrBlocked, v.Reason)
+	}
+	return fmt.Errorf("%w %s: %s", ErrBlocked, v.Rule, v.Reason)
+}
+
+// describe names what a verdict applies to, for logs.
+func describe(in Input, v Verdict) string {
+	what := "output"
+	switch in.Target {
+	case ToolArgs:
+		what = "tool " + in.Tool
+	case ToolResult:
+		what = "result of " + in.Tool
+	}
+	if in.Session != "" {
+		what += " in " + in.Session
+	}
+	if v.Rule == "" {
+		return what
+	}
+	return fmt.Sprintf("%s on %s", v.Rule, what)
+}
+
+// checkAction reports an action that isn't Warn, Block, Rewrite, or
+// Quarantine.
+func checkAction(action string) error {
+	switch action {
+	case Warn, Block, Rewrite, Quarantine:
+		return nil
+	}
+	return fmt.Errorf("action %q must be warn, block, rewrite, or quarantine", action)
+}
+
+// checkTarget reports a target that isn't Output, ToolArgs, ToolResult,
+// or "".
+func checkTarget(target string) error {
+	switch target {
+	case "", Output, ToolArgs, ToolResult:
+		return nil
+	}
+	return fmt.Errorf("target %q must be output, tool, or result", target)
+}
+
+// targets reports whether a guardrail for targets applies to target. No
+// targets, or "", means Output and ToolArgs: tool results are only checked
+// by guardrails that name them.
+func targets(target string, want ...string) bool {
+	if len(want) == 0 {
+		want = []string{""}
+	}
+	for _, t := range want {
+		if t == target || (t == "" && target != ToolResult) {
+			return true
+		}
+	}
+	return false
+}
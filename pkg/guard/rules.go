@@ -0,0 +1,215 @@
+package guard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Rule matches a regular expression against content.
+type Rule struct {
+	Name    string   `json:"name"`
+	Target  string   `json:"target,omitempty"`  // Output, ToolArgs, ToolResult, or "" for the first two
+	Tools   []string `json:"tools,omitempty"`   // Tool name globs the rule applies to (empty = all)
+	Pattern string   `json:"pattern"`           // Regexp searched for in the content
+	Action  string   `json:"action"`            // Warn, Block, Rewrite, or Quarantine (ToolResult)
+	Replace string   `json:"replace,omitempty"` // Rewrite: replacement for each match; $1 expands to a group
+	Reason  string   `json:"reason,omitempty"`  // Reported when the rule fires
+}
+
+type rules []compiledRule
+
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+// Rules returns a guardrail applying rules in order. Each rule's pattern
+// and action are checked up front.
+func Rules(rs ...Rule) (Guardrail, error) {
+	var out rules
+	for i, r := range rs {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("guard: %s: %w", r.Name, err)
+		}
+		if err := checkAction(r.Action); err != nil {
+			return nil, fmt.Errorf("guard: %s: %w", r.Name, err)
+		}
+		if err := checkTarget(r.Target); err != nil {
+			return nil, fmt.Errorf("guard: %s: %w", r.Name, err)
+		}
+		out = append(out, compiledRule{Rule: r, re: re})
+	}
+	return out, nil
+}
+
+func (rs rules) Check(_ context.Context, in Input) (Verdict, error) {
+	rewritten := Verdict{}
+	for _, r := range rs {
+		if !targets(in.Target, r.Target) || !r.re.MatchString(in.Text) {
+			continue
+		}
+		if in.Target != Output && len(r.Tools) > 0 && !matchTool(r.Tools, in.Tool) {
+			continue
+		}
+		reason := r.Reason
+		if reason == "" {
+			reason = "matched " + r.Pattern
+		}
+		switch r.Action {
+		case Rewrite:
+			in.Text = r.re.ReplaceAllString(in.Text, r.Replace)
+			rewritten = Verdict{Action: Rewrite, Rule: r.Name, Reason: reason, Text: in.Text}
+		default:
+			return Verdict{Action: r.Action, Rule: r.Name, Reason: reason}, nil
+		}
+	}
+	return rewritten, nil
+}
+
+func matchTool(patterns []string, tool string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, tool); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Denylist blocks tool calls whose arguments name a denied path or contain
+// a denied command. Every string in the JSON arguments is checked.
+type Denylist struct {
+	Paths    []string `json:"paths,omitempty"`    // Files or directories (everything under them), or globs; ~ is the home directory
+	Commands []string `json:"commands,omitempty"` // Command lines such as "rm -rf /" or "git push --force", matched on word boundaries
+	Dir      string   `json:"-"`                  // Resolves relative paths (empty = only absolute paths and bare names are checked)
+}
+
+func (d Denylist) Check(_ context.Context, in Input) (Verdict, error) {
+	if in.Target != ToolArgs {
+		return Verdict{}, nil
+	}
+	var args any
+	if err := json.Unmarshal([]byte(in.Text), &args); err != nil {
+		args = in.Text // Check malformed arguments as one string
+	}
+	for _, s := range stringsIn(args) {
+		for _, c := range d.Commands {
+			if containsCommand(s, c) {
+				return Verdict{Action: Block, Rule: "deny_commands", Reason: fmt.Sprintf("command %q is denied", c)}, nil
+			}
+		}
+		for _, tok := range strings.FieldsFunc(s, isPathSep) {
+			for _, p := range d.Paths {
+				if d.underPath(tok, p) {
+					return Verdict{Action: Block, Rule: "deny_paths", Reason: fmt.Sprintf("path %s is denied", p)}, nil
+				}
+			}
+		}
+	}
+	return Verdict{}, nil
+}
+
+// underPath reports whether tok names denied or something under it. A
+// denied entry without a slash, such as ".env" or "*.pem", matches that file
+// name in any directory.
+func (d Denylist) underPath(tok, denied string) bool {
+	if !strings.ContainsRune(denied, '/') {
+		ok, _ := filepath.Match(denied, filepath.Base(tok))
+		return ok
+	}
+	tok, denied = d.resolve(tok), d.resolve(denied)
+	if tok == "" || denied == "" {
+		return false
+	}
+	// Check tok and each directory above it, so a denied directory or
+	// glob covers everything under it.
+	for p := tok; ; p = filepath.Dir(p) {
+		if ok, _ := filepath.Match(denied, p); ok || p == denied {
+			return true
+		}
+		if p == filepath.Dir(p) {
+			return false
+		}
+	}
+}
+
+// resolve makes p absolute and clean, returning "" if it is relative and
+// there is no Dir to resolve it against.
+func (d Denylist) resolve(p string) string {
+	p = expandHome(p)
+	if !filepath.IsAbs(p) {
+		if d.Dir == "" {
+			return ""
+		}
+		p = filepath.Join(d.Dir, p)
+	}
+	return filepath.Clean(p)
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + p[1:]
+		}
+	}
+	return p
+}
+
+// isPathSep splits argument strings into candidate paths.
+func isPathSep(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '=' || r == '"' || r == '\'' || r == ';' || r == '|' || r == '&' || r == '>' || r == '<'
+}
+
+// containsCommand reports whether cmd appears in s as whole words, with
+// runs of whitespace treated as one space.
+func containsCommand(s, cmd string) bool {
+	s, cmd = strings.Join(strings.Fields(s), " "), strings.Join(strings.Fields(cmd), " ")
+	if cmd == "" {
+		return false
+	}
+	for i := 0; ; {
+		j := strings.Index(s[i:], cmd)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(cmd)
+		if (start == 0 || isCommandSep(s[start-1])) && (end == len(s) || isCommandSep(s[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isCommandSep(c byte) bool {
+	return strings.IndexByte(" ;|&()`$\"'", c) >= 0
+}
+
+// stringsIn returns every string in a decoded JSON value.
+func stringsIn(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, e := range v {
+			out = append(out, stringsIn(e)...)
+		}
+		return out
+	case map[string]any:
+		var out []string
+		for _, e := range v {
+			out = append(out, stringsIn(e)...)
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package loop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// ErrMalformedArguments is returned when the model keeps calling tools
+// with arguments they reject after being told how to fix them.
+var ErrMalformedArguments = errors.New("model keeps sending malformed tool arguments")
+
+// argRetryNote is the result of a call with malformed arguments, given
+// the call's error and tool.
+const argRetryNote = "Error: %v\n\nThe call was not run. Call %s again with arguments that fix this"
+
+// argRetries counts a run's tool calls with malformed arguments in a row,
+// so the model gets a bounded number of chances to correct them.
+type argRetries struct {
+	limit int // Malformed calls in a row allowed (0 = no limit)
+	count int
+}
+
+// observe records whether a call was rejected for its arguments, and
+// returns an error once more than limit calls in a row have been.
+func (r *argRetries) observe(err error) error {
+	if !errors.Is(err, toolreg.ErrInvalidArguments) {
+		r.count = 0
+		return nil
+	}
+	r.count++
+	if r.limit > 0 && r.count > r.limit {
+		return fmt.Errorf("%w: %d calls in a row, the last: %v", ErrMalformedArguments, r.count, err)
+	}
+	return nil
+}
+
+// argHint tells the model why a call was rejected for its arguments and
+// how to fix it, with the parameter schema of the tool it called if it was
+// offered one.
+func argHint(tc provider.ToolCall, defs []provider.ToolDef, err error) string {
+	hint := fmt.Sprintf(argRetryNote, err, tc.Name)
+	for _, d := range defs {
+		if d.Name != tc.Name || d.Parameters == nil {
+			continue
+		}
+		if schema, err := json.Marshal(d.Parameters); err == nil {
+			return hint + ", matching its parameters:\n" + string(schema)
+		}
+	}
+	return hint + "."
+}
@@ -0,0 +1,89 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func greetRegistry(calls *int) *toolreg.Registry {
+	reg := toolreg.NewRegistry(30 * time.Second)
+	reg.Register(&toolreg.ToolManifest{
+		Name: "greet",
+		Commands: map[string]toolreg.CommandDef{"say": {
+			Parameters: map[string]toolreg.ParameterDef{"name": {Type: "string", Required: true}},
+			Handler: func(_ context.Context, args map[string]any) (toolreg.ToolResult, error) {
+				*calls++
+				return toolreg.ToolResult{Stdout: "Hello, " + args["name"].(string)}, nil
+			},
+		}},
+	})
+	return reg
+}
+
+func TestRun_MalformedToolArguments(t *testing.T) {
+	mp := mockProvider(
+		providertest.ToolCall("greet.say", `{"name": "Ada"`),
+		providertest.ToolCall("greet.say", `{"nmae": "Ada"}`),
+		providertest.ToolCall("greet.say", `{"name": "Ada"}`),
+		providertest.Text("Greeted Ada."),
+	)
+	var calls int
+	al := makeLoop(t, mp, greetRegistry(&calls))
+
+	answer, err := al.Run(context.Background(), "Greet Ada")
+	if err != nil || answer != "Greeted Ada." {
+		t.Fatalf("Run = %q, %v", answer, err)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+	for i, want := range []string{"not a JSON object", `missing required parameter "name"`} {
+		msgs := mp.Call(i + 1).Messages
+		result := msgs[len(msgs)-1].Content
+		if !strings.Contains(result, want) || !strings.Contains(result, "Call greet.say again") || !strings.Contains(result, `"required":["name"]`) {
+			t.Errorf("result of call %d = %q, want the error and the parameter schema", i+1, result)
+		}
+	}
+}
+
+func TestRun_MalformedToolArgumentsLimit(t *testing.T) {
+	mp := mockProvider()
+	for i := range 10 {
+		mp.Then(providertest.ToolCall("greet.say", fmt.Sprintf(`{"who": "Ada %d"}`, i)))
+	}
+	var calls int
+	al := makeLoop(t, mp, greetRegistry(&calls))
+	al.cfg.ArgRetries = 2
+
+	_, err := al.Run(context.Background(), "Greet Ada")
+	if !errors.Is(err, ErrMalformedArguments) || !strings.Contains(err.Error(), `unknown parameter "who"`) {
+		t.Fatalf("err = %v, want ErrMalformedArguments", err)
+	}
+	// Two chances to correct the call, then the run stops.
+	if len(mp.Calls()) != 3 {
+		t.Errorf("LLM calls = %d, want 3", len(mp.Calls()))
+	}
+	if calls != 0 {
+		t.Errorf("handler ran %d times, want 0", calls)
+	}
+}
+
+func TestArgHint(t *testing.T) {
+	defs := []provider.ToolDef{{Name: "greet.say", Parameters: map[string]any{"type": "object"}}}
+	err := fmt.Errorf("greet.say: %w: missing required parameter %q", toolreg.ErrInvalidArguments, "name")
+	got := argHint(provider.ToolCall{Name: "greet.say"}, defs, err)
+	if !strings.HasPrefix(got, `Error: greet.say: invalid arguments: missing required parameter "name"`) || !strings.HasSuffix(got, "matching its parameters:\n"+`{"type":"object"}`) {
+		t.Errorf("hint = %q", got)
+	}
+	if got := argHint(provider.ToolCall{Name: "other.run"}, defs, err); !strings.HasSuffix(got, "Call other.run again with arguments that fix this.") {
+		t.Errorf("hint without a schema = %q", got)
+	}
+}
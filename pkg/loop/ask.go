@@ -0,0 +1,106 @@
+package loop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// AskTool is the tool the model calls to ask the user a question. It is
+// offered only when the run has RunOptions.Ask set, since scheduled runs
+// have nobody to answer.
+const AskTool = "user.ask"
+
+// AskFunc shows question to the user in the run's channel and waits for
+// the answer.
+type AskFunc func(ctx context.Context, question string) (string, error)
+
+var askToolDef = provider.ToolDef{
+	Name:        AskTool,
+	Description: "Ask the user a clarifying question and wait for the answer. Use it when the request is ambiguous and guessing wrong would waste work, not for confirmation of routine steps.",
+	Parameters: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"question": map[string]any{"type": "string", "description": "The question, phrased so it can be answered briefly"},
+		},
+		"required": []string{"question"},
+	},
+}
+
+// ask handles a call to AskTool. The run pauses until the user answers or
+// Config.AskTimeout passes; a timeout is reported to the model as a result,
+// not an error, so it carries on with its best guess.
+func (al *AgentLoop) ask(ctx context.Context, opts RunOptions, tc provider.ToolCall) (toolreg.ToolResult, error) {
+	var args struct {
+		Question string `json:"question"`
+	}
+	if err := json.Unmarshal([]byte(tc.Arguments), &args); err != nil {
+		return toolreg.ToolResult{}, fmt.Errorf("%s: %w: not a JSON object (%v)", AskTool, toolreg.ErrInvalidArguments, err)
+	}
+	if strings.TrimSpace(args.Question) == "" {
+		return toolreg.ToolResult{}, fmt.Errorf("%s: %w: question is required", AskTool, toolreg.ErrInvalidArguments)
+	}
+
+	askCtx := ctx
+	if al.cfg.AskTimeout > 0 {
+		var cancel context.CancelFunc
+		askCtx, cancel = context.WithTimeout(ctx, al.cfg.AskTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	answer, err := opts.Ask(askCtx, args.Question)
+	res := toolreg.ToolResult{Stdout: answer, Duration: time.Since(start)}
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		res.Stdout = fmt.Sprintf("The user did not answer within %s. Continue with your best judgment and say what you assumed.", al.cfg.AskTimeout)
+		return res, nil
+	}
+	return res, err
+}
+
+// confirm returns a toolreg.ConfirmFunc that puts yes-or-no questions to
+// the user through opts.Ask, such as whether a tool may use the network.
+// Each question is asked once per run and its answer reused. Anything but
+// a yes, including no answer within Config.AskTimeout, is a no.
+func (al *AgentLoop) confirm(opts RunOptions) toolreg.ConfirmFunc {
+	var mu sync.Mutex
+	answers := make(map[string]bool)
+	return func(ctx context.Context, question string) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ok, seen := answers[question]; seen {
+			return ok, nil
+		}
+		askCtx := ctx
+		if al.cfg.AskTimeout > 0 {
+			var cancel context.CancelFunc
+			askCtx, cancel = context.WithTimeout(ctx, al.cfg.AskTimeout)
+			defer cancel()
+		}
+		answer, err := opts.Ask(askCtx, question)
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		answers[question] = isYes(answer)
+		return answers[question], nil
+	}
+}
+
+// isYes reports whether answer approves.
+func isYes(answer string) bool {
+	word, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(answer)), " ")
+	switch strings.TrimRight(word, ".!,") {
+	case "y", "yes", "ok", "okay", "sure", "allow", "approve", "approved":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package loop
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func askCall(question string) *provider.ChatResponse {
+	return &provider.ChatResponse{ToolCalls: []provider.ToolCall{{ID: "q1", Name: AskTool, Arguments: `{"question":"` + question + `"}`}}}
+}
+
+func TestRun_AskUser(t *testing.T) {
+	mp := mockProvider(
+		providertest.Respond(askCall("Which colour?")),
+		providertest.Text("Painting it blue"),
+	)
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+
+	var asked string
+	opts := RunOptions{Ask: func(_ context.Context, q string) (string, error) {
+		asked = q
+		return "blue", nil
+	}}
+	if _, err := al.RunWith(context.Background(), "paint the shed", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if asked != "Which colour?" {
+		t.Errorf("asked %q", asked)
+	}
+	if tools := mp.Call(0).Tools; len(tools) != 1 || tools[0].Name != AskTool {
+		t.Errorf("tools sent = %+v", tools)
+	}
+	msgs := mp.Call(1).Messages
+	if last := msgs[len(msgs)-1]; last.Role != "tool" || last.Content != "blue" {
+		t.Errorf("tool result = %+v", last)
+	}
+}
+
+func TestRun_AskUserNotOfferedWithoutChannel(t *testing.T) {
+	mp := mockProvider(providertest.Text("ok"))
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+	if _, err := al.Run(context.Background(), "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if len(mp.Call(0).Tools) != 0 {
+		t.Errorf("tools sent = %+v", mp.Call(0).Tools)
+	}
+}
+
+func TestRun_AskUserTimeout(t *testing.T) {
+	mp := mockProvider(
+		providertest.Respond(askCall("Which colour?")),
+		providertest.Text("Went with red"),
+	)
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+	al.cfg.AskTimeout = 10 * time.Millisecond
+
+	opts := RunOptions{Ask: func(ctx context.Context, _ string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}}
+	if _, err := al.RunWith(context.Background(), "paint the shed", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msgs := mp.Call(1).Messages
+	if last := msgs[len(msgs)-1]; !strings.Contains(last.Content, "did not answer within 10ms") {
+		t.Errorf("tool result = %+v", last)
+	}
+}
+
+func TestRun_ConfirmNetwork(t *testing.T) {
+	call := &provider.ChatResponse{ToolCalls: []provider.ToolCall{{ID: "tc1", Name: "fetch.url", Arguments: `{"url":"https://example.com"}`}}}
+	mp := mockProvider(
+		providertest.Respond(call),
+		providertest.Respond(call),
+		providertest.Text("done"),
+	)
+	reg := toolreg.NewRegistry(30 * time.Second)
+	reg.Register(&toolreg.ToolManifest{
+		Name:     "fetch",
+		Binary:   "echo",
+		Network:  true,
+		Commands: map[string]toolreg.CommandDef{"url": {Description: "Fetch a URL", Args: "{url}"}},
+	})
+	al := makeLoop(t, mp, reg)
+	al.cfg.Permissions = &toolreg.Profile{Name: "careful", Network: toolreg.NetworkAsk}
+
+	var asked []string
+	opts := RunOptions{Ask: func(_ context.Context, q string) (string, error) {
+		asked = append(asked, q)
+		return "Yes.", nil
+	}}
+	if _, err := al.RunWith(context.Background(), "fetch it", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(asked) != 1 || !strings.Contains(asked[0], "fetch.url") {
+		t.Errorf("asked %q, want one question about fetch.url", asked)
+	}
+	msgs := mp.Call(2).Messages
+	if last := msgs[len(msgs)-1]; !strings.Contains(last.Content, "https://example.com") {
+		t.Errorf("tool result = %+v", last)
+	}
+
+	// A scheduled run has nobody to ask, so it isn't offered the tool.
+	mp = mockProvider(providertest.Text("ok"))
+	al = makeLoop(t, mp, reg)
+	al.cfg.Permissions = &toolreg.Profile{Name: "careful", Network: toolreg.NetworkAsk}
+	if _, err := al.Run(context.Background(), "fetch it"); err != nil {
+		t.Fatal(err)
+	}
+	if len(mp.Call(0).Tools) != 0 {
+		t.Errorf("tools sent = %+v", mp.Call(0).Tools)
+	}
+}
@@ -0,0 +1,80 @@
+package loop
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
+)
+
+// ErrNoCheckpoint is returned by Resume when the session has no unfinished
+// run.
+var ErrNoCheckpoint = errors.New("no unfinished run to resume")
+
+// interruptedToolNote answers a tool call that was in flight when a run
+// was cut short. Running it again could repeat its side effects.
+const interruptedToolNote = "[This tool call was interrupted by a restart and did not report a result. It may or may not have taken effect; check before retrying it.]"
+
+// Resume finishes the session's run that was cut short by a crash or
+// restart, from its last checkpoint (see Config.Checkpoint).
+func (al *AgentLoop) Resume(ctx context.Context) (string, error) {
+	return al.ResumeWith(ctx, RunOptions{})
+}
+
+// ResumeWith is Resume with per-run overrides. The run keeps its intent
+// and model unless opts sets them, and its ID and tags. Tool calls that
+// were in flight are not run again; the model is told they were
+// interrupted.
+func (al *AgentLoop) ResumeWith(ctx context.Context, opts RunOptions) (string, error) {
+	cp := al.sessions.GetCheckpoint(al.cfg.SessionKey)
+	if cp == nil {
+		return "", fmt.Errorf("session %s: %w", al.cfg.SessionKey, ErrNoCheckpoint)
+	}
+	opts.Intent = cmp.Or(opts.Intent, cp.Intent)
+	opts.Model = cmp.Or(opts.Model, cp.Model)
+	return al.runWith(ctx, cp.Prompt, opts, cp)
+}
+
+// resumeMessages returns the checkpoint's conversation with its pending
+// tool calls answered, adding the answers to the session.
+func (al *AgentLoop) resumeMessages(key string, cp *session.Checkpoint, tr *transcript.Run, rm runMeta) []provider.Message {
+	if al.cfg.Verbose {
+		log.Printf("[loop] resuming %s after %d iterations, %d tool calls pending", key, cp.Iteration, len(cp.Pending))
+	}
+	messages := cp.Messages
+	for _, tc := range cp.Pending {
+		msg := provider.Message{Role: "tool", Content: interruptedToolNote, ToolCallID: tc.ID, Meta: rm.stamp("", 0)}
+		messages = append(messages, msg)
+		al.sessions.AddMessage(key, msg)
+		tr.Message(cp.Iteration, msg)
+	}
+	return messages
+}
+
+// checkpoint saves the run's progress to its session when Config.Checkpoint
+// is set: messages is what the next LLM call would be sent, after
+// iteration calls, with pending tool calls still to answer. saved counts
+// the messages the session's checkpoint already holds, or is -1 if it
+// holds none of this run's, e.g. after the prompt was trimmed. Only the
+// messages added since are journaled, and the journal keeps them across a
+// crash, so the session isn't rewritten after every step. Nothing is
+// saved once ctx is done, since a tool killed by a shutdown would be
+// recorded as failed.
+func (al *AgentLoop) checkpoint(ctx context.Context, key string, cp *session.Checkpoint, saved *int, messages []provider.Message, iteration int, pending []provider.ToolCall) {
+	if !al.cfg.Checkpoint || ctx.Err() != nil {
+		return
+	}
+	cp.Messages, cp.Iteration, cp.Pending, cp.Updated = messages, iteration, pending, time.Now()
+	if *saved < 0 || *saved > len(messages) {
+		al.sessions.SetCheckpoint(key, cp)
+	} else {
+		al.sessions.AdvanceCheckpoint(key, messages[*saved:], iteration, pending)
+	}
+	*saved = len(messages)
+}
@@ -0,0 +1,34 @@
+package loop
+
+import (
+	"context"
+	"log"
+)
+
+// compact folds the session's older messages into its summary with
+// Config.Summarizer once it holds more than Config.CompactAfter messages,
+// keeping the last Config.CompactKeep. A failure is logged and leaves the
+// session as it was; the next run tries again.
+func (al *AgentLoop) compact(ctx context.Context, key string) {
+	if al.cfg.Summarizer == nil {
+		return
+	}
+	n := al.sessions.MessageCount(key)
+	if n <= al.cfg.CompactAfter {
+		return
+	}
+	ok, err := al.sessions.Compact(ctx, key, al.cfg.Summarizer, al.cfg.CompactKeep)
+	if err != nil {
+		log.Printf("[loop] compact %s: %v", key, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if err := al.sessions.Save(key); err != nil {
+		log.Printf("[loop] compact %s: %v", key, err)
+	}
+	if al.cfg.Verbose {
+		log.Printf("[loop] compacted %s: %d messages folded into the summary", key, n-al.sessions.MessageCount(key))
+	}
+}
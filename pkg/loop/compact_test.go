@@ -0,0 +1,39 @@
+package loop
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/summarize"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func TestRun_Compaction(t *testing.T) {
+	mp := mockProvider(providertest.Text("Use port 8080."), providertest.Text("Done."), providertest.Text("It was 8080."))
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+	al.cfg.Summarizer = &summarize.Extractive{}
+	al.cfg.CompactAfter, al.cfg.CompactKeep = 3, 2
+
+	for _, prompt := range []string{"Which port should the API use?", "Start it"} {
+		if _, err := al.Run(context.Background(), prompt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := al.sessions.MessageCount("main"); n != 2 {
+		t.Errorf("history after compaction = %d messages, want 2", n)
+	}
+	summary := al.sessions.GetSummary("main")
+	if !strings.Contains(summary, "- User: Which port should the API use?") || !strings.Contains(summary, "- Assistant: Use port 8080.") {
+		t.Errorf("summary = %q", summary)
+	}
+
+	if _, err := al.Run(context.Background(), "Which port was it?"); err != nil {
+		t.Fatal(err)
+	}
+	if system := mp.Call(2).Messages[0].Content; !strings.Contains(system, "Use port 8080.") {
+		t.Errorf("the summary is missing from the system prompt:\n%s", system)
+	}
+}
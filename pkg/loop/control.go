@@ -0,0 +1,91 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// ErrInterrupted is returned by Run when Interrupt stops an active run.
+var ErrInterrupted = errors.New("run interrupted")
+
+// ErrShutdown is the cause a daemon cancels its runs' context with when it
+// shuts down (see context.WithCancelCause). With Config.Checkpoint, runs
+// cancelled for it keep their checkpoint, so they can be resumed.
+var ErrShutdown = errors.New("shutting down")
+
+// activeRun tracks an in-progress run so it can be interrupted or steered.
+type activeRun struct {
+	cancel context.CancelCauseFunc
+	steer  []string // Pending steering messages, oldest first
+}
+
+// Interrupt stops the active run for sessionKey. The run saves its session
+// and returns ErrInterrupted. It reports whether a run was active.
+func (al *AgentLoop) Interrupt(sessionKey string) bool {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	run, ok := al.runs[sessionKey]
+	if ok {
+		run.cancel(ErrInterrupted)
+	}
+	return ok
+}
+
+// Steer queues a user message for the active run on sessionKey. It is added
+// to the conversation before the next LLM call, letting a caller redirect a
+// long run ("stop, try a different approach"). It reports whether a run was
+// active; if not, the message is dropped and should be sent with Run instead.
+func (al *AgentLoop) Steer(sessionKey, message string) bool {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	run, ok := al.runs[sessionKey]
+	if ok {
+		run.steer = append(run.steer, message)
+	}
+	return ok
+}
+
+// begin registers a run for key and returns its cancellable context and a
+// function that unregisters it.
+func (al *AgentLoop) begin(ctx context.Context, key string) (context.Context, func(), error) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if _, busy := al.runs[key]; busy {
+		return nil, nil, fmt.Errorf("session %s already has a run in progress", key)
+	}
+	runCtx, cancel := context.WithCancelCause(toolreg.WithSessionKey(ctx, key))
+	al.runs[key] = &activeRun{cancel: cancel}
+	end := func() {
+		al.mu.Lock()
+		delete(al.runs, key)
+		al.mu.Unlock()
+		cancel(nil)
+	}
+	return runCtx, end, nil
+}
+
+// drainSteering returns and clears pending steering messages for key.
+func (al *AgentLoop) drainSteering(key string) []string {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	run, ok := al.runs[key]
+	if !ok {
+		return nil
+	}
+	msgs := run.steer
+	run.steer = nil
+	return msgs
+}
+
+// interrupted reports whether ctx was cancelled by Interrupt.
+func interrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrInterrupted)
+}
+
+// shuttingDown reports whether ctx was cancelled with ErrShutdown.
+func shuttingDown(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrShutdown)
+}
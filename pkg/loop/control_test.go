@@ -0,0 +1,134 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// blockingProvider signals started and blocks until its context ends.
+type blockingProvider struct {
+	started chan struct{}
+}
+
+func (b *blockingProvider) Name() string { return "blocking" }
+
+func (b *blockingProvider) Chat(ctx context.Context, _ provider.ChatRequest) (*provider.ChatResponse, error) {
+	close(b.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestInterrupt(t *testing.T) {
+	bp := &blockingProvider{started: make(chan struct{})}
+	al := makeLoop(t, bp, toolreg.NewRegistry(30*time.Second))
+
+	if al.Interrupt("main") {
+		t.Fatal("Interrupt reported an active run before Run started")
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := al.Run(context.Background(), "long task")
+		errc <- err
+	}()
+	<-bp.started
+
+	if !al.Interrupt("main") {
+		t.Fatal("Interrupt found no active run")
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrInterrupted) {
+			t.Fatalf("err = %v, want ErrInterrupted", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run did not stop after Interrupt")
+	}
+
+	// The user message survives the interruption.
+	if h := al.sessions.GetHistory("main"); len(h) == 0 || h[0].Content != "long task" {
+		t.Errorf("history = %+v", h)
+	}
+}
+
+func TestSteer(t *testing.T) {
+	mp := mockProvider(
+		providertest.Respond(&provider.ChatResponse{ToolCalls: []provider.ToolCall{{ID: "tc1", Name: "work.step", Arguments: `{}`}}}),
+		providertest.Text("switched approach"),
+	)
+	reg := toolreg.NewRegistry(30 * time.Second)
+	al := makeLoop(t, mp, reg)
+	reg.Register(&toolreg.ToolManifest{
+		Name: "work",
+		Commands: map[string]toolreg.CommandDef{
+			"step": {Handler: func(ctx context.Context, args map[string]any) (toolreg.ToolResult, error) {
+				if !al.Steer("main", "stop, try a different approach") {
+					t.Error("Steer found no active run")
+				}
+				return toolreg.ToolResult{Stdout: "step done"}, nil
+			}},
+		},
+	})
+
+	if _, err := al.Run(context.Background(), "do the thing"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	msgs := mp.Call(1).Messages
+	last := msgs[len(msgs)-1]
+	if last.Role != "user" || last.Content != "stop, try a different approach" {
+		t.Errorf("last message = %+v, want steering message", last)
+	}
+	if al.Steer("main", "too late") {
+		t.Error("Steer succeeded after the run finished")
+	}
+}
+
+func TestRun_SessionBusy(t *testing.T) {
+	bp := &blockingProvider{started: make(chan struct{})}
+	al := makeLoop(t, bp, toolreg.NewRegistry(30*time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		al.Run(ctx, "first")
+		close(done)
+	}()
+	<-bp.started
+
+	if _, err := al.Run(context.Background(), "second"); err == nil {
+		t.Error("expected error for concurrent run on the same session")
+	}
+	cancel()
+	<-done
+}
+
+func TestToolsSeeSessionKey(t *testing.T) {
+	reg := toolreg.NewRegistry(30 * time.Second)
+	var got string
+	reg.Register(&toolreg.ToolManifest{
+		Name: "whoami",
+		Commands: map[string]toolreg.CommandDef{
+			"run": {Handler: func(ctx context.Context, args map[string]any) (toolreg.ToolResult, error) {
+				got = toolreg.SessionKey(ctx)
+				return toolreg.ToolResult{Stdout: "ok"}, nil
+			}},
+		},
+	})
+	mp := mockProvider(
+		providertest.Respond(&provider.ChatResponse{ToolCalls: []provider.ToolCall{{ID: "tc1", Name: "whoami.run", Arguments: `{}`}}}),
+		providertest.Text("done"),
+	)
+	al := makeLoop(t, mp, reg)
+	if _, err := al.Run(context.Background(), "go"); err != nil {
+		t.Fatal(err)
+	}
+	if got != al.cfg.SessionKey {
+		t.Errorf("SessionKey = %q, want %q", got, al.cfg.SessionKey)
+	}
+}
@@ -0,0 +1,28 @@
+package loop
+
+import (
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// Event types reported to RunOptions.OnEvent.
+const (
+	EventToolStart = "tool_start" // A tool call is about to execute
+	EventToolEnd   = "tool_end"   // A tool call finished; Result/Err are set
+)
+
+// Event reports progress within a run, e.g. to show tool activity in a chat UI.
+type Event struct {
+	Type      string
+	Iteration int
+	ToolCall  provider.ToolCall
+	Result    string             // Raw tool output (EventToolEnd)
+	Output    toolreg.ToolResult // Stdout, stderr, exit code, and duration (EventToolEnd)
+	Err       error              // Tool error (EventToolEnd)
+}
+
+func (o RunOptions) emit(e Event) {
+	if o.OnEvent != nil {
+		o.OnEvent(e)
+	}
+}
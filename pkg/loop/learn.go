@@ -0,0 +1,128 @@
+package loop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// LearningStore saves learnings extracted after runs. eval.Client
+// implements it.
+type LearningStore interface {
+	StoreLearning(ctx context.Context, content string, tags []string) error
+}
+
+// maxLearnings caps how many learnings one run may store.
+const maxLearnings = 3
+
+const learnPrompt = `The conversation below is a run of an AI agent that uses tools. The run %s.
+Extract 1-%d concise, reusable learnings that would make future runs more
+effective: tool usage that worked or failed, dead ends to avoid, facts about
+the environment. Each learning is one sentence. Skip anything specific to this
+one task. Return an empty list if there is nothing worth keeping.
+
+%s`
+
+var learnSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"learnings": map[string]any{
+			"type":     "array",
+			"items":    map[string]any{"type": "string"},
+			"maxItems": maxLearnings,
+		},
+	},
+	"required": []string{"learnings"},
+}
+
+// extractLearnings asks the model for learnings from a finished run and
+// saves them to Config.Learnings, tagged with the run's intent. The call
+// counts toward the run's usage and cost like any other. Failures are
+// logged, never returned.
+func (al *AgentLoop) extractLearnings(ctx context.Context, p provider.Provider, opts RunOptions, iteration int, run []provider.Message, runErr error) {
+	if al.cfg.Learnings == nil || len(run) == 0 || ctx.Err() != nil || errors.Is(runErr, ErrInterrupted) {
+		return
+	}
+	outcome := "succeeded"
+	if runErr != nil {
+		outcome = "failed: " + truncate(runErr.Error(), 200)
+	}
+
+	model, err := al.budgetModel(opts.Model)
+	if err != nil {
+		return
+	}
+
+	var transcript strings.Builder
+	for _, m := range run {
+		fmt.Fprintf(&transcript, "[%s] %s\n", m.Role, truncate(m.Content, 1000))
+		for _, tc := range m.ToolCalls {
+			fmt.Fprintf(&transcript, "[tool call] %s(%s)\n", tc.Name, truncate(tc.Arguments, 200))
+		}
+	}
+	resp, usd, err := al.chat(ctx, p, iteration, provider.ChatRequest{
+		Model:          model,
+		Messages:       []provider.Message{{Role: "user", Content: fmt.Sprintf(learnPrompt, outcome, maxLearnings, transcript.String())}},
+		ResponseFormat: provider.FormatJSONSchema,
+		ResponseSchema: learnSchema,
+		Intent:         "learnings",
+		CostTier:       opts.CostTier,
+	})
+	if err != nil {
+		log.Printf("[loop] extract learnings: %v", err)
+		return
+	}
+	if opts.Usage != nil {
+		opts.Usage.PromptTokens += resp.Usage.PromptTokens
+		opts.Usage.CompletionTokens += resp.Usage.CompletionTokens
+	}
+	if opts.Cost != nil {
+		*opts.Cost += usd
+	}
+	al.sessions.AddCost(al.cfg.SessionKey, usd)
+
+	var out struct {
+		Learnings []string `json:"learnings"`
+	}
+	if err := json.Unmarshal([]byte(resp.Content), &out); err != nil {
+		log.Printf("[loop] extract learnings: decode: %v", err)
+		return
+	}
+	tags := learningTags(opts.Intent, runErr)
+	stored := 0
+	for _, l := range out.Learnings {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		if stored == maxLearnings {
+			break
+		}
+		if err := al.cfg.Learnings.StoreLearning(ctx, l, tags); err != nil {
+			log.Printf("[loop] store learning: %v", err)
+			return
+		}
+		stored++
+		if al.cfg.Verbose {
+			log.Printf("[loop] learning: %s", l)
+		}
+	}
+}
+
+// learningTags tags a learning with its source and the run's intent, so
+// later runs with the same intent can find it.
+func learningTags(intent string, runErr error) []string {
+	if intent == "" {
+		intent = "run"
+	}
+	tags := []string{"orchestrator", "auto", intent}
+	if runErr != nil {
+		tags = append(tags, "failure")
+	}
+	return tags
+}
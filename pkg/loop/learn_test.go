@@ -0,0 +1,102 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+type learning struct {
+	content string
+	tags    []string
+}
+
+type fakeLearnings struct {
+	stored []learning
+}
+
+func (f *fakeLearnings) StoreLearning(_ context.Context, content string, tags []string) error {
+	f.stored = append(f.stored, learning{content, tags})
+	return nil
+}
+
+func TestExtractLearnings(t *testing.T) {
+	mp := mockProvider(
+		providertest.Text("done"),
+		providertest.Text(`{"learnings": ["Use git.log before git.diff", " ", "Tests live next to sources", "one", "too many"]}`),
+	)
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+	store := &fakeLearnings{}
+	al.cfg.Learnings = store
+
+	if _, err := al.RunWith(context.Background(), "review the repo", RunOptions{Intent: "coding"}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(mp.Calls()) != 2 {
+		t.Fatalf("calls = %d, want run + extraction", len(mp.Calls()))
+	}
+	req := mp.Call(1)
+	if req.Intent != "learnings" || req.ResponseFormat != provider.FormatJSONSchema ||
+		!strings.Contains(req.Messages[0].Content, "[user] review the repo") || !strings.Contains(req.Messages[0].Content, "succeeded") {
+		t.Errorf("extraction request = %+v", req)
+	}
+	if len(store.stored) != 3 || store.stored[0].content != "Use git.log before git.diff" || store.stored[2].content != "one" {
+		t.Errorf("stored = %+v", store.stored)
+	}
+	if !slices.Equal(store.stored[0].tags, []string{"orchestrator", "auto", "coding"}) {
+		t.Errorf("tags = %v", store.stored[0].tags)
+	}
+}
+
+func TestExtractLearningsCountsUsage(t *testing.T) {
+	mp := mockProvider(
+		providertest.Respond(&provider.ChatResponse{Content: "done", Usage: provider.Usage{PromptTokens: 20, CompletionTokens: 10}}),
+		providertest.Respond(&provider.ChatResponse{Content: `{"learnings": ["one"]}`, Usage: provider.Usage{PromptTokens: 7, CompletionTokens: 3}}),
+	)
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+	al.cfg.Learnings = &fakeLearnings{}
+
+	var u provider.Usage
+	if _, err := al.RunWith(context.Background(), "go", RunOptions{Usage: &u}); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if u.PromptTokens != 27 || u.CompletionTokens != 13 {
+		t.Errorf("usage = %+v, want the extraction counted", u)
+	}
+}
+
+func TestExtractLearningsAfterFailure(t *testing.T) {
+	mp := mockProvider(
+		providertest.Fail(errors.New("rate limited")),
+		providertest.Text(`{"learnings": ["Back off on rate limits"]}`),
+	)
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+	store := &fakeLearnings{}
+	al.cfg.Learnings = store
+
+	if _, err := al.Run(context.Background(), "go"); err == nil {
+		t.Fatal("expected run error")
+	}
+	if !strings.Contains(mp.Call(1).Messages[0].Content, "failed: LLM call failed") {
+		t.Errorf("prompt = %s", mp.Call(1).Messages[0].Content)
+	}
+	if len(store.stored) != 1 || !slices.Equal(store.stored[0].tags, []string{"orchestrator", "auto", "run", "failure"}) {
+		t.Errorf("stored = %+v", store.stored)
+	}
+}
+
+func TestExtractLearningsOff(t *testing.T) {
+	mp := mockProvider(providertest.Text("done"))
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+	al.Run(context.Background(), "go")
+	if len(mp.Calls()) != 1 {
+		t.Errorf("calls = %d, want no extraction when Learnings is nil", len(mp.Calls()))
+	}
+}
@@ -2,17 +2,32 @@
 package loop
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os/exec"
-	"strings"
+	"maps"
+	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/audit"
 	ctxpkg "github.com/rcliao/teeny-orchestrator/pkg/context"
+	"github.com/rcliao/teeny-orchestrator/pkg/cost"
+	"github.com/rcliao/teeny-orchestrator/pkg/eval"
+	"github.com/rcliao/teeny-orchestrator/pkg/guard"
+	"github.com/rcliao/teeny-orchestrator/pkg/metrics"
 	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/queue"
 	"github.com/rcliao/teeny-orchestrator/pkg/session"
 	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
 )
 
 // Config for the agent loop.
@@ -20,10 +35,52 @@ type Config struct {
 	MaxIterations int
 	SessionKey    string
 	Verbose       bool
-	AutoCapture   bool   // Record calls to token-eval
-	EvalBinary    string // Path to token-eval binary
+	AutoCapture   bool          // Record LLM calls
+	EvalBinary    string        // Path to token-eval binary (used when Recorder is nil)
+	Recorder      eval.Recorder // Where calls are captured (default: token-eval binary)
+
+	MaxToolOutput       int  // Bytes per tool result before it is shrunk (0 = unlimited)
+	SummarizeToolOutput bool // Summarize oversized results with the provider instead of truncating
+	WrapToolResults     bool // Mark tool results as untrusted data the model shouldn't take instructions from (guard.Wrap)
+
+	TracerProvider trace.TracerProvider // Spans for runs and LLM calls (default: otel global provider)
+	Metrics        *metrics.Metrics     // LLM call, token, and iteration metrics (nil = off)
+	Pricing        *cost.Table          // Per-model prices for cost tracking (nil = no cost)
+	Budget         *cost.Tracker        // Spend limits checked before each LLM call (nil = unlimited); wrap the provider in cost.Track to record spend
+	BudgetModel    string               // Model used once a budget is spent ("" = refuse to run)
+	Learnings      LearningStore        // If set, learnings are extracted after each run and saved here
+	Permissions    *toolreg.Profile     // Tools the session may call (nil = all)
+	AskTimeout     time.Duration        // How long AskTool waits for an answer (0 = until the run ends)
+	RepeatLimit    int                  // Repeated tool calls before the model is warned, then stopped (0 = off)
+	ArgRetries     int                  // Tool calls in a row with malformed arguments the model may correct before the run fails (0 = no limit)
+	Sampling       provider.Sampling    // Max tokens, temperature, and other generation settings (zero = provider defaults)
+	Thinking       string               // What happens to extended thinking after a run: ThinkingDiscard, ThinkingLog, or ThinkingSave
+	MaxContinues   int                  // Times an answer cut off by max tokens is continued (0 = return it truncated)
+	Models         *provider.Catalog    // Context windows, to warn when a prompt nears one (nil = no warnings)
+	Runs           *Runs                // Tracks runs started with Submit (nil = the loop keeps its own)
+	Queue          *queue.Queue         // Admits runs one per session and caps them globally (nil = no waiting)
+	Transcripts    *transcript.Writer   // Where each run's JSONL transcript is written (nil = none)
+	Guard          *guard.Guard         // Checks answers and tool arguments against content policies, and tool results for injections (nil = no checks)
+	Audit          *audit.Log           // Tamper-evident record of who started each run, its tool calls, and its cost (nil = none)
+
+	Summarizer   session.Summarizer // Folds older history into the session summary after a run (nil = never compact)
+	CompactAfter int                // Messages in a session before a run compacts it
+	CompactKeep  int                // Most recent messages compaction keeps verbatim
+
+	Checkpoint bool // Save each run's progress to its session after every step, so ResumeWith can finish a run cut short by a crash or restart
+
+	ReflectionEnabled bool   // Have the model check the final answer against the request and tool results, and fix clear errors
+	ReflectionModel   string // Model for that check, e.g. a cheaper one ("" = the run's model)
 }
 
+// Thinking modes for Config.Thinking. Within a run, thinking is always
+// passed back to the provider with the tool results that follow it.
+const (
+	ThinkingDiscard = ""     // Not kept in the session (default)
+	ThinkingLog     = "log"  // Logged as it arrives, not kept in the session
+	ThinkingSave    = "save" // Kept in the session history
+)
+
 // DefaultConfig returns sensible defaults.
 func DefaultConfig() Config {
 	return Config{
@@ -31,6 +88,13 @@ func DefaultConfig() Config {
 		SessionKey:    "main",
 		AutoCapture:   true,
 		EvalBinary:    "token-eval",
+		MaxToolOutput: 32 * 1024,
+		AskTimeout:    10 * time.Minute,
+		RepeatLimit:   3,
+		ArgRetries:    3,
+		MaxContinues:  3,
+		CompactAfter:  200,
+		CompactKeep:   40,
 	}
 }
 
@@ -41,90 +105,448 @@ type AgentLoop struct {
 	ctxBuilder *ctxpkg.Builder
 	sessions   *session.Manager
 	cfg        Config
+	tracer     trace.Tracer
+
+	mu        sync.Mutex            // guards runs
+	runs      map[string]*activeRun // keyed by session key
+	submitted *Runs                 // Runs started with Submit
+	replay    *replay               // Plays back a transcript instead of running tools (see Replay)
 }
 
 // New creates an agent loop.
 func New(p provider.Provider, reg *toolreg.Registry, cb *ctxpkg.Builder, sm *session.Manager, cfg Config) *AgentLoop {
+	if cfg.AutoCapture && cfg.Recorder == nil && cfg.EvalBinary != "" {
+		cfg.Recorder = eval.NewExecRecorder(cfg.EvalBinary)
+	}
+	tp := cfg.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	submitted := cfg.Runs
+	if submitted == nil {
+		submitted = NewRuns(0)
+	}
 	return &AgentLoop{
 		provider:   p,
 		registry:   reg,
 		ctxBuilder: cb,
 		sessions:   sm,
 		cfg:        cfg,
+		runs:       make(map[string]*activeRun),
+		submitted:  submitted,
+		tracer:     tp.Tracer(tracerName),
 	}
 }
 
+// RunOptions overrides loop settings for a single run.
+type RunOptions struct {
+	Provider       provider.Provider   // Replaces the loop's provider for this run
+	Model          string              // Model override passed to the provider
+	Intent         string              // Routing tag (see provider.Router)
+	CostTier       string              // Routing cost preference (see provider.Router)
+	ResponseFormat string              // provider.FormatJSON or FormatJSONSchema
+	ResponseSchema any                 // JSON Schema for FormatJSONSchema
+	OnEvent        func(Event)         // Progress callback, called synchronously from the loop
+	Usage          *provider.Usage     // If set, accumulates token usage across the run's LLM calls
+	Cost           *float64            // If set, accumulates the run's estimated cost in USD
+	Permissions    *toolreg.Profile    // Replaces the loop's tool permissions for this run
+	Ask            AskFunc             // If set, the model can ask the user questions mid-run (see AskTool)
+	Sampling       provider.Sampling   // Overrides the set fields of the loop's sampling settings
+	ToolChoice     string              // provider.ToolChoice* or a tool name; see toolChoice
+	Images         []provider.Image    // Attached to the user message
+	Documents      []provider.Document // Attached to the user message
+	Tags           map[string]string   // Labels saved with the run's messages (see provider.Meta)
+}
+
 // Run processes a user message through the full agent loop.
 // Returns the final assistant text response.
 func (al *AgentLoop) Run(ctx context.Context, userMessage string) (string, error) {
+	return al.RunWith(ctx, userMessage, RunOptions{})
+}
+
+// RunStructured runs a user message through the loop with JSON output enforced
+// and unmarshals the final answer into out. schema is a JSON Schema object
+// describing out; if nil, any JSON object is accepted.
+func (al *AgentLoop) RunStructured(ctx context.Context, userMessage string, schema any, out any) error {
+	return al.RunStructuredWith(ctx, userMessage, schema, out, RunOptions{})
+}
+
+// RunStructuredWith is RunStructured with per-run overrides.
+func (al *AgentLoop) RunStructuredWith(ctx context.Context, userMessage string, schema any, out any, opts RunOptions) error {
+	opts.ResponseFormat = provider.FormatJSON
+	if schema != nil {
+		opts.ResponseFormat = provider.FormatJSONSchema
+		opts.ResponseSchema = schema
+	}
+	content, err := al.RunWith(ctx, userMessage, opts)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(content), out); err != nil {
+		return fmt.Errorf("decode structured response: %w (content: %s)", err, truncate(content, 200))
+	}
+	return nil
+}
+
+// RunWith is Run with per-run overrides.
+func (al *AgentLoop) RunWith(ctx context.Context, userMessage string, opts RunOptions) (string, error) {
+	return al.runWith(ctx, userMessage, opts, nil)
+}
+
+// runWith runs userMessage, or resumes the run saved in cp if it is set.
+func (al *AgentLoop) runWith(ctx context.Context, userMessage string, opts RunOptions, cp *session.Checkpoint) (string, error) {
+	ctx, span := al.tracer.Start(ctx, "agent.run", trace.WithAttributes(
+		attribute.String("session", al.cfg.SessionKey),
+		attribute.String("intent", opts.Intent),
+	))
+	defer span.End()
+
+	start := al.sessions.MessageCount(al.cfg.SessionKey)
+	content, iterations, err := al.run(ctx, userMessage, opts, cp)
+	span.SetAttributes(attribute.Int("iterations", iterations))
+	al.cfg.Metrics.ObserveRun(opts.Intent, iterations)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if al.cfg.Learnings != nil && iterations > 0 {
+		if history := al.sessions.GetHistory(al.cfg.SessionKey); start < len(history) {
+			al.extractLearnings(ctx, al.runProvider(opts), opts, iterations+1, history[start:], err)
+		}
+	}
+	return content, err
+}
+
+// runProvider returns the provider for a run.
+func (al *AgentLoop) runProvider(opts RunOptions) provider.Provider {
+	if opts.Provider != nil {
+		return opts.Provider
+	}
+	return al.provider
+}
+
+// run executes the tool loop, reporting how many LLM iterations it started.
+// With resume set it picks up from that checkpoint instead of starting
+// from userMessage.
+func (al *AgentLoop) run(ctx context.Context, userMessage string, opts RunOptions, resume *session.Checkpoint) (content string, iterations int, err error) {
 	key := al.cfg.SessionKey
+	p := al.runProvider(opts)
 
-	// Load history and summary
-	history := al.sessions.GetHistory(key)
-	summary := al.sessions.GetSummary(key)
+	perms := al.cfg.Permissions
+	if opts.Permissions != nil {
+		perms = opts.Permissions
+	}
+	if perms != nil {
+		ctx = toolreg.WithProfile(ctx, perms)
+	}
+	if opts.Ask != nil {
+		ctx = toolreg.WithConfirm(ctx, al.confirm(opts))
+	}
 
-	// Build initial messages
-	messages := al.ctxBuilder.BuildMessages(history, summary, userMessage)
+	release, err := al.cfg.Queue.Acquire(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer release()
+
+	ctx, end, err := al.begin(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer end()
+
+	cp := resume
+	if cp == nil {
+		// Load history and summary
+		history := al.sessions.GetHistory(key)
+		summary := al.sessions.GetSummary(key)
+
+		// Build initial messages
+		messages := al.ctxBuilder.BuildMessages(ctx, history, summary, userMessage)
+		messages[len(messages)-1].Images = opts.Images
+		messages[len(messages)-1].Documents = opts.Documents
+		cp = &session.Checkpoint{Prompt: userMessage, Intent: opts.Intent, Model: opts.Model, Tags: maps.Clone(opts.Tags), Messages: messages, Start: len(messages), Started: time.Now()}
+	}
+	messages := cp.Messages
+	runStart := cp.Start // Messages from here on are the run's own
+	skill := al.ctxBuilder.MatchSkill(userMessage)
+	if skill != nil && al.cfg.Verbose {
+		log.Printf("[loop] using skill %s", skill.Name)
+	}
+
+	userMsg := provider.Message{Role: "user", Content: userMessage, Images: opts.Images, Documents: opts.Documents}
+	tr := al.cfg.Transcripts.Start(key, opts.Intent, userMsg)
+	defer func() { tr.End(content, err) }()
+	if cp.RunID == "" {
+		cp.RunID = cmp.Or(tr.ID(), newRunID())
+	}
+	rm := runMeta{runID: cp.RunID, channel: opts.Intent, tags: cp.Tags}
 
 	// Save user message to session
-	al.sessions.AddMessage(key, provider.Message{Role: "user", Content: userMessage})
+	if resume == nil {
+		saved := historyAttachments(userMsg)
+		saved.Meta = rm.stamp("", 0)
+		al.sessions.AddMessage(key, saved)
+	}
+	tm := al.newTimings()
+	defer tm.logSummary()
+	var audited *audit.Run
+	if al.cfg.Audit != nil {
+		// The audit trail records the run's totals even if the caller
+		// doesn't collect them
+		if opts.Usage == nil {
+			opts.Usage = new(provider.Usage)
+		}
+		if opts.Cost == nil {
+			opts.Cost = new(float64)
+		}
+		audited = al.cfg.Audit.Start(ctx, tr.ID(), key, opts.Intent, userMessage)
+		defer func() { audited.End(*opts.Usage, *opts.Cost, err) }()
+	}
+	if al.cfg.Checkpoint || resume != nil {
+		defer func() {
+			// Only a run cut short by a shutdown keeps its checkpoint, to
+			// be resumed at the next start. One that failed, timed out, or
+			// was cancelled for any other reason is over.
+			if !shuttingDown(ctx) {
+				al.sessions.SetCheckpoint(key, nil)
+				al.sessions.Save(key)
+			}
+		}()
+	}
+	cpSaved := -1 // Messages the session's checkpoint holds
+	if resume != nil {
+		cpSaved = len(resume.Messages)
+		messages = al.resumeMessages(key, resume, tr, rm)
+		iterations = resume.Iteration
+	}
+	al.checkpoint(ctx, key, cp, &cpSaved, messages, cp.Iteration, nil)
 
-	// Get tool definitions
-	toolDefs := al.registry.ToToolDefs()
+	// Get tool definitions: the permitted tools, narrowed by the skill's
+	// allowlist, then the most relevant
+	toolDefs := al.ctxBuilder.SelectTools(ctx, userMessage, al.registry.ToToolDefs())
+	if opts.Ask != nil {
+		toolDefs = append(toolDefs, askToolDef)
+	}
+	if err := checkToolChoice(opts.ToolChoice, toolDefs); err != nil {
+		return "", 0, err
+	}
 
 	// Tool loop
 	var finalContent string
-	for i := 0; i < al.cfg.MaxIterations; i++ {
+	repeats := repeatDetector{limit: al.cfg.RepeatLimit}
+	badArgs := argRetries{limit: al.cfg.ArgRetries}
+	var partial string // Answer so far when it was cut off by max tokens
+	var answerModel string
+	var answerUSD float64 // Cost of the calls that wrote the answer so far
+	continues := 0
+	warnedWindow := false
+	for i := cp.Iteration; i < al.cfg.MaxIterations; i++ {
+		if interrupted(ctx) {
+			al.sessions.Save(key)
+			return "", iterations, ErrInterrupted
+		}
+		iterations = i + 1
+
+		// Pick up steering messages queued since the last iteration
+		for _, steer := range al.drainSteering(key) {
+			if al.cfg.Verbose {
+				log.Printf("[loop] steering: %s", truncate(steer, 100))
+			}
+			steerMsg := provider.Message{Role: "user", Content: steer, Meta: rm.stamp("", 0)}
+			messages = append(messages, steerMsg)
+			al.sessions.AddMessage(key, steerMsg)
+			tr.Message(i+1, steerMsg)
+		}
+
 		if al.cfg.Verbose {
 			log.Printf("[loop] iteration %d/%d, %d messages", i+1, al.cfg.MaxIterations, len(messages))
 		}
 
+		model, err := al.budgetModel(opts.Model)
+		if err != nil {
+			al.sessions.Save(key)
+			return "", iterations, err
+		}
+
 		// Call LLM
-		resp, err := al.provider.Chat(ctx, provider.ChatRequest{
-			Messages: messages,
-			Tools:    toolDefs,
-		})
+		req := provider.ChatRequest{
+			Model:          model,
+			Messages:       messages,
+			Tools:          toolDefs,
+			Sampling:       al.cfg.Sampling.Merge(opts.Sampling),
+			ToolChoice:     toolChoice(opts.ToolChoice, i),
+			ResponseFormat: opts.ResponseFormat,
+			ResponseSchema: opts.ResponseSchema,
+			Intent:         opts.Intent,
+			CostTier:       opts.CostTier,
+		}
+		callStart := time.Now()
+		resp, usd, err := al.chat(ctx, p, i+1, req)
+		callTime := time.Since(callStart)
+		tr.LLM(i+1, model, resp, usd, callTime, err)
+		tm.llm("llm", i+1, model, resp, callTime, err)
+		// A prompt too big for the context window is sent again without
+		// its oldest messages. The session keeps them; only this run's
+		// prompts lose them.
+		for trims := 0; err != nil && provider.ContextOverflow(err) && trims < maxContextTrims; trims++ {
+			trimmed, start, ok := trimMessages(messages, runStart)
+			if !ok {
+				break
+			}
+			log.Printf("[loop] prompt overflowed the context window: dropped %d of %d messages", len(messages)-len(trimmed), len(messages))
+			messages, runStart, cp.Start, cpSaved = trimmed, start, start, -1
+			req.Messages = messages
+			callStart = time.Now()
+			resp, usd, err = al.chat(ctx, p, i+1, req)
+			callTime = time.Since(callStart)
+			tr.LLM(i+1, model, resp, usd, callTime, err)
+			tm.llm("llm", i+1, model, resp, callTime, err)
+		}
 		if err != nil {
-			return "", fmt.Errorf("LLM call failed (iteration %d): %w", i+1, err)
+			if interrupted(ctx) {
+				al.sessions.Save(key)
+				return "", iterations, ErrInterrupted
+			}
+			return "", iterations, fmt.Errorf("LLM call failed (iteration %d): %w", i+1, err)
 		}
 
-		// Auto-capture to token-eval
+		if opts.Usage != nil {
+			opts.Usage.PromptTokens += resp.Usage.PromptTokens
+			opts.Usage.CompletionTokens += resp.Usage.CompletionTokens
+		}
+		if opts.Cost != nil {
+			*opts.Cost += usd
+		}
+		al.sessions.AddCost(key, usd)
+		if !warnedWindow {
+			warnedWindow = al.warnContextWindow(cmp.Or(resp.Model, model), resp.Usage.PromptTokens)
+		}
+
+		// Auto-capture the call
 		if al.cfg.AutoCapture {
-			al.captureEval(resp, userMessage, i+1)
+			al.captureEval(ctx, p, resp, usd, userMessage, i+1)
 		}
 
-		if al.cfg.Verbose {
-			log.Printf("[loop] response: %d chars, %d tool calls, usage: %d+%d tokens",
-				len(resp.Content), len(resp.ToolCalls),
-				resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+		if al.cfg.Thinking == ThinkingLog {
+			logThinking(resp.Thinking)
+		}
+		answerModel = cmp.Or(resp.Model, model)
+		answerUSD += usd
+
+		// Cut off by max tokens: have the model carry on from where it
+		// stopped, and stitch the parts together. Structured output isn't
+		// continued: the parts of a JSON answer don't stitch into valid
+		// JSON, so it is returned truncated and fails to decode.
+		if len(resp.ToolCalls) == 0 && resp.StopReason == provider.StopMaxTokens && opts.ResponseFormat == "" && continues < al.cfg.MaxContinues && i < al.cfg.MaxIterations-1 {
+			continues++
+			if al.cfg.Verbose {
+				log.Printf("[loop] response hit max tokens; continuing (%d/%d)", continues, al.cfg.MaxContinues)
+			}
+			partial += resp.Content
+			messages = append(messages,
+				provider.Message{Role: "assistant", Content: resp.Content},
+				provider.Message{Role: "user", Content: continueNote},
+			)
+			tr.Message(i+1, provider.Message{Role: "user", Content: continueNote})
+			continue
 		}
 
 		// No tool calls → done
 		if len(resp.ToolCalls) == 0 {
-			finalContent = resp.Content
+			finalContent = partial + resp.Content
 			break
 		}
 
+		partial = "" // A cut-off answer that turned into tool calls is superseded
+
 		// Append assistant message with tool calls
 		assistantMsg := provider.Message{
 			Role:      "assistant",
 			Content:   resp.Content,
 			ToolCalls: resp.ToolCalls,
+			Thinking:  resp.Thinking,
+			Meta:      rm.stamp(answerModel, answerUSD),
 		}
+		answerUSD = 0
 		messages = append(messages, assistantMsg)
+		if al.cfg.Thinking != ThinkingSave {
+			assistantMsg.Thinking = nil
+		}
 		al.sessions.AddMessage(key, assistantMsg)
+		al.checkpoint(ctx, key, cp, &cpSaved, messages, iterations, resp.ToolCalls)
 
 		// Execute each tool call
-		for _, tc := range resp.ToolCalls {
+		var repeat string
+		var malformed, blocked error
+		for j, tc := range resp.ToolCalls {
+			if what := repeats.observe(tc); what != "" {
+				repeat = what
+			}
 			if al.cfg.Verbose {
 				log.Printf("[loop] executing tool: %s(%s)", tc.Name, truncate(tc.Arguments, 100))
 			}
 
-			result, err := al.registry.Execute(ctx, tc)
-			if err != nil {
-				result = fmt.Sprintf("Error: %s", err)
+			verdict := al.cfg.Guard.Check(ctx, guard.Input{Target: guard.ToolArgs, Session: key, Tool: tc.Name, Text: tc.Arguments})
+			if verdict.Action == guard.Rewrite {
+				tc.Arguments = verdict.Text
 			}
 
+			opts.emit(Event{Type: EventToolStart, Iteration: i + 1, ToolCall: tc})
+			toolStart := time.Now()
+			var res toolreg.ToolResult
+			var err error
+			switch {
+			case verdict.Action == guard.Block:
+				err = verdict.Err()
+			case tc.Name == AskTool && opts.Ask != nil:
+				res, err = al.ask(ctx, opts, tc)
+			case skill.AllowsTool(tc.Name):
+				res, err = al.executeTool(ctx, tc)
+			default:
+				err = fmt.Errorf("tool %s is not allowed by skill %s", tc.Name, skill.Name)
+			}
+			toolTime := time.Since(toolStart)
+			tm.tool(i+1, tc, res, toolTime, err)
+			opts.emit(Event{Type: EventToolEnd, Iteration: i + 1, ToolCall: tc, Result: res.Stdout, Output: res, Err: err})
+			result := formatToolResult(res, err)
+			if errors.Is(err, toolreg.ErrInvalidArguments) {
+				result = argHint(tc, toolDefs, err)
+			}
+			if al.replay != nil {
+				result = res.Stdout // Recorded as the model read it
+			}
+
+			// Output from the world may carry instructions meant to hijack
+			// the run; the user's answers and the loop's own errors don't.
+			// The whole result is screened, before an oversized one is
+			// summarized by the LLM.
+			screened := verdict.Action != guard.Block && (tc.Name != AskTool || opts.Ask == nil)
+			withheld := ""
+			if screened {
+				switch v := al.cfg.Guard.Check(ctx, guard.Input{Target: guard.ToolResult, Session: key, Tool: tc.Name, Text: result}); v.Action {
+				case guard.Rewrite:
+					result = v.Text
+				case guard.Quarantine, guard.Block:
+					withheld, result = result, guard.Quarantined(tc.Name, v)
+					if v.Action == guard.Block && blocked == nil {
+						blocked = v.Err()
+					}
+				}
+			}
+			if withheld == "" {
+				result = al.fitToolOutput(ctx, p, opts, tc, result)
+				if screened && al.cfg.WrapToolResults {
+					result = guard.Wrap(tc.Name, result)
+				}
+			}
+			if withheld != "" {
+				tr.Quarantined(i+1, tc, result, withheld, res.ExitCode, toolTime)
+			} else {
+				tr.Tool(i+1, tc, result, res.ExitCode, toolTime, err)
+			}
+			audited.Tool(tc, res.ExitCode, toolTime, err)
+
 			if al.cfg.Verbose {
 				log.Printf("[loop] tool result: %s", truncate(result, 200))
 			}
@@ -133,9 +555,39 @@ func (al *AgentLoop) Run(ctx context.Context, userMessage string) (string, error
 				Role:       "tool",
 				Content:    result,
 				ToolCallID: tc.ID,
+				Meta:       rm.stamp("", 0),
 			}
 			messages = append(messages, toolMsg)
 			al.sessions.AddMessage(key, toolMsg)
+			al.checkpoint(ctx, key, cp, &cpSaved, messages, iterations, resp.ToolCalls[j+1:])
+			if malformed == nil {
+				malformed = badArgs.observe(err)
+			}
+		}
+
+		// Every call got a result, so the session stays well-formed
+		if blocked != nil {
+			al.sessions.Save(key)
+			return "", iterations, blocked
+		}
+		if malformed != nil {
+			al.sessions.Save(key)
+			return "", iterations, malformed
+		}
+
+		// Warn a model that is stuck repeating itself, and stop it if it
+		// carries on regardless
+		if repeat != "" {
+			note, err := repeats.trip(repeat)
+			if err != nil {
+				al.sessions.Save(key)
+				return "", iterations, err
+			}
+			if al.cfg.Verbose {
+				log.Printf("[loop] %s", note)
+			}
+			messages = append(messages, provider.Message{Role: "user", Content: note})
+			tr.Message(i+1, provider.Message{Role: "user", Content: note})
 		}
 
 		// If this was the last iteration, the next LLM call won't happen
@@ -147,42 +599,157 @@ func (al *AgentLoop) Run(ctx context.Context, userMessage string) (string, error
 		}
 	}
 
+	// Structured answers are left alone: a rewrite could break the schema
+	if al.cfg.ReflectionEnabled && finalContent != "" && opts.ResponseFormat == "" {
+		finalContent = al.reflect(ctx, p, opts, iterations, userMessage, messages[runStart:], finalContent, tr, tm)
+	}
 	if finalContent == "" {
 		finalContent = "I've completed processing but have no response to give."
 	}
+	switch verdict := al.cfg.Guard.Check(ctx, guard.Input{Target: guard.Output, Session: key, Text: finalContent}); verdict.Action {
+	case guard.Block:
+		al.sessions.Save(key)
+		return "", iterations, verdict.Err()
+	case guard.Rewrite:
+		finalContent = verdict.Text
+	}
 
 	// Save assistant response
-	al.sessions.AddMessage(key, provider.Message{Role: "assistant", Content: finalContent})
+	al.sessions.AddMessage(key, provider.Message{Role: "assistant", Content: finalContent, Meta: rm.stamp(answerModel, answerUSD)})
 	al.sessions.Save(key)
+	al.compact(ctx, key)
 
-	return finalContent, nil
+	return finalContent, iterations, nil
 }
 
-// captureEval records the LLM call to token-eval if available.
-func (al *AgentLoop) captureEval(resp *provider.ChatResponse, intent string, iteration int) {
-	binary := al.cfg.EvalBinary
-	if binary == "" {
-		return
+// continueNote asks the model to resume an answer cut off by max tokens.
+const continueNote = "[Your reply was cut off by the output token limit. Continue exactly where it stopped, without repeating or summarizing anything you already wrote.]"
+
+// logThinking logs extended thinking blocks.
+func logThinking(blocks []provider.Thinking) {
+	for _, th := range blocks {
+		if th.Redacted != "" {
+			log.Printf("[loop] thinking: [redacted]")
+			continue
+		}
+		log.Printf("[loop] thinking: %s", th.Text)
+	}
+}
+
+// toolChoice returns the tool choice for an iteration. ToolChoiceNone holds
+// for the whole run, but a required or named tool is only forced on the
+// first call; forcing it every time would never let the run finish.
+func toolChoice(choice string, iteration int) string {
+	if choice == provider.ToolChoiceNone || iteration == 0 {
+		return choice
 	}
-	// Check if binary exists
-	if _, err := exec.LookPath(binary); err != nil {
+	return provider.ToolChoiceAuto
+}
+
+// checkToolChoice reports a named tool choice that the run doesn't offer.
+func checkToolChoice(choice string, defs []provider.ToolDef) error {
+	switch choice {
+	case provider.ToolChoiceAuto, provider.ToolChoiceRequired, provider.ToolChoiceNone:
+		return nil
+	}
+	for _, d := range defs {
+		if d.Name == choice {
+			return nil
+		}
+	}
+	return fmt.Errorf("tool choice %s is not among the tools offered to this run", choice)
+}
+
+// contextWarnRatio is the share of a model's context window a prompt may
+// fill before the loop warns.
+const contextWarnRatio = 0.8
+
+// warnContextWindow logs a warning and returns true if a prompt of
+// promptTokens fills most of model's context window.
+func (al *AgentLoop) warnContextWindow(model string, promptTokens int) bool {
+	info, ok := al.cfg.Models.Lookup(model)
+	if !ok || info.ContextWindow <= 0 || float64(promptTokens) < contextWarnRatio*float64(info.ContextWindow) {
+		return false
+	}
+	log.Printf("[loop] prompt of %d tokens is %d%% of %s's %d-token context window",
+		promptTokens, promptTokens*100/info.ContextWindow, model, info.ContextWindow)
+	return true
+}
+
+// budgetModel returns the model for the next LLM call: model while within
+// budget, BudgetModel once a budget is spent, or an error if there is no
+// cheaper model to fall back to.
+func (al *AgentLoop) budgetModel(model string) (string, error) {
+	err := al.cfg.Budget.Check()
+	if err == nil {
+		return model, nil
+	}
+	var exceeded *cost.ExceededError
+	if !errors.As(err, &exceeded) {
+		log.Printf("[loop] budget check: %v", err) // Don't block runs on a broken ledger
+		return model, nil
+	}
+	if al.cfg.BudgetModel == "" {
+		return "", err
+	}
+	if al.cfg.Verbose {
+		log.Printf("[loop] %v; using %s", err, al.cfg.BudgetModel)
+	}
+	return al.cfg.BudgetModel, nil
+}
+
+// captureEval records the LLM call via the configured recorder.
+// Capture failures are logged, never fatal.
+func (al *AgentLoop) captureEval(ctx context.Context, p provider.Provider, resp *provider.ChatResponse, usd float64, intent string, iteration int) {
+	if al.cfg.Recorder == nil {
 		return
 	}
+	rec := eval.Record{
+		Provider:         p.Name(),
+		Model:            resp.Model,
+		Intent:           fmt.Sprintf("orchestrator:%s:iter%d", truncate(intent, 50), iteration),
+		Session:          al.cfg.SessionKey,
+		Iteration:        iteration,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.PromptTokens + resp.Usage.CompletionTokens,
+		Cost:             usd,
+	}
+	if err := al.cfg.Recorder.Record(ctx, rec); err != nil && al.cfg.Verbose {
+		log.Printf("[loop] capture failed: %v", err)
+	}
+}
 
-	args := []string{
-		"record",
-		"--provider", al.provider.Name(),
-		"--prompt-tokens", fmt.Sprintf("%d", resp.Usage.PromptTokens),
-		"--completion-tokens", fmt.Sprintf("%d", resp.Usage.CompletionTokens),
-		"--intent", fmt.Sprintf("orchestrator:%s:iter%d", truncate(intent, 50), iteration),
+// historyAttachments returns msg as the session keeps it. Inline image and
+// PDF data is sent with its own turn only, so later turns don't pay for it
+// again; the message notes what was attached instead. Image URLs and
+// document text are kept.
+func historyAttachments(msg provider.Message) provider.Message {
+	var images []provider.Image
+	dropped := 0
+	for _, img := range msg.Images {
+		if img.URL == "" {
+			dropped++
+			continue
+		}
+		images = append(images, img)
+	}
+	if dropped > 0 {
+		msg.Content += fmt.Sprintf("\n[%d attached image(s) shown earlier, not kept]", dropped)
 	}
+	msg.Images = images
 
-	cmd := exec.Command(binary, args...)
-	// Fire and forget — provide minimal JSON on stdin
-	input := map[string]any{"session": al.cfg.SessionKey, "iteration": iteration}
-	data, _ := json.Marshal(input)
-	cmd.Stdin = strings.NewReader(string(data))
-	_ = cmd.Run()
+	var docs []provider.Document
+	for _, doc := range msg.Documents {
+		if doc.Text == "" {
+			msg.Content += fmt.Sprintf("\n[attached document %q shown earlier, not kept]", doc.Name)
+			continue
+		}
+		doc.Data = "" // Later turns read the extracted text
+		docs = append(docs, doc)
+	}
+	msg.Documents = docs
+	return msg
 }
 
 func truncate(s string, max int) string {
@@ -0,0 +1,37 @@
+package loop
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// runMeta stamps the messages a run saves to its session with the run's
+// ID, channel, and tags (see provider.Meta).
+type runMeta struct {
+	runID   string
+	channel string
+	tags    map[string]string
+}
+
+// stamp returns the metadata of a message saved now. model and usd are
+// set for assistant messages: the model that wrote it and what that cost.
+func (rm runMeta) stamp(model string, usd float64) *provider.Meta {
+	return &provider.Meta{
+		Time:    time.Now(),
+		RunID:   rm.runID,
+		Channel: rm.channel,
+		Model:   model,
+		CostUSD: usd,
+		Tags:    rm.tags,
+	}
+}
+
+// newRunID makes up an ID for a run that has no transcript to name it.
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
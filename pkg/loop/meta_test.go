@@ -0,0 +1,57 @@
+package loop
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/cost"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
+)
+
+func TestRunWith_MessageMeta(t *testing.T) {
+	mp := mockProvider(
+		providertest.Respond(&provider.ChatResponse{ToolCalls: []provider.ToolCall{{ID: "tc1", Name: "greet.say", Arguments: `{"name": "Ada"}`}}, Model: "m1", Usage: provider.Usage{PromptTokens: 1_000_000}}),
+		providertest.Respond(&provider.ChatResponse{Content: "Greeted Ada.", Model: "m2", Usage: provider.Usage{CompletionTokens: 500_000}}),
+	)
+	var calls int
+	al := makeLoop(t, mp, greetRegistry(&calls))
+	al.cfg.Pricing = cost.New(map[string]cost.Price{"m1": {Input: 2}, "m2": {Output: 8}})
+	al.cfg.Transcripts = transcript.New(t.TempDir())
+
+	start := time.Now()
+	if _, err := al.RunWith(context.Background(), "Greet Ada", RunOptions{Intent: "slack", Tags: map[string]string{"ticket": "T-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	h := al.sessions.GetHistory("main")
+	if len(h) != 4 {
+		t.Fatalf("history = %+v", h)
+	}
+	runID := h[0].Meta.RunID
+	if runID == "" {
+		t.Fatal("no run ID")
+	}
+	for i, want := range []struct {
+		model string
+		usd   float64
+	}{{"", 0}, {"m1", 2}, {"", 0}, {"m2", 4}} {
+		m := h[i].Meta
+		if m == nil || m.RunID != runID || m.Channel != "slack" || m.Tags["ticket"] != "T-1" || m.Time.Before(start) {
+			t.Errorf("message %d meta = %+v", i, m)
+			continue
+		}
+		if m.Model != want.model || m.CostUSD != want.usd {
+			t.Errorf("message %d: model %q, cost %v; want %q, %v", i, m.Model, m.CostUSD, want.model, want.usd)
+		}
+	}
+
+	mp.Then(providertest.Text("Hi again."))
+	if _, err := al.Run(context.Background(), "Again"); err != nil {
+		t.Fatal(err)
+	}
+	if m := al.sessions.GetHistory("main")[4].Meta; m.RunID == runID || m.Tags != nil {
+		t.Errorf("second run meta = %+v", m)
+	}
+}
@@ -0,0 +1,110 @@
+package loop
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// summarizeInputFactor caps how much of an oversized result is sent to the
+// summarizer, as a multiple of the output limit.
+const summarizeInputFactor = 10
+
+const summarizePrompt = `The following is the output of the tool call %s(%s).
+It is too large to include in full. Summarize it in under %d characters,
+keeping every detail needed to act on it (paths, line numbers, errors, IDs, counts).
+
+%s`
+
+// formatToolResult renders a tool result for the model. A successful call
+// is just its stdout. A failed one leads with the error, then shows what
+// the command wrote, since a failing tool's stdout often holds the
+// diagnostic.
+func formatToolResult(res toolreg.ToolResult, err error) string {
+	if err == nil {
+		return res.Stdout
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Error: %s", err)
+	if out := strings.TrimSpace(res.Stdout); out != "" {
+		fmt.Fprintf(&sb, "\n\nstdout:\n%s", out)
+	}
+	if errOut := strings.TrimSpace(res.Stderr); errOut != "" {
+		fmt.Fprintf(&sb, "\n\nstderr:\n%s", errOut)
+	}
+	return sb.String()
+}
+
+// fitToolOutput shrinks a tool result that exceeds its output limit.
+// The tool manifest's limit wins over Config.MaxToolOutput. When
+// SummarizeToolOutput is set the provider condenses the result; otherwise,
+// or if summarization fails, the head and tail are kept.
+func (al *AgentLoop) fitToolOutput(ctx context.Context, p provider.Provider, opts RunOptions, tc provider.ToolCall, result string) string {
+	limit := al.registry.OutputLimit(tc.Name)
+	if limit == 0 {
+		limit = al.cfg.MaxToolOutput
+	}
+	if limit <= 0 || len(result) <= limit {
+		return result
+	}
+
+	if al.cfg.SummarizeToolOutput {
+		summary, err := al.summarizeOutput(ctx, p, opts, tc, result, limit)
+		if err == nil {
+			return summary
+		}
+		if al.cfg.Verbose {
+			log.Printf("[loop] summarize %s output failed: %v", tc.Name, err)
+		}
+	}
+	return truncateMiddle(result, limit)
+}
+
+func (al *AgentLoop) summarizeOutput(ctx context.Context, p provider.Provider, opts RunOptions, tc provider.ToolCall, result string, limit int) (string, error) {
+	input := truncateMiddle(result, limit*summarizeInputFactor)
+	prompt := fmt.Sprintf(summarizePrompt, tc.Name, truncate(tc.Arguments, 200), limit, input)
+	resp, err := p.Chat(ctx, provider.ChatRequest{
+		Model:    opts.Model,
+		Messages: []provider.Message{{Role: "user", Content: prompt}},
+		Intent:   "tool-summary",
+		CostTier: opts.CostTier,
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.Content == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	summary := fmt.Sprintf("[summarized from %d bytes]\n%s", len(result), resp.Content)
+	return truncateMiddle(summary, limit), nil
+}
+
+// truncateMiddle keeps the head and tail of s within max bytes, replacing
+// the middle with a marker. The head gets two thirds of the budget since
+// it usually carries headers and the first errors; the tail keeps
+// summaries and exit status. Cuts never split a UTF-8 sequence.
+func truncateMiddle(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	marker := fmt.Sprintf("\n\n[... %d bytes omitted ...]\n\n", len(s)-max)
+	budget := max - len(marker)
+	if budget <= 0 {
+		return truncate(s, max)
+	}
+	head := budget * 2 / 3
+	tail := budget - head
+	for head > 0 && !utf8.RuneStart(s[head]) {
+		head--
+	}
+	start := len(s) - tail
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+	return s[:head] + marker + s[start:]
+}
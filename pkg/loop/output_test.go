@@ -0,0 +1,136 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func TestTruncateMiddle(t *testing.T) {
+	s := strings.Repeat("a", 500) + strings.Repeat("z", 500)
+	got := truncateMiddle(s, 200)
+	if len(got) > 200 {
+		t.Fatalf("len = %d, want <= 200", len(got))
+	}
+	if !strings.HasPrefix(got, "aaa") || !strings.HasSuffix(got, "zzz") {
+		t.Errorf("head/tail not preserved: %q", got)
+	}
+	if !strings.Contains(got, "bytes omitted") {
+		t.Errorf("missing omission marker: %q", got)
+	}
+
+	if got := truncateMiddle("short", 200); got != "short" {
+		t.Errorf("short input changed: %q", got)
+	}
+
+	multi := strings.Repeat("é", 300)
+	if got := truncateMiddle(multi, 101); !utf8.ValidString(got) {
+		t.Errorf("split a UTF-8 sequence: %q", got)
+	}
+}
+
+func bigOutputRegistry(maxOutput int) *toolreg.Registry {
+	reg := toolreg.NewRegistry(30 * time.Second)
+	reg.Register(&toolreg.ToolManifest{
+		Name:      "fs",
+		MaxOutput: maxOutput,
+		Commands: map[string]toolreg.CommandDef{
+			"cat": {Handler: func(ctx context.Context, args map[string]any) (toolreg.ToolResult, error) {
+				return toolreg.ToolResult{Stdout: "BEGIN" + strings.Repeat("x", 10000) + "END"}, nil
+			}},
+		},
+	})
+	return reg
+}
+
+func catCall() *provider.ChatResponse {
+	return &provider.ChatResponse{ToolCalls: []provider.ToolCall{{ID: "tc1", Name: "fs.cat", Arguments: `{}`}}}
+}
+
+func TestFormatToolResult(t *testing.T) {
+	tests := []struct {
+		name string
+		res  toolreg.ToolResult
+		err  error
+		want string
+	}{
+		{"success is stdout", toolreg.ToolResult{Stdout: "ok\n", Stderr: "warning"}, nil, "ok\n"},
+		{"failure keeps output", toolreg.ToolResult{Stdout: "3 tests failed\n", Stderr: "exit status 1\n", ExitCode: 1},
+			errors.New("go.test exited with code 1"),
+			"Error: go.test exited with code 1\n\nstdout:\n3 tests failed\n\nstderr:\nexit status 1"},
+		{"error without output", toolreg.ToolResult{}, errors.New("unknown tool: x"), "Error: unknown tool: x"},
+	}
+	for _, tt := range tests {
+		if got := formatToolResult(tt.res, tt.err); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRun_TruncatesToolOutput(t *testing.T) {
+	mp := mockProvider(
+		providertest.Respond(catCall()),
+		providertest.Text("done"),
+	)
+	al := makeLoop(t, mp, bigOutputRegistry(0))
+	al.cfg.MaxToolOutput = 1000
+
+	if _, err := al.Run(context.Background(), "read it"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	msgs := mp.Call(1).Messages
+	tool := msgs[len(msgs)-1]
+	if len(tool.Content) > 1000 || !strings.HasPrefix(tool.Content, "BEGIN") || !strings.HasSuffix(tool.Content, "END") {
+		t.Errorf("tool output not truncated with head/tail: %d bytes", len(tool.Content))
+	}
+}
+
+func TestRun_ManifestOutputLimitWins(t *testing.T) {
+	mp := mockProvider(
+		providertest.Respond(catCall()),
+		providertest.Text("done"),
+	)
+	al := makeLoop(t, mp, bigOutputRegistry(300))
+	al.cfg.MaxToolOutput = 5000
+
+	if _, err := al.Run(context.Background(), "read it"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	msgs := mp.Call(1).Messages
+	if n := len(msgs[len(msgs)-1].Content); n > 300 {
+		t.Errorf("tool output = %d bytes, want <= 300", n)
+	}
+}
+
+func TestRun_SummarizesToolOutput(t *testing.T) {
+	mp := mockProvider(
+		providertest.Respond(catCall()),
+		providertest.Text("a file of x characters"),
+		providertest.Text("done"),
+	)
+	al := makeLoop(t, mp, bigOutputRegistry(0))
+	al.cfg.MaxToolOutput = 1000
+	al.cfg.SummarizeToolOutput = true
+
+	if _, err := al.Run(context.Background(), "read it"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(mp.Calls()) != 3 {
+		t.Fatalf("calls = %d, want 3", len(mp.Calls()))
+	}
+	if mp.Call(1).Intent != "tool-summary" || len(mp.Call(1).Tools) != 0 {
+		t.Errorf("summary request = %+v", mp.Call(1))
+	}
+	msgs := mp.Call(2).Messages
+	got := msgs[len(msgs)-1].Content
+	if !strings.Contains(got, "a file of x characters") || !strings.Contains(got, "summarized from") {
+		t.Errorf("tool message = %q, want summary", got)
+	}
+}
@@ -0,0 +1,131 @@
+package loop
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
+)
+
+// Caps on the tool evidence shown to the reviewer, in bytes.
+const (
+	maxEvidencePerTool = 2000
+	maxEvidence        = 24 * 1024
+)
+
+const reflectPrompt = `You are checking an AI agent's answer before it is sent to the user.
+Compare it with the request and with what the agent's tools actually returned.
+
+Request:
+<request>
+%s
+</request>
+
+What the agent did:
+<evidence>
+%s
+</evidence>
+
+Answer:
+<answer>
+%s
+</answer>
+
+If the answer is correct and complete, reply with "ok": true. If it has clear
+errors (claims the tool output contradicts, wrong numbers, names, or paths,
+or parts of the request it ignored), reply with "ok": false, list the
+"issues", and put the corrected answer in "answer". Fix only real errors: keep
+the answer's wording and format otherwise, and don't add claims the evidence
+doesn't support.`
+
+var reflectSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"ok":     map[string]any{"type": "boolean"},
+		"issues": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"answer": map[string]any{"type": "string"},
+	},
+	"required": []string{"ok"},
+}
+
+// reflect has the model review answer against the request and the run's
+// messages (tool calls and results), and returns the corrected answer if
+// the review found errors. The review uses Config.ReflectionModel, or the
+// run's model if that is empty. Failures are logged and leave the answer
+// unchanged.
+func (al *AgentLoop) reflect(ctx context.Context, p provider.Provider, opts RunOptions, iteration int, request string, run []provider.Message, answer string, tr *transcript.Run, tm *timings) string {
+	model, err := al.budgetModel(cmp.Or(al.cfg.ReflectionModel, opts.Model))
+	if err != nil {
+		return answer
+	}
+	prompt := fmt.Sprintf(reflectPrompt, request, evidence(run), answer)
+	callStart := time.Now()
+	resp, usd, err := al.chat(ctx, p, iteration, provider.ChatRequest{
+		Model:          model,
+		Messages:       []provider.Message{{Role: "user", Content: prompt}},
+		ResponseFormat: provider.FormatJSONSchema,
+		ResponseSchema: reflectSchema,
+		Intent:         "reflection",
+		CostTier:       opts.CostTier,
+	})
+	callTime := time.Since(callStart)
+	tr.LLM(iteration, model, resp, usd, callTime, err)
+	tm.llm("reflect", iteration, model, resp, callTime, err)
+	if err != nil {
+		log.Printf("[loop] reflection: %v", err)
+		return answer
+	}
+	if opts.Usage != nil {
+		opts.Usage.PromptTokens += resp.Usage.PromptTokens
+		opts.Usage.CompletionTokens += resp.Usage.CompletionTokens
+	}
+	if opts.Cost != nil {
+		*opts.Cost += usd
+	}
+	al.sessions.AddCost(al.cfg.SessionKey, usd)
+
+	var out struct {
+		OK     bool     `json:"ok"`
+		Issues []string `json:"issues"`
+		Answer string   `json:"answer"`
+	}
+	if err := json.Unmarshal([]byte(resp.Content), &out); err != nil {
+		log.Printf("[loop] reflection: decode: %v", err)
+		return answer
+	}
+	if out.OK || strings.TrimSpace(out.Answer) == "" {
+		return answer
+	}
+	if al.cfg.Verbose {
+		log.Printf("[loop] reflection corrected the answer: %s", strings.Join(out.Issues, "; "))
+	}
+	return out.Answer
+}
+
+// evidence renders the tool calls and results of a run for the reviewer,
+// plus any user messages that steered it.
+func evidence(run []provider.Message) string {
+	var b strings.Builder
+	for _, m := range run {
+		switch m.Role {
+		case "assistant":
+			for _, tc := range m.ToolCalls {
+				fmt.Fprintf(&b, "[tool call] %s(%s)\n", tc.Name, truncate(tc.Arguments, 500))
+			}
+		case "tool":
+			fmt.Fprintf(&b, "[tool result]\n%s\n", truncateMiddle(strings.TrimSpace(m.Content), maxEvidencePerTool))
+		case "user":
+			fmt.Fprintf(&b, "[user] %s\n", truncate(m.Content, 500))
+		}
+	}
+	if b.Len() == 0 {
+		return "(no tools were used)"
+	}
+	return truncateMiddle(b.String(), maxEvidence)
+}
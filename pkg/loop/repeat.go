@@ -0,0 +1,84 @@
+package loop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// ErrRepeating is returned when the model keeps repeating the same tool
+// calls after being told to stop.
+var ErrRepeating = errors.New("model is repeating tool calls")
+
+// repeatNote is added to the conversation the first time a repeat is seen.
+const repeatNote = "[loop detector] %s. Repeating it will not give a different result. Change the arguments, try a different approach, or answer with what you have."
+
+// repeatDetector watches a run's tool calls for the model getting stuck:
+// the same call with the same arguments limit times in a row, or two calls
+// alternating limit times each.
+type repeatDetector struct {
+	limit  int
+	calls  []string // Recent call signatures, oldest first
+	warned bool
+}
+
+// observe records a tool call and describes the repeat it completes, or
+// returns "" if there is none.
+func (d *repeatDetector) observe(tc provider.ToolCall) string {
+	if d.limit <= 0 {
+		return ""
+	}
+	d.calls = append(d.calls, callSignature(tc))
+	if n := 2 * d.limit; len(d.calls) > n {
+		d.calls = d.calls[len(d.calls)-n:]
+	}
+
+	if d.repeated(1) {
+		return fmt.Sprintf("You called %s with the same arguments %d times in a row", tc.Name, d.limit)
+	}
+	if d.repeated(2) && d.calls[len(d.calls)-1] != d.calls[len(d.calls)-2] {
+		return fmt.Sprintf("You alternated between the same two tool calls %d times", d.limit)
+	}
+	return ""
+}
+
+// repeated reports whether the last limit runs of period calls are the same.
+func (d *repeatDetector) repeated(period int) bool {
+	n := period * d.limit
+	if len(d.calls) < n {
+		return false
+	}
+	recent := d.calls[len(d.calls)-n:]
+	for i := period; i < n; i++ {
+		if recent[i] != recent[i-period] {
+			return false
+		}
+	}
+	return true
+}
+
+// trip handles a detected repeat: the first time it returns a note for the
+// model and starts counting afresh; after that it returns an error.
+func (d *repeatDetector) trip(what string) (string, error) {
+	if d.warned {
+		return "", fmt.Errorf("%w: %s after being warned", ErrRepeating, what)
+	}
+	d.warned = true
+	d.calls = nil
+	return fmt.Sprintf(repeatNote, what), nil
+}
+
+// callSignature identifies a call by name and arguments, ignoring key order
+// and whitespace in the JSON.
+func callSignature(tc provider.ToolCall) string {
+	args := tc.Arguments
+	var v any
+	if json.Unmarshal([]byte(args), &v) == nil {
+		if b, err := json.Marshal(v); err == nil {
+			args = string(b)
+		}
+	}
+	return tc.Name + " " + args
+}
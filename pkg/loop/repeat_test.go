@@ -0,0 +1,75 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func TestRepeatDetector(t *testing.T) {
+	a := provider.ToolCall{Name: "git.status", Arguments: `{"path":".","short":true}`}
+	aReordered := provider.ToolCall{Name: "git.status", Arguments: `{ "short": true, "path": "." }`}
+	b := provider.ToolCall{Name: "git.diff", Arguments: `{}`}
+	c := provider.ToolCall{Name: "git.log", Arguments: `{}`}
+
+	tests := []struct {
+		name  string
+		limit int
+		calls []provider.ToolCall
+		want  string // Substring of the last observe result ("" = no repeat)
+	}{
+		{"identical", 3, []provider.ToolCall{a, a, a}, "same arguments 3 times"},
+		{"key order ignored", 3, []provider.ToolCall{a, aReordered, a}, "same arguments"},
+		{"below limit", 3, []provider.ToolCall{a, a}, ""},
+		{"broken run", 3, []provider.ToolCall{a, a, b, a}, ""},
+		{"oscillation", 2, []provider.ToolCall{a, b, a, b}, "alternated"},
+		{"three-way", 2, []provider.ToolCall{a, b, c, a, b, c}, ""},
+		{"off", 0, []provider.ToolCall{a, a, a, a}, ""},
+	}
+	for _, tt := range tests {
+		d := repeatDetector{limit: tt.limit}
+		var got string
+		for _, tc := range tt.calls {
+			got = d.observe(tc)
+		}
+		if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: observe = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRun_RepeatedToolCalls(t *testing.T) {
+	mp := mockProvider()
+	for i := 0; i < 10; i++ {
+		mp.Then(providertest.Respond(&provider.ChatResponse{
+			ToolCalls: []provider.ToolCall{{ID: fmt.Sprintf("tc%d", i), Name: "echo.run", Arguments: `{"text":"again"}`}},
+		}))
+	}
+	reg := toolreg.NewRegistry(30 * time.Second)
+	reg.Register(&toolreg.ToolManifest{
+		Name:     "echo",
+		Binary:   "echo",
+		Commands: map[string]toolreg.CommandDef{"run": {Description: "echo", Args: "{text}"}},
+	})
+	al := makeLoop(t, mp, reg)
+
+	_, err := al.Run(context.Background(), "keep going")
+	if !errors.Is(err, ErrRepeating) {
+		t.Fatalf("err = %v, want ErrRepeating", err)
+	}
+	// Warned after the third call, stopped after three more.
+	if len(mp.Calls()) != 6 {
+		t.Errorf("LLM calls = %d, want 6", len(mp.Calls()))
+	}
+	msgs := mp.Call(3).Messages
+	if last := msgs[len(msgs)-1]; last.Role != "user" || !strings.Contains(last.Content, "[loop detector]") {
+		t.Errorf("message after the repeat = %+v, want the loop detector note", last)
+	}
+}
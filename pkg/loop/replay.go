@@ -0,0 +1,240 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	ctxpkg "github.com/rcliao/teeny-orchestrator/pkg/context"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
+)
+
+// DivergenceError is returned by Replay when the replayed run does
+// something other than what the transcript recorded.
+type DivergenceError struct {
+	Seq  int    // Transcript entry the replay reached (0 = past the last one)
+	Want string // What the transcript has there
+	Got  string // What the replayed run did instead
+}
+
+func (e *DivergenceError) Error() string {
+	where := "after the last entry"
+	if e.Seq > 0 {
+		where = fmt.Sprintf("at entry %d", e.Seq)
+	}
+	return fmt.Sprintf("replay diverged %s: recorded %s, replayed %s", where, e.Want, e.Got)
+}
+
+// Replay runs the prompt of a recorded run through the loop again, with
+// the transcript standing in for the provider and the tools: each LLM
+// call gets the next recorded reply and each tool call the recorded
+// result, and steering messages are sent again at the same iterations.
+// Nothing is executed, so a run can be replayed to see why the agent did
+// what it did (with Verbose or OnEvent), or after a refactor to check the
+// loop still makes the same calls.
+//
+// cfg supplies loop settings such as MaxIterations, RepeatLimit,
+// MaxContinues, and reflection. The run uses a throwaway session and
+// skips guardrails, learnings, eval capture, transcripts, auditing,
+// queueing, budgets, output shrinking, and result wrapping; recorded tool
+// results are already shrunk and wrapped. A guardrail that rewrote or
+// blocked the original answer therefore shows up as a divergence at the
+// end.
+//
+// Replay returns the replayed answer and the run's error. The error is a
+// *DivergenceError if the run made a call the transcript doesn't have
+// next, stopped before the transcript's last call, or finished with a
+// different answer or error.
+func Replay(ctx context.Context, entries []transcript.Entry, cfg Config, opts RunOptions) (string, error) {
+	var start, end *transcript.Entry
+	r := &replay{}
+	for i, e := range entries {
+		switch e.Type {
+		case transcript.TypeStart:
+			start = &entries[i]
+		case transcript.TypeEnd:
+			end = &entries[i]
+		case transcript.TypeLLM, transcript.TypeTool, transcript.TypeMessage:
+			r.steps = append(r.steps, e)
+		}
+	}
+	if start == nil || start.Message == nil {
+		return "", errors.New("replay: the transcript has no start entry")
+	}
+
+	dir, err := os.MkdirTemp("", "teeny-replay-")
+	if err != nil {
+		return "", fmt.Errorf("replay: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	cfg.SessionKey = start.Session
+	cfg.AutoCapture, cfg.Recorder, cfg.Learnings = false, nil, nil
+	cfg.Transcripts, cfg.Audit, cfg.Queue, cfg.Runs = nil, nil, nil, nil
+	cfg.Guard, cfg.Budget, cfg.Permissions, cfg.Checkpoint = nil, nil, nil, false
+	cfg.MaxToolOutput, cfg.SummarizeToolOutput, cfg.Summarizer = 0, false, nil
+	cfg.WrapToolResults = false
+	reg := toolreg.NewRegistry(0)
+	al := New(r, reg, ctxpkg.NewBuilder(dir, ctxpkg.Config{}, nil), session.NewManager(dir), cfg)
+	al.replay = r
+	r.steer = func(msg string) { al.Steer(cfg.SessionKey, msg) }
+
+	opts.Provider, opts.Ask, opts.Permissions = nil, nil, nil
+	opts.Intent = start.Intent
+	answer, err := al.RunWith(ctx, start.Message.Content, opts)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.diverged != nil {
+		return answer, r.diverged
+	}
+	if r.skipMessages(); r.pos < len(r.steps) {
+		e := r.steps[r.pos]
+		return answer, &DivergenceError{Seq: e.Seq, Want: describeEntry(e), Got: "the end of the run"}
+	}
+	if end != nil {
+		switch {
+		case end.Error != "" && (err == nil || err.Error() != end.Error):
+			return answer, &DivergenceError{Seq: end.Seq, Want: fmt.Sprintf("error %q", end.Error), Got: outcome(answer, err)}
+		case end.Error == "" && (err != nil || answer != end.Result):
+			return answer, &DivergenceError{Seq: end.Seq, Want: fmt.Sprintf("answer %q", truncate(end.Result, 200)), Got: outcome(answer, err)}
+		}
+	}
+	return answer, err
+}
+
+// outcome describes how a replayed run finished.
+func outcome(answer string, err error) string {
+	if err != nil {
+		return fmt.Sprintf("error %q", err)
+	}
+	return fmt.Sprintf("answer %q", truncate(answer, 200))
+}
+
+// describeEntry describes a recorded step for a DivergenceError.
+func describeEntry(e transcript.Entry) string {
+	if e.Type == transcript.TypeTool && e.ToolCall != nil {
+		return fmt.Sprintf("tool call %s(%s)", e.ToolCall.Name, truncate(e.ToolCall.Arguments, 100))
+	}
+	return "an LLM call"
+}
+
+// replay plays a transcript's LLM replies and tool results back. It is
+// the provider of a replayed run and stands in for its registry.
+type replay struct {
+	steer func(msg string) // Queues a steering message on the run
+
+	mu        sync.Mutex
+	steps     []transcript.Entry // LLM, tool, and message entries, in order
+	pos       int                // Next step
+	iteration int                // Iteration of the last LLM reply played
+	diverged  *DivergenceError
+}
+
+func (r *replay) Name() string { return "replay" }
+
+// Chat returns the next recorded LLM reply, or its recorded failure.
+func (r *replay) Chat(_ context.Context, _ provider.ChatRequest) (*provider.ChatResponse, error) {
+	e, err := r.next("an LLM call", func(e transcript.Entry) bool { return e.Type == transcript.TypeLLM })
+	if err != nil {
+		return nil, err
+	}
+	if e.Error != "" {
+		return nil, errors.New(e.Error)
+	}
+	resp := &provider.ChatResponse{Model: e.Model, StopReason: e.StopReason}
+	if e.Message != nil {
+		resp.Content, resp.ToolCalls, resp.Thinking = e.Message.Content, e.Message.ToolCalls, e.Message.Thinking
+	}
+	if e.Usage != nil {
+		resp.Usage = *e.Usage
+	}
+	return resp, nil
+}
+
+// tool returns the recorded result of tc, which must be the next step, and
+// its recorded error. The result is the text the model read, already
+// formatted, so the loop passes it on as is. A call is matched by name
+// and ID, or by its arguments if it has no ID.
+func (r *replay) tool(tc provider.ToolCall) (toolreg.ToolResult, error) {
+	got := fmt.Sprintf("tool call %s(%s)", tc.Name, truncate(tc.Arguments, 100))
+	e, err := r.next(got, func(e transcript.Entry) bool {
+		if e.Type != transcript.TypeTool || e.ToolCall == nil || e.ToolCall.Name != tc.Name {
+			return false
+		}
+		if tc.ID != "" {
+			return e.ToolCall.ID == tc.ID
+		}
+		return e.ToolCall.Arguments == tc.Arguments
+	})
+	if err != nil {
+		return toolreg.ToolResult{}, err
+	}
+	res := toolreg.ToolResult{Stdout: e.Result, ExitCode: e.ExitCode}
+	if e.Error != "" {
+		return res, errors.New(e.Error)
+	}
+	return res, nil
+}
+
+// next takes the next step if match accepts it, and records a divergence
+// described as got otherwise. Once the replay diverges every step fails,
+// so the run stops at its next LLM call.
+func (r *replay) next(got string, match func(transcript.Entry) bool) (transcript.Entry, error) {
+	e, steering, err := r.take(got, match)
+	for _, msg := range steering {
+		r.steer(msg)
+	}
+	return e, err
+}
+
+func (r *replay) take(got string, match func(transcript.Entry) bool) (transcript.Entry, []string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.diverged != nil {
+		return transcript.Entry{}, nil, r.diverged
+	}
+	r.skipMessages()
+	if r.pos >= len(r.steps) {
+		r.diverged = &DivergenceError{Want: "the end of the run", Got: got}
+		return transcript.Entry{}, nil, r.diverged
+	}
+	e := r.steps[r.pos]
+	if !match(e) {
+		r.diverged = &DivergenceError{Seq: e.Seq, Want: describeEntry(e), Got: got}
+		return transcript.Entry{}, nil, r.diverged
+	}
+	r.pos++
+	if e.Type == transcript.TypeLLM {
+		r.iteration = e.Iteration
+	}
+	return e, r.skipMessages(), nil
+}
+
+// skipMessages moves past message entries and returns the steering among
+// them: user messages recorded at the start of a later iteration than the
+// last reply. Notes the loop adds itself belong to the reply's iteration
+// and are added again by the replayed run.
+func (r *replay) skipMessages() []string {
+	var steering []string
+	for ; r.pos < len(r.steps) && r.steps[r.pos].Type == transcript.TypeMessage; r.pos++ {
+		e := r.steps[r.pos]
+		if r.iteration > 0 && e.Iteration > r.iteration && e.Message != nil && e.Message.Role == "user" {
+			steering = append(steering, e.Message.Content)
+		}
+	}
+	return steering
+}
+
+// executeTool runs a tool call through the registry, or plays back its
+// recorded result in a replay.
+func (al *AgentLoop) executeTool(ctx context.Context, tc provider.ToolCall) (toolreg.ToolResult, error) {
+	if al.replay != nil {
+		return al.replay.tool(tc)
+	}
+	return al.registry.Execute(ctx, tc)
+}
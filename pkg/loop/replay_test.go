@@ -0,0 +1,122 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
+)
+
+// recordRun runs a two-step tool conversation and returns its transcript.
+func recordRun(t *testing.T) []transcript.Entry {
+	t.Helper()
+	mp := mockProvider(
+		providertest.ToolCall("counter.next", `{"by":2}`),
+		providertest.Respond(&provider.ChatResponse{Content: "The counter is at 2.", Usage: provider.Usage{PromptTokens: 10, CompletionTokens: 5}}),
+	)
+	reg := toolreg.NewRegistry(30 * time.Second)
+	reg.Register(&toolreg.ToolManifest{
+		Name: "counter",
+		Commands: map[string]toolreg.CommandDef{"next": {
+			Parameters: map[string]toolreg.ParameterDef{"by": {Type: "integer"}},
+			Handler: func(context.Context, map[string]any) (toolreg.ToolResult, error) {
+				return toolreg.ToolResult{Stdout: "2"}, nil
+			},
+		}},
+	})
+	al := makeLoop(t, mp, reg)
+	dir := t.TempDir()
+	al.cfg.Transcripts = transcript.New(dir)
+	if _, err := al.RunWith(context.Background(), "Bump the counter", RunOptions{Intent: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	entries, err := transcript.Read(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestReplay(t *testing.T) {
+	entries := recordRun(t)
+
+	var tools []string
+	opts := RunOptions{OnEvent: func(e Event) {
+		if e.Type == EventToolEnd {
+			tools = append(tools, e.ToolCall.Name+" → "+e.Result)
+		}
+	}}
+	answer, err := Replay(context.Background(), entries, DefaultConfig(), opts)
+	if err != nil || answer != "The counter is at 2." {
+		t.Fatalf("Replay = %q, %v", answer, err)
+	}
+	if !slices.Equal(tools, []string{"counter.next → 2"}) {
+		t.Errorf("tool calls = %v", tools)
+	}
+}
+
+func TestReplayToolError(t *testing.T) {
+	entries := recordRun(t)
+	for i, e := range entries {
+		if e.Type == transcript.TypeTool {
+			entries[i].Result, entries[i].Error = "Error: counter is stuck", "counter is stuck"
+		}
+	}
+
+	var got []Event
+	opts := RunOptions{OnEvent: func(e Event) {
+		if e.Type == EventToolEnd {
+			got = append(got, e)
+		}
+	}}
+	cfg := DefaultConfig()
+	cfg.WrapToolResults = true
+	if _, err := Replay(context.Background(), entries, cfg, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Err == nil || got[0].Err.Error() != "counter is stuck" || got[0].Result != "Error: counter is stuck" {
+		t.Errorf("tool events = %+v", got)
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	entries := recordRun(t)
+	without := func(typ string) []transcript.Entry {
+		return slices.DeleteFunc(slices.Clone(entries), func(e transcript.Entry) bool { return e.Type == typ })
+	}
+	changedAnswer := slices.Clone(entries)
+	changedAnswer[len(changedAnswer)-1].Result = "The counter is at 3."
+	fewerIterations := DefaultConfig()
+	fewerIterations.MaxIterations = 1
+
+	tests := []struct {
+		name    string
+		entries []transcript.Entry
+		cfg     Config
+		want    string
+	}{
+		{"missing tool call", without(transcript.TypeTool), DefaultConfig(), "recorded an LLM call, replayed tool call counter.next"},
+		{"different answer", changedAnswer, DefaultConfig(), `recorded answer "The counter is at 3.", replayed answer "The counter is at 2."`},
+		{"stopped early", entries, fewerIterations, "recorded an LLM call, replayed the end of the run"},
+	}
+	for _, tt := range tests {
+		_, err := Replay(context.Background(), tt.entries, tt.cfg, RunOptions{})
+		var div *DivergenceError
+		if !errors.As(err, &div) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := Replay(context.Background(), without(transcript.TypeStart), DefaultConfig(), RunOptions{}); err == nil {
+		t.Error("expected an error without a start entry")
+	}
+}
@@ -0,0 +1,182 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+var (
+	// ErrUnknownRun is returned for run IDs that were never submitted or
+	// have been forgotten.
+	ErrUnknownRun = errors.New("unknown run")
+	// ErrRunPending is returned by Result while the run is in progress.
+	ErrRunPending = errors.New("run still in progress")
+)
+
+// Run statuses for RunInfo.Status.
+const (
+	RunRunning     = "running"
+	RunDone        = "done"
+	RunFailed      = "failed"
+	RunInterrupted = "interrupted"
+)
+
+// RunInfo describes a run started with Submit.
+type RunInfo struct {
+	ID       string         `json:"id"`
+	Session  string         `json:"session"`
+	Status   string         `json:"status"` // RunRunning, RunDone, RunFailed, or RunInterrupted
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished,omitzero"`
+	Result   string         `json:"result,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Usage    provider.Usage `json:"usage"`
+	Cost     float64        `json:"cost_usd,omitempty"`
+
+	err error
+}
+
+// Runs keeps track of submitted runs. Share one between loops (Config.Runs)
+// so a run can be looked up whichever loop started it. Finished runs are
+// forgotten after the keep duration.
+type Runs struct {
+	mu     sync.Mutex
+	keep   time.Duration // 0 = forever
+	nextID int
+	runs   map[string]*RunInfo
+}
+
+// NewRuns creates a run tracker that forgets finished runs after keep
+// (0 = never).
+func NewRuns(keep time.Duration) *Runs {
+	return &Runs{keep: keep, runs: make(map[string]*RunInfo)}
+}
+
+// Get returns the run with id.
+func (r *Runs) Get(id string) (RunInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.runs[id]
+	if !ok {
+		return RunInfo{}, false
+	}
+	return *info, true
+}
+
+// List returns every known run, oldest first.
+func (r *Runs) List() []RunInfo {
+	r.mu.Lock()
+	list := make([]RunInfo, 0, len(r.runs))
+	for _, info := range r.runs {
+		list = append(list, *info)
+	}
+	r.mu.Unlock()
+	slices.SortFunc(list, func(a, b RunInfo) int { return a.Started.Compare(b.Started) })
+	return list
+}
+
+// add registers a new running run for session and prunes old ones. It
+// fails if session already has a run in progress.
+func (r *Runs) add(session string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, info := range r.runs {
+		if info.Session == session && info.Status == RunRunning {
+			return "", fmt.Errorf("session %s already has run %s in progress", session, info.ID)
+		}
+	}
+	now := time.Now()
+	if r.keep > 0 {
+		for id, info := range r.runs {
+			if info.Status != RunRunning && now.Sub(info.Finished) > r.keep {
+				delete(r.runs, id)
+			}
+		}
+	}
+	r.nextID++
+	id := strconv.Itoa(r.nextID)
+	r.runs[id] = &RunInfo{ID: id, Session: session, Status: RunRunning, Started: now}
+	return id, nil
+}
+
+// finish records the outcome of run id.
+func (r *Runs) finish(id, result string, err error, usage provider.Usage, usd float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.runs[id]
+	if !ok {
+		return
+	}
+	info.Finished = time.Now()
+	info.Result, info.err, info.Usage, info.Cost = result, err, usage, usd
+	switch {
+	case errors.Is(err, ErrInterrupted):
+		info.Status = RunInterrupted
+	case err != nil:
+		info.Status = RunFailed
+	default:
+		info.Status = RunDone
+	}
+	if err != nil {
+		info.Error = err.Error()
+	}
+}
+
+// Submit starts Run in the background and returns its run ID. See
+// SubmitWith.
+func (al *AgentLoop) Submit(ctx context.Context, userMessage string) (string, error) {
+	return al.SubmitWith(ctx, userMessage, RunOptions{})
+}
+
+// SubmitWith starts RunWith in the background and returns its run ID for
+// Status and Result. ctx bounds the run, not the call, so pass one that
+// outlives the caller's request. It fails if the session already has a
+// submitted run in progress.
+func (al *AgentLoop) SubmitWith(ctx context.Context, userMessage string, opts RunOptions) (string, error) {
+	var usage provider.Usage
+	var usd float64
+	if opts.Usage == nil {
+		opts.Usage = &usage
+	}
+	if opts.Cost == nil {
+		opts.Cost = &usd
+	}
+	id, err := al.submitted.add(al.cfg.SessionKey)
+	if err != nil {
+		return "", err
+	}
+	go func() {
+		result, err := al.RunWith(ctx, userMessage, opts)
+		al.submitted.finish(id, result, err, *opts.Usage, *opts.Cost)
+	}()
+	return id, nil
+}
+
+// Status reports on a submitted run.
+func (al *AgentLoop) Status(runID string) (RunInfo, error) {
+	info, ok := al.submitted.Get(runID)
+	if !ok {
+		return RunInfo{}, fmt.Errorf("%w %s", ErrUnknownRun, runID)
+	}
+	return info, nil
+}
+
+// Result returns a submitted run's answer, or its error once it has
+// failed. It returns ErrRunPending while the run is in progress.
+func (al *AgentLoop) Result(runID string) (string, error) {
+	info, err := al.Status(runID)
+	if err != nil {
+		return "", err
+	}
+	if info.Status == RunRunning {
+		return "", ErrRunPending
+	}
+	return info.Result, info.err
+}
@@ -0,0 +1,86 @@
+package loop
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// waitRun polls a submitted run until it finishes.
+func waitRun(t *testing.T, al *AgentLoop, id string) RunInfo {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		info, err := al.Status(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Status != RunRunning {
+			return info
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("run %s did not finish", id)
+	return RunInfo{}
+}
+
+func TestSubmit(t *testing.T) {
+	release := make(chan struct{})
+	mp := mockProvider(func(ctx context.Context, _ provider.ChatRequest) (*provider.ChatResponse, error) {
+		<-release
+		return &provider.ChatResponse{Content: "done", Usage: provider.Usage{PromptTokens: 5, CompletionTokens: 2}}, nil
+	})
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+
+	id, err := al.Submit(context.Background(), "long task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := al.Result(id); !errors.Is(err, ErrRunPending) {
+		t.Errorf("result while running: err = %v", err)
+	}
+	for len(mp.Calls()) == 0 {
+		time.Sleep(time.Millisecond) // Wait until the run is under way
+	}
+	if _, err := al.Submit(context.Background(), "another"); err == nil {
+		t.Error("expected an error submitting to a busy session")
+	}
+
+	close(release)
+	info := waitRun(t, al, id)
+	if info.Status != RunDone || info.Result != "done" || info.Usage.CompletionTokens != 2 || info.Finished.IsZero() {
+		t.Errorf("info = %+v", info)
+	}
+	if result, err := al.Result(id); err != nil || result != "done" {
+		t.Errorf("Result = %q, %v", result, err)
+	}
+	if _, err := al.Status("nope"); !errors.Is(err, ErrUnknownRun) {
+		t.Errorf("unknown run: err = %v", err)
+	}
+}
+
+func TestSubmit_Failure(t *testing.T) {
+	runs := NewRuns(time.Hour)
+	al := makeLoop(t, mockProvider(providertest.Fail(errors.New("API down"))), toolreg.NewRegistry(30*time.Second))
+	al.submitted = runs
+
+	id, err := al.Submit(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := waitRun(t, al, id)
+	if info.Status != RunFailed || info.Error == "" {
+		t.Errorf("info = %+v", info)
+	}
+	if _, err := al.Result(id); err == nil {
+		t.Error("expected the run's error from Result")
+	}
+	if list := runs.List(); len(list) != 1 || list[0].ID != id {
+		t.Errorf("shared runs = %+v", list)
+	}
+}
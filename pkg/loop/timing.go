@@ -0,0 +1,120 @@
+package loop
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+// timings collects how long each step of a verbose run took, for the
+// summary logged when it ends. A nil *timings records nothing.
+type timings struct {
+	start time.Time
+	steps []timedStep
+}
+
+type timedStep struct {
+	iteration int
+	kind      string // "llm", "tool", or "reflect"
+	name      string // Model or tool
+	d         time.Duration
+	detail    string
+}
+
+// newTimings starts timing a run if the loop is verbose.
+func (al *AgentLoop) newTimings() *timings {
+	if !al.cfg.Verbose {
+		return nil
+	}
+	return &timings{start: time.Now()}
+}
+
+// llm logs an LLM call as a key=value event and records it.
+func (t *timings) llm(kind string, iteration int, model string, resp *provider.ChatResponse, d time.Duration, err error) {
+	if t == nil {
+		return
+	}
+	model = cmp.Or(model, "-")
+	var detail string
+	if err != nil {
+		detail = "error: " + truncate(err.Error(), 60)
+		log.Printf("[loop] %s iteration=%d model=%s duration=%s error=%q", kind, iteration, model, roundDuration(d), err)
+	} else {
+		model = cmp.Or(resp.Model, model)
+		detail = fmt.Sprintf("%d+%d tokens, %d tool calls", resp.Usage.PromptTokens, resp.Usage.CompletionTokens, len(resp.ToolCalls))
+		log.Printf("[loop] %s iteration=%d model=%s duration=%s prompt_tokens=%d completion_tokens=%d chars=%d tool_calls=%d stop=%s",
+			kind, iteration, model, roundDuration(d), resp.Usage.PromptTokens, resp.Usage.CompletionTokens, len(resp.Content), len(resp.ToolCalls), cmp.Or(resp.StopReason, "-"))
+	}
+	t.steps = append(t.steps, timedStep{iteration: iteration, kind: kind, name: model, d: d, detail: detail})
+}
+
+// tool logs a tool call as a key=value event and records it.
+func (t *timings) tool(iteration int, tc provider.ToolCall, res toolreg.ToolResult, d time.Duration, err error) {
+	if t == nil {
+		return
+	}
+	detail := fmt.Sprintf("exit %d, %d bytes", res.ExitCode, len(res.Stdout))
+	if err != nil {
+		detail = "error: " + truncate(err.Error(), 60)
+		log.Printf("[loop] tool iteration=%d name=%s duration=%s exit=%d bytes=%d error=%q", iteration, tc.Name, roundDuration(d), res.ExitCode, len(res.Stdout), err)
+	} else {
+		log.Printf("[loop] tool iteration=%d name=%s duration=%s exit=%d bytes=%d", iteration, tc.Name, roundDuration(d), res.ExitCode, len(res.Stdout))
+	}
+	t.steps = append(t.steps, timedStep{iteration: iteration, kind: "tool", name: tc.Name, d: d, detail: detail})
+}
+
+// logSummary logs a table of the run's steps with their share of its
+// time, then totals for LLM calls and tools and the slowest step.
+func (t *timings) logSummary() {
+	if t == nil || len(t.steps) == 0 {
+		return
+	}
+	total := time.Since(t.start)
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ITER\tSTEP\tNAME\tTIME\tSHARE\tDETAIL")
+	var llm, tools time.Duration
+	var llmCalls, toolCalls int
+	for _, s := range t.steps {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d%%\t%s\n", s.iteration, s.kind, s.name, roundDuration(s.d), share(s.d, total), s.detail)
+		if s.kind == "tool" {
+			tools += s.d
+			toolCalls++
+		} else {
+			llm += s.d
+			llmCalls++
+		}
+	}
+	w.Flush()
+	slowest := slices.MaxFunc(t.steps, func(a, b timedStep) int { return cmp.Compare(a.d, b.d) })
+	fmt.Fprintf(&b, "total %s: LLM %s in %d calls (%d%%), tools %s in %d calls (%d%%), other %s; slowest: %s %s in iteration %d (%s)",
+		roundDuration(total), roundDuration(llm), llmCalls, share(llm, total), roundDuration(tools), toolCalls, share(tools, total),
+		roundDuration(max(total-llm-tools, 0)), slowest.kind, slowest.name, slowest.iteration, roundDuration(slowest.d))
+	log.Printf("[loop] run summary:\n%s", b.String())
+}
+
+// share returns d as a whole percentage of total.
+func share(d, total time.Duration) int {
+	if total <= 0 {
+		return 0
+	}
+	return int(d * 100 / total)
+}
+
+// roundDuration rounds d to a precision that suits its size.
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
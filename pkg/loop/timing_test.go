@@ -0,0 +1,55 @@
+package loop
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func TestRun_VerboseTimings(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	mp := mockProvider(
+		providertest.ToolCall("nap.take", `{}`),
+		providertest.Respond(&provider.ChatResponse{Content: "Rested.", Model: "m1", Usage: provider.Usage{PromptTokens: 12, CompletionTokens: 3}}),
+	)
+	reg := toolreg.NewRegistry(30 * time.Second)
+	reg.Register(&toolreg.ToolManifest{
+		Name: "nap",
+		Commands: map[string]toolreg.CommandDef{"take": {Handler: func(context.Context, map[string]any) (toolreg.ToolResult, error) {
+			time.Sleep(20 * time.Millisecond)
+			return toolreg.ToolResult{Stdout: "zzz"}, nil
+		}}},
+	})
+	al := makeLoop(t, mp, reg)
+	al.cfg.Verbose = true
+	if _, err := al.Run(context.Background(), "Take a nap"); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"[loop] tool iteration=1 name=nap.take duration=2",
+		"exit=0 bytes=3",
+		"[loop] llm iteration=2 model=m1 duration=",
+		"prompt_tokens=12 completion_tokens=3 chars=7 tool_calls=0",
+		"[loop] run summary:\nITER  STEP  NAME",
+		"1     tool  nap.take",
+		"12+3 tokens, 0 tool calls",
+		"tools 2",
+		"slowest: tool nap.take in iteration 1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log missing %q:\n%s", want, out)
+		}
+	}
+}
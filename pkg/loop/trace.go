@@ -0,0 +1,52 @@
+package loop
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// tracerName identifies spans created by the loop.
+const tracerName = "github.com/rcliao/teeny-orchestrator/pkg/loop"
+
+// chat calls the provider inside an "llm.chat" span carrying the
+// iteration, model, token usage, and cost, and records the call in Metrics.
+// It returns the call's estimated cost in USD (0 for unpriced models).
+func (al *AgentLoop) chat(ctx context.Context, p provider.Provider, iteration int, req provider.ChatRequest) (*provider.ChatResponse, float64, error) {
+	ctx, span := al.tracer.Start(ctx, "llm.chat", trace.WithAttributes(
+		attribute.String("gen_ai.system", p.Name()),
+		attribute.String("gen_ai.request.model", req.Model),
+		attribute.Int("iteration", iteration),
+		attribute.Int("messages", len(req.Messages)),
+	))
+	defer span.End()
+
+	resp, err := p.Chat(ctx, req)
+	if err != nil {
+		al.cfg.Metrics.ObserveLLMCall(p.Name(), req.Model, 0, 0, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, 0, err
+	}
+	model := resp.Model
+	if model == "" {
+		model = req.Model
+	}
+	usd := al.cfg.Pricing.Cost(model, resp.Usage)
+	span.SetAttributes(
+		attribute.String("gen_ai.response.model", resp.Model),
+		attribute.Int("gen_ai.usage.input_tokens", resp.Usage.PromptTokens),
+		attribute.Int("gen_ai.usage.output_tokens", resp.Usage.CompletionTokens),
+		attribute.Int("tool_calls", len(resp.ToolCalls)),
+		attribute.Float64("cost_usd", usd),
+	)
+	al.cfg.Metrics.ObserveLLMCall(p.Name(), resp.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, nil)
+	if usd > 0 {
+		al.cfg.Metrics.ObserveCost(p.Name(), model, usd)
+	}
+	return resp, usd, nil
+}
@@ -0,0 +1,85 @@
+package loop
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func spanAttr(s sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range s.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestRun_Tracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	reg := toolreg.NewRegistry(30 * time.Second)
+	reg.SetTracerProvider(tp)
+	reg.Register(&toolreg.ToolManifest{
+		Name: "echo",
+		Commands: map[string]toolreg.CommandDef{
+			"run": {Handler: func(ctx context.Context, args map[string]any) (toolreg.ToolResult, error) {
+				return toolreg.ToolResult{Stdout: "hi"}, nil
+			}},
+		},
+	})
+	mp := mockProvider(
+		providertest.Respond(&provider.ChatResponse{ToolCalls: []provider.ToolCall{{ID: "tc1", Name: "echo.run", Arguments: `{}`}}, Model: "m1",
+			Usage: provider.Usage{PromptTokens: 20, CompletionTokens: 5}}),
+		providertest.Respond(&provider.ChatResponse{Content: "done", Model: "m1"}),
+	)
+	base := makeLoop(t, mp, reg)
+	cfg := base.cfg
+	cfg.TracerProvider = tp
+	al := New(mp, reg, base.ctxBuilder, base.sessions, cfg)
+
+	if _, err := al.Run(context.Background(), "hi"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	var names []string
+	byName := map[string][]sdktrace.ReadOnlySpan{}
+	for _, s := range sr.Ended() {
+		names = append(names, s.Name())
+		byName[s.Name()] = append(byName[s.Name()], s)
+	}
+	if len(byName["agent.run"]) != 1 || len(byName["llm.chat"]) != 2 || len(byName["tool.execute"]) != 1 {
+		t.Fatalf("spans = %v", names)
+	}
+
+	run := byName["agent.run"][0]
+	if got := spanAttr(run, "iterations").AsInt64(); got != 2 {
+		t.Errorf("iterations = %d, want 2", got)
+	}
+	first := byName["llm.chat"][0]
+	if first.Parent().SpanID() != run.SpanContext().SpanID() {
+		t.Error("llm.chat is not a child of agent.run")
+	}
+	if got := spanAttr(first, "gen_ai.usage.input_tokens").AsInt64(); got != 20 {
+		t.Errorf("input tokens = %d, want 20", got)
+	}
+	if got := spanAttr(first, "gen_ai.response.model").AsString(); got != "m1" {
+		t.Errorf("model = %q, want m1", got)
+	}
+	tool := byName["tool.execute"][0]
+	if got := spanAttr(tool, "tool.name").AsString(); got != "echo.run" {
+		t.Errorf("tool.name = %q", got)
+	}
+	if tool.Parent().SpanID() != run.SpanContext().SpanID() {
+		t.Error("tool.execute is not a child of agent.run")
+	}
+}
@@ -0,0 +1,53 @@
+package loop
+
+import "github.com/rcliao/teeny-orchestrator/pkg/provider"
+
+// maxContextTrims is how many times a call rejected for overflowing the
+// context window is retried with fewer messages before the run fails.
+const maxContextTrims = 3
+
+// trimMessages drops the oldest messages that can go when a prompt
+// overflows the context window, and returns the rest with the new index of
+// the run's first message. System messages and the user message that
+// started the run are always kept. The older half of the session history
+// goes first, cut at a user message so no tool call loses its result; once
+// history is gone, the run's oldest tool exchanges go, keeping the latest.
+// ok is false if nothing more can be dropped.
+func trimMessages(msgs []provider.Message, start int) (trimmed []provider.Message, newStart int, ok bool) {
+	sys := 0
+	for sys < len(msgs) && msgs[sys].Role == "system" {
+		sys++
+	}
+	prompt := start - 1 // The user message that started the run
+	if prompt < sys || start > len(msgs) {
+		return msgs, start, false
+	}
+
+	if history := prompt - sys; history > 0 {
+		cut := sys + max(history/2, 1)
+		for cut < prompt && msgs[cut].Role != "user" {
+			cut++
+		}
+		return drop(msgs, sys, cut), start - (cut - sys), true
+	}
+
+	// Each exchange starts with an assistant message and runs to the next
+	var exchanges []int
+	for i := start; i < len(msgs); i++ {
+		if msgs[i].Role == "assistant" {
+			exchanges = append(exchanges, i)
+		}
+	}
+	if len(exchanges) < 2 {
+		return msgs, start, false
+	}
+	cut := exchanges[len(exchanges)/2]
+	return drop(msgs, start, cut), start, true
+}
+
+// drop returns msgs without msgs[from:to], leaving msgs unchanged.
+func drop(msgs []provider.Message, from, to int) []provider.Message {
+	out := make([]provider.Message, 0, len(msgs)-(to-from))
+	out = append(out, msgs[:from]...)
+	return append(out, msgs[to:]...)
+}
@@ -0,0 +1,131 @@
+package loop
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func TestTrimMessages(t *testing.T) {
+	sys := provider.Message{Role: "system", Content: "sys"}
+	user := func(s string) provider.Message { return provider.Message{Role: "user", Content: s} }
+	asst := func(s string) provider.Message { return provider.Message{Role: "assistant", Content: s} }
+	call := func(s string) provider.Message {
+		return provider.Message{Role: "assistant", ToolCalls: []provider.ToolCall{{ID: s, Name: "echo"}}}
+	}
+	result := func(s string) provider.Message { return provider.Message{Role: "tool", ToolCallID: s, Content: s} }
+
+	tests := []struct {
+		name      string
+		msgs      []provider.Message
+		start     int
+		want      string // Contents (or tool call IDs) of the kept messages
+		wantStart int
+		wantOK    bool
+	}{
+		{
+			name:      "older half of history",
+			msgs:      []provider.Message{sys, user("u1"), asst("a1"), user("u2"), asst("a2"), user("prompt")},
+			start:     6,
+			want:      "sys u2 a2 prompt",
+			wantStart: 4,
+			wantOK:    true,
+		},
+		{
+			name:      "history cut at a user message",
+			msgs:      []provider.Message{sys, user("u1"), call("t1"), result("t1"), asst("a1"), user("u2"), asst("a2"), user("prompt")},
+			start:     8,
+			want:      "sys u2 a2 prompt",
+			wantStart: 4,
+			wantOK:    true,
+		},
+		{
+			name:      "last history message",
+			msgs:      []provider.Message{sys, asst("a1"), user("prompt"), call("t1"), result("t1")},
+			start:     3,
+			want:      "sys prompt t1 t1",
+			wantStart: 2,
+			wantOK:    true,
+		},
+		{
+			name:      "oldest tool exchanges",
+			msgs:      []provider.Message{sys, user("prompt"), call("t1"), result("t1"), call("t2"), result("t2"), user("steer"), call("t3"), result("t3")},
+			start:     2,
+			want:      "sys prompt t2 t2 steer t3 t3",
+			wantStart: 2,
+			wantOK:    true,
+		},
+		{
+			name:      "latest exchange kept",
+			msgs:      []provider.Message{sys, user("prompt"), call("t1"), result("t1")},
+			start:     2,
+			want:      "sys prompt t1 t1",
+			wantStart: 2,
+			wantOK:    false,
+		},
+	}
+	for _, tt := range tests {
+		got, start, ok := trimMessages(tt.msgs, tt.start)
+		var kept []string
+		for _, m := range got {
+			if len(m.ToolCalls) > 0 {
+				kept = append(kept, m.ToolCalls[0].ID)
+			} else {
+				kept = append(kept, m.Content)
+			}
+		}
+		if strings.Join(kept, " ") != tt.want || start != tt.wantStart || ok != tt.wantOK {
+			t.Errorf("%s: got %v, start %d, ok %v; want %s, start %d, ok %v", tt.name, kept, start, ok, tt.want, tt.wantStart, tt.wantOK)
+		}
+	}
+}
+
+func TestRun_ContextOverflow(t *testing.T) {
+	overflow := &provider.HTTPError{Provider: "anthropic", StatusCode: 400, Body: "prompt is too long: 210000 tokens > 200000 maximum"}
+	mp := mockProvider(providertest.Fail(overflow), providertest.Text("done"))
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+	for _, m := range []string{"u1", "a1", "u2", "a2"} {
+		role := "user"
+		if m[0] == 'a' {
+			role = "assistant"
+		}
+		al.sessions.AddMessage("main", provider.Message{Role: role, Content: m})
+	}
+
+	result, err := al.Run(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result != "done" {
+		t.Errorf("result = %q", result)
+	}
+	first, retry := mp.Call(0).Messages, mp.Call(1).Messages
+	if len(retry) >= len(first) {
+		t.Errorf("retry sent %d messages, first call %d", len(retry), len(first))
+	}
+	if last := retry[len(retry)-1]; last.Content != "prompt" {
+		t.Errorf("retry ends with %q, want the prompt", last.Content)
+	}
+	// The session keeps the dropped messages
+	if got := len(al.sessions.GetHistory("main")); got != 6 {
+		t.Errorf("history has %d messages, want 6", got)
+	}
+}
+
+func TestRun_ContextOverflowUntrimmable(t *testing.T) {
+	overflow := &provider.HTTPError{Provider: "openai", StatusCode: 400, Body: `{"error":{"code":"context_length_exceeded"}}`}
+	mp := mockProvider(providertest.Fail(overflow))
+	al := makeLoop(t, mp, toolreg.NewRegistry(30*time.Second))
+
+	if _, err := al.Run(context.Background(), "prompt"); !provider.ContextOverflow(err) {
+		t.Errorf("err = %v, want the context overflow", err)
+	}
+	if n := len(mp.Calls()); n != 1 {
+		t.Errorf("%d calls, want 1", n)
+	}
+}
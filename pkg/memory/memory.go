@@ -0,0 +1,225 @@
+// Package memory is a local store for learnings and notes, searchable by
+// full text. It replaces shelling out to the agent-memory binary.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure-Go SQLite driver with FTS5
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS memories (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	content    TEXT NOT NULL,
+	tags       TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS memories_fts USING fts5(
+	content, tags, content='memories', content_rowid='id'
+);
+CREATE TRIGGER IF NOT EXISTS memories_ai AFTER INSERT ON memories BEGIN
+	INSERT INTO memories_fts(rowid, content, tags) VALUES (new.id, new.content, new.tags);
+END;
+CREATE TRIGGER IF NOT EXISTS memories_ad AFTER DELETE ON memories BEGIN
+	INSERT INTO memories_fts(memories_fts, rowid, content, tags) VALUES ('delete', old.id, old.content, old.tags);
+END;
+CREATE TRIGGER IF NOT EXISTS memories_au AFTER UPDATE ON memories BEGIN
+	INSERT INTO memories_fts(memories_fts, rowid, content, tags) VALUES ('delete', old.id, old.content, old.tags);
+	INSERT INTO memories_fts(rowid, content, tags) VALUES (new.id, new.content, new.tags);
+END;
+`
+
+// Memory is one stored entry.
+type Memory struct {
+	ID      int64     `json:"id"`
+	Content string    `json:"content"`
+	Tags    []string  `json:"tags,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Store keeps memories in a SQLite database. It is safe for concurrent use.
+type Store struct {
+	db       *sql.DB
+	embedder provider.Embedder // nil disables semantic recall
+}
+
+// Open opens (or creates) a memory database at path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("memory: create db dir: %w", err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("memory: open db: %w", err)
+	}
+	db.SetMaxOpenConns(1) // SQLite serializes writers anyway
+	if _, err := db.Exec(schema + embeddingsSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("memory: init schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Add stores content with tags and returns its ID.
+func (s *Store) Add(ctx context.Context, content string, tags []string) (int64, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return 0, fmt.Errorf("memory: empty content")
+	}
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO memories (content, tags, created_at) VALUES (?, ?, ?)`,
+		content, joinTags(tags), time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, fmt.Errorf("memory: add: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if s.embedder != nil {
+		// A failure here is retried by the next Recall.
+		if err := s.embed(ctx, []Memory{{ID: id, Content: content, Tags: splitTags(joinTags(tags))}}); err != nil {
+			log.Printf("[memory] embed %d: %v", id, err)
+		}
+	}
+	return id, nil
+}
+
+// Search returns up to limit memories matching any word of query in their
+// content or tags, best match first.
+func (s *Store) Search(ctx context.Context, query string, limit int) ([]Memory, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+	return s.query(ctx,
+		`SELECT m.id, m.content, m.tags, m.created_at FROM memories_fts f
+		 JOIN memories m ON m.id = f.rowid
+		 WHERE memories_fts MATCH ? ORDER BY bm25(memories_fts) LIMIT ?`,
+		match, limitOrAll(limit))
+}
+
+// Tagged returns up to limit memories carrying tag, newest first.
+func (s *Store) Tagged(ctx context.Context, tag string, limit int) ([]Memory, error) {
+	return s.query(ctx,
+		`SELECT id, content, tags, created_at FROM memories
+		 WHERE ',' || tags || ',' LIKE '%,' || ? || ',%' ESCAPE '\' ORDER BY id DESC LIMIT ?`,
+		likeEscaper.Replace(tag), limitOrAll(limit))
+}
+
+// likeEscaper escapes LIKE wildcards, so a tag only matches itself.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Get returns the memory with id.
+func (s *Store) Get(ctx context.Context, id int64) (*Memory, error) {
+	ms, err := s.query(ctx, `SELECT id, content, tags, created_at FROM memories WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ms) == 0 {
+		return nil, fmt.Errorf("memory: no memory %d", id)
+	}
+	return &ms[0], nil
+}
+
+// Tag adds tags to a memory. Tags it already has are ignored.
+func (s *Store) Tag(ctx context.Context, id int64, tags ...string) error {
+	m, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t != "" && !slices.Contains(m.Tags, t) {
+			m.Tags = append(m.Tags, t)
+		}
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE memories SET tags = ? WHERE id = ?`, joinTags(m.Tags), id); err != nil {
+		return fmt.Errorf("memory: tag: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a memory. Deleting a missing ID is an error.
+func (s *Store) Delete(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM memories WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("memory: delete: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("memory: no memory %d", id)
+	}
+	return nil
+}
+
+// Close releases the database handle.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) query(ctx context.Context, q string, args ...any) ([]Memory, error) {
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("memory: query: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Memory
+	for rows.Next() {
+		var m Memory
+		var tags, created string
+		if err := rows.Scan(&m.ID, &m.Content, &tags, &created); err != nil {
+			return nil, fmt.Errorf("memory: scan: %w", err)
+		}
+		m.Tags = splitTags(tags)
+		m.Created, _ = time.Parse(time.RFC3339Nano, created)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// ftsQuery turns free text into an FTS5 query matching any of its words.
+// Words are quoted so punctuation and FTS operators are taken literally.
+func ftsQuery(text string) string {
+	var terms []string
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool {
+		return !(r == '_' || r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 127)
+	}) {
+		terms = append(terms, `"`+w+`"`)
+	}
+	return strings.Join(terms, " OR ")
+}
+
+func joinTags(tags []string) string {
+	var clean []string
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t != "" {
+			clean = append(clean, strings.ReplaceAll(t, ",", " "))
+		}
+	}
+	return strings.Join(clean, ",")
+}
+
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+func limitOrAll(limit int) int {
+	if limit <= 0 {
+		return -1 // SQLite: no limit
+	}
+	return limit
+}
@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "sub", "memory.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestAddAndSearch(t *testing.T) {
+	s := openStore(t)
+	ctx := t.Context()
+	s.Add(ctx, "Run git.status before committing", []string{"orchestrator", "git"})
+	s.Add(ctx, "The deploy script needs AWS_PROFILE set", []string{"deploy"})
+	s.Add(ctx, "Prefer small commits; git history stays readable", []string{"orchestrator"})
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"git", 2},
+		{"deploy", 1},
+		{"orchestrator learnings", 2}, // Matches the tag; any word is enough
+		{"AWS_PROFILE", 1},
+		{`"unbalanced (quote* OR`, 0}, // FTS syntax is taken literally
+		{"", 0},
+	}
+	for _, tt := range tests {
+		got, err := s.Search(ctx, tt.query, 10)
+		if err != nil {
+			t.Errorf("Search(%q): %v", tt.query, err)
+			continue
+		}
+		if len(got) != tt.want {
+			t.Errorf("Search(%q) = %d results, want %d: %+v", tt.query, len(got), tt.want, got)
+		}
+	}
+
+	got, _ := s.Search(ctx, "git", 1)
+	if len(got) != 1 {
+		t.Errorf("limit ignored: %d results", len(got))
+	}
+}
+
+func TestTagAndDelete(t *testing.T) {
+	s := openStore(t)
+	ctx := t.Context()
+	id, err := s.Add(ctx, "Tests live next to sources", []string{"go"})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := s.Tag(ctx, id, "layout", "go"); err != nil {
+		t.Fatalf("tag: %v", err)
+	}
+	m, err := s.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(m.Tags, []string{"go", "layout"}) || m.Created.IsZero() {
+		t.Errorf("memory = %+v", m)
+	}
+	if got, _ := s.Search(ctx, "layout", 10); len(got) != 1 {
+		t.Errorf("new tag not searchable: %+v", got)
+	}
+	if got, _ := s.Tagged(ctx, "layout", 10); len(got) != 1 {
+		t.Errorf("Tagged = %+v", got)
+	}
+	if got, _ := s.Tagged(ctx, "lay", 10); len(got) != 0 {
+		t.Errorf("Tagged matched a tag prefix: %+v", got)
+	}
+	for _, tag := range []string{"lay%", "lay_ut", "%"} {
+		if got, _ := s.Tagged(ctx, tag, 10); len(got) != 0 {
+			t.Errorf("Tagged(%q) matched as a wildcard: %+v", tag, got)
+		}
+	}
+	if _, err := s.Add(ctx, "Coverage runs nightly", []string{"ci_100%"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Tagged(ctx, "ci_100%", 10); len(got) != 1 {
+		t.Errorf("Tagged with wildcard characters = %+v", got)
+	}
+
+	if err := s.Delete(ctx, id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got, _ := s.Search(ctx, "tests", 10); len(got) != 0 {
+		t.Errorf("deleted memory still searchable: %+v", got)
+	}
+	if err := s.Delete(ctx, id); err == nil {
+		t.Error("expected error deleting a missing memory")
+	}
+	if _, err := s.Add(ctx, "  ", nil); err == nil {
+		t.Error("expected error for empty content")
+	}
+}
@@ -0,0 +1,167 @@
+package memory
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+const embeddingsSchema = `
+CREATE TABLE IF NOT EXISTS embeddings (
+	memory_id INTEGER PRIMARY KEY,
+	model     TEXT NOT NULL,
+	vector    BLOB NOT NULL
+);
+CREATE TRIGGER IF NOT EXISTS embeddings_ad AFTER DELETE ON memories BEGIN
+	DELETE FROM embeddings WHERE memory_id = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS embeddings_au AFTER UPDATE OF content ON memories BEGIN
+	DELETE FROM embeddings WHERE memory_id = old.id;
+END;
+`
+
+// embedBatch is how many memories are embedded per request when
+// backfilling.
+const embedBatch = 64
+
+// UseEmbedder enables semantic recall. Memories are embedded as they are
+// added; ones stored earlier, or under a different model, are embedded on
+// the next Recall.
+func (s *Store) UseEmbedder(e provider.Embedder) {
+	s.embedder = e
+}
+
+// Recall returns up to limit memories closest in meaning to query. Without
+// an embedder, or if embedding fails, it falls back to Search.
+func (s *Store) Recall(ctx context.Context, query string, limit int) ([]Memory, error) {
+	if s.embedder == nil || strings.TrimSpace(query) == "" {
+		return s.Search(ctx, query, limit)
+	}
+	ms, err := s.recall(ctx, query, limit)
+	if err != nil {
+		log.Printf("[memory] semantic recall failed, using full-text search: %v", err)
+		return s.Search(ctx, query, limit)
+	}
+	return ms, nil
+}
+
+func (s *Store) recall(ctx context.Context, query string, limit int) ([]Memory, error) {
+	if err := s.backfill(ctx); err != nil {
+		return nil, err
+	}
+	qv, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT memory_id, vector FROM embeddings WHERE model = ?`, s.embedder.Model())
+	if err != nil {
+		return nil, fmt.Errorf("memory: query embeddings: %w", err)
+	}
+	type hit struct {
+		id    int64
+		score float64
+	}
+	var hits []hit
+	for rows.Next() {
+		var h hit
+		var blob []byte
+		if err := rows.Scan(&h.id, &blob); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("memory: scan embedding: %w", err)
+		}
+		h.score = provider.Cosine(qv[0], decodeVector(blob))
+		hits = append(hits, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	out := make([]Memory, 0, len(hits))
+	for _, h := range hits {
+		m, err := s.Get(ctx, h.id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *m)
+	}
+	return out, nil
+}
+
+// embed stores vectors for memories.
+func (s *Store) embed(ctx context.Context, ms []Memory) error {
+	if len(ms) == 0 {
+		return nil
+	}
+	texts := make([]string, len(ms))
+	for i, m := range ms {
+		texts[i] = embedText(m)
+	}
+	vecs, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	model := s.embedder.Model()
+	for i, m := range ms {
+		_, err := s.db.ExecContext(ctx,
+			`INSERT INTO embeddings (memory_id, model, vector) VALUES (?, ?, ?)
+			 ON CONFLICT(memory_id) DO UPDATE SET model = excluded.model, vector = excluded.vector`,
+			m.ID, model, encodeVector(vecs[i]))
+		if err != nil {
+			return fmt.Errorf("memory: save embedding: %w", err)
+		}
+	}
+	return nil
+}
+
+// backfill embeds memories that have no vector from the current model.
+func (s *Store) backfill(ctx context.Context) error {
+	for {
+		ms, err := s.query(ctx,
+			`SELECT m.id, m.content, m.tags, m.created_at FROM memories m
+			 LEFT JOIN embeddings e ON e.memory_id = m.id AND e.model = ?
+			 WHERE e.memory_id IS NULL ORDER BY m.id LIMIT ?`,
+			s.embedder.Model(), embedBatch)
+		if err != nil || len(ms) == 0 {
+			return err
+		}
+		if err := s.embed(ctx, ms); err != nil {
+			return err
+		}
+	}
+}
+
+// embedText is what gets embedded for a memory: its content and tags.
+func embedText(m Memory) string {
+	if len(m.Tags) == 0 {
+		return m.Content
+	}
+	return m.Content + "\ntags: " + strings.Join(m.Tags, ", ")
+}
+
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+func decodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
@@ -0,0 +1,128 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// conceptEmbedder maps text onto a few hand-picked concepts so tests can
+// check ranking by meaning without a real model.
+type conceptEmbedder struct {
+	model string
+	calls int
+	fail  bool
+}
+
+var concepts = [][]string{
+	{"git", "commit", "branch", "history"},
+	{"deploy", "release", "ship", "production"},
+	{"test", "assert", "coverage"},
+}
+
+func (e *conceptEmbedder) Model() string { return e.model }
+
+func (e *conceptEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	if e.fail {
+		return nil, errors.New("embedder down")
+	}
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, len(concepts))
+		for d, words := range concepts {
+			for _, w := range words {
+				v[d] += float32(strings.Count(strings.ToLower(text), w))
+			}
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func TestRecall(t *testing.T) {
+	s := openStore(t)
+	ctx := t.Context()
+	// Stored before the embedder is set; Recall backfills them.
+	s.Add(ctx, "Run git status before committing", nil)
+	s.Add(ctx, "The deploy script needs AWS_PROFILE set", nil)
+
+	e := &conceptEmbedder{model: "fake:v1"}
+	s.UseEmbedder(e)
+	s.Add(ctx, "Keep coverage above 80% and assert on errors", nil)
+
+	// No word overlaps with the deploy memory; only its meaning does.
+	got, err := s.Recall(ctx, "how do we ship to production?", 1)
+	if err != nil {
+		t.Fatalf("recall: %v", err)
+	}
+	if len(got) != 1 || !strings.Contains(got[0].Content, "deploy") {
+		t.Errorf("Recall = %+v, want the deploy memory", got)
+	}
+	if got, _ := s.Search(ctx, "how do we ship to production?", 1); len(got) != 0 {
+		t.Errorf("keyword search unexpectedly matched: %+v", got)
+	}
+
+	got, _ = s.Recall(ctx, "which branch has the commit", 3)
+	if len(got) != 3 || !strings.Contains(got[0].Content, "git") {
+		t.Errorf("Recall ranking = %+v", got)
+	}
+
+	// Deleting a memory drops its vector.
+	if err := s.Delete(ctx, got[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	s.db.QueryRow(`SELECT COUNT(*) FROM embeddings`).Scan(&n)
+	if n != 2 {
+		t.Errorf("embeddings = %d, want 2", n)
+	}
+}
+
+func TestRecall_ModelChangeReembeds(t *testing.T) {
+	s := openStore(t)
+	ctx := t.Context()
+	s.UseEmbedder(&conceptEmbedder{model: "fake:v1"})
+	s.Add(ctx, "Release notes go in CHANGELOG.md", nil)
+
+	v2 := &conceptEmbedder{model: "fake:v2"}
+	s.UseEmbedder(v2)
+	got, err := s.Recall(ctx, "production release", 5)
+	if err != nil || len(got) != 1 {
+		t.Fatalf("Recall = %+v, %v", got, err)
+	}
+	var model string
+	s.db.QueryRow(`SELECT model FROM embeddings`).Scan(&model)
+	if model != "fake:v2" {
+		t.Errorf("stored model = %q, want fake:v2", model)
+	}
+	if v2.calls != 2 { // backfill + query
+		t.Errorf("embed calls = %d, want 2", v2.calls)
+	}
+}
+
+func TestRecall_FallsBackToSearch(t *testing.T) {
+	s := openStore(t)
+	ctx := t.Context()
+	s.UseEmbedder(&conceptEmbedder{model: "fake:v1", fail: true})
+	if _, err := s.Add(ctx, "The deploy script needs AWS_PROFILE set", nil); err != nil {
+		t.Fatalf("add should succeed when embedding fails: %v", err)
+	}
+	got, err := s.Recall(ctx, "deploy", 5)
+	if err != nil || len(got) != 1 {
+		t.Errorf("Recall = %+v, %v; want full-text fallback", got, err)
+	}
+
+	s.UseEmbedder(nil)
+	if got, _ := s.Recall(ctx, "AWS_PROFILE", 5); len(got) != 1 {
+		t.Errorf("Recall without embedder = %+v", got)
+	}
+}
+
+func TestVectorEncoding(t *testing.T) {
+	v := []float32{0.25, -1.5, 3}
+	if got := decodeVector(encodeVector(v)); len(got) != 3 || got[1] != -1.5 {
+		t.Errorf("round trip = %v", got)
+	}
+}
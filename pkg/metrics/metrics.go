@@ -0,0 +1,113 @@
+// Package metrics exports orchestrator counters and histograms in the
+// Prometheus text format.
+//
+// All Metrics methods are safe on a nil receiver, so components can hold an
+// optional *Metrics without checking it.
+package metrics
+
+import (
+	"net/http"
+	"time"
+)
+
+// Outcome label values.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// Metrics holds every orchestrator metric.
+type Metrics struct {
+	reg *Registry
+
+	llmCalls       *CounterVec
+	llmTokens      *CounterVec
+	llmCost        *CounterVec
+	toolDuration   *HistogramVec
+	loopIterations *HistogramVec
+	jobRuns        *CounterVec
+}
+
+// New creates and registers the orchestrator metrics.
+func New() *Metrics {
+	reg := NewRegistry()
+	return &Metrics{
+		reg: reg,
+		llmCalls: reg.NewCounterVec("teeny_llm_calls_total",
+			"LLM calls by provider, model, and outcome.", "provider", "model", "outcome"),
+		llmTokens: reg.NewCounterVec("teeny_llm_tokens_total",
+			"Tokens used by provider, model, and type (prompt or completion).", "provider", "model", "type"),
+		llmCost: reg.NewCounterVec("teeny_llm_cost_usd_total",
+			"Estimated LLM spend in US dollars.", "provider", "model"),
+		toolDuration: reg.NewHistogramVec("teeny_tool_duration_seconds",
+			"Tool execution latency by tool command and outcome.",
+			[]float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}, "tool", "outcome"),
+		loopIterations: reg.NewHistogramVec("teeny_loop_iterations",
+			"LLM iterations per agent run.",
+			[]float64{1, 2, 3, 5, 8, 13, 20, 50}, "intent"),
+		jobRuns: reg.NewCounterVec("teeny_scheduler_job_runs_total",
+			"Scheduled job runs by job and outcome.", "job", "outcome"),
+	}
+}
+
+// Registry returns the underlying registry for adding custom collectors.
+func (m *Metrics) Registry() *Registry {
+	return m.reg
+}
+
+// Handler serves all metrics; mount it at /metrics.
+func (m *Metrics) Handler() http.Handler {
+	return m.reg.Handler()
+}
+
+// ObserveLLMCall records one provider call and its token usage.
+func (m *Metrics) ObserveLLMCall(provider, model string, promptTokens, completionTokens int, err error) {
+	if m == nil {
+		return
+	}
+	m.llmCalls.Inc(provider, model, outcome(err))
+	if err != nil {
+		return
+	}
+	m.llmTokens.Add(float64(promptTokens), provider, model, "prompt")
+	m.llmTokens.Add(float64(completionTokens), provider, model, "completion")
+}
+
+// ObserveCost adds estimated spend for a call.
+func (m *Metrics) ObserveCost(provider, model string, usd float64) {
+	if m == nil {
+		return
+	}
+	m.llmCost.Add(usd, provider, model)
+}
+
+// ObserveTool records a tool execution's latency.
+func (m *Metrics) ObserveTool(tool string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.toolDuration.Observe(d.Seconds(), tool, outcome(err))
+}
+
+// ObserveRun records how many iterations an agent run took.
+func (m *Metrics) ObserveRun(intent string, iterations int) {
+	if m == nil {
+		return
+	}
+	m.loopIterations.Observe(float64(iterations), intent)
+}
+
+// ObserveJob records a scheduled job run.
+func (m *Metrics) ObserveJob(job string, err error) {
+	if m == nil {
+		return
+	}
+	m.jobRuns.Inc(job, outcome(err))
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+	return OutcomeSuccess
+}
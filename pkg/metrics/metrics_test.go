@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCounterVec(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounterVec("calls_total", "Calls.", "name")
+	c.Inc("a")
+	c.Add(2.5, "a")
+	c.Add(-1, "a") // ignored
+	c.Inc(`we"ird`)
+
+	if got := c.Value("a"); got != 3.5 {
+		t.Errorf("Value(a) = %v, want 3.5", got)
+	}
+
+	var b strings.Builder
+	reg.WriteText(&b)
+	want := `# HELP calls_total Calls.
+# TYPE calls_total counter
+calls_total{name="a"} 3.5
+calls_total{name="we\"ird"} 1
+`
+	if b.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	reg := NewRegistry()
+	h := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	var b strings.Builder
+	reg.WriteText(&b)
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 2.55
+latency_seconds_count 3
+`
+	if b.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.ObserveLLMCall("anthropic", "sonnet", 100, 20, nil)
+	m.ObserveLLMCall("anthropic", "sonnet", 0, 0, errors.New("boom"))
+	m.ObserveCost("anthropic", "sonnet", 0.01)
+	m.ObserveTool("git.status", 200*time.Millisecond, nil)
+	m.ObserveRun("scheduled", 3)
+	m.ObserveJob("daily", nil)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`teeny_llm_calls_total{provider="anthropic",model="sonnet",outcome="success"} 1`,
+		`teeny_llm_calls_total{provider="anthropic",model="sonnet",outcome="error"} 1`,
+		`teeny_llm_tokens_total{provider="anthropic",model="sonnet",type="prompt"} 100`,
+		`teeny_llm_cost_usd_total{provider="anthropic",model="sonnet"} 0.01`,
+		`teeny_tool_duration_seconds_bucket{tool="git.status",outcome="success",le="0.5"} 1`,
+		`teeny_loop_iterations_count{intent="scheduled"} 1`,
+		`teeny_scheduler_job_runs_total{job="daily",outcome="success"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.ObserveLLMCall("p", "m", 1, 1, nil)
+	m.ObserveTool("t", time.Second, nil)
+	m.ObserveRun("", 1)
+	m.ObserveJob("j", nil)
+	m.ObserveCost("p", "m", 1)
+}
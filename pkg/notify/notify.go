@@ -0,0 +1,183 @@
+// Package notify delivers run results to webhooks, email, and files.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Target is one delivery destination. Set exactly one field.
+type Target struct {
+	Webhook string `json:"webhook,omitempty"` // URL; the Result is POSTed as JSON
+	Email   string `json:"email,omitempty"`   // Recipient address; needs SMTP config
+	File    string `json:"file,omitempty"`    // Path the result is appended to
+}
+
+func (t Target) String() string {
+	switch {
+	case t.Webhook != "":
+		return "webhook " + t.Webhook
+	case t.Email != "":
+		return "email " + t.Email
+	case t.File != "":
+		return "file " + t.File
+	}
+	return "empty target"
+}
+
+// Result is what gets delivered.
+type Result struct {
+	Job     string    `json:"job,omitempty"`
+	Session string    `json:"session"`
+	Output  string    `json:"output"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Subject is a one-line summary used for email subjects and file headings.
+func (r Result) Subject() string {
+	name := r.Job
+	if name == "" {
+		name = r.Session
+	}
+	if r.Error != "" {
+		return fmt.Sprintf("[teeny] %s failed", name)
+	}
+	return fmt.Sprintf("[teeny] %s", name)
+}
+
+// SMTPConfig configures email delivery.
+type SMTPConfig struct {
+	Host     string
+	Port     int // Default 587
+	Username string
+	Password string
+	From     string
+}
+
+// sendMailFunc matches smtp.SendMail.
+type sendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// Notifier delivers results to targets.
+type Notifier struct {
+	smtp     SMTPConfig
+	client   *http.Client
+	sendMail sendMailFunc
+}
+
+// New creates a notifier. smtp may be zero if no email targets are used.
+func New(smtpCfg SMTPConfig) *Notifier {
+	if smtpCfg.Port == 0 {
+		smtpCfg.Port = 587
+	}
+	return &Notifier{
+		smtp:     smtpCfg,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		sendMail: smtp.SendMail,
+	}
+}
+
+// Deliver sends r to every target and joins any errors. A failing target
+// does not stop delivery to the rest.
+func (n *Notifier) Deliver(ctx context.Context, targets []Target, r Result) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	var errs []error
+	for _, t := range targets {
+		var err error
+		switch {
+		case t.Webhook != "":
+			err = n.webhook(ctx, t.Webhook, r)
+		case t.Email != "":
+			err = n.email(t.Email, r)
+		case t.File != "":
+			err = appendFile(t.File, r)
+		default:
+			err = errors.New("no destination set")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("notify: %s: %w", t, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) webhook(ctx context.Context, url string, r Result) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+func (n *Notifier) email(to string, r Result) error {
+	if n.smtp.Host == "" || n.smtp.From == "" {
+		return errors.New("smtp host and from address are not configured")
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.smtp.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", r.Subject())
+	fmt.Fprintf(&msg, "Date: %s\r\n", r.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(body(r))
+
+	var auth smtp.Auth
+	if n.smtp.Username != "" {
+		auth = smtp.PlainAuth("", n.smtp.Username, n.smtp.Password, n.smtp.Host)
+	}
+	addr := n.smtp.Host + ":" + strconv.Itoa(n.smtp.Port)
+	return n.sendMail(addr, auth, n.smtp.From, []string{to}, []byte(msg.String()))
+}
+
+// appendFile appends r to path as a Markdown section.
+func appendFile(path string, r Result) error {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "## %s — %s\n\n%s\n\n", r.Subject(), r.Time.Format(time.RFC3339), body(r))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func body(r Result) string {
+	if r.Error != "" {
+		return "Error: " + r.Error
+	}
+	return r.Output
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeliverWebhook(t *testing.T) {
+	var got Result
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	err := New(SMTPConfig{}).Deliver(context.Background(), []Target{{Webhook: srv.URL}}, Result{Job: "daily", Session: "s", Output: "all good"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Job != "daily" || got.Output != "all good" || got.Time.IsZero() {
+		t.Errorf("payload = %+v", got)
+	}
+}
+
+func TestDeliverEmail(t *testing.T) {
+	n := New(SMTPConfig{Host: "mail.example.com", Username: "bot", Password: "pw", From: "bot@example.com"})
+	var addr, msg string
+	var to []string
+	n.sendMail = func(a string, _ smtp.Auth, _ string, rcpt []string, m []byte) error {
+		addr, to, msg = a, rcpt, string(m)
+		return nil
+	}
+
+	err := n.Deliver(context.Background(), []Target{{Email: "me@example.com"}}, Result{Job: "daily", Error: "provider down"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "mail.example.com:587" || len(to) != 1 || to[0] != "me@example.com" {
+		t.Errorf("sendMail(%s, %v)", addr, to)
+	}
+	if !strings.Contains(msg, "Subject: [teeny] daily failed\r\n") || !strings.HasSuffix(msg, "Error: provider down") {
+		t.Errorf("message = %q", msg)
+	}
+
+	// Without SMTP config, email targets fail.
+	if err := New(SMTPConfig{}).Deliver(context.Background(), []Target{{Email: "me@example.com"}}, Result{}); err == nil {
+		t.Error("expected error without smtp config")
+	}
+}
+
+func TestDeliverFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "daily.md")
+	n := New(SMTPConfig{})
+	at := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, out := range []string{"first", "second"} {
+		if err := n.Deliver(context.Background(), []Target{{File: path}}, Result{Job: "daily", Output: out, Time: at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## [teeny] daily — 2025-03-01T09:00:00Z\n\nfirst\n\n## [teeny] daily — 2025-03-01T09:00:00Z\n\nsecond\n\n"
+	if string(data) != want {
+		t.Errorf("file = %q", data)
+	}
+}
+
+func TestDeliverContinuesAfterFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.md")
+	targets := []Target{{}, {Webhook: "http://127.0.0.1:0/"}, {File: path}}
+	err := New(SMTPConfig{}).Deliver(context.Background(), targets, Result{Session: "s", Output: "x"})
+	if err == nil || !strings.Contains(err.Error(), "empty target") || !strings.Contains(err.Error(), "webhook") {
+		t.Errorf("err = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file target skipped: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package pgstore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/scheduler"
+)
+
+// History is a scheduler.HistoryStore on Postgres.
+type History struct {
+	db *sql.DB
+}
+
+var _ scheduler.HistoryStore = (*History)(nil)
+
+// History returns the job history in d.
+func (d *DB) History() *History {
+	return &History{db: d.db}
+}
+
+func (h *History) Record(r scheduler.RunRecord) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	_, err := h.db.ExecContext(ctx, `
+INSERT INTO job_runs (job, session, attempt, start, duration_ms, result, error, input_tokens, output_tokens, cost_usd)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		r.Job, r.Session, r.Attempt, r.Start, r.DurationMs, r.Result, r.Error, r.InputTokens, r.OutputTokens, r.CostUSD)
+	if err != nil {
+		return fmt.Errorf("pgstore: record job run: %w", err)
+	}
+	return nil
+}
+
+func (h *History) List(job string, limit int) ([]scheduler.RunRecord, error) {
+	var max sql.NullInt64 // NULL = no limit
+	if limit > 0 {
+		max = sql.NullInt64{Int64: int64(limit), Valid: true}
+	}
+	ctx, cancel := queryContext()
+	defer cancel()
+	rows, err := h.db.QueryContext(ctx, `
+SELECT job, session, attempt, start, duration_ms, result, error, input_tokens, output_tokens, cost_usd
+FROM job_runs WHERE $1 = '' OR job = $1 ORDER BY id DESC LIMIT $2`, job, max)
+	if err != nil {
+		return nil, fmt.Errorf("pgstore: job history: %w", err)
+	}
+	defer rows.Close()
+	var runs []scheduler.RunRecord
+	for rows.Next() {
+		var r scheduler.RunRecord
+		if err := rows.Scan(&r.Job, &r.Session, &r.Attempt, &r.Start, &r.DurationMs, &r.Result, &r.Error,
+			&r.InputTokens, &r.OutputTokens, &r.CostUSD); err != nil {
+			return nil, fmt.Errorf("pgstore: job history: %w", err)
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
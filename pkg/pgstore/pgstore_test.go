@@ -0,0 +1,224 @@
+package pgstore
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/scheduler"
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
+)
+
+// testDB opens a fresh schema in the database named by
+// $TEENY_TEST_POSTGRES, e.g. postgres://postgres@localhost/postgres, and
+// drops it after the test. Without the variable the test is skipped.
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	dsn := os.Getenv("TEENY_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("TEENY_TEST_POSTGRES is not set")
+	}
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	b := make([]byte, 4)
+	rand.Read(b)
+	schema := "teeny_test_" + hex.EncodeToString(b)
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	d, err := Open(context.Background(), u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestMigrate(t *testing.T) {
+	d := testDB(t)
+	ctx := context.Background()
+	if err := d.Migrate(ctx); err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	if v, err := d.SchemaVersion(ctx); err != nil || v != len(migrations) {
+		t.Errorf("SchemaVersion = %d, %v; want %d", v, err, len(migrations))
+	}
+}
+
+func TestSessions(t *testing.T) {
+	d := testDB(t)
+	a := session.NewManagerWithStore(d.Sessions())
+	b := session.NewManagerWithStore(d.Sessions())
+
+	a.AddMessage("slack:C1", provider.Message{Role: "user", Content: "hi"})
+	if err := a.Save("slack:C1"); err != nil {
+		t.Fatal(err)
+	}
+	b.AddMessage("slack:C1", provider.Message{Role: "assistant", Content: "hello"})
+	if got := a.GetHistory("slack:C1"); len(got) != 2 {
+		t.Fatalf("history = %+v", got)
+	}
+
+	// Deleted and created again, the session still looks changed
+	if err := b.Delete("slack:C1"); err != nil {
+		t.Fatal(err)
+	}
+	b.AddMessage("slack:C1", provider.Message{Role: "user", Content: "fresh"})
+	if got := a.GetHistory("slack:C1"); len(got) != 1 || got[0].Content != "fresh" {
+		t.Errorf("history after re-creation = %+v", got)
+	}
+
+	res, err := a.Prune([]session.Retention{{ArchiveAfter: time.Hour}}, time.Now().Add(2*time.Hour))
+	if err != nil || len(res.Archived) != 1 {
+		t.Fatalf("Prune = %+v, %v", res, err)
+	}
+	if a.MessageCount("slack:C1") != 0 {
+		t.Error("archived session still live")
+	}
+	if err := b.Restore("slack:C1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.GetHistory("slack:C1"); len(got) != 1 {
+		t.Errorf("restored history = %+v", got)
+	}
+}
+
+func TestSessionLock(t *testing.T) {
+	d := testDB(t)
+	s := d.Sessions()
+	other := d.Sessions()
+	other.LockTimeout = 100 * time.Millisecond
+
+	unlock, err := s.Lock("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Lock("k"); err == nil {
+		t.Fatal("took a held lock")
+	}
+	held, err := other.Lock("other")
+	if err != nil {
+		t.Fatalf("lock on another session: %v", err)
+	}
+	held()
+	unlock()
+	unlock, err = other.Lock("k")
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	unlock()
+}
+
+// The tests below check the SQL the session store sends against sqlmock,
+// so they run without a database.
+
+func mockSessions(t *testing.T) (*SessionStore, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return &SessionStore{db: db, LockTimeout: 2 * time.Second}, mock
+}
+
+func TestSessionLockPerName(t *testing.T) {
+	s, mock := mockSessions(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT set_config\('lock_timeout', \$1, true\)`).WithArgs("2000").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(hashtext\(\$1\)\)`).WithArgs("slack:C1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	unlock, err := s.Lock("slack:C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
+
+func TestSessionLockTimeout(t *testing.T) {
+	s, mock := mockSessions(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`set_config`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`pg_advisory_xact_lock`).WillReturnError(errors.New("canceling statement due to lock timeout"))
+	mock.ExpectRollback()
+
+	if _, err := s.Lock("k"); err == nil || !strings.Contains(err.Error(), "lock timeout") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestSessionSaveSQL(t *testing.T) {
+	s, mock := mockSessions(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO sessions \(name, snapshot\)`).WithArgs("k", []byte("{}")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM session_journal WHERE name = \$1`).WithArgs("k").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	if err := s.Save("k", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := testDB(t).History()
+	start := time.Now().Truncate(time.Millisecond)
+	for _, job := range []string{"a", "b", "a"} {
+		if err := h.Record(scheduler.RunRecord{Job: job, Start: start, Result: "ok", CostUSD: 0.5}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runs, err := h.List("", 0); err != nil || len(runs) != 3 {
+		t.Fatalf("List all = %+v, %v", runs, err)
+	}
+	runs, err := h.List("a", 1)
+	if err != nil || len(runs) != 1 || runs[0].Job != "a" || runs[0].CostUSD != 0.5 || !runs[0].Start.Equal(start) {
+		t.Errorf("List a = %+v, %v", runs, err)
+	}
+}
+
+func TestTranscripts(t *testing.T) {
+	ts := testDB(t).Transcripts()
+	r := transcript.NewStore(ts).Start("s1", "cli", provider.Message{Role: "user", Content: "hi"})
+	r.Tool(1, provider.ToolCall{ID: "1", Name: "shell.run"}, "ok", 0, time.Millisecond, nil)
+	r.End("done", nil)
+
+	entries, err := ts.Entries(context.Background(), r.ID())
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("Entries = %+v, %v", entries, err)
+	}
+	if s := transcript.Summarize(entries); s.Session != "s1" || s.Result != "done" || s.ToolCalls["shell.run"] != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+	if entries, _ := ts.Entries(context.Background(), "missing"); len(entries) != 0 {
+		t.Errorf("missing run = %+v", entries)
+	}
+}
@@ -0,0 +1,259 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+)
+
+// DefaultLockTimeout is how long SessionStore.Lock waits for another
+// process by default.
+const DefaultLockTimeout = 10 * time.Second
+
+// SessionStore is a session.Store, with an archive, on Postgres. Sessions
+// are stored under their keys, unchanged. Each session has its own
+// advisory lock, released by the server if the process holding it dies.
+type SessionStore struct {
+	db          *sql.DB
+	owner       *DB           // Closed by Close (nil = the caller closes it)
+	LockTimeout time.Duration // How long Lock waits (default DefaultLockTimeout)
+}
+
+var _ session.ArchiveStore = (*SessionStore)(nil)
+
+// Sessions returns a session store on d.
+func (d *DB) Sessions() *SessionStore {
+	return &SessionStore{db: d.db}
+}
+
+// OpenSessions opens the database at url for a session store alone, which
+// closes it on Close.
+func OpenSessions(ctx context.Context, url string) (*SessionStore, error) {
+	d, err := Open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	s := d.Sessions()
+	s.owner = d
+	return s, nil
+}
+
+// Close closes the database if OpenSessions opened it.
+func (s *SessionStore) Close() error {
+	if s.owner == nil {
+		return nil
+	}
+	return s.owner.Close()
+}
+
+func (s *SessionStore) Name(key string) string { return key }
+
+func (s *SessionStore) Names() ([]string, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM sessions`)
+	if err != nil {
+		return nil, fmt.Errorf("pgstore: list sessions: %w", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("pgstore: list sessions: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Lock takes the advisory lock on hashtext(name) in a transaction, which
+// holds it until unlock ends the transaction. Sessions whose names hash
+// alike share a lock, which only costs some waiting. Lock gives up after
+// LockTimeout.
+func (s *SessionStore) Lock(name string) (func(), error) {
+	timeout := s.LockTimeout
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+	// Not queryContext: cancelling the transaction's context would end it,
+	// releasing the lock while it is still held. lock_timeout bounds the
+	// wait instead.
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("pgstore: lock %s: %w", name, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+QueryTimeout)
+	defer cancel()
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('lock_timeout', $1, true)`, strconv.FormatInt(timeout.Milliseconds(), 10)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("pgstore: lock %s: %w", name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, name); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("pgstore: lock %s: %w", name, err)
+	}
+	return func() { tx.Rollback() }, nil
+}
+
+// Version is drawn from a sequence on every write, so it never repeats,
+// even for a session deleted and created again.
+func (s *SessionStore) Version(name string) (string, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	var v int64
+	err := s.db.QueryRowContext(ctx, `SELECT version FROM sessions WHERE name = $1`, name).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("pgstore: session %s: %w", name, err)
+	}
+	return strconv.FormatInt(v, 10), nil
+}
+
+func (s *SessionStore) Snapshot(name string) ([]byte, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `SELECT snapshot FROM sessions WHERE name = $1`, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pgstore: session %s: %w", name, err)
+	}
+	return data, nil
+}
+
+func (s *SessionStore) Journal(name string) ([][]byte, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT entry FROM session_journal WHERE name = $1 ORDER BY id`, name)
+	if err != nil {
+		return nil, fmt.Errorf("pgstore: session %s: %w", name, err)
+	}
+	defer rows.Close()
+	var entries [][]byte
+	for rows.Next() {
+		var e []byte
+		if err := rows.Scan(&e); err != nil {
+			return nil, fmt.Errorf("pgstore: session %s: %w", name, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SessionStore) Append(name string, entry []byte) error {
+	return s.tx(name, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO session_journal (name, entry) VALUES ($1, $2)`, name, entry); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO sessions (name) VALUES ($1)
+ON CONFLICT (name) DO UPDATE SET version = nextval('session_versions'), updated_at = now()`, name)
+		return err
+	})
+}
+
+func (s *SessionStore) Save(name string, snapshot []byte) error {
+	return s.tx(name, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO sessions (name, snapshot) VALUES ($1, $2)
+ON CONFLICT (name) DO UPDATE SET snapshot = EXCLUDED.snapshot, version = nextval('session_versions'), updated_at = now()`,
+			name, snapshot); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM session_journal WHERE name = $1`, name)
+		return err
+	})
+}
+
+func (s *SessionStore) Delete(name string) error {
+	return s.tx(name, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE name = $1`, name); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM session_journal WHERE name = $1`, name)
+		return err
+	})
+}
+
+// tx runs fn in a transaction.
+func (s *SessionStore) tx(name string, fn func(context.Context, *sql.Tx) error) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("pgstore: session %s: %w", name, err)
+	}
+	defer tx.Rollback()
+	if err := fn(ctx, tx); err != nil {
+		return fmt.Errorf("pgstore: session %s: %w", name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("pgstore: session %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *SessionStore) Archive(name string, data []byte, updated time.Time) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	// Archive names are unique, so a clash is an error rather than an
+	// archive to overwrite
+	_, err := s.db.ExecContext(ctx, `INSERT INTO session_archive (name, data, updated_at) VALUES ($1, $2, $3)`, name, data, updated)
+	if err != nil {
+		return fmt.Errorf("pgstore: archive %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *SessionStore) Archived(name string) ([]byte, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM session_archive WHERE name = $1`, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pgstore: archive %s: %w", name, err)
+	}
+	return data, nil
+}
+
+func (s *SessionStore) Archives() (map[string]time.Time, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT name, updated_at FROM session_archive`)
+	if err != nil {
+		return nil, fmt.Errorf("pgstore: list archives: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		var updated time.Time
+		if err := rows.Scan(&name, &updated); err != nil {
+			return nil, fmt.Errorf("pgstore: list archives: %w", err)
+		}
+		out[name] = updated
+	}
+	return out, rows.Err()
+}
+
+func (s *SessionStore) DeleteArchive(name string) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM session_archive WHERE name = $1`, name); err != nil {
+		return fmt.Errorf("pgstore: archive %s: %w", name, err)
+	}
+	return nil
+}
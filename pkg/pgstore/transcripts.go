@@ -0,0 +1,68 @@
+package pgstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/transcript"
+)
+
+// Transcripts is a transcript.Store on Postgres. Each entry is a row of
+// transcript_entries, its common fields in columns for querying and the
+// whole entry as JSON.
+type Transcripts struct {
+	db *sql.DB
+}
+
+var _ transcript.Store = (*Transcripts)(nil)
+
+// Transcripts returns the transcripts in d.
+func (d *DB) Transcripts() *Transcripts {
+	return &Transcripts{db: d.db}
+}
+
+func (t *Transcripts) Append(e transcript.Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tool := ""
+	if e.ToolCall != nil {
+		tool = e.ToolCall.Name
+	}
+	ctx, cancel := queryContext()
+	defer cancel()
+	_, err = t.db.ExecContext(ctx, `
+INSERT INTO transcript_entries (run, seq, time, type, session, model, tool, cost_usd, duration_ms, error, entry)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		e.Run, e.Seq, e.Time, e.Type, e.Session, e.Model, tool, e.Cost, e.DurationMs, e.Error, string(data))
+	if err != nil {
+		return fmt.Errorf("pgstore: record transcript: %w", err)
+	}
+	return nil
+}
+
+// Entries returns the entries of a run, in order, or none if there is no
+// such run.
+func (t *Transcripts) Entries(ctx context.Context, run string) ([]transcript.Entry, error) {
+	rows, err := t.db.QueryContext(ctx, `SELECT entry FROM transcript_entries WHERE run = $1 ORDER BY seq`, run)
+	if err != nil {
+		return nil, fmt.Errorf("pgstore: transcript %s: %w", run, err)
+	}
+	defer rows.Close()
+	var entries []transcript.Entry
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("pgstore: transcript %s: %w", run, err)
+		}
+		var e transcript.Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("pgstore: transcript %s: %w", run, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
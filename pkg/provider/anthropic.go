@@ -14,21 +14,44 @@ const anthropicAPIURL = "https://api.anthropic.com/v1/messages"
 
 // Anthropic implements Provider for Claude models.
 type Anthropic struct {
-	apiKey string
-	model  string
+	apiKey   string
+	model    string
+	thinking int // Extended thinking budget in tokens (0 = off)
+	http     httpClient
+}
+
+// AnthropicOption configures an Anthropic provider. Both the Anthropic
+// options and ClientOptions are AnthropicOptions.
+type AnthropicOption interface {
+	applyAnthropic(*Anthropic)
+}
+
+type anthropicOption func(*Anthropic)
+
+func (f anthropicOption) applyAnthropic(a *Anthropic) { f(a) }
+
+// WithThinking enables extended thinking with a budget of budgetTokens
+// (at least 1024). Requests that force a tool, including structured
+// output, are sent without it, since the API doesn't allow both.
+func WithThinking(budgetTokens int) AnthropicOption {
+	return anthropicOption(func(a *Anthropic) { a.thinking = budgetTokens })
 }
 
 // NewAnthropic creates an Anthropic provider.
 // apiKey defaults to ANTHROPIC_API_KEY env var if empty.
 // model defaults to claude-sonnet-4-20250514 if empty.
-func NewAnthropic(apiKey, model string) *Anthropic {
+func NewAnthropic(apiKey, model string, opts ...AnthropicOption) *Anthropic {
 	if apiKey == "" {
 		apiKey = os.Getenv("ANTHROPIC_API_KEY")
 	}
 	if model == "" {
 		model = "claude-sonnet-4-20250514"
 	}
-	return &Anthropic{apiKey: apiKey, model: model}
+	a := &Anthropic{apiKey: apiKey, model: model}
+	for _, opt := range opts {
+		opt.applyAnthropic(a)
+	}
+	return a
 }
 
 func (a *Anthropic) Name() string { return "anthropic" }
@@ -36,11 +59,26 @@ func (a *Anthropic) Name() string { return "anthropic" }
 // Anthropic API types
 
 type anthropicRequest struct {
-	Model     string             `json:"model"`
-	MaxTokens int                `json:"max_tokens"`
-	System    string             `json:"system,omitempty"`
-	Messages  []anthropicMessage `json:"messages"`
-	Tools     []anthropicTool    `json:"tools,omitempty"`
+	Model         string               `json:"model"`
+	MaxTokens     int                  `json:"max_tokens"`
+	System        string               `json:"system,omitempty"`
+	Messages      []anthropicMessage   `json:"messages"`
+	Tools         []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Thinking      *anthropicThinking   `json:"thinking,omitempty"`
+}
+
+type anthropicThinking struct {
+	Type         string `json:"type"` // "enabled"
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 type anthropicMessage struct {
@@ -49,13 +87,26 @@ type anthropicMessage struct {
 }
 
 type contentBlock struct {
-	Type      string `json:"type"`
-	Text      string `json:"text,omitempty"`
-	ID        string `json:"id,omitempty"`
-	Name      string `json:"name,omitempty"`
-	Input     any    `json:"input,omitempty"`
-	ToolUseID string `json:"tool_use_id,omitempty"`
-	Content   string `json:"content,omitempty"`
+	Type      string       `json:"type"`
+	Text      string       `json:"text,omitempty"`
+	ID        string       `json:"id,omitempty"`
+	Name      string       `json:"name,omitempty"`
+	Input     any          `json:"input,omitempty"`
+	ToolUseID string       `json:"tool_use_id,omitempty"`
+	Content   string       `json:"content,omitempty"`
+	Source    *blockSource `json:"source,omitempty"`
+	Title     string       `json:"title,omitempty"`
+	Thinking  string       `json:"thinking,omitempty"`
+	Signature string       `json:"signature,omitempty"`
+	Data      string       `json:"data,omitempty"` // Redacted thinking
+}
+
+// blockSource is the content of an image or document block.
+type blockSource struct {
+	Type      string `json:"type"` // "base64", "url", or "text"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
 }
 
 type anthropicTool struct {
@@ -78,11 +129,61 @@ type anthropicResponse struct {
 	Type string `json:"type"`
 }
 
+// structuredOutputTool is the tool Anthropic is forced to call when a
+// structured response format is requested. Its input is the answer.
+const structuredOutputTool = "structured_output"
+
 func (a *Anthropic) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
 	if a.apiKey == "" {
 		return nil, fmt.Errorf("anthropic: ANTHROPIC_API_KEY not set")
 	}
 
+	apiReq := a.buildRequest(req)
+
+	body, err := json.Marshal(apiReq)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic: marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", anthropicAPIURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("anthropic: create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", a.apiKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := a.http.do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic: read response: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, newHTTPError("anthropic", resp, respBody)
+	}
+
+	var apiResp anthropicResponse
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return nil, fmt.Errorf("anthropic: unmarshal response: %w", err)
+	}
+
+	if apiResp.Type == "error" && apiResp.Error != nil {
+		return nil, fmt.Errorf("anthropic: API error: %s: %s", apiResp.Error.Type, apiResp.Error.Message)
+	}
+
+	result := parseAnthropicResponse(&apiResp)
+	result.Model = apiReq.Model
+	return result, nil
+}
+
+// buildRequest converts a ChatRequest into the Anthropic wire format.
+func (a *Anthropic) buildRequest(req ChatRequest) anthropicRequest {
 	model := req.Model
 	if model == "" {
 		model = a.model
@@ -101,17 +202,53 @@ func (a *Anthropic) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, e
 		case "system":
 			system = m.Content
 		case "user":
-			msgs = append(msgs, anthropicMessage{Role: "user", Content: m.Content})
+			if len(m.Images) == 0 && len(m.Documents) == 0 {
+				msgs = append(msgs, anthropicMessage{Role: "user", Content: m.Content})
+				continue
+			}
+			// Attachments go before the text, as Anthropic recommends
+			var blocks []contentBlock
+			for _, img := range m.Images {
+				src := &blockSource{Type: "base64", MediaType: img.MediaType, Data: img.Data}
+				if img.URL != "" {
+					src = &blockSource{Type: "url", URL: img.URL}
+				}
+				blocks = append(blocks, contentBlock{Type: "image", Source: src})
+			}
+			for _, doc := range m.Documents {
+				src := &blockSource{Type: "text", MediaType: MediaTypeText, Data: doc.Text}
+				if doc.MediaType == MediaTypePDF && doc.Data != "" {
+					src = &blockSource{Type: "base64", MediaType: MediaTypePDF, Data: doc.Data}
+				}
+				blocks = append(blocks, contentBlock{Type: "document", Source: src, Title: doc.Name})
+			}
+			if m.Content != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: m.Content})
+			}
+			msgs = append(msgs, anthropicMessage{Role: "user", Content: blocks})
 		case "assistant":
-			if len(m.ToolCalls) > 0 {
-				// Assistant message with tool calls → content blocks
+			if len(m.ToolCalls) > 0 || len(m.Thinking) > 0 {
+				// Assistant message with tool calls or thinking → content
+				// blocks, thinking first as the API returned it
 				var blocks []contentBlock
+				for _, th := range m.Thinking {
+					if th.Redacted != "" {
+						blocks = append(blocks, contentBlock{Type: "redacted_thinking", Data: th.Redacted})
+					} else {
+						blocks = append(blocks, contentBlock{Type: "thinking", Thinking: th.Text, Signature: th.Signature})
+					}
+				}
 				if m.Content != "" {
 					blocks = append(blocks, contentBlock{Type: "text", Text: m.Content})
 				}
 				for _, tc := range m.ToolCalls {
-					var input any
-					_ = json.Unmarshal([]byte(tc.Arguments), &input)
+					// Malformed arguments are sent as an empty object: the
+					// API rejects a tool_use without one, and the tool
+					// result already tells the model what was wrong
+					var input map[string]any
+					if json.Unmarshal([]byte(tc.Arguments), &input) != nil || input == nil {
+						input = map[string]any{}
+					}
 					blocks = append(blocks, contentBlock{
 						Type:  "tool_use",
 						ID:    tc.ID,
@@ -147,64 +284,96 @@ func (a *Anthropic) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, e
 	}
 
 	apiReq := anthropicRequest{
-		Model:     model,
-		MaxTokens: maxTokens,
-		System:    system,
-		Messages:  msgs,
-		Tools:     tools,
+		Model:         model,
+		MaxTokens:     maxTokens,
+		System:        system,
+		Messages:      msgs,
+		Tools:         tools,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.StopSequences,
 	}
 
-	body, err := json.Marshal(apiReq)
-	if err != nil {
-		return nil, fmt.Errorf("anthropic: marshal request: %w", err)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", anthropicAPIURL, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("anthropic: create request: %w", err)
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", a.apiKey)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := http.DefaultClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("anthropic: request failed: %w", err)
+	if len(apiReq.Tools) > 0 {
+		apiReq.ToolChoice = anthropicChoice(req.ToolChoice)
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("anthropic: read response: %w", err)
+	structured := req.ResponseFormat == FormatJSON || req.ResponseFormat == FormatJSONSchema
+	if a.thinking > 0 && !structured && (apiReq.ToolChoice == nil || apiReq.ToolChoice.Type == "auto" || apiReq.ToolChoice.Type == "none") {
+		// The budget counts toward max_tokens, and thinking only runs at
+		// the default temperature
+		apiReq.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: a.thinking}
+		if apiReq.MaxTokens <= a.thinking {
+			apiReq.MaxTokens = a.thinking + maxTokens
+		}
+		apiReq.Temperature = nil
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("anthropic: HTTP %d: %s", resp.StatusCode, string(respBody))
+	// Structured output: the answer is a call to a tool whose schema is
+	// the answer's. With no other tools to call it is forced; otherwise
+	// any tool call is, so the model can use real tools first and still
+	// never answer in free text.
+	if structured {
+		schema := req.ResponseSchema
+		if schema == nil {
+			schema = map[string]any{"type": "object"}
+		}
+		apiReq.Tools = append(apiReq.Tools, anthropicTool{
+			Name:        structuredOutputTool,
+			Description: "Respond with the final answer as structured JSON.",
+			InputSchema: schema,
+		})
+		switch {
+		case len(req.Tools) == 0 || req.ToolChoice == ToolChoiceNone:
+			apiReq.ToolChoice = &anthropicToolChoice{Type: "tool", Name: structuredOutputTool}
+		case apiReq.ToolChoice == nil:
+			apiReq.ToolChoice = &anthropicToolChoice{Type: "any"}
+		}
 	}
 
-	var apiResp anthropicResponse
-	if err := json.Unmarshal(respBody, &apiResp); err != nil {
-		return nil, fmt.Errorf("anthropic: unmarshal response: %w", err)
-	}
+	return apiReq
+}
 
-	if apiResp.Type == "error" && apiResp.Error != nil {
-		return nil, fmt.Errorf("anthropic: API error: %s: %s", apiResp.Error.Type, apiResp.Error.Message)
+// anthropicChoice maps ChatRequest.ToolChoice to Anthropic's tool_choice.
+func anthropicChoice(choice string) *anthropicToolChoice {
+	switch choice {
+	case ToolChoiceAuto:
+		return nil
+	case ToolChoiceRequired:
+		return &anthropicToolChoice{Type: "any"}
+	case ToolChoiceNone:
+		return &anthropicToolChoice{Type: "none"}
+	default:
+		return &anthropicToolChoice{Type: "tool", Name: choice}
 	}
+}
 
-	// Parse response content blocks
+// parseAnthropicResponse converts Anthropic content blocks into a ChatResponse.
+func parseAnthropicResponse(apiResp *anthropicResponse) *ChatResponse {
 	result := &ChatResponse{
 		Usage: Usage{
 			PromptTokens:     apiResp.Usage.InputTokens,
 			CompletionTokens: apiResp.Usage.OutputTokens,
 		},
+		StopReason: apiResp.StopReason,
+	}
+	if result.StopReason == "end_turn" {
+		result.StopReason = StopEnd
 	}
 
 	for _, block := range apiResp.Content {
 		switch block.Type {
 		case "text":
 			result.Content += block.Text
+		case "thinking":
+			result.Thinking = append(result.Thinking, Thinking{Text: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			result.Thinking = append(result.Thinking, Thinking{Redacted: block.Data})
 		case "tool_use":
 			args, _ := json.Marshal(block.Input)
+			if block.Name == structuredOutputTool {
+				result.Content = string(args)
+				continue
+			}
 			result.ToolCalls = append(result.ToolCalls, ToolCall{
 				ID:        block.ID,
 				Name:      block.Name,
@@ -213,5 +382,5 @@ func (a *Anthropic) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, e
 		}
 	}
 
-	return result, nil
+	return result
 }
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// MaxImageBytes is the largest image file LoadImage accepts, matching the
+// smallest per-image limit of the supported APIs.
+const MaxImageBytes = 5 << 20
+
+// imageTypes are the media types both Anthropic and OpenAI accept.
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Image is a picture attached to a user message, either by URL or inline
+// as base64 data.
+type Image struct {
+	URL       string `json:"url,omitempty"`
+	MediaType string `json:"media_type,omitempty"` // e.g. "image/png"; required with Data
+	Data      string `json:"data,omitempty"`       // Base64-encoded image bytes
+}
+
+// Media types for Document.MediaType.
+const (
+	MediaTypePDF  = "application/pdf"
+	MediaTypeText = "text/plain"
+)
+
+// Document is a file attached to a user message. A PDF carries its bytes in
+// Data and, when it could be extracted, its text in Text; a text file
+// carries only Text. Providers that read PDFs natively use Data, the rest
+// use Text.
+type Document struct {
+	Name      string `json:"name"`
+	MediaType string `json:"media_type"` // MediaTypePDF or MediaTypeText
+	Data      string `json:"data,omitempty"`
+	Text      string `json:"text,omitempty"`
+}
+
+// dataURL returns the image as a URL, inlining data as a data: URL.
+func (img Image) dataURL() string {
+	if img.URL != "" {
+		return img.URL
+	}
+	return "data:" + img.MediaType + ";base64," + img.Data
+}
+
+// LoadImage attaches an image from an http(s) URL or a local file. Files
+// are read and inlined; their type is detected from the content.
+func LoadImage(src string) (Image, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		return Image{URL: src}, nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return Image{}, fmt.Errorf("image: %w", err)
+	}
+	if info.Size() > MaxImageBytes {
+		return Image{}, fmt.Errorf("image: %s is %d bytes, over the %d byte limit", src, info.Size(), MaxImageBytes)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return Image{}, fmt.Errorf("image: %w", err)
+	}
+	mediaType := http.DetectContentType(data)
+	if !imageTypes[mediaType] {
+		return Image{}, fmt.Errorf("image: %s is %s, not PNG, JPEG, GIF, or WebP", src, mediaType)
+	}
+	return Image{MediaType: mediaType, Data: base64.StdEncoding.EncodeToString(data)}, nil
+}
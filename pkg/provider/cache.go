@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// CacheConfig controls Cache.
+type CacheConfig struct {
+	Size int           // Responses kept; the oldest is evicted first
+	TTL  time.Duration // How long a response stays fresh (0 = until evicted)
+}
+
+// Cache answers a request identical to an earlier one from memory. Hits
+// report zero usage, since nothing was spent on them. Errors are not
+// cached.
+func Cache(cfg CacheConfig) Middleware {
+	return func(p Provider) Provider {
+		c := &responseCache{cfg: cfg, entries: make(map[[32]byte]cacheEntry)}
+		return &wrapped{next: p, chat: func(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+			key, ok := cacheKey(req)
+			if !ok {
+				return p.Chat(ctx, req)
+			}
+			if resp, ok := c.get(key); ok {
+				return resp, nil
+			}
+			resp, err := p.Chat(ctx, req)
+			if err == nil {
+				c.put(key, resp)
+			}
+			return resp, err
+		}}
+	}
+}
+
+type cacheEntry struct {
+	resp  *ChatResponse
+	added time.Time
+}
+
+type responseCache struct {
+	cfg     CacheConfig
+	mu      sync.Mutex
+	entries map[[32]byte]cacheEntry
+	order   [][32]byte // Insertion order, oldest first
+}
+
+func cacheKey(req ChatRequest) ([32]byte, bool) {
+	// Metadata never reaches the model, so it doesn't change the answer
+	msgs := make([]Message, len(req.Messages))
+	for i, m := range req.Messages {
+		m.Meta = nil
+		msgs[i] = m
+	}
+	req.Messages = msgs
+	data, err := json.Marshal(req)
+	if err != nil {
+		return [32]byte{}, false
+	}
+	return sha256.Sum256(data), true
+}
+
+func (c *responseCache) get(key [32]byte) (*ChatResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || (c.cfg.TTL > 0 && time.Since(e.added) > c.cfg.TTL) {
+		return nil, false
+	}
+	hit := *e.resp
+	hit.Usage = Usage{}
+	return &hit, true
+}
+
+func (c *responseCache) put(key [32]byte, resp *ChatResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = cacheEntry{resp: resp, added: time.Now()}
+	for len(c.order) > max(c.cfg.Size, 1) {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// httpClient sends a provider's API requests.
+type httpClient struct {
+	client  *http.Client // nil = http.DefaultClient
+	headers http.Header  // Added to every request, replacing the provider's own
+}
+
+func (h *httpClient) do(req *http.Request) (*http.Response, error) {
+	for k, v := range h.headers {
+		req.Header[k] = v
+	}
+	c := h.client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return c.Do(req)
+}
+
+// ClientOption configures how any provider talks HTTP. It can be passed to
+// both NewAnthropic and NewOpenAI.
+type ClientOption func(*httpClient)
+
+func (f ClientOption) applyAnthropic(a *Anthropic) { f(&a.http) }
+func (f ClientOption) applyOpenAI(o *OpenAI)       { f(&o.http) }
+
+// WithHTTPClient sends requests with c instead of http.DefaultClient, e.g.
+// to go through a proxy or trust a corporate CA.
+func WithHTTPClient(c *http.Client) ClientOption {
+	return func(h *httpClient) { h.client = c }
+}
+
+// WithHeaders adds headers to every request, e.g. HTTP-Referer and X-Title
+// for OpenRouter or OpenAI-Organization. They replace any header of the
+// same name the provider sets. Calling it again adds to earlier headers.
+func WithHeaders(headers map[string]string) ClientOption {
+	return func(h *httpClient) {
+		if h.headers == nil {
+			h.headers = http.Header{}
+		}
+		for k, v := range headers {
+			h.headers.Set(k, v)
+		}
+	}
+}
+
+// HTTPConfig describes an HTTP client for NewHTTPClient.
+type HTTPConfig struct {
+	Proxy   string        // Proxy URL (default: HTTPS_PROXY and friends from the environment)
+	Timeout time.Duration // Whole-request timeout (0 = none; the caller's context still applies)
+	CAFile  string        // PEM bundle trusted in addition to the system roots
+}
+
+// NewHTTPClient builds a client from cfg. Connections are pooled as in
+// http.DefaultTransport.
+func NewHTTPClient(cfg HTTPConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("provider: proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("provider: ca file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("provider: ca file %s has no PEM certificates", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Transport: transport, Timeout: cfg.Timeout}, nil
+}
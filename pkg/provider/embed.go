@@ -0,0 +1,181 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Embedder turns text into vectors for semantic search.
+type Embedder interface {
+	// Embed returns one vector per input text, in order.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model identifies the embedding model. Vectors from different models
+	// are not comparable.
+	Model() string
+}
+
+// Cosine returns the cosine similarity of a and b, or 0 if their lengths
+// differ or either is zero.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// EmbedConfig selects an embedding backend.
+type EmbedConfig struct {
+	Name    string // "openai" or "ollama"
+	APIKey  string
+	Model   string
+	BaseURL string // Embeddings endpoint (OpenAI) or server URL (Ollama)
+}
+
+// NewEmbedder creates an Embedder by name.
+func NewEmbedder(cfg EmbedConfig) (Embedder, error) {
+	switch cfg.Name {
+	case "openai":
+		return NewOpenAIEmbedder(cfg.APIKey, cfg.Model, cfg.BaseURL), nil
+	case "ollama":
+		return NewOllamaEmbedder(cfg.Model, cfg.BaseURL), nil
+	default:
+		return nil, fmt.Errorf("unknown embedder: %q (supported: openai, ollama)", cfg.Name)
+	}
+}
+
+const openaiEmbedURL = "https://api.openai.com/v1/embeddings"
+
+// OpenAIEmbedder calls the OpenAI embeddings API or a compatible endpoint.
+type OpenAIEmbedder struct {
+	apiKey string
+	model  string
+	url    string
+}
+
+// NewOpenAIEmbedder creates an OpenAI embedder. apiKey defaults to
+// OPENAI_API_KEY, model to text-embedding-3-small, and url to the OpenAI
+// embeddings endpoint.
+func NewOpenAIEmbedder(apiKey, model, url string) *OpenAIEmbedder {
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if model == "" {
+		model = "text-embedding-3-small"
+	}
+	if url == "" {
+		url = openaiEmbedURL
+	}
+	return &OpenAIEmbedder{apiKey: apiKey, model: model, url: url}
+}
+
+func (o *OpenAIEmbedder) Model() string { return "openai:" + o.model }
+
+func (o *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if o.apiKey == "" {
+		return nil, fmt.Errorf("openai: API key not set (OPENAI_API_KEY)")
+	}
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	err := postJSON(ctx, o.url, map[string]string{"Authorization": "Bearer " + o.apiKey},
+		map[string]any{"model": o.model, "input": texts}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("openai: embed: %w", err)
+	}
+	out := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index >= 0 && d.Index < len(out) {
+			out[d.Index] = d.Embedding
+		}
+	}
+	for i, v := range out {
+		if v == nil {
+			return nil, fmt.Errorf("openai: embed: no vector for input %d", i)
+		}
+	}
+	return out, nil
+}
+
+const ollamaDefaultURL = "http://localhost:11434"
+
+// OllamaEmbedder calls a local Ollama server's /api/embed endpoint.
+type OllamaEmbedder struct {
+	model   string
+	baseURL string
+}
+
+// NewOllamaEmbedder creates an Ollama embedder. model defaults to
+// nomic-embed-text and baseURL to http://localhost:11434.
+func NewOllamaEmbedder(model, baseURL string) *OllamaEmbedder {
+	if model == "" {
+		model = "nomic-embed-text"
+	}
+	if baseURL == "" {
+		baseURL = ollamaDefaultURL
+	}
+	return &OllamaEmbedder{model: model, baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (o *OllamaEmbedder) Model() string { return "ollama:" + o.model }
+
+func (o *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	err := postJSON(ctx, o.baseURL+"/api/embed", nil, map[string]any{"model": o.model, "input": texts}, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: embed: %w", err)
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama: embed: got %d vectors for %d inputs", len(resp.Embeddings), len(texts))
+	}
+	return resp.Embeddings, nil
+}
+
+// postJSON POSTs body as JSON and decodes a 200 response into out.
+func postJSON(ctx context.Context, url string, headers map[string]string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+	return json.Unmarshal(respBody, out)
+}
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("bad auth header: %q", r.Header.Get("Authorization"))
+		}
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "text-embedding-3-small" || len(req.Input) != 2 {
+			t.Errorf("request = %+v", req)
+		}
+		// Out of order on purpose; index decides placement.
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer server.Close()
+
+	e := NewOpenAIEmbedder("test-key", "", server.URL)
+	vecs, err := e.Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	if len(vecs) != 2 || vecs[0][0] != 1 || vecs[1][1] != 1 {
+		t.Errorf("vectors = %v", vecs)
+	}
+	if e.Model() != "openai:text-embedding-3-small" {
+		t.Errorf("Model() = %q", e.Model())
+	}
+}
+
+func TestOllamaEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embed" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"embeddings":[[0.5,0.5]]}`))
+	}))
+	defer server.Close()
+
+	e := NewOllamaEmbedder("", server.URL+"/")
+	vecs, err := e.Embed(context.Background(), []string{"a"})
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	if len(vecs) != 1 || vecs[0][0] != 0.5 {
+		t.Errorf("vectors = %v", vecs)
+	}
+	if _, err := e.Embed(context.Background(), []string{"a", "b"}); err == nil {
+		t.Error("expected error when vector count does not match inputs")
+	}
+}
+
+func TestEmbedderErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad model", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if _, err := NewOpenAIEmbedder("k", "", server.URL).Embed(context.Background(), []string{"a"}); err == nil {
+		t.Error("expected HTTP error")
+	}
+	if _, err := NewEmbedder(EmbedConfig{Name: "nope"}); err == nil {
+		t.Error("expected unknown embedder error")
+	}
+	e, err := NewEmbedder(EmbedConfig{Name: "ollama", Model: "mxbai-embed-large"})
+	if err != nil || e.Model() != "ollama:mxbai-embed-large" {
+		t.Errorf("NewEmbedder = %v, %v", e, err)
+	}
+}
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 0}, []float32{1, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 1}, 0},
+		{[]float32{1, 0}, []float32{-1, 0}, -1},
+		{[]float32{1, 0}, []float32{1, 0, 0}, 0},
+		{[]float32{0, 0}, []float32{1, 0}, 0},
+	}
+	for _, tt := range tests {
+		if got := Cosine(tt.a, tt.b); got != tt.want {
+			t.Errorf("Cosine(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -1,34 +1,98 @@
 package provider
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpenRouterURL is the chat completions endpoint of OpenRouter.
+const OpenRouterURL = "https://openrouter.ai/api/v1/chat/completions"
 
 // Config holds provider configuration.
 type Config struct {
-	Name    string
-	APIKey  string
-	Model   string
-	BaseURL string // Optional: custom endpoint for OpenAI-compatible APIs
+	Name       string
+	APIKey     string
+	Model      string
+	BaseURL    string            // Optional: custom endpoint for OpenAI-compatible APIs; resource URL for Azure
+	APIVersion string            // Azure OpenAI api-version (default DefaultAzureAPIVersion)
+	Thinking   int               // Anthropic extended thinking budget in tokens (0 = off)
+	HTTPClient *http.Client      // Optional: client for API requests (default http.DefaultClient)
+	Headers    map[string]string // Optional: extra headers sent with every request
+
+	// Middleware, applied around the provider from the outside in: Cache,
+	// Retry, Limits, then Log. Zero values leave each one out.
+	Cache  CacheConfig
+	Retry  RetryConfig
+	Limits Limits
+	Log    bool
 }
 
 // New creates a Provider by name.
-// Supported: "anthropic", "openai".
+// Supported: "anthropic", "openai", "azure", and the Presets.
 // For openai-compatible endpoints with custom base URLs, set BaseURL in config.
 func New(name, apiKey, model string) (Provider, error) {
 	return NewFromConfig(Config{Name: name, APIKey: apiKey, Model: model})
 }
 
-// NewFromConfig creates a Provider from a full Config.
+// NewFromConfig creates a Provider from a full Config, wrapped in the
+// middleware it configures.
 func NewFromConfig(cfg Config) (Provider, error) {
+	p, err := newProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var mws []Middleware
+	if cfg.Cache.Size > 0 {
+		mws = append(mws, Cache(cfg.Cache))
+	}
+	if cfg.Retry.Attempts > 0 {
+		mws = append(mws, Retry(cfg.Retry))
+	}
+	if cfg.Limits != (Limits{}) {
+		mws = append(mws, RateLimit(cfg.Limits))
+	}
+	if cfg.Log {
+		mws = append(mws, Logging())
+	}
+	return Chain(p, mws...), nil
+}
+
+func newProvider(cfg Config) (Provider, error) {
+	client := []ClientOption{WithHTTPClient(cfg.HTTPClient), WithHeaders(cfg.Headers)}
 	switch cfg.Name {
 	case "anthropic", "claude":
-		return NewAnthropic(cfg.APIKey, cfg.Model), nil
+		var opts []AnthropicOption
+		for _, o := range client {
+			opts = append(opts, o)
+		}
+		if cfg.Thinking > 0 {
+			opts = append(opts, WithThinking(cfg.Thinking))
+		}
+		return NewAnthropic(cfg.APIKey, cfg.Model, opts...), nil
 	case "openai", "gpt":
-		p := NewOpenAI(cfg.APIKey, cfg.Model)
+		opts := openaiOptions(client)
 		if cfg.BaseURL != "" {
-			p = NewOpenAI(cfg.APIKey, cfg.Model, WithBaseURL(cfg.BaseURL))
+			opts = append(opts, WithBaseURL(cfg.BaseURL))
+		}
+		return NewOpenAI(cfg.APIKey, cfg.Model, opts...), nil
+	case "azure", "azure-openai":
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("azure provider requires base_url (https://NAME.openai.azure.com)")
 		}
-		return p, nil
+		return NewOpenAI(cfg.APIKey, cfg.Model, append(openaiOptions(client), WithAzure(cfg.BaseURL, cfg.APIVersion))...), nil
 	default:
-		return nil, fmt.Errorf("unknown provider: %q (supported: anthropic, openai)", cfg.Name)
+		if preset, ok := Presets[cfg.Name]; ok {
+			return newPreset(cfg.Name, preset, cfg, openaiOptions(client)), nil
+		}
+		return nil, fmt.Errorf("unknown provider: %q (supported: anthropic, openai, azure, %s)", cfg.Name, strings.Join(presetNames(), ", "))
+	}
+}
+
+func openaiOptions(client []ClientOption) []OpenAIOption {
+	opts := make([]OpenAIOption, 0, len(client))
+	for _, o := range client {
+		opts = append(opts, o)
 	}
+	return opts
 }
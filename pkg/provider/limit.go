@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits caps how fast requests are sent to a provider. Zero fields are
+// unlimited.
+type Limits struct {
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	TokensPerMinute   int `json:"tokens_per_minute,omitempty"` // Prompt plus completion tokens
+	MaxInFlight       int `json:"max_in_flight,omitempty"`     // Requests waiting on a response at once
+}
+
+// Limiter is a Provider that holds requests back to stay within Limits.
+// Share one Limiter between every caller of an API key (sessions, jobs,
+// channels) so that together they stay under the provider's rate limits.
+type Limiter struct {
+	p        Provider
+	inFlight chan struct{} // nil = unlimited
+
+	mu       sync.Mutex
+	requests *bucket // nil = unlimited
+	tokens   *bucket // nil = unlimited
+}
+
+// NewLimiter wraps p. With zero Limits it only forwards requests.
+func NewLimiter(p Provider, l Limits) *Limiter {
+	lim := &Limiter{p: p}
+	if l.MaxInFlight > 0 {
+		lim.inFlight = make(chan struct{}, l.MaxInFlight)
+	}
+	now := time.Now()
+	if l.RequestsPerMinute > 0 {
+		lim.requests = newBucket(l.RequestsPerMinute, now)
+	}
+	if l.TokensPerMinute > 0 {
+		lim.tokens = newBucket(l.TokensPerMinute, now)
+	}
+	return lim
+}
+
+func (l *Limiter) Name() string { return l.p.Name() }
+
+// Chat waits for a free slot and enough budget, then forwards the request.
+// Tokens are reserved from an estimate of the prompt and max_tokens and
+// corrected with the reported usage once the response arrives.
+func (l *Limiter) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+			defer func() { <-l.inFlight }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	estimate := estimateTokens(req)
+	l.mu.Lock()
+	now := time.Now()
+	var wait time.Duration
+	if l.requests != nil {
+		wait = max(wait, l.requests.reserve(1, now))
+	}
+	if l.tokens != nil {
+		wait = max(wait, l.tokens.reserve(float64(estimate), now))
+	}
+	l.mu.Unlock()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			l.refund(1, estimate)
+			return nil, ctx.Err()
+		}
+	}
+
+	resp, err := l.p.Chat(ctx, req)
+	if err == nil && l.tokens != nil {
+		if used := resp.Usage.PromptTokens + resp.Usage.CompletionTokens; used > 0 {
+			l.refund(0, estimate-used)
+		}
+	}
+	return resp, err
+}
+
+// refund returns unused budget; a negative token count takes more.
+func (l *Limiter) refund(requests, tokens int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.requests != nil {
+		l.requests.level += float64(requests)
+	}
+	if l.tokens != nil {
+		l.tokens.level += float64(tokens)
+	}
+}
+
+// estimateTokens approximates the tokens a request will use at four
+// characters per token, plus its max_tokens.
+func estimateTokens(req ChatRequest) int {
+	return (promptChars(req.Messages)+3)/4 + req.MaxTokens
+}
+
+// bucket is a token bucket holding up to a minute's worth of budget.
+// Reservations may take it below zero; later callers wait for the refill.
+type bucket struct {
+	perSecond float64
+	capacity  float64
+	level     float64
+	last      time.Time
+}
+
+func newBucket(perMinute int, now time.Time) *bucket {
+	return &bucket{perSecond: float64(perMinute) / 60, capacity: float64(perMinute), level: float64(perMinute), last: now}
+}
+
+// reserve takes n from the bucket and returns how long to wait before
+// the reservation is covered.
+func (b *bucket) reserve(n float64, now time.Time) time.Duration {
+	b.level = min(b.capacity, b.level+now.Sub(b.last).Seconds()*b.perSecond)
+	b.last = now
+	b.level -= n
+	if b.level >= 0 {
+		return 0
+	}
+	return time.Duration(-b.level / b.perSecond * float64(time.Second))
+}
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBucket_Reserve(t *testing.T) {
+	start := time.Now()
+	b := newBucket(60, start) // One per second
+
+	tests := []struct {
+		name  string
+		n     float64
+		after time.Duration
+		want  time.Duration
+	}{
+		{"within budget", 59, 0, 0},
+		{"last one", 1, 0, 0},
+		{"empty", 1, 0, time.Second},
+		{"queued behind", 2, 0, 3 * time.Second},
+		{"refilled", 1, 10 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		if got := b.reserve(tt.n, start.Add(tt.after)); got != tt.want {
+			t.Errorf("%s: wait = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Refill never exceeds a minute's worth.
+	if got := b.reserve(61, start.Add(time.Hour)); got != time.Second {
+		t.Errorf("after an hour: wait = %v, want 1s", got)
+	}
+}
+
+// blockingProvider counts concurrent requests until release is closed.
+type blockingProvider struct {
+	release chan struct{}
+	active  atomic.Int32
+	peak    atomic.Int32
+}
+
+func (p *blockingProvider) Name() string { return "blocking" }
+
+func (p *blockingProvider) Chat(ctx context.Context, _ ChatRequest) (*ChatResponse, error) {
+	n := p.active.Add(1)
+	defer p.active.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	<-p.release
+	return &ChatResponse{}, nil
+}
+
+func TestLimiter_MaxInFlight(t *testing.T) {
+	p := &blockingProvider{release: make(chan struct{})}
+	l := NewLimiter(p, Limits{MaxInFlight: 2})
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Chat(context.Background(), ChatRequest{})
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(p.release)
+	wg.Wait()
+	if peak := p.peak.Load(); peak != 2 {
+		t.Errorf("peak in flight = %d, want 2", peak)
+	}
+}
+
+func TestLimiter_WaitRespectsContext(t *testing.T) {
+	l := NewLimiter(&recordingProvider{name: "main"}, Limits{RequestsPerMinute: 1})
+	if _, err := l.Chat(context.Background(), ChatRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Chat(ctx, ChatRequest{}); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+	// The cancelled request gave its reservation back.
+	if level := l.requests.level; level < -0.01 {
+		t.Errorf("requests level = %v after refund", level)
+	}
+}
+
+func TestLimiter_TokensCorrectedByUsage(t *testing.T) {
+	p := usageProvider{Usage{PromptTokens: 300, CompletionTokens: 200}}
+	l := NewLimiter(p, Limits{TokensPerMinute: 10000})
+	if _, err := l.Chat(context.Background(), ChatRequest{Sampling: Sampling{MaxTokens: 1000}}); err != nil {
+		t.Fatal(err)
+	}
+	// 1000 was reserved for max_tokens; only 500 was used.
+	if level := l.tokens.level; level < 9499 || level > 9501 {
+		t.Errorf("tokens level = %v, want ~9500", level)
+	}
+}
+
+type usageProvider struct{ usage Usage }
+
+func (p usageProvider) Name() string { return "usage" }
+
+func (p usageProvider) Chat(context.Context, ChatRequest) (*ChatResponse, error) {
+	return &ChatResponse{Usage: p.usage}, nil
+}
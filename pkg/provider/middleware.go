@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Middleware wraps a Provider to add behavior around Chat: retries, rate
+// limits, caching, logging, or usage accounting.
+type Middleware func(Provider) Provider
+
+// Chain wraps p in mws. The first middleware is the outermost, so it sees
+// each request first and each response last.
+func Chain(p Provider, mws ...Middleware) Provider {
+	for i := len(mws) - 1; i >= 0; i-- {
+		if mws[i] != nil {
+			p = mws[i](p)
+		}
+	}
+	return p
+}
+
+// wrapped is a Provider that keeps the wrapped provider's name.
+type wrapped struct {
+	next Provider
+	chat func(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+}
+
+func (w *wrapped) Name() string { return w.next.Name() }
+
+func (w *wrapped) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	return w.chat(ctx, req)
+}
+
+// ObserveFunc is called after every Chat call with its result. resp is nil
+// when err is set.
+type ObserveFunc func(ctx context.Context, req ChatRequest, resp *ChatResponse, err error)
+
+// Observe calls fn after every call, e.g. to account for usage.
+func Observe(fn ObserveFunc) Middleware {
+	return func(p Provider) Provider {
+		return &wrapped{next: p, chat: func(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+			resp, err := p.Chat(ctx, req)
+			fn(ctx, req, resp, err)
+			return resp, err
+		}}
+	}
+}
+
+// Logging logs the model, token usage, and latency of every call.
+func Logging() Middleware {
+	return func(p Provider) Provider {
+		return &wrapped{next: p, chat: func(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+			start := time.Now()
+			resp, err := p.Chat(ctx, req)
+			elapsed := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				log.Printf("[provider] %s %s: failed after %s: %v", p.Name(), req.Model, elapsed, err)
+				return nil, err
+			}
+			log.Printf("[provider] %s %s: %d+%d tokens, stop %s, %s",
+				p.Name(), resp.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.StopReason, elapsed)
+			return resp, nil
+		}}
+	}
+}
+
+// RateLimit shares one Limiter between every request through it.
+func RateLimit(l Limits) Middleware {
+	return func(p Provider) Provider { return NewLimiter(p, l) }
+}
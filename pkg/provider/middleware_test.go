@@ -0,0 +1,183 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptProvider returns errs in order, then a response.
+type scriptProvider struct {
+	errs  []error
+	calls int
+}
+
+func (p *scriptProvider) Name() string { return "script" }
+
+func (p *scriptProvider) Chat(_ context.Context, req ChatRequest) (*ChatResponse, error) {
+	p.calls++
+	if p.calls <= len(p.errs) {
+		return nil, p.errs[p.calls-1]
+	}
+	return &ChatResponse{Content: fmt.Sprintf("answer %d", p.calls), Model: req.Model, Usage: Usage{PromptTokens: 10}}, nil
+}
+
+func TestChain_Order(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return Observe(func(context.Context, ChatRequest, *ChatResponse, error) { order = append(order, name) })
+	}
+	p := Chain(&scriptProvider{}, tag("outer"), nil, tag("inner"))
+	if _, err := p.Chat(context.Background(), ChatRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	// Observers run after the call returns, so the innermost reports first.
+	if strings.Join(order, ",") != "inner,outer" {
+		t.Errorf("order = %v", order)
+	}
+	if p.Name() != "script" {
+		t.Errorf("name = %q", p.Name())
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &HTTPError{StatusCode: 429}, true},
+		{"overloaded", fmt.Errorf("wrapped: %w", &HTTPError{StatusCode: 529}), true},
+		{"server error", &HTTPError{StatusCode: 502}, true},
+		{"bad request", &HTTPError{StatusCode: 400}, false},
+		{"network", &url.Error{Op: "Post", URL: "https://api", Err: errors.New("connection reset")}, true},
+		{"cancelled", &url.Error{Op: "Post", URL: "https://api", Err: context.Canceled}, false},
+		{"other", errors.New("marshal request"), false},
+	}
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.want {
+			t.Errorf("%s: Retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContextOverflow(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"anthropic", &HTTPError{StatusCode: 400, Body: `{"error":{"message":"prompt is too long: 210000 tokens > 200000 maximum"}}`}, true},
+		{"openai", fmt.Errorf("wrapped: %w", &HTTPError{StatusCode: 400, Body: `{"error":{"code":"context_length_exceeded"}}`}), true},
+		{"too large", &HTTPError{StatusCode: 413}, true},
+		{"other bad request", &HTTPError{StatusCode: 400, Body: "invalid model"}, false},
+		{"rate limited", &HTTPError{StatusCode: 429, Body: "prompt is too long"}, false},
+		{"other", errors.New("prompt is too long"), false},
+	}
+	for _, tt := range tests {
+		if got := ContextOverflow(tt.err); got != tt.want {
+			t.Errorf("%s: ContextOverflow = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	limited := &HTTPError{Provider: "script", StatusCode: 429, RetryAfter: time.Millisecond}
+	tests := []struct {
+		name      string
+		errs      []error
+		attempts  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"succeeds after retries", []error{limited, &HTTPError{StatusCode: 503}}, 2, 3, false},
+		{"gives up", []error{limited, limited, limited}, 2, 3, true},
+		{"not retryable", []error{&HTTPError{StatusCode: 401}}, 2, 1, true},
+	}
+	for _, tt := range tests {
+		sp := &scriptProvider{errs: tt.errs}
+		p := Chain(sp, Retry(RetryConfig{Attempts: tt.attempts, Backoff: time.Millisecond}))
+		_, err := p.Chat(context.Background(), ChatRequest{})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+		if sp.calls != tt.wantCalls {
+			t.Errorf("%s: calls = %d, want %d", tt.name, sp.calls, tt.wantCalls)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	sp := &scriptProvider{}
+	p := Chain(sp, Cache(CacheConfig{Size: 1}))
+	ctx := context.Background()
+	a := ChatRequest{Model: "m", Messages: []Message{{Role: "user", Content: "ping"}}}
+	b := ChatRequest{Model: "m", Messages: []Message{{Role: "user", Content: "pong"}}}
+
+	first, _ := p.Chat(ctx, a)
+	hit, _ := p.Chat(ctx, a)
+	if sp.calls != 1 || hit.Content != first.Content {
+		t.Fatalf("calls = %d, hit = %+v", sp.calls, hit)
+	}
+	if hit.Usage != (Usage{}) || first.Usage.PromptTokens != 10 {
+		t.Errorf("usage: first %+v, hit %+v", first.Usage, hit.Usage)
+	}
+
+	// b evicts a from a cache of one.
+	p.Chat(ctx, b)
+	p.Chat(ctx, a)
+	if sp.calls != 3 {
+		t.Errorf("calls = %d, want 3 after eviction", sp.calls)
+	}
+}
+
+func TestCache_TTL(t *testing.T) {
+	sp := &scriptProvider{}
+	p := Chain(sp, Cache(CacheConfig{Size: 10, TTL: time.Millisecond}))
+	p.Chat(context.Background(), ChatRequest{})
+	time.Sleep(5 * time.Millisecond)
+	p.Chat(context.Background(), ChatRequest{})
+	if sp.calls != 2 {
+		t.Errorf("calls = %d, want 2 after expiry", sp.calls)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"slow down"}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewOpenAI("key", "model", WithBaseURL(server.URL)).Chat(context.Background(), ChatRequest{})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("err = %v, want *HTTPError", err)
+	}
+	if httpErr.StatusCode != 429 || httpErr.RetryAfter != 7*time.Second {
+		t.Errorf("got %+v", httpErr)
+	}
+	if !strings.HasPrefix(err.Error(), "openai: HTTP 429: ") {
+		t.Errorf("message = %q", err.Error())
+	}
+}
+
+func TestNewFromConfig_Middleware(t *testing.T) {
+	p, err := NewFromConfig(Config{Name: "openai", APIKey: "key", Limits: Limits{MaxInFlight: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*Limiter); !ok {
+		t.Errorf("provider = %T, want *Limiter", p)
+	}
+	if p.Name() != "openai" {
+		t.Errorf("name = %q", p.Name())
+	}
+}
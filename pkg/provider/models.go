@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"maps"
+	"strings"
+)
+
+// ModelInfo describes what a model accepts and costs.
+type ModelInfo struct {
+	ContextWindow int     `json:"context_window"`         // Input plus output tokens
+	MaxOutput     int     `json:"max_output,omitempty"`   // Output tokens per response
+	Tools         bool    `json:"tools,omitempty"`        // Supports tool calls
+	Vision        bool    `json:"vision,omitempty"`       // Accepts images
+	InputPrice    float64 `json:"input_price,omitempty"`  // USD per million input tokens (0 = unknown)
+	OutputPrice   float64 `json:"output_price,omitempty"` // USD per million output tokens (0 = unknown)
+}
+
+// defaultModels are common models, keyed by model name or name prefix.
+var defaultModels = map[string]ModelInfo{
+	// Anthropic
+	"claude-opus-4-5":   {ContextWindow: 200_000, MaxOutput: 64_000, Tools: true, Vision: true, InputPrice: 5, OutputPrice: 25},
+	"claude-opus-4":     {ContextWindow: 200_000, MaxOutput: 32_000, Tools: true, Vision: true, InputPrice: 15, OutputPrice: 75},
+	"claude-sonnet-4":   {ContextWindow: 200_000, MaxOutput: 64_000, Tools: true, Vision: true, InputPrice: 3, OutputPrice: 15},
+	"claude-haiku-4-5":  {ContextWindow: 200_000, MaxOutput: 64_000, Tools: true, Vision: true, InputPrice: 1, OutputPrice: 5},
+	"claude-3-7-sonnet": {ContextWindow: 200_000, MaxOutput: 64_000, Tools: true, Vision: true, InputPrice: 3, OutputPrice: 15},
+	"claude-3-5-sonnet": {ContextWindow: 200_000, MaxOutput: 8192, Tools: true, Vision: true, InputPrice: 3, OutputPrice: 15},
+	"claude-3-5-haiku":  {ContextWindow: 200_000, MaxOutput: 8192, Tools: true, InputPrice: 0.8, OutputPrice: 4},
+	"claude-3-opus":     {ContextWindow: 200_000, MaxOutput: 4096, Tools: true, Vision: true, InputPrice: 15, OutputPrice: 75},
+	"claude-3-haiku":    {ContextWindow: 200_000, MaxOutput: 4096, Tools: true, Vision: true, InputPrice: 0.25, OutputPrice: 1.25},
+
+	// OpenAI
+	"gpt-5":        {ContextWindow: 400_000, MaxOutput: 128_000, Tools: true, Vision: true, InputPrice: 1.25, OutputPrice: 10},
+	"gpt-5-mini":   {ContextWindow: 400_000, MaxOutput: 128_000, Tools: true, Vision: true, InputPrice: 0.25, OutputPrice: 2},
+	"gpt-5-nano":   {ContextWindow: 400_000, MaxOutput: 128_000, Tools: true, Vision: true, InputPrice: 0.05, OutputPrice: 0.4},
+	"gpt-4.1":      {ContextWindow: 1_047_576, MaxOutput: 32_768, Tools: true, Vision: true, InputPrice: 2, OutputPrice: 8},
+	"gpt-4.1-mini": {ContextWindow: 1_047_576, MaxOutput: 32_768, Tools: true, Vision: true, InputPrice: 0.4, OutputPrice: 1.6},
+	"gpt-4.1-nano": {ContextWindow: 1_047_576, MaxOutput: 32_768, Tools: true, Vision: true, InputPrice: 0.1, OutputPrice: 0.4},
+	"gpt-4o":       {ContextWindow: 128_000, MaxOutput: 16_384, Tools: true, Vision: true, InputPrice: 2.5, OutputPrice: 10},
+	"gpt-4o-mini":  {ContextWindow: 128_000, MaxOutput: 16_384, Tools: true, Vision: true, InputPrice: 0.15, OutputPrice: 0.6},
+	"o1":           {ContextWindow: 200_000, MaxOutput: 100_000, Tools: true, Vision: true, InputPrice: 15, OutputPrice: 60},
+	"o1-mini":      {ContextWindow: 128_000, MaxOutput: 65_536, InputPrice: 1.1, OutputPrice: 4.4},
+	"o3":           {ContextWindow: 200_000, MaxOutput: 100_000, Tools: true, Vision: true, InputPrice: 2, OutputPrice: 8},
+	"o3-mini":      {ContextWindow: 200_000, MaxOutput: 100_000, Tools: true, InputPrice: 1.1, OutputPrice: 4.4},
+	"o4-mini":      {ContextWindow: 200_000, MaxOutput: 100_000, Tools: true, Vision: true, InputPrice: 1.1, OutputPrice: 4.4},
+
+	// Google
+	"gemini-2.5-pro":   {ContextWindow: 1_048_576, MaxOutput: 65_536, Tools: true, Vision: true, InputPrice: 1.25, OutputPrice: 10},
+	"gemini-2.5-flash": {ContextWindow: 1_048_576, MaxOutput: 65_536, Tools: true, Vision: true, InputPrice: 0.3, OutputPrice: 2.5},
+	"gemini-2.0-flash": {ContextWindow: 1_048_576, MaxOutput: 8192, Tools: true, Vision: true, InputPrice: 0.1, OutputPrice: 0.4},
+	"gemini-1.5-pro":   {ContextWindow: 2_097_152, MaxOutput: 8192, Tools: true, Vision: true, InputPrice: 1.25, OutputPrice: 5},
+	"gemini-1.5-flash": {ContextWindow: 1_048_576, MaxOutput: 8192, Tools: true, Vision: true, InputPrice: 0.075, OutputPrice: 0.3},
+
+	// Preset defaults
+	"llama-3.3-70b":        {ContextWindow: 131_072, MaxOutput: 32_768, Tools: true},
+	"Llama-3.3-70B":        {ContextWindow: 131_072, MaxOutput: 8192, Tools: true},
+	"mistral-large-latest": {ContextWindow: 131_072, MaxOutput: 8192, Tools: true},
+	"deepseek-chat":        {ContextWindow: 65_536, MaxOutput: 8192, Tools: true},
+}
+
+// Catalog maps models to their ModelInfo.
+type Catalog struct {
+	models map[string]ModelInfo
+}
+
+// DefaultCatalog returns a catalog of built-in models.
+func DefaultCatalog() *Catalog {
+	return NewCatalog(defaultModels)
+}
+
+// NewCatalog returns a catalog of only the given models.
+func NewCatalog(models map[string]ModelInfo) *Catalog {
+	return &Catalog{models: maps.Clone(models)}
+}
+
+// With returns a copy of c with overrides added or replacing entries.
+func (c *Catalog) With(overrides map[string]ModelInfo) *Catalog {
+	out := NewCatalog(c.models)
+	maps.Copy(out.models, overrides)
+	return out
+}
+
+// All returns every entry, keyed by model name or prefix.
+func (c *Catalog) All() map[string]ModelInfo {
+	return maps.Clone(c.models)
+}
+
+// Lookup finds model. An exact match wins; otherwise the longest key that
+// prefixes the model is used, so dated names such as
+// "claude-sonnet-4-20250514" match "claude-sonnet-4". A router prefix like
+// "openai/" is ignored.
+func (c *Catalog) Lookup(model string) (ModelInfo, bool) {
+	if c == nil {
+		return ModelInfo{}, false
+	}
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	if info, ok := c.models[model]; ok {
+		return info, true
+	}
+	best := ""
+	for key := range c.models {
+		if strings.HasPrefix(model, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return ModelInfo{}, false
+	}
+	return c.models[best], true
+}
@@ -0,0 +1,27 @@
+package provider
+
+import "testing"
+
+func TestCatalog_Lookup(t *testing.T) {
+	c := DefaultCatalog().With(map[string]ModelInfo{"local-llama": {ContextWindow: 8192}})
+	tests := []struct {
+		model      string
+		wantWindow int
+		wantOK     bool
+	}{
+		{"claude-sonnet-4-20250514", 200_000, true},
+		{"gpt-4o-mini", 128_000, true},
+		{"openrouter/anthropic/claude-opus-4-5", 200_000, true},
+		{"local-llama", 8192, true},
+		{"mystery", 0, false},
+	}
+	for _, tt := range tests {
+		info, ok := c.Lookup(tt.model)
+		if ok != tt.wantOK || info.ContextWindow != tt.wantWindow {
+			t.Errorf("%s: got %d, %v", tt.model, info.ContextWindow, ok)
+		}
+	}
+	if info, _ := c.Lookup("gpt-4o-mini"); info.InputPrice != 0.15 || !info.Tools || !info.Vision {
+		t.Errorf("gpt-4o-mini = %+v", info)
+	}
+}
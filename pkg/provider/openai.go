@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 )
 
 const openaiDefaultURL = "https://api.openai.com/v1/chat/completions"
@@ -15,17 +17,48 @@ const openaiDefaultURL = "https://api.openai.com/v1/chat/completions"
 // OpenAI implements Provider for OpenAI-compatible APIs.
 // Works with OpenAI, Groq, Together, Ollama, and any OpenAI-compatible endpoint.
 type OpenAI struct {
-	apiKey  string
-	model   string
-	baseURL string
+	name       string // Reported by Name for presets ("" = "openai")
+	apiKey     string
+	model      string
+	baseURL    string
+	azure      bool   // Azure OpenAI: deployment URLs and api-key header
+	apiVersion string // Azure api-version query parameter
+	http       httpClient
 }
 
-// OpenAIOption configures an OpenAI provider.
-type OpenAIOption func(*OpenAI)
+// OpenAIOption configures an OpenAI provider. Both the OpenAI options and
+// ClientOptions are OpenAIOptions.
+type OpenAIOption interface {
+	applyOpenAI(*OpenAI)
+}
+
+type openaiOption func(*OpenAI)
+
+func (f openaiOption) applyOpenAI(o *OpenAI) { f(o) }
 
 // WithBaseURL sets a custom API base URL (for compatible providers).
 func WithBaseURL(url string) OpenAIOption {
-	return func(o *OpenAI) { o.baseURL = url }
+	return openaiOption(func(o *OpenAI) { o.baseURL = url })
+}
+
+// DefaultAzureAPIVersion is the Azure OpenAI api-version used when none is set.
+const DefaultAzureAPIVersion = "2024-10-21"
+
+// WithAzure targets an Azure OpenAI resource. endpoint is the resource URL
+// (e.g. https://NAME.openai.azure.com); the model name is used as the
+// deployment name. apiVersion defaults to DefaultAzureAPIVersion.
+func WithAzure(endpoint, apiVersion string) OpenAIOption {
+	return openaiOption(func(o *OpenAI) {
+		if apiVersion == "" {
+			apiVersion = DefaultAzureAPIVersion
+		}
+		o.azure = true
+		o.baseURL = strings.TrimRight(endpoint, "/")
+		o.apiVersion = apiVersion
+		if o.apiKey == "" {
+			o.apiKey = os.Getenv("AZURE_OPENAI_API_KEY")
+		}
+	})
 }
 
 // NewOpenAI creates an OpenAI-compatible provider.
@@ -40,26 +73,108 @@ func NewOpenAI(apiKey, model string, opts ...OpenAIOption) *OpenAI {
 	}
 	o := &OpenAI{apiKey: apiKey, model: model, baseURL: openaiDefaultURL}
 	for _, opt := range opts {
-		opt(o)
+		opt.applyOpenAI(o)
 	}
 	return o
 }
 
-func (o *OpenAI) Name() string { return "openai" }
+func (o *OpenAI) Name() string {
+	if o.azure {
+		return "azure"
+	}
+	if o.name != "" {
+		return o.name
+	}
+	return "openai"
+}
+
+// endpoint returns the chat completions URL for a model.
+// For Azure the model is the deployment name.
+func (o *OpenAI) endpoint(model string) string {
+	if !o.azure {
+		return o.baseURL
+	}
+	return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		o.baseURL, url.PathEscape(model), url.QueryEscape(o.apiVersion))
+}
 
 // OpenAI API types
 
 type openaiRequest struct {
-	Model    string          `json:"model"`
-	Messages []openaiMessage `json:"messages"`
-	Tools    []openaiTool    `json:"tools,omitempty"`
+	Model          string                `json:"model"`
+	Messages       []openaiMessage       `json:"messages"`
+	Tools          []openaiTool          `json:"tools,omitempty"`
+	ToolChoice     any                   `json:"tool_choice,omitempty"` // "auto", "required", "none", or a function
+	ResponseFormat *openaiResponseFormat `json:"response_format,omitempty"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	Temperature    *float64              `json:"temperature,omitempty"`
+	TopP           *float64              `json:"top_p,omitempty"`
+	Stop           []string              `json:"stop,omitempty"`
+	Seed           *int                  `json:"seed,omitempty"`
+}
+
+type openaiResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *openaiJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openaiJSONSchema struct {
+	Name   string `json:"name"`
+	Schema any    `json:"schema"`
 }
 
 type openaiMessage struct {
-	Role       string          `json:"role"`
-	Content    string          `json:"content,omitempty"`
+	Role       string           `json:"role"`
+	Content    any              `json:"content,omitempty"` // string, or []openaiPart for images
 	ToolCalls  []openaiToolCall `json:"tool_calls,omitempty"`
-	ToolCallID string          `json:"tool_call_id,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openaiPart struct {
+	Type     string          `json:"type"` // "text", "image_url", or "file"
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openaiImageURL `json:"image_url,omitempty"`
+	File     *openaiFile     `json:"file,omitempty"`
+}
+
+type openaiFile struct {
+	Filename string `json:"filename"`
+	FileData string `json:"file_data"` // data: URL
+}
+
+type openaiImageURL struct {
+	URL string `json:"url"` // http(s) or data: URL
+}
+
+// openaiContent returns a message's content: nil when empty, so it is
+// omitted, the text alone, or parts when files are attached. Documents are
+// sent as text when there is any, since few OpenAI-compatible APIs accept
+// file parts.
+func openaiContent(m Message) any {
+	if len(m.Images) == 0 && len(m.Documents) == 0 {
+		if m.Content == "" {
+			return nil
+		}
+		return m.Content
+	}
+	var parts []openaiPart
+	for _, doc := range m.Documents {
+		if doc.Text != "" || doc.Data == "" {
+			parts = append(parts, openaiPart{Type: "text", Text: fmt.Sprintf("<document name=%q>\n%s\n</document>", doc.Name, doc.Text)})
+			continue
+		}
+		parts = append(parts, openaiPart{Type: "file", File: &openaiFile{
+			Filename: doc.Name,
+			FileData: "data:" + doc.MediaType + ";base64," + doc.Data,
+		}})
+	}
+	if m.Content != "" {
+		parts = append(parts, openaiPart{Type: "text", Text: m.Content})
+	}
+	for _, img := range m.Images {
+		parts = append(parts, openaiPart{Type: "image_url", ImageURL: &openaiImageURL{URL: img.dataURL()}})
+	}
+	return parts
 }
 
 type openaiToolCall struct {
@@ -83,9 +198,10 @@ type openaiTool struct {
 type openaiResponse struct {
 	Choices []struct {
 		Message struct {
-			Content   string          `json:"content"`
+			Content   string           `json:"content"`
 			ToolCalls []openaiToolCall `json:"tool_calls,omitempty"`
 		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
 	Usage struct {
 		PromptTokens     int `json:"prompt_tokens"`
@@ -97,6 +213,33 @@ type openaiResponse struct {
 	} `json:"error"`
 }
 
+// openaiChoice maps ChatRequest.ToolChoice to OpenAI's tool_choice.
+func openaiChoice(choice string) any {
+	switch choice {
+	case ToolChoiceAuto:
+		return nil
+	case ToolChoiceRequired, ToolChoiceNone:
+		return choice
+	default:
+		return map[string]any{"type": "function", "function": map[string]string{"name": choice}}
+	}
+}
+
+// openaiStopReason maps a finish_reason to a ChatResponse stop reason.
+// OpenAI reports "stop" for stop sequences too, so they read as StopEnd.
+func openaiStopReason(reason string) string {
+	switch reason {
+	case "stop":
+		return StopEnd
+	case "tool_calls", "function_call":
+		return StopToolUse
+	case "length":
+		return StopMaxTokens
+	default:
+		return reason
+	}
+}
+
 func (o *OpenAI) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
 	if o.apiKey == "" {
 		return nil, fmt.Errorf("openai: API key not set (OPENAI_API_KEY)")
@@ -112,9 +255,9 @@ func (o *OpenAI) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, erro
 	for _, m := range req.Messages {
 		switch m.Role {
 		case "system", "user":
-			msgs = append(msgs, openaiMessage{Role: m.Role, Content: m.Content})
+			msgs = append(msgs, openaiMessage{Role: m.Role, Content: openaiContent(m)})
 		case "assistant":
-			msg := openaiMessage{Role: "assistant", Content: m.Content}
+			msg := openaiMessage{Role: "assistant", Content: openaiContent(m)}
 			for _, tc := range m.ToolCalls {
 				msg.ToolCalls = append(msg.ToolCalls, openaiToolCall{
 					ID:   tc.ID,
@@ -129,7 +272,7 @@ func (o *OpenAI) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, erro
 		case "tool":
 			msgs = append(msgs, openaiMessage{
 				Role:       "tool",
-				Content:    m.Content,
+				Content:    openaiContent(m),
 				ToolCallID: m.ToolCallID,
 			})
 		}
@@ -146,9 +289,28 @@ func (o *OpenAI) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, erro
 	}
 
 	apiReq := openaiRequest{
-		Model:    model,
-		Messages: msgs,
-		Tools:    tools,
+		Model:       model,
+		Messages:    msgs,
+		Tools:       tools,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.StopSequences,
+		Seed:        req.Seed,
+	}
+
+	if len(tools) > 0 {
+		apiReq.ToolChoice = openaiChoice(req.ToolChoice)
+	}
+
+	switch req.ResponseFormat {
+	case FormatJSON:
+		apiReq.ResponseFormat = &openaiResponseFormat{Type: "json_object"}
+	case FormatJSONSchema:
+		apiReq.ResponseFormat = &openaiResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &openaiJSONSchema{Name: "response", Schema: req.ResponseSchema},
+		}
 	}
 
 	body, err := json.Marshal(apiReq)
@@ -156,14 +318,18 @@ func (o *OpenAI) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, erro
 		return nil, fmt.Errorf("openai: marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.baseURL, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.endpoint(model), bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("openai: create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	if o.azure {
+		httpReq.Header.Set("api-key", o.apiKey)
+	} else {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, err := o.http.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("openai: request failed: %w", err)
 	}
@@ -175,7 +341,7 @@ func (o *OpenAI) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, erro
 	}
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("openai: HTTP %d: %s", resp.StatusCode, string(respBody))
+		return nil, newHTTPError("openai", resp, respBody)
 	}
 
 	var apiResp openaiResponse
@@ -194,10 +360,12 @@ func (o *OpenAI) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, erro
 	choice := apiResp.Choices[0]
 	result := &ChatResponse{
 		Content: choice.Message.Content,
+		Model:   model,
 		Usage: Usage{
 			PromptTokens:     apiResp.Usage.PromptTokens,
 			CompletionTokens: apiResp.Usage.CompletionTokens,
 		},
+		StopReason: openaiStopReason(choice.FinishReason),
 	}
 
 	for _, tc := range choice.Message.ToolCalls {
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -69,11 +70,12 @@ func TestOpenAI_Chat_SimpleResponse(t *testing.T) {
 					Content   string          `json:"content"`
 					ToolCalls []openaiToolCall `json:"tool_calls,omitempty"`
 				} `json:"message"`
+				FinishReason string `json:"finish_reason"`
 			}{
 				{Message: struct {
 					Content   string          `json:"content"`
 					ToolCalls []openaiToolCall `json:"tool_calls,omitempty"`
-				}{Content: "Hello!"}},
+				}{Content: "Hello!"}, FinishReason: "stop"},
 			},
 			Usage: struct {
 				PromptTokens     int `json:"prompt_tokens"`
@@ -97,6 +99,9 @@ func TestOpenAI_Chat_SimpleResponse(t *testing.T) {
 	if resp.Content != "Hello!" {
 		t.Errorf("content = %q", resp.Content)
 	}
+	if resp.StopReason != StopEnd {
+		t.Errorf("stop reason = %q", resp.StopReason)
+	}
 	if resp.Usage.PromptTokens != 80 || resp.Usage.CompletionTokens != 15 {
 		t.Errorf("usage = %+v", resp.Usage)
 	}
@@ -178,6 +183,81 @@ func TestOpenAI_Chat_ErrorResponse(t *testing.T) {
 	}
 }
 
+func TestOpenAI_Chat_ResponseFormat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req openaiRequest
+		json.Unmarshal(body, &req)
+
+		if req.ResponseFormat == nil || req.ResponseFormat.Type != "json_schema" {
+			t.Fatalf("response_format = %+v", req.ResponseFormat)
+		}
+		if req.ResponseFormat.JSONSchema == nil || req.ResponseFormat.JSONSchema.Schema == nil {
+			t.Errorf("missing json_schema: %+v", req.ResponseFormat)
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"{\"ok\":true}"}}]}`))
+	}))
+	defer server.Close()
+
+	o := NewOpenAI("test-key", "gpt-4o", WithBaseURL(server.URL))
+	resp, err := o.Chat(context.Background(), ChatRequest{
+		Messages:       []Message{{Role: "user", Content: "hi"}},
+		ResponseFormat: FormatJSONSchema,
+		ResponseSchema: map[string]any{"type": "object"},
+	})
+	if err != nil {
+		t.Fatalf("Chat error: %v", err)
+	}
+	if resp.Content != `{"ok":true}` {
+		t.Errorf("content = %q", resp.Content)
+	}
+}
+
+func TestOpenAI_Azure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/my-gpt4o/chat/completions" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if r.URL.Query().Get("api-version") != "2024-06-01" {
+			t.Errorf("api-version = %q", r.URL.Query().Get("api-version"))
+		}
+		if r.Header.Get("api-key") != "azure-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("bad auth headers: %v", r.Header)
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi from azure"}}]}`))
+	}))
+	defer server.Close()
+
+	o := NewOpenAI("azure-key", "my-gpt4o", WithAzure(server.URL+"/", "2024-06-01"))
+	if o.Name() != "azure" {
+		t.Errorf("Name() = %q", o.Name())
+	}
+	resp, err := o.Chat(context.Background(), ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}})
+	if err != nil {
+		t.Fatalf("Chat error: %v", err)
+	}
+	if resp.Content != "hi from azure" {
+		t.Errorf("content = %q", resp.Content)
+	}
+}
+
+func TestFactory_Azure(t *testing.T) {
+	if _, err := NewFromConfig(Config{Name: "azure", APIKey: "k", Model: "dep"}); err == nil {
+		t.Error("expected error without base URL")
+	}
+	p, err := NewFromConfig(Config{Name: "azure", APIKey: "k", Model: "dep", BaseURL: "https://x.openai.azure.com"})
+	if err != nil {
+		t.Fatalf("NewFromConfig azure: %v", err)
+	}
+	o := p.(*OpenAI)
+	if o.apiVersion != DefaultAzureAPIVersion {
+		t.Errorf("apiVersion = %q", o.apiVersion)
+	}
+	if got := o.endpoint("dep"); got != "https://x.openai.azure.com/openai/deployments/dep/chat/completions?api-version="+DefaultAzureAPIVersion {
+		t.Errorf("endpoint = %q", got)
+	}
+}
+
 func TestFactory_New(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -240,3 +320,172 @@ func TestFactory_NewFromConfig(t *testing.T) {
 		t.Fatal("NewFromConfig expected error for unknown provider")
 	}
 }
+
+func TestOpenAI_Chat_Sampling(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	temp, seed := 0.0, 42
+	o := NewOpenAI("test-key", "gpt-4o", WithBaseURL(server.URL))
+	_, err := o.Chat(context.Background(), ChatRequest{
+		Messages: []Message{{Role: "user", Content: "hi"}},
+		Sampling: Sampling{MaxTokens: 256, Temperature: &temp, StopSequences: []string{"\n\n"}, Seed: &seed},
+	})
+	if err != nil {
+		t.Fatalf("Chat error: %v", err)
+	}
+	for _, want := range []string{`"max_tokens":256`, `"temperature":0`, `"stop":["\n\n"]`, `"seed":42`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("request %s is missing %s", body, want)
+		}
+	}
+	if strings.Contains(body, "top_p") {
+		t.Errorf("request %s sets top_p", body)
+	}
+}
+
+func TestOpenAI_Chat_ToolChoice(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	o := NewOpenAI("test-key", "gpt-4o", WithBaseURL(server.URL))
+	tools := []ToolDef{{Name: "extract", Parameters: map[string]any{"type": "object"}}}
+	tests := []struct {
+		name, choice string
+		want         string // Substring of the request body ("" = no tool_choice)
+	}{
+		{"auto", ToolChoiceAuto, ""},
+		{"required", ToolChoiceRequired, `"tool_choice":"required"`},
+		{"none", ToolChoiceNone, `"tool_choice":"none"`},
+		{"named", "extract", `"tool_choice":{"function":{"name":"extract"},"type":"function"}`},
+	}
+	for _, tt := range tests {
+		if _, err := o.Chat(context.Background(), ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}, Tools: tools, ToolChoice: tt.choice}); err != nil {
+			t.Fatalf("%s: Chat error: %v", tt.name, err)
+		}
+		if tt.want == "" && strings.Contains(body, "tool_choice") || !strings.Contains(body, tt.want) {
+			t.Errorf("%s: request %s, want %s", tt.name, body, tt.want)
+		}
+	}
+}
+
+func TestOpenAI_Chat_Images(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"choices":[{"message":{"content":"a cat"}}]}`))
+	}))
+	defer server.Close()
+
+	o := NewOpenAI("test-key", "gpt-4o", WithBaseURL(server.URL))
+	_, err := o.Chat(context.Background(), ChatRequest{Messages: []Message{{
+		Role:    "user",
+		Content: "What is this?",
+		Images:  []Image{{MediaType: "image/png", Data: "aGk="}},
+	}}})
+	if err != nil {
+		t.Fatalf("Chat error: %v", err)
+	}
+	want := `"content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,aGk="}}]`
+	if !strings.Contains(body, want) {
+		t.Errorf("request %s is missing %s", body, want)
+	}
+}
+
+func TestOpenAI_Chat_Documents(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	o := NewOpenAI("test-key", "gpt-4o", WithBaseURL(server.URL))
+	_, err := o.Chat(context.Background(), ChatRequest{Messages: []Message{{
+		Role:    "user",
+		Content: "Summarize",
+		Documents: []Document{
+			{Name: "report.pdf", MediaType: MediaTypePDF, Data: "JVBERi0=", Text: "Q3 revenue grew"},
+			{Name: "scan.pdf", MediaType: MediaTypePDF, Data: "JVBERi0="},
+		},
+	}}})
+	if err != nil {
+		t.Fatalf("Chat error: %v", err)
+	}
+	for _, want := range []string{
+		`{"type":"text","text":"\u003cdocument name=\"report.pdf\"\u003e\nQ3 revenue grew\n\u003c/document\u003e"}`,
+		`{"type":"file","file":{"filename":"scan.pdf","file_data":"data:application/pdf;base64,JVBERi0="}}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("request %s is missing %s", body, want)
+		}
+	}
+}
+
+func TestOpenAIStopReason(t *testing.T) {
+	tests := []struct{ reason, want string }{
+		{"stop", StopEnd},
+		{"tool_calls", StopToolUse},
+		{"length", StopMaxTokens},
+		{"content_filter", "content_filter"},
+	}
+	for _, tt := range tests {
+		if got := openaiStopReason(tt.reason); got != tt.want {
+			t.Errorf("openaiStopReason(%q) = %q, want %q", tt.reason, got, tt.want)
+		}
+	}
+}
+
+func TestFactory_OpenRouter(t *testing.T) {
+	t.Setenv("OPENROUTER_API_KEY", "or-key")
+	p, err := NewFromConfig(Config{Name: "openrouter", Model: "anthropic/claude-sonnet-4", Headers: map[string]string{"X-Title": "teeny"}})
+	if err != nil {
+		t.Fatalf("NewFromConfig openrouter: %v", err)
+	}
+	o := p.(*OpenAI)
+	if o.baseURL != OpenRouterURL {
+		t.Errorf("baseURL = %q", o.baseURL)
+	}
+	if o.apiKey != "or-key" {
+		t.Errorf("apiKey = %q", o.apiKey)
+	}
+	if o.http.headers.Get("X-Title") != "teeny" {
+		t.Errorf("headers = %v", o.http.headers)
+	}
+}
+
+func TestFactory_Presets(t *testing.T) {
+	t.Setenv("GROQ_API_KEY", "groq-key")
+	for name, preset := range Presets {
+		p, err := NewFromConfig(Config{Name: name})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		o := p.(*OpenAI)
+		if o.Name() != name || o.baseURL != preset.BaseURL || o.model != preset.Model {
+			t.Errorf("%s: got name %q, url %q, model %q", name, o.Name(), o.baseURL, o.model)
+		}
+	}
+
+	p, _ := NewFromConfig(Config{Name: "groq", Model: "mixtral-8x7b", BaseURL: "http://localhost:8080/v1/chat/completions"})
+	o := p.(*OpenAI)
+	if o.apiKey != "groq-key" || o.model != "mixtral-8x7b" || o.baseURL != "http://localhost:8080/v1/chat/completions" {
+		t.Errorf("overrides: key %q, model %q, url %q", o.apiKey, o.model, o.baseURL)
+	}
+
+	if _, err := NewFromConfig(Config{Name: "nope"}); err == nil || !strings.Contains(err.Error(), "deepseek, groq") {
+		t.Errorf("unknown provider error = %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"maps"
+	"os"
+	"slices"
+)
+
+// Preset describes an OpenAI-compatible vendor: where its chat completions
+// endpoint is, which model to use by default, and where its API key lives.
+type Preset struct {
+	BaseURL   string
+	Model     string
+	APIKeyEnv string
+}
+
+// Presets are the vendors NewFromConfig accepts by name. Config.BaseURL,
+// Config.Model, and Config.APIKey override a preset's values.
+var Presets = map[string]Preset{
+	"openrouter": {BaseURL: OpenRouterURL, Model: "openai/gpt-4o", APIKeyEnv: "OPENROUTER_API_KEY"},
+	"groq":       {BaseURL: "https://api.groq.com/openai/v1/chat/completions", Model: "llama-3.3-70b-versatile", APIKeyEnv: "GROQ_API_KEY"},
+	"mistral":    {BaseURL: "https://api.mistral.ai/v1/chat/completions", Model: "mistral-large-latest", APIKeyEnv: "MISTRAL_API_KEY"},
+	"deepseek":   {BaseURL: "https://api.deepseek.com/chat/completions", Model: "deepseek-chat", APIKeyEnv: "DEEPSEEK_API_KEY"},
+	"together":   {BaseURL: "https://api.together.xyz/v1/chat/completions", Model: "meta-llama/Llama-3.3-70B-Instruct-Turbo", APIKeyEnv: "TOGETHER_API_KEY"},
+}
+
+// newPreset creates an OpenAI provider for the named preset.
+func newPreset(name string, preset Preset, cfg Config, opts []OpenAIOption) *OpenAI {
+	if cfg.BaseURL != "" {
+		preset.BaseURL = cfg.BaseURL
+	}
+	if cfg.Model != "" {
+		preset.Model = cfg.Model
+	}
+	apiKey := cfg.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv(preset.APIKeyEnv)
+	}
+	opts = append(opts, WithBaseURL(preset.BaseURL), openaiOption(func(o *OpenAI) { o.name = name }))
+	return NewOpenAI(apiKey, preset.Model, opts...)
+}
+
+// presetNames lists the presets in sorted order.
+func presetNames() []string {
+	return slices.Sorted(maps.Keys(Presets))
+}
@@ -1,7 +1,10 @@
 // Package provider defines the LLM provider interface and common types.
 package provider
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Message represents a conversation message.
 type Message struct {
@@ -9,6 +12,30 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Images     []Image    `json:"images,omitempty"`    // User messages only
+	Documents  []Document `json:"documents,omitempty"` // User messages only
+	Thinking   []Thinking `json:"thinking,omitempty"`  // Assistant reasoning, passed back on the next call
+	Meta       *Meta      `json:"meta,omitempty"`      // Where the message came from; never sent to the model
+}
+
+// Meta describes a message saved to a session: when and by which run it
+// was added, through which channel, and what producing it cost.
+type Meta struct {
+	Time    time.Time         `json:"time"`
+	RunID   string            `json:"run_id,omitempty"`
+	Channel string            `json:"channel,omitempty"`  // The run's intent, e.g. "slack" or "scheduled"
+	Model   string            `json:"model,omitempty"`    // Assistant messages only
+	CostUSD float64           `json:"cost_usd,omitempty"` // Assistant messages only: the LLM call that produced it
+	Tags    map[string]string `json:"tags,omitempty"`     // Labels set by whoever started the run
+}
+
+// Thinking is a block of the model's reasoning from extended thinking.
+// Anthropic signs each block and needs it back unchanged with the tool
+// results that follow it.
+type Thinking struct {
+	Text      string `json:"text,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Redacted  string `json:"redacted,omitempty"` // Encrypted reasoning flagged by safety systems
 }
 
 // ToolCall represents a tool invocation requested by the LLM.
@@ -31,19 +58,82 @@ type Usage struct {
 	CompletionTokens int `json:"completion_tokens"`
 }
 
+// Response formats for ChatRequest.ResponseFormat.
+const (
+	FormatText       = ""            // Free-form text (default)
+	FormatJSON       = "json"        // Any JSON object
+	FormatJSONSchema = "json_schema" // JSON matching ChatRequest.ResponseSchema
+)
+
+// Tool choices for ChatRequest.ToolChoice. Any other value is the name of
+// a tool the model must call.
+const (
+	ToolChoiceAuto     = ""         // The model decides (default)
+	ToolChoiceRequired = "required" // The model must call some tool
+	ToolChoiceNone     = "none"     // The model must not call tools
+)
+
+// Sampling controls how a response is generated. Zero values and nil
+// pointers leave the provider's default in place, so a temperature of 0 is
+// set with a pointer.
+type Sampling struct {
+	MaxTokens     int      `json:"max_tokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"top_p,omitempty"`
+	StopSequences []string `json:"stop,omitempty"`
+	Seed          *int     `json:"seed,omitempty"` // OpenAI-compatible APIs only; Anthropic ignores it
+}
+
+// Merge returns s with the fields set in o replacing its own.
+func (s Sampling) Merge(o Sampling) Sampling {
+	if o.MaxTokens > 0 {
+		s.MaxTokens = o.MaxTokens
+	}
+	if o.Temperature != nil {
+		s.Temperature = o.Temperature
+	}
+	if o.TopP != nil {
+		s.TopP = o.TopP
+	}
+	if o.StopSequences != nil {
+		s.StopSequences = o.StopSequences
+	}
+	if o.Seed != nil {
+		s.Seed = o.Seed
+	}
+	return s
+}
+
 // ChatRequest is the input to a provider.
 type ChatRequest struct {
-	Model     string
-	Messages  []Message
-	Tools     []ToolDef
-	MaxTokens int
+	Model    string
+	Messages []Message
+	Tools    []ToolDef
+	Sampling
+	ToolChoice     string // ToolChoiceAuto, ToolChoiceRequired, ToolChoiceNone, or a tool name
+	ResponseFormat string // FormatText, FormatJSON, or FormatJSONSchema
+	ResponseSchema any    // JSON Schema object for FormatJSONSchema
+	Intent         string // Caller tag used for routing (e.g. "heartbeat", "coding")
+	CostTier       string // Caller cost preference used for routing (e.g. "low", "high")
 }
 
+// Stop reasons for ChatResponse.StopReason. Providers' own names are
+// mapped to these; reasons without an equivalent are passed through.
+const (
+	StopEnd       = "end"           // The model finished its answer
+	StopToolUse   = "tool_use"      // The model is waiting for tool results
+	StopMaxTokens = "max_tokens"    // The output token limit cut the answer off
+	StopSequence  = "stop_sequence" // A stop sequence was generated
+)
+
 // ChatResponse is the output from a provider.
 type ChatResponse struct {
-	Content   string
-	ToolCalls []ToolCall
-	Usage     Usage
+	Content    string
+	Thinking   []Thinking // Extended thinking, separate from Content
+	ToolCalls  []ToolCall
+	Usage      Usage
+	Model      string // Model that served the request
+	StopReason string // StopEnd, StopToolUse, StopMaxTokens, StopSequence, or the provider's own reason
 }
 
 // Provider is the interface all LLM backends implement.
@@ -6,7 +6,11 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewAnthropic_Defaults(t *testing.T) {
@@ -147,6 +151,44 @@ func TestAnthropic_ErrorResponse(t *testing.T) {
 	}
 }
 
+func TestAnthropic_StructuredOutput(t *testing.T) {
+	a := NewAnthropic("key", "model")
+	schema := map[string]any{"type": "object", "properties": map[string]any{"ok": map[string]any{"type": "boolean"}}}
+	req := a.buildRequest(ChatRequest{
+		Messages:       []Message{{Role: "user", Content: "hi"}},
+		ResponseFormat: FormatJSONSchema,
+		ResponseSchema: schema,
+	})
+
+	if req.ToolChoice == nil || req.ToolChoice.Type != "tool" || req.ToolChoice.Name != structuredOutputTool {
+		t.Fatalf("tool_choice = %+v", req.ToolChoice)
+	}
+	if len(req.Tools) != 1 || req.Tools[0].Name != structuredOutputTool {
+		t.Fatalf("tools = %+v", req.Tools)
+	}
+
+	// With real tools the model may call them before it answers
+	req = a.buildRequest(ChatRequest{
+		Messages:       []Message{{Role: "user", Content: "hi"}},
+		Tools:          []ToolDef{{Name: "search", Parameters: map[string]any{"type": "object"}}},
+		ResponseFormat: FormatJSONSchema,
+		ResponseSchema: schema,
+	})
+	if req.ToolChoice == nil || req.ToolChoice.Type != "any" || len(req.Tools) != 2 {
+		t.Fatalf("with tools: tool_choice = %+v, tools = %+v", req.ToolChoice, req.Tools)
+	}
+
+	resp := parseAnthropicResponse(&anthropicResponse{
+		Content: []contentBlock{{Type: "tool_use", ID: "t1", Name: structuredOutputTool, Input: map[string]any{"ok": true}}},
+	})
+	if resp.Content != `{"ok":true}` {
+		t.Errorf("content = %q", resp.Content)
+	}
+	if len(resp.ToolCalls) != 0 {
+		t.Errorf("structured output should not surface as a tool call: %+v", resp.ToolCalls)
+	}
+}
+
 func TestMessage_JSON(t *testing.T) {
 	msg := Message{
 		Role:    "assistant",
@@ -167,3 +209,254 @@ func TestMessage_JSON(t *testing.T) {
 		t.Errorf("roundtrip failed: %+v", decoded)
 	}
 }
+
+func TestSampling(t *testing.T) {
+	low, high, seed := 0.0, 0.9, 7
+	base := Sampling{MaxTokens: 1024, Temperature: &high, StopSequences: []string{"END"}}
+	got := base.Merge(Sampling{Temperature: &low, Seed: &seed})
+	if got.MaxTokens != 1024 || *got.Temperature != 0 || *got.Seed != 7 || len(got.StopSequences) != 1 {
+		t.Errorf("Merge = %+v", got)
+	}
+
+	a := NewAnthropic("key", "model")
+	req := a.buildRequest(ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}, Sampling: got})
+	body, _ := json.Marshal(req)
+	for _, want := range []string{`"max_tokens":1024`, `"temperature":0`, `"stop_sequences":["END"]`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("anthropic request %s is missing %s", body, want)
+		}
+	}
+	if strings.Contains(string(body), "seed") || strings.Contains(string(body), "top_p") {
+		t.Errorf("anthropic request %s has unset or unsupported fields", body)
+	}
+}
+
+func TestAnthropic_ToolChoice(t *testing.T) {
+	a := NewAnthropic("key", "model")
+	tools := []ToolDef{{Name: "git.status", Parameters: map[string]any{"type": "object"}}}
+	tests := []struct {
+		name, choice string
+		tools        []ToolDef
+		want         *anthropicToolChoice
+	}{
+		{"auto", ToolChoiceAuto, tools, nil},
+		{"required", ToolChoiceRequired, tools, &anthropicToolChoice{Type: "any"}},
+		{"none", ToolChoiceNone, tools, &anthropicToolChoice{Type: "none"}},
+		{"named", "git.status", tools, &anthropicToolChoice{Type: "tool", Name: "git.status"}},
+		{"no tools", ToolChoiceRequired, nil, nil},
+	}
+	for _, tt := range tests {
+		req := a.buildRequest(ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}, Tools: tt.tools, ToolChoice: tt.choice})
+		if (req.ToolChoice == nil) != (tt.want == nil) || (tt.want != nil && *req.ToolChoice != *tt.want) {
+			t.Errorf("%s: tool_choice = %+v, want %+v", tt.name, req.ToolChoice, tt.want)
+		}
+	}
+}
+
+func TestLoadImage(t *testing.T) {
+	dir := t.TempDir()
+	png := filepath.Join(dir, "shot.png")
+	os.WriteFile(png, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644)
+	text := filepath.Join(dir, "notes.txt")
+	os.WriteFile(text, []byte("not an image"), 0644)
+
+	img, err := LoadImage(png)
+	if err != nil || img.MediaType != "image/png" || img.Data == "" {
+		t.Errorf("LoadImage(png) = %+v, %v", img, err)
+	}
+	if img, err := LoadImage("https://example.com/a.jpg"); err != nil || img.URL != "https://example.com/a.jpg" {
+		t.Errorf("LoadImage(url) = %+v, %v", img, err)
+	}
+	if _, err := LoadImage(text); err == nil || !strings.Contains(err.Error(), "not PNG") {
+		t.Errorf("LoadImage(text) err = %v", err)
+	}
+	if _, err := LoadImage(filepath.Join(dir, "missing.png")); err == nil {
+		t.Error("LoadImage(missing) should fail")
+	}
+}
+
+func TestAnthropic_Images(t *testing.T) {
+	a := NewAnthropic("key", "model")
+	req := a.buildRequest(ChatRequest{Messages: []Message{{
+		Role:    "user",
+		Content: "What does this show?",
+		Images:  []Image{{MediaType: "image/png", Data: "aGk="}, {URL: "https://example.com/a.jpg"}},
+	}}})
+	blocks, ok := req.Messages[0].Content.([]contentBlock)
+	if !ok || len(blocks) != 3 {
+		t.Fatalf("content = %+v", req.Messages[0].Content)
+	}
+	if blocks[0].Type != "image" || *blocks[0].Source != (blockSource{Type: "base64", MediaType: "image/png", Data: "aGk="}) {
+		t.Errorf("block 0 = %+v", blocks[0])
+	}
+	if blocks[1].Source == nil || *blocks[1].Source != (blockSource{Type: "url", URL: "https://example.com/a.jpg"}) {
+		t.Errorf("block 1 = %+v", blocks[1])
+	}
+	if blocks[2].Type != "text" || blocks[2].Text != "What does this show?" {
+		t.Errorf("block 2 = %+v", blocks[2])
+	}
+}
+
+func TestAnthropic_Documents(t *testing.T) {
+	a := NewAnthropic("key", "model")
+	req := a.buildRequest(ChatRequest{Messages: []Message{{
+		Role:    "user",
+		Content: "Summarize these",
+		Documents: []Document{
+			{Name: "report.pdf", MediaType: MediaTypePDF, Data: "JVBERi0=", Text: "extracted"},
+			{Name: "notes.md", MediaType: MediaTypeText, Text: "# Notes"},
+		},
+	}}})
+	blocks, ok := req.Messages[0].Content.([]contentBlock)
+	if !ok || len(blocks) != 3 {
+		t.Fatalf("content = %+v", req.Messages[0].Content)
+	}
+	if blocks[0].Type != "document" || blocks[0].Title != "report.pdf" || *blocks[0].Source != (blockSource{Type: "base64", MediaType: MediaTypePDF, Data: "JVBERi0="}) {
+		t.Errorf("PDF block = %+v %+v", blocks[0], blocks[0].Source)
+	}
+	if blocks[1].Title != "notes.md" || *blocks[1].Source != (blockSource{Type: "text", MediaType: MediaTypeText, Data: "# Notes"}) {
+		t.Errorf("text block = %+v %+v", blocks[1], blocks[1].Source)
+	}
+}
+
+func TestAnthropic_Thinking(t *testing.T) {
+	a := NewAnthropic("key", "model", WithThinking(2048))
+	temp := 0.2
+	history := []Message{
+		{Role: "user", Content: "Plan the release"},
+		{Role: "assistant", Thinking: []Thinking{{Text: "Check tags first", Signature: "sig"}, {Redacted: "enc"}},
+			ToolCalls: []ToolCall{{ID: "t1", Name: "git.tags", Arguments: `{}`}}},
+		{Role: "tool", ToolCallID: "t1", Content: "v1.2.0"},
+	}
+	req := a.buildRequest(ChatRequest{Messages: history, Sampling: Sampling{Temperature: &temp}})
+	if req.Thinking == nil || req.Thinking.BudgetTokens != 2048 || req.MaxTokens <= 2048 || req.Temperature != nil {
+		t.Errorf("thinking = %+v, max_tokens = %d, temperature = %v", req.Thinking, req.MaxTokens, req.Temperature)
+	}
+	blocks := req.Messages[1].Content.([]contentBlock)
+	if len(blocks) != 3 || blocks[0].Type != "thinking" || blocks[0].Signature != "sig" || blocks[1].Type != "redacted_thinking" || blocks[1].Data != "enc" {
+		t.Errorf("assistant blocks = %+v", blocks)
+	}
+
+	// Forcing a tool turns thinking off for the request.
+	forced := a.buildRequest(ChatRequest{Messages: history, ResponseFormat: FormatJSON})
+	if forced.Thinking != nil {
+		t.Errorf("structured output request has thinking %+v", forced.Thinking)
+	}
+
+	resp := parseAnthropicResponse(&anthropicResponse{Content: []contentBlock{
+		{Type: "thinking", Thinking: "v1.2.0 is latest", Signature: "sig2"},
+		{Type: "text", Text: "Tag v1.3.0 next."},
+	}})
+	if resp.Content != "Tag v1.3.0 next." || len(resp.Thinking) != 1 || resp.Thinking[0] != (Thinking{Text: "v1.2.0 is latest", Signature: "sig2"}) {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestAnthropic_StopReason(t *testing.T) {
+	for reason, want := range map[string]string{"end_turn": StopEnd, "max_tokens": StopMaxTokens, "tool_use": StopToolUse, "refusal": "refusal"} {
+		if got := parseAnthropicResponse(&anthropicResponse{StopReason: reason}).StopReason; got != want {
+			t.Errorf("stop_reason %q = %q, want %q", reason, got, want)
+		}
+	}
+}
+
+func TestAnthropic_MalformedToolArguments(t *testing.T) {
+	a := NewAnthropic("key", "model")
+	for _, args := range []string{`{"path": "a.txt"`, `null`, `["a.txt"]`, ``} {
+		req := a.buildRequest(ChatRequest{Messages: []Message{
+			{Role: "user", Content: "Read a.txt"},
+			{Role: "assistant", ToolCalls: []ToolCall{{ID: "t1", Name: "fs.read", Arguments: args}}},
+			{Role: "tool", ToolCallID: "t1", Content: "Error: invalid arguments"},
+		}})
+		blocks := req.Messages[1].Content.([]contentBlock)
+		if input, ok := blocks[0].Input.(map[string]any); !ok || input == nil || len(input) != 0 {
+			t.Errorf("arguments %q sent as input %#v, want an empty object", args, blocks[0].Input)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestWithHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/messages" {
+			w.Write([]byte(`{"content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn"}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	var hosts []string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		hosts = append(hosts, r.URL.Host)
+		r.URL.Scheme = "http"
+		r.URL.Host = strings.TrimPrefix(server.URL, "http://")
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	providers := []Provider{
+		NewAnthropic("key", "model", WithHTTPClient(client)),
+		NewOpenAI("key", "model", WithHTTPClient(client)),
+	}
+	for _, p := range providers {
+		resp, err := p.Chat(context.Background(), ChatRequest{Messages: []Message{{Role: "user", Content: "hello"}}})
+		if err != nil {
+			t.Fatalf("%s: %v", p.Name(), err)
+		}
+		if resp.Content != "hi" {
+			t.Errorf("%s: content = %q", p.Name(), resp.Content)
+		}
+	}
+	if want := []string{"api.anthropic.com", "api.openai.com"}; strings.Join(hosts, ",") != strings.Join(want, ",") {
+		t.Errorf("hosts = %v, want %v", hosts, want)
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	c, err := NewHTTPClient(HTTPConfig{Proxy: "http://proxy.internal:3128", Timeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Timeout != time.Minute {
+		t.Errorf("timeout = %v", c.Timeout)
+	}
+	req, _ := http.NewRequest("GET", "https://api.openai.com/v1/chat/completions", nil)
+	proxy, err := c.Transport.(*http.Transport).Proxy(req)
+	if err != nil || proxy == nil || proxy.Host != "proxy.internal:3128" {
+		t.Errorf("proxy = %v, %v", proxy, err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(bad, []byte("not a certificate"), 0644)
+	if _, err := NewHTTPClient(HTTPConfig{CAFile: bad}); err == nil {
+		t.Error("expected error for a CA file without certificates")
+	}
+	if _, err := NewHTTPClient(HTTPConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("expected error for a missing CA file")
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	o := NewOpenAI("key", "model", WithBaseURL(server.URL),
+		WithHeaders(map[string]string{"HTTP-Referer": "https://example.com", "Authorization": "Bearer other"}),
+		WithHeaders(map[string]string{"OpenAI-Organization": "org-1"}))
+	if _, err := o.Chat(context.Background(), ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{"Http-Referer": "https://example.com", "Authorization": "Bearer other", "Openai-Organization": "org-1"} {
+		if got.Get(k) != want {
+			t.Errorf("%s = %q, want %q", k, got.Get(k), want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Package providertest provides a scripted provider.Provider for testing
+// code built on the agent loop without calling a real LLM.
+//
+// A Provider plays back one Step per Chat call, in order:
+//
+//	p := providertest.New(
+//		providertest.ToolCall("echo.run", `{"text":"hi"}`),
+//		providertest.Text("The echo said hi."),
+//	)
+//
+// and records every request so tests can inspect what was sent.
+package providertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// ErrScriptDone is returned by calls after the script has run out, unless
+// Otherwise set a step for them.
+var ErrScriptDone = errors.New("providertest: no more scripted responses")
+
+// Step produces the result of one Chat call.
+type Step func(ctx context.Context, req provider.ChatRequest) (*provider.ChatResponse, error)
+
+// Text responds with a final answer.
+func Text(content string) Step {
+	return Respond(&provider.ChatResponse{Content: content, StopReason: provider.StopEnd})
+}
+
+// ToolCall responds with a single tool call. Its ID is filled in by the
+// Provider.
+func ToolCall(name, arguments string) Step {
+	return ToolCalls(provider.ToolCall{Name: name, Arguments: arguments})
+}
+
+// ToolCalls responds with several tool calls at once. Calls without an ID
+// get one from the Provider.
+func ToolCalls(calls ...provider.ToolCall) Step {
+	return Respond(&provider.ChatResponse{ToolCalls: calls, StopReason: provider.StopToolUse})
+}
+
+// Respond returns resp as is.
+func Respond(resp *provider.ChatResponse) Step {
+	return func(context.Context, provider.ChatRequest) (*provider.ChatResponse, error) {
+		return resp, nil
+	}
+}
+
+// Fail returns err, as an API error would be.
+func Fail(err error) Step {
+	return func(context.Context, provider.ChatRequest) (*provider.ChatResponse, error) {
+		return nil, err
+	}
+}
+
+// Provider is a provider.Provider that plays back a script. It is safe for
+// concurrent use; concurrent calls take steps in arrival order.
+type Provider struct {
+	mu        sync.Mutex
+	name      string
+	steps     []Step
+	otherwise Step
+	calls     []provider.ChatRequest
+}
+
+// New creates a Provider named "mock" that plays steps in order.
+func New(steps ...Step) *Provider {
+	return &Provider{name: "mock", steps: steps}
+}
+
+// Then appends steps to the script.
+func (p *Provider) Then(steps ...Step) *Provider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps = append(p.steps, steps...)
+	return p
+}
+
+// Otherwise sets the step used for every call after the script runs out.
+func (p *Provider) Otherwise(step Step) *Provider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.otherwise = step
+	return p
+}
+
+// Named sets the name the Provider reports.
+func (p *Provider) Named(name string) *Provider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.name = name
+	return p
+}
+
+func (p *Provider) Name() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.name
+}
+
+// Chat records req and plays the next step.
+func (p *Provider) Chat(ctx context.Context, req provider.ChatRequest) (*provider.ChatResponse, error) {
+	p.mu.Lock()
+	n := len(p.calls)
+	p.calls = append(p.calls, req)
+	step := p.otherwise
+	if n < len(p.steps) {
+		step = p.steps[n]
+	}
+	p.mu.Unlock()
+
+	if step == nil {
+		return nil, fmt.Errorf("%w (call %d)", ErrScriptDone, n+1)
+	}
+	resp, err := step(ctx, req)
+	if resp != nil && hasMissingID(resp.ToolCalls) {
+		copied := *resp
+		copied.ToolCalls = append([]provider.ToolCall(nil), resp.ToolCalls...)
+		for i := range copied.ToolCalls {
+			if copied.ToolCalls[i].ID == "" {
+				copied.ToolCalls[i].ID = fmt.Sprintf("call_%d_%d", n+1, i+1)
+			}
+		}
+		resp = &copied
+	}
+	return resp, err
+}
+
+func hasMissingID(calls []provider.ToolCall) bool {
+	for _, tc := range calls {
+		if tc.ID == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Calls returns the requests received so far.
+func (p *Provider) Calls() []provider.ChatRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]provider.ChatRequest(nil), p.calls...)
+}
+
+// Call returns the i-th request received, counting from 0. It panics if
+// there have been fewer calls.
+func (p *Provider) Call(i int) provider.ChatRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[i]
+}
@@ -0,0 +1,54 @@
+package providertest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func TestProvider_Script(t *testing.T) {
+	apiDown := errors.New("api down")
+	p := New(
+		ToolCall("echo.run", `{"text":"hi"}`),
+		Fail(apiDown),
+	).Then(Text("done"))
+	ctx := context.Background()
+
+	resp, err := p.Chat(ctx, provider.ChatRequest{Model: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "call_1_1" || resp.ToolCalls[0].Name != "echo.run" {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+	if _, err := p.Chat(ctx, provider.ChatRequest{}); !errors.Is(err, apiDown) {
+		t.Errorf("call 2: err = %v", err)
+	}
+	if resp, err := p.Chat(ctx, provider.ChatRequest{}); err != nil || resp.Content != "done" {
+		t.Errorf("call 3: %+v, %v", resp, err)
+	}
+	if _, err := p.Chat(ctx, provider.ChatRequest{}); !errors.Is(err, ErrScriptDone) {
+		t.Errorf("call 4: err = %v", err)
+	}
+
+	if n := len(p.Calls()); n != 4 {
+		t.Errorf("calls = %d", n)
+	}
+	if p.Call(0).Model != "first" {
+		t.Errorf("first call model = %q", p.Call(0).Model)
+	}
+}
+
+func TestProvider_Otherwise(t *testing.T) {
+	p := New().Otherwise(Text("fallback")).Named("scripted")
+	for range 2 {
+		if resp, err := p.Chat(context.Background(), provider.ChatRequest{}); err != nil || resp.Content != "fallback" {
+			t.Errorf("got %+v, %v", resp, err)
+		}
+	}
+	if p.Name() != "scripted" {
+		t.Errorf("name = %q", p.Name())
+	}
+}
@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPError is returned when a provider's API answers with a non-200
+// status.
+type HTTPError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // From the Retry-After header (0 if absent)
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s: HTTP %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// newHTTPError builds an HTTPError from a failed response.
+func newHTTPError(name string, resp *http.Response, body []byte) *HTTPError {
+	e := &HTTPError{Provider: name, StatusCode: resp.StatusCode, Body: string(body)}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return e
+}
+
+// Retryable reports whether a failed call may succeed if sent again: rate
+// limits, overload and server errors, and network failures.
+func Retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, 529: // 529: Anthropic overloaded
+			return true
+		}
+		return httpErr.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// ContextOverflow reports whether a failed call was rejected because the
+// prompt doesn't fit the model's context window. Sending it again only helps
+// once messages are dropped.
+func ContextOverflow(err error) bool {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	if httpErr.StatusCode == http.StatusRequestEntityTooLarge {
+		return true
+	}
+	if httpErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	body := strings.ToLower(httpErr.Body)
+	for _, s := range []string{"prompt is too long", "context_length_exceeded", "maximum context length", "context window"} {
+		if strings.Contains(body, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryConfig controls Retry.
+type RetryConfig struct {
+	Attempts int           // Extra attempts after a failed call
+	Backoff  time.Duration // First delay, doubled each attempt (default 1s)
+	MaxDelay time.Duration // Longest delay, including Retry-After (default 1m)
+}
+
+// Retry sends a request again when it fails with a Retryable error,
+// waiting with exponential backoff or as long as the API asks.
+func Retry(cfg RetryConfig) Middleware {
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = time.Minute
+	}
+	return func(p Provider) Provider {
+		return &wrapped{next: p, chat: func(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+			delay := cfg.Backoff
+			for attempt := 0; ; attempt++ {
+				resp, err := p.Chat(ctx, req)
+				if err == nil || attempt >= cfg.Attempts || !Retryable(err) {
+					return resp, err
+				}
+				wait := delay
+				var httpErr *HTTPError
+				if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+					wait = httpErr.RetryAfter
+				}
+				wait = min(wait, cfg.MaxDelay)
+				log.Printf("[provider] %s: %v (retrying in %s)", p.Name(), err, wait)
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				}
+				delay *= 2
+			}
+		}}
+	}
+}
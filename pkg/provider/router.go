@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"slices"
+)
+
+// Route is a provider/model pair a request can be sent to.
+type Route struct {
+	Provider Provider
+	Model    string // Empty keeps the request's (or provider's default) model
+}
+
+// Rule sends matching requests to a route. Every condition that is set
+// must match; unset conditions match anything.
+type Rule struct {
+	Name           string
+	MinPromptChars int      // Total message chars >= this
+	MaxPromptChars int      // Total message chars <= this (0 = no limit)
+	Intents        []string // Request Intent is one of these
+	CostTier       string   // Request CostTier equals this
+	Route          Route
+}
+
+// Matches reports whether req satisfies all of the rule's conditions.
+func (r Rule) Matches(req ChatRequest) bool {
+	if r.MinPromptChars > 0 || r.MaxPromptChars > 0 {
+		n := promptChars(req.Messages)
+		if n < r.MinPromptChars || (r.MaxPromptChars > 0 && n > r.MaxPromptChars) {
+			return false
+		}
+	}
+	if len(r.Intents) > 0 && !slices.Contains(r.Intents, req.Intent) {
+		return false
+	}
+	if r.CostTier != "" && r.CostTier != req.CostTier {
+		return false
+	}
+	return true
+}
+
+// Router is a Provider that picks a route per request using ordered rules.
+// The first matching rule wins; requests matching no rule use the fallback.
+type Router struct {
+	rules    []Rule
+	fallback Route
+}
+
+// NewRouter creates a router. fallback.Provider must be non-nil.
+func NewRouter(fallback Route, rules ...Rule) *Router {
+	return &Router{rules: rules, fallback: fallback}
+}
+
+// Name reports the fallback provider's name; ChatResponse.Model records
+// the model actually used.
+func (r *Router) Name() string { return r.fallback.Provider.Name() }
+
+// Select returns the route for a request.
+func (r *Router) Select(req ChatRequest) Route {
+	for _, rule := range r.rules {
+		if rule.Matches(req) {
+			route := rule.Route
+			if route.Provider == nil {
+				route.Provider = r.fallback.Provider
+			}
+			return route
+		}
+	}
+	return r.fallback
+}
+
+// Chat forwards the request to the selected route. An explicit
+// req.Model always takes precedence over the route's model.
+func (r *Router) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	route := r.Select(req)
+	if req.Model == "" {
+		req.Model = route.Model
+	}
+	return route.Provider.Chat(ctx, req)
+}
+
+func promptChars(msgs []Message) int {
+	n := 0
+	for _, m := range msgs {
+		n += len(m.Content)
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// recordingProvider remembers the last request it served.
+type recordingProvider struct {
+	name string
+	last ChatRequest
+}
+
+func (p *recordingProvider) Name() string { return p.name }
+
+func (p *recordingProvider) Chat(_ context.Context, req ChatRequest) (*ChatResponse, error) {
+	p.last = req
+	return &ChatResponse{Content: p.name, Model: req.Model}, nil
+}
+
+func TestRouter_Select(t *testing.T) {
+	main := &recordingProvider{name: "main"}
+	other := &recordingProvider{name: "other"}
+	r := NewRouter(Route{Provider: main, Model: "frontier"},
+		Rule{Name: "heartbeat", Intents: []string{"heartbeat"}, Route: Route{Model: "cheap"}},
+		Rule{Name: "long", MinPromptChars: 100, Route: Route{Provider: other, Model: "long-context"}},
+		Rule{Name: "budget", CostTier: "low", Route: Route{Model: "cheap"}},
+	)
+
+	tests := []struct {
+		name      string
+		req       ChatRequest
+		wantProv  string
+		wantModel string
+	}{
+		{"fallback", ChatRequest{Messages: []Message{{Content: "hi"}}}, "main", "frontier"},
+		{"intent", ChatRequest{Intent: "heartbeat"}, "main", "cheap"},
+		{"prompt length", ChatRequest{Messages: []Message{{Content: strings.Repeat("x", 150)}}}, "other", "long-context"},
+		{"cost tier", ChatRequest{CostTier: "low"}, "main", "cheap"},
+	}
+	for _, tt := range tests {
+		route := r.Select(tt.req)
+		if route.Provider.Name() != tt.wantProv || route.Model != tt.wantModel {
+			t.Errorf("%s: got %s/%s, want %s/%s", tt.name, route.Provider.Name(), route.Model, tt.wantProv, tt.wantModel)
+		}
+	}
+}
+
+func TestRouter_ChatExplicitModelWins(t *testing.T) {
+	main := &recordingProvider{name: "main"}
+	r := NewRouter(Route{Provider: main, Model: "frontier"},
+		Rule{Intents: []string{"heartbeat"}, Route: Route{Model: "cheap"}},
+	)
+
+	resp, err := r.Chat(context.Background(), ChatRequest{Intent: "heartbeat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Model != "cheap" {
+		t.Errorf("routed model = %q, want cheap", resp.Model)
+	}
+
+	resp, _ = r.Chat(context.Background(), ChatRequest{Intent: "heartbeat", Model: "pinned"})
+	if resp.Model != "pinned" {
+		t.Errorf("explicit model = %q, want pinned", resp.Model)
+	}
+}
+
+func TestRule_MaxPromptChars(t *testing.T) {
+	rule := Rule{MaxPromptChars: 10}
+	if !rule.Matches(ChatRequest{Messages: []Message{{Content: "short"}}}) {
+		t.Error("short prompt should match")
+	}
+	if rule.Matches(ChatRequest{Messages: []Message{{Content: "much longer prompt"}}}) {
+		t.Error("long prompt should not match")
+	}
+}
@@ -0,0 +1,162 @@
+// Package queue bounds how many agent runs execute at once. Runs on the same
+// session never overlap, since each one appends to the session's history;
+// runs on different sessions proceed in parallel up to a global limit.
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultMaxRuns is the global limit used when New is given 0.
+const DefaultMaxRuns = 4
+
+// Queue admits runs one at a time per session and at most MaxRuns at a time
+// overall. Share one Queue between everything that starts runs (channels,
+// webhooks, scheduled jobs) so that together they stay under the limit. A
+// nil Queue admits every run immediately.
+type Queue struct {
+	slots chan struct{} // Global run slots; nil = unlimited
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	running  int
+	idle     chan struct{} // Closed when the last session is forgotten
+}
+
+// session serializes the runs of one session key.
+type session struct {
+	lock chan struct{} // Holds a value while a run owns the session
+	refs int           // Runs holding or waiting for the lock
+}
+
+// Stats is a snapshot of the queue.
+type Stats struct {
+	Running int `json:"running"` // Runs holding a slot
+	Waiting int `json:"waiting"` // Runs waiting for their session or a slot
+}
+
+// New creates a queue that runs at most maxRuns at once (0 =
+// DefaultMaxRuns, negative = unlimited).
+func New(maxRuns int) *Queue {
+	q := &Queue{sessions: make(map[string]*session)}
+	if maxRuns == 0 {
+		maxRuns = DefaultMaxRuns
+	}
+	if maxRuns > 0 {
+		q.slots = make(chan struct{}, maxRuns)
+	}
+	return q
+}
+
+// Acquire waits until sessionKey has no other run in progress and a global
+// slot is free. Runs are admitted to a session in no particular order. On
+// success the caller must call release when the run ends; if ctx is done
+// first, Acquire returns its error.
+func (q *Queue) Acquire(ctx context.Context, sessionKey string) (release func(), err error) {
+	if q == nil {
+		return func() {}, nil
+	}
+	s := q.session(sessionKey)
+	// Take the session before a slot, so runs stuck behind their own
+	// session don't hold slots other sessions could use.
+	select {
+	case s.lock <- struct{}{}:
+	case <-ctx.Done():
+		q.leave(sessionKey, s)
+		return nil, ctx.Err()
+	}
+	if q.slots != nil {
+		select {
+		case q.slots <- struct{}{}:
+		case <-ctx.Done():
+			<-s.lock
+			q.leave(sessionKey, s)
+			return nil, ctx.Err()
+		}
+	}
+	q.mu.Lock()
+	q.running++
+	q.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if q.slots != nil {
+				<-q.slots
+			}
+			<-s.lock
+			q.mu.Lock()
+			q.running--
+			q.mu.Unlock()
+			q.leave(sessionKey, s)
+		})
+	}, nil
+}
+
+// Stats reports how many runs are running and waiting.
+func (q *Queue) Stats() Stats {
+	if q == nil {
+		return Stats{}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := Stats{Running: q.running}
+	for _, s := range q.sessions {
+		st.Waiting += s.refs
+	}
+	st.Waiting -= q.running
+	return st
+}
+
+// Wait blocks until no run is running or waiting, or ctx is done, in
+// which case it returns ctx's error. Runs that start meanwhile are waited
+// for too, so stop whatever starts runs first.
+func (q *Queue) Wait(ctx context.Context) error {
+	if q == nil {
+		return nil
+	}
+	for {
+		q.mu.Lock()
+		if len(q.sessions) == 0 {
+			q.mu.Unlock()
+			return nil
+		}
+		idle := q.idle
+		q.mu.Unlock()
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// session returns the entry for key, counting the caller as a user of it.
+func (q *Queue) session(key string) *session {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.sessions) == 0 {
+		q.idle = make(chan struct{})
+	}
+	s, ok := q.sessions[key]
+	if !ok {
+		s = &session{lock: make(chan struct{}, 1)}
+		q.sessions[key] = s
+	}
+	s.refs++
+	return s
+}
+
+// leave drops the caller's use of s, forgetting the session once no run
+// holds or waits for it.
+func (q *Queue) leave(key string, s *session) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if s.refs--; s.refs == 0 {
+		delete(q.sessions, key)
+		if len(q.sessions) == 0 {
+			close(q.idle)
+		}
+	}
+}
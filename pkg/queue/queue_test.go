@@ -0,0 +1,181 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquire_SerializesSession(t *testing.T) {
+	q := New(10)
+	var active, peak atomic.Int32
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := q.Acquire(context.Background(), "s1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+			n := active.Add(1)
+			if n > peak.Load() {
+				peak.Store(n)
+			}
+			time.Sleep(5 * time.Millisecond)
+			active.Add(-1)
+		}()
+	}
+	wg.Wait()
+	if peak.Load() != 1 {
+		t.Errorf("peak concurrent runs on one session = %d, want 1", peak.Load())
+	}
+	if len(q.sessions) != 0 {
+		t.Errorf("sessions left behind: %d", len(q.sessions))
+	}
+}
+
+func TestAcquire_GlobalLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxRuns int
+		want    int
+	}{
+		{"capped", 2, 2},
+		{"default", 0, DefaultMaxRuns},
+		{"unlimited", -1, 8},
+	}
+	for _, tt := range tests {
+		q := New(tt.maxRuns)
+		hold := make(chan struct{})
+		var mu sync.Mutex
+		var releases []func()
+		for i := range 8 {
+			go func() {
+				release, err := q.Acquire(context.Background(), string(rune('a'+i)))
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				releases = append(releases, release)
+				mu.Unlock()
+				<-hold
+			}()
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for q.Stats().Running < tt.want && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond) // Give extra runs a chance to sneak in
+		if st := q.Stats(); st.Running != tt.want || st.Waiting != 8-tt.want {
+			t.Errorf("%s: stats = %+v, want %d running", tt.name, st, tt.want)
+		}
+		close(hold)
+		deadline = time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			for _, release := range releases {
+				release()
+			}
+			releases = nil
+			mu.Unlock()
+			if q.Stats() == (Stats{}) {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if st := q.Stats(); st != (Stats{}) {
+			t.Errorf("%s: after release stats = %+v", tt.name, st)
+		}
+	}
+}
+
+func TestAcquire_Cancelled(t *testing.T) {
+	q := New(1)
+	release, err := q.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Waiting for the session and waiting for a slot both give up with ctx.
+	for _, key := range []string{"a", "b"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := q.Acquire(ctx, key)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: err = %v, want deadline exceeded", key, err)
+		}
+	}
+	if st := q.Stats(); st != (Stats{Running: 1}) {
+		t.Errorf("stats = %+v", st)
+	}
+
+	release()
+	release() // Releasing twice is harmless
+	if _, err := q.Acquire(context.Background(), "b"); err != nil {
+		t.Errorf("after release: %v", err)
+	}
+}
+
+func TestWait(t *testing.T) {
+	q := New(1)
+	if err := q.Wait(context.Background()); err != nil {
+		t.Fatalf("idle queue: %v", err)
+	}
+
+	release, err := q.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting := make(chan func())
+	go func() {
+		release, err := q.Acquire(context.Background(), "b")
+		if err != nil {
+			t.Error(err)
+		}
+		waiting <- release
+	}()
+	for q.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("busy queue: err = %v, want deadline exceeded", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- q.Wait(context.Background()) }()
+	release()
+	release = <-waiting // The waiting run is admitted, so Wait keeps waiting
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned %v with a run in progress", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	if err := <-done; err != nil {
+		t.Errorf("after release: %v", err)
+	}
+}
+
+func TestNilQueue(t *testing.T) {
+	var q *Queue
+	release, err := q.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if q.Stats() != (Stats{}) {
+		t.Error("nil queue has stats")
+	}
+	if err := q.Wait(context.Background()); err != nil {
+		t.Errorf("Wait: %v", err)
+	}
+}
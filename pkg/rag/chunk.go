@@ -0,0 +1,66 @@
+package rag
+
+import "strings"
+
+// line is a piece of a document no longer than the chunk size, tagged with
+// its 1-based line number.
+type line struct {
+	no   int
+	text string
+}
+
+// split cuts text into chunks of about size characters along line
+// boundaries. Each chunk after the first starts with up to overlap
+// characters of trailing lines from the previous one. Lines longer than size
+// are cut into pieces.
+func split(path, text string, size, overlap int) []Chunk {
+	var lines []line
+	for i, l := range strings.SplitAfter(text, "\n") {
+		for len(l) > size {
+			lines = append(lines, line{i + 1, l[:size]})
+			l = l[size:]
+		}
+		if l != "" {
+			lines = append(lines, line{i + 1, l})
+		}
+	}
+
+	var chunks []Chunk
+	var cur []line
+	n := 0
+	emit := func() {
+		var sb strings.Builder
+		for _, l := range cur {
+			sb.WriteString(l.text)
+		}
+		if t := strings.TrimSpace(sb.String()); t != "" {
+			chunks = append(chunks, Chunk{Path: path, StartLine: cur[0].no, EndLine: cur[len(cur)-1].no, Text: t})
+		}
+	}
+	for _, l := range lines {
+		if n+len(l.text) > size && len(cur) > 0 {
+			emit()
+			// Carry the trailing lines that fit in the overlap, then drop
+			// more from the front until the new line fits.
+			keep := len(cur)
+			for m := 0; keep > 0 && m+len(cur[keep-1].text) <= overlap; keep-- {
+				m += len(cur[keep-1].text)
+			}
+			cur = append([]line(nil), cur[keep:]...)
+			n = 0
+			for _, c := range cur {
+				n += len(c.text)
+			}
+			for len(cur) > 0 && n+len(l.text) > size {
+				n -= len(cur[0].text)
+				cur = cur[1:]
+			}
+		}
+		cur = append(cur, l)
+		n += len(l.text)
+	}
+	if len(cur) > 0 {
+		emit()
+	}
+	return chunks
+}
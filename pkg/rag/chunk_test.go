@@ -0,0 +1,46 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	text := "line one\nline two\nline three\nline four\n"
+	tests := []struct {
+		name          string
+		size, overlap int
+		want          []string
+	}{
+		{"fits", 100, 10, []string{"line one\nline two\nline three\nline four"}},
+		{"no overlap", 20, 0, []string{"line one\nline two", "line three", "line four"}},
+		{"overlap", 22, 11, []string{"line one\nline two", "line two\nline three", "line three\nline four"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := split("f.md", text, tt.size, tt.overlap)
+			var got []string
+			for _, c := range chunks {
+				got = append(got, c.Text)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("chunks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	chunks := split("f.md", text, 22, 11)
+	if chunks[1].StartLine != 2 || chunks[1].EndLine != 3 {
+		t.Errorf("line range = %d-%d, want 2-3", chunks[1].StartLine, chunks[1].EndLine)
+	}
+}
+
+func TestSplit_LongLineAndBlank(t *testing.T) {
+	chunks := split("f.md", strings.Repeat("x", 25), 10, 0)
+	if len(chunks) != 3 || chunks[2].Text != "xxxxx" || chunks[2].StartLine != 1 {
+		t.Errorf("chunks = %+v", chunks)
+	}
+	if chunks := split("f.md", "\n\n  \n", 10, 0); len(chunks) != 0 {
+		t.Errorf("blank text produced chunks: %+v", chunks)
+	}
+}
@@ -0,0 +1,319 @@
+// Package rag indexes workspace documents for retrieval. Documents are split
+// into overlapping chunks, embedded, and ranked by similarity to a query.
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ctxpkg "github.com/rcliao/teeny-orchestrator/pkg/context"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// Config controls which files are indexed and how they are chunked.
+type Config struct {
+	Include      []string // Globs relative to the root; "**/" matches any depth (default **/*.md, **/*.txt)
+	ChunkChars   int      // Target chunk size (default 1500)
+	OverlapChars int      // Text repeated between adjacent chunks (default 200)
+	MaxFileBytes int64    // Larger files are skipped (default 1 MiB)
+	Cache        string   // JSON file that keeps chunks and vectors between runs, one per root ("" = memory only)
+}
+
+// DefaultConfig returns sensible defaults.
+func DefaultConfig() Config {
+	return Config{
+		Include:      []string{"**/*.md", "**/*.txt"},
+		ChunkChars:   1500,
+		OverlapChars: 200,
+		MaxFileBytes: 1 << 20,
+	}
+}
+
+// Chunk is an indexed span of a document.
+type Chunk struct {
+	Path      string    `json:"path"` // Relative to the root
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Text      string    `json:"text"`
+	Vector    []float32 `json:"vector"`
+}
+
+// Result is a chunk and its similarity to the query.
+type Result struct {
+	Chunk
+	Score float64
+}
+
+type fileEntry struct {
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	Chunks  []Chunk   `json:"chunks"`
+}
+
+type indexFile struct {
+	Root  string                `json:"root"`
+	Model string                `json:"model"`
+	Files map[string]*fileEntry `json:"files"`
+}
+
+// embedBatch is how many chunks are embedded per request.
+const embedBatch = 64
+
+// Index holds embedded chunks of the documents under a root directory. It is
+// safe for concurrent use.
+type Index struct {
+	root     string
+	cfg      Config
+	embedder provider.Embedder
+
+	mu     sync.Mutex
+	files  map[string]*fileEntry
+	loaded bool
+}
+
+// New creates an index of the documents under root. Nothing is read until
+// the first Update or Search.
+func New(root string, e provider.Embedder, cfg Config) *Index {
+	def := DefaultConfig()
+	if len(cfg.Include) == 0 {
+		cfg.Include = def.Include
+	}
+	if cfg.ChunkChars <= 0 {
+		cfg.ChunkChars = def.ChunkChars
+	}
+	if cfg.OverlapChars < 0 || cfg.OverlapChars >= cfg.ChunkChars {
+		cfg.OverlapChars = 0
+	}
+	if cfg.MaxFileBytes <= 0 {
+		cfg.MaxFileBytes = def.MaxFileBytes
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	if cfg.Cache != "" {
+		cfg.Cache = cachePath(cfg.Cache, root)
+	}
+	return &Index{root: root, cfg: cfg, embedder: e, files: make(map[string]*fileEntry)}
+}
+
+// Update re-indexes files that were added or changed since the last update
+// and drops files that no longer exist.
+func (ix *Index) Update(ctx context.Context) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.update(ctx)
+}
+
+func (ix *Index) update(ctx context.Context) error {
+	if !ix.loaded {
+		ix.load()
+		ix.loaded = true
+	}
+
+	seen := make(map[string]bool)
+	var pending []*Chunk
+	changed := false
+	err := filepath.WalkDir(ix.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable entries are skipped
+		}
+		rel, _ := filepath.Rel(ix.root, path)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if path != ix.root && skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !ix.included(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > ix.cfg.MaxFileBytes {
+			return nil
+		}
+		seen[rel] = true
+		if e := ix.files[rel]; e != nil && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		e := &fileEntry{ModTime: info.ModTime(), Size: info.Size(), Chunks: split(rel, string(data), ix.cfg.ChunkChars, ix.cfg.OverlapChars)}
+		ix.files[rel] = e
+		for i := range e.Chunks {
+			pending = append(pending, &e.Chunks[i])
+		}
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("rag: walk %s: %w", ix.root, err)
+	}
+	for rel := range ix.files {
+		if !seen[rel] {
+			delete(ix.files, rel)
+			changed = true
+		}
+	}
+
+	for start := 0; start < len(pending); start += embedBatch {
+		batch := pending[start:min(start+embedBatch, len(pending))]
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = c.Path + "\n\n" + c.Text
+		}
+		vecs, err := ix.embedder.Embed(ctx, texts)
+		if err != nil {
+			// Forget the unembedded files so the next update retries them.
+			for _, c := range pending[start:] {
+				delete(ix.files, c.Path)
+			}
+			return fmt.Errorf("rag: embed: %w", err)
+		}
+		for i, c := range batch {
+			c.Vector = vecs[i]
+		}
+	}
+
+	if changed {
+		return ix.save()
+	}
+	return nil
+}
+
+// Search updates the index, then returns the limit chunks most similar to
+// query, best first.
+func (ix *Index) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if err := ix.update(ctx); err != nil {
+		return nil, err
+	}
+	qv, err := ix.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("rag: embed query: %w", err)
+	}
+
+	var results []Result
+	for _, e := range ix.files {
+		for _, c := range e.Chunks {
+			results = append(results, Result{Chunk: c, Score: provider.Cosine(qv[0], c.Vector)})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// Retrieve implements context.Retriever.
+func (ix *Index) Retrieve(ctx context.Context, query string, limit int) ([]ctxpkg.Passage, error) {
+	results, err := ix.Search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	passages := make([]ctxpkg.Passage, len(results))
+	for i, r := range results {
+		passages[i] = ctxpkg.Passage{
+			Source: fmt.Sprintf("%s:%d-%d", r.Path, r.StartLine, r.EndLine),
+			Text:   r.Text,
+		}
+	}
+	return passages, nil
+}
+
+// included reports whether rel matches any include glob.
+func (ix *Index) included(rel string) bool {
+	for _, pattern := range ix.cfg.Include {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob is filepath.Match on slash-separated paths, where a leading
+// "**/" also matches files at any depth.
+func matchGlob(pattern, rel string) bool {
+	if rest, ok := strings.CutPrefix(pattern, "**/"); ok {
+		for {
+			if ok, _ := filepath.Match(rest, rel); ok {
+				return true
+			}
+			i := strings.IndexByte(rel, '/')
+			if i < 0 {
+				return false
+			}
+			rel = rel[i+1:]
+		}
+	}
+	ok, _ := filepath.Match(pattern, rel)
+	return ok
+}
+
+// skipDir reports whether a directory is never indexed: hidden directories
+// and dependency trees.
+func skipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor"
+}
+
+// cachePath returns the cache file for root: path with a hash of root
+// added to its name, so workspaces sharing a configured path don't
+// overwrite each other's cache.
+func cachePath(path, root string) string {
+	sum := sha256.Sum256([]byte(root))
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + hex.EncodeToString(sum[:6]) + ext
+}
+
+// load reads the cache, ignoring it if it belongs to another root or model.
+func (ix *Index) load() {
+	if ix.cfg.Cache == "" {
+		return
+	}
+	data, err := os.ReadFile(ix.cfg.Cache)
+	if err != nil {
+		return
+	}
+	var f indexFile
+	if json.Unmarshal(data, &f) != nil || f.Root != ix.root || f.Model != ix.embedder.Model() || f.Files == nil {
+		return
+	}
+	ix.files = f.Files
+}
+
+func (ix *Index) save() error {
+	if ix.cfg.Cache == "" {
+		return nil
+	}
+	data, err := json.Marshal(indexFile{Root: ix.root, Model: ix.embedder.Model(), Files: ix.files})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ix.cfg.Cache), 0755); err != nil {
+		return fmt.Errorf("rag: create cache dir: %w", err)
+	}
+	tmp := ix.cfg.Cache + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("rag: write cache: %w", err)
+	}
+	return os.Rename(tmp, ix.cfg.Cache)
+}
@@ -0,0 +1,161 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wordEmbedder counts a few topic words so similarity follows topic.
+type wordEmbedder struct {
+	texts int
+	fail  bool
+}
+
+var topics = []string{"deploy", "database", "testing"}
+
+func (e *wordEmbedder) Model() string { return "fake:words" }
+
+func (e *wordEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	if e.fail {
+		return nil, errors.New("embedder down")
+	}
+	e.texts += len(texts)
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		v := make([]float32, len(topics))
+		for d, w := range topics {
+			v[d] = float32(strings.Count(strings.ToLower(t), w))
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "README.md", "# Project\n\nRun the deploy script to deploy.")
+	writeFile(t, root, "docs/db.md", "The database uses SQLite. Back up the database nightly.")
+	writeFile(t, root, "docs/notes.txt", "testing: go test ./...")
+	writeFile(t, root, "main.go", "package main // deploy deploy deploy")
+	writeFile(t, root, ".git/HEAD.md", "deploy")
+	writeFile(t, root, "node_modules/x/README.md", "deploy")
+
+	ix := New(root, &wordEmbedder{}, Config{})
+	results, err := ix.Search(t.Context(), "how does the database work", 2)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(results) != 2 || results[0].Path != "docs/db.md" {
+		t.Fatalf("results = %+v", results)
+	}
+	if results[0].StartLine != 1 || results[0].EndLine != 1 || results[0].Score <= results[1].Score {
+		t.Errorf("top result = %+v", results[0])
+	}
+
+	all, _ := ix.Search(t.Context(), "deploy", 0)
+	if len(all) != 3 { // README.md, docs/db.md, docs/notes.txt
+		t.Errorf("indexed %d chunks, want 3: %+v", len(all), all)
+	}
+
+	passages, err := ix.Retrieve(t.Context(), "deploy", 1)
+	if err != nil || len(passages) != 1 || passages[0].Source != "README.md:1-3" {
+		t.Errorf("Retrieve = %+v, %v", passages, err)
+	}
+}
+
+func TestUpdate_Incremental(t *testing.T) {
+	root := t.TempDir()
+	cache := filepath.Join(t.TempDir(), "rag.json")
+	writeFile(t, root, "a.md", "deploy notes")
+	writeFile(t, root, "b.md", "database notes")
+
+	e := &wordEmbedder{}
+	if err := New(root, e, Config{Cache: cache}).Update(t.Context()); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if e.texts != 2 {
+		t.Fatalf("embedded %d texts, want 2", e.texts)
+	}
+
+	// A new index reuses the cache and only embeds what changed.
+	e = &wordEmbedder{}
+	ix := New(root, e, Config{Cache: cache})
+	writeFile(t, root, "a.md", "deploy notes, revised")
+	os.Chtimes(filepath.Join(root, "a.md"), time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	os.Remove(filepath.Join(root, "b.md"))
+	if err := ix.Update(t.Context()); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if e.texts != 1 {
+		t.Errorf("embedded %d texts after edit, want 1", e.texts)
+	}
+	results, _ := ix.Search(t.Context(), "database", 0)
+	if len(results) != 1 || !strings.Contains(results[0].Text, "revised") {
+		t.Errorf("results = %+v", results)
+	}
+
+	// Another workspace configured with the same cache keeps its own.
+	other := t.TempDir()
+	writeFile(t, other, "c.md", "release checklist")
+	e = &wordEmbedder{}
+	if err := New(other, e, Config{Cache: cache}).Update(t.Context()); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	e = &wordEmbedder{}
+	ix = New(root, e, Config{Cache: cache})
+	results, _ = ix.Search(t.Context(), "release", 0)
+	if e.texts != 1 || len(results) != 1 || results[0].Path != "a.md" {
+		t.Errorf("embedded %d texts, results = %+v, want the first workspace's cache", e.texts, results)
+	}
+}
+
+func TestUpdate_EmbedFailureRetries(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "a.md", "deploy notes")
+
+	e := &wordEmbedder{fail: true}
+	ix := New(root, e, Config{})
+	if err := ix.Update(t.Context()); err == nil {
+		t.Fatal("expected embed error")
+	}
+	e.fail = false
+	results, err := ix.Search(t.Context(), "deploy", 1)
+	if err != nil || len(results) != 1 || results[0].Vector == nil {
+		t.Errorf("Search after recovery = %+v, %v", results, err)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/deep/guide.md", true},
+		{"**/*.md", "main.go", false},
+		{"docs/*.md", "docs/guide.md", true},
+		{"docs/*.md", "docs/deep/guide.md", false},
+		{"docs/**/*.md", "docs/a/b/guide.md", false}, // "**" only spans directories as a prefix
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.rel); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
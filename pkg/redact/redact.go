@@ -0,0 +1,156 @@
+// Package redact masks secrets such as API keys and tokens in text before
+// it is logged or written to disk.
+package redact
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// Mask replaces each secret.
+const Mask = "[REDACTED]"
+
+// Builtin are the patterns every Redactor starts with. When a pattern has
+// a capture group, only the first group is masked, so the key name in
+// "aws_secret_access_key = ..." stays readable.
+var Builtin = []string{
+	`sk-ant-[A-Za-z0-9_-]{20,}`,                                         // Anthropic
+	`sk-(?:proj-|svcacct-)?[A-Za-z0-9_-]{20,}`,                          // OpenAI and compatible
+	`gh[pousr]_[A-Za-z0-9]{36,}`,                                        // GitHub tokens
+	`github_pat_[A-Za-z0-9_]{22,}`,                                      // GitHub fine-grained tokens
+	`xox[abeprs]-[A-Za-z0-9-]{10,}`,                                     // Slack bot and user tokens
+	`xapp-[A-Za-z0-9-]{10,}`,                                            // Slack app tokens
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,                                     // AWS access key IDs
+	`(?i)aws_secret_access_key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`, // AWS secret keys
+	`AIza[0-9A-Za-z_-]{35}`,                                             // Google API keys
+	`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`,   // JWTs
+	`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{20,}=*)`,                         // Authorization headers
+	// PEM private keys
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+}
+
+// minValueLen is the shortest literal secret value masked; shorter values
+// would mask ordinary words.
+const minValueLen = 8
+
+// Redactor masks text matching its patterns or known secret values. A nil
+// Redactor leaves text unchanged.
+type Redactor struct {
+	patterns []*regexp.Regexp
+	values   []string
+}
+
+// New returns a Redactor for the Builtin patterns plus extra.
+func New(extra ...string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, p := range append(slices.Clone(Builtin), extra...) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact: pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// AddValues masks the given literal values wherever they appear, e.g.
+// secrets read from the environment. Values shorter than 8 characters are
+// ignored. Call it before the Redactor is shared.
+func (r *Redactor) AddValues(values ...string) {
+	for _, v := range values {
+		if len(v) >= minValueLen && !slices.Contains(r.values, v) {
+			r.values = append(r.values, v)
+		}
+	}
+}
+
+// String returns s with secrets masked.
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, Mask)
+	}
+	for _, re := range r.patterns {
+		s = replace(re, s)
+	}
+	return s
+}
+
+// Message returns msg with secrets masked in its content, tool call
+// arguments, and thinking. Signed thinking is left alone, since the
+// provider rejects altered blocks.
+func (r *Redactor) Message(msg provider.Message) provider.Message {
+	if r == nil {
+		return msg
+	}
+	msg.Content = r.String(msg.Content)
+	if len(msg.ToolCalls) > 0 {
+		calls := slices.Clone(msg.ToolCalls)
+		for i := range calls {
+			calls[i].Arguments = r.String(calls[i].Arguments)
+		}
+		msg.ToolCalls = calls
+	}
+	if len(msg.Thinking) > 0 {
+		thinking := slices.Clone(msg.Thinking)
+		for i := range thinking {
+			if thinking[i].Signature == "" {
+				thinking[i].Text = r.String(thinking[i].Text)
+			}
+		}
+		msg.Thinking = thinking
+	}
+	return msg
+}
+
+// Writer returns a writer that masks secrets in each Write before passing
+// it to w, e.g. log.SetOutput(r.Writer(os.Stderr)). Secrets split across
+// two writes are not caught, so it suits writers like the log package that
+// write whole lines.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return writer{r: r, w: w}
+}
+
+type writer struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.r.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// replace masks re's matches in s: the first capture group if re has one,
+// otherwise the whole match.
+func replace(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) > 2 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(Mask)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
@@ -1,5 +1,7 @@
 // Package scheduler — cron expression parser.
-// Supports standard 5-field cron: minute hour day-of-month month day-of-week
+// Supports standard 5-field cron: minute hour day-of-month month day-of-week,
+// an optional leading seconds field (6 fields), and the macros @yearly,
+// @annually, @monthly, @weekly, @daily, @midnight, and @hourly.
 // Fields: *, N, N-M, N-M/step, */step, comma-separated lists.
 // Day-of-week: 0=Sunday, 1=Monday, ..., 6=Saturday, 7=Sunday.
 package scheduler
@@ -11,8 +13,20 @@ import (
 	"time"
 )
 
+// cronMacros expand to 5-field expressions.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
 // CronExpr represents a parsed cron expression.
 type CronExpr struct {
+	Second     []bool // 0-59; nil for 5-field expressions (fires at second 0)
 	Minute     []bool // 0-59
 	Hour       []bool // 0-23
 	DayOfMonth []bool // 1-31
@@ -20,11 +34,23 @@ type CronExpr struct {
 	DayOfWeek  []bool // 0-6 (Sun=0)
 }
 
-// ParseCron parses a standard 5-field cron expression.
+// ParseCron parses a 5-field cron expression, a 6-field expression with
+// a leading seconds field, or a macro such as @daily.
 func ParseCron(expr string) (*CronExpr, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
 	fields := strings.Fields(expr)
+	var second []bool
+	if len(fields) == 6 {
+		var err error
+		if second, err = parseField(fields[0], 0, 59); err != nil {
+			return nil, fmt.Errorf("cron second: %w", err)
+		}
+		fields = fields[1:]
+	}
 	if len(fields) != 5 {
-		return nil, fmt.Errorf("cron: expected 5 fields, got %d", len(fields))
+		return nil, fmt.Errorf("cron: expected 5 or 6 fields, got %d", len(fields))
 	}
 
 	minute, err := parseField(fields[0], 0, 59)
@@ -49,6 +75,7 @@ func ParseCron(expr string) (*CronExpr, error) {
 	}
 
 	c := &CronExpr{
+		Second:     second,
 		Minute:     minute,
 		Hour:       hour,
 		DayOfMonth: dom,
@@ -71,7 +98,11 @@ func ParseCron(expr string) (*CronExpr, error) {
 }
 
 // Matches returns true if the given time matches the cron expression.
+// Seconds are only checked for 6-field expressions.
 func (c *CronExpr) Matches(t time.Time) bool {
+	if c.Second != nil && !c.Second[t.Second()] {
+		return false
+	}
 	min := t.Minute()
 	hr := t.Hour()
 	dom := t.Day()
@@ -97,6 +128,39 @@ func (c *CronExpr) Matches(t time.Time) bool {
 	return true
 }
 
+// Next returns the first matching time strictly after after, in after's
+// location. It returns the zero time if nothing matches within five years
+// (e.g. "0 0 31 2 *").
+func (c *CronExpr) Next(after time.Time) time.Time {
+	loc := after.Location()
+	var t time.Time
+	if c.Second != nil {
+		t = after.Truncate(time.Second).Add(time.Second)
+	} else {
+		t = after.Truncate(time.Minute).Add(time.Minute)
+	}
+
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, mo, d := t.Date()
+		switch {
+		case !c.Month[mo]:
+			t = time.Date(y, mo+1, 1, 0, 0, 0, 0, loc)
+		case !c.DayOfMonth[d] || !c.DayOfWeek[t.Weekday()]:
+			t = time.Date(y, mo, d+1, 0, 0, 0, 0, loc)
+		case !c.Hour[t.Hour()]:
+			t = time.Date(y, mo, d, t.Hour()+1, 0, 0, 0, loc)
+		case !c.Minute[t.Minute()]:
+			t = time.Date(y, mo, d, t.Hour(), t.Minute()+1, 0, 0, loc)
+		case c.Second != nil && !c.Second[t.Second()]:
+			t = t.Add(time.Second)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
 // parseField parses a single cron field into a boolean slice.
 func parseField(field string, min, max int) ([]bool, error) {
 	result := make([]bool, max+1)
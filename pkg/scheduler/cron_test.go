@@ -19,6 +19,9 @@ func TestParseCronValid(t *testing.T) {
 		{"0,30 * * * *"},
 		{"0 9-17 * * *"},
 		{"0 9-17/2 * * *"},
+		{"*/10 * * * * *"}, // 6 fields: seconds first
+		{"@daily"},
+		{"@weekly"},
 	}
 
 	for _, tt := range tests {
@@ -36,8 +39,10 @@ func TestParseCronInvalid(t *testing.T) {
 	tests := []string{
 		"",
 		"* * *",
-		"* * * * * *",
+		"* * * * * * *",
 		"60 * * * *",
+		"60 * * * * *", // seconds out of range
+		"@sometimes",
 		"* 25 * * *",
 		"@every 5m",
 		"abc * * * *",
@@ -99,31 +104,67 @@ func TestCronSunday7Alias(t *testing.T) {
 	}
 }
 
-func TestShouldRunCron(t *testing.T) {
-	// "0 10 * * *" = daily at 10:00
-	schedule := "0 10 * * *"
-
-	now := time.Date(2026, 2, 17, 10, 0, 30, 0, time.UTC) // 10:00:30
-	lastBefore := time.Date(2026, 2, 16, 10, 0, 0, 0, time.UTC)
-	lastSameMinute := time.Date(2026, 2, 17, 10, 0, 0, 0, time.UTC)
-
-	if !shouldRun(schedule, lastBefore, now) {
-		t.Error("expected shouldRun=true: cron matches and last was yesterday")
+func TestCronSeconds(t *testing.T) {
+	c, err := ParseCron("30 0 10 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Matches(time.Date(2026, 2, 17, 10, 0, 30, 0, time.UTC)) {
+		t.Error("expected match at 10:00:30")
 	}
-	if shouldRun(schedule, lastSameMinute, now) {
-		t.Error("expected shouldRun=false: already ran this minute")
+	if c.Matches(time.Date(2026, 2, 17, 10, 0, 0, 0, time.UTC)) {
+		t.Error("expected no match at 10:00:00")
+	}
+
+	// 5-field expressions ignore seconds when matching.
+	c5, _ := ParseCron("0 10 * * *")
+	if !c5.Matches(time.Date(2026, 2, 17, 10, 0, 30, 0, time.UTC)) {
+		t.Error("expected 5-field match at 10:00:30")
 	}
 }
 
-func TestShouldRunInitialCron(t *testing.T) {
-	matching := time.Date(2026, 2, 17, 10, 0, 0, 0, time.UTC)
-	nonMatching := time.Date(2026, 2, 17, 10, 5, 0, 0, time.UTC)
+func TestCronNext(t *testing.T) {
+	after := time.Date(2026, 2, 17, 10, 0, 30, 0, time.UTC) // Tuesday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 2, 17, 10, 1, 0, 0, time.UTC)},
+		{"0 10 * * *", time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, 2, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 0", time.Date(2026, 2, 22, 9, 0, 0, 0, time.UTC)},
+		{"*/20 * * * * *", time.Date(2026, 2, 17, 10, 0, 40, 0, time.UTC)},
+		{"@daily", time.Date(2026, 2, 18, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 2, 22, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}}, // Never
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := c.Next(after); !got.Equal(tt.want) {
+			t.Errorf("%q.Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
 
-	if !shouldRunInitial("0 10 * * *", matching) {
-		t.Error("expected shouldRunInitial=true at matching time")
+	// Next is strictly after its argument.
+	c, _ := ParseCron("0 10 * * *")
+	at := time.Date(2026, 2, 17, 10, 0, 0, 0, time.UTC)
+	if got := c.Next(at); !got.Equal(at.AddDate(0, 0, 1)) {
+		t.Errorf("Next at a match = %v", got)
 	}
-	if shouldRunInitial("0 10 * * *", nonMatching) {
-		t.Error("expected shouldRunInitial=false at non-matching time")
+}
+
+func TestCronNextKeepsLocation(t *testing.T) {
+	loc := time.FixedZone("UTC-8", -8*3600)
+	c, _ := ParseCron("0 9 * * *")
+	got := c.Next(time.Date(2026, 2, 17, 10, 0, 0, 0, loc))
+	if want := time.Date(2026, 2, 18, 9, 0, 0, 0, loc); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("Next = %v, want %v", got, want)
 	}
 }
 
@@ -0,0 +1,195 @@
+package scheduler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// resultSnippet caps how much of a job's output is kept in history.
+const resultSnippet = 500
+
+// RunRecord is one job execution.
+type RunRecord struct {
+	Job          string    `json:"job"`
+	Session      string    `json:"session"`
+	Attempt      int       `json:"attempt,omitempty"` // 1 for the first try, then retries
+	Start        time.Time `json:"start"`
+	DurationMs   int64     `json:"duration_ms"`
+	Result       string    `json:"result,omitempty"` // First 500 bytes of the output
+	Error        string    `json:"error,omitempty"`
+	InputTokens  int       `json:"input_tokens,omitempty"`
+	OutputTokens int       `json:"output_tokens,omitempty"`
+	CostUSD      float64   `json:"cost_usd,omitempty"`
+}
+
+// HistoryStore persists job runs.
+type HistoryStore interface {
+	Record(r RunRecord) error
+	// List returns up to limit runs of job, newest first. An empty job
+	// matches all jobs; limit <= 0 means no limit.
+	List(job string, limit int) ([]RunRecord, error)
+}
+
+// MemoryHistory keeps the most recent runs in memory.
+type MemoryHistory struct {
+	mu   sync.Mutex
+	max  int
+	runs []RunRecord
+}
+
+// NewMemoryHistory keeps up to max runs.
+func NewMemoryHistory(max int) *MemoryHistory {
+	return &MemoryHistory{max: max}
+}
+
+func (m *MemoryHistory) Record(r RunRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs = append(m.runs, r)
+	if len(m.runs) > m.max {
+		m.runs = slices.Delete(m.runs, 0, len(m.runs)-m.max)
+	}
+	return nil
+}
+
+func (m *MemoryHistory) List(job string, limit int) ([]RunRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return newestFirst(m.runs, job, limit), nil
+}
+
+// FileHistory appends runs to a JSON Lines file.
+type FileHistory struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileHistory stores runs in path, creating parent directories.
+func NewFileHistory(path string) (*FileHistory, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("scheduler: history dir: %w", err)
+	}
+	return &FileHistory{path: path}, nil
+}
+
+func (f *FileHistory) Record(r RunRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("scheduler: history: %w", err)
+	}
+	_, err = file.Write(append(line, '\n'))
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (f *FileHistory) List(job string, limit int) ([]RunRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: history: %w", err)
+	}
+	defer file.Close()
+
+	var runs []RunRecord
+	sc := bufio.NewScanner(file)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var r RunRecord
+		if json.Unmarshal(sc.Bytes(), &r) != nil {
+			continue // Skip a torn last line
+		}
+		runs = append(runs, r)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scheduler: history: %w", err)
+	}
+	return newestFirst(runs, job, limit), nil
+}
+
+func newestFirst(runs []RunRecord, job string, limit int) []RunRecord {
+	var out []RunRecord
+	for i := len(runs) - 1; i >= 0; i-- {
+		if job != "" && runs[i].Job != job {
+			continue
+		}
+		out = append(out, runs[i])
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out
+}
+
+type usageKey struct{}
+
+type usage struct {
+	mu            sync.Mutex
+	input, output int
+	cost          float64
+}
+
+// ReportUsage adds token usage and estimated USD cost to the job run
+// executing in ctx, so it is recorded in history. It is a no-op outside a
+// scheduled run.
+func ReportUsage(ctx context.Context, inputTokens, outputTokens int, costUSD float64) {
+	if u, ok := ctx.Value(usageKey{}).(*usage); ok {
+		u.mu.Lock()
+		u.input += inputTokens
+		u.output += outputTokens
+		u.cost += costUSD
+		u.mu.Unlock()
+	}
+}
+
+// History returns up to limit recent runs of job, newest first. An empty
+// job returns runs of all jobs.
+func (s *Scheduler) History(job string, limit int) ([]RunRecord, error) {
+	return s.history.List(job, limit)
+}
+
+// HistoryHandler serves History as JSON. Mount it on a pattern with a
+// {name} wildcard to filter by job; ?limit=N caps results (default 20).
+func (s *Scheduler) HistoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := 20
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		runs, err := s.History(r.PathValue("name"), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if runs == nil {
+			runs = []RunRecord{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runs)
+	})
+}
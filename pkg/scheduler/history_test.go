@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "history.jsonl")
+	h, err := NewFileHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, job := range []string{"a", "b", "a", "a"} {
+		if err := h.Record(RunRecord{Job: job, Start: start.Add(time.Duration(i) * time.Minute), DurationMs: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A second store on the same file sees persisted runs.
+	h2, _ := NewFileHistory(path)
+	runs, err := h2.List("a", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].DurationMs != 3 || runs[1].DurationMs != 2 {
+		t.Errorf("runs = %+v", runs)
+	}
+
+	// Torn trailing lines are skipped.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"job":"a","sta`)
+	f.Close()
+	if runs, err := h2.List("", 0); err != nil || len(runs) != 4 {
+		t.Errorf("List after torn line = %d, %v", len(runs), err)
+	}
+
+	empty, _ := NewFileHistory(filepath.Join(t.TempDir(), "none.jsonl"))
+	if runs, err := empty.List("", 0); err != nil || runs != nil {
+		t.Errorf("missing file = %v, %v", runs, err)
+	}
+}
+
+func TestMemoryHistoryCap(t *testing.T) {
+	h := NewMemoryHistory(2)
+	for i := range 3 {
+		h.Record(RunRecord{Job: "j", DurationMs: int64(i)})
+	}
+	runs, _ := h.List("j", 0)
+	if len(runs) != 2 || runs[0].DurationMs != 2 || runs[1].DurationMs != 1 {
+		t.Errorf("runs = %+v", runs)
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	s := New(nil, nil, false)
+	s.history.Record(RunRecord{Job: "a", Result: "one"})
+	s.history.Record(RunRecord{Job: "b", Result: "two"})
+	s.history.Record(RunRecord{Job: "a", Result: "three"})
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/jobs/history", s.HistoryHandler())
+	mux.Handle("GET /v1/jobs/{name}/history", s.HistoryHandler())
+
+	get := func(path string) (int, []RunRecord) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var runs []RunRecord
+		json.Unmarshal(rec.Body.Bytes(), &runs)
+		return rec.Code, runs
+	}
+
+	if code, runs := get("/v1/jobs/a/history?limit=1"); code != 200 || len(runs) != 1 || runs[0].Result != "three" {
+		t.Errorf("job history = %d %+v", code, runs)
+	}
+	if _, runs := get("/v1/jobs/history"); len(runs) != 3 {
+		t.Errorf("all history = %+v", runs)
+	}
+	if code, _ := get("/v1/jobs/a/history?limit=x"); code != http.StatusBadRequest {
+		t.Errorf("bad limit status = %d", code)
+	}
+}
@@ -7,8 +7,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/metrics"
+	"github.com/rcliao/teeny-orchestrator/pkg/notify"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
 )
 
 // Job defines a scheduled task.
@@ -18,8 +24,41 @@ type Job struct {
 	Prompt   string `json:"prompt"`
 	Session  string `json:"session"`
 	Enabled  bool   `json:"enabled"`
+	CatchUp  int    `json:"catch_up,omitempty"` // Missed cron runs to replay at startup (0 = skip them)
+
+	Overlap     string `json:"overlap,omitempty"`      // OverlapSkip (default), OverlapQueue, or OverlapParallel
+	MaxParallel int    `json:"max_parallel,omitempty"` // Cap for OverlapParallel (0 = unlimited)
+
+	Retries      int             `json:"retries,omitempty"`       // Extra attempts after a failed run
+	RetryBackoff string          `json:"retry_backoff,omitempty"` // First retry delay, doubled each attempt (default "30s")
+	OnFailure    []notify.Target `json:"on_failure,omitempty"`    // Alerted once all attempts fail
+
+	Notify []notify.Target `json:"notify,omitempty"` // Where to deliver the result
+
+	CreatedBy string `json:"created_by,omitempty"` // Set to "agent" for jobs from the schedule tool
+	Profile   string `json:"profile,omitempty"`    // Tool permission profile; overrides the session's
+	Agent     string `json:"agent,omitempty"`      // Named agent that runs the job (default: the default agent)
+
+	Sampling *provider.Sampling `json:"sampling,omitempty"` // Generation settings, e.g. a low temperature for repeatable runs
 }
 
+// Overlap policies decide what happens when a job fires while a previous
+// run is still going.
+const (
+	OverlapSkip     = "skip"     // Drop the new run
+	OverlapQueue    = "queue"    // Run it after the current one finishes
+	OverlapParallel = "parallel" // Run it alongside, up to MaxParallel
+)
+
+// Retry delays start at defaultBackoff and double up to maxBackoff.
+const (
+	defaultBackoff = 30 * time.Second
+	maxBackoff     = time.Hour
+)
+
+// maxQueued bounds how many runs OverlapQueue holds per job.
+const maxQueued = 10
+
 // RunFunc is called when a job fires. It receives the job's prompt and session key.
 type RunFunc func(ctx context.Context, sessionKey, prompt string) (string, error)
 
@@ -31,18 +70,78 @@ type Scheduler struct {
 	cancel  context.CancelFunc
 	running bool
 	verbose bool
+	metrics *metrics.Metrics
+	notify  *notify.Notifier
+	history HistoryStore
+
+	store    *Store
+	stored   []Job     // Jobs loaded from store, guarded by mu
+	storeMod time.Time // Store file mod time at last load
+	wake     chan struct{}
+
+	statesMu sync.Mutex
+	states   map[string]*jobState // Keyed by job name
+
+	draining chan struct{}  // Closed by Drain, guarded by mu
+	runs     sync.WaitGroup // Runs and catch-ups in progress
+}
+
+// jobState tracks in-flight runs of one job for its overlap policy.
+type jobState struct {
+	mu      sync.Mutex
+	running int
+	queued  int
 }
 
 // New creates a scheduler with the given jobs and run function.
 func New(jobs []Job, runFn RunFunc, verbose bool) *Scheduler {
 	return &Scheduler{
-		jobs:    jobs,
-		runFn:   runFn,
-		verbose: verbose,
+		jobs:     jobs,
+		runFn:    runFn,
+		verbose:  verbose,
+		history:  NewMemoryHistory(500),
+		states:   make(map[string]*jobState),
+		wake:     make(chan struct{}, 1),
+		draining: make(chan struct{}),
 	}
 }
 
-// Start begins the scheduler loop. It checks jobs every minute.
+// SetMetrics records job outcomes in m.
+func (s *Scheduler) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
+}
+
+// SetNotifier delivers job results to each job's Notify targets.
+func (s *Scheduler) SetNotifier(n *notify.Notifier) {
+	s.notify = n
+}
+
+// SetHistory replaces the default in-memory run history.
+func (s *Scheduler) SetHistory(h HistoryStore) {
+	s.history = h
+}
+
+// SetStore adds the jobs in st to the schedule and persists runtime job
+// changes there, such as one-shot "@at" jobs disabling themselves after
+// they fire. Jobs added to or removed from the store while running are
+// picked up automatically. Call before Start.
+func (s *Scheduler) SetStore(st *Store) {
+	s.store = st
+	st.OnChange(s.poke)
+	s.reloadStore(true)
+}
+
+// SetJobs replaces the configured jobs, e.g. after the config file is
+// reloaded. Jobs whose schedule is unchanged keep their next fire time;
+// runs in progress are not affected.
+func (s *Scheduler) SetJobs(jobs []Job) {
+	s.mu.Lock()
+	s.jobs = jobs
+	s.mu.Unlock()
+	s.poke()
+}
+
+// Start begins the scheduler loop. It sleeps until the next job is due.
 func (s *Scheduler) Start(ctx context.Context) {
 	s.mu.Lock()
 	if s.running {
@@ -66,6 +165,52 @@ func (s *Scheduler) Stop() {
 	s.running = false
 }
 
+// Drain stops firing jobs and waits for the runs in progress to finish.
+// Runs queued by OverlapQueue, missed runs not yet caught up, and retries
+// not yet started are dropped. If ctx is done first Drain returns its
+// error; Stop then cancels the runs still going.
+func (s *Scheduler) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.drained() {
+		close(s.draining)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drained reports whether Drain has been called.
+func (s *Scheduler) drained() bool {
+	select {
+	case <-s.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// track counts a new run in progress for Drain, unless the scheduler is
+// draining. The caller must call s.runs.Done when it reports true.
+func (s *Scheduler) track() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.drained() {
+		return false
+	}
+	s.runs.Add(1)
+	return true
+}
+
 // Running returns whether the scheduler is active.
 func (s *Scheduler) Running() bool {
 	s.mu.Lock()
@@ -73,55 +218,346 @@ func (s *Scheduler) Running() bool {
 	return s.running
 }
 
-func (s *Scheduler) loop(ctx context.Context) {
-	// Track last run time per job to avoid double-firing
-	lastRun := make(map[string]time.Time)
+// storePoll is how often the loop checks the store file for changes made
+// by other processes (e.g. the schedule tool in `teeny chat`).
+const storePoll = 15 * time.Second
+
+// entry is a scheduled job and its next fire time (zero = never).
+type entry struct {
+	job   Job
+	sched Schedule
+	next  time.Time
+}
 
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+// loop sleeps until the earliest next fire time, runs every job that is
+// due, and repeats. Store changes wake it to re-plan.
+func (s *Scheduler) loop(ctx context.Context) {
+	s.reloadStore(true)
+	entries := s.plan(ctx, nil, time.Now())
 
-	// Check immediately on start
-	s.checkJobs(ctx, lastRun)
+	var poll <-chan time.Time
+	if s.store != nil {
+		ticker := time.NewTicker(storePoll)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
 
 	for {
+		var wake time.Time
+		for _, e := range entries {
+			if !e.next.IsZero() && (wake.IsZero() || e.next.Before(wake)) {
+				wake = e.next
+			}
+		}
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !wake.IsZero() {
+			timer = time.NewTimer(time.Until(wake))
+			due = timer.C
+		}
+
 		select {
 		case <-ctx.Done():
+		case <-s.draining:
+		case <-s.wake:
+			s.reloadStore(true)
+			entries = s.plan(ctx, entries, time.Now())
+		case <-poll:
+			if s.reloadStore(false) {
+				entries = s.plan(ctx, entries, time.Now())
+			}
+		case <-due:
+			now := time.Now()
+			for name, e := range entries {
+				if e.next.IsZero() || e.next.After(now) {
+					continue
+				}
+				e.next = e.sched.Next(now)
+				if e.next.IsZero() {
+					s.expire(name) // Before running, so a crash mid-run can't fire it twice
+				}
+				s.fire(ctx, e.job)
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil || s.drained() {
 			return
-		case <-ticker.C:
-			s.checkJobs(ctx, lastRun)
 		}
 	}
 }
 
-func (s *Scheduler) checkJobs(ctx context.Context, lastRun map[string]time.Time) {
-	now := time.Now()
-	for _, job := range s.jobs {
+// plan builds the schedule for all enabled jobs. Entries in prev whose
+// schedule is unchanged keep their next fire time. On the first plan
+// (prev == nil) interval jobs fire immediately and missed runs are caught
+// up; jobs added later wait for their first slot.
+func (s *Scheduler) plan(ctx context.Context, prev map[string]*entry, now time.Time) map[string]*entry {
+	startup := prev == nil
+	entries := make(map[string]*entry)
+	for _, job := range s.Jobs() {
 		if !job.Enabled {
 			continue
 		}
-		last, ok := lastRun[job.Name]
-		if ok && !shouldRun(job.Schedule, last, now) {
+		if _, dup := entries[job.Name]; dup {
+			log.Printf("[scheduler] job %q: duplicate name, ignoring", job.Name)
 			continue
 		}
-		if !ok && !shouldRunInitial(job.Schedule, now) {
-			// For interval-based, run on first check; for cron, check alignment
-			lastRun[job.Name] = now
+		if old, ok := prev[job.Name]; ok && old.job.Schedule == job.Schedule {
+			old.job = job
+			entries[job.Name] = old
 			continue
 		}
+		sched, err := validate(job)
+		if err != nil {
+			log.Printf("[scheduler] job %q: %v", job.Name, err)
+			continue
+		}
+		e := &entry{job: job, sched: sched, next: sched.Next(now)}
+		entries[job.Name] = e
+		if _, ok := sched.(interval); ok && startup {
+			e.next = now // Interval jobs run immediately on start
+		}
+		if !startup {
+			continue
+		}
+		missed := s.missedRuns(job, sched, now)
+		if _, ok := sched.(at); ok && e.next.IsZero() {
+			s.expire(job.Name) // Past due: it has fired, is being caught up, or was missed
+		}
+		if missed > 0 && s.track() {
+			go func() {
+				defer s.runs.Done()
+				s.catchUp(ctx, job, missed)
+			}()
+		}
+	}
+	return entries
+}
+
+// validate checks a job's settings and parses its schedule.
+func validate(job Job) (Schedule, error) {
+	sched, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	switch job.Overlap {
+	case "", OverlapSkip, OverlapQueue, OverlapParallel:
+	default:
+		return nil, fmt.Errorf("unknown overlap policy %q", job.Overlap)
+	}
+	if job.RetryBackoff != "" {
+		if _, err := time.ParseDuration(job.RetryBackoff); err != nil {
+			return nil, fmt.Errorf("invalid retry_backoff: %w", err)
+		}
+	}
+	return sched, nil
+}
+
+// Jobs returns the configured jobs followed by those from the store.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(slices.Clone(s.jobs), s.stored...)
+}
+
+// reloadStore re-reads the store's jobs. Unless force is set, it only
+// does so when the file changed since the last load. It reports whether
+// jobs were reloaded.
+func (s *Scheduler) reloadStore(force bool) bool {
+	if s.store == nil {
+		return false
+	}
+	mod := s.store.modTime()
+	s.mu.Lock()
+	unchanged := mod.Equal(s.storeMod)
+	s.mu.Unlock()
+	if unchanged && !force {
+		return false
+	}
+	jobs, err := s.store.Jobs()
+	if err != nil {
+		log.Printf("[scheduler] reload store: %v", err)
+		return false
+	}
+	s.mu.Lock()
+	s.stored, s.storeMod = jobs, mod
+	s.mu.Unlock()
+	return true
+}
+
+// poke wakes the loop to re-plan.
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// expire disables the named job after its schedule has no more fire
+// times, and persists that so it stays disabled across restarts.
+func (s *Scheduler) expire(name string) {
+	s.mu.Lock()
+	for _, jobs := range [][]Job{s.jobs, s.stored} {
+		for i := range jobs {
+			if jobs[i].Name == name {
+				jobs[i].Enabled = false
+			}
+		}
+	}
+	s.mu.Unlock()
+	if s.store == nil {
+		return
+	}
+	if err := s.store.Disable(name); err != nil {
+		log.Printf("[scheduler] job %q: disable: %v", name, err)
+	}
+}
+
+// missedRuns counts the slots of job that passed since its last recorded
+// run, capped at job.CatchUp. Recurring jobs with no history have missed
+// nothing; a one-shot job has missed its slot if it never ran after it.
+func (s *Scheduler) missedRuns(job Job, sched Schedule, now time.Time) int {
+	if job.CatchUp <= 0 {
+		return 0
+	}
+	runs, err := s.history.List(job.Name, 1)
+	if err != nil {
+		return 0
+	}
+	if when, ok := sched.(at); ok {
+		if !time.Time(when).After(now) && (len(runs) == 0 || runs[0].Start.Before(time.Time(when))) {
+			return 1
+		}
+		return 0
+	}
+	if len(runs) == 0 {
+		return 0
+	}
+	n := 0
+	for t := sched.Next(runs[0].Start); !t.IsZero() && !t.After(now) && n < job.CatchUp; t = sched.Next(t) {
+		n++
+	}
+	return n
+}
+
+// catchUp replays n missed runs of job one after another. The replay
+// counts as a running instance for the job's overlap policy.
+func (s *Scheduler) catchUp(ctx context.Context, job Job, n int) {
+	log.Printf("[scheduler] job %q missed %d run(s), catching up", job.Name, n)
+	st := s.state(job.Name)
+	st.mu.Lock()
+	st.running++
+	st.mu.Unlock()
+	defer s.finish(ctx, job, st)
+
+	for range n {
+		if ctx.Err() != nil || s.drained() {
+			return
+		}
+		s.runJob(ctx, job)
+	}
+}
+
+// fire starts a run of job in the background, applying its overlap policy.
+func (s *Scheduler) fire(ctx context.Context, job Job) {
+	st := s.state(job.Name)
+	st.mu.Lock()
+	if st.running > 0 {
+		switch job.Overlap {
+		case OverlapQueue:
+			if st.queued < maxQueued {
+				st.queued++
+			} else {
+				log.Printf("[scheduler] job %q queue full, dropping run", job.Name)
+			}
+			st.mu.Unlock()
+			return
+		case OverlapParallel:
+			if job.MaxParallel > 0 && st.running >= job.MaxParallel {
+				st.mu.Unlock()
+				log.Printf("[scheduler] job %q at %d parallel runs, skipping", job.Name, st.running)
+				return
+			}
+		default:
+			st.mu.Unlock()
+			if s.verbose {
+				log.Printf("[scheduler] job %q still running, skipping", job.Name)
+			}
+			return
+		}
+	}
+	if !s.track() {
+		st.mu.Unlock()
+		return
+	}
+	st.running++
+	st.mu.Unlock()
+
+	go func() {
+		defer s.runs.Done()
+		defer s.finish(ctx, job, st)
+		s.runJob(ctx, job)
+	}()
+}
+
+// finish releases a run slot, first draining any runs queued behind it.
+func (s *Scheduler) finish(ctx context.Context, job Job, st *jobState) {
+	for {
+		st.mu.Lock()
+		if st.queued == 0 || ctx.Err() != nil || s.drained() {
+			st.queued = 0
+			st.running--
+			st.mu.Unlock()
+			return
+		}
+		st.queued--
+		st.mu.Unlock()
+		s.runJob(ctx, job)
+	}
+}
 
-		lastRun[job.Name] = now
-		go s.runJob(ctx, job)
+func (s *Scheduler) state(name string) *jobState {
+	s.statesMu.Lock()
+	defer s.statesMu.Unlock()
+	st, ok := s.states[name]
+	if !ok {
+		st = &jobState{}
+		s.states[name] = st
 	}
+	return st
 }
 
 func (s *Scheduler) runJob(ctx context.Context, job Job) {
-	if s.verbose {
-		log.Printf("[scheduler] running job %q session=%s", job.Name, job.Session)
+	var result string
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		result, err = s.attempt(ctx, job, attempts)
+		if err == nil || attempts > job.Retries || ctx.Err() != nil || s.drained() {
+			break
+		}
+		delay := job.retryDelay(attempts)
+		log.Printf("[scheduler] job %q attempt %d failed: %v (retrying in %s)", job.Name, attempts, err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+		case <-s.draining:
+		case <-timer.C:
+		}
+		timer.Stop()
+		if ctx.Err() != nil || s.drained() {
+			break
+		}
 	}
 
-	result, err := s.runFn(ctx, job.Session, job.Prompt)
+	s.deliver(ctx, job, result, err)
 	if err != nil {
 		log.Printf("[scheduler] job %q error: %v", job.Name, err)
+		if ctx.Err() == nil {
+			s.alert(ctx, job, attempts, err)
+		}
 		return
 	}
 
@@ -130,36 +566,146 @@ func (s *Scheduler) runJob(ctx context.Context, job Job) {
 	}
 }
 
-// shouldRun checks if a job should run based on schedule and last run time.
-// Supports "@every <duration>" and standard 5-field cron expressions.
-func shouldRun(schedule string, last, now time.Time) bool {
-	// Try interval first
-	if interval, err := parseInterval(schedule); err == nil {
-		return now.Sub(last) >= interval
+// attempt runs job once, recording metrics and history.
+func (s *Scheduler) attempt(ctx context.Context, job Job, n int) (string, error) {
+	if s.verbose {
+		log.Printf("[scheduler] running job %q session=%s attempt=%d", job.Name, job.Session, n)
 	}
+	u := &usage{}
+	start := time.Now()
+	result, err := s.runFn(WithJob(context.WithValue(ctx, usageKey{}, u), job), job.Session, job.Prompt)
+	s.metrics.ObserveJob(job.Name, err)
+	s.record(job, n, start, result, err, u)
+	return result, err
+}
+
+type jobKey struct{}
+
+// WithJob records the job a run belongs to.
+func WithJob(ctx context.Context, job Job) context.Context {
+	return context.WithValue(ctx, jobKey{}, job)
+}
+
+// JobFrom returns the job a RunFunc call was started for. It reports false
+// outside a scheduled run.
+func JobFrom(ctx context.Context) (Job, bool) {
+	job, ok := ctx.Value(jobKey{}).(Job)
+	return job, ok
+}
 
-	// Try cron expression
-	if cron, err := ParseCron(schedule); err == nil {
-		// Only fire if current minute matches AND we haven't run this minute
-		truncNow := now.Truncate(time.Minute)
-		truncLast := last.Truncate(time.Minute)
-		return cron.Matches(now) && truncNow.After(truncLast)
+// retryDelay is the wait before retry number n (1-based).
+func (j Job) retryDelay(n int) time.Duration {
+	d := defaultBackoff
+	if j.RetryBackoff != "" {
+		if parsed, err := time.ParseDuration(j.RetryBackoff); err == nil {
+			d = parsed
+		}
+	}
+	for i := 1; i < n && d < maxBackoff; i++ {
+		d *= 2
 	}
+	return min(d, maxBackoff)
+}
 
-	return false
+// record adds a finished run to the history store.
+func (s *Scheduler) record(job Job, attempt int, start time.Time, result string, runErr error, u *usage) {
+	r := RunRecord{
+		Job:          job.Name,
+		Session:      job.Session,
+		Attempt:      attempt,
+		Start:        start,
+		DurationMs:   time.Since(start).Milliseconds(),
+		Result:       truncate(result, resultSnippet),
+		InputTokens:  u.input,
+		OutputTokens: u.output,
+		CostUSD:      u.cost,
+	}
+	if runErr != nil {
+		r.Error = runErr.Error()
+	}
+	if err := s.history.Record(r); err != nil {
+		log.Printf("[scheduler] job %q history: %v", job.Name, err)
+	}
 }
 
-// shouldRunInitial returns true for first-time check.
-// For intervals: always true (run immediately).
-// For cron: true only if current time matches the expression.
-func shouldRunInitial(schedule string, now time.Time) bool {
-	if _, err := parseInterval(schedule); err == nil {
-		return true
+// deliver sends a job's result, or its error, to the job's notify targets.
+func (s *Scheduler) deliver(ctx context.Context, job Job, result string, runErr error) {
+	if s.notify == nil || len(job.Notify) == 0 {
+		return
+	}
+	r := notify.Result{Job: job.Name, Session: job.Session, Output: result}
+	if runErr != nil {
+		r.Error = runErr.Error()
+	}
+	if err := s.notify.Deliver(ctx, job.Notify, r); err != nil {
+		log.Printf("[scheduler] job %q delivery: %v", job.Name, err)
+	}
+}
+
+// alert tells the job's on_failure targets that every attempt failed.
+func (s *Scheduler) alert(ctx context.Context, job Job, attempts int, runErr error) {
+	if s.notify == nil || len(job.OnFailure) == 0 {
+		return
+	}
+	r := notify.Result{
+		Job:     job.Name,
+		Session: job.Session,
+		Error:   fmt.Sprintf("failed after %d attempt(s): %v", attempts, runErr),
+	}
+	if err := s.notify.Deliver(ctx, job.OnFailure, r); err != nil {
+		log.Printf("[scheduler] job %q failure alert: %v", job.Name, err)
+	}
+}
+
+// Schedule computes when a job fires next.
+type Schedule interface {
+	// Next returns the first fire time strictly after after, or the zero
+	// time if the schedule never fires again.
+	Next(after time.Time) time.Time
+}
+
+// ParseSchedule parses "@every <duration>", "@at <RFC 3339 time>", a cron
+// expression, or a cron macro such as "@daily".
+func ParseSchedule(schedule string) (Schedule, error) {
+	if ts, ok := strings.CutPrefix(schedule, "@at "); ok {
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(ts))
+		if err != nil {
+			return nil, fmt.Errorf("invalid @at time (want RFC 3339, e.g. 2026-03-01T09:00:00Z): %w", err)
+		}
+		return at(t), nil
 	}
-	if cron, err := ParseCron(schedule); err == nil {
-		return cron.Matches(now)
+	if strings.HasPrefix(schedule, "@every ") {
+		d, err := parseInterval(schedule)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("interval must be positive: %s", schedule)
+		}
+		return interval(d), nil
+	}
+	cron, err := ParseCron(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported schedule %q: %w", schedule, err)
+	}
+	return cron, nil
+}
+
+// interval is an "@every <duration>" schedule.
+type interval time.Duration
+
+func (d interval) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(d))
+}
+
+// at is a one-shot "@at <time>" schedule.
+type at time.Time
+
+func (t at) Next(after time.Time) time.Time {
+	if when := time.Time(t); when.After(after) {
+		return when
 	}
-	return false
+	return time.Time{}
 }
 
 // parseInterval parses "@every 30m" style schedules.
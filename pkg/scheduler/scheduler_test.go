@@ -2,9 +2,15 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/notify"
 )
 
 func TestParseInterval(t *testing.T) {
@@ -35,17 +41,43 @@ func TestParseInterval(t *testing.T) {
 	}
 }
 
-func TestShouldRun(t *testing.T) {
-	now := time.Now()
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2026, 2, 17, 10, 0, 30, 0, time.UTC)
+	tests := []struct {
+		schedule string
+		want     time.Time
+	}{
+		{"@every 30m", now.Add(30 * time.Minute)},
+		{"0 10 * * *", time.Date(2026, 2, 18, 10, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 2, 17, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * * *", time.Date(2026, 2, 17, 10, 0, 45, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		sched, err := ParseSchedule(tt.schedule)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.schedule, err)
+			continue
+		}
+		if got := sched.Next(now); !got.Equal(tt.want) {
+			t.Errorf("%q.Next = %v, want %v", tt.schedule, got, tt.want)
+		}
+	}
 
-	// Should run: 31 minutes since last
-	if !shouldRun("@every 30m", now.Add(-31*time.Minute), now) {
-		t.Error("expected shouldRun=true after 31m with 30m interval")
+	at, err := ParseSchedule("@at 2026-02-17T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := at.Next(now); !got.Equal(time.Date(2026, 2, 17, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("@at.Next before = %v", got)
+	}
+	if got := at.Next(now.Add(3 * time.Hour)); !got.IsZero() {
+		t.Errorf("@at.Next after = %v, want zero", got)
 	}
 
-	// Should not run: 10 minutes since last
-	if shouldRun("@every 30m", now.Add(-10*time.Minute), now) {
-		t.Error("expected shouldRun=false after 10m with 30m interval")
+	for _, bad := range []string{"@every -5m", "@every soon", "@fortnightly", "invalid", "@at tomorrow"} {
+		if _, err := ParseSchedule(bad); err == nil {
+			t.Errorf("ParseSchedule(%q) expected error", bad)
+		}
 	}
 }
 
@@ -131,6 +163,368 @@ func TestSchedulerSkipsDisabledJob(t *testing.T) {
 	}
 }
 
+func TestRunJobNotifies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.md")
+	runFn := func(ctx context.Context, session, prompt string) (string, error) {
+		return "report", nil
+	}
+	s := New(nil, runFn, false)
+	s.SetNotifier(notify.New(notify.SMTPConfig{}))
+
+	s.runJob(context.Background(), Job{Name: "daily", Session: "s", Notify: []notify.Target{{File: path}}})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "[teeny] daily") || !strings.Contains(string(data), "report") {
+		t.Errorf("delivered %q", data)
+	}
+}
+
+func TestRunJobRecordsHistory(t *testing.T) {
+	runFn := func(ctx context.Context, session, prompt string) (string, error) {
+		ReportUsage(ctx, 100, 20, 0.5)
+		if prompt == "fail" {
+			return "", errors.New("provider down")
+		}
+		return strings.Repeat("x", 1000), nil
+	}
+	s := New(nil, runFn, false)
+	s.runJob(context.Background(), Job{Name: "nightly", Session: "n", Prompt: "ok"})
+	s.runJob(context.Background(), Job{Name: "other", Session: "o", Prompt: "ok"})
+	s.runJob(context.Background(), Job{Name: "nightly", Session: "n", Prompt: "fail"})
+
+	runs, err := s.History("nightly", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("runs = %+v", runs)
+	}
+	if runs[0].Error != "provider down" || runs[1].Error != "" {
+		t.Errorf("expected newest (failed) run first: %+v", runs)
+	}
+	if len(runs[1].Result) != resultSnippet+3 || runs[1].InputTokens != 100 || runs[1].OutputTokens != 20 || runs[1].CostUSD != 0.5 || runs[1].Start.IsZero() {
+		t.Errorf("run = %+v", runs[1])
+	}
+	if all, _ := s.History("", 0); len(all) != 3 {
+		t.Errorf("all runs = %d, want 3", len(all))
+	}
+}
+
+func TestMissedRuns(t *testing.T) {
+	now := time.Date(2026, 2, 17, 10, 30, 0, 0, time.UTC)
+	sched, _ := ParseSchedule("0 * * * *") // Hourly
+	s := New(nil, nil, false)
+	s.history.Record(RunRecord{Job: "hourly", Start: now.Add(-5*time.Hour - 30*time.Minute)}) // 05:00
+
+	tests := []struct {
+		job  Job
+		want int
+	}{
+		{Job{Name: "hourly"}, 0},              // catch_up not set
+		{Job{Name: "hourly", CatchUp: 1}, 1},  // Fire once
+		{Job{Name: "hourly", CatchUp: 10}, 5}, // 06:00 through 10:00
+		{Job{Name: "never-ran", CatchUp: 3}, 0},
+	}
+	for _, tt := range tests {
+		if got := s.missedRuns(tt.job, sched, now); got != tt.want {
+			t.Errorf("missedRuns(%+v) = %d, want %d", tt.job, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerCatchesUp(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	runFn := func(ctx context.Context, session, prompt string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return "ok", nil
+	}
+	job := Job{Name: "daily", Schedule: "@daily", Session: "d", Enabled: true, CatchUp: 2}
+	s := New([]Job{job}, runFn, false)
+	s.history.Record(RunRecord{Job: "daily", Start: time.Now().AddDate(0, 0, -3)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := calls
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("calls = %d, want 2 catch-up runs", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Stop()
+}
+
+func TestFireOverlap(t *testing.T) {
+	tests := []struct {
+		overlap     string
+		maxParallel int
+		want        int // Runs started for 4 fires while the first blocks
+	}{
+		{"", 0, 1},
+		{OverlapSkip, 0, 1},
+		{OverlapQueue, 0, 4},
+		{OverlapParallel, 0, 4},
+		{OverlapParallel, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overlap, func(t *testing.T) {
+			var mu sync.Mutex
+			var started, peak, active int
+			release := make(chan struct{})
+			runFn := func(ctx context.Context, session, prompt string) (string, error) {
+				mu.Lock()
+				started++
+				active++
+				peak = max(peak, active)
+				mu.Unlock()
+				<-release
+				mu.Lock()
+				active--
+				mu.Unlock()
+				return "ok", nil
+			}
+			s := New(nil, runFn, false)
+			job := Job{Name: "slow", Overlap: tt.overlap, MaxParallel: tt.maxParallel}
+			for range 4 {
+				s.fire(context.Background(), job)
+			}
+			close(release)
+
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				runs, _ := s.History("slow", 0)
+				if len(runs) >= tt.want || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond) // Let any extra runs show up
+
+			mu.Lock()
+			defer mu.Unlock()
+			if started != tt.want {
+				t.Errorf("started = %d, want %d", started, tt.want)
+			}
+			if tt.overlap == OverlapQueue && peak != 1 {
+				t.Errorf("queued runs overlapped: peak = %d", peak)
+			}
+		})
+	}
+}
+
+func TestDrain(t *testing.T) {
+	var mu sync.Mutex
+	started := 0
+	release := make(chan struct{})
+	runFn := func(ctx context.Context, session, prompt string) (string, error) {
+		mu.Lock()
+		started++
+		mu.Unlock()
+		<-release
+		return "ok", nil
+	}
+	s := New(nil, runFn, false)
+	job := Job{Name: "slow", Overlap: OverlapQueue}
+	s.fire(context.Background(), job)
+	s.fire(context.Background(), job) // Queued behind the first
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain with a run in progress: err = %v, want deadline exceeded", err)
+	}
+
+	s.fire(context.Background(), job) // Ignored while draining
+	close(release)
+	if err := s.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if started != 1 {
+		t.Errorf("started = %d, want 1 (queued and new runs dropped)", started)
+	}
+}
+
+func TestRunJobRetries(t *testing.T) {
+	dir := t.TempDir()
+	failures := 2
+	var calls int
+	runFn := func(ctx context.Context, session, prompt string) (string, error) {
+		calls++
+		if calls <= failures {
+			return "", errors.New("flaky")
+		}
+		return "ok", nil
+	}
+	s := New(nil, runFn, false)
+	s.SetNotifier(notify.New(notify.SMTPConfig{}))
+	alerts := filepath.Join(dir, "alerts.md")
+	job := Job{Name: "flaky", Retries: 2, RetryBackoff: "1ms", OnFailure: []notify.Target{{File: alerts}}}
+
+	// Succeeds on the third attempt: no alert.
+	s.runJob(context.Background(), job)
+	runs, _ := s.History("flaky", 0)
+	if calls != 3 || len(runs) != 3 || runs[0].Attempt != 3 || runs[0].Error != "" || runs[2].Attempt != 1 {
+		t.Fatalf("calls = %d, runs = %+v", calls, runs)
+	}
+	if _, err := os.Stat(alerts); err == nil {
+		t.Error("unexpected failure alert")
+	}
+
+	// Fails every attempt: alert once.
+	calls, failures = 0, 10
+	s.runJob(context.Background(), job)
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+	data, err := os.ReadFile(alerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "failed after 3 attempt(s): flaky") {
+		t.Errorf("alert = %q", data)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		backoff string
+		n       int
+		want    time.Duration
+	}{
+		{"", 1, 30 * time.Second},
+		{"", 3, 2 * time.Minute},
+		{"10s", 2, 20 * time.Second},
+		{"45m", 3, time.Hour}, // Capped
+	}
+	for _, tt := range tests {
+		if got := (Job{RetryBackoff: tt.backoff}).retryDelay(tt.n); got != tt.want {
+			t.Errorf("retryDelay(%q, %d) = %v, want %v", tt.backoff, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestOneShotJob(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daemon.json")
+	job := Job{Name: "remind", Schedule: "@at " + time.Now().Add(200*time.Millisecond).Format(time.RFC3339Nano), Session: "r", Prompt: "follow up", Enabled: true}
+	SaveDaemonConfig(path, &DaemonConfig{Jobs: []Job{job}})
+
+	runs := make(chan string, 2)
+	runFn := func(ctx context.Context, session, prompt string) (string, error) {
+		runs <- prompt
+		return "ok", nil
+	}
+	s := New([]Job{job}, runFn, false)
+	s.SetStore(NewStore(path))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	select {
+	case p := <-runs:
+		if p != "follow up" {
+			t.Errorf("prompt = %q", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("one-shot job did not fire")
+	}
+	s.Stop()
+
+	cfg, err := LoadDaemonConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Jobs[0].Enabled {
+		t.Error("one-shot job still enabled in store")
+	}
+}
+
+func TestStoreJobsAddedWhileRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daemon.json")
+	runs := make(chan string, 4)
+	runFn := func(ctx context.Context, session, prompt string) (string, error) {
+		runs <- session
+		return "ok", nil
+	}
+	st := NewStore(path)
+	s := New(nil, runFn, false)
+	s.SetStore(st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+	defer s.Stop()
+
+	when := time.Now().Add(100 * time.Millisecond).Format(time.RFC3339Nano)
+	if err := st.Add(Job{Name: "later", Schedule: "@at " + when, Session: "added", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case session := <-runs:
+		if session != "added" {
+			t.Errorf("session = %q", session)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job added to the store did not fire")
+	}
+
+	if jobs := s.Jobs(); len(jobs) != 1 || jobs[0].Enabled {
+		t.Errorf("jobs = %+v", jobs)
+	}
+}
+
+func TestSetJobs(t *testing.T) {
+	runs := make(chan string, 4)
+	runFn := func(ctx context.Context, session, prompt string) (string, error) {
+		runs <- session
+		return "ok", nil
+	}
+	s := New(nil, runFn, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+	defer s.Stop()
+
+	when := time.Now().Add(100 * time.Millisecond).Format(time.RFC3339Nano)
+	s.SetJobs([]Job{{Name: "reloaded", Schedule: "@at " + when, Session: "new", Enabled: true}})
+	select {
+	case session := <-runs:
+		if session != "new" {
+			t.Errorf("session = %q", session)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job set while running did not fire")
+	}
+}
+
+func TestMissedOneShot(t *testing.T) {
+	now := time.Date(2026, 2, 17, 10, 0, 0, 0, time.UTC)
+	sched, _ := ParseSchedule("@at 2026-02-17T09:00:00Z")
+	job := Job{Name: "remind", CatchUp: 1}
+
+	s := New(nil, nil, false)
+	if got := s.missedRuns(job, sched, now); got != 1 {
+		t.Errorf("never ran: missed = %d, want 1", got)
+	}
+	s.history.Record(RunRecord{Job: "remind", Start: time.Date(2026, 2, 17, 9, 0, 0, 0, time.UTC)})
+	if got := s.missedRuns(job, sched, now); got != 0 {
+		t.Errorf("already ran: missed = %d, want 0", got)
+	}
+}
+
 func TestTruncate(t *testing.T) {
 	if got := truncate("hello", 10); got != "hello" {
 		t.Errorf("truncate short: %q", got)
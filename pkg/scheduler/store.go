@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store persists runtime changes to jobs in a daemon config file
+// (daemon.json): jobs the agent schedules for itself, and one-shot jobs
+// disabling themselves after they fire.
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	onChange []func()
+}
+
+// NewStore returns a store backed by the daemon config file at path.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// OnChange registers fn to be called after the store is written.
+func (st *Store) OnChange(fn func()) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.onChange = append(st.onChange, fn)
+}
+
+// Jobs returns the jobs in the file. A missing file has no jobs.
+func (st *Store) Jobs() ([]Job, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	cfg, err := LoadDaemonConfig(st.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: load %s: %w", st.path, err)
+	}
+	return cfg.Jobs, nil
+}
+
+// Add appends job. Names must be unique within the file.
+func (st *Store) Add(job Job) error {
+	return st.AddIf(job, nil)
+}
+
+// AddIf appends job if check accepts the jobs already in the file. The
+// check and the write happen under one lock, so limits it enforces hold
+// against concurrent adds. A nil check accepts anything.
+func (st *Store) AddIf(job Job, check func(jobs []Job) error) error {
+	var failed error
+	err := st.update(func(cfg *DaemonConfig) bool {
+		for _, j := range cfg.Jobs {
+			if j.Name == job.Name {
+				failed = fmt.Errorf("scheduler: job %q already exists", job.Name)
+				return false
+			}
+		}
+		if check != nil {
+			if failed = check(cfg.Jobs); failed != nil {
+				return false
+			}
+		}
+		cfg.Jobs = append(cfg.Jobs, job)
+		return true
+	})
+	if err == nil {
+		err = failed
+	}
+	return err
+}
+
+// Remove deletes the named job if match accepts it, and reports whether
+// a job was removed. A nil match accepts any job.
+func (st *Store) Remove(name string, match func(Job) bool) (bool, error) {
+	removed := false
+	err := st.update(func(cfg *DaemonConfig) bool {
+		for i, j := range cfg.Jobs {
+			if j.Name == name && (match == nil || match(j)) {
+				cfg.Jobs = append(cfg.Jobs[:i], cfg.Jobs[i+1:]...)
+				removed = true
+				return true
+			}
+		}
+		return false
+	})
+	return removed, err
+}
+
+// Disable marks the named job disabled. Jobs not in the file (e.g.
+// declared in the main config) are left alone.
+func (st *Store) Disable(name string) error {
+	return st.update(func(cfg *DaemonConfig) bool {
+		changed := false
+		for i := range cfg.Jobs {
+			if cfg.Jobs[i].Name == name && cfg.Jobs[i].Enabled {
+				cfg.Jobs[i].Enabled = false
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+// update loads the file, applies fn, and writes it back if fn reports a
+// change. A missing file is treated as empty.
+func (st *Store) update(fn func(cfg *DaemonConfig) bool) error {
+	st.mu.Lock()
+	cfg, err := LoadDaemonConfig(st.path)
+	if os.IsNotExist(err) {
+		cfg, err = &DaemonConfig{}, nil
+	}
+	if err != nil {
+		st.mu.Unlock()
+		return fmt.Errorf("scheduler: load %s: %w", st.path, err)
+	}
+	if !fn(cfg) {
+		st.mu.Unlock()
+		return nil
+	}
+	err = SaveDaemonConfig(st.path, cfg)
+	listeners := st.onChange
+	st.mu.Unlock()
+
+	if err == nil {
+		for _, fn := range listeners {
+			fn()
+		}
+	}
+	return err
+}
+
+// modTime returns the file's modification time, or zero if it is missing.
+func (st *Store) modTime() time.Time {
+	info, err := os.Stat(st.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// SaveDaemonConfig writes cfg to path atomically.
+func SaveDaemonConfig(path string, cfg *DaemonConfig) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("scheduler: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("scheduler: write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("scheduler: write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestStoreDisable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daemon.json")
+	err := SaveDaemonConfig(path, &DaemonConfig{
+		PidFile: "/tmp/teeny.pid",
+		Jobs: []Job{
+			{Name: "remind", Schedule: "@at 2026-03-01T09:00:00Z", Enabled: true},
+			{Name: "daily", Schedule: "@daily", Enabled: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewStore(path)
+	if err := st.Disable("remind"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Disable("not-in-file"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadDaemonConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PidFile != "/tmp/teeny.pid" || len(cfg.Jobs) != 2 {
+		t.Fatalf("config = %+v", cfg)
+	}
+	if cfg.Jobs[0].Enabled || !cfg.Jobs[1].Enabled {
+		t.Errorf("jobs = %+v", cfg.Jobs)
+	}
+}
+
+func TestStoreMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daemon.json")
+	if err := NewStore(path).Disable("x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Disable with no change should not create the file")
+	}
+}
+
+func TestStoreAddRemove(t *testing.T) {
+	st := NewStore(filepath.Join(t.TempDir(), "daemon.json"))
+	changes := 0
+	st.OnChange(func() { changes++ })
+
+	if err := st.Add(Job{Name: "a", CreatedBy: "agent"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Add(Job{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Add(Job{Name: "a"}); err == nil {
+		t.Error("expected duplicate name error")
+	}
+
+	agentOnly := func(j Job) bool { return j.CreatedBy == "agent" }
+	if removed, err := st.Remove("b", agentOnly); err != nil || removed {
+		t.Errorf("Remove(b) = %v, %v; want not removed", removed, err)
+	}
+	if removed, err := st.Remove("a", agentOnly); err != nil || !removed {
+		t.Errorf("Remove(a) = %v, %v", removed, err)
+	}
+
+	jobs, err := st.Jobs()
+	if err != nil || len(jobs) != 1 || jobs[0].Name != "b" {
+		t.Errorf("jobs = %+v, %v", jobs, err)
+	}
+	if changes != 3 {
+		t.Errorf("changes = %d, want 3", changes)
+	}
+}
+
+func TestStoreAddIf(t *testing.T) {
+	st := NewStore(filepath.Join(t.TempDir(), "daemon.json"))
+	atMostOne := func(jobs []Job) error {
+		if len(jobs) >= 1 {
+			return errors.New("full")
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			st.AddIf(Job{Name: fmt.Sprintf("job-%d", i)}, atMostOne)
+		}(i)
+	}
+	wg.Wait()
+	if jobs, _ := st.Jobs(); len(jobs) != 1 {
+		t.Errorf("jobs = %d, want 1", len(jobs))
+	}
+	if err := st.AddIf(Job{Name: "late"}, atMostOne); err == nil || err.Error() != "full" {
+		t.Errorf("AddIf past limit: err = %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ErrForbidden is returned, possibly wrapped, when a request's token may
+// not use a session.
+var ErrForbidden = errors.New("token may not use this session")
+
+// Token is a bearer token accepted by the API and what its requests may do.
+type Token struct {
+	Name     string
+	Secret   string   // The bearer token itself
+	Sessions []string // Session keys or globs it may run in and read (empty = all)
+	Profile  string   // Permission profile for its runs' tools, for the run function ("" = the session's)
+	Schedule bool     // May read job history and use the schedule tool
+	Reload   bool     // May reload the daemon's config
+}
+
+// AllowsSession reports whether the token may use the session key.
+func (t Token) AllowsSession(key string) bool {
+	if len(t.Sessions) == 0 {
+		return true
+	}
+	for _, pattern := range t.Sessions {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenCtx struct{}
+
+// TokenFrom returns the token that authenticated the request ctx belongs
+// to. ok is false when the server takes no tokens.
+func TokenFrom(ctx context.Context) (Token, bool) {
+	t, ok := ctx.Value(tokenCtx{}).(Token)
+	return t, ok
+}
+
+// Authorize returns ErrForbidden if the request's token may not use the
+// session key. Requests to a server without tokens may use any session.
+func Authorize(ctx context.Context, key string) error {
+	if t, ok := TokenFrom(ctx); ok && !t.AllowsSession(key) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// RequireTokens makes every request except GET /healthz and those to
+// Signed paths carry one of tokens as "Authorization: Bearer <token>".
+// Without tokens the API is open, which is only safe on localhost.
+func (s *Server) RequireTokens(tokens ...Token) {
+	s.tokens = tokens
+}
+
+// Signed exempts requests to path from RequireTokens, as its handler
+// checks a signature instead, the way webhook senders authenticate. Only
+// mark a path whose handler always does: an unsigned webhook still needs
+// a token.
+func (s *Server) Signed(path string) {
+	if s.signed == nil {
+		s.signed = make(map[string]bool)
+	}
+	s.signed[path] = true
+}
+
+// RequireSchedule wraps h so only tokens with Schedule may call it.
+func RequireSchedule(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := TokenFrom(r.Context()); ok && !t.Schedule {
+			http.Error(w, "token may not read jobs", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// authenticate serves requests that carry a known token, or need none.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if len(s.tokens) == 0 {
+		return next
+	}
+	// Hashes have equal length, so the comparison takes the same time
+	// whatever the token
+	sums := make([][32]byte, len(s.tokens))
+	for i, t := range s.tokens {
+		sums[i] = sha256.Sum256([]byte(t.Secret))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || s.signed[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		sum := sha256.Sum256([]byte(strings.TrimSpace(secret)))
+		match := -1
+		for i := range sums {
+			if subtle.ConstantTimeCompare(sum[:], sums[i][:]) == 1 {
+				match = i
+			}
+		}
+		if !ok || match < 0 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="teeny"`)
+			http.Error(w, "missing or unknown bearer token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenCtx{}, s.tokens[match])))
+	})
+}
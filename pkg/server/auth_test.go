@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequireTokens(t *testing.T) {
+	s := New("")
+	s.RequireTokens(
+		Token{Name: "ops", Secret: "s3cret", Schedule: true},
+		Token{Name: "bot", Secret: "b0t", Sessions: []string{"bot-*"}},
+	)
+	s.Handle("GET /whoami", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tok, _ := TokenFrom(r.Context())
+		w.Write([]byte(tok.Name))
+	}))
+	s.Handle("GET /v1/jobs/history", RequireSchedule(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("[]"))
+	})))
+	s.Handle("POST /v1/hooks/{name}", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	s.Handle("POST /v1/github", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	s.Signed("/v1/hooks/deploy")
+	s.Signed("/v1/github")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		want   int
+		body   string
+	}{
+		{"health is open", "GET", "/healthz", "", http.StatusOK, "ok\n"},
+		{"signed hooks are open", "POST", "/v1/hooks/deploy", "", http.StatusAccepted, ""},
+		{"unsigned hooks need a token", "POST", "/v1/hooks/open", "", http.StatusUnauthorized, ""},
+		{"unsigned hooks with a token", "POST", "/v1/hooks/open", "Bearer s3cret", http.StatusAccepted, ""},
+		{"signed github is open", "POST", "/v1/github", "", http.StatusAccepted, ""},
+		{"no token", "GET", "/whoami", "", http.StatusUnauthorized, ""},
+		{"unknown token", "GET", "/whoami", "Bearer nope", http.StatusUnauthorized, ""},
+		{"not bearer", "GET", "/whoami", "Basic s3cret", http.StatusUnauthorized, ""},
+		{"token", "GET", "/whoami", "Bearer s3cret", http.StatusOK, "ops"},
+		{"other token", "GET", "/whoami", "Bearer b0t", http.StatusOK, "bot"},
+		{"schedule scope", "GET", "/v1/jobs/history", "Bearer s3cret", http.StatusOK, "[]"},
+		{"no schedule scope", "GET", "/v1/jobs/history", "Bearer b0t", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		if rec.Code != tt.want || (tt.body != "" && rec.Body.String() != tt.body) {
+			t.Errorf("%s: %d %q, want %d %q", tt.name, rec.Code, rec.Body.String(), tt.want, tt.body)
+		}
+		if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate header", tt.name)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	if err := Authorize(context.Background(), "anything"); err != nil {
+		t.Errorf("without a token: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), tokenCtx{}, Token{Sessions: []string{"bot-*", "main"}})
+	for key, want := range map[string]bool{"bot-1": true, "main": true, "main-2": false, "coder:bot-1": false} {
+		if got := Authorize(ctx, key) == nil; got != want {
+			t.Errorf("Authorize(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestQuestionsScopedToToken(t *testing.T) {
+	q := NewQuestions()
+	s := New("")
+	s.RequireTokens(Token{Name: "bot", Secret: "b0t", Sessions: []string{"bot-*"}})
+	s.Handle("GET /v1/questions", q)
+	s.Handle("POST /v1/questions/{id}", q)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go q.Ask(ctx, "bot-1", "mine?")
+	go q.Ask(ctx, "ops", "theirs?")
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer b0t")
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		q.mu.Lock()
+		n := len(q.pending)
+		q.mu.Unlock()
+		if n == 2 {
+			break
+		}
+	}
+
+	var list []Question
+	json.Unmarshal(serve("GET", "/v1/questions", "").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Session != "bot-1" {
+		t.Fatalf("questions = %+v", list)
+	}
+	var other string
+	q.mu.Lock()
+	for id, pq := range q.pending {
+		if pq.Session == "ops" {
+			other = id
+		}
+	}
+	q.mu.Unlock()
+	if rec := serve("POST", "/v1/questions/"+other, `{"answer":"no"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("answering another session's question: status = %d", rec.Code)
+	}
+	if rec := serve("POST", "/v1/questions/"+list[0].ID, `{"answer":"yes"}`); rec.Code != http.StatusNoContent {
+		t.Errorf("answering own question: status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// DefaultModel is the model name the default agent is served as.
+const DefaultModel = "teeny"
+
+// ChatFunc runs prompt in sessionKey as the named agent ("" = default) and
+// returns the answer with the run's token usage. An empty sessionKey asks
+// for a stateless run: it starts from history, the conversation's earlier
+// turns, and keeps nothing afterwards. onEvent reports tool activity. An
+// error wrapping ErrForbidden means the request's token may not use the
+// session.
+type ChatFunc func(ctx context.Context, agent, sessionKey string, history []provider.Message, prompt string, onEvent func(loop.Event)) (string, provider.Usage, error)
+
+// Completions serves the agent behind an OpenAI-compatible API, so chat UIs
+// built for OpenAI can talk to it:
+//
+//	GET  /v1/models            lists the agents as models
+//	POST /v1/chat/completions  answers the conversation's last user message
+//
+// A request with an X-Session header names its conversation, which the
+// agent keeps in a session: only the last message is run, and the history,
+// system prompt, and tools are the agent's own. The session is "chat-" and
+// a hash of the request's token and the header, so clients with different
+// tokens never share one. Without the header the request is stateless: the
+// run starts from the earlier user and assistant messages it carries. With
+// "stream": true the answer is sent as server-sent events in one chunk
+// once the run finishes, not incrementally, with comments marking tool
+// calls while it works.
+type Completions struct {
+	run    ChatFunc
+	models []string
+	nextID atomic.Int64
+}
+
+// NewCompletions serves runs started by run. agents are the named agents
+// listed as models beside DefaultModel.
+func NewCompletions(run ChatFunc, agents ...string) *Completions {
+	return &Completions{run: run, models: append([]string{DefaultModel}, agents...)}
+}
+
+func (h *Completions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		h.listModels(w)
+		return
+	}
+	h.complete(w, r)
+}
+
+func (h *Completions) listModels(w http.ResponseWriter) {
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	list := struct {
+		Object string  `json:"object"`
+		Data   []model `json:"data"`
+	}{Object: "list"}
+	for _, name := range h.models {
+		list.Data = append(list.Data, model{ID: name, Object: "model", OwnedBy: "teeny"})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// chatMessage is an OpenAI chat message. Content is a string or a list of
+// parts, of which only text is used.
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+func (m chatMessage) text() string {
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(m.Content, &parts)
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func (h *Completions) complete(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Model    string        `json:"model"`
+		Messages []chatMessage `json:"messages"`
+		Stream   bool          `json:"stream"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHookBody)).Decode(&body); err != nil {
+		writeChatError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid body: %v", err))
+		return
+	}
+	var last string
+	n := len(body.Messages)
+	if n > 0 && body.Messages[n-1].Role == "user" {
+		last = body.Messages[n-1].text()
+	}
+	if strings.TrimSpace(last) == "" {
+		writeChatError(w, http.StatusBadRequest, "invalid_request_error", "the last message must be a user message with text")
+		return
+	}
+	model := cmp.Or(body.Model, DefaultModel)
+	if !slices.Contains(h.models, model) {
+		writeChatError(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("model %q does not exist", model))
+		return
+	}
+	agent := model
+	if agent == DefaultModel {
+		agent = ""
+	}
+	var sessionKey string
+	var history []provider.Message
+	if conversation := r.Header.Get("X-Session"); conversation != "" {
+		sessionKey = conversationKey(r.Context(), conversation)
+	} else {
+		history = priorTurns(body.Messages[:n-1])
+	}
+
+	c := chunker{
+		w:       w,
+		id:      fmt.Sprintf("chatcmpl-%d", h.nextID.Add(1)),
+		model:   model,
+		created: time.Now().Unix(),
+	}
+	if !body.Stream {
+		answer, usage, err := h.run(r.Context(), agent, sessionKey, history, last, nil)
+		if errors.Is(err, ErrForbidden) {
+			writeChatError(w, http.StatusForbidden, "permission_error", err.Error())
+			return
+		}
+		if err != nil {
+			writeChatError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, c.completion(answer, usage))
+		return
+	}
+
+	c.start()
+	answer, _, err := h.run(r.Context(), agent, sessionKey, history, last, func(e loop.Event) {
+		if e.Type == loop.EventToolStart {
+			c.comment("tool " + e.ToolCall.Name)
+		}
+	})
+	if err != nil {
+		c.fail(err)
+		return
+	}
+	c.finish(answer)
+}
+
+// conversationKey returns the session for the client's conversation ID,
+// scoped to the token the request came with.
+func conversationKey(ctx context.Context, conversation string) string {
+	var token string
+	if t, ok := TokenFrom(ctx); ok {
+		token = t.Name
+	}
+	sum := sha256.Sum256([]byte(token + "\x00" + conversation))
+	return "chat-" + hex.EncodeToString(sum[:8])
+}
+
+// priorTurns returns the text of the user and assistant messages in msgs,
+// for a stateless run. System messages are dropped: the agent has its own.
+func priorTurns(msgs []chatMessage) []provider.Message {
+	var out []provider.Message
+	for _, m := range msgs {
+		if m.Role != "user" && m.Role != "assistant" {
+			continue
+		}
+		if text := m.text(); text != "" {
+			out = append(out, provider.Message{Role: m.Role, Content: text})
+		}
+	}
+	return out
+}
+
+type chatError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func writeChatError(w http.ResponseWriter, status int, typ, msg string) {
+	writeJSON(w, status, map[string]chatError{"error": {Message: msg, Type: typ}})
+}
+
+// chunker writes a completion, whole or as a stream of chunks.
+type chunker struct {
+	w       http.ResponseWriter
+	id      string
+	model   string
+	created int64
+}
+
+func (c chunker) completion(answer string, usage provider.Usage) any {
+	return map[string]any{
+		"id":      c.id,
+		"object":  "chat.completion",
+		"created": c.created,
+		"model":   c.model,
+		"choices": []any{map[string]any{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": answer},
+			"finish_reason": "stop",
+		}},
+		"usage": map[string]int{
+			"prompt_tokens":     usage.PromptTokens,
+			"completion_tokens": usage.CompletionTokens,
+			"total_tokens":      usage.PromptTokens + usage.CompletionTokens,
+		},
+	}
+}
+
+// start sends the stream's headers and its first chunk, so the client
+// knows the run has begun.
+func (c chunker) start() {
+	c.w.Header().Set("Content-Type", "text/event-stream")
+	c.w.Header().Set("Cache-Control", "no-cache")
+	c.w.WriteHeader(http.StatusOK)
+	c.chunk(map[string]string{"role": "assistant"}, nil)
+}
+
+// comment sends an SSE comment, which clients ignore; it keeps the
+// connection alive while tools run.
+func (c chunker) comment(text string) {
+	fmt.Fprintf(c.w, ": %s\n\n", strings.ReplaceAll(text, "\n", " "))
+	c.flush()
+}
+
+func (c chunker) finish(answer string) {
+	c.chunk(map[string]string{"content": answer}, nil)
+	stop := "stop"
+	c.chunk(map[string]string{}, &stop)
+	c.done()
+}
+
+// fail ends a stream with an error event.
+func (c chunker) fail(err error) {
+	c.event(map[string]chatError{"error": {Message: err.Error(), Type: "server_error"}})
+	c.done()
+}
+
+func (c chunker) chunk(delta map[string]string, finish *string) {
+	c.event(map[string]any{
+		"id":      c.id,
+		"object":  "chat.completion.chunk",
+		"created": c.created,
+		"model":   c.model,
+		"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finish}},
+	})
+}
+
+func (c chunker) event(v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(c.w, "data: %s\n\n", data)
+	c.flush()
+}
+
+func (c chunker) done() {
+	fmt.Fprint(c.w, "data: [DONE]\n\n")
+	c.flush()
+}
+
+func (c chunker) flush() {
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func TestCompletions(t *testing.T) {
+	type call struct {
+		agent, session, prompt string
+		history                []provider.Message
+	}
+	var calls []call
+	run := func(_ context.Context, agent, sessionKey string, history []provider.Message, prompt string, onEvent func(loop.Event)) (string, provider.Usage, error) {
+		calls = append(calls, call{agent, sessionKey, prompt, history})
+		if prompt == "boom" {
+			return "", provider.Usage{}, errors.New("provider down")
+		}
+		if onEvent != nil {
+			onEvent(loop.Event{Type: loop.EventToolStart, ToolCall: provider.ToolCall{Name: "echo.run"}})
+		}
+		return "echo: " + prompt, provider.Usage{PromptTokens: 10, CompletionTokens: 5}, nil
+	}
+	s := New("")
+	h := NewCompletions(run, "ops")
+	s.Handle("GET /v1/models", h)
+	s.Handle("POST /v1/chat/completions", h)
+	serve := func(body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/v1/models", nil))
+	var models struct{ Data []struct{ ID string } }
+	json.Unmarshal(rec.Body.Bytes(), &models)
+	if len(models.Data) != 2 || models.Data[0].ID != DefaultModel || models.Data[1].ID != "ops" {
+		t.Errorf("models = %s", rec.Body.String())
+	}
+
+	rec = serve(`{"model":"teeny","messages":[{"role":"system","content":"be nice"},{"role":"user","content":"hi"}]}`)
+	var resp struct {
+		Object  string
+		Model   string
+		Choices []struct {
+			Message      struct{ Role, Content string }
+			FinishReason string `json:"finish_reason"`
+		}
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("completion: %d %s", rec.Code, rec.Body.String())
+	}
+	if resp.Object != "chat.completion" || len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "echo: hi" ||
+		resp.Choices[0].FinishReason != "stop" || resp.Usage.TotalTokens != 15 {
+		t.Errorf("completion = %s", rec.Body.String())
+	}
+
+	if c := calls[0]; c.session != "" || len(c.history) != 0 {
+		t.Errorf("stateless call = %+v", c)
+	}
+
+	// Without a conversation ID the earlier turns are sent along
+	serve(`{"model":"teeny","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"echo: hi"},{"role":"user","content":[{"type":"text","text":"again"}]}]}`)
+	if c := calls[1]; c.prompt != "again" || c.session != "" || len(c.history) != 2 || c.history[1].Content != "echo: hi" {
+		t.Errorf("stateless follow-up = %+v", c)
+	}
+
+	// With one, every turn runs in the conversation's session and only the
+	// last message is sent
+	serve(`{"model":"ops","messages":[{"role":"user","content":"hi"}]}`, "X-Session", "conv-1")
+	serve(`{"model":"ops","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"echo: hi"},{"role":"user","content":"more"}]}`, "X-Session", "conv-1")
+	if a, b := calls[2], calls[3]; a.agent != "ops" || !strings.HasPrefix(a.session, "chat-") || b.session != a.session || b.history != nil {
+		t.Errorf("conversation calls = %+v, %+v", a, b)
+	}
+
+	rec = serve(`{"messages":[{"role":"user","content":"hi"}],"stream":true}`)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("stream content type = %q", ct)
+	}
+	stream := rec.Body.String()
+	for _, want := range []string{`"delta":{"role":"assistant"}`, ": tool echo.run\n", `"delta":{"content":"echo: hi"}`, `"finish_reason":"stop"`} {
+		if !strings.Contains(stream, want) {
+			t.Errorf("stream missing %q:\n%s", want, stream)
+		}
+	}
+	if !strings.HasSuffix(stream, "data: [DONE]\n\n") {
+		t.Errorf("stream doesn't end with [DONE]:\n%s", stream)
+	}
+	if !strings.Contains(serve(`{"messages":[{"role":"user","content":"boom"}],"stream":true}`).Body.String(), `"error":{"message":"provider down"`) {
+		t.Error("stream error not reported")
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"not json", `hi`, http.StatusBadRequest},
+		{"no user message", `{"messages":[{"role":"system","content":"x"}]}`, http.StatusBadRequest},
+		{"unknown model", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`, http.StatusNotFound},
+		{"run failed", `{"messages":[{"role":"user","content":"boom"}]}`, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		rec := serve(tt.body)
+		var e struct{ Error struct{ Message string } }
+		json.Unmarshal(rec.Body.Bytes(), &e)
+		if rec.Code != tt.want || e.Error.Message == "" {
+			t.Errorf("%s: %d %s", tt.name, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestCompletionsSessionPerToken(t *testing.T) {
+	var sessions []string
+	run := func(_ context.Context, _, sessionKey string, _ []provider.Message, prompt string, _ func(loop.Event)) (string, provider.Usage, error) {
+		sessions = append(sessions, sessionKey)
+		return prompt, provider.Usage{}, nil
+	}
+	s := New("")
+	s.RequireTokens(Token{Name: "alice", Secret: "a"}, Token{Name: "bob", Secret: "b"})
+	s.Handle("POST /v1/chat/completions", NewCompletions(run))
+	for _, secret := range []string{"a", "b", "a"} {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Authorization", "Bearer "+secret)
+		req.Header.Set("X-Session", "conv-1")
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%d %s", rec.Code, rec.Body.String())
+		}
+	}
+	if sessions[0] == sessions[1] || sessions[0] != sessions[2] {
+		t.Errorf("sessions = %v; want one per token", sessions)
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// maxHookBody caps webhook payload size.
+const maxHookBody = 1 << 20
+
+// RunFunc starts an agent run. It matches scheduler.RunFunc.
+type RunFunc func(ctx context.Context, sessionKey, prompt string) (string, error)
+
+// Hook turns an inbound webhook into an agent run.
+type Hook struct {
+	Name     string
+	Session  string   // Session key template, e.g. "issue-{{.issue.number}}"
+	Prompt   string   // Prompt template rendered with the decoded JSON payload
+	Secret   string   // HMAC-SHA256 secret requests must be signed with
+	Unsigned bool     // Accept requests without a signature when Secret is empty
+	Events   []string // Accepted X-GitHub-Event values (empty = all)
+	Agent    string   // Named agent that runs the hook, for the RunFunc ("" = default)
+}
+
+type compiledHook struct {
+	Hook
+	session *template.Template
+	prompt  *template.Template
+}
+
+// Hooks serves POST /v1/hooks/{name}. Each accepted request renders its
+// hook's templates and starts a run in the background; the response is
+// 202 Accepted with the session key.
+type Hooks struct {
+	ctx     context.Context // Runs are cancelled when this is done
+	run     RunFunc
+	verbose bool
+	hooks   map[string]*compiledHook
+}
+
+// NewHooks compiles hook templates. Each hook needs a Secret unless it
+// opts into Unsigned. Runs inherit ctx, not the request's context, so they
+// outlive the HTTP response.
+func NewHooks(ctx context.Context, run RunFunc, verbose bool, hooks ...Hook) (*Hooks, error) {
+	h := &Hooks{ctx: ctx, run: run, verbose: verbose, hooks: make(map[string]*compiledHook)}
+	for _, hook := range hooks {
+		if hook.Name == "" || hook.Prompt == "" {
+			return nil, fmt.Errorf("server: hook needs a name and prompt")
+		}
+		if hook.Secret == "" && !hook.Unsigned {
+			return nil, fmt.Errorf("server: hook %s needs a secret, or Unsigned to accept anyone's requests", hook.Name)
+		}
+		if hook.Secret == "" {
+			log.Printf("[hooks] warning: hook %s accepts unsigned requests, so anyone who can reach it can start runs", hook.Name)
+		}
+		if hook.Session == "" {
+			hook.Session = "hook-" + hook.Name
+		}
+		c := &compiledHook{Hook: hook}
+		var err error
+		if c.session, err = template.New(hook.Name + ".session").Parse(hook.Session); err != nil {
+			return nil, fmt.Errorf("server: hook %s session: %w", hook.Name, err)
+		}
+		if c.prompt, err = template.New(hook.Name + ".prompt").Parse(hook.Prompt); err != nil {
+			return nil, fmt.Errorf("server: hook %s prompt: %w", hook.Name, err)
+		}
+		h.hooks[hook.Name] = c
+	}
+	return h, nil
+}
+
+func (h *Hooks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hook, ok := h.hooks[r.PathValue("name")]
+	if !ok {
+		http.Error(w, "unknown hook", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHookBody+1))
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxHookBody {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if (hook.Secret != "" || !hook.Unsigned) && !validSignature(hook.Secret, body, r.Header) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if event := r.Header.Get("X-GitHub-Event"); len(hook.Events) > 0 && !slices.Contains(hook.Events, event) {
+		w.WriteHeader(http.StatusNoContent) // Not an error; GitHub just sends more than we want
+		return
+	}
+
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "payload must be JSON", http.StatusBadRequest)
+		return
+	}
+	session, err := render(hook.session, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	prompt, err := render(hook.prompt, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	go func() {
+		if h.verbose {
+			log.Printf("[hooks] %s → session %s", hook.Name, session)
+		}
+		if _, err := h.run(withHook(h.ctx, hook.Hook), session, prompt); err != nil {
+			log.Printf("[hooks] %s run failed: %v", hook.Name, err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"session": session})
+}
+
+type hookKey struct{}
+
+func withHook(ctx context.Context, hook Hook) context.Context {
+	return context.WithValue(ctx, hookKey{}, hook)
+}
+
+// HookFrom returns the hook a RunFunc call was started for. It reports
+// false outside a hook run.
+func HookFrom(ctx context.Context) (Hook, bool) {
+	hook, ok := ctx.Value(hookKey{}).(Hook)
+	return hook, ok
+}
+
+func render(t *template.Template, data any) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render %s: %w", t.Name(), err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// validSignature checks a GitHub-style "sha256=<hex>" HMAC of body, sent
+// in X-Hub-Signature-256 or X-Signature-256.
+func validSignature(secret string, body []byte, header http.Header) bool {
+	if secret == "" {
+		return false // Anyone can sign with an empty key
+	}
+	sig := header.Get("X-Hub-Signature-256")
+	if sig == "" {
+		sig = header.Get("X-Signature-256")
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha256="))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
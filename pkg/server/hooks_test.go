@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type hookRun struct{ session, prompt, agent string }
+
+func newTestHooks(t *testing.T, hooks ...Hook) (*Server, chan hookRun) {
+	t.Helper()
+	runs := make(chan hookRun, 1)
+	h, err := NewHooks(context.Background(), func(ctx context.Context, session, prompt string) (string, error) {
+		hook, _ := HookFrom(ctx)
+		runs <- hookRun{session, prompt, hook.Agent}
+		return "", nil
+	}, false, hooks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New("")
+	s.Handle("POST /v1/hooks/{name}", h)
+	return s, runs
+}
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHookRendersAndRuns(t *testing.T) {
+	s, runs := newTestHooks(t, Hook{
+		Name:    "github",
+		Session: "issue-{{.issue.number}}",
+		Prompt:  "Triage issue #{{.issue.number}}: {{.issue.title}}",
+		Secret:  "s3cret",
+		Events:  []string{"issues"},
+		Agent:   "coder",
+	})
+	body := `{"action":"opened","issue":{"number":42,"title":"Crash on start"}}`
+
+	req := httptest.NewRequest("POST", "/v1/hooks/github", strings.NewReader(body))
+	req.Header.Set("X-Hub-Signature-256", sign("s3cret", body))
+	req.Header.Set("X-GitHub-Event", "issues")
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), `"session":"issue-42"`) {
+		t.Fatalf("response = %d %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case run := <-runs:
+		if run.session != "issue-42" || run.prompt != "Triage issue #42: Crash on start" || run.agent != "coder" {
+			t.Errorf("run = %+v", run)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run not started")
+	}
+}
+
+func TestHookRejects(t *testing.T) {
+	s, runs := newTestHooks(t, Hook{Name: "gh", Prompt: "{{.x}}", Secret: "s3cret", Events: []string{"issues"}})
+	body := `{"x":1}`
+
+	tests := []struct {
+		name  string
+		path  string
+		sig   string
+		event string
+		body  string
+		want  int
+	}{
+		{"unknown hook", "/v1/hooks/nope", sign("s3cret", body), "issues", body, http.StatusNotFound},
+		{"missing signature", "/v1/hooks/gh", "", "issues", body, http.StatusUnauthorized},
+		{"wrong secret", "/v1/hooks/gh", sign("other", body), "issues", body, http.StatusUnauthorized},
+		{"filtered event", "/v1/hooks/gh", sign("s3cret", body), "push", body, http.StatusNoContent},
+		{"not json", "/v1/hooks/gh", sign("s3cret", "nope"), "issues", "nope", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			if tt.sig != "" {
+				req.Header.Set("X-Hub-Signature-256", tt.sig)
+			}
+			req.Header.Set("X-GitHub-Event", tt.event)
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+	select {
+	case run := <-runs:
+		t.Errorf("unexpected run: %+v", run)
+	default:
+	}
+}
+
+func TestHookUnsigned(t *testing.T) {
+	s, runs := newTestHooks(t, Hook{Name: "open", Prompt: "{{.x}}", Unsigned: true})
+	req := httptest.NewRequest("POST", "/v1/hooks/open", strings.NewReader(`{"x":"hi"}`))
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("response = %d %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case run := <-runs:
+		if run.prompt != "hi" {
+			t.Errorf("run = %+v", run)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run not started")
+	}
+}
+
+func TestUnsignedHookNeedsToken(t *testing.T) {
+	s, runs := newTestHooks(t, Hook{Name: "open", Prompt: "{{.x}}", Unsigned: true}, Hook{Name: "gh", Prompt: "{{.x}}", Secret: "s3cret"})
+	s.RequireTokens(Token{Name: "ops", Secret: "t0ken"})
+	s.Signed("/v1/hooks/gh")
+	body := `{"x":"hi"}`
+
+	tests := []struct {
+		name, path, auth, sig string
+		want                  int
+	}{
+		{"unsigned without a token", "/v1/hooks/open", "", "", http.StatusUnauthorized},
+		{"unsigned with a token", "/v1/hooks/open", "Bearer t0ken", "", http.StatusAccepted},
+		{"signed without a token", "/v1/hooks/gh", "", sign("s3cret", body), http.StatusAccepted},
+		{"bad signature without a token", "/v1/hooks/gh", "", sign("other", body), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.path, strings.NewReader(body))
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		if tt.sig != "" {
+			req.Header.Set("X-Hub-Signature-256", tt.sig)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusAccepted {
+			<-runs
+		}
+	}
+}
+
+func TestNewHooksInvalid(t *testing.T) {
+	run := func(context.Context, string, string) (string, error) { return "", nil }
+	if _, err := NewHooks(context.Background(), run, false, Hook{Name: "x"}); err == nil {
+		t.Error("expected error for missing prompt")
+	}
+	if _, err := NewHooks(context.Background(), run, false, Hook{Name: "x", Prompt: "{{.x}}"}); err == nil || !strings.Contains(err.Error(), "needs a secret") {
+		t.Errorf("unsigned hook without Unsigned: err = %v", err)
+	}
+	if _, err := NewHooks(context.Background(), run, false, Hook{Name: "x", Prompt: "{{.bad", Unsigned: true}); err == nil {
+		t.Error("expected template parse error")
+	}
+}
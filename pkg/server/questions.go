@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Question is a user.ask call waiting for an answer over HTTP.
+type Question struct {
+	ID       string    `json:"id"`
+	Session  string    `json:"session"`
+	Question string    `json:"question"`
+	Asked    time.Time `json:"asked"`
+
+	reply chan string
+}
+
+// Questions holds questions asked by runs that have no chat channel, such
+// as webhook runs. GET /v1/questions lists them and
+// POST /v1/questions/{id} with {"answer": "..."} answers one.
+type Questions struct {
+	mu      sync.Mutex
+	nextID  int
+	pending map[string]*Question
+}
+
+// NewQuestions creates an empty question queue.
+func NewQuestions() *Questions {
+	return &Questions{pending: make(map[string]*Question)}
+}
+
+// Ask queues question for session and blocks until it is answered or ctx
+// is done.
+func (q *Questions) Ask(ctx context.Context, session, question string) (string, error) {
+	q.mu.Lock()
+	q.nextID++
+	pq := &Question{
+		ID:       strconv.Itoa(q.nextID),
+		Session:  session,
+		Question: question,
+		Asked:    time.Now(),
+		reply:    make(chan string, 1),
+	}
+	q.pending[pq.ID] = pq
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.pending, pq.ID)
+		q.mu.Unlock()
+	}()
+
+	select {
+	case answer := <-pq.reply:
+		return answer, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (q *Questions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		q.list(r.Context(), w)
+		return
+	}
+
+	var body struct {
+		Answer string `json:"answer"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHookBody)).Decode(&body); err != nil || body.Answer == "" {
+		http.Error(w, `body must be {"answer": "..."}`, http.StatusBadRequest)
+		return
+	}
+	q.mu.Lock()
+	pq, ok := q.pending[id]
+	ok = ok && Authorize(r.Context(), pq.Session) == nil
+	if ok {
+		delete(q.pending, id)
+		pq.reply <- body.Answer
+	}
+	q.mu.Unlock()
+	if !ok {
+		http.Error(w, "no such question", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// list writes the pending questions the request may see, oldest first.
+func (q *Questions) list(ctx context.Context, w http.ResponseWriter) {
+	q.mu.Lock()
+	list := make([]*Question, 0, len(q.pending))
+	for _, pq := range q.pending {
+		if Authorize(ctx, pq.Session) == nil {
+			list = append(list, pq)
+		}
+	}
+	q.mu.Unlock()
+	slices.SortFunc(list, func(a, b *Question) int { return a.Asked.Compare(b.Asked) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuestions(t *testing.T) {
+	q := NewQuestions()
+	s := New("")
+	s.Handle("GET /v1/questions", q)
+	s.Handle("POST /v1/questions/{id}", q)
+
+	answers := make(chan string, 1)
+	go func() {
+		answer, _ := q.Ask(context.Background(), "hook-deploy", "Which region?")
+		answers <- answer
+	}()
+
+	var list []Question
+	deadline := time.Now().Add(2 * time.Second)
+	for len(list) == 0 && time.Now().Before(deadline) {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/v1/questions", nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatalf("list: %v (%s)", err, rec.Body.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(list) != 1 || list[0].Session != "hook-deploy" || list[0].Question != "Which region?" {
+		t.Fatalf("questions = %+v", list)
+	}
+
+	tests := []struct {
+		name, id, body string
+		want           int
+	}{
+		{"unknown id", "99", `{"answer":"x"}`, http.StatusNotFound},
+		{"empty answer", list[0].ID, `{}`, http.StatusBadRequest},
+		{"answer", list[0].ID, `{"answer":"us-east-1"}`, http.StatusNoContent},
+		{"already answered", list[0].ID, `{"answer":"eu-west-1"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/v1/questions/"+tt.id, strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	select {
+	case answer := <-answers:
+		if answer != "us-east-1" {
+			t.Errorf("answer = %q", answer)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Ask did not return")
+	}
+}
+
+func TestQuestionsAskCancelled(t *testing.T) {
+	q := NewQuestions()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := q.Ask(ctx, "s", "still there?"); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+	if len(q.pending) != 0 {
+		t.Errorf("pending = %v", q.pending)
+	}
+}
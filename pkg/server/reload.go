@@ -0,0 +1,26 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+// ReloadFunc re-reads the daemon's configuration.
+type ReloadFunc func(ctx context.Context) error
+
+// Reload serves POST /v1/reload, which applies the daemon's config file
+// again with reload. Only tokens with Reload may call it. A config that
+// fails to load is reported with 500 and leaves the daemon as it was.
+func Reload(reload ReloadFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := TokenFrom(r.Context()); ok && !t.Reload {
+			http.Error(w, "token may not reload the config", http.StatusForbidden)
+			return
+		}
+		if err := reload(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+	})
+}
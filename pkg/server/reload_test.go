@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	var reloads int
+	var fail error
+	s := New("")
+	s.RequireTokens(
+		Token{Name: "ops", Secret: "s3cret", Reload: true},
+		Token{Name: "bot", Secret: "b0t"},
+	)
+	s.Handle("POST /v1/reload", Reload(func(context.Context) error {
+		reloads++
+		return fail
+	}))
+
+	post := func(auth string) int {
+		req := httptest.NewRequest("POST", "/v1/reload", nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := post("Bearer b0t"); code != http.StatusForbidden {
+		t.Errorf("without reload scope: %d, want 403", code)
+	}
+	if code := post("Bearer s3cret"); code != http.StatusOK {
+		t.Errorf("reload: %d, want 200", code)
+	}
+	fail = errors.New("config: bad")
+	if code := post("Bearer s3cret"); code != http.StatusInternalServerError {
+		t.Errorf("failed reload: %d, want 500", code)
+	}
+	if reloads != 2 {
+		t.Errorf("reloads = %d, want 2", reloads)
+	}
+}
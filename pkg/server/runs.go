@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+)
+
+// SubmitFunc starts a run in the background as the named agent ("" =
+// default) and returns its ID. ctx is the request's, which carries its
+// Token; the run must outlive it. An error wrapping ErrForbidden means the
+// token may not use the session.
+type SubmitFunc func(ctx context.Context, agent, sessionKey, prompt string) (string, error)
+
+// ErrUnknownAgent is wrapped by a SubmitFunc's error for an agent that
+// isn't configured.
+var ErrUnknownAgent = errors.New("unknown agent")
+
+// Runs serves the async run API:
+//
+//	POST /v1/runs       {"session": "...", "prompt": "...", "agent": "..."} starts a run (202 with its ID)
+//	GET  /v1/runs       lists known runs
+//	GET  /v1/runs/{id}  reports a run's status, and its result once finished
+//
+// A token only sees runs in sessions it may use.
+type Runs struct {
+	submit SubmitFunc
+	runs   *loop.Runs
+}
+
+// NewRuns serves runs started by submit and tracked in runs.
+func NewRuns(submit SubmitFunc, runs *loop.Runs) *Runs {
+	return &Runs{submit: submit, runs: runs}
+}
+
+func (h *Runs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch id := r.PathValue("id"); {
+	case r.Method == http.MethodPost:
+		h.start(w, r)
+	case id != "":
+		info, ok := h.runs.Get(id)
+		if !ok || Authorize(r.Context(), info.Session) != nil {
+			http.Error(w, "no such run", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	default:
+		list := slices.DeleteFunc(h.runs.List(), func(info loop.RunInfo) bool {
+			return Authorize(r.Context(), info.Session) != nil
+		})
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+func (h *Runs) start(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Session string `json:"session"`
+		Prompt  string `json:"prompt"`
+		Agent   string `json:"agent"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHookBody)).Decode(&body); err != nil || body.Prompt == "" {
+		http.Error(w, `body must be {"session": "...", "prompt": "..."}`, http.StatusBadRequest)
+		return
+	}
+	if body.Session == "" {
+		body.Session = "api"
+	}
+	id, err := h.submit(r.Context(), body.Agent, body.Session, body.Prompt)
+	if errors.Is(err, ErrUnknownAgent) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": id, "session": body.Session})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ctxpkg "github.com/rcliao/teeny-orchestrator/pkg/context"
+	"github.com/rcliao/teeny-orchestrator/pkg/loop"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+	"github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+)
+
+func TestRuns(t *testing.T) {
+	runs := loop.NewRuns(time.Hour)
+	submit := func(_ context.Context, agent, sessionKey, prompt string) (string, error) {
+		if agent != "" {
+			return "", fmt.Errorf("%w %q", ErrUnknownAgent, agent)
+		}
+		if sessionKey == "private" {
+			return "", ErrForbidden
+		}
+		reg := toolreg.NewRegistry(time.Second)
+		cfg := loop.DefaultConfig()
+		cfg.SessionKey = sessionKey
+		cfg.AutoCapture = false
+		cfg.Runs = runs
+		al := loop.New(providertest.New(providertest.Text("echo: "+prompt)), reg,
+			ctxpkg.NewBuilder(t.TempDir(), ctxpkg.DefaultConfig(), reg), session.NewManager(t.TempDir()), cfg)
+		return al.Submit(context.Background(), prompt)
+	}
+	s := New("")
+	h := NewRuns(submit, runs)
+	s.Handle("POST /v1/runs", h)
+	s.Handle("GET /v1/runs", h)
+	s.Handle("GET /v1/runs/{id}", h)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := serve("POST", "/v1/runs", `{"session":"s1"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing prompt: status = %d", rec.Code)
+	}
+	if rec := serve("POST", "/v1/runs", `{"prompt":"ping","agent":"nope"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown agent: status = %d", rec.Code)
+	}
+	if rec := serve("POST", "/v1/runs", `{"session":"private","prompt":"ping"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("forbidden session: status = %d", rec.Code)
+	}
+	rec := serve("POST", "/v1/runs", `{"session":"s1","prompt":"ping"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("submit: status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	var started struct{ ID, Session string }
+	json.Unmarshal(rec.Body.Bytes(), &started)
+	if started.ID == "" || started.Session != "s1" {
+		t.Fatalf("submit response = %s", rec.Body.String())
+	}
+
+	var info loop.RunInfo
+	deadline := time.Now().Add(5 * time.Second)
+	for info.Status != loop.RunDone && time.Now().Before(deadline) {
+		rec := serve("GET", "/v1/runs/"+started.ID, "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+			t.Fatalf("status: %v (%s)", err, rec.Body.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if info.Status != loop.RunDone || info.Result != "echo: ping" {
+		t.Errorf("run = %+v", info)
+	}
+
+	var list []loop.RunInfo
+	json.Unmarshal(serve("GET", "/v1/runs", "").Body.Bytes(), &list)
+	if len(list) != 1 {
+		t.Errorf("list = %+v", list)
+	}
+	if rec := serve("GET", "/v1/runs/99", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown run: status = %d", rec.Code)
+	}
+}
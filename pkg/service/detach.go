@@ -0,0 +1,44 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Detach starts this program again with args, in a new session with no
+// controlling terminal, and returns its process ID without waiting for
+// it. The new process's output is appended to logPath, or discarded when
+// logPath is empty.
+func Detach(args []string, logPath string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("service: detach: %w", err)
+	}
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		return 0, fmt.Errorf("service: detach: %w", err)
+	}
+	defer null.Close()
+	out := null
+	if logPath != "" {
+		if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+			return 0, fmt.Errorf("service: detach: %w", err)
+		}
+		if out, err = os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+			return 0, fmt.Errorf("service: detach: %w", err)
+		}
+		defer out.Close()
+	}
+	p, err := os.StartProcess(exe, append([]string{exe}, args...), &os.ProcAttr{
+		Env:   os.Environ(),
+		Files: []*os.File{null, out, out},
+		Sys:   sysProcAttr(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("service: detach: %w", err)
+	}
+	pid := p.Pid
+	p.Release()
+	return pid, nil
+}
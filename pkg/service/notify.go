@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// States for Notify, from the sd_notify protocol.
+const (
+	Ready     = "READY=1"     // Startup is finished
+	Reloading = "RELOADING=1" // Reloading config; send Ready when done
+	Stopping  = "STOPPING=1"  // Shutting down
+	Watchdog  = "WATCHDOG=1"  // Still alive
+)
+
+// Notify sends state to systemd's notification socket ($NOTIFY_SOCKET).
+// It reports false, without an error, when no socket is set, i.e. when the
+// process isn't a systemd service of Type=notify.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:] // Abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("service: notify: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("service: notify: %w", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns how often systemd expects a Watchdog
+// notification ($WATCHDOG_USEC), or 0 when the watchdog is off or set for
+// another process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog notifies systemd's watchdog at half the interval it expects
+// until ctx is done. It returns at once when the watchdog is off.
+func RunWatchdog(ctx context.Context) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			Notify(Watchdog)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Package service runs the daemon under a process supervisor: it keeps a
+// PID file, speaks systemd's notify protocol for readiness and the
+// watchdog, and detaches the daemon from its terminal.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrRunning is returned by WritePIDFile when the file names another live
+// process.
+var ErrRunning = errors.New("already running")
+
+// WritePIDFile records this process's ID in path, creating parent
+// directories. It fails with ErrRunning if path names another process
+// that is still alive; a file left by a daemon that crashed is replaced.
+// Call remove on exit: it deletes the file if it still holds our ID.
+func WritePIDFile(path string) (remove func(), err error) {
+	if pid, err := ReadPIDFile(path); err == nil && pid != os.Getpid() && alive(pid) {
+		return nil, fmt.Errorf("service: %s: process %d %w", path, pid, ErrRunning)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("service: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		return nil, fmt.Errorf("service: write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("service: write %s: %w", path, err)
+	}
+	return func() {
+		if pid, err := ReadPIDFile(path); err == nil && pid == os.Getpid() {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+// ReadPIDFile returns the process ID stored in path.
+func ReadPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("service: %s: not a PID file", path)
+	}
+	return pid, nil
+}
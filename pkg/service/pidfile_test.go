@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestWritePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "teeny.pid")
+	remove, err := WritePIDFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := ReadPIDFile(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("pid = %d, %v; want %d", pid, err, os.Getpid())
+	}
+
+	// Our own PID file can be written again, e.g. after a restart in place.
+	if _, err := WritePIDFile(path); err != nil {
+		t.Errorf("rewrite: %v", err)
+	}
+	remove()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("PID file not removed: %v", err)
+	}
+}
+
+func TestWritePIDFile_Running(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "teeny.pid")
+	os.WriteFile(path, []byte(strconv.Itoa(os.Getppid())), 0o644)
+	if _, err := WritePIDFile(path); !errors.Is(err, ErrRunning) {
+		t.Errorf("live process: err = %v, want ErrRunning", err)
+	}
+}
+
+func TestWritePIDFile_Stale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "teeny.pid")
+	os.WriteFile(path, []byte("garbage"), 0o644)
+	if _, err := WritePIDFile(path); err != nil {
+		t.Errorf("unreadable file: %v", err)
+	}
+	os.WriteFile(path, []byte("999999999\n"), 0o644)
+	if _, err := WritePIDFile(path); err != nil {
+		t.Errorf("dead process: %v", err)
+	}
+}
+
+func TestRemoveKeepsOtherPID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "teeny.pid")
+	remove, err := WritePIDFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte("999999999\n"), 0o644) // Taken over by another daemon
+	remove()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("another daemon's PID file was removed: %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package service
+
+import (
+	"os"
+	"syscall"
+)
+
+// alive reports whether a process with pid exists.
+func alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
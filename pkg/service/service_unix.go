@@ -0,0 +1,23 @@
+//go:build unix
+
+package service
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// alive reports whether a process with pid exists.
+func alive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
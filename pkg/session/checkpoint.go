@@ -0,0 +1,104 @@
+package session
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// Checkpoint is the state of a run in progress, saved with its session so
+// a run cut short by a crash or restart can be resumed.
+type Checkpoint struct {
+	Prompt    string              `json:"prompt"` // The user message that started the run
+	Intent    string              `json:"intent,omitempty"`
+	Model     string              `json:"model,omitempty"`
+	RunID     string              `json:"run_id,omitempty"` // Kept by the resumed run (see provider.Meta)
+	Tags      map[string]string   `json:"tags,omitempty"`
+	Messages  []provider.Message  `json:"messages"`          // What the next LLM call would be sent, system prompt included
+	Start     int                 `json:"start"`             // Index in Messages of the first message the run added
+	Iteration int                 `json:"iteration"`         // LLM calls completed
+	Pending   []provider.ToolCall `json:"pending,omitempty"` // Tool calls requested but not yet answered
+	Started   time.Time           `json:"started"`
+	Updated   time.Time           `json:"updated"`
+}
+
+// SetCheckpoint records the state of the session's run in progress, or
+// clears it when cp is nil. Save persists it. The checkpoint is copied, and
+// its messages are redacted like the session's.
+func (m *Manager) SetCheckpoint(key string, cp *Checkpoint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cp == nil {
+		m.view(key)
+		if s, ok := m.sessions[key]; ok && s.Checkpoint != nil {
+			m.update(record{Op: opCheckpoint, Key: key})
+		}
+		return
+	}
+	c := *cp
+	c.Prompt = m.redactor.String(c.Prompt)
+	c.Messages = make([]provider.Message, len(cp.Messages))
+	for i, msg := range cp.Messages {
+		c.Messages[i] = m.redactor.Message(msg)
+	}
+	c.Pending = append([]provider.ToolCall(nil), cp.Pending...)
+	for i := range c.Pending {
+		c.Pending[i].Arguments = m.redactor.String(c.Pending[i].Arguments)
+	}
+	m.update(record{Op: opCheckpoint, Key: key, Checkpoint: &c})
+}
+
+// AdvanceCheckpoint records a step of the session's run: added goes on
+// the end of the checkpoint's messages, and iteration and pending replace
+// its own. Only added is journaled, so a long run's checkpoints don't grow
+// with each step. It does nothing if the session has no checkpoint.
+func (m *Manager) AdvanceCheckpoint(key string, added []provider.Message, iteration int, pending []provider.ToolCall) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.view(key)
+	if s, ok := m.sessions[key]; !ok || s.Checkpoint == nil {
+		return
+	}
+	step := &Checkpoint{Iteration: iteration, Messages: make([]provider.Message, len(added))}
+	for i, msg := range added {
+		step.Messages[i] = m.redactor.Message(msg)
+	}
+	step.Pending = append([]provider.ToolCall(nil), pending...)
+	for i := range step.Pending {
+		step.Pending[i].Arguments = m.redactor.String(step.Pending[i].Arguments)
+	}
+	m.update(record{Op: opStep, Key: key, Checkpoint: step})
+}
+
+// GetCheckpoint returns the session's unfinished run, or nil if it has none.
+func (m *Manager) GetCheckpoint(key string) *Checkpoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.view(key)
+	if s, ok := m.sessions[key]; ok && s.Checkpoint != nil {
+		c := *s.Checkpoint
+		c.Messages = append([]provider.Message(nil), c.Messages...)
+		return &c
+	}
+	return nil
+}
+
+// Checkpointed returns the keys of sessions with an unfinished run, sorted.
+func (m *Manager) Checkpointed() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refreshAll()
+	var keys []string
+	for key, s := range m.sessions {
+		if s.Checkpoint != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
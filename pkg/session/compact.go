@@ -0,0 +1,74 @@
+package session
+
+import (
+	"context"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// Summarizer condenses the messages compacted out of a session into its
+// summary. previous is the summary of the messages compacted before them
+// ("" for none), and the result replaces it. See package summarize for
+// implementations.
+type Summarizer interface {
+	Summarize(ctx context.Context, previous string, msgs []provider.Message) (string, error)
+}
+
+// Compact folds all but about the last keepLast messages of a session into
+// its summary with s, then drops them from the history with SetSummary.
+// The cut falls before a user message, so tool calls stay with their
+// results. It reports whether anything was compacted. Messages added while
+// s runs are kept, and nothing is compacted if another process compacted
+// the session in the meantime.
+func (m *Manager) Compact(ctx context.Context, key string, s Summarizer, keepLast int) (bool, error) {
+	m.mu.Lock()
+	m.view(key)
+	sess, ok := m.sessions[key]
+	if !ok {
+		m.mu.Unlock()
+		return false, nil
+	}
+	msgs := append([]provider.Message(nil), sess.Messages...)
+	previous := sess.Summary
+	m.mu.Unlock()
+
+	cut := compactCut(msgs, keepLast)
+	if cut == 0 {
+		return false, nil
+	}
+	summary, err := s.Summarize(ctx, previous, msgs[:cut])
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.view(key)
+	sess, ok = m.sessions[key]
+	if !ok || sess.Summary != previous || len(sess.Messages) < len(msgs) {
+		return false, nil
+	}
+	m.update(record{Op: opSummary, Key: key, Summary: m.redactor.String(summary), KeepLast: len(sess.Messages) - cut})
+	return true, nil
+}
+
+// compactCut returns how many of the oldest messages to compact so about
+// keepLast are left: the cut moves forward to a user message, or back to
+// one if none follows. It returns 0 if there is nothing to compact.
+func compactCut(msgs []provider.Message, keepLast int) int {
+	if len(msgs) <= keepLast {
+		return 0
+	}
+	start := len(msgs) - max(keepLast, 1)
+	for cut := start; cut < len(msgs); cut++ {
+		if msgs[cut].Role == "user" {
+			return cut
+		}
+	}
+	for cut := start - 1; cut > 0; cut-- {
+		if msgs[cut].Role == "user" {
+			return cut
+		}
+	}
+	return 0
+}
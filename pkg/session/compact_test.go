@@ -0,0 +1,75 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// joinSummarizer appends the compacted messages' contents to the summary.
+type joinSummarizer struct {
+	during func() // Called while summarizing
+	err    error
+}
+
+func (j joinSummarizer) Summarize(_ context.Context, previous string, msgs []provider.Message) (string, error) {
+	if j.during != nil {
+		j.during()
+	}
+	for _, m := range msgs {
+		previous += m.Content + ";"
+	}
+	return previous, j.err
+}
+
+func TestCompact(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManager(dir)
+	for i := range 3 {
+		m.AddMessage("s1", provider.Message{Role: "user", Content: fmt.Sprintf("q%d", i)})
+		m.AddMessage("s1", provider.Message{Role: "assistant", ToolCalls: []provider.ToolCall{{ID: "t"}}})
+		m.AddMessage("s1", provider.Message{Role: "tool", Content: fmt.Sprintf("r%d", i), ToolCallID: "t"})
+	}
+
+	// Keeping 2 would split q2 from its tool call, so the cut moves back
+	s := joinSummarizer{during: func() { m.AddMessage("s1", provider.Message{Role: "assistant", Content: "late"}) }}
+	ok, err := m.Compact(context.Background(), "s1", s, 2)
+	if !ok || err != nil {
+		t.Fatalf("Compact = %v, %v", ok, err)
+	}
+	if got := m.GetSummary("s1"); got != "q0;;r0;q1;;r1;" {
+		t.Errorf("summary = %q", got)
+	}
+	h := NewManager(dir).GetHistory("s1")
+	if len(h) != 4 || h[0].Content != "q2" || h[3].Content != "late" {
+		t.Errorf("history = %+v", h)
+	}
+
+	if ok, _ := m.Compact(context.Background(), "s1", joinSummarizer{}, 10); ok {
+		t.Error("compacted a session within keepLast")
+	}
+	m.AddMessage("s1", provider.Message{Role: "user", Content: "q3"})
+	if ok, err := m.Compact(context.Background(), "s1", joinSummarizer{err: errors.New("down")}, 0); ok || err == nil {
+		t.Errorf("failed summarizer: Compact = %v, %v", ok, err)
+	}
+	if m.MessageCount("s1") != 5 {
+		t.Error("a failed compaction changed the history")
+	}
+}
+
+func TestCompactRace(t *testing.T) {
+	m := NewManager(tempDir(t))
+	for _, c := range []string{"a", "b", "c"} {
+		m.AddMessage("s1", provider.Message{Role: "user", Content: c})
+	}
+	s := joinSummarizer{during: func() { m.SetSummary("s1", "other", 1) }}
+	if ok, err := m.Compact(context.Background(), "s1", s, 1); ok || err != nil {
+		t.Errorf("Compact = %v, %v; want a no-op after a concurrent compaction", ok, err)
+	}
+	if m.GetSummary("s1") != "other" {
+		t.Errorf("summary = %q", m.GetSummary("s1"))
+	}
+}
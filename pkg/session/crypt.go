@@ -0,0 +1,127 @@
+package session
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// encMagic prefixes encrypted session files.
+var encMagic = []byte("TEENYENC1\n")
+
+// Keyring service and account used by LoadKey.
+const (
+	KeyringService = "teeny-orchestrator"
+	KeyringAccount = "session-key"
+)
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithCipher encrypts sessions with c. Existing plaintext sessions are
+// still read and are rewritten encrypted on their next Save.
+func WithCipher(c *Cipher) Option {
+	return func(m *Manager) { m.cipher = c }
+}
+
+// Cipher seals session files with AES-GCM.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a cipher from a 16, 24, or 32 byte AES key.
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// seal encrypts data, binding it to name so files can't be swapped.
+func (c *Cipher) seal(name string, data []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), encMagic...)
+	out = append(out, nonce...)
+	return c.aead.Seal(out, nonce, data, []byte(name)), nil
+}
+
+// open decrypts a file produced by seal.
+func (c *Cipher) open(name string, data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(data, encMagic)
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("session: encrypted file too short")
+	}
+	plain, err := c.aead.Open(nil, data[:n], data[n:], []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("session: decrypt %s: %w", name, err)
+	}
+	return plain, nil
+}
+
+// open decrypts data stored under name if it is sealed, and returns it
+// as is otherwise.
+func (m *Manager) open(name string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encMagic) {
+		return data, nil
+	}
+	if m.cipher == nil {
+		return nil, fmt.Errorf("session: %s is encrypted and no key is set", name)
+	}
+	return m.cipher.open(name, data)
+}
+
+// LoadKey returns the base64-encoded session key from the envVar
+// environment variable, falling back to the OS keyring (secret-tool on
+// Linux, security on macOS) under KeyringService/KeyringAccount.
+func LoadKey(envVar string) ([]byte, error) {
+	encoded := ""
+	if envVar != "" {
+		encoded = os.Getenv(envVar)
+	}
+	if encoded == "" {
+		var err error
+		if encoded, err = keyringLookup(); err != nil {
+			return nil, fmt.Errorf("session: no key in $%s or keyring: %w", envVar, err)
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("session: key is not valid base64: %w", err)
+	}
+	return key, nil
+}
+
+func keyringLookup() (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", KeyringService, "-a", KeyringAccount, "-w")
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "service", KeyringService, "account", KeyringAccount)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return "", errors.New("empty keyring entry")
+	}
+	return string(out), nil
+}
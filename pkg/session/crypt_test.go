@@ -0,0 +1,94 @@
+package session
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func testCipher(t *testing.T, fill byte) *Cipher {
+	t.Helper()
+	c, err := NewCipher(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEncryptedSaveAndReload(t *testing.T) {
+	dir := tempDir(t)
+	c := testCipher(t, 1)
+
+	m := NewManager(dir, WithCipher(c))
+	m.AddMessage("secret", provider.Message{Role: "user", Content: "api key is hunter2"})
+	if err := m.Save("secret"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "secret.enc"))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if bytes.Contains(data, []byte("hunter2")) {
+		t.Fatal("session stored in plaintext")
+	}
+
+	if h := NewManager(dir, WithCipher(c)).GetHistory("secret"); len(h) != 1 || h[0].Content != "api key is hunter2" {
+		t.Errorf("reloaded history = %+v", h)
+	}
+	if h := NewManager(dir).GetHistory("secret"); h != nil {
+		t.Error("encrypted session loaded without a key")
+	}
+	if h := NewManager(dir, WithCipher(testCipher(t, 2))).GetHistory("secret"); h != nil {
+		t.Error("encrypted session loaded with the wrong key")
+	}
+}
+
+func TestEncryptionMigratesPlaintext(t *testing.T) {
+	dir := tempDir(t)
+	plain := NewManager(dir)
+	plain.AddMessage("old", provider.Message{Role: "user", Content: "hello"})
+	plain.Save("old")
+
+	m := NewManager(dir, WithCipher(testCipher(t, 1)))
+	if m.MessageCount("old") != 1 {
+		t.Fatal("plaintext session not readable with encryption enabled")
+	}
+	m.Save("old")
+	if _, err := os.Stat(filepath.Join(dir, "old.json")); !os.IsNotExist(err) {
+		t.Error("plaintext copy not removed after encrypted save")
+	}
+	if err := m.Delete("old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.enc")); !os.IsNotExist(err) {
+		t.Error("encrypted file not deleted")
+	}
+}
+
+func TestNewCipherKeyLength(t *testing.T) {
+	if _, err := NewCipher([]byte("short")); err == nil {
+		t.Error("expected error for invalid key length")
+	}
+}
+
+func TestLoadKeyFromEnv(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	t.Setenv("TEST_SESSION_KEY", base64.StdEncoding.EncodeToString(key))
+	got, err := LoadKey("TEST_SESSION_KEY")
+	if err != nil {
+		t.Fatalf("LoadKey: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("key = %x", got)
+	}
+
+	t.Setenv("TEST_SESSION_KEY", "not base64!")
+	if _, err := LoadKey("TEST_SESSION_KEY"); err == nil {
+		t.Error("expected error for invalid base64")
+	}
+}
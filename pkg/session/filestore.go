@@ -0,0 +1,287 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File extensions for plaintext and encrypted sessions.
+const (
+	plainExt     = ".json"
+	encryptedExt = ".enc"
+)
+
+// journalExt is the extension of a session's journal: the changes made
+// since its last Save, one record per line. Each change is appended
+// before it is applied in memory, so a session survives a crash between
+// saves, and changes made by other processes sharing the directory are
+// picked up before the next read or write.
+const journalExt = ".wal"
+
+// lockName is the file locked while the directory is read or written.
+const lockName = ".lock"
+
+// archiveDir is the subdirectory of the session directory that holds
+// archived sessions.
+const archiveDir = "archive"
+
+// File extensions for plaintext and encrypted archives.
+const (
+	archiveExt          = ".json.gz"
+	encryptedArchiveExt = ".json.gz.enc"
+)
+
+// fileStore keeps each session in a directory as a snapshot file and a
+// journal file, named by sanitized key, with archives in archiveDir. A
+// lock file keeps processes sharing the directory from writing at once.
+type fileStore struct {
+	dir       string
+	encrypted bool     // Snapshots are written encrypted, and win over a stale plaintext copy
+	lockf     *os.File // nil = no locking
+}
+
+var _ ArchiveStore = (*fileStore)(nil)
+
+func newFileStore(dir string, encrypted bool) *fileStore {
+	os.MkdirAll(dir, 0755)
+	fs := &fileStore{dir: dir, encrypted: encrypted}
+	if f, err := os.OpenFile(filepath.Join(dir, lockName), os.O_RDWR|os.O_CREATE, 0600); err == nil {
+		fs.lockf = f
+	}
+	return fs
+}
+
+func (fs *fileStore) Name(key string) string { return sanitize(key) }
+
+// Lock locks the whole directory, whatever the name.
+func (fs *fileStore) Lock(string) (func(), error) {
+	if fs.lockf == nil {
+		return func() {}, nil
+	}
+	if err := lockFile(fs.lockf); err != nil {
+		return nil, err
+	}
+	return func() { unlockFile(fs.lockf) }, nil
+}
+
+func (fs *fileStore) Names() ([]string, error) {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != plainExt && ext != encryptedExt && ext != journalExt) {
+			continue
+		}
+		if name := strings.TrimSuffix(e.Name(), ext); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// snapshot returns the snapshot file of name, or "" if it has none.
+func (fs *fileStore) snapshot(name string) (string, os.FileInfo) {
+	files := []string{name + plainExt}
+	if fs.encrypted {
+		files = []string{name + encryptedExt, name + plainExt}
+	}
+	for _, f := range files {
+		if fi, err := os.Stat(filepath.Join(fs.dir, f)); err == nil {
+			return f, fi
+		}
+	}
+	return "", nil
+}
+
+// Version is made of the snapshot's name, size, and modification time,
+// and the journal's size.
+func (fs *fileStore) Version(name string) (string, error) {
+	file, fi := fs.snapshot(name)
+	journal := int64(-1)
+	if jfi, err := os.Stat(filepath.Join(fs.dir, name+journalExt)); err == nil {
+		journal = jfi.Size()
+	}
+	switch {
+	case file != "":
+		return fmt.Sprintf("%s %d %d %d", file, fi.Size(), fi.ModTime().UnixNano(), journal), nil
+	case journal >= 0:
+		return fmt.Sprintf("journal %d", journal), nil
+	}
+	return "", nil
+}
+
+func (fs *fileStore) Snapshot(name string) ([]byte, error) {
+	file, _ := fs.snapshot(name)
+	if file == "" {
+		return nil, nil
+	}
+	return os.ReadFile(filepath.Join(fs.dir, file))
+}
+
+// Journal drops a last line cut short by a crash from the file.
+func (fs *fileStore) Journal(name string) ([][]byte, error) {
+	path := filepath.Join(fs.dir, name+journalExt)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries [][]byte
+	complete := bytes.LastIndexByte(data, '\n') + 1
+	for line := range bytes.SplitSeq(data[:complete], []byte("\n")) {
+		if len(line) > 0 {
+			entries = append(entries, line)
+		}
+	}
+	if complete < len(data) {
+		return entries, os.Truncate(path, int64(complete))
+	}
+	return entries, nil
+}
+
+func (fs *fileStore) Append(name string, entry []byte) error {
+	f, err := os.OpenFile(filepath.Join(fs.dir, name+journalExt), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(entry, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (fs *fileStore) Save(name string, snapshot []byte) error {
+	file := name + plainExt
+	if fs.encrypted {
+		file = name + encryptedExt
+	}
+	if err := writeAtomic(fs.dir, file, snapshot); err != nil {
+		return err
+	}
+	if fs.encrypted {
+		// Drop the plaintext copy left from before encryption was enabled.
+		os.Remove(filepath.Join(fs.dir, name+plainExt))
+	}
+	if err := os.Remove(filepath.Join(fs.dir, name+journalExt)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (fs *fileStore) Delete(name string) error {
+	for _, ext := range []string{plainExt, encryptedExt, journalExt} {
+		if err := os.Remove(filepath.Join(fs.dir, name+ext)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Archive keeps the session's last update as the file's modification
+// time.
+func (fs *fileStore) Archive(name string, data []byte, updated time.Time) error {
+	file := name + archiveExt
+	if bytes.HasPrefix(data, encMagic) {
+		file = name + encryptedArchiveExt
+	}
+	dir := filepath.Join(fs.dir, archiveDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+		return fmt.Errorf("session: archive %s already exists", file)
+	}
+	if err := writeAtomic(dir, file, data); err != nil {
+		return err
+	}
+	os.Chtimes(filepath.Join(dir, file), updated, updated)
+	return nil
+}
+
+func (fs *fileStore) Archived(name string) ([]byte, error) {
+	files := []string{name + archiveExt}
+	if fs.encrypted {
+		files = []string{name + encryptedArchiveExt, name + archiveExt}
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(filepath.Join(fs.dir, archiveDir, f))
+		if !os.IsNotExist(err) {
+			return data, err
+		}
+	}
+	return nil, nil
+}
+
+func (fs *fileStore) Archives() (map[string]time.Time, error) {
+	entries, err := os.ReadDir(filepath.Join(fs.dir, archiveDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]time.Time)
+	for _, e := range entries {
+		name, ok := archiveName(e.Name())
+		if !ok {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			out[name] = info.ModTime()
+		}
+	}
+	return out, nil
+}
+
+// archiveName returns the name of the session in an archive file.
+func archiveName(file string) (string, bool) {
+	for _, ext := range []string{encryptedArchiveExt, archiveExt} {
+		if name, ok := strings.CutSuffix(file, ext); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (fs *fileStore) DeleteArchive(name string) error {
+	for _, ext := range []string{archiveExt, encryptedArchiveExt} {
+		if err := os.Remove(filepath.Join(fs.dir, archiveDir, name+ext)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAtomic writes data to dir/name through a temporary file, so
+// readers see the old contents or the new, never part of them.
+func writeAtomic(dir, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, "session-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+	return os.Rename(tmpPath, filepath.Join(dir, name))
+}
+
+func sanitize(key string) string {
+	return strings.ReplaceAll(key, ":", "_")
+}
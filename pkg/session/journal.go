@@ -0,0 +1,264 @@
+package session
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// Journal record operations.
+const (
+	opMessage    = "message"    // Message appended to the history
+	opSummary    = "summary"    // Summary set and history truncated to KeepLast
+	opCost       = "cost"       // CostUSD added to the running cost
+	opCheckpoint = "checkpoint" // Checkpoint set, or cleared if nil
+	opStep       = "step"       // Checkpoint's messages extended, its iteration and pending calls replaced
+)
+
+// record is one change in a journal, stored as a JSON line, sealed and
+// base64-encoded if the manager encrypts sessions.
+type record struct {
+	Op         string            `json:"op"`
+	Key        string            `json:"key"`
+	Time       time.Time         `json:"time"`
+	Message    *provider.Message `json:"message,omitempty"`
+	Summary    string            `json:"summary,omitempty"`
+	KeepLast   int               `json:"keep_last,omitempty"`
+	CostUSD    float64           `json:"cost_usd,omitempty"`
+	Checkpoint *Checkpoint       `json:"checkpoint,omitempty"`
+}
+
+// apply makes the change r records to s.
+func (r record) apply(s *Session) {
+	switch r.Op {
+	case opMessage:
+		s.Messages = append(s.Messages, *r.Message)
+		s.Updated = r.Time
+	case opSummary:
+		s.Summary = r.Summary
+		if r.KeepLast > 0 && len(s.Messages) > r.KeepLast {
+			s.Messages = s.Messages[len(s.Messages)-r.KeepLast:]
+		}
+		s.Updated = r.Time
+	case opCost:
+		s.CostUSD += r.CostUSD
+	case opCheckpoint:
+		s.Checkpoint = r.Checkpoint
+	case opStep:
+		if cp := s.Checkpoint; cp != nil && r.Checkpoint != nil {
+			cp.Messages = append(cp.Messages, r.Checkpoint.Messages...)
+			cp.Iteration, cp.Pending, cp.Updated = r.Checkpoint.Iteration, r.Checkpoint.Pending, r.Time
+		}
+	}
+}
+
+// refresh reloads the session stored under name if it changed since this
+// manager last loaded or wrote it. A session that can't be read, e.g.
+// without its key, is left out of memory and marked broken, so it is
+// never written over, and the error is returned until what is stored
+// changes. The caller holds m.mu and the store lock.
+func (m *Manager) refresh(name string) error {
+	delete(m.stale, name)
+	v, err := m.store.Version(name)
+	if err != nil {
+		return err
+	}
+	if known, ok := m.versions[name]; ok && v == known {
+		return m.broken[name]
+	}
+	s, err := m.load(name)
+	for key := range m.sessions {
+		if m.store.Name(key) == name {
+			delete(m.sessions, key)
+		}
+	}
+	m.versions[name] = v
+	if err != nil {
+		m.broken[name] = fmt.Errorf("session: read %s: %w", name, err)
+		return m.broken[name]
+	}
+	delete(m.broken, name)
+	if s != nil {
+		m.sessions[s.Key] = s
+	}
+	m.setVersion(name) // Loading may have trimmed a torn journal
+	return nil
+}
+
+// setVersion records the stored version of name as the one this manager
+// has. The caller holds m.mu and the store lock.
+func (m *Manager) setVersion(name string) {
+	if v, err := m.store.Version(name); err == nil {
+		m.versions[name] = v
+	}
+}
+
+// load reads the snapshot and journal stored under name. It returns nil
+// if there is neither, or if the snapshot can't be read.
+func (m *Manager) load(name string) (*Session, error) {
+	var s *Session
+	data, err := m.store.Snapshot(name)
+	if err != nil {
+		return nil, err
+	}
+	if data != nil {
+		if data, err = m.open(name+encryptedExt, data); err != nil {
+			return nil, err
+		}
+		s = &Session{}
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := m.store.Journal(name)
+	for _, e := range entries {
+		r, ok := m.decodeRecord(name, e)
+		if !ok {
+			continue
+		}
+		if s == nil {
+			s = &Session{Key: r.Key, Created: r.Time, Updated: r.Time}
+		}
+		r.apply(s)
+	}
+	return s, err
+}
+
+// decodeRecord reads a journal entry, reporting false for one that can't
+// be read, which is skipped.
+func (m *Manager) decodeRecord(name string, entry []byte) (record, bool) {
+	var r record
+	if m.cipher != nil {
+		sealed, err := base64.StdEncoding.DecodeString(string(entry))
+		if err != nil {
+			return r, false
+		}
+		if entry, err = m.cipher.open(name+journalExt, sealed); err != nil {
+			return r, false
+		}
+	}
+	if json.Unmarshal(entry, &r) != nil || r.Key == "" || (r.Op == opMessage && r.Message == nil) {
+		return r, false
+	}
+	return r, true
+}
+
+// appendJournal appends r to the journal of its session.
+func (m *Manager) appendJournal(name string, r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if m.cipher != nil {
+		sealed, err := m.cipher.seal(name+journalExt, line)
+		if err != nil {
+			return err
+		}
+		line = []byte(base64.StdEncoding.EncodeToString(sealed))
+	}
+	return m.store.Append(name, line)
+}
+
+// update records a change to a session in its journal and applies it in
+// memory. The caller holds m.mu. A failure to write the journal, or to
+// lock the store for it, is returned by the session's next Save, and the
+// change is kept in memory only. A change to a session that can't be read
+// is dropped rather than applied to an empty one.
+func (m *Manager) update(r record) {
+	r.Time = time.Now()
+	name := m.store.Name(r.Key)
+	unlock, err := m.lock(name)
+	if err != nil {
+		m.errs[name] = errors.Join(m.errs[name], err)
+		r.apply(m.getOrCreate(r.Key))
+		return
+	}
+	defer unlock()
+
+	if err := m.refresh(name); err != nil {
+		m.errs[name] = errors.Join(m.errs[name], err)
+		if m.broken[name] != nil {
+			return
+		}
+	} else if err := m.appendJournal(name, r); err != nil {
+		m.errs[name] = errors.Join(m.errs[name], err)
+	}
+	r.apply(m.getOrCreate(r.Key))
+	m.setVersion(name)
+}
+
+// view brings a session up to date with the store before it is read. On a
+// Notifier, a loaded session is only checked once another process has
+// changed it. The caller holds m.mu.
+func (m *Manager) view(key string) {
+	name := m.store.Name(key)
+	if m.current(name) {
+		return
+	}
+	unlock, err := m.lock(name)
+	if err != nil {
+		return // Serve what is in memory
+	}
+	defer unlock()
+	m.refresh(name)
+}
+
+// current reports whether the store's notifications vouch that name is as
+// this manager last loaded or wrote it. The caller holds m.mu.
+func (m *Manager) current(name string) bool {
+	_, known := m.versions[name]
+	return m.watching && known && !m.stale[name]
+}
+
+// refreshAll brings every stored session up to date, picking up sessions
+// created or deleted by other processes. Each is locked only while it is
+// reread. The caller holds m.mu.
+func (m *Manager) refreshAll() {
+	names := make(map[string]bool, len(m.versions))
+	for name := range m.versions {
+		names[name] = true
+	}
+	if stored, err := m.store.Names(); err == nil {
+		for _, name := range stored {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		if m.current(name) {
+			continue
+		}
+		if unlock, err := m.lock(name); err == nil {
+			m.refresh(name)
+			unlock()
+		}
+	}
+}
+
+// lock takes the store lock on the session stored under name, so no
+// other process reads or writes it until the returned function is called.
+// Callers that can't take it must not write to the store.
+func (m *Manager) lock(name string) (func(), error) {
+	unlock, err := m.store.Lock(name)
+	if err != nil {
+		return nil, fmt.Errorf("session: lock %s: %w", name, err)
+	}
+	return unlock, nil
+}
+
+// watch marks the sessions named on changes stale until it is closed,
+// then has the manager check the store on every read again.
+func (m *Manager) watch(changes <-chan string) {
+	for name := range changes {
+		m.mu.Lock()
+		m.stale[name] = true
+		m.mu.Unlock()
+	}
+	m.mu.Lock()
+	m.watching = false
+	m.mu.Unlock()
+}
@@ -0,0 +1,181 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func TestJournalSurvivesCrash(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManager(dir)
+	for i := range 4 {
+		m.AddMessage("s1", provider.Message{Role: "user", Content: fmt.Sprint(i)})
+	}
+	m.SetSummary("s1", "counting", 2)
+	m.AddCost("s1", 0.25)
+	m.SetCheckpoint("s1", &Checkpoint{Prompt: "count", Iteration: 1})
+
+	// No Save: a new manager replays the journal
+	m2 := NewManager(dir)
+	h := m2.GetHistory("s1")
+	if len(h) != 2 || h[0].Content != "2" || h[1].Content != "3" {
+		t.Errorf("history = %+v", h)
+	}
+	if m2.GetSummary("s1") != "counting" || m2.Cost("s1") != 0.25 || m2.GetCheckpoint("s1") == nil {
+		t.Errorf("summary = %q, cost = %v, checkpoint = %v", m2.GetSummary("s1"), m2.Cost("s1"), m2.GetCheckpoint("s1"))
+	}
+
+	if err := m2.Save("s1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "s1"+journalExt)); !os.IsNotExist(err) {
+		t.Error("journal not removed by Save")
+	}
+	if NewManager(dir).MessageCount("s1") != 2 {
+		t.Error("snapshot lost the journaled changes")
+	}
+}
+
+func TestJournalTornWrite(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManager(dir)
+	m.AddMessage("s1", provider.Message{Role: "user", Content: "kept"})
+
+	path := filepath.Join(dir, "s1"+journalExt)
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"op":"message","key":"s1","message":{"role":"us`)
+	f.Close()
+
+	m2 := NewManager(dir)
+	m2.AddMessage("s1", provider.Message{Role: "assistant", Content: "after"})
+	if h := NewManager(dir).GetHistory("s1"); len(h) != 2 || h[0].Content != "kept" || h[1].Content != "after" {
+		t.Errorf("history = %+v", h)
+	}
+}
+
+func TestJournalEncrypted(t *testing.T) {
+	dir := tempDir(t)
+	c := testCipher(t, 1)
+	m := NewManager(dir, WithCipher(c))
+	m.AddMessage("secret", provider.Message{Role: "user", Content: "api key is hunter2"})
+
+	data, err := os.ReadFile(filepath.Join(dir, "secret"+journalExt))
+	if err != nil || bytes.Contains(data, []byte("hunter2")) {
+		t.Fatalf("journal = %q, %v", data, err)
+	}
+	if h := NewManager(dir, WithCipher(c)).GetHistory("secret"); len(h) != 1 || h[0].Content != "api key is hunter2" {
+		t.Errorf("reloaded history = %+v", h)
+	}
+	if h := NewManager(dir, WithCipher(testCipher(t, 2))).GetHistory("secret"); h != nil {
+		t.Error("journal read with the wrong key")
+	}
+}
+
+func TestSharedDirectory(t *testing.T) {
+	dir := tempDir(t)
+	a, b := NewManager(dir), NewManager(dir)
+
+	a.AddMessage("s1", provider.Message{Role: "user", Content: "from a"})
+	b.AddMessage("s1", provider.Message{Role: "user", Content: "from b"})
+	if err := a.Save("s1"); err != nil {
+		t.Fatal(err)
+	}
+	a.AddMessage("s1", provider.Message{Role: "user", Content: "a again"})
+	if err := b.Save("s1"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"from a", "from b", "a again"}
+	for _, m := range []*Manager{a, b, NewManager(dir)} {
+		h := m.GetHistory("s1")
+		if len(h) != len(want) {
+			t.Fatalf("history = %+v, want %v", h, want)
+		}
+		for i := range want {
+			if h[i].Content != want[i] {
+				t.Errorf("message %d = %q, want %q", i, h[i].Content, want[i])
+			}
+		}
+	}
+
+	b.AddMessage("s2", provider.Message{Role: "user", Content: "new"})
+	if n := len(a.List()); n != 2 {
+		t.Errorf("a lists %d sessions, want 2", n)
+	}
+	if err := b.Delete("s2"); err != nil {
+		t.Fatal(err)
+	}
+	if a.MessageCount("s2") != 0 || len(a.List()) != 1 {
+		t.Error("session deleted by another manager is still listed")
+	}
+}
+
+func TestSharedDirectoryConcurrent(t *testing.T) {
+	dir := tempDir(t)
+	managers := []*Manager{NewManager(dir), NewManager(dir), NewManager(dir)}
+
+	var wg sync.WaitGroup
+	for i, m := range managers {
+		wg.Go(func() {
+			for j := range 20 {
+				m.AddMessage("s1", provider.Message{Role: "user", Content: fmt.Sprintf("%d-%d", i, j)})
+				if j%5 == 0 {
+					if err := m.Save("s1"); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	if n := NewManager(dir).MessageCount("s1"); n != 60 {
+		t.Errorf("messages = %d, want 60", n)
+	}
+}
+
+func TestUnreadableSessionNotOverwritten(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManager(dir, WithCipher(testCipher(t, 1)))
+	m.AddMessage("secret", provider.Message{Role: "user", Content: "hi"})
+	if err := m.Save("secret"); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(filepath.Join(dir, "secret"+encryptedExt))
+
+	wrong := NewManager(dir, WithCipher(testCipher(t, 2)))
+	wrong.AddMessage("secret", provider.Message{Role: "user", Content: "lost?"})
+	if err := wrong.Save("secret"); err == nil {
+		t.Error("Save wrote over a session it couldn't read")
+	}
+	if after, _ := os.ReadFile(filepath.Join(dir, "secret"+encryptedExt)); !bytes.Equal(before, after) {
+		t.Error("snapshot changed")
+	}
+	if h := NewManager(dir, WithCipher(testCipher(t, 1))).GetHistory("secret"); len(h) != 1 || h[0].Content != "hi" {
+		t.Errorf("history = %+v", h)
+	}
+}
+
+// unlockable is a store whose lock can't be taken.
+type unlockable struct{ Store }
+
+func (unlockable) Lock(string) (func(), error) { return nil, errors.New("lock timeout") }
+
+func TestLockFailureFailsWrites(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManagerWithStore(unlockable{newFileStore(dir, false)})
+	m.AddMessage("s1", provider.Message{Role: "user", Content: "hi"})
+	if err := m.Save("s1"); err == nil || !strings.Contains(err.Error(), "lock timeout") {
+		t.Errorf("Save: err = %v", err)
+	}
+	if names, _ := newFileStore(dir, false).Names(); len(names) != 0 {
+		t.Errorf("wrote %v without the lock", names)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package session
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable: processes sharing a
+// session directory are not kept apart, though runs in one process are.
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
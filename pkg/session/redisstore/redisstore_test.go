@@ -0,0 +1,205 @@
+package redisstore
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+)
+
+// newStore returns a store on its own client of mr.
+func newStore(t *testing.T, mr *miniredis.Miniredis, opts Options) *Store {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, opts)
+}
+
+// eventually fails the test if cond doesn't hold within a second.
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+	}
+}
+
+func TestManager(t *testing.T) {
+	mr := miniredis.RunT(t)
+	m := session.NewManagerWithStore(newStore(t, mr, Options{}))
+	defer m.Close()
+
+	m.AddMessage("slack:C1", provider.Message{Role: "user", Content: "hi"})
+	m.AddMessage("slack:C1", provider.Message{Role: "assistant", Content: "hello"})
+	if err := m.Save("slack:C1"); err != nil {
+		t.Fatal(err)
+	}
+	m.AddMessage("slack:C1", provider.Message{Role: "user", Content: "again"})
+
+	if !mr.Exists("teeny:session:slack:C1:snapshot") {
+		t.Errorf("keys = %v", mr.Keys())
+	}
+	if got, _ := mr.List("teeny:session:slack:C1:journal"); len(got) != 1 {
+		t.Errorf("journal = %v, want the message added after Save", got)
+	}
+
+	reopened := session.NewManagerWithStore(newStore(t, mr, Options{}))
+	defer reopened.Close()
+	if got := reopened.GetHistory("slack:C1"); len(got) != 3 || got[2].Content != "again" {
+		t.Fatalf("reloaded history = %+v", got)
+	}
+	if err := reopened.Delete("slack:C1"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("keys left after Delete: %v", keys)
+	}
+}
+
+func TestManager_Replicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := session.NewManagerWithStore(newStore(t, mr, Options{}))
+	defer a.Close()
+	b := session.NewManagerWithStore(newStore(t, mr, Options{}))
+	defer b.Close()
+
+	if got := b.MessageCount("k"); got != 0 {
+		t.Fatalf("count = %d", got)
+	}
+	a.AddMessage("k", provider.Message{Role: "user", Content: "from a"})
+	eventually(t, func() bool { return b.MessageCount("k") == 1 })
+
+	b.AddMessage("k", provider.Message{Role: "assistant", Content: "from b"})
+	if err := b.Save("k"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool { return a.MessageCount("k") == 2 })
+
+	// Without notifications, every read checks the store
+	b.Close()
+	eventually(t, func() bool {
+		a.AddMessage("k", provider.Message{Role: "user", Content: "from a again"})
+		return b.MessageCount("k") == a.MessageCount("k")
+	})
+}
+
+func TestTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	opts := Options{TTL: time.Hour}
+	m := session.NewManagerWithStore(newStore(t, mr, opts))
+	defer m.Close()
+	m.AddMessage("old", provider.Message{Role: "user", Content: "a"})
+	m.Save("old")
+	mr.FastForward(50 * time.Minute)
+	m.AddMessage("new", provider.Message{Role: "user", Content: "b"})
+	mr.FastForward(20 * time.Minute)
+
+	s := newStore(t, mr, opts)
+	if names, err := s.Names(); err != nil || len(names) != 1 || names[0] != "new" {
+		t.Fatalf("Names = %v, %v", names, err)
+	}
+	if members, _ := mr.Members("teeny:sessions"); len(members) != 1 {
+		t.Errorf("expired names kept: %v", members)
+	}
+	if got := session.NewManagerWithStore(s).List(); len(got) != 1 || got[0].Key != "new" {
+		t.Errorf("List = %+v", got)
+	}
+}
+
+func TestLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := newStore(t, mr, Options{LockTimeout: 50 * time.Millisecond})
+	b := newStore(t, mr, Options{LockTimeout: 50 * time.Millisecond})
+
+	unlock, err := a.Lock("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Lock("k"); err == nil {
+		t.Fatal("took a held lock")
+	}
+	other, err := b.Lock("other")
+	if err != nil {
+		t.Fatalf("lock on another session: %v", err)
+	}
+	other()
+	unlock()
+	unlock, err = b.Lock("k")
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	unlock()
+
+	// A lock left by a dead process expires
+	if _, err := a.Lock("k"); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(lockTTL)
+	if _, err := b.Lock("k"); err != nil {
+		t.Errorf("lock after expiry: %v", err)
+	}
+}
+
+func TestLockFencesWrites(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := newStore(t, mr, Options{LockTimeout: 50 * time.Millisecond})
+	b := newStore(t, mr, Options{LockTimeout: 50 * time.Millisecond})
+
+	unlockA, err := a.Lock("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(lockTTL) // a stalls past its lock
+	unlockB, err := b.Lock("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Append("k", []byte("from b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Save("k", []byte("stale")); !errors.Is(err, errLockLost) {
+		t.Errorf("write after losing the lock: err = %v", err)
+	}
+	if got, _ := b.Journal("k"); len(got) != 1 {
+		t.Errorf("journal = %q, want b's entry kept", got)
+	}
+	unlockA() // Leaves b's lock alone
+	if _, err := a.Lock("k"); err == nil {
+		t.Error("a's unlock released b's lock")
+	}
+	unlockB()
+}
+
+func TestEncrypted(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := session.NewCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := session.NewManagerWithStore(newStore(t, mr, Options{}), session.WithCipher(c))
+	defer m.Close()
+	m.AddMessage("secret", provider.Message{Role: "user", Content: "launch codes"})
+	journal, _ := mr.List("teeny:session:secret:journal")
+	m.Save("secret")
+	snapshot, _ := mr.Get("teeny:session:secret:snapshot")
+
+	for _, raw := range append(journal, snapshot) {
+		if raw == "" || strings.Contains(raw, "launch codes") {
+			t.Errorf("stored %q", raw)
+		}
+	}
+	if got := session.NewManagerWithStore(newStore(t, mr, Options{}), session.WithCipher(c)).GetHistory("secret"); len(got) != 1 {
+		t.Errorf("decrypted history = %+v", got)
+	}
+	if got := session.NewManagerWithStore(newStore(t, mr, Options{})).GetHistory("secret"); got != nil {
+		t.Errorf("read without the key: %+v", got)
+	}
+}
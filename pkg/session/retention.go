@@ -0,0 +1,290 @@
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Retention says how long sessions whose keys start with Prefix are kept.
+// A session is idle from its last update.
+type Retention struct {
+	Prefix       string        // Session key prefix ("" = every session)
+	ArchiveAfter time.Duration // Idle time before the session is compressed into the archive (0 = never)
+	DeleteAfter  time.Duration // Idle time before it is deleted, from the archive or not (0 = never)
+}
+
+// policyFor returns the policy with the longest prefix of key.
+func policyFor(policies []Retention, key string) (Retention, bool) {
+	var best Retention
+	found := false
+	for _, p := range policies {
+		if strings.HasPrefix(key, p.Prefix) && (!found || len(p.Prefix) > len(best.Prefix)) {
+			best, found = p, true
+		}
+	}
+	return best, found
+}
+
+// PruneResult lists the sessions Prune archived and deleted.
+type PruneResult struct {
+	Archived []string // Keys
+	Deleted  []string // Keys, or archive/<name> for archived sessions
+}
+
+// Prune applies retention policies as of now. Each session follows the
+// policy with the longest matching prefix, and sessions no policy matches
+// are kept. Sessions with an unfinished run are kept, so they can still be
+// resumed. An archived session keeps its last update, so it is deleted on
+// the same schedule. Without an archive (see Archive), sessions due for
+// it are kept until they are due for deletion. Each archive is named for
+// the session and its last update, so archiving a reused key never
+// overwrites an earlier archive. Sessions are pruned one at a time, so
+// runs in other sessions carry on meanwhile.
+func (m *Manager) Prune(policies []Retention, now time.Time) (PruneResult, error) {
+	m.mu.Lock()
+	m.refreshAll()
+	keys := make([]string, 0, len(m.sessions))
+	for key := range m.sessions {
+		keys = append(keys, key)
+	}
+	m.mu.Unlock()
+
+	archives := m.archives()
+	var res PruneResult
+	var errs []error
+	sort.Strings(keys)
+	for _, key := range keys {
+		archived, deleted, err := m.prune(key, policies, archives, now)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("session %s: %w", key, err))
+		case archived:
+			res.Archived = append(res.Archived, key)
+		case deleted:
+			res.Deleted = append(res.Deleted, key)
+		}
+	}
+
+	// Archives are listed by name, not key
+	named := make([]Retention, len(policies))
+	for i, p := range policies {
+		named[i] = p
+		named[i].Prefix = m.store.Name(p.Prefix)
+	}
+	for _, a := range archives {
+		stored, err := a.Archives()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		names := make([]string, 0, len(stored))
+		for name := range stored {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := policyFor(named, name); ok && p.DeleteAfter > 0 && now.Sub(stored[name]) > p.DeleteAfter {
+				if err := a.DeleteArchive(name); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				res.Deleted = append(res.Deleted, path.Join("archive", name))
+			}
+		}
+	}
+	return res, errors.Join(errs...)
+}
+
+// prune applies its policy to one session, rereading it under its lock in
+// case another process or run changed it.
+func (m *Manager) prune(key string, policies []Retention, archives []Archive, now time.Time) (archived, deleted bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := m.store.Name(key)
+	unlock, err := m.lock(name)
+	if err != nil {
+		return false, false, err
+	}
+	defer unlock()
+	if err := m.refresh(name); err != nil {
+		return false, false, err
+	}
+
+	s, ok := m.sessions[key]
+	if !ok {
+		return false, false, nil
+	}
+	p, ok := policyFor(policies, key)
+	idle := now.Sub(s.Updated)
+	switch {
+	case !ok || s.Checkpoint != nil:
+	case p.DeleteAfter > 0 && idle > p.DeleteAfter:
+		return false, true, m.remove(key)
+	case len(archives) > 0 && p.ArchiveAfter > 0 && idle > p.ArchiveAfter:
+		if err := m.archiveSession(archives[0], s); err != nil {
+			return false, false, fmt.Errorf("archive: %w", err)
+		}
+		return true, false, nil
+	}
+	return false, false, nil
+}
+
+// archives returns where sessions are archived: first the archive new ones
+// go to, then the store's own if that is another.
+func (m *Manager) archives() []Archive {
+	var out []Archive
+	if m.archive != nil {
+		out = append(out, m.archive)
+	}
+	if as, ok := m.store.(ArchiveStore); ok && Archive(as) != m.archive {
+		out = append(out, as)
+	}
+	return out
+}
+
+// archiveSession compresses s into the archive, encrypted if the manager
+// encrypts sessions, and removes it from the live sessions. The caller
+// holds m.mu and the store lock.
+func (m *Manager) archiveSession(to Archive, s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	data = buf.Bytes()
+
+	name := stampArchive(m.store.Name(s.Key), s.Updated)
+	if m.cipher != nil {
+		if data, err = m.cipher.seal(name+encryptedArchiveExt, data); err != nil {
+			return err
+		}
+	}
+	if err := to.Archive(name, data, s.Updated); err != nil {
+		return err
+	}
+	return m.remove(s.Key)
+}
+
+// archiveStamp is the layout of the last update in archive names.
+const archiveStamp = "20060102T150405.000Z"
+
+// stampArchive returns the archive name for the session stored under
+// name, last updated at updated.
+func stampArchive(name string, updated time.Time) string {
+	return name + "@" + updated.UTC().Format(archiveStamp)
+}
+
+// archivedName returns the name of the session archived as archive. Names
+// archived before they were stamped are the session's own.
+func archivedName(archive string) string {
+	if i := strings.LastIndex(archive, "@"); i >= 0 {
+		if _, err := time.Parse(archiveStamp, archive[i+1:]); err == nil {
+			return archive[:i]
+		}
+	}
+	return archive
+}
+
+// latestArchive returns the newest archive of the session stored under
+// name in a, or "" if a has none.
+func latestArchive(a Archive, name string) (string, error) {
+	stored, err := a.Archives()
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for archive := range stored {
+		// Stamps sort in time order, after an unstamped name
+		if archivedName(archive) == name && archive > latest {
+			latest = archive
+		}
+	}
+	return latest, nil
+}
+
+// Restore moves the newest archive of a session back among the live ones.
+// Older archives of the same key stay archived.
+func (m *Manager) Restore(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := m.store.Name(key)
+	unlock, err := m.lock(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := m.refresh(name); err != nil {
+		return err
+	}
+	if _, exists := m.sessions[key]; exists {
+		return fmt.Errorf("session: %s already exists", key)
+	}
+	var from Archive
+	var archive string
+	var data []byte
+	for _, a := range m.archives() {
+		if archive, err = latestArchive(a, name); err != nil {
+			return err
+		}
+		if archive == "" {
+			continue
+		}
+		if data, err = a.Archived(archive); err != nil {
+			return err
+		}
+		if data != nil {
+			from = a
+			break
+		}
+	}
+	if from == nil {
+		return fmt.Errorf("session: %s is not archived", key)
+	}
+	data, err = m.open(archive+encryptedArchiveExt, data)
+	if err != nil {
+		return err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("session: read archive %s: %w", archive, err)
+	}
+	if data, err = io.ReadAll(zr); err != nil {
+		return fmt.Errorf("session: read archive %s: %w", archive, err)
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("session: read archive %s: %w", archive, err)
+	}
+
+	m.sessions[s.Key] = &s
+	if err := m.save(s.Key); err != nil {
+		delete(m.sessions, s.Key)
+		return err
+	}
+	return from.DeleteArchive(archive)
+}
+
+// remove deletes a session from memory and the store. The caller holds
+// m.mu and the store lock.
+func (m *Manager) remove(key string) error {
+	name := m.store.Name(key)
+	delete(m.sessions, key)
+	delete(m.errs, name)
+	defer m.setVersion(name)
+	return m.store.Delete(name)
+}
@@ -0,0 +1,181 @@
+package session
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+const day = 24 * time.Hour
+
+func TestPrune(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManager(dir)
+	for _, key := range []string{"main", "slack:C1", "keep:x", "resumable"} {
+		m.AddMessage(key, provider.Message{Role: "user", Content: "hi from " + key})
+	}
+	m.SetCheckpoint("resumable", &Checkpoint{Prompt: "hi"})
+	policies := []Retention{
+		{ArchiveAfter: 7 * day, DeleteAfter: 30 * day},
+		{Prefix: "slack:", DeleteAfter: 3 * day},
+		{Prefix: "keep:"},
+	}
+	now := time.Now()
+
+	res, err := m.Prune(policies, now.Add(5*day))
+	if err != nil || !slices.Equal(res.Deleted, []string{"slack:C1"}) || len(res.Archived) != 0 {
+		t.Fatalf("after 5 days: %+v, %v", res, err)
+	}
+
+	res, err = m.Prune(policies, now.Add(10*day))
+	if err != nil || !slices.Equal(res.Archived, []string{"main"}) || len(res.Deleted) != 0 {
+		t.Fatalf("after 10 days: %+v, %v", res, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, archiveDir, "main@*"+archiveExt)); len(files) != 1 {
+		t.Errorf("archive files = %v", files)
+	}
+	if NewManager(dir).MessageCount("main") != 0 || len(m.List()) != 2 {
+		t.Errorf("archived session still listed: %+v", m.List())
+	}
+
+	if err := m.Restore("main"); err != nil {
+		t.Fatal(err)
+	}
+	if h := NewManager(dir).GetHistory("main"); len(h) != 1 || h[0].Content != "hi from main" {
+		t.Errorf("restored history = %+v", h)
+	}
+	if err := m.Restore("main"); err == nil {
+		t.Error("restored a session that exists")
+	}
+
+	m.Prune(policies, now.Add(10*day))
+	res, err = m.Prune(policies, now.Add(40*day))
+	if err != nil || len(res.Deleted) != 1 || !strings.HasPrefix(res.Deleted[0], "archive/main@") {
+		t.Fatalf("after 40 days: %+v, %v", res, err)
+	}
+	if err := m.Restore("main"); err == nil {
+		t.Error("restored a deleted archive")
+	}
+	if keys := []string{m.List()[0].Key, m.List()[1].Key}; !slices.Contains(keys, "keep:x") || !slices.Contains(keys, "resumable") {
+		t.Errorf("kept sessions = %v", keys)
+	}
+}
+
+func TestPruneEncrypted(t *testing.T) {
+	dir := tempDir(t)
+	c := testCipher(t, 1)
+	m := NewManager(dir, WithCipher(c))
+	m.AddMessage("secret", provider.Message{Role: "user", Content: "api key is hunter2"})
+	if _, err := m.Prune([]Retention{{ArchiveAfter: day}}, time.Now().Add(2*day)); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, archiveDir, "secret@*"+encryptedArchiveExt))
+	if len(files) != 1 {
+		t.Fatalf("archive files = %v", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil || bytes.Contains(data, []byte("hunter2")) {
+		t.Fatalf("archive = %q, %v", data, err)
+	}
+	if err := NewManager(dir, WithCipher(testCipher(t, 2))).Restore("secret"); err == nil {
+		t.Error("restored with the wrong key")
+	}
+	if err := m.Restore("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if h := m.GetHistory("secret"); len(h) != 1 || h[0].Content != "api key is hunter2" {
+		t.Errorf("restored history = %+v", h)
+	}
+}
+
+// memArchive is an Archive in memory.
+type memArchive map[string][]byte
+
+func (a memArchive) Archive(name string, data []byte, _ time.Time) error {
+	a[name] = data
+	return nil
+}
+func (a memArchive) Archived(name string) ([]byte, error) { return a[name], nil }
+func (a memArchive) DeleteArchive(name string) error      { delete(a, name); return nil }
+func (a memArchive) Archives() (map[string]time.Time, error) {
+	out := make(map[string]time.Time)
+	for name := range a {
+		out[name] = time.Now().Add(100 * day)
+	}
+	return out, nil
+}
+
+func TestPruneWithArchive(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManager(dir)
+	m.AddMessage("old", provider.Message{Role: "user", Content: "hi"})
+	m.Prune([]Retention{{ArchiveAfter: day}}, time.Now().Add(2*day))
+
+	// A session the store archived before can still be restored
+	a := memArchive{}
+	m = NewManager(dir, WithArchive(a))
+	m.AddMessage("main", provider.Message{Role: "user", Content: "hi"})
+	res, err := m.Prune([]Retention{{ArchiveAfter: day}}, time.Now().Add(2*day))
+	if err != nil || !slices.Equal(res.Archived, []string{"main"}) || len(a) != 1 {
+		t.Fatalf("Prune = %+v, %v; archive = %v", res, err, a)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, archiveDir, "main*")); len(files) != 0 {
+		t.Errorf("archived to the store too: %v", files)
+	}
+	for _, key := range []string{"main", "old"} {
+		if err := m.Restore(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(a) != 0 || len(m.List()) != 2 {
+		t.Errorf("after restore: archive = %v, sessions = %+v", a, m.List())
+	}
+}
+
+func TestPruneReusedKey(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManager(dir)
+	policies := []Retention{{ArchiveAfter: day}}
+	m.AddMessage("main", provider.Message{Role: "user", Content: "first"})
+	if _, err := m.Prune(policies, time.Now().Add(2*day)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond) // So the second session's last update differs
+	m.AddMessage("main", provider.Message{Role: "user", Content: "second"})
+	if _, err := m.Prune(policies, time.Now().Add(2*day)); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, archiveDir, "main@*")); len(files) != 2 {
+		t.Fatalf("archive files = %v; want one per archiving", files)
+	}
+	for _, want := range []string{"second", "first"} {
+		if err := m.Restore("main"); err != nil {
+			t.Fatal(err)
+		}
+		if h := m.GetHistory("main"); len(h) != 1 || h[0].Content != want {
+			t.Errorf("restored history = %+v; want %q", h, want)
+		}
+		m.Delete("main")
+	}
+}
+
+func TestArchivedName(t *testing.T) {
+	stamped := stampArchive("email_<a@b>", time.Now())
+	for archive, want := range map[string]string{
+		stamped:       "email_<a@b>",
+		"email_<a@b>": "email_<a@b>", // Archived before names were stamped
+		"main":        "main",
+	} {
+		if got := archivedName(archive); got != want {
+			t.Errorf("archivedName(%q) = %q, want %q", archive, got, want)
+		}
+	}
+}
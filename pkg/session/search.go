@@ -0,0 +1,96 @@
+package session
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// snippetRadius is how many bytes of context Search keeps around a hit.
+const snippetRadius = 60
+
+// Match is one message that satisfied a Search query.
+type Match struct {
+	Key     string    `json:"key"`
+	Index   int       `json:"index"` // Position in the session's messages
+	Role    string    `json:"role"`
+	Snippet string    `json:"snippet"`
+	Updated time.Time `json:"updated"` // Session's last update
+}
+
+// Search returns messages containing every whitespace-separated term of
+// query, case-insensitively. Tool call names and arguments are searched
+// along with content. Results are ordered by most recently updated
+// session, then by message position.
+func (m *Manager) Search(query string) []Match {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refreshAll()
+	var out []Match
+	for _, s := range m.sessions {
+		for i, msg := range s.Messages {
+			text := msg.Content
+			for _, tc := range msg.ToolCalls {
+				text += "\n" + tc.Name + "(" + tc.Arguments + ")"
+			}
+			lower := strings.ToLower(text)
+			if !containsAll(lower, terms) {
+				continue
+			}
+			out = append(out, Match{
+				Key:     s.Key,
+				Index:   i,
+				Role:    msg.Role,
+				Snippet: snippet(text, strings.Index(lower, terms[0]), len(terms[0])),
+				Updated: s.Updated,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Updated.Equal(out[j].Updated) {
+			return out[i].Updated.After(out[j].Updated)
+		}
+		if out[i].Key != out[j].Key {
+			return out[i].Key < out[j].Key
+		}
+		return out[i].Index < out[j].Index
+	})
+	return out
+}
+
+func containsAll(s string, terms []string) bool {
+	for _, t := range terms {
+		if !strings.Contains(s, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// snippet returns text around [at, at+n) on a single line, with ellipses
+// where it was cut.
+func snippet(text string, at, n int) string {
+	start := max(at-snippetRadius, 0)
+	end := min(at+n+snippetRadius, len(text))
+	// Don't cut inside a UTF-8 sequence.
+	for start > 0 && start < len(text) && text[start]&0xC0 == 0x80 {
+		start--
+	}
+	for end < len(text) && text[end]&0xC0 == 0x80 {
+		end++
+	}
+	out := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		out = "..." + out
+	}
+	if end < len(text) {
+		out += "..."
+	}
+	return out
+}
@@ -2,14 +2,17 @@
 package session
 
 import (
+	"context"
 	"encoding/json"
-	"os"
-	"path/filepath"
-	"strings"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/redact"
 )
 
 // Session holds conversation state.
@@ -17,33 +20,110 @@ type Session struct {
 	Key      string             `json:"key"`
 	Messages []provider.Message `json:"messages"`
 	Summary  string             `json:"summary,omitempty"`
+	Parent   string             `json:"parent,omitempty"`    // Session this was forked from
+	ForkedAt int                `json:"forked_at,omitempty"` // Parent message count at the fork
+	CostUSD  float64            `json:"cost_usd,omitempty"`  // Estimated spend on LLM calls
 	Created  time.Time          `json:"created"`
 	Updated  time.Time          `json:"updated"`
+
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"` // Unfinished run, if the loop checkpoints runs
 }
 
-// Manager handles session CRUD and persistence.
+// Manager handles session CRUD and persistence. Every change is written
+// to the session's journal as it is made and folded into its snapshot by
+// Save. The store's lock keeps processes sharing it from writing at once,
+// and each one rereads a session another has changed before using it, so
+// two processes, or two runs, on the same key add to one history instead
+// of overwriting each other's.
 type Manager struct {
 	sessions map[string]*Session
-	mu       sync.RWMutex
-	dir      string
+	mu       sync.Mutex
+	store    Store
+	archive  Archive          // Where Prune archives to (nil = the store, if it can)
+	cipher   *Cipher          // nil stores plaintext JSON
+	redactor *redact.Redactor // nil stores messages as given
+
+	versions map[string]string // Store versions as last loaded or written, by name
+	errs     map[string]error  // Journal write failures, returned by the next Save
+	broken   map[string]error  // Names whose stored session can't be read, which are never overwritten
+
+	watching bool               // The store's change notifications are being received (see Notifier)
+	stale    map[string]bool    // Names changed by other processes since they were loaded
+	stop     context.CancelFunc // Stops the notifications
+
+	usage UsageFunc // Token counts for Stats (nil = none)
 }
 
 // NewManager creates a session manager backed by a directory.
-func NewManager(dir string) *Manager {
-	os.MkdirAll(dir, 0755)
+func NewManager(dir string, opts ...Option) *Manager {
+	m := newManager(opts)
+	m.store = newFileStore(dir, m.cipher != nil)
+	m.refreshAll()
+	return m
+}
+
+// NewManagerWithStore creates a session manager backed by s, which Close
+// closes if it has a Close method. If s is a Notifier, the manager follows
+// its notifications until then.
+func NewManagerWithStore(s Store, opts ...Option) *Manager {
+	m := newManager(opts)
+	m.store = s
+	if n, ok := s.(Notifier); ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		if changes, err := n.Changes(ctx); err == nil {
+			m.watching, m.stop = true, cancel
+			go m.watch(changes)
+		} else {
+			cancel()
+		}
+	}
+	m.refreshAll()
+	return m
+}
+
+func newManager(opts []Option) *Manager {
 	m := &Manager{
 		sessions: make(map[string]*Session),
-		dir:      dir,
+		versions: make(map[string]string),
+		errs:     make(map[string]error),
+		broken:   make(map[string]error),
+		stale:    make(map[string]bool),
+		stop:     func() {},
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
-	m.loadAll()
 	return m
 }
 
+// Close stops following the store's change notifications and closes the
+// store.
+func (m *Manager) Close() error {
+	m.stop()
+	if c, ok := m.store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// WithArchive makes Prune archive sessions to a rather than the store.
+// Restore still finds sessions the store archived before.
+func WithArchive(a Archive) Option {
+	return func(m *Manager) { m.archive = a }
+}
+
+// WithRedactor masks secrets in messages and summaries as they are added,
+// so they are neither saved nor sent back to the model on later turns.
+func WithRedactor(r *redact.Redactor) Option {
+	return func(m *Manager) { m.redactor = r }
+}
+
 // GetHistory returns message history for a session.
 func (m *Manager) GetHistory(key string) []provider.Message {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	m.view(key)
 	s, ok := m.sessions[key]
 	if !ok {
 		return nil
@@ -55,9 +135,10 @@ func (m *Manager) GetHistory(key string) []provider.Message {
 
 // GetSummary returns the session's compaction summary.
 func (m *Manager) GetSummary(key string) string {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	m.view(key)
 	if s, ok := m.sessions[key]; ok {
 		return s.Summary
 	}
@@ -69,113 +150,245 @@ func (m *Manager) AddMessage(key string, msg provider.Message) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	s := m.getOrCreate(key)
-	s.Messages = append(s.Messages, msg)
-	s.Updated = time.Now()
+	msg = m.redactor.Message(msg)
+	m.update(record{Op: opMessage, Key: key, Message: &msg})
 }
 
-// SetSummary sets the compaction summary and truncates history.
+// SetSummary sets the compaction summary and truncates history to the
+// last keepLast messages. Compact computes both with a Summarizer.
 func (m *Manager) SetSummary(key string, summary string, keepLast int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	s := m.getOrCreate(key)
-	s.Summary = summary
-	if keepLast > 0 && len(s.Messages) > keepLast {
-		s.Messages = s.Messages[len(s.Messages)-keepLast:]
-	}
-	s.Updated = time.Now()
+	m.update(record{Op: opSummary, Key: key, Summary: m.redactor.String(summary), KeepLast: keepLast})
 }
 
 // MessageCount returns how many messages are in a session.
 func (m *Manager) MessageCount(key string) int {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
+	m.view(key)
 	if s, ok := m.sessions[key]; ok {
 		return len(s.Messages)
 	}
 	return 0
 }
 
-// Save persists a session to disk.
-func (m *Manager) Save(key string) error {
-	m.mu.RLock()
-	s, ok := m.sessions[key]
-	if !ok {
-		m.mu.RUnlock()
-		return nil
+// AddCost adds usd to the session's running cost.
+func (m *Manager) AddCost(key string, usd float64) {
+	if usd == 0 {
+		return
 	}
-	// Snapshot
-	snapshot := Session{
-		Key:      s.Key,
-		Summary:  s.Summary,
-		Created:  s.Created,
-		Updated:  s.Updated,
-		Messages: make([]provider.Message, len(s.Messages)),
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.update(record{Op: opCost, Key: key, CostUSD: usd})
+}
+
+// Cost returns the session's estimated spend in USD.
+func (m *Manager) Cost(key string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.view(key)
+	if s, ok := m.sessions[key]; ok {
+		return s.CostUSD
 	}
-	copy(snapshot.Messages, s.Messages)
-	m.mu.RUnlock()
+	return 0
+}
 
-	data, err := json.MarshalIndent(snapshot, "", "  ")
+// Info describes a stored session without its messages.
+type Info struct {
+	Key      string    `json:"key"`
+	Parent   string    `json:"parent,omitempty"`
+	Messages int       `json:"messages"`
+	CostUSD  float64   `json:"cost_usd,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+// List returns all sessions, most recently updated first.
+func (m *Manager) List() []Info {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refreshAll()
+	out := make([]Info, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		out = append(out, Info{Key: s.Key, Parent: s.Parent, Messages: len(s.Messages), CostUSD: s.CostUSD, Created: s.Created, Updated: s.Updated})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Updated.After(out[j].Updated) })
+	return out
+}
+
+// Delete removes a session from memory and the store.
+func (m *Manager) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unlock, err := m.lock(m.store.Name(key))
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	filename := sanitize(key) + ".json"
-	path := filepath.Join(m.dir, filename)
+	return m.remove(key)
+}
+
+// Fork copies the first atMessageIndex messages of srcKey (and its summary)
+// into a new session newKey and saves it, leaving srcKey untouched. Pass
+// MessageCount(srcKey) to fork the whole conversation. The cut may not
+// separate an assistant's tool calls from their results.
+func (m *Manager) Fork(srcKey, newKey string, atMessageIndex int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	// Atomic write
-	tmp, err := os.CreateTemp(m.dir, "session-*.tmp")
+	// The source is only read, so it is unlocked before the fork is
+	// written, and no two locks are held at once.
+	src, err := m.snapshot(srcKey)
 	if err != nil {
 		return err
 	}
-	tmpPath := tmp.Name()
-	defer os.Remove(tmpPath)
+	if src == nil {
+		return fmt.Errorf("session: unknown session %s", srcKey)
+	}
+	if atMessageIndex < 0 || atMessageIndex > len(src.Messages) {
+		return fmt.Errorf("session: fork index %d out of range [0, %d]", atMessageIndex, len(src.Messages))
+	}
+	if splitsToolCall(src.Messages, atMessageIndex) {
+		return fmt.Errorf("session: fork index %d splits a tool call from its results", atMessageIndex)
+	}
 
-	if _, err := tmp.Write(data); err != nil {
-		tmp.Close()
+	unlock, err := m.lock(m.store.Name(newKey))
+	if err != nil {
 		return err
 	}
-	tmp.Close()
+	defer unlock()
+	if err := m.refresh(m.store.Name(newKey)); err != nil {
+		return err
+	}
+	if _, exists := m.sessions[newKey]; exists {
+		return fmt.Errorf("session: %s already exists", newKey)
+	}
 
-	return os.Rename(tmpPath, path)
+	now := time.Now()
+	fork := &Session{
+		Key:      newKey,
+		Messages: append([]provider.Message(nil), src.Messages[:atMessageIndex]...),
+		Summary:  src.Summary,
+		Parent:   srcKey,
+		ForkedAt: atMessageIndex,
+		Created:  now,
+		Updated:  now,
+	}
+	m.sessions[newKey] = fork
+	return m.save(newKey)
 }
 
-func (m *Manager) getOrCreate(key string) *Session {
+// snapshot rereads the session stored under key under its lock and
+// returns a copy, or nil if there is none. The caller holds m.mu.
+func (m *Manager) snapshot(key string) (*Session, error) {
+	name := m.store.Name(key)
+	unlock, err := m.lock(name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := m.refresh(name); err != nil {
+		return nil, err
+	}
 	s, ok := m.sessions[key]
 	if !ok {
-		s = &Session{
-			Key:     key,
-			Created: time.Now(),
-			Updated: time.Now(),
-		}
-		m.sessions[key] = s
+		return nil, nil
 	}
-	return s
+	c := *s
+	c.Messages = append([]provider.Message(nil), s.Messages...)
+	return &c, nil
+}
+
+// splitsToolCall reports whether cutting msgs at i leaves tool calls
+// without results or results without their calls. A full copy never splits.
+func splitsToolCall(msgs []provider.Message, i int) bool {
+	if i == len(msgs) {
+		return false
+	}
+	return (i > 0 && len(msgs[i-1].ToolCalls) > 0) || msgs[i].Role == "tool"
 }
 
-func (m *Manager) loadAll() {
-	entries, err := os.ReadDir(m.dir)
+// Save writes a session's snapshot, with any changes other processes
+// have journaled, and clears its journal. It also returns any error
+// writing the journal since the last Save. A stored session that can't be
+// read is left as it is, and Save fails.
+func (m *Manager) Save(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := m.store.Name(key)
+	unlock, err := m.lock(name)
 	if err != nil {
-		return
+		return errors.Join(m.errs[name], err)
 	}
-	for _, e := range entries {
-		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
-			continue
-		}
-		data, err := os.ReadFile(filepath.Join(m.dir, e.Name()))
-		if err != nil {
-			continue
+	defer unlock()
+
+	if err := m.refresh(name); err != nil {
+		return errors.Join(m.errs[name], err)
+	}
+	err = m.errs[name]
+	delete(m.errs, name)
+	return errors.Join(err, m.save(key))
+}
+
+// save writes a session's snapshot and clears its journal. The caller
+// holds m.mu and the store lock.
+func (m *Manager) save(key string) error {
+	s, ok := m.sessions[key]
+	if !ok {
+		return nil
+	}
+	name := m.store.Name(key)
+	if err := m.broken[name]; err != nil {
+		return fmt.Errorf("session: not overwriting unreadable %s: %w", name, err)
+	}
+	defer m.setVersion(name)
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if m.cipher != nil {
+		if data, err = m.cipher.seal(name+encryptedExt, data); err != nil {
+			return err
 		}
-		var s Session
-		if err := json.Unmarshal(data, &s); err != nil {
-			continue
+	}
+	return m.store.Save(name, data)
+}
+
+// SaveAll persists every session, e.g. before the process exits.
+func (m *Manager) SaveAll() error {
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.sessions))
+	for key := range m.sessions {
+		keys = append(keys, key)
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, key := range keys {
+		if err := m.Save(key); err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", key, err))
 		}
-		m.sessions[s.Key] = &s
 	}
+	return errors.Join(errs...)
 }
 
-func sanitize(key string) string {
-	return strings.ReplaceAll(key, ":", "_")
+func (m *Manager) getOrCreate(key string) *Session {
+	s, ok := m.sessions[key]
+	if !ok {
+		s = &Session{
+			Key:     key,
+			Created: time.Now(),
+			Updated: time.Now(),
+		}
+		m.sessions[key] = s
+	}
+	return s
 }
@@ -3,9 +3,11 @@ package session
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/redact"
 )
 
 func tempDir(t *testing.T) string {
@@ -100,6 +102,21 @@ func TestSaveAndReload(t *testing.T) {
 	}
 }
 
+func TestSaveAll(t *testing.T) {
+	d := tempDir(t)
+	m := NewManager(d)
+	m.AddMessage("a", provider.Message{Role: "user", Content: "one"})
+	m.AddMessage("b", provider.Message{Role: "user", Content: "two"})
+	if err := m.SaveAll(); err != nil {
+		t.Fatalf("save all: %v", err)
+	}
+
+	m2 := NewManager(d)
+	if m2.MessageCount("a") != 1 || m2.MessageCount("b") != 1 {
+		t.Fatalf("reload: a=%d b=%d messages", m2.MessageCount("a"), m2.MessageCount("b"))
+	}
+}
+
 func TestSaveNonexistent(t *testing.T) {
 	m := NewManager(tempDir(t))
 	if err := m.Save("nope"); err != nil {
@@ -112,3 +129,221 @@ func TestSanitize(t *testing.T) {
 		t.Fatalf("sanitize failed: %s", sanitize("a:b:c"))
 	}
 }
+
+func TestAddCost(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManager(dir)
+	m.AddMessage("s", provider.Message{Role: "user", Content: "hi"})
+	m.AddCost("s", 0.25)
+	m.AddCost("s", 0.5)
+	m.Save("s")
+
+	if got := NewManager(dir).Cost("s"); got != 0.75 {
+		t.Errorf("reloaded cost = %v, want 0.75", got)
+	}
+	if got := m.List()[0].CostUSD; got != 0.75 {
+		t.Errorf("Info.CostUSD = %v, want 0.75", got)
+	}
+	if got := m.Cost("missing"); got != 0 {
+		t.Errorf("missing session cost = %v", got)
+	}
+}
+
+func TestListAndDelete(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManager(dir)
+	m.AddMessage("old", provider.Message{Role: "user", Content: "a"})
+	m.AddMessage("new", provider.Message{Role: "user", Content: "b"})
+	m.AddMessage("new", provider.Message{Role: "assistant", Content: "c"})
+	m.Save("old")
+	m.Save("new")
+
+	list := m.List()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(list))
+	}
+	if list[0].Key != "new" || list[0].Messages != 2 {
+		t.Errorf("expected most recent first, got %+v", list[0])
+	}
+
+	if err := m.Delete("old"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.json")); !os.IsNotExist(err) {
+		t.Error("session file not removed")
+	}
+	if len(NewManager(dir).List()) != 1 {
+		t.Error("deleted session reloaded from disk")
+	}
+	if err := m.Delete("missing"); err != nil {
+		t.Errorf("deleting missing session should not error: %v", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	m := NewManager(tempDir(t))
+	m.AddMessage("infra", provider.Message{Role: "user", Content: "Should we use Postgres or SQLite?"})
+	m.AddMessage("infra", provider.Message{Role: "assistant", Content: "Decision: use SQLite for the eval store."})
+	m.AddMessage("other", provider.Message{Role: "assistant", ToolCalls: []provider.ToolCall{
+		{ID: "1", Name: "shell.run", Arguments: `{"command":"sqlite3 eval.db"}`},
+	}})
+	m.AddMessage("other", provider.Message{Role: "user", Content: "unrelated"})
+
+	got := m.Search("decision SQLITE")
+	if len(got) != 1 {
+		t.Fatalf("expected 1 match, got %+v", got)
+	}
+	if got[0].Key != "infra" || got[0].Index != 1 || got[0].Role != "assistant" {
+		t.Errorf("unexpected match: %+v", got[0])
+	}
+	if got[0].Snippet != "Decision: use SQLite for the eval store." {
+		t.Errorf("snippet = %q", got[0].Snippet)
+	}
+
+	if got := m.Search("sqlite"); len(got) != 3 {
+		t.Errorf("expected content and tool call matches, got %+v", got)
+	}
+	if got := m.Search("   "); got != nil {
+		t.Errorf("empty query returned %+v", got)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("a ", 100) + "needle" + strings.Repeat(" b", 100)
+	got := snippet(text, strings.Index(text, "needle"), len("needle"))
+	if !strings.HasPrefix(got, "...") || !strings.HasSuffix(got, "...") || !strings.Contains(got, "needle") {
+		t.Errorf("snippet = %q", got)
+	}
+}
+
+func TestFork(t *testing.T) {
+	dir := tempDir(t)
+	m := NewManager(dir)
+	m.AddMessage("main", provider.Message{Role: "user", Content: "plan A or B?"})
+	m.AddMessage("main", provider.Message{Role: "assistant", ToolCalls: []provider.ToolCall{{ID: "1", Name: "fs.read"}}})
+	m.AddMessage("main", provider.Message{Role: "tool", Content: "file", ToolCallID: "1"})
+	m.AddMessage("main", provider.Message{Role: "assistant", Content: "going with A"})
+	m.SetSummary("main", "earlier context", 0)
+
+	if err := m.Fork("main", "try-b", 1); err != nil {
+		t.Fatalf("fork: %v", err)
+	}
+	if h := m.GetHistory("try-b"); len(h) != 1 || h[0].Content != "plan A or B?" {
+		t.Errorf("fork history = %+v", h)
+	}
+	if m.GetSummary("try-b") != "earlier context" {
+		t.Error("summary not copied")
+	}
+	m.AddMessage("try-b", provider.Message{Role: "user", Content: "use B"})
+	if m.MessageCount("main") != 4 {
+		t.Error("fork modified the source session")
+	}
+
+	// The fork's snapshot, plus the message journaled since
+	reloaded := NewManager(dir)
+	if reloaded.MessageCount("try-b") != 2 {
+		t.Errorf("reloaded fork has %d messages, want 2", reloaded.MessageCount("try-b"))
+	}
+	for _, info := range reloaded.List() {
+		if info.Key == "try-b" && info.Parent != "main" {
+			t.Errorf("parent = %q, want main", info.Parent)
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		src, dst string
+		at       int
+	}{
+		{"unknown source", "missing", "x", 0},
+		{"existing target", "main", "try-b", 0},
+		{"out of range", "main", "x", 5},
+		{"splits tool call", "main", "x", 2},
+	} {
+		if err := m.Fork(tt.src, tt.dst, tt.at); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+	if err := m.Fork("main", "full", m.MessageCount("main")); err != nil {
+		t.Errorf("full fork: %v", err)
+	}
+}
+
+func TestWithRedactor(t *testing.T) {
+	r, err := redact.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	m := NewManager(dir, WithRedactor(r))
+	key := "ghp_" + strings.Repeat("a", 36)
+	m.AddMessage("s", provider.Message{Role: "tool", Content: "token: " + key})
+	m.AddMessage("s", provider.Message{Role: "assistant", ToolCalls: []provider.ToolCall{{ID: "1", Name: "gh", Arguments: `{"token":"` + key + `"}`}}})
+	m.Save("s")
+
+	data, _ := os.ReadFile(filepath.Join(dir, "s.json"))
+	if strings.Contains(string(data), key) {
+		t.Errorf("saved session contains the secret: %s", data)
+	}
+	if h := m.GetHistory("s"); h[0].Content != "token: [REDACTED]" || h[1].ToolCalls[0].ID != "1" {
+		t.Errorf("history = %+v", h)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	r, err := redact.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	m := NewManager(dir, WithRedactor(r))
+	key := "ghp_" + strings.Repeat("a", 36)
+	m.AddMessage("s", provider.Message{Role: "user", Content: "deploy"})
+	m.SetCheckpoint("s", &Checkpoint{
+		Prompt:    "deploy",
+		Messages:  []provider.Message{{Role: "tool", Content: "token: " + key}},
+		Iteration: 2,
+		Pending:   []provider.ToolCall{{ID: "1", Name: "deploy.run"}},
+	})
+	m.SetCheckpoint("other", nil) // Clearing a missing session is a no-op
+	m.Save("s")
+
+	data, _ := os.ReadFile(filepath.Join(dir, "s.json"))
+	if strings.Contains(string(data), key) {
+		t.Errorf("saved checkpoint contains the secret: %s", data)
+	}
+	m = NewManager(dir)
+	if keys := m.Checkpointed(); len(keys) != 1 || keys[0] != "s" {
+		t.Errorf("Checkpointed = %v", keys)
+	}
+	cp := m.GetCheckpoint("s")
+	if cp == nil || cp.Iteration != 2 || len(cp.Pending) != 1 || cp.Messages[0].Content != "token: [REDACTED]" {
+		t.Fatalf("checkpoint = %+v", cp)
+	}
+
+	m.SetCheckpoint("s", nil)
+	if m.GetCheckpoint("s") != nil || len(m.Checkpointed()) != 0 {
+		t.Error("checkpoint not cleared")
+	}
+	if m.MessageCount("s") != 1 {
+		t.Error("clearing the checkpoint changed the history")
+	}
+}
+
+func TestAdvanceCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir)
+	m.AdvanceCheckpoint("s", []provider.Message{{Role: "tool"}}, 1, nil) // No checkpoint yet: a no-op
+	m.SetCheckpoint("s", &Checkpoint{Prompt: "deploy", Messages: []provider.Message{{Role: "user", Content: "deploy"}}})
+	m.AdvanceCheckpoint("s", []provider.Message{{Role: "assistant", Content: "calling"}}, 1, []provider.ToolCall{{ID: "1"}})
+	m.AdvanceCheckpoint("s", []provider.Message{{Role: "tool", Content: "ok", ToolCallID: "1"}}, 1, nil)
+
+	journal, _ := os.ReadFile(filepath.Join(dir, "s"+journalExt))
+	if n := strings.Count(string(journal), `"deploy"`); n != 2 { // The prompt and the first message, once
+		t.Errorf("journal repeats the checkpoint's messages:\n%s", journal)
+	}
+	cp := NewManager(dir).GetCheckpoint("s")
+	if cp == nil || len(cp.Messages) != 3 || cp.Messages[2].Content != "ok" || cp.Iteration != 1 || len(cp.Pending) != 0 {
+		t.Fatalf("checkpoint = %+v", cp)
+	}
+}
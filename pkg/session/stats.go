@@ -0,0 +1,86 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// Usage is the LLM usage recorded for a session outside it, e.g. in the
+// eval call store.
+type Usage struct {
+	Calls            int
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+}
+
+// UsageFunc looks up the usage recorded for a session key.
+type UsageFunc func(key string) (Usage, error)
+
+// SetUsage makes Stats join the token counts fn records for each session.
+// Without it, Stats reports no tokens.
+func (m *Manager) SetUsage(fn UsageFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage = fn
+}
+
+// Stats summarizes a session's size and spend.
+type Stats struct {
+	Key       string         `json:"key"`
+	Messages  int            `json:"messages"` // Kept in the history, so not those compacted into the summary
+	ByRole    map[string]int `json:"by_role"`
+	ToolCalls int            `json:"tool_calls"`
+	Compacted bool           `json:"compacted,omitempty"` // The history has a summary of earlier messages
+	CostUSD   float64        `json:"cost_usd"`            // The session's running cost
+
+	// From the usage source (see SetUsage)
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	RecordedCostUSD  float64 `json:"recorded_cost_usd"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// TotalTokens returns the prompt and completion tokens together.
+func (s Stats) TotalTokens() int {
+	return s.PromptTokens + s.CompletionTokens
+}
+
+// Stats returns the message counts, tokens, and cost of a session.
+func (m *Manager) Stats(key string) (Stats, error) {
+	m.mu.Lock()
+	m.view(key)
+	s, ok := m.sessions[key]
+	if !ok {
+		m.mu.Unlock()
+		return Stats{}, fmt.Errorf("session: unknown session %s", key)
+	}
+	st := Stats{
+		Key:       key,
+		Messages:  len(s.Messages),
+		ByRole:    make(map[string]int),
+		Compacted: s.Summary != "",
+		CostUSD:   s.CostUSD,
+		Created:   s.Created,
+		Updated:   s.Updated,
+	}
+	for _, msg := range s.Messages {
+		st.ByRole[msg.Role]++
+		st.ToolCalls += len(msg.ToolCalls)
+	}
+	usage := m.usage
+	m.mu.Unlock()
+
+	if usage == nil {
+		return st, nil
+	}
+	u, err := usage(key)
+	if err != nil {
+		return st, fmt.Errorf("session %s: usage: %w", key, err)
+	}
+	st.Calls, st.PromptTokens, st.CompletionTokens, st.RecordedCostUSD = u.Calls, u.PromptTokens, u.CompletionTokens, u.CostUSD
+	return st, nil
+}
@@ -0,0 +1,40 @@
+package session
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func TestStats(t *testing.T) {
+	m := NewManager(tempDir(t))
+	m.AddMessage("s1", provider.Message{Role: "user", Content: "list files"})
+	m.AddMessage("s1", provider.Message{Role: "assistant", ToolCalls: []provider.ToolCall{{ID: "1", Name: "fs.ls"}, {ID: "2", Name: "fs.ls"}}})
+	m.AddMessage("s1", provider.Message{Role: "tool", Content: "a", ToolCallID: "1"})
+	m.AddMessage("s1", provider.Message{Role: "tool", Content: "b", ToolCallID: "2"})
+	m.AddMessage("s1", provider.Message{Role: "assistant", Content: "a and b"})
+	m.AddCost("s1", 0.5)
+
+	st, err := m.Stats("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Messages != 5 || st.ByRole["tool"] != 2 || st.ByRole["assistant"] != 2 || st.ToolCalls != 2 || st.CostUSD != 0.5 || st.TotalTokens() != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+
+	m.SetUsage(func(key string) (Usage, error) {
+		if key != "s1" {
+			return Usage{}, errors.New("wrong key")
+		}
+		return Usage{Calls: 2, PromptTokens: 300, CompletionTokens: 30, CostUSD: 0.5}, nil
+	})
+	if st, err = m.Stats("s1"); err != nil || st.Calls != 2 || st.TotalTokens() != 330 || st.RecordedCostUSD != 0.5 {
+		t.Errorf("stats with usage = %+v, %v", st, err)
+	}
+
+	if _, err := m.Stats("missing"); err == nil {
+		t.Error("stats of a missing session")
+	}
+}
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// Store is where a Manager keeps sessions. Each session is stored under a
+// name as a snapshot and a journal of the changes made since, both opaque
+// to the store: the Manager encodes, and encrypts, them. NewManager keeps
+// sessions in a directory; NewManagerWithStore takes any other Store, such
+// as a Redis one shared by several daemons.
+type Store interface {
+	// Name returns the name key is stored under.
+	Name(key string) string
+	// Names lists the stored sessions, in no particular order.
+	Names() ([]string, error)
+	// Lock keeps other processes from reading or writing the session
+	// stored under name until unlock is called. A store may lock more than
+	// that session. It returns an error, rather than waiting forever, if
+	// the lock can't be taken.
+	Lock(name string) (unlock func(), err error)
+	// Version identifies what is stored under name, changing with every
+	// write. It is "" when nothing is.
+	Version(name string) (string, error)
+	// Snapshot returns the snapshot stored under name, or nil if there is
+	// none.
+	Snapshot(name string) ([]byte, error)
+	// Journal returns the journal entries stored under name, oldest first.
+	Journal(name string) ([][]byte, error)
+	// Append adds an entry, which holds no newlines, to name's journal.
+	Append(name string, entry []byte) error
+	// Save replaces the snapshot stored under name and clears its journal.
+	Save(name string, snapshot []byte) error
+	// Delete removes the snapshot and journal stored under name.
+	Delete(name string) error
+}
+
+// Archive keeps archived sessions apart from the live ones, for Prune and
+// Restore. A Manager archives into its store if that is an ArchiveStore,
+// or elsewhere, such as an object store, with WithArchive. Without either,
+// Prune leaves sessions it would archive in place.
+type Archive interface {
+	// Archive stores an archived session, last updated at updated, under
+	// name. Names are never reused, so an existing archive under name may
+	// be refused but must not be overwritten.
+	Archive(name string, data []byte, updated time.Time) error
+	// Archived returns the archive stored under name, or nil if there is
+	// none.
+	Archived(name string) ([]byte, error)
+	// Archives returns the last update of each archived session, by name.
+	// A store that can't keep the update may return when it archived the
+	// session instead.
+	Archives() (map[string]time.Time, error)
+	// DeleteArchive removes the archive stored under name.
+	DeleteArchive(name string) error
+}
+
+// ArchiveStore is a Store with its own Archive.
+type ArchiveStore interface {
+	Store
+	Archive
+}
+
+// Notifier is a Store that reports sessions other processes change. A
+// Manager on one only checks the store for changes to a session it has
+// loaded when told of one, rather than on every read, so a change is seen
+// as soon as its notification arrives.
+type Notifier interface {
+	Store
+	// Changes sends the name of each session another process changes
+	// until ctx is done or notifications stop, then closes the channel.
+	Changes(ctx context.Context) (<-chan string, error)
+}
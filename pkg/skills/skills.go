@@ -0,0 +1,201 @@
+// Package skills loads task-specific prompt packs. A skill lives in
+// <dir>/<name>/SKILL.md: YAML front matter describing when it applies,
+// followed by the guidance added to the system prompt for matching tasks.
+//
+//	---
+//	description: Cut and publish a release
+//	triggers: [release, "tag a version"]
+//	tools: [git.*, gh.release]
+//	---
+//	1. Update CHANGELOG.md ...
+package skills
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// FileName is the skill definition file inside a skill directory.
+const FileName = "SKILL.md"
+
+// Skill is a prompt pack for one kind of task.
+type Skill struct {
+	Name        string   `yaml:"name"`        // Default: the directory name
+	Description string   `yaml:"description"` // One line on what the skill covers
+	Triggers    []string `yaml:"triggers"`    // Words or phrases that select the skill (default: the name)
+	Tools       []string `yaml:"tools"`       // Allowed tool names or globs (empty = all tools)
+	Body        string   `yaml:"-"`           // Guidance for the system prompt
+	Dir         string   `yaml:"-"`           // Directory holding SKILL.md
+}
+
+// Load reads every <dir>/<name>/SKILL.md, sorted by name. A missing dir
+// yields no skills. Skills that fail to parse are logged and skipped.
+func Load(dir string) ([]*Skill, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("skills: read %s: %w", dir, err)
+	}
+
+	var out []*Skill
+	seen := make(map[string]string)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		skillDir := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(filepath.Join(skillDir, FileName))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.Printf("[skills] skipping %s: %v", skillDir, err)
+			continue
+		}
+		s, err := Parse(data)
+		if err != nil {
+			log.Printf("[skills] skipping %s: %v", skillDir, err)
+			continue
+		}
+		if s.Name == "" {
+			s.Name = e.Name()
+		}
+		if prev, ok := seen[s.Name]; ok {
+			log.Printf("[skills] skipping %s: name %q already used by %s", skillDir, s.Name, prev)
+			continue
+		}
+		seen[s.Name] = skillDir
+		s.Dir = skillDir
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Parse reads a SKILL.md. Front matter is optional; without it the whole
+// file is the body.
+func Parse(data []byte) (*Skill, error) {
+	s := &Skill{}
+	body := data
+	if rest, ok := bytes.CutPrefix(data, []byte("---\n")); ok {
+		front, after, found := bytes.Cut(rest, []byte("\n---"))
+		if !found {
+			return nil, fmt.Errorf("skills: unterminated front matter")
+		}
+		if err := yaml.Unmarshal(front, s); err != nil {
+			return nil, fmt.Errorf("skills: front matter: %w", err)
+		}
+		body = after
+	}
+	s.Body = strings.TrimSpace(string(body))
+	if s.Body == "" {
+		return nil, fmt.Errorf("skills: empty body")
+	}
+	return s, nil
+}
+
+// Match picks the skill for message. A message starting with "/<name>"
+// selects that skill outright. Otherwise the skill whose triggers appear
+// most often as whole words wins; ties go to the first skill. It returns
+// nil when nothing matches.
+func Match(skills []*Skill, message string) *Skill {
+	msg := strings.TrimSpace(message)
+	if cmd, ok := strings.CutPrefix(msg, "/"); ok {
+		name, _, _ := strings.Cut(cmd, " ")
+		for _, s := range skills {
+			if s.Name == name {
+				return s
+			}
+		}
+	}
+
+	words := splitWords(msg)
+	var best *Skill
+	bestScore := 0
+	for _, s := range skills {
+		triggers := s.Triggers
+		if len(triggers) == 0 {
+			triggers = []string{s.Name}
+		}
+		score := 0
+		for _, t := range triggers {
+			if containsPhrase(words, splitWords(t)) {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = s, score
+		}
+	}
+	return best
+}
+
+// AllowsTool reports whether the skill permits tool name. A nil skill, or
+// one without an allowlist, permits every tool.
+func (s *Skill) AllowsTool(name string) bool {
+	if s == nil || len(s.Tools) == 0 {
+		return true
+	}
+	for _, pattern := range s.Tools {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterTools returns the tool definitions the skill permits.
+func (s *Skill) FilterTools(defs []provider.ToolDef) []provider.ToolDef {
+	if s == nil || len(s.Tools) == 0 {
+		return defs
+	}
+	var out []provider.ToolDef
+	for _, d := range defs {
+		if s.AllowsTool(d.Name) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// splitWords lowercases text and splits it on anything but letters and
+// digits; "-" and "_" also separate words, so "code-review" matches
+// "code review".
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsPhrase reports whether phrase occurs as consecutive words.
+func containsPhrase(words, phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		match := true
+		for j, p := range phrase {
+			if words[i+j] != p {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
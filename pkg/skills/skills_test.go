@@ -0,0 +1,93 @@
+package skills
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func writeSkill(t *testing.T, dir, name, content string) {
+	t.Helper()
+	os.MkdirAll(filepath.Join(dir, name), 0755)
+	if err := os.WriteFile(filepath.Join(dir, name, FileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeSkill(t, dir, "release", "---\ndescription: Cut a release\ntriggers: [release, tag a version]\ntools: [git.*]\n---\n\nBump the version, then tag.\n")
+	writeSkill(t, dir, "code-review", "Read the diff first.")
+	writeSkill(t, dir, "broken", "---\ntriggers: [\n---\nbody")
+	writeSkill(t, dir, "empty", "---\ndescription: nothing\n---\n")
+	os.MkdirAll(filepath.Join(dir, "no-skill-file"), 0755)
+
+	got, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "code-review" || got[1].Name != "release" {
+		t.Fatalf("skills = %+v", got)
+	}
+	r := got[1]
+	if r.Description != "Cut a release" || len(r.Triggers) != 2 || r.Body != "Bump the version, then tag." || r.Dir != filepath.Join(dir, "release") {
+		t.Errorf("release = %+v", r)
+	}
+
+	if got, err := Load(filepath.Join(dir, "missing")); err != nil || got != nil {
+		t.Errorf("Load(missing) = %v, %v", got, err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	skills := []*Skill{
+		{Name: "code-review"},
+		{Name: "release", Triggers: []string{"release", "tag a version", "changelog"}},
+		{Name: "deploy", Triggers: []string{"deploy", "release"}},
+	}
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"please do a code review of this PR", "code-review"}, // Name as trigger, split on "-"
+		{"Release it and update the CHANGELOG", "release"},    // Two triggers beat one
+		{"deploy the changelog", "release"},                   // Tie goes to the first skill
+		{"/deploy now", "deploy"},                             // Explicit selection
+		{"tag a version", "release"},
+		{"releases are fun", ""}, // Whole words only
+		{"/unknown thing", ""},
+		{"hello", ""},
+	}
+	for _, tt := range tests {
+		got := Match(skills, tt.message)
+		name := ""
+		if got != nil {
+			name = got.Name
+		}
+		if name != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.message, name, tt.want)
+		}
+	}
+}
+
+func TestToolAllowlist(t *testing.T) {
+	defs := []provider.ToolDef{{Name: "git.status"}, {Name: "git.log"}, {Name: "shell.run"}}
+
+	s := &Skill{Name: "release", Tools: []string{"git.*"}}
+	if got := s.FilterTools(defs); len(got) != 2 || got[1].Name != "git.log" {
+		t.Errorf("FilterTools = %+v", got)
+	}
+	if s.AllowsTool("shell.run") {
+		t.Error("shell.run should not be allowed")
+	}
+
+	var none *Skill
+	if got := none.FilterTools(defs); len(got) != 3 || !none.AllowsTool("shell.run") {
+		t.Error("nil skill should allow every tool")
+	}
+	if !(&Skill{}).AllowsTool("shell.run") {
+		t.Error("skill without allowlist should allow every tool")
+	}
+}
@@ -0,0 +1,191 @@
+package summarize
+
+import (
+	"cmp"
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// Line prefixes of an extractive summary. Importance is read back from
+// them when a later compaction has to drop lines.
+const (
+	prefixUser      = "- User: "
+	prefixAssistant = "- Assistant: "
+	prefixCalled    = "- Called "
+	prefixResult    = "- Result: "
+	prefixError     = "- Error: "
+)
+
+// Extractive builds the summary from the messages themselves, without a
+// model: a line from each, clipped to LineChars, added to the previous
+// summary's lines. Once the summary passes MaxChars the oldest lines are
+// dropped, or with Weighted the least important.
+type Extractive struct {
+	MaxChars  int  // Default DefaultMaxChars
+	LineChars int  // Characters kept from each message (default 200)
+	Weighted  bool // Drop the least important lines first (see Importance)
+}
+
+// Summarize implements session.Summarizer.
+func (e *Extractive) Summarize(_ context.Context, previous string, msgs []provider.Message) (string, error) {
+	var lines []string
+	for l := range strings.SplitSeq(previous, "\n") {
+		if strings.TrimSpace(l) != "" {
+			lines = append(lines, l)
+		}
+	}
+	lineChars := cmp.Or(e.LineChars, 200)
+	for _, m := range msgs {
+		lines = append(lines, extract(m, lineChars)...)
+	}
+	scores := make([]float64, len(lines))
+	for i, l := range lines {
+		scores[i] = lineImportance(l)
+	}
+	keep := fit(lines, scores, cmp.Or(e.MaxChars, DefaultMaxChars), e.Weighted)
+	out := make([]string, len(keep))
+	for i, k := range keep {
+		out[i] = lines[k]
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// extract returns the summary lines of a message.
+func extract(m provider.Message, limit int) []string {
+	var lines []string
+	switch m.Role {
+	case "tool":
+		if failed(m.Content) {
+			lines = append(lines, prefixError+clip(strings.TrimPrefix(m.Content, "Error:"), limit))
+		} else {
+			lines = append(lines, prefixResult+clip(m.Content, limit))
+		}
+	case "user":
+		lines = append(lines, prefixUser+clip(m.Content, limit))
+	default:
+		if strings.TrimSpace(m.Content) != "" {
+			lines = append(lines, prefixAssistant+clip(m.Content, limit))
+		}
+		for _, tc := range m.ToolCalls {
+			lines = append(lines, prefixCalled+tc.Name+"("+clip(tc.Arguments, limit)+")")
+		}
+	}
+	return lines
+}
+
+// clip flattens s to one line of at most limit bytes.
+func clip(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= limit {
+		return s
+	}
+	cut := limit
+	for cut > 0 && !isRuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
+
+func isRuneStart(b byte) bool { return b&0xC0 != 0x80 }
+
+// failed reports whether a tool result is an error, as the loop formats
+// them.
+func failed(result string) bool {
+	return strings.HasPrefix(result, "Error:")
+}
+
+// Importance scores how much a message matters to a summary. Tool
+// outcomes score highest, failures above successes, then the calls that
+// produced them; text that records a decision or an instruction is raised,
+// and small talk scores zero.
+func Importance(m provider.Message) float64 {
+	switch {
+	case m.Role == "tool" && failed(m.Content):
+		return importance(prefixError, m.Content)
+	case m.Role == "tool":
+		return importance(prefixResult, m.Content)
+	case m.Role == "user":
+		return importance(prefixUser, m.Content)
+	case len(m.ToolCalls) > 0:
+		return importance(prefixCalled, m.Content)
+	default:
+		return importance(prefixAssistant, m.Content)
+	}
+}
+
+// lineImportance scores a line of an extractive summary by its prefix.
+func lineImportance(line string) float64 {
+	for _, p := range []string{prefixUser, prefixAssistant, prefixCalled, prefixResult, prefixError} {
+		if text, ok := strings.CutPrefix(line, p); ok {
+			return importance(p, text)
+		}
+	}
+	return importance(prefixAssistant, line)
+}
+
+// decisionWords mark text that records a decision, instruction, or
+// preference.
+var decisionWords = []string{
+	"decided", "decision", "agreed", "we'll", "we will", "let's", "go with", "chose", "instead",
+	"must", "should", "don't", "do not", "never", "always", "prefer", "deadline", "remember", "plan",
+}
+
+// smallTalk are replies that carry nothing worth summarizing on their own.
+var smallTalk = map[string]bool{
+	"hi": true, "hello": true, "hey": true, "thanks": true, "thank you": true, "thx": true, "ok": true,
+	"okay": true, "great": true, "cool": true, "nice": true, "sounds good": true, "got it": true,
+	"you're welcome": true, "no problem": true, "bye": true, "perfect": true, "awesome": true,
+}
+
+// importance scores text by the kind of line it would be.
+func importance(kind, text string) float64 {
+	var score float64
+	switch kind {
+	case prefixError:
+		return 4
+	case prefixResult:
+		return 3
+	case prefixCalled:
+		score = 2.5
+	case prefixUser:
+		score = 1.5
+	default:
+		score = 1
+	}
+	lower := strings.ToLower(text)
+	if kind != prefixCalled && strings.TrimSpace(text) != "" && isSmallTalk(lower) {
+		return 0
+	}
+	for _, w := range decisionWords {
+		if strings.Contains(lower, w) {
+			return score + 2
+		}
+	}
+	return score
+}
+
+// isSmallTalk reports whether lowercased text is a short pleasantry such
+// as "thanks!" or "ok, great".
+func isSmallTalk(lower string) bool {
+	if len(lower) > 40 {
+		return false
+	}
+	words := strings.FieldsFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) && r != '\'' })
+	if len(words) == 0 {
+		return true
+	}
+	for i := 0; i < len(words); {
+		switch {
+		case i+1 < len(words) && smallTalk[words[i]+" "+words[i+1]]:
+			i += 2
+		case smallTalk[words[i]]:
+			i++
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+// Package summarize condenses session history for compaction (see
+// session.Manager.Compact). Each strategy folds the messages being
+// compacted into the summary of those compacted before them:
+//
+//   - LLM has a model rewrite the summary with the messages folded in.
+//   - Rolling has a model summarize only the messages, and appends that.
+//   - Extractive keeps a line from each message, with no model at all.
+//
+// LLM and Extractive take a Weighted option that spends the space on
+// decisions and tool outcomes rather than small talk (see Importance).
+package summarize
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/session"
+)
+
+// DefaultMaxChars is the summary length strategies aim for when MaxChars
+// is unset.
+const DefaultMaxChars = 4000
+
+// toolResultChars caps each tool result in the transcript sent to a model.
+const toolResultChars = 2000
+
+var (
+	_ session.Summarizer = (*LLM)(nil)
+	_ session.Summarizer = (*Rolling)(nil)
+	_ session.Summarizer = (*Extractive)(nil)
+)
+
+const llmPrompt = `You are compacting the history of a conversation between a user and an AI assistant that uses tools.
+Write a summary of it in under %d characters that lets the assistant carry on without the messages.
+Keep facts, the user's requests and preferences, decisions made, and what tools did and found
+(paths, IDs, errors, results). Reply with the summary only.%s
+
+## Summary so far
+
+%s
+
+## Messages to add
+
+%s`
+
+// weightedNote steers a weighted LLM summary.
+const weightedNote = `
+Decisions and tool outcomes matter most; leave out greetings, thanks, and small talk.`
+
+// LLM has a model rewrite the previous summary with the new messages
+// folded in.
+type LLM struct {
+	Provider provider.Provider
+	Model    string // "" = the provider's default
+	MaxChars int    // Summary length asked for (default DefaultMaxChars)
+	MaxInput int    // Transcript characters sent per call, the oldest messages dropped first (default 20 × MaxChars)
+	Weighted bool   // Drop the least important messages first instead, and ask the model to favor decisions and tool outcomes
+}
+
+// Summarize implements session.Summarizer.
+func (l *LLM) Summarize(ctx context.Context, previous string, msgs []provider.Message) (string, error) {
+	maxChars := cmp.Or(l.MaxChars, DefaultMaxChars)
+	note := ""
+	if l.Weighted {
+		note = weightedNote
+	}
+	transcript := fitTranscript(msgs, cmp.Or(l.MaxInput, 20*maxChars), l.Weighted)
+	prompt := fmt.Sprintf(llmPrompt, maxChars, note, cmp.Or(previous, "(none)"), transcript)
+	resp, err := l.Provider.Chat(ctx, provider.ChatRequest{
+		Model:    l.Model,
+		Messages: []provider.Message{{Role: "user", Content: prompt}},
+		Intent:   "compaction",
+	})
+	if err != nil {
+		return "", fmt.Errorf("summarize: %w", err)
+	}
+	summary := strings.TrimSpace(resp.Content)
+	if summary == "" {
+		return "", fmt.Errorf("summarize: the model returned an empty summary")
+	}
+	return summary, nil
+}
+
+// Rolling has Chunk summarize only the new messages and appends that to
+// the previous summary as a paragraph, so each message is summarized once
+// and earlier paragraphs are never rewritten. Once the summary passes
+// MaxChars its oldest paragraphs are dropped.
+type Rolling struct {
+	Chunk    session.Summarizer // Usually an LLM
+	MaxChars int                // Default DefaultMaxChars
+}
+
+// Summarize implements session.Summarizer.
+func (r *Rolling) Summarize(ctx context.Context, previous string, msgs []provider.Message) (string, error) {
+	chunk, err := r.Chunk.Summarize(ctx, "", msgs)
+	if err != nil {
+		return "", err
+	}
+	paragraphs := slices.DeleteFunc(strings.Split(previous, "\n\n"), func(p string) bool { return strings.TrimSpace(p) == "" })
+	paragraphs = append(paragraphs, strings.TrimSpace(chunk))
+	maxChars := cmp.Or(r.MaxChars, DefaultMaxChars)
+	for len(paragraphs) > 1 && len(strings.Join(paragraphs, "\n\n")) > maxChars {
+		paragraphs = paragraphs[1:]
+	}
+	return strings.Join(paragraphs, "\n\n"), nil
+}
+
+// fitTranscript renders msgs for a model in at most limit characters. The
+// oldest messages are left out first, or with weighted the least
+// important.
+func fitTranscript(msgs []provider.Message, limit int, weighted bool) string {
+	blocks := make([]string, len(msgs))
+	scores := make([]float64, len(msgs))
+	for i, m := range msgs {
+		blocks[i] = formatMessage(m)
+		scores[i] = Importance(m)
+	}
+	keep := fit(blocks, scores, limit, weighted)
+	var b strings.Builder
+	if dropped := len(msgs) - len(keep); dropped > 0 {
+		fmt.Fprintf(&b, "[%d messages left out for length]\n", dropped)
+	}
+	for _, i := range keep {
+		b.WriteString(blocks[i])
+	}
+	return b.String()
+}
+
+// formatMessage renders a message as transcript lines.
+func formatMessage(m provider.Message) string {
+	var b strings.Builder
+	content := m.Content
+	if m.Role == "tool" && len(content) > toolResultChars {
+		content = content[:toolResultChars] + "..."
+	}
+	if content != "" || len(m.ToolCalls) == 0 {
+		fmt.Fprintf(&b, "[%s] %s\n", m.Role, content)
+	}
+	for _, tc := range m.ToolCalls {
+		fmt.Fprintf(&b, "[tool call] %s(%s)\n", tc.Name, tc.Arguments)
+	}
+	return b.String()
+}
+
+// fit returns the indexes of the items to keep, in order, so their
+// lengths plus a separator each add up to at most limit. It drops the
+// first items, or with weighted the lowest scoring, oldest first among
+// equals.
+func fit(items []string, scores []float64, limit int, weighted bool) []int {
+	total := 0
+	for _, it := range items {
+		total += len(it) + 1
+	}
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	if weighted {
+		slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(scores[a], scores[b]) })
+	}
+	dropped := make([]bool, len(items))
+	for _, i := range order {
+		if total <= limit {
+			break
+		}
+		dropped[i] = true
+		total -= len(items[i]) + 1
+	}
+	var keep []int
+	for i := range items {
+		if !dropped[i] {
+			keep = append(keep, i)
+		}
+	}
+	return keep
+}
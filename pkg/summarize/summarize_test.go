@@ -0,0 +1,131 @@
+package summarize
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/provider/providertest"
+)
+
+var history = []provider.Message{
+	{Role: "user", Content: "hi!"},
+	{Role: "assistant", Content: "Hello! How can I help?"},
+	{Role: "user", Content: "Deploy the API. Let's go with blue-green this time."},
+	{Role: "assistant", ToolCalls: []provider.ToolCall{{ID: "1", Name: "shell.run", Arguments: `{"cmd": "make deploy"}`}}},
+	{Role: "tool", Content: "Error: exit status 2\n\nstderr:\nmissing DEPLOY_ENV", ToolCallID: "1"},
+	{Role: "user", Content: "thanks"},
+}
+
+func TestLLM(t *testing.T) {
+	mp := providertest.New(providertest.Text("  Deploy failed: DEPLOY_ENV is unset.  "))
+	l := &LLM{Provider: mp, Model: "small", Weighted: true}
+
+	got, err := l.Summarize(context.Background(), "User runs the API.", history)
+	if err != nil || got != "Deploy failed: DEPLOY_ENV is unset." {
+		t.Fatalf("Summarize = %q, %v", got, err)
+	}
+	req := mp.Call(0)
+	prompt := req.Messages[0].Content
+	if req.Model != "small" || req.Intent != "compaction" {
+		t.Errorf("request model %q, intent %q", req.Model, req.Intent)
+	}
+	for _, want := range []string{"User runs the API.", "[tool call] shell.run", "missing DEPLOY_ENV", "leave out greetings"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+
+	mp.Then(providertest.Text(""))
+	if _, err := l.Summarize(context.Background(), "", history); err == nil {
+		t.Error("accepted an empty summary")
+	}
+}
+
+func TestLLM_MaxInput(t *testing.T) {
+	for _, tc := range []struct {
+		weighted bool
+		kept     string // Appears in the prompt
+		dropped  string // Doesn't
+	}{
+		{false, "thanks", "Deploy the API"},
+		{true, "missing DEPLOY_ENV", "Hello! How can I help?"},
+	} {
+		mp := providertest.New(providertest.Text("summary"))
+		l := &LLM{Provider: mp, MaxInput: 150, Weighted: tc.weighted}
+		if _, err := l.Summarize(context.Background(), "", history); err != nil {
+			t.Fatal(err)
+		}
+		prompt := mp.Call(0).Messages[0].Content
+		if !strings.Contains(prompt, tc.kept) || strings.Contains(prompt, tc.dropped) || !strings.Contains(prompt, "left out for length") {
+			t.Errorf("weighted=%v prompt:\n%s", tc.weighted, prompt)
+		}
+	}
+}
+
+func TestRolling(t *testing.T) {
+	mp := providertest.New(providertest.Text("Second part."), providertest.Text("Third part."))
+	r := &Rolling{Chunk: &LLM{Provider: mp}, MaxChars: 30}
+
+	got, err := r.Summarize(context.Background(), "First part.", history)
+	if err != nil || got != "First part.\n\nSecond part." {
+		t.Fatalf("Summarize = %q, %v", got, err)
+	}
+	if prompt := mp.Call(0).Messages[0].Content; strings.Contains(prompt, "First part.") {
+		t.Error("the chunk summarizer was sent the previous summary")
+	}
+	if got, _ = r.Summarize(context.Background(), got, history); got != "Second part.\n\nThird part." {
+		t.Errorf("past MaxChars = %q", got)
+	}
+}
+
+func TestExtractive(t *testing.T) {
+	e := &Extractive{}
+	got, err := e.Summarize(context.Background(), "- User: earlier request", history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"- User: earlier request",
+		"- User: hi!",
+		"- Assistant: Hello! How can I help?",
+		"- User: Deploy the API. Let's go with blue-green this time.",
+		`- Called shell.run({"cmd": "make deploy"})`,
+		"- Error: exit status 2 stderr: missing DEPLOY_ENV",
+		"- User: thanks",
+	}, "\n")
+	if got != want {
+		t.Errorf("summary =\n%s\nwant\n%s", got, want)
+	}
+
+	// Over budget: the oldest lines go, or the least important
+	e.MaxChars = 150
+	got, _ = e.Summarize(context.Background(), "", history)
+	if strings.Contains(got, "Deploy the API") || !strings.Contains(got, "- User: thanks") {
+		t.Errorf("unweighted summary =\n%s", got)
+	}
+	e.Weighted = true
+	got, _ = e.Summarize(context.Background(), "", history)
+	if !strings.Contains(got, "Deploy the API") || !strings.Contains(got, "DEPLOY_ENV") || strings.Contains(got, "thanks") || strings.Contains(got, "hi!") {
+		t.Errorf("weighted summary =\n%s", got)
+	}
+}
+
+func TestImportance(t *testing.T) {
+	order := []provider.Message{
+		{Role: "user", Content: "Thanks, great!"},
+		{Role: "assistant", Content: "Here is the file list."},
+		{Role: "user", Content: "List the files."},
+		{Role: "assistant", ToolCalls: []provider.ToolCall{{Name: "fs.ls"}}},
+		{Role: "tool", Content: "a.go b.go"},
+		{Role: "user", Content: "We decided to keep the old schema."},
+		{Role: "tool", Content: "Error: permission denied"},
+	}
+	for i := 1; i < len(order); i++ {
+		if Importance(order[i-1]) >= Importance(order[i]) {
+			t.Errorf("Importance(%q) = %v, not below Importance(%q) = %v",
+				order[i-1].Content, Importance(order[i-1]), order[i].Content, Importance(order[i]))
+		}
+	}
+}
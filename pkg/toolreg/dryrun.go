@@ -0,0 +1,88 @@
+package toolreg
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// DryRun says which tool calls the registry only describes instead of
+// running.
+type DryRun string
+
+const (
+	DryRunOff    DryRun = ""       // Run every call
+	DryRunAll    DryRun = "all"    // Run nothing
+	DryRunWrites DryRun = "writes" // Run read-only commands; describe the rest
+)
+
+// ParseDryRun checks a dry-run mode name.
+func ParseDryRun(s string) (DryRun, error) {
+	switch m := DryRun(s); m {
+	case DryRunOff, DryRunAll, DryRunWrites:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown dry-run mode %q (want %q or %q)", s, DryRunAll, DryRunWrites)
+}
+
+// SetDryRun makes Execute log the calls mode covers and return what they
+// would have run instead of running them. Arguments, profiles, and
+// working directories are still checked, so a dry run fails where a real
+// one would before it starts.
+func (r *Registry) SetDryRun(mode DryRun) {
+	r.dryRun = mode
+}
+
+// dryRuns reports whether the dry-run mode skips the command.
+func (r *Registry) dryRuns(tool *ToolManifest, cmd CommandDef) bool {
+	switch r.dryRun {
+	case DryRunAll:
+		return true
+	case DryRunWrites:
+		return !tool.ReadOnly && !cmd.ReadOnly
+	}
+	return false
+}
+
+// wouldExecute describes a skipped call: the command line for a binary,
+// or the name and arguments for a built-in.
+func (r *Registry) wouldExecute(name string, tool *ToolManifest, cmdName string, cmd CommandDef, args map[string]any) (ToolResult, error) {
+	var what string
+	if cmd.Handler != nil {
+		raw, _ := json.Marshal(args) // Sorted keys, so descriptions are stable
+		what = fmt.Sprintf("%s %s (built-in)", name, raw)
+	} else {
+		dir, err := r.workDirFor(tool, cmd)
+		if err != nil {
+			return ToolResult{}, fmt.Errorf("%s: %w", name, err)
+		}
+		argv := []string{displayArg(tool.Binary)}
+		for _, a := range buildCommandArgs(cmd, args, cmdName) {
+			argv = append(argv, displayArg(a))
+		}
+		what = strings.Join(argv, " ")
+		if tool.Sandbox != nil {
+			what += " in a " + cmp.Or(tool.Sandbox.Runtime, "docker") + " container"
+		}
+		if dir != "" {
+			what += " in " + dir
+		}
+		if cmd.Stdin {
+			if v, ok := args[cmp.Or(cmd.StdinParam, "content")]; ok {
+				what += fmt.Sprintf(" with %d bytes on stdin", len(formatArg(v)))
+			}
+		}
+	}
+	log.Printf("[toolreg] dry run: would execute %s", what)
+	return ToolResult{Stdout: "would execute: " + what + "\n(dry run: nothing was executed, so there is no output)"}, nil
+}
+
+// displayArg shell-quotes s if it isn't a plain word.
+func displayArg(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=,@+%") == "" {
+		return s
+	}
+	return shellQuote(s)
+}
@@ -0,0 +1,75 @@
+package toolreg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func TestDryRun(t *testing.T) {
+	ws, _ := filepath.EvalSymlinks(t.TempDir())
+	marker := filepath.Join(ws, "ran")
+	ran := 0
+	r := NewRegistry(0)
+	r.SetWorkspace(ws, false)
+	r.Register(&ToolManifest{
+		Name:   "deploy",
+		Binary: "touch",
+		Commands: map[string]CommandDef{
+			"prod":   {Args: "{target}", Parameters: map[string]ParameterDef{"target": {Type: "string", Required: true}}},
+			"status": {Args: marker, ReadOnly: true},
+		},
+	})
+	r.Register(&ToolManifest{
+		Name: "notes",
+		Commands: map[string]CommandDef{"add": {
+			Parameters: map[string]ParameterDef{"text": {Type: "string"}, "tag": {Type: "string"}},
+			Handler: func(context.Context, map[string]any) (ToolResult, error) {
+				ran++
+				return ToolResult{Stdout: "added"}, nil
+			},
+		}},
+	})
+	call := func(name, args string) (string, error) {
+		res, err := r.Execute(context.Background(), provider.ToolCall{ID: "1", Name: name, Arguments: args})
+		return res.Stdout, err
+	}
+
+	r.SetDryRun(DryRunAll)
+	out, err := call("deploy.prod", `{"target":"my file"}`)
+	if err != nil || !strings.HasPrefix(out, "would execute: touch prod 'my file' in "+ws+"\n") {
+		t.Errorf("binary dry run = %q, %v", out, err)
+	}
+	out, err = call("notes.add", `{"text":"hi","tag":"x"}`)
+	if err != nil || !strings.HasPrefix(out, `would execute: notes.add {"tag":"x","text":"hi"} (built-in)`) || ran != 0 {
+		t.Errorf("built-in dry run = %q, %v (ran %d)", out, err, ran)
+	}
+	if _, err := call("deploy.prod", `{}`); err == nil {
+		t.Error("dry run skipped argument validation")
+	}
+	if _, err := call("deploy.status", `{}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("read-only command ran in dry-run mode all")
+	}
+
+	r.SetDryRun(DryRunWrites)
+	if _, err := call("deploy.status", `{}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("read-only command didn't run in dry-run mode writes: %v", err)
+	}
+	if out, _ := call("notes.add", `{"text":"hi"}`); !strings.HasPrefix(out, "would execute:") || ran != 0 {
+		t.Errorf("write ran in dry-run mode writes: %q", out)
+	}
+
+	if _, err := ParseDryRun("some"); err == nil {
+		t.Error("ParseDryRun accepted an unknown mode")
+	}
+}
@@ -0,0 +1,115 @@
+package toolreg
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits caps how often and how concurrently a tool may run.
+type Limits struct {
+	MaxConcurrent int `json:"max_concurrent,omitempty"`  // Simultaneous executions (0 = unlimited)
+	MinIntervalMs int `json:"min_interval_ms,omitempty"` // Minimum gap between call starts (0 = none)
+}
+
+// limiter enforces a Limits value.
+type limiter struct {
+	sem      chan struct{} // nil when concurrency is unlimited
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time // Earliest start for the next call
+}
+
+func newLimiter(l Limits) *limiter {
+	lim := &limiter{interval: time.Duration(l.MinIntervalMs) * time.Millisecond}
+	if l.MaxConcurrent > 0 {
+		lim.sem = make(chan struct{}, l.MaxConcurrent)
+	}
+	return lim
+}
+
+// acquire waits for an interval slot and a concurrency slot.
+// Callers must call release when acquire returns nil.
+func (l *limiter) acquire(ctx context.Context) error {
+	if l.interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		start := l.next
+		if start.Before(now) {
+			start = now
+		}
+		l.next = start.Add(l.interval)
+		l.mu.Unlock()
+
+		if wait := time.Until(start); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (l *limiter) release() {
+	if l.sem != nil {
+		<-l.sem
+	}
+}
+
+// SetLimits sets limits shared by every tool execution.
+func (r *Registry) SetLimits(l Limits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.global = newLimiter(l)
+}
+
+// SetToolLimits sets limits for one tool, overriding its manifest.
+func (r *Registry) SetToolLimits(tool string, l Limits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limiters[tool] = newLimiter(l)
+}
+
+// acquire takes the tool's slot and then a global slot, returning a
+// function that releases both. The tool slot is taken first so a call
+// waiting on its own tool never holds a global slot.
+func (r *Registry) acquire(ctx context.Context, tool *ToolManifest) (func(), error) {
+	r.mu.Lock()
+	toolLim, ok := r.limiters[tool.Name]
+	if !ok && tool.Limits != nil {
+		toolLim = newLimiter(*tool.Limits)
+		r.limiters[tool.Name] = toolLim
+	}
+	global := r.global
+	r.mu.Unlock()
+
+	var held []*limiter
+	release := func() {
+		for _, l := range held {
+			l.release()
+		}
+	}
+	for _, l := range []*limiter{toolLim, global} {
+		if l == nil {
+			continue
+		}
+		if err := l.acquire(ctx); err != nil {
+			release()
+			return nil, err
+		}
+		held = append(held, l)
+	}
+	return release, nil
+}
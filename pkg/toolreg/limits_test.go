@@ -0,0 +1,136 @@
+package toolreg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// countingTool returns a native tool that tracks peak concurrency.
+func countingTool(name string, limits *Limits, hold time.Duration, peak *int32) *ToolManifest {
+	var running int32
+	return &ToolManifest{
+		Name:   name,
+		Limits: limits,
+		Commands: map[string]CommandDef{
+			"run": {
+				Handler: func(ctx context.Context, args map[string]any) (ToolResult, error) {
+					n := atomic.AddInt32(&running, 1)
+					defer atomic.AddInt32(&running, -1)
+					for {
+						p := atomic.LoadInt32(peak)
+						if n <= p || atomic.CompareAndSwapInt32(peak, p, n) {
+							break
+						}
+					}
+					time.Sleep(hold)
+					return ToolResult{Stdout: "ok"}, nil
+				},
+			},
+		},
+	}
+}
+
+func runParallel(t *testing.T, r *Registry, name string, n int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Execute(context.Background(), provider.ToolCall{Name: name + ".run", Arguments: `{}`}); err != nil {
+				t.Errorf("execute: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestManifestMaxConcurrent(t *testing.T) {
+	var peak int32
+	r := NewRegistry(5 * time.Second)
+	r.Register(countingTool("git", &Limits{MaxConcurrent: 2}, 20*time.Millisecond, &peak))
+
+	runParallel(t, r, "git", 8)
+	if peak != 2 {
+		t.Fatalf("peak concurrency = %d, want 2", peak)
+	}
+}
+
+func TestGlobalLimitSpansTools(t *testing.T) {
+	var peak int32
+	r := NewRegistry(5 * time.Second)
+	r.SetLimits(Limits{MaxConcurrent: 1})
+	// Both tools share one counter so peak measures global concurrency.
+	r.Register(countingTool("a", nil, 10*time.Millisecond, &peak))
+	r.Register(countingTool("b", nil, 10*time.Millisecond, &peak))
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runParallel(t, r, name, 1)
+		}()
+	}
+	wg.Wait()
+	if peak != 1 {
+		t.Fatalf("peak concurrency = %d, want 1", peak)
+	}
+}
+
+func TestSetToolLimitsOverridesManifest(t *testing.T) {
+	var peak int32
+	r := NewRegistry(5 * time.Second)
+	r.Register(countingTool("api", &Limits{MaxConcurrent: 4}, 20*time.Millisecond, &peak))
+	r.SetToolLimits("api", Limits{MaxConcurrent: 1})
+
+	runParallel(t, r, "api", 4)
+	if peak != 1 {
+		t.Fatalf("peak concurrency = %d, want 1", peak)
+	}
+}
+
+func TestMinInterval(t *testing.T) {
+	var peak int32
+	r := NewRegistry(5 * time.Second)
+	r.Register(countingTool("api", &Limits{MinIntervalMs: 30}, 0, &peak))
+
+	start := time.Now()
+	runParallel(t, r, "api", 4)
+	// Four calls need three gaps between their starts.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("4 calls finished in %v, want >= 90ms", elapsed)
+	}
+}
+
+func TestLimitWaitHonorsContext(t *testing.T) {
+	r := NewRegistry(5 * time.Second)
+	r.SetLimits(Limits{MaxConcurrent: 1})
+	block := make(chan struct{})
+	r.Register(&ToolManifest{
+		Name: "slow",
+		Commands: map[string]CommandDef{
+			"run": {Handler: func(ctx context.Context, args map[string]any) (ToolResult, error) {
+				<-block
+				return ToolResult{}, nil
+			}},
+		},
+	})
+	defer close(block)
+
+	go r.Execute(context.Background(), provider.ToolCall{Name: "slow.run", Arguments: `{}`})
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := r.Execute(ctx, provider.ToolCall{Name: "slow.run", Arguments: `{}`})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+}
@@ -0,0 +1,90 @@
+package toolreg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// manifestFiles are the manifest names Discover looks for in each tool
+// directory. The first one present is used.
+var manifestFiles = []string{"tool.json", "tool.yaml", "tool.yml"}
+
+// ParseManifests parses a manifest file, choosing JSON or YAML by the
+// extension of name. A file may hold one tool, a list of tools, or an object
+// with a "tools" list; a YAML file may also hold several documents separated
+// by "---". YAML is normalized through JSON so it uses the same field names.
+func ParseManifests(name string, data []byte) ([]*ToolManifest, error) {
+	var docs []json.RawMessage
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		for {
+			var doc any
+			err := dec.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if doc == nil {
+				continue // Empty document
+			}
+			raw, err := json.Marshal(doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			docs = append(docs, raw)
+		}
+	default:
+		docs = []json.RawMessage{data}
+	}
+
+	var out []*ToolManifest
+	for _, doc := range docs {
+		ms, err := decodeManifests(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		out = append(out, ms...)
+	}
+	for i, m := range out {
+		if m.Name == "" {
+			return nil, fmt.Errorf("%s: tool %d has no name", name, i+1)
+		}
+	}
+	return out, nil
+}
+
+// decodeManifests decodes one JSON document holding a tool, a list of
+// tools, or {"tools": [...]}.
+func decodeManifests(doc json.RawMessage) ([]*ToolManifest, error) {
+	doc = bytes.TrimSpace(doc)
+	if bytes.HasPrefix(doc, []byte("[")) {
+		var list []*ToolManifest
+		err := json.Unmarshal(doc, &list)
+		return list, err
+	}
+	var wrapper struct {
+		Name  string          `json:"name"`
+		Tools []*ToolManifest `json:"tools"`
+	}
+	if err := json.Unmarshal(doc, &wrapper); err != nil {
+		return nil, err
+	}
+	if wrapper.Name == "" && wrapper.Tools != nil {
+		return wrapper.Tools, nil
+	}
+	var m ToolManifest
+	if err := json.Unmarshal(doc, &m); err != nil {
+		return nil, err
+	}
+	return []*ToolManifest{&m}, nil
+}
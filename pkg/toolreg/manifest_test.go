@@ -0,0 +1,98 @@
+package toolreg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseManifests(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		want    []string
+		wantErr string
+	}{
+		{"json object", "tool.json", `{"name": "a", "binary": "echo"}`, []string{"a"}, ""},
+		{"json array", "tool.json", `[{"name": "a"}, {"name": "b"}]`, []string{"a", "b"}, ""},
+		{"json tools list", "tool.json", `{"tools": [{"name": "a"}, {"name": "b"}]}`, []string{"a", "b"}, ""},
+		{"yaml object", "tool.yaml", "name: a\nbinary: echo\n", []string{"a"}, ""},
+		{"yaml documents", "tool.yml", "name: a\n---\nname: b\n---\n", []string{"a", "b"}, ""},
+		{"yaml tools list", "tool.yaml", "tools:\n  - name: a\n  - name: b\n---\n- name: c\n", []string{"a", "b", "c"}, ""},
+		{"missing name", "tool.yaml", "name: a\n---\nbinary: echo\n", nil, "tool 2 has no name"},
+		{"bad json", "tool.json", `{"name": `, nil, "tool.json"},
+		{"bad yaml", "tool.yaml", "name: [a\n", nil, "tool.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms, err := ParseManifests(tt.file, []byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, m := range ms {
+				names = append(names, m.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("names = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifestsYAMLFields(t *testing.T) {
+	ms, err := ParseManifests("tool.yaml", []byte(`
+name: grep
+binary: grep
+timeout: 5
+commands:
+  search:
+    description: Search files
+    args: "-rn {pattern} ."
+    parameters:
+      pattern: {type: string, description: Pattern, required: true}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := ms[0]
+	cmd := m.Commands["search"]
+	if m.Binary != "grep" || m.Timeout != 5 || cmd.Args != "-rn {pattern} ." || !cmd.Parameters["pattern"].Required {
+		t.Errorf("manifest = %+v", m)
+	}
+}
+
+func TestDiscoverYAMLMultiTool(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "wrappers"), 0755)
+	os.WriteFile(filepath.Join(dir, "wrappers", "tool.yaml"), []byte(`
+name: date
+binary: date
+commands:
+  now: {description: Current time}
+---
+name: uptime
+binary: uptime
+commands:
+  show: {description: System uptime}
+`), 0644)
+
+	r := NewRegistry(0)
+	r.Discover([]string{dir})
+	var names []string
+	for _, d := range r.ToToolDefs() {
+		names = append(names, d.Name)
+	}
+	if want := []string{"date.now", "uptime.show"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
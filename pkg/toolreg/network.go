@@ -0,0 +1,80 @@
+package toolreg
+
+import (
+	"context"
+	"fmt"
+)
+
+// Network policies for a Profile: what happens when a session calls a tool
+// that can reach the network (see Registry.Networked).
+const (
+	NetworkAllow = "allow" // Networked tools run like any other (the default)
+	NetworkAsk   = "ask"   // Each networked tool needs the user's approval
+	NetworkDeny  = "deny"  // Networked tools never run, so no data leaves the machine
+)
+
+// ConfirmFunc asks the user a yes-or-no question and reports the answer.
+type ConfirmFunc func(ctx context.Context, question string) (bool, error)
+
+type confirmCtx struct{}
+
+// WithConfirm lets tool calls made with the returned context ask the user
+// for approval, as a NetworkAsk profile requires. Without it those calls
+// are refused, as nobody could approve them.
+func WithConfirm(ctx context.Context, f ConfirmFunc) context.Context {
+	return context.WithValue(ctx, confirmCtx{}, f)
+}
+
+func confirmFrom(ctx context.Context) ConfirmFunc {
+	f, _ := ctx.Value(confirmCtx{}).(ConfirmFunc)
+	return f
+}
+
+// Networked reports whether the tool called name can reach the network:
+// its manifest or command says so, or it runs in a sandbox with a network.
+func (r *Registry) Networked(name string) bool {
+	ref, ok := r.names[name]
+	return ok && ref.networked()
+}
+
+func (ref toolRef) networked() bool {
+	if ref.tool.Network || ref.tool.Commands[ref.cmd].Network {
+		return true
+	}
+	return ref.tool.Sandbox != nil && ref.tool.Sandbox.Network != "" && ref.tool.Sandbox.Network != "none"
+}
+
+// networkPermitted reports why the profile p refuses a networked tool
+// outright, or nil.
+func networkPermitted(ctx context.Context, p *Profile, name string) error {
+	switch p.Network {
+	case NetworkDeny:
+		return fmt.Errorf("tool %s uses the network, which profile %s denies", name, p.Name)
+	case NetworkAsk:
+		if confirmFrom(ctx) == nil {
+			return fmt.Errorf("tool %s uses the network, which profile %s allows only with approval, and nobody can approve it", name, p.Name)
+		}
+	}
+	return nil
+}
+
+// confirmNetwork asks the user to approve a call to a networked tool when
+// the profile in ctx requires it.
+func (r *Registry) confirmNetwork(ctx context.Context, name string, ref toolRef) error {
+	p := ProfileFrom(ctx)
+	if p == nil || p.Network != NetworkAsk || !ref.networked() {
+		return nil
+	}
+	confirm := confirmFrom(ctx)
+	if confirm == nil {
+		return networkPermitted(ctx, p, name)
+	}
+	ok, err := confirm(ctx, fmt.Sprintf("Allow %s to use the network? (yes/no)", name))
+	if err != nil {
+		return fmt.Errorf("%s: asking for network approval: %w", name, err)
+	}
+	if !ok {
+		return fmt.Errorf("tool %s uses the network, and the user did not approve it", name)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package toolreg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrPathDenied is wrapped by errors for paths a PathPolicy forbids.
+var ErrPathDenied = errors.New("path not allowed")
+
+// PathPolicy limits the files tools may read and write. Entries are paths,
+// which cover everything under them, or globs. Relative entries resolve
+// against the workspace and ~ is the home directory. An entry without a
+// slash, such as ".env" or "*.pem", matches that name anywhere, including
+// a directory of that name and everything in it.
+type PathPolicy struct {
+	Read  []string `json:"read,omitempty"`  // Tools may only read here, or where they may write (empty = anywhere not denied)
+	Write []string `json:"write,omitempty"` // Tools may only write here (empty = the workspace)
+	Deny  []string `json:"deny,omitempty"`  // Never read or written, e.g. ~/.ssh; wins over Read and Write
+}
+
+// IsZero reports whether the policy sets nothing.
+func (p PathPolicy) IsZero() bool {
+	return len(p.Read) == 0 && len(p.Write) == 0 && len(p.Deny) == 0
+}
+
+// Validate checks that every entry is a valid glob.
+func (p PathPolicy) Validate() error {
+	for _, list := range []struct {
+		name    string
+		entries []string
+	}{{"read", p.Read}, {"write", p.Write}, {"deny", p.Deny}} {
+		for _, e := range list.entries {
+			if e == "" {
+				return fmt.Errorf("%s: empty path", list.name)
+			}
+			if _, err := filepath.Match(e, ""); err != nil {
+				return fmt.Errorf("%s: %q: %w", list.name, e, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Paths is a PathPolicy resolved against a workspace. Built-in tools check
+// the paths they touch against it, and manifest tools are told it through
+// the environment (see Env). A nil *Paths allows everything.
+type Paths struct {
+	root              string
+	read, write, deny []string
+}
+
+// Env vars that pass a Paths to manifest tools, each a list of absolute
+// paths and globs joined by the OS path list separator (":" on Unix).
+const (
+	EnvReadPaths  = "TEENY_READ_PATHS" // Unset when anything not denied may be read
+	EnvWritePaths = "TEENY_WRITE_PATHS"
+	EnvDenyPaths  = "TEENY_DENY_PATHS"
+)
+
+// NewPaths resolves p against workspace. It returns nil when p is zero.
+func NewPaths(p PathPolicy, workspace string) *Paths {
+	if p.IsZero() {
+		return nil
+	}
+	root, _ := realPath(workspace)
+	out := &Paths{root: root}
+	for _, e := range p.Read {
+		out.read = append(out.read, out.entry(e))
+	}
+	for _, e := range p.Write {
+		out.write = append(out.write, out.entry(e))
+	}
+	if len(out.write) == 0 {
+		out.write = []string{root}
+	}
+	for _, e := range p.Deny {
+		out.deny = append(out.deny, out.entry(e))
+	}
+	return out
+}
+
+// entry resolves a policy entry. Names stay as they are; paths are made
+// absolute, with symlinks followed up to the first glob.
+func (p *Paths) entry(e string) string {
+	e = expandHome(e)
+	if !strings.ContainsRune(e, '/') {
+		return e
+	}
+	if !filepath.IsAbs(e) {
+		e = filepath.Join(p.root, e)
+	}
+	e = filepath.Clean(e)
+	i := strings.IndexAny(e, "*?[")
+	if i < 0 {
+		return resolve(e)
+	}
+	dir := filepath.Dir(e[:i+1])
+	return filepath.Join(resolve(dir), strings.TrimPrefix(e, dir))
+}
+
+// CanRead returns an error wrapping ErrPathDenied unless tools may read
+// path, which is relative to the workspace unless absolute.
+func (p *Paths) CanRead(path string) error {
+	if p == nil {
+		return nil
+	}
+	path = p.abs(path)
+	if e := matches(p.deny, path); e != "" {
+		return fmt.Errorf("%w: %s is denied (%s)", ErrPathDenied, path, e)
+	}
+	if len(p.read) > 0 && matches(p.read, path) == "" && matches(p.write, path) == "" {
+		return fmt.Errorf("%w: %s is outside the readable paths", ErrPathDenied, path)
+	}
+	return nil
+}
+
+// CanWrite returns an error wrapping ErrPathDenied unless tools may write
+// path, which is relative to the workspace unless absolute.
+func (p *Paths) CanWrite(path string) error {
+	if p == nil {
+		return nil
+	}
+	path = p.abs(path)
+	if e := matches(p.deny, path); e != "" {
+		return fmt.Errorf("%w: %s is denied (%s)", ErrPathDenied, path, e)
+	}
+	if matches(p.write, path) == "" {
+		return fmt.Errorf("%w: %s is outside the writable paths", ErrPathDenied, path)
+	}
+	return nil
+}
+
+// CanMount is CanRead, or CanWrite if write is set, for a directory
+// exposed whole, as a sandbox mount is. It also refuses a directory that
+// holds a denied path, such as a home directory holding ~/.ssh. Denied
+// names like ".env" could be anywhere, so they aren't held against it.
+func (p *Paths) CanMount(path string, write bool) error {
+	if p == nil {
+		return nil
+	}
+	check := p.CanRead
+	if write {
+		check = p.CanWrite
+	}
+	if err := check(path); err != nil {
+		return err
+	}
+	path = p.abs(path)
+	for _, e := range p.deny {
+		if !strings.ContainsRune(e, '/') {
+			continue
+		}
+		prefix := e
+		if i := strings.IndexAny(e, "*?["); i >= 0 {
+			prefix = filepath.Dir(e[:i+1])
+		}
+		if within(path, prefix) {
+			return fmt.Errorf("%w: %s holds denied %s", ErrPathDenied, path, e)
+		}
+	}
+	return nil
+}
+
+// Env returns the policy as env vars for manifest tools.
+func (p *Paths) Env() []string {
+	if p == nil {
+		return nil
+	}
+	sep := string(filepath.ListSeparator)
+	env := []string{
+		EnvWritePaths + "=" + strings.Join(p.write, sep),
+		EnvDenyPaths + "=" + strings.Join(p.deny, sep),
+	}
+	if len(p.read) > 0 {
+		env = append(env, EnvReadPaths+"="+strings.Join(slices.Concat(p.read, p.write), sep))
+	}
+	return env
+}
+
+func (p *Paths) abs(path string) string {
+	path = expandHome(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.root, path)
+	}
+	return resolve(filepath.Clean(path))
+}
+
+// matches returns the first entry that path, or a directory above it,
+// matches, or "".
+func matches(entries []string, path string) string {
+	for _, e := range entries {
+		named := !strings.ContainsRune(e, '/')
+		for q := path; ; q = filepath.Dir(q) {
+			if named {
+				if ok, _ := filepath.Match(e, filepath.Base(q)); ok {
+					return e
+				}
+			} else if ok, _ := filepath.Match(e, q); ok || q == e {
+				return e
+			}
+			if q == filepath.Dir(q) {
+				break
+			}
+		}
+	}
+	return ""
+}
+
+// resolve follows the symlinks in the part of an absolute path that
+// exists, so a link can't lead a check astray and a file yet to be
+// created is judged by where its directory really is.
+func resolve(path string) string {
+	if r, err := filepath.EvalSymlinks(path); err == nil {
+		return r
+	}
+	dir := filepath.Dir(path)
+	if dir == path {
+		return path
+	}
+	return filepath.Join(resolve(dir), filepath.Base(path))
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + p[1:]
+		}
+	}
+	return p
+}
@@ -0,0 +1,80 @@
+package toolreg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	home, _ := filepath.EvalSymlinks(t.TempDir())
+	t.Setenv("HOME", home)
+	ws := filepath.Join(home, "project")
+	os.MkdirAll(filepath.Join(ws, "docs"), 0755)
+	os.MkdirAll(filepath.Join(home, ".ssh"), 0700)
+	os.Symlink(filepath.Join(home, ".ssh"), filepath.Join(ws, "keys"))
+
+	p := NewPaths(PathPolicy{Deny: []string{"~/.ssh", ".env", "*.pem"}}, ws)
+	tests := []struct {
+		path        string
+		read, write bool
+	}{
+		{"main.go", true, true},
+		{"docs/new.md", true, true}, // Doesn't exist yet
+		{filepath.Join(home, "notes.txt"), true, false},
+		{"~/.ssh/id_ed25519", false, false},
+		{"keys/id_ed25519", false, false}, // Through a symlink
+		{".env", false, false},
+		{"config/.env/prod", false, false},
+		{"certs/server.pem", false, false},
+		{"../project/main.go", true, true},
+		{"../other/main.go", true, false},
+	}
+	for _, tt := range tests {
+		if err := p.CanRead(tt.path); (err == nil) != tt.read || (err != nil && !errors.Is(err, ErrPathDenied)) {
+			t.Errorf("CanRead(%s) = %v, want read %v", tt.path, err, tt.read)
+		}
+		if err := p.CanWrite(tt.path); (err == nil) != tt.write {
+			t.Errorf("CanWrite(%s) = %v, want write %v", tt.path, err, tt.write)
+		}
+	}
+
+	p = NewPaths(PathPolicy{Read: []string{"/usr/share/*"}, Write: []string{"out"}}, ws)
+	for path, want := range map[string]bool{"/usr/share/dict/words": true, "/etc/passwd": false, "out/a.txt": true, "main.go": false} {
+		if err := p.CanRead(path); (err == nil) != want {
+			t.Errorf("CanRead(%s) = %v, want %v", path, err, want)
+		}
+	}
+
+	if NewPaths(PathPolicy{}, ws) != nil || (*Paths)(nil).CanWrite("/etc/passwd") != nil {
+		t.Error("a zero policy should allow everything")
+	}
+}
+
+func TestPathsEnv(t *testing.T) {
+	ws, _ := filepath.EvalSymlinks(t.TempDir())
+	got := NewPaths(PathPolicy{Deny: []string{"/secrets", ".env"}}, ws).Env()
+	want := []string{EnvWritePaths + "=" + ws, EnvDenyPaths + "=/secrets" + string(filepath.ListSeparator) + ".env"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Env = %q, want %q", got, want)
+	}
+	got = NewPaths(PathPolicy{Read: []string{"/data"}}, ws).Env()
+	if !slices.Contains(got, EnvReadPaths+"=/data"+string(filepath.ListSeparator)+ws) {
+		t.Errorf("Env = %q, want the read paths with the writable ones", got)
+	}
+}
+
+func TestWorkDirFor_Paths(t *testing.T) {
+	ws, _ := filepath.EvalSymlinks(t.TempDir())
+	r := NewRegistry(0)
+	r.SetWorkspace(ws, false)
+	r.SetPaths(NewPaths(PathPolicy{Deny: []string{"/etc"}}, ws))
+	if _, err := r.workDirFor(&ToolManifest{WorkDir: "/etc"}, CommandDef{}); !errors.Is(err, ErrPathDenied) {
+		t.Errorf("workdir /etc: err = %v", err)
+	}
+	if dir, err := r.workDirFor(&ToolManifest{}, CommandDef{}); err != nil || dir != ws {
+		t.Errorf("default workdir = %q, %v", dir, err)
+	}
+}
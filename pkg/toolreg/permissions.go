@@ -0,0 +1,80 @@
+package toolreg
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Profile limits which tools a session or job may call. Patterns are
+// path.Match globs over tool names such as "github.*", or a bare tool name
+// such as "deploy" for all of its commands. A command called through an
+// alias or namespace is also checked under its canonical "tool.command".
+type Profile struct {
+	Name     string   `json:"-"`
+	Allow    []string `json:"allow,omitempty"`     // Tools that may run; empty allows all
+	Deny     []string `json:"deny,omitempty"`      // Tools that never run; wins over Allow
+	ReadOnly bool     `json:"read_only,omitempty"` // Only commands marked read_only may run
+	Network  string   `json:"network,omitempty"`   // NetworkAllow (default), NetworkAsk, or NetworkDeny
+}
+
+// Validate checks the profile's network policy.
+func (p Profile) Validate() error {
+	switch p.Network {
+	case "", NetworkAllow, NetworkAsk, NetworkDeny:
+		return nil
+	}
+	return fmt.Errorf("network: %q is not %q, %q, or %q", p.Network, NetworkAllow, NetworkAsk, NetworkDeny)
+}
+
+type profileCtx struct{}
+
+// WithProfile applies p to tool calls made with the returned context. A nil
+// profile leaves calls unrestricted.
+func WithProfile(ctx context.Context, p *Profile) context.Context {
+	return context.WithValue(ctx, profileCtx{}, p)
+}
+
+// ProfileFrom returns the profile applied to ctx, or nil if none is.
+func ProfileFrom(ctx context.Context) *Profile {
+	p, _ := ctx.Value(profileCtx{}).(*Profile)
+	return p
+}
+
+// Permitted reports why the profile in ctx refuses the tool called name, or
+// nil if it may run. Unknown names are left for Execute to report.
+func (r *Registry) Permitted(ctx context.Context, name string) error {
+	p := ProfileFrom(ctx)
+	ref, ok := r.names[name]
+	if p == nil || !ok {
+		return nil
+	}
+	names := []string{name, ref.tool.Name + "." + ref.cmd}
+	if len(p.Allow) > 0 && !matchesAny(p.Allow, names) {
+		return fmt.Errorf("tool %s is not allowed by profile %s", name, p.Name)
+	}
+	if matchesAny(p.Deny, names) {
+		return fmt.Errorf("tool %s is denied by profile %s", name, p.Name)
+	}
+	if p.ReadOnly && !ref.tool.ReadOnly && !ref.tool.Commands[ref.cmd].ReadOnly {
+		return fmt.Errorf("tool %s is not read-only; profile %s only allows read-only tools", name, p.Name)
+	}
+	if ref.networked() {
+		return networkPermitted(ctx, p, name)
+	}
+	return nil
+}
+
+// matchesAny reports whether any pattern matches any of names.
+func matchesAny(patterns, names []string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			tool, _, _ := strings.Cut(name, ".")
+			if ok, _ := path.Match(pattern, name); ok || pattern == tool {
+				return true
+			}
+		}
+	}
+	return false
+}
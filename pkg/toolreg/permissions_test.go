@@ -0,0 +1,120 @@
+package toolreg
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func TestPermitted(t *testing.T) {
+	r := NewRegistry(0)
+	r.Register(&ToolManifest{
+		Name:     "deploy",
+		Binary:   "echo",
+		Aliases:  map[string]string{"ship.it": "prod"},
+		Commands: map[string]CommandDef{"prod": {}, "status": {ReadOnly: true}},
+	})
+	r.Register(&ToolManifest{
+		Name:     "github",
+		Binary:   "echo",
+		ReadOnly: true,
+		Commands: map[string]CommandDef{"search": {}},
+	})
+
+	tests := []struct {
+		name    string
+		profile *Profile
+		tool    string
+		want    string // substring of error, "" if permitted
+	}{
+		{"no profile", nil, "deploy.prod", ""},
+		{"allow glob", &Profile{Name: "p", Allow: []string{"github.*"}}, "github.search", ""},
+		{"not allowed", &Profile{Name: "p", Allow: []string{"github.*"}}, "deploy.prod", "not allowed by profile p"},
+		{"deny bare tool name", &Profile{Name: "nightly", Deny: []string{"deploy"}}, "deploy.status", "denied by profile nightly"},
+		{"deny beats allow", &Profile{Name: "p", Allow: []string{"*"}, Deny: []string{"deploy.prod"}}, "deploy.prod", "denied"},
+		{"deny covers alias", &Profile{Name: "p", Deny: []string{"deploy"}}, "ship.it", "denied"},
+		{"read-only command", &Profile{Name: "ro", ReadOnly: true}, "deploy.status", ""},
+		{"read-only tool", &Profile{Name: "ro", ReadOnly: true}, "github.search", ""},
+		{"read-write refused", &Profile{Name: "ro", ReadOnly: true}, "deploy.prod", "not read-only"},
+		{"unknown tool", &Profile{Name: "p", Allow: []string{"x"}}, "nope.run", ""},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.profile != nil {
+			ctx = WithProfile(ctx, tt.profile)
+		}
+		err := r.Permitted(ctx, tt.tool)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestExecuteEnforcesProfile(t *testing.T) {
+	r := NewRegistry(0)
+	r.Register(&ToolManifest{Name: "deploy", Binary: "echo", Commands: map[string]CommandDef{"prod": {}}})
+	ctx := WithProfile(context.Background(), &Profile{Name: "nightly", Deny: []string{"deploy"}})
+
+	_, err := r.Execute(ctx, provider.ToolCall{ID: "1", Name: "deploy.prod", Arguments: `{}`})
+	if err == nil || !strings.Contains(err.Error(), "denied by profile nightly") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	r := NewRegistry(0)
+	r.Register(&ToolManifest{Name: "fetch", Binary: "echo", Network: true, Commands: map[string]CommandDef{"url": {}}})
+	r.Register(&ToolManifest{Name: "notes", Binary: "echo", Commands: map[string]CommandDef{"add": {}, "sync": {Network: true}}})
+	r.Register(&ToolManifest{Name: "scan", Binary: "echo", Sandbox: &Sandbox{Image: "x", Network: "bridge"}, Commands: map[string]CommandDef{"run": {}}})
+
+	for name, want := range map[string]bool{"fetch.url": true, "notes.add": false, "notes.sync": true, "scan.run": true, "nope.run": false} {
+		if got := r.Networked(name); got != want {
+			t.Errorf("Networked(%s) = %v, want %v", name, got, want)
+		}
+	}
+
+	deny := WithProfile(context.Background(), &Profile{Name: "airgap", Network: NetworkDeny})
+	if err := r.Permitted(deny, "notes.sync"); err == nil || !strings.Contains(err.Error(), "profile airgap denies") {
+		t.Errorf("deny: err = %v", err)
+	}
+	if err := r.Permitted(deny, "notes.add"); err != nil {
+		t.Errorf("deny, offline tool: %v", err)
+	}
+
+	ask := WithProfile(context.Background(), &Profile{Name: "careful", Network: NetworkAsk})
+	if err := r.Permitted(ask, "fetch.url"); err == nil || !strings.Contains(err.Error(), "nobody can approve it") {
+		t.Errorf("ask without a confirm: err = %v", err)
+	}
+	var asked []string
+	answer := false
+	ask = WithConfirm(ask, func(_ context.Context, q string) (bool, error) {
+		asked = append(asked, q)
+		return answer, nil
+	})
+	if err := r.Permitted(ask, "fetch.url"); err != nil || len(asked) != 0 {
+		t.Errorf("ask: Permitted = %v, asked %q", err, asked)
+	}
+	_, err := r.Execute(ask, provider.ToolCall{ID: "1", Name: "fetch.url", Arguments: `{}`})
+	if err == nil || !strings.Contains(err.Error(), "did not approve") || len(asked) != 1 || !strings.Contains(asked[0], "fetch.url") {
+		t.Errorf("refused: err = %v, asked %q", err, asked)
+	}
+	answer = true
+	if _, err := r.Execute(ask, provider.ToolCall{ID: "2", Name: "fetch.url", Arguments: `{}`}); err != nil {
+		t.Errorf("approved: %v", err)
+	}
+	if _, err := r.Execute(ask, provider.ToolCall{ID: "3", Name: "notes.add", Arguments: `{}`}); err != nil || len(asked) != 2 {
+		t.Errorf("offline tool: err = %v, asked %q", err, asked)
+	}
+
+	if err := (Profile{Network: "sometimes"}).Validate(); err == nil {
+		t.Error("Validate accepted an unknown network policy")
+	}
+}
@@ -5,45 +5,136 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/metrics"
 	"github.com/rcliao/teeny-orchestrator/pkg/provider"
 )
 
+// HandlerFunc executes a built-in command in-process. Like a binary, it
+// reports its output and exit code in the result, which it fills in as far
+// as it got when it also returns an error.
+type HandlerFunc func(ctx context.Context, args map[string]any) (ToolResult, error)
+
+// TextHandler adapts a built-in whose only result is its output.
+func TextHandler(f func(ctx context.Context, args map[string]any) (string, error)) HandlerFunc {
+	return func(ctx context.Context, args map[string]any) (ToolResult, error) {
+		out, err := f(ctx, args)
+		return ToolResult{Stdout: out}, err
+	}
+}
+
+// ToolResult is the outcome of a tool call. It is filled in as far as the
+// call got, so a failed command still reports its output.
+type ToolResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int // The binary's exit status; -1 if it was killed or could not start
+	Duration time.Duration
+}
+
+type sessionKeyCtx struct{}
+
+// WithSessionKey records the session a tool call runs in.
+func WithSessionKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, sessionKeyCtx{}, key)
+}
+
+// SessionKey returns the session a handler's tool call runs in, or "" if
+// unknown.
+func SessionKey(ctx context.Context) string {
+	key, _ := ctx.Value(sessionKeyCtx{}).(string)
+	return key
+}
+
 // CommandDef defines a single command within a tool.
 type CommandDef struct {
-	Description string                    `json:"description"`
-	Args        string                    `json:"args"`        // Template: "--namespace {namespace}"
-	Stdin       bool                      `json:"stdin"`       // Whether content goes via stdin
-	StdinParam  string                    `json:"stdin_param"` // Which parameter provides stdin (default: "content")
-	Parameters  map[string]ParameterDef   `json:"parameters"`
+	Description string                  `json:"description"`
+	Args        string                  `json:"args"`        // Template: "--namespace {namespace}"; each word is one argument
+	Stdin       bool                    `json:"stdin"`       // Whether content goes via stdin
+	StdinParam  string                  `json:"stdin_param"` // Which parameter provides stdin (default: "content")
+	Parameters  map[string]ParameterDef `json:"parameters"`
+	Timeout     int                     `json:"timeout,omitempty"`   // Seconds; overrides the tool and registry timeout
+	WorkDir     string                  `json:"workdir,omitempty"`   // Absolute or workspace-relative; overrides the tool's
+	ReadOnly    bool                    `json:"read_only,omitempty"` // Changes nothing, so read-only profiles may call it
+	Network     bool                    `json:"network,omitempty"`   // Can reach the network, so network policies apply
+	Handler     HandlerFunc             `json:"-"`                   // Built-in implementation; replaces running Binary
 }
 
 // ParameterDef defines a tool parameter.
 type ParameterDef struct {
-	Type        string `json:"type"`
-	Description string `json:"description"`
-	Required    bool   `json:"required"`
-	Default     any    `json:"default,omitempty"`
+	Type        string                  `json:"type"`
+	Description string                  `json:"description"`
+	Required    bool                    `json:"required"`
+	Default     any                     `json:"default,omitempty"`
+	Enum        []any                   `json:"enum,omitempty"`       // Allowed values
+	Items       *ParameterDef           `json:"items,omitempty"`      // Element schema when Type is "array"
+	Properties  map[string]ParameterDef `json:"properties,omitempty"` // Field schemas when Type is "object"
+	Quoting     string                  `json:"quoting,omitempty"`    // "" keeps the value one argument, "quote" shell-quotes it, "raw" splits it on spaces
 }
 
-// ToolManifest is the tool.json format.
+// ToolManifest is the tool.json (or tool.yaml) format.
 type ToolManifest struct {
 	Name        string                `json:"name"`
 	Binary      string                `json:"binary"`
 	Description string                `json:"description"`
 	Commands    map[string]CommandDef `json:"commands"`
+	Namespaces  []string              `json:"namespaces,omitempty"` // Extra names the commands are also exposed under
+	Aliases     map[string]string     `json:"aliases,omitempty"`    // Full alias name → command, e.g. "mem.save": "add"
+	Timeout     int                   `json:"timeout,omitempty"`    // Seconds; overrides the registry timeout
+	Limits      *Limits               `json:"limits,omitempty"`     // Per-tool concurrency and rate limits
+	MaxOutput   int                   `json:"max_output,omitempty"` // Bytes per result before the loop shrinks it
+	Env         map[string]string     `json:"env,omitempty"`        // Set for the binary; values may use ${VAR} and ${SECRET:name}
+	PassEnv     []string              `json:"pass_env,omitempty"`   // Parent env vars passed through besides DefaultEnv
+	WorkDir     string                `json:"workdir,omitempty"`    // Absolute or workspace-relative (default: the workspace)
+	Sandbox     *Sandbox              `json:"sandbox,omitempty"`    // Run the binary in a container instead of on the host
+	ReadOnly    bool                  `json:"read_only,omitempty"`  // Every command is read-only (see CommandDef.ReadOnly)
+	Network     bool                  `json:"network,omitempty"`    // Every command can reach the network (see CommandDef.Network)
+}
+
+// tracerName identifies spans created by the registry.
+const tracerName = "github.com/rcliao/teeny-orchestrator/pkg/toolreg"
+
+// toolRef is the command behind an exposed "namespace.command" name.
+type toolRef struct {
+	tool  *ToolManifest
+	cmd   string
+	alias bool
 }
 
 // Registry holds discovered tools.
 type Registry struct {
-	tools   map[string]*ToolManifest // keyed by tool name
-	timeout time.Duration
+	tools    map[string]*ToolManifest // keyed by tool name and namespace
+	names    map[string]toolRef       // keyed by exposed name, including aliases
+	timeout  time.Duration
+	mu       sync.Mutex          // guards limiters and global
+	limiters map[string]*limiter // keyed by tool name
+	global   *limiter
+	tracer   trace.Tracer     // nil uses the otel global provider
+	metrics  *metrics.Metrics // nil disables metrics
+	secrets  SecretProvider   // Resolves ${SECRET:name} in manifest env; nil fails them
+	passEnv  []string         // Parent env vars passed to every tool
+	dryRun   DryRun           // Calls to describe instead of run
+
+	workspace string // Default working directory; base for relative workdirs
+	jail      bool   // Refuse working directories outside workspace
+	paths     *Paths // Files tools may touch (nil = any)
 }
 
 // NewRegistry creates an empty registry.
@@ -52,12 +143,17 @@ func NewRegistry(timeout time.Duration) *Registry {
 		timeout = 30 * time.Second
 	}
 	return &Registry{
-		tools:   make(map[string]*ToolManifest),
-		timeout: timeout,
+		tools:    make(map[string]*ToolManifest),
+		names:    make(map[string]toolRef),
+		timeout:  timeout,
+		limiters: make(map[string]*limiter),
 	}
 }
 
-// Discover scans directories for tool.json manifests.
+// Discover scans directories for tool manifests: tool.json, tool.yaml, or
+// tool.yml in each subdirectory. Manifests that fail to parse or collide
+// with an already registered tool are logged and skipped, so earlier
+// directories win.
 func (r *Registry) Discover(dirs []string) error {
 	for _, dir := range dirs {
 		entries, err := os.ReadDir(dir)
@@ -68,104 +164,276 @@ func (r *Registry) Discover(dirs []string) error {
 			if !e.IsDir() {
 				continue
 			}
-			manifestPath := filepath.Join(dir, e.Name(), "tool.json")
-			data, err := os.ReadFile(manifestPath)
-			if err != nil {
-				continue
+			for _, file := range manifestFiles {
+				manifestPath := filepath.Join(dir, e.Name(), file)
+				data, err := os.ReadFile(manifestPath)
+				if err != nil {
+					continue
+				}
+				manifests, err := ParseManifests(manifestPath, data)
+				if err != nil {
+					log.Printf("[toolreg] skipping %v", err)
+					break
+				}
+				for _, m := range manifests {
+					if err := r.Register(m); err != nil {
+						log.Printf("[toolreg] skipping %s: %v", manifestPath, err)
+					}
+				}
+				break
 			}
-			var manifest ToolManifest
-			if err := json.Unmarshal(data, &manifest); err != nil {
-				continue
-			}
-			r.tools[manifest.Name] = &manifest
 		}
 	}
 	return nil
 }
 
-// Register adds a tool manifest directly.
-func (r *Registry) Register(m *ToolManifest) {
-	r.tools[m.Name] = m
+// Register adds a tool manifest directly. Its commands are exposed as
+// "name.command", again under each of its namespaces, and under its
+// aliases. It fails, registering nothing, if any of those names is invalid
+// or already taken by another tool.
+func (r *Registry) Register(m *ToolManifest) error {
+	if r.tools[m.Name] == m {
+		return nil // Already registered
+	}
+	names, err := exposedNames(m)
+	if err != nil {
+		return err
+	}
+	if m.Sandbox != nil {
+		if err := m.Sandbox.validate(); err != nil {
+			return fmt.Errorf("toolreg: %s: %w", m.Name, err)
+		}
+	}
+	var problems []string
+	for _, ns := range append([]string{m.Name}, m.Namespaces...) {
+		if other, ok := r.tools[ns]; ok {
+			problems = append(problems, fmt.Sprintf("tool name %q already registered by %s", ns, other.Name))
+		}
+	}
+	for name := range names {
+		if other, ok := r.names[name]; ok {
+			problems = append(problems, fmt.Sprintf("%q already registered by %s", name, other.tool.Name))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("toolreg: %s: %s", m.Name, strings.Join(problems, "; "))
+	}
+
+	for _, ns := range append([]string{m.Name}, m.Namespaces...) {
+		r.tools[ns] = m
+	}
+	for name, ref := range names {
+		r.names[name] = ref
+	}
+	return nil
+}
+
+// exposedNames lists every name a manifest's commands are called by.
+func exposedNames(m *ToolManifest) (map[string]toolRef, error) {
+	names := make(map[string]toolRef)
+	for _, ns := range append([]string{m.Name}, m.Namespaces...) {
+		if ns == "" || strings.Contains(ns, ".") {
+			return nil, fmt.Errorf("toolreg: %s: invalid tool name %q", m.Name, ns)
+		}
+		for cmd := range m.Commands {
+			names[ns+"."+cmd] = toolRef{tool: m, cmd: cmd}
+		}
+	}
+	for alias, target := range m.Aliases {
+		if ns, cmd, ok := strings.Cut(alias, "."); !ok || ns == "" || cmd == "" {
+			return nil, fmt.Errorf("toolreg: %s: alias %q must look like namespace.command", m.Name, alias)
+		}
+		cmd := strings.TrimPrefix(target, m.Name+".")
+		if _, ok := m.Commands[cmd]; !ok {
+			return nil, fmt.Errorf("toolreg: %s: alias %q points to unknown command %q", m.Name, alias, target)
+		}
+		if _, ok := names[alias]; ok {
+			return nil, fmt.Errorf("toolreg: %s: alias %q shadows a command", m.Name, alias)
+		}
+		names[alias] = toolRef{tool: m, cmd: cmd, alias: true}
+	}
+	return names, nil
 }
 
-// ToToolDefs converts all registered tools to LLM tool definitions.
-// Each command becomes a separate tool: "toolname.command".
+// ToToolDefs converts all registered tools to LLM tool definitions, sorted
+// by name. Each exposed name becomes a separate tool: "toolname.command",
+// its namespaced copies, and aliases.
 func (r *Registry) ToToolDefs() []provider.ToolDef {
 	var defs []provider.ToolDef
-	for _, tool := range r.tools {
-		for cmdName, cmd := range tool.Commands {
-			fullName := tool.Name + "." + cmdName
-			defs = append(defs, provider.ToolDef{
-				Name:        fullName,
-				Description: fmt.Sprintf("[%s] %s", tool.Name, cmd.Description),
-				Parameters:  buildJSONSchema(cmd.Parameters),
-			})
+	for name, ref := range r.names {
+		cmd := ref.tool.Commands[ref.cmd]
+		ns, _, _ := strings.Cut(name, ".")
+		desc := fmt.Sprintf("[%s] %s", ns, cmd.Description)
+		if ref.alias {
+			desc += fmt.Sprintf(" (alias of %s.%s)", ref.tool.Name, ref.cmd)
 		}
+		defs = append(defs, provider.ToolDef{
+			Name:        name,
+			Description: desc,
+			Parameters:  buildJSONSchema(cmd.Parameters),
+		})
 	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
 	return defs
 }
 
 func buildJSONSchema(params map[string]ParameterDef) map[string]any {
-	properties := make(map[string]any)
-	var required []string
+	return paramSchema(ParameterDef{Type: "object", Properties: params})
+}
 
-	for name, p := range params {
-		prop := map[string]any{
-			"type":        p.Type,
-			"description": p.Description,
-		}
-		if p.Default != nil {
-			prop["default"] = p.Default
+// paramSchema renders p as JSON Schema, recursing into array items and
+// object properties. The top-level object always lists its properties,
+// even when there are none.
+func paramSchema(p ParameterDef) map[string]any {
+	schema := map[string]any{"type": p.Type}
+	if p.Description != "" {
+		schema["description"] = p.Description
+	}
+	if p.Default != nil {
+		schema["default"] = p.Default
+	}
+	if len(p.Enum) > 0 {
+		schema["enum"] = p.Enum
+	}
+	if p.Items != nil {
+		schema["items"] = paramSchema(*p.Items)
+	}
+	if p.Type == "object" {
+		properties := make(map[string]any)
+		var required []string
+		for name, sub := range p.Properties {
+			properties[name] = paramSchema(sub)
+			if sub.Required {
+				required = append(required, name)
+			}
 		}
-		properties[name] = prop
-		if p.Required {
-			required = append(required, name)
+		schema["properties"] = properties
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
 		}
 	}
+	return schema
+}
+
+// SetTracerProvider sets where "tool.execute" spans are sent.
+func (r *Registry) SetTracerProvider(tp trace.TracerProvider) {
+	r.tracer = tp.Tracer(tracerName)
+}
+
+// SetMetrics records tool latency in m.
+func (r *Registry) SetMetrics(m *metrics.Metrics) {
+	r.metrics = m
+}
 
-	schema := map[string]any{
-		"type":       "object",
-		"properties": properties,
+// Execute runs a tool command and returns its result. A command that exits
+// non-zero returns an error along with whatever it wrote to stdout and
+// stderr.
+func (r *Registry) Execute(ctx context.Context, toolCall provider.ToolCall) (ToolResult, error) {
+	tracer := r.tracer
+	if tracer == nil {
+		tracer = otel.Tracer(tracerName)
 	}
-	if len(required) > 0 {
-		schema["required"] = required
+	ctx, span := tracer.Start(ctx, "tool.execute", trace.WithAttributes(
+		attribute.String("tool.name", toolCall.Name),
+		attribute.String("tool.call_id", toolCall.ID),
+	))
+	defer span.End()
+
+	start := time.Now()
+	res, err := r.execute(ctx, toolCall)
+	res.Duration = time.Since(start)
+	r.metrics.ObserveTool(toolCall.Name, res.Duration, err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
-	return schema
+	span.SetAttributes(
+		attribute.Int("tool.output_bytes", len(res.Stdout)),
+		attribute.Int("tool.exit_code", res.ExitCode),
+	)
+	return res, err
 }
 
-// Execute runs a tool command and returns the output.
-func (r *Registry) Execute(ctx context.Context, toolCall provider.ToolCall) (string, error) {
+func (r *Registry) execute(ctx context.Context, toolCall provider.ToolCall) (ToolResult, error) {
 	// Parse "toolname.command"
 	parts := strings.SplitN(toolCall.Name, ".", 2)
 	if len(parts) != 2 {
-		return "", fmt.Errorf("invalid tool name: %s (expected tool.command)", toolCall.Name)
+		return ToolResult{}, fmt.Errorf("invalid tool name: %s (expected tool.command)", toolCall.Name)
 	}
 	toolName, cmdName := parts[0], parts[1]
 
-	tool, ok := r.tools[toolName]
+	ref, ok := r.names[toolCall.Name]
 	if !ok {
-		return "", fmt.Errorf("unknown tool: %s", toolName)
+		if _, known := r.tools[toolName]; !known {
+			return ToolResult{}, fmt.Errorf("unknown tool: %s", toolName)
+		}
+		return ToolResult{}, fmt.Errorf("unknown command: %s.%s", toolName, cmdName)
 	}
-
-	cmdDef, ok := tool.Commands[cmdName]
-	if !ok {
-		return "", fmt.Errorf("unknown command: %s.%s", toolName, cmdName)
+	if err := r.Permitted(ctx, toolCall.Name); err != nil {
+		return ToolResult{}, err
 	}
+	tool, cmdName := ref.tool, ref.cmd
+	cmdDef := tool.Commands[cmdName]
 
 	// Parse arguments from JSON
 	var args map[string]any
 	if err := json.Unmarshal([]byte(toolCall.Arguments), &args); err != nil {
-		return "", fmt.Errorf("parse tool arguments: %w", err)
+		return ToolResult{}, fmt.Errorf("%s.%s: %w: not a JSON object (%v)", toolName, cmdName, ErrInvalidArguments, err)
+	}
+	if err := ValidateArgs(cmdDef.Parameters, args); err != nil {
+		return ToolResult{}, fmt.Errorf("%s.%s: %w", toolName, cmdName, err)
 	}
 
-	// Build command line
-	cmdArgs := buildCommandArgs(cmdDef, args, cmdName)
+	if r.dryRuns(tool, cmdDef) {
+		return r.wouldExecute(toolCall.Name, tool, cmdName, cmdDef, args)
+	}
+	if err := r.confirmNetwork(ctx, toolCall.Name, ref); err != nil {
+		return ToolResult{}, err
+	}
+
+	// Wait for rate and concurrency limits before the timeout starts
+	release, err := r.acquire(ctx, tool)
+	if err != nil {
+		return ToolResult{}, fmt.Errorf("%s.%s: waiting for rate limit: %w", toolName, cmdName, err)
+	}
+	defer release()
 
 	// Create command with timeout
-	execCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	timeout := r.timeoutFor(tool, cmdDef)
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(execCtx, tool.Binary, cmdArgs...)
+	if cmdDef.Handler != nil {
+		res, err := cmdDef.Handler(execCtx, args)
+		if err != nil && res.ExitCode == 0 {
+			res.ExitCode = 1 // Failed without saying how, like a command exiting 1
+		}
+		return res, err
+	}
+
+	// Build command line
+	cmdArgs := buildCommandArgs(cmdDef, args, cmdName)
+
+	env, err := r.toolEnv(ctx, tool)
+	if err != nil {
+		return ToolResult{}, fmt.Errorf("%s.%s: %w", toolName, cmdName, err)
+	}
+	dir, err := r.workDirFor(tool, cmdDef)
+	if err != nil {
+		return ToolResult{}, fmt.Errorf("%s.%s: %w", toolName, cmdName, err)
+	}
+	var cmd *exec.Cmd
+	if tool.Sandbox != nil {
+		if cmd, err = r.sandboxCommand(execCtx, tool, dir, cmdArgs, env); err != nil {
+			return ToolResult{}, fmt.Errorf("%s.%s: %w", toolName, cmdName, err)
+		}
+	} else {
+		cmd = exec.CommandContext(execCtx, tool.Binary, cmdArgs...)
+		cmd.Dir = dir
+	}
+	cmd.Env = env
 
 	// Handle stdin
 	if cmdDef.Stdin {
@@ -174,7 +442,7 @@ func (r *Registry) Execute(ctx context.Context, toolCall provider.ToolCall) (str
 			stdinParam = "content"
 		}
 		if val, ok := args[stdinParam]; ok {
-			cmd.Stdin = strings.NewReader(fmt.Sprintf("%v", val))
+			cmd.Stdin = strings.NewReader(formatArg(val))
 		}
 	}
 
@@ -182,32 +450,55 @@ func (r *Registry) Execute(ctx context.Context, toolCall provider.ToolCall) (str
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	if err := cmd.Run(); err != nil {
-		errMsg := stderr.String()
-		if errMsg == "" {
-			errMsg = err.Error()
+	err = cmd.Run()
+	res := ToolResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	if err != nil {
+		res.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			res.ExitCode = exitErr.ExitCode()
 		}
-		return "", fmt.Errorf("%s.%s failed: %s", toolName, cmdName, errMsg)
+		if execCtx.Err() == context.DeadlineExceeded {
+			return res, fmt.Errorf("%s.%s timed out after %s", toolName, cmdName, timeout)
+		}
+		if res.ExitCode > 0 {
+			return res, fmt.Errorf("%s.%s exited with code %d", toolName, cmdName, res.ExitCode)
+		}
+		return res, fmt.Errorf("%s.%s failed: %w", toolName, cmdName, err)
 	}
 
-	return stdout.String(), nil
+	return res, nil
+}
+
+// OutputLimit returns the max_output of the tool behind a "tool.command"
+// name or alias, or 0 if the tool is unknown or sets no limit.
+func (r *Registry) OutputLimit(name string) int {
+	if ref, ok := r.names[name]; ok {
+		return ref.tool.MaxOutput
+	}
+	return 0
+}
+
+// timeoutFor resolves the execution timeout: command, then tool, then registry.
+func (r *Registry) timeoutFor(tool *ToolManifest, cmd CommandDef) time.Duration {
+	switch {
+	case cmd.Timeout > 0:
+		return time.Duration(cmd.Timeout) * time.Second
+	case tool.Timeout > 0:
+		return time.Duration(tool.Timeout) * time.Second
+	default:
+		return r.timeout
+	}
 }
 
 func buildCommandArgs(cmdDef CommandDef, args map[string]any, cmdName string) []string {
 	result := []string{cmdName}
 
 	if cmdDef.Args != "" {
-		// Template-based: replace {param} with values
-		expanded := cmdDef.Args
-		for key, val := range args {
-			placeholder := "{" + key + "}"
-			expanded = strings.ReplaceAll(expanded, placeholder, fmt.Sprintf("%v", val))
-		}
-		// Split and append non-empty parts
-		for _, part := range strings.Fields(expanded) {
-			if !strings.Contains(part, "{") { // skip unreplaced placeholders
-				result = append(result, part)
-			}
+		// Template-based: each word of the template is expanded on its own,
+		// so a value containing spaces stays a single argument
+		for _, elem := range strings.Fields(cmdDef.Args) {
+			result = append(result, expandElement(elem, cmdDef.Parameters, args)...)
 		}
 	} else {
 		// Flag-based: --key value for each arg
@@ -215,13 +506,104 @@ func buildCommandArgs(cmdDef CommandDef, args map[string]any, cmdName string) []
 		if stdinParam == "" {
 			stdinParam = "content"
 		}
-		for key, val := range args {
+		keys := make([]string, 0, len(args))
+		for key := range args {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			val := args[key]
 			if cmdDef.Stdin && key == stdinParam {
 				continue // stdin param handled separately
 			}
-			result = append(result, fmt.Sprintf("--%s", key), fmt.Sprintf("%v", val))
+			items := []any{val}
+			if list, ok := val.([]any); ok {
+				items = list // Arrays repeat the flag: --tag a --tag b
+			}
+			for _, item := range items {
+				result = append(result, fmt.Sprintf("--%s", key))
+				result = append(result, quoteArg(cmdDef.Parameters[key], formatArg(item))...)
+			}
 		}
 	}
 
 	return result
 }
+
+// placeholderRe matches a {param} placeholder in an args template.
+var placeholderRe = regexp.MustCompile(`\{[^{}\s]+\}`)
+
+// expandElement substitutes the placeholders in one template word. The
+// word is dropped if any placeholder has no value. Substitution is a single
+// pass, so a value containing "{other}" is not expanded again.
+func expandElement(elem string, params map[string]ParameterDef, args map[string]any) []string {
+	missing, raw := false, false
+	out := placeholderRe.ReplaceAllStringFunc(elem, func(m string) string {
+		name := m[1 : len(m)-1]
+		val, ok := args[name]
+		if !ok || val == nil {
+			missing = true
+			return ""
+		}
+		p := params[name]
+		if p.Quoting == "raw" {
+			raw = true
+		}
+		if p.Quoting == "quote" {
+			return shellQuote(formatArg(val))
+		}
+		return formatArg(val)
+	})
+	switch {
+	case missing:
+		return nil
+	case raw:
+		return strings.Fields(out)
+	default:
+		return []string{out}
+	}
+}
+
+// quoteArg applies a parameter's quoting to a flag value.
+func quoteArg(p ParameterDef, s string) []string {
+	switch p.Quoting {
+	case "raw":
+		return strings.Fields(s)
+	case "quote":
+		return []string{shellQuote(s)}
+	default:
+		return []string{s}
+	}
+}
+
+// shellQuote wraps s in single quotes for tools that pass an argument on to
+// a shell, such as "sh -c" or ssh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// formatArg renders an argument value for a command line. Arrays of scalars
+// are joined with commas; objects, and arrays containing them, are passed
+// as JSON.
+func formatArg(val any) string {
+	switch v := val.(type) {
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case []any, map[string]any:
+				data, _ := json.Marshal(v)
+				return string(data)
+			}
+			parts[i] = formatArg(item)
+		}
+		return strings.Join(parts, ",")
+	case map[string]any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64) // Not %v, which writes 1e+06
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
@@ -2,9 +2,16 @@ package toolreg
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/rcliao/teeny-orchestrator/pkg/provider"
 )
@@ -69,6 +76,104 @@ func TestDiscover(t *testing.T) {
 	}
 }
 
+func TestNamespacesAndAliases(t *testing.T) {
+	r := NewRegistry(0)
+	err := r.Register(&ToolManifest{
+		Name:       "agent-memory",
+		Binary:     "echo",
+		Namespaces: []string{"memory"},
+		Aliases:    map[string]string{"mem.save": "agent-memory.add", "mem.find": "search"},
+		MaxOutput:  100,
+		Commands: map[string]CommandDef{
+			"add":    {Description: "Store a memory", Parameters: map[string]ParameterDef{}},
+			"search": {Description: "Search memories", Parameters: map[string]ParameterDef{}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	var names []string
+	descs := map[string]string{}
+	for _, d := range r.ToToolDefs() {
+		names = append(names, d.Name)
+		descs[d.Name] = d.Description
+	}
+	want := "agent-memory.add,agent-memory.search,mem.find,mem.save,memory.add,memory.search"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("defs = %s, want %s", got, want)
+	}
+	if descs["mem.save"] != "[mem] Store a memory (alias of agent-memory.add)" || descs["memory.add"] != "[memory] Store a memory" {
+		t.Errorf("descriptions = %v", descs)
+	}
+
+	// Aliases run the target command.
+	for _, name := range []string{"mem.save", "memory.add"} {
+		res, err := r.Execute(context.Background(), provider.ToolCall{Name: name, Arguments: `{}`})
+		if err != nil || res.Stdout != "add\n" {
+			t.Errorf("Execute(%s) = %q, %v", name, res.Stdout, err)
+		}
+	}
+	if r.OutputLimit("mem.find") != 100 {
+		t.Errorf("OutputLimit(mem.find) = %d", r.OutputLimit("mem.find"))
+	}
+	if _, err := r.Execute(context.Background(), provider.ToolCall{Name: "memory.nope", Arguments: `{}`}); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("unknown command error = %v", err)
+	}
+}
+
+func TestRegisterCollisions(t *testing.T) {
+	cmds := map[string]CommandDef{"run": {Description: "run"}}
+	r := NewRegistry(0)
+	first := &ToolManifest{Name: "git", Binary: "git", Commands: cmds, Aliases: map[string]string{"vcs.run": "run"}}
+	if err := r.Register(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(first); err != nil {
+		t.Errorf("re-registering the same manifest: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		m    *ToolManifest
+		want string
+	}{
+		{"same name", &ToolManifest{Name: "git", Commands: cmds}, `tool name "git" already registered by git`},
+		{"namespace", &ToolManifest{Name: "other", Namespaces: []string{"git"}, Commands: cmds}, `tool name "git" already registered by git`},
+		{"alias", &ToolManifest{Name: "other", Commands: cmds, Aliases: map[string]string{"vcs.run": "run"}}, `"vcs.run" already registered by git`},
+		{"alias vs command", &ToolManifest{Name: "vcs", Commands: cmds}, `"vcs.run" already registered by git`},
+		{"bad alias name", &ToolManifest{Name: "x", Commands: cmds, Aliases: map[string]string{"save": "run"}}, "must look like namespace.command"},
+		{"bad alias target", &ToolManifest{Name: "x", Commands: cmds, Aliases: map[string]string{"x.save": "add"}}, "unknown command"},
+		{"dotted namespace", &ToolManifest{Name: "x", Namespaces: []string{"a.b"}, Commands: cmds}, "invalid tool name"},
+	}
+	for _, tt := range tests {
+		err := r.Register(tt.m)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	// Failed registrations leave nothing behind.
+	if defs := r.ToToolDefs(); len(defs) != 2 {
+		t.Errorf("defs = %+v", defs)
+	}
+}
+
+func TestDiscoverKeepsFirst(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	for i, dir := range dirs {
+		os.MkdirAll(filepath.Join(dir, "tool"), 0755)
+		os.WriteFile(filepath.Join(dir, "tool", "tool.json"), []byte(`{
+			"name": "dup", "binary": "echo",
+			"commands": {"run": {"description": "copy `+string(rune('A'+i))+`"}}
+		}`), 0644)
+	}
+	r := NewRegistry(0)
+	r.Discover(dirs)
+	if defs := r.ToToolDefs(); len(defs) != 1 || defs[0].Description != "[dup] copy A" {
+		t.Errorf("defs = %+v", defs)
+	}
+}
+
 func TestDiscoverMissingDir(t *testing.T) {
 	r := NewRegistry(0)
 	if err := r.Discover([]string{"/nonexistent"}); err != nil {
@@ -90,7 +195,7 @@ func TestExecuteEcho(t *testing.T) {
 		},
 	})
 
-	out, err := r.Execute(context.Background(), provider.ToolCall{
+	res, err := r.Execute(context.Background(), provider.ToolCall{
 		ID:        "1",
 		Name:      "test.greet",
 		Arguments: `{}`,
@@ -98,8 +203,32 @@ func TestExecuteEcho(t *testing.T) {
 	if err != nil {
 		t.Fatalf("execute: %v", err)
 	}
-	if out != "greet hello world\n" {
-		t.Fatalf("unexpected output: %q", out)
+	if res.Stdout != "greet hello world\n" {
+		t.Fatalf("unexpected output: %q", res.Stdout)
+	}
+}
+
+func TestExecuteNonZeroExit(t *testing.T) {
+	r := NewRegistry(0)
+	r.Register(&ToolManifest{
+		Name:   "check",
+		Binary: "sh",
+		Commands: map[string]CommandDef{
+			// Runs sh -c '...': the command name is sh's first argument
+			"-c": {Description: "fail", Args: "{script}", Parameters: map[string]ParameterDef{"script": {Type: "string"}}},
+		},
+	})
+
+	res, err := r.Execute(context.Background(), provider.ToolCall{
+		ID:        "1",
+		Name:      "check.-c",
+		Arguments: `{"script": "echo 2 problems found; echo boom >&2; exit 3"}`,
+	})
+	if err == nil || !strings.Contains(err.Error(), "exited with code 3") {
+		t.Fatalf("err = %v", err)
+	}
+	if res.ExitCode != 3 || res.Stdout != "2 problems found\n" || res.Stderr != "boom\n" || res.Duration <= 0 {
+		t.Errorf("result = %+v", res)
 	}
 }
 
@@ -119,6 +248,51 @@ func TestExecuteInvalidName(t *testing.T) {
 	}
 }
 
+func TestExecuteInvalidArguments(t *testing.T) {
+	r := NewRegistry(0)
+	r.Register(&ToolManifest{Name: "greet", Commands: map[string]CommandDef{"say": {
+		Parameters: map[string]ParameterDef{"name": {Type: "string", Required: true}},
+		Handler:    func(context.Context, map[string]any) (ToolResult, error) { return ToolResult{Stdout: "hi"}, nil },
+	}}})
+	for args, want := range map[string]string{
+		`{"name": `:       "greet.say: invalid arguments: not a JSON object",
+		`{"name": 7}`:     `greet.say: invalid arguments: parameter "name" must be string`,
+		`["Ada"]`:         "greet.say: invalid arguments: not a JSON object",
+		`{"name": "Ada"}`: "",
+	} {
+		_, err := r.Execute(context.Background(), provider.ToolCall{Name: "greet.say", Arguments: args})
+		if want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", args, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidArguments) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", args, err, want)
+		}
+	}
+}
+
+func TestExecuteHandlerResult(t *testing.T) {
+	r := NewRegistry(0)
+	r.Register(&ToolManifest{Name: "b", Commands: map[string]CommandDef{
+		"exit": {Handler: func(context.Context, map[string]any) (ToolResult, error) {
+			return ToolResult{Stdout: "out", Stderr: "err", ExitCode: 2}, errors.New("exited with code 2")
+		}},
+		"text": {Handler: TextHandler(func(context.Context, map[string]any) (string, error) {
+			return "partial", errors.New("broke")
+		})},
+	}})
+	res, err := r.Execute(context.Background(), provider.ToolCall{Name: "b.exit", Arguments: `{}`})
+	if err == nil || res.Stdout != "out" || res.Stderr != "err" || res.ExitCode != 2 {
+		t.Errorf("b.exit = %+v, %v", res, err)
+	}
+	res, err = r.Execute(context.Background(), provider.ToolCall{Name: "b.text", Arguments: `{}`})
+	if err == nil || res.Stdout != "partial" || res.ExitCode != 1 {
+		t.Errorf("b.text = %+v, %v", res, err)
+	}
+}
+
 func TestBuildJSONSchema(t *testing.T) {
 	schema := buildJSONSchema(map[string]ParameterDef{
 		"name": {Type: "string", Description: "Name", Required: true},
@@ -137,3 +311,146 @@ func TestBuildJSONSchema(t *testing.T) {
 		t.Fatalf("unexpected required: %v", req)
 	}
 }
+
+func TestBuildJSONSchemaNested(t *testing.T) {
+	schema := buildJSONSchema(map[string]ParameterDef{
+		"tags": {Type: "array", Items: &ParameterDef{Type: "string", Enum: []any{"bug", "docs"}}},
+		"filter": {Type: "object", Required: true, Properties: map[string]ParameterDef{
+			"owner": {Type: "string", Required: true},
+		}},
+	})
+
+	props := schema["properties"].(map[string]any)
+	items := props["tags"].(map[string]any)["items"].(map[string]any)
+	if items["type"] != "string" || len(items["enum"].([]any)) != 2 {
+		t.Errorf("items = %v", items)
+	}
+	filter := props["filter"].(map[string]any)
+	if _, ok := filter["properties"].(map[string]any)["owner"]; !ok {
+		t.Errorf("filter = %v", filter)
+	}
+	if req := filter["required"].([]string); len(req) != 1 || req[0] != "owner" {
+		t.Errorf("filter required = %v", req)
+	}
+	if req := schema["required"].([]string); len(req) != 1 || req[0] != "filter" {
+		t.Errorf("required = %v", req)
+	}
+}
+
+func TestBuildCommandArgsStructured(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  CommandDef
+		args map[string]any
+		want string
+	}{
+		{"flag array repeats", CommandDef{}, map[string]any{"tag": []any{"a", "b"}}, "run --tag a --tag b"},
+		{"flag object as json", CommandDef{}, map[string]any{"filter": map[string]any{"owner": "me"}}, `run --filter {"owner":"me"}`},
+		{"template array joined", CommandDef{Args: "--tags {tags}"}, map[string]any{"tags": []any{"a", float64(2)}}, "run --tags a,2"},
+		{"flag array of objects", CommandDef{}, map[string]any{"m": []any{map[string]any{"k": float64(1)}}}, `run --m {"k":1}`},
+		{"template nested array as json", CommandDef{Args: "{m}"}, map[string]any{"m": []any{[]any{"a"}}}, `run [["a"]]`},
+		{"large integer", CommandDef{Args: "--limit {limit}"}, map[string]any{"limit": float64(1000000)}, "run --limit 1000000"},
+		{"flag numbers", CommandDef{}, map[string]any{"n": []any{float64(12345678901), 0.5}}, "run --n 12345678901 --n 0.5"},
+	}
+	for _, tt := range tests {
+		got := strings.Join(buildCommandArgs(tt.cmd, tt.args, "run"), " ")
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildCommandArgsTemplate(t *testing.T) {
+	params := map[string]ParameterDef{
+		"query": {Type: "string"},
+		"extra": {Type: "string", Quoting: "raw"},
+		"cmd":   {Type: "string", Quoting: "quote"},
+	}
+	tests := []struct {
+		name     string
+		template string
+		args     map[string]any
+		want     []string
+	}{
+		{"spaces stay in one arg", "search --q {query}", map[string]any{"query": "a b; rm -rf /"}, []string{"run", "search", "--q", "a b; rm -rf /"}},
+		{"embedded placeholder", "--q={query}", map[string]any{"query": "x y"}, []string{"run", "--q=x y"}},
+		{"missing value drops word", "--q {query} --n {limit}", map[string]any{"query": "x"}, []string{"run", "--q", "x", "--n"}},
+		{"no re-expansion", "{query} {cmd}", map[string]any{"query": "{cmd}"}, []string{"run", "{cmd}"}},
+		{"literal braces kept", "-exec {} ;", nil, []string{"run", "-exec", "{}", ";"}},
+		{"raw splits", "{extra}", map[string]any{"extra": "-v  --color"}, []string{"run", "-v", "--color"}},
+		{"quote for shells", "sh -c {cmd}", map[string]any{"cmd": "echo it's"}, []string{"run", "sh", "-c", `'echo it'\''s'`}},
+		{"json object one arg", "--f {query}", map[string]any{"query": map[string]any{"a": "b c"}}, []string{"run", "--f", `{"a":"b c"}`}},
+	}
+	for _, tt := range tests {
+		got := buildCommandArgs(CommandDef{Args: tt.template, Parameters: params}, tt.args, "run")
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildCommandArgsFlagQuoting(t *testing.T) {
+	cmd := CommandDef{Parameters: map[string]ParameterDef{
+		"extra": {Quoting: "raw"},
+		"name":  {},
+	}}
+	got := buildCommandArgs(cmd, map[string]any{"name": "a b", "extra": "x y"}, "run")
+	want := []string{"run", "--extra", "x", "y", "--name", "a b"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTimeoutFor(t *testing.T) {
+	r := NewRegistry(30 * time.Second)
+	tests := []struct {
+		name string
+		tool int
+		cmd  int
+		want time.Duration
+	}{
+		{"registry default", 0, 0, 30 * time.Second},
+		{"tool override", 600, 0, 10 * time.Minute},
+		{"command wins", 600, 5, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.timeoutFor(&ToolManifest{Timeout: tt.tool}, CommandDef{Timeout: tt.cmd})
+			if got != tt.want {
+				t.Fatalf("timeoutFor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	r := NewRegistry(50 * time.Millisecond)
+	r.Register(&ToolManifest{
+		Name:   "slow",
+		Binary: "sleep",
+		Commands: map[string]CommandDef{
+			"5": {Description: "sleep"},
+		},
+	})
+
+	_, err := r.Execute(context.Background(), provider.ToolCall{Name: "slow.5", Arguments: `{}`})
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Fatalf("err = %v, want timeout", err)
+	}
+}
+
+func TestExecuteTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	r := NewRegistry(0)
+	r.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	r.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "missing.cmd", Arguments: `{}`})
+
+	spans := sr.Ended()
+	if len(spans) != 1 || spans[0].Name() != "tool.execute" {
+		t.Fatalf("spans = %v", spans)
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("status = %v, want error", spans[0].Status())
+	}
+}
@@ -0,0 +1,120 @@
+package toolreg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sandbox runs a tool's binary inside a container instead of on the host.
+type Sandbox struct {
+	Image    string  `json:"image"`
+	Runtime  string  `json:"runtime,omitempty"`  // "docker" (default) or "podman", or a path to either
+	Network  string  `json:"network,omitempty"`  // Container network (default "none")
+	Mounts   []Mount `json:"mounts,omitempty"`   // Extra host paths made visible in the container
+	ReadOnly bool    `json:"readonly,omitempty"` // Mount the working directory read-only
+}
+
+// Mount is a host path bound into a sandbox container.
+type Mount struct {
+	Source   string `json:"source"` // Host path, absolute or workspace-relative
+	Target   string `json:"target"` // Absolute path in the container
+	ReadOnly bool   `json:"readonly,omitempty"`
+}
+
+// sandboxWorkDir is where the tool's working directory is mounted.
+const sandboxWorkDir = "/workspace"
+
+// validate reports manifest mistakes before anything runs.
+func (s *Sandbox) validate() error {
+	if s.Image == "" {
+		return fmt.Errorf("sandbox: image is required")
+	}
+	for _, m := range s.Mounts {
+		if m.Source == "" || !strings.HasPrefix(m.Target, "/") {
+			return fmt.Errorf("sandbox: mount %q → %q needs a source and an absolute target", m.Source, m.Target)
+		}
+	}
+	return nil
+}
+
+// sandboxCommand wraps a tool invocation in "docker run". The working
+// directory is mounted at /workspace, and the container has no network
+// unless the manifest asks for one. Mounts are held to the path policy
+// (see Paths.CanMount), as the tool can touch anything in them. Variables from the manifest's env and
+// pass_env are forwarded by name, so their values, secrets included, never
+// appear on the container runtime's command line; the caller sets cmd.Env.
+func (r *Registry) sandboxCommand(ctx context.Context, tool *ToolManifest, dir string, args, env []string) (*exec.Cmd, error) {
+	sb := tool.Sandbox
+	runtime := sb.Runtime
+	if runtime == "" {
+		runtime = "docker"
+	}
+	network := sb.Network
+	if network == "" {
+		network = "none"
+	}
+	hostDir, err := realPath(dir)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: resolve workdir: %w", err)
+	}
+	if err := r.paths.CanMount(hostDir, !sb.ReadOnly); err != nil {
+		return nil, fmt.Errorf("sandbox: workdir: %w", err)
+	}
+
+	name := fmt.Sprintf("teeny-%s-%d", tool.Name, time.Now().UnixNano())
+	run := []string{"run", "--rm", "-i", "--name", name, "--network", network, "-w", sandboxWorkDir}
+	run = append(run, "-v", volume(hostDir, sandboxWorkDir, sb.ReadOnly))
+	for _, m := range sb.Mounts {
+		src := m.Source
+		if !filepath.IsAbs(src) && r.workspace != "" {
+			src = filepath.Join(r.workspace, src)
+		}
+		if src, err = realPath(src); err != nil {
+			return nil, fmt.Errorf("sandbox: resolve mount %s: %w", m.Source, err)
+		}
+		if r.jail {
+			root, err := realPath(r.workspace)
+			if err != nil {
+				return nil, fmt.Errorf("sandbox: resolve workspace: %w", err)
+			}
+			if !within(root, src) {
+				return nil, fmt.Errorf("sandbox: mount %s is outside the workspace %s", m.Source, root)
+			}
+		}
+		if err := r.paths.CanMount(src, !m.ReadOnly); err != nil {
+			return nil, fmt.Errorf("sandbox: mount %s: %w", m.Source, err)
+		}
+		run = append(run, "-v", volume(src, m.Target, m.ReadOnly))
+	}
+	for _, kv := range env {
+		k, _, _ := strings.Cut(kv, "=")
+		if _, ok := tool.Env[k]; ok || slices.Contains(tool.PassEnv, k) || slices.Contains(r.passEnv, k) {
+			run = append(run, "-e", k)
+		}
+	}
+	run = append(run, sb.Image, tool.Binary)
+	run = append(run, args...)
+
+	cmd := exec.CommandContext(ctx, runtime, run...)
+	// Killing the runtime client does not stop the container, so stop it
+	// by name too.
+	cmd.Cancel = func() error {
+		exec.Command(runtime, "kill", name).Run()
+		return cmd.Process.Kill()
+	}
+	return cmd, nil
+}
+
+// volume formats a -v bind mount.
+func volume(src, target string, readOnly bool) string {
+	v := src + ":" + target
+	if readOnly {
+		v += ":ro"
+	}
+	return v
+}
@@ -0,0 +1,118 @@
+package toolreg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+// fakeRuntime writes a stand-in for docker that prints its arguments, one
+// per line, and the value of TOKEN.
+func fakeRuntime(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "docker")
+	script := "#!/bin/sh\nfor a in \"$@\"; do echo \"$a\"; done\necho \"TOKEN=$TOKEN\"\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecuteSandboxed(t *testing.T) {
+	ws, _ := filepath.EvalSymlinks(t.TempDir())
+	os.MkdirAll(filepath.Join(ws, "data"), 0755)
+	t.Setenv("TEST_SECRET_TOKEN", "tok")
+
+	r := NewRegistry(0)
+	r.SetWorkspace(ws, true)
+	r.UseSecrets(EnvSecrets{Prefix: "TEST_SECRET_"})
+	err := r.Register(&ToolManifest{
+		Name:   "untrusted",
+		Binary: "scan",
+		Env:    map[string]string{"TOKEN": "${SECRET:token}"},
+		Sandbox: &Sandbox{
+			Image:   "alpine:3",
+			Runtime: fakeRuntime(t),
+			Mounts:  []Mount{{Source: "data", Target: "/data", ReadOnly: true}},
+		},
+		Commands: map[string]CommandDef{"run": {Description: "scan", Args: "--path {path}"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := r.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "untrusted.run", Arguments: `{"path": "a b"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(strings.Split(strings.TrimSpace(res.Stdout), "\n"), " ")
+	for _, want := range []string{
+		"run --rm -i --name teeny-untrusted-",
+		"--network none -w /workspace -v " + ws + ":/workspace -v " + filepath.Join(ws, "data") + ":/data:ro -e TOKEN alpine:3 scan run --path a b",
+		"TOKEN=tok",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("runtime invocation missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "-e TOKEN=") {
+		t.Errorf("secret value on the command line:\n%s", got)
+	}
+}
+
+func TestSandboxRejects(t *testing.T) {
+	ws, _ := filepath.EvalSymlinks(t.TempDir())
+	tests := []struct {
+		name string
+		sb   *Sandbox
+		want string
+	}{
+		{"no image", &Sandbox{}, "image is required"},
+		{"relative target", &Sandbox{Image: "x", Mounts: []Mount{{Source: "a", Target: "a"}}}, "absolute target"},
+		{"mount outside jail", &Sandbox{Image: "x", Runtime: fakeRuntime(t), Mounts: []Mount{{Source: "/", Target: "/host"}}}, "outside the workspace"},
+	}
+	for _, tt := range tests {
+		r := NewRegistry(0)
+		r.SetWorkspace(ws, true)
+		err := r.Register(&ToolManifest{Name: "t", Binary: "x", Sandbox: tt.sb, Commands: map[string]CommandDef{"run": {}}})
+		if err == nil {
+			_, err = r.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "t.run", Arguments: `{}`})
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSandboxMountsFollowPaths(t *testing.T) {
+	home, _ := filepath.EvalSymlinks(t.TempDir())
+	ws := filepath.Join(home, "project")
+	for _, dir := range []string{filepath.Join(ws, "data"), filepath.Join(home, ".ssh"), filepath.Join(home, "notes")} {
+		os.MkdirAll(dir, 0755)
+	}
+	tests := []struct {
+		name   string
+		mounts []Mount
+		want   string // substring of error, "" if it runs
+	}{
+		{"inside the workspace", []Mount{{Source: "data", Target: "/data"}}, ""},
+		{"denied path", []Mount{{Source: filepath.Join(home, ".ssh"), Target: "/keys", ReadOnly: true}}, "is denied"},
+		{"holds a denied path", []Mount{{Source: home, Target: "/home", ReadOnly: true}}, "holds denied"},
+		{"read-only elsewhere", []Mount{{Source: filepath.Join(home, "notes"), Target: "/notes", ReadOnly: true}}, ""},
+		{"writable elsewhere", []Mount{{Source: filepath.Join(home, "notes"), Target: "/notes"}}, "outside the writable paths"},
+	}
+	for _, tt := range tests {
+		r := NewRegistry(0)
+		r.SetWorkspace(ws, false)
+		r.SetPaths(NewPaths(PathPolicy{Deny: []string{filepath.Join(home, ".ssh")}}, ws))
+		r.Register(&ToolManifest{Name: "t", Binary: "x", Sandbox: &Sandbox{Image: "x", Runtime: fakeRuntime(t), Mounts: tt.mounts}, Commands: map[string]CommandDef{"run": {}}})
+		_, err := r.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "t.run", Arguments: `{}`})
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package toolreg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DefaultEnv lists the parent environment variables every tool receives.
+// Anything else must be named in the manifest's pass_env or set in its env.
+var DefaultEnv = []string{"PATH", "HOME", "LANG", "TMPDIR"}
+
+// ErrSecretNotFound is returned by a SecretProvider that has no value for a
+// name, so a chain can try the next provider.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider resolves ${SECRET:name} references in tool environments.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// EnvSecrets reads a secret from the environment variable named Prefix
+// followed by the upper-cased name, e.g. github_token → GITHUB_TOKEN.
+type EnvSecrets struct {
+	Prefix string
+}
+
+func (s EnvSecrets) Secret(_ context.Context, name string) (string, error) {
+	v, ok := os.LookupEnv(s.Prefix + strings.ToUpper(name))
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return v, nil
+}
+
+// FileSecrets reads a secret from the file Dir/name, without the trailing
+// newline.
+type FileSecrets struct {
+	Dir string
+}
+
+func (s FileSecrets) Secret(_ context.Context, name string) (string, error) {
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(s.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// KeyringSecrets reads a secret from the OS keyring, stored under Service
+// with the secret name as the account. It uses security(1) on macOS and
+// secret-tool(1) elsewhere.
+type KeyringSecrets struct {
+	Service string
+}
+
+func (s KeyringSecrets) Secret(ctx context.Context, name string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.CommandContext(ctx, "security", "find-generic-password", "-s", s.Service, "-a", name, "-w")
+	} else {
+		cmd = exec.CommandContext(ctx, "secret-tool", "lookup", "service", s.Service, "account", name)
+	}
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.Is(err, exec.ErrNotFound) || errors.As(err, &exitErr) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimRight(out, "\r\n")), nil
+}
+
+// ChainSecrets tries each provider in order and returns the first value
+// found.
+type ChainSecrets []SecretProvider
+
+func (c ChainSecrets) Secret(ctx context.Context, name string) (string, error) {
+	for _, p := range c {
+		v, err := p.Secret(ctx, name)
+		if !errors.Is(err, ErrSecretNotFound) {
+			return v, err
+		}
+	}
+	return "", ErrSecretNotFound
+}
+
+// UseSecrets sets the provider for ${SECRET:name} references in manifest
+// env values. Without one, such references fail.
+func (r *Registry) UseSecrets(p SecretProvider) {
+	r.secrets = p
+}
+
+// SetPassEnv adds parent environment variables passed to every tool, on top
+// of DefaultEnv.
+func (r *Registry) SetPassEnv(names []string) {
+	r.passEnv = names
+}
+
+// toolEnv builds the environment for running tool: DefaultEnv, the
+// registry's and manifest's pass-through variables, then the manifest's env
+// with ${SECRET:name} and ${VAR} references expanded. An unresolvable
+// reference is an error, so a tool never runs with a missing credential.
+func (r *Registry) toolEnv(ctx context.Context, tool *ToolManifest) ([]string, error) {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if slices.Contains(DefaultEnv, name) || slices.Contains(r.passEnv, name) || slices.Contains(tool.PassEnv, name) {
+			if _, overridden := tool.Env[name]; !overridden {
+				env = append(env, kv)
+			}
+		}
+	}
+
+	env = append(env, r.paths.Env()...)
+
+	keys := make([]string, 0, len(tool.Env))
+	for k := range tool.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var expandErr error
+		v := os.Expand(tool.Env[k], func(ref string) string {
+			if expandErr != nil {
+				return ""
+			}
+			if name, ok := strings.CutPrefix(ref, "SECRET:"); ok {
+				if r.secrets == nil {
+					expandErr = fmt.Errorf("secret %q: no secrets provider configured", name)
+					return ""
+				}
+				s, err := r.secrets.Secret(ctx, name)
+				if err != nil {
+					expandErr = fmt.Errorf("secret %q: %w", name, err)
+				}
+				return s
+			}
+			s, ok := os.LookupEnv(ref)
+			if !ok {
+				expandErr = fmt.Errorf("%s is not set", ref)
+			}
+			return s
+		})
+		if expandErr != nil {
+			return nil, fmt.Errorf("env %s: %w", k, expandErr)
+		}
+		env = append(env, k+"="+v)
+	}
+	return env, nil
+}
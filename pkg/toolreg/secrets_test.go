@@ -0,0 +1,113 @@
+package toolreg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func TestSecretProviders(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "db_password"), []byte("hunter2\n"), 0600)
+	t.Setenv("TEST_GITHUB_TOKEN", "ghp_env")
+
+	chain := ChainSecrets{EnvSecrets{Prefix: "TEST_"}, FileSecrets{Dir: dir}}
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{"github_token", "ghp_env", nil},
+		{"db_password", "hunter2", nil},
+		{"missing", "", ErrSecretNotFound},
+	}
+	for _, tt := range tests {
+		got, err := chain.Secret(context.Background(), tt.name)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if _, err := (FileSecrets{Dir: dir}).Secret(context.Background(), "../etc/passwd"); err == nil || errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("path traversal: err = %v", err)
+	}
+}
+
+func TestToolEnv(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin:/bin")
+	t.Setenv("TEST_UNRELATED", "leak")
+	t.Setenv("TEST_PASSED", "yes")
+	t.Setenv("TEST_GLOBAL", "all")
+
+	r := NewRegistry(0)
+	r.SetPassEnv([]string{"TEST_GLOBAL"})
+	r.UseSecrets(ChainSecrets{EnvSecrets{Prefix: "TEST_SECRET_"}})
+	t.Setenv("TEST_SECRET_API_KEY", "s3cret")
+
+	env, err := r.toolEnv(context.Background(), &ToolManifest{
+		Name:    "t",
+		PassEnv: []string{"TEST_PASSED"},
+		Env:     map[string]string{"API_KEY": "${SECRET:api_key}", "URL": "https://${TEST_PASSED}.example"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(env, "\n")
+	for _, want := range []string{"PATH=/usr/bin:/bin", "TEST_PASSED=yes", "TEST_GLOBAL=all", "API_KEY=s3cret", "URL=https://yes.example"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("env missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "TEST_UNRELATED") {
+		t.Errorf("env leaked parent variable:\n%s", got)
+	}
+}
+
+func TestToolEnvUnresolved(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets SecretProvider
+		value   string
+		want    string
+	}{
+		{"no provider", nil, "${SECRET:token}", `secret "token": no secrets provider configured`},
+		{"missing secret", ChainSecrets{}, "${SECRET:token}", `secret "token": secret not found`},
+		{"unset var", nil, "${TEST_DEFINITELY_UNSET}", "TEST_DEFINITELY_UNSET is not set"},
+	}
+	for _, tt := range tests {
+		r := NewRegistry(0)
+		if tt.secrets != nil {
+			r.UseSecrets(tt.secrets)
+		}
+		_, err := r.toolEnv(context.Background(), &ToolManifest{Env: map[string]string{"X": tt.value}})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestExecuteInjectsEnv(t *testing.T) {
+	t.Setenv("TEST_UNRELATED", "leak")
+	r := NewRegistry(0)
+	r.UseSecrets(ChainSecrets{EnvSecrets{Prefix: "TEST_SECRET_"}})
+	t.Setenv("TEST_SECRET_TOKEN", "tok")
+	r.Register(&ToolManifest{
+		Name:     "env",
+		Binary:   "env",
+		Env:      map[string]string{"TOKEN": "${SECRET:token}"},
+		Commands: map[string]CommandDef{"printenv": {Description: "print"}},
+	})
+
+	res, err := r.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "env.printenv", Arguments: `{}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res.Stdout, "TOKEN=tok") || strings.Contains(res.Stdout, "TEST_UNRELATED") {
+		t.Errorf("output = %q", res.Stdout)
+	}
+}
@@ -0,0 +1,152 @@
+package toolreg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidArguments is wrapped by the errors for tool calls whose
+// arguments are not a JSON object or don't match the command's parameters,
+// which the model can fix by calling again.
+var ErrInvalidArguments = errors.New("invalid arguments")
+
+// ValidateArgs checks LLM-provided arguments against a command's parameter
+// definitions: required fields, types, and enums, including the items of
+// arrays and the fields of nested objects. Unknown arguments are rejected
+// when the command declares parameters. The returned error lists every
+// problem so the model can correct the call in one go.
+func ValidateArgs(params map[string]ParameterDef, args map[string]any) error {
+	var problems []string
+	validateObject("", params, args, &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidArguments, strings.Join(problems, "; "))
+}
+
+// validateObject checks the fields of one object. prefix is the path of the
+// object itself, e.g. "filter." for a nested one and "" at the top level.
+func validateObject(prefix string, params map[string]ParameterDef, args map[string]any, problems *[]string) {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := params[name]
+		val, ok := args[name]
+		if !ok || val == nil {
+			if p.Required {
+				*problems = append(*problems, fmt.Sprintf("missing required parameter %q", prefix+name))
+			}
+			continue
+		}
+		validateValue(prefix+name, p, val, problems)
+	}
+
+	if len(params) > 0 {
+		var unknown []string
+		for name := range args {
+			if _, ok := params[name]; !ok {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			*problems = append(*problems, fmt.Sprintf("unknown parameter %q (expected one of: %s)", prefix+name, strings.Join(names, ", ")))
+		}
+	}
+}
+
+// validateValue checks one value, then the items or fields inside it.
+func validateValue(path string, p ParameterDef, val any, problems *[]string) {
+	if msg := checkType(p.Type, val); msg != "" {
+		*problems = append(*problems, fmt.Sprintf("parameter %q %s", path, msg))
+		return
+	}
+	if len(p.Enum) > 0 && !inEnum(p.Enum, val) {
+		*problems = append(*problems, fmt.Sprintf("parameter %q must be one of %s, got %v", path, formatEnum(p.Enum), val))
+		return
+	}
+	switch v := val.(type) {
+	case []any:
+		if p.Items == nil {
+			return
+		}
+		for i, item := range v {
+			validateValue(fmt.Sprintf("%s[%d]", path, i), *p.Items, item, problems)
+		}
+	case map[string]any:
+		if p.Type == "object" && p.Properties != nil {
+			validateObject(path+".", p.Properties, v, problems)
+		}
+	}
+}
+
+// checkType returns a description of the mismatch, or "" if val fits typ.
+// Values are as decoded by encoding/json (numbers are float64).
+func checkType(typ string, val any) string {
+	ok := true
+	switch typ {
+	case "", "any":
+		return ""
+	case "string":
+		_, ok = val.(string)
+	case "number":
+		_, ok = val.(float64)
+	case "integer":
+		f, isNum := val.(float64)
+		ok = isNum && f == math.Trunc(f)
+	case "boolean":
+		_, ok = val.(bool)
+	case "array":
+		_, ok = val.([]any)
+	case "object":
+		_, ok = val.(map[string]any)
+	}
+	if ok {
+		return ""
+	}
+	return fmt.Sprintf("must be %s, got %s", typ, jsonTypeName(val))
+}
+
+func jsonTypeName(val any) string {
+	switch v := val.(type) {
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", val)
+	}
+}
+
+func inEnum(enum []any, val any) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(val) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []any) string {
+	parts := make([]string, len(enum))
+	for i, e := range enum {
+		parts[i] = fmt.Sprintf("%q", fmt.Sprint(e))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
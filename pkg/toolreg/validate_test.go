@@ -0,0 +1,126 @@
+package toolreg
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func TestValidateArgs(t *testing.T) {
+	params := map[string]ParameterDef{
+		"content": {Type: "string", Required: true},
+		"limit":   {Type: "integer"},
+		"format":  {Type: "string", Enum: []any{"json", "text"}},
+		"verbose": {Type: "boolean"},
+	}
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string // substring of error, "" for valid
+	}{
+		{"valid", map[string]any{"content": "x", "limit": float64(5), "format": "json"}, ""},
+		{"missing required", map[string]any{"limit": float64(5)}, `missing required parameter "content"`},
+		{"wrong type", map[string]any{"content": "x", "limit": "five"}, `parameter "limit" must be integer, got string`},
+		{"fractional integer", map[string]any{"content": "x", "limit": 1.5}, `must be integer, got number`},
+		{"bad enum", map[string]any{"content": "x", "format": "xml"}, `must be one of ["json", "text"], got xml`},
+		{"unknown param", map[string]any{"content": "x", "colour": "red"}, `unknown parameter "colour"`},
+		{"null optional", map[string]any{"content": "x", "verbose": nil}, ""},
+	}
+
+	for _, tt := range tests {
+		err := ValidateArgs(params, tt.args)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want substring %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidateArgs_ReportsAllProblems(t *testing.T) {
+	params := map[string]ParameterDef{
+		"a": {Type: "string", Required: true},
+		"b": {Type: "number"},
+	}
+	err := ValidateArgs(params, map[string]any{"b": true})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), `"a"`) || !strings.Contains(err.Error(), `"b"`) {
+		t.Errorf("expected both problems reported, got: %v", err)
+	}
+}
+
+func TestValidateArgs_Nested(t *testing.T) {
+	params := map[string]ParameterDef{
+		"tags": {Type: "array", Items: &ParameterDef{Type: "string", Enum: []any{"bug", "docs"}}},
+		"filter": {Type: "object", Properties: map[string]ParameterDef{
+			"owner": {Type: "string", Required: true},
+			"since": {Type: "integer"},
+		}},
+		"raw": {Type: "object"},
+	}
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string // substring of error, "" for valid
+	}{
+		{"valid", map[string]any{
+			"tags":   []any{"bug", "docs"},
+			"filter": map[string]any{"owner": "me", "since": float64(3)},
+			"raw":    map[string]any{"anything": true},
+		}, ""},
+		{"item type", map[string]any{"tags": []any{"bug", float64(2)}}, `parameter "tags[1]" must be string, got integer`},
+		{"item enum", map[string]any{"tags": []any{"feature"}}, `parameter "tags[0]" must be one of ["bug", "docs"]`},
+		{"not an array", map[string]any{"tags": "bug"}, `parameter "tags" must be array, got string`},
+		{"nested required", map[string]any{"filter": map[string]any{}}, `missing required parameter "filter.owner"`},
+		{"nested type", map[string]any{"filter": map[string]any{"owner": "me", "since": "today"}}, `parameter "filter.since" must be integer`},
+		{"nested unknown", map[string]any{"filter": map[string]any{"owner": "me", "repo": "x"}}, `unknown parameter "filter.repo"`},
+	}
+
+	for _, tt := range tests {
+		err := ValidateArgs(params, tt.args)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want substring %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidateArgs_NoParamsAcceptsAnything(t *testing.T) {
+	if err := ValidateArgs(nil, map[string]any{"text": "hi"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestExecuteRejectsInvalidArgs(t *testing.T) {
+	r := NewRegistry(0)
+	r.Register(&ToolManifest{
+		Name:   "test",
+		Binary: "echo",
+		Commands: map[string]CommandDef{
+			"greet": {
+				Description: "greet",
+				Parameters:  map[string]ParameterDef{"name": {Type: "string", Required: true}},
+			},
+		},
+	})
+
+	_, err := r.Execute(context.Background(), provider.ToolCall{Name: "test.greet", Arguments: `{}`})
+	if err == nil || !strings.Contains(err.Error(), "test.greet") || !strings.Contains(err.Error(), "name") {
+		t.Fatalf("expected descriptive validation error, got %v", err)
+	}
+}
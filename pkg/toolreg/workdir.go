@@ -0,0 +1,78 @@
+package toolreg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SetWorkspace sets the directory tools run in and relative workdirs are
+// resolved against. With jail set, a tool whose working directory resolves
+// outside root, after following symlinks, is refused.
+func (r *Registry) SetWorkspace(root string, jail bool) {
+	r.workspace = root
+	r.jail = jail
+}
+
+// SetPaths limits the files tools may touch. Tools are refused a working
+// directory they may not read, and manifest tools receive the policy in
+// their environment (see Paths.Env) to enforce themselves.
+func (r *Registry) SetPaths(p *Paths) {
+	r.paths = p
+}
+
+// workDirFor resolves the working directory for a command: the command's
+// workdir, then the tool's, then the workspace. An empty result means the
+// current directory.
+func (r *Registry) workDirFor(tool *ToolManifest, cmd CommandDef) (string, error) {
+	dir := cmd.WorkDir
+	if dir == "" {
+		dir = tool.WorkDir
+	}
+	if dir != "" && !filepath.IsAbs(dir) && r.workspace != "" {
+		dir = filepath.Join(r.workspace, dir)
+	}
+	if dir == "" {
+		dir = r.workspace
+	}
+	if err := r.paths.CanRead(dir); err != nil {
+		return "", fmt.Errorf("workdir: %w", err)
+	}
+	if !r.jail {
+		return dir, nil
+	}
+
+	root, err := realPath(r.workspace)
+	if err != nil {
+		return "", fmt.Errorf("resolve workspace: %w", err)
+	}
+	resolved, err := realPath(dir)
+	if err != nil {
+		return "", fmt.Errorf("resolve workdir: %w", err)
+	}
+	if !within(root, resolved) {
+		return "", fmt.Errorf("workdir %s is outside the workspace %s", dir, root)
+	}
+	return resolved, nil
+}
+
+// realPath makes path absolute and follows symlinks where it exists.
+func realPath(path string) (string, error) {
+	if path == "" {
+		path = "."
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	return abs, nil
+}
+
+// within reports whether path is root or below it.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
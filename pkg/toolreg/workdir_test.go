@@ -0,0 +1,78 @@
+package toolreg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+)
+
+func TestWorkDirFor(t *testing.T) {
+	ws, _ := filepath.EvalSymlinks(t.TempDir())
+	outside, _ := filepath.EvalSymlinks(t.TempDir())
+	os.MkdirAll(filepath.Join(ws, "repo", "sub"), 0755)
+	os.Symlink(outside, filepath.Join(ws, "escape"))
+
+	tests := []struct {
+		name    string
+		jail    bool
+		tool    string
+		cmd     string
+		want    string
+		wantErr string
+	}{
+		{"default is workspace", false, "", "", ws, ""},
+		{"tool relative", false, "repo", "", filepath.Join(ws, "repo"), ""},
+		{"command overrides tool", false, "repo", "repo/sub", filepath.Join(ws, "repo", "sub"), ""},
+		{"absolute without jail", false, outside, "", outside, ""},
+		{"jail allows inside", true, "repo", "", filepath.Join(ws, "repo"), ""},
+		{"jail rejects absolute", true, outside, "", "", "outside the workspace"},
+		{"jail rejects dotdot", true, "../", "", "", "outside the workspace"},
+		{"jail rejects symlink", true, "escape", "", "", "outside the workspace"},
+	}
+	for _, tt := range tests {
+		r := NewRegistry(0)
+		r.SetWorkspace(ws, tt.jail)
+		got, err := r.workDirFor(&ToolManifest{WorkDir: tt.tool}, CommandDef{WorkDir: tt.cmd})
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestExecuteWorkDir(t *testing.T) {
+	ws, _ := filepath.EvalSymlinks(t.TempDir())
+	os.MkdirAll(filepath.Join(ws, "repo"), 0755)
+
+	r := NewRegistry(0)
+	r.SetWorkspace(ws, true)
+	r.Register(&ToolManifest{
+		Name:    "where",
+		Binary:  "sh",
+		WorkDir: "repo",
+		Commands: map[string]CommandDef{
+			"-c":     {Description: "print dir", Args: "pwd"}, // Runs sh -c pwd
+			"escape": {Description: "escape", WorkDir: "/"},
+		},
+	})
+
+	res, err := r.Execute(context.Background(), provider.ToolCall{ID: "1", Name: "where.-c", Arguments: `{}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(res.Stdout) != filepath.Join(ws, "repo") {
+		t.Errorf("pwd = %q", res.Stdout)
+	}
+	if _, err := r.Execute(context.Background(), provider.ToolCall{ID: "2", Name: "where.escape", Arguments: `{}`}); err == nil {
+		t.Error("expected jail to refuse /")
+	}
+}
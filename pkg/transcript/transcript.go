@@ -0,0 +1,351 @@
+// Package transcript records agent runs as JSON Lines, one file per run,
+// or in a Store such as a database, for offline analysis and for replaying
+// runs through evals.
+package transcript
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rcliao/teeny-orchestrator/pkg/provider"
+	"github.com/rcliao/teeny-orchestrator/pkg/redact"
+)
+
+// Entry types, in the order they appear in a transcript.
+const (
+	TypeStart   = "start"   // The run began; Session, Intent, and Message (the prompt) are set
+	TypeMessage = "message" // A message added mid-run, e.g. steering or a loop note
+	TypeLLM     = "llm"     // An LLM call; Message holds the reply, or Error the failure
+	TypeTool    = "tool"    // A tool call; ToolCall and Result are set
+	TypeEnd     = "end"     // The run finished; Result or Error, and the run's total Usage and Cost
+)
+
+// Entry is one line of a transcript.
+type Entry struct {
+	Run        string             `json:"run"`
+	Seq        int                `json:"seq"`
+	Time       time.Time          `json:"time"`
+	Type       string             `json:"type"`
+	Session    string             `json:"session,omitempty"`
+	Intent     string             `json:"intent,omitempty"`
+	Iteration  int                `json:"iteration,omitempty"`
+	Model      string             `json:"model,omitempty"`
+	Message    *provider.Message  `json:"message,omitempty"`
+	ToolCall   *provider.ToolCall `json:"tool_call,omitempty"`
+	Result     string             `json:"result,omitempty"`
+	Withheld   string             `json:"withheld,omitempty"` // Tool output a guardrail quarantined; Result holds what the model read instead
+	ExitCode   int                `json:"exit_code,omitempty"`
+	StopReason string             `json:"stop_reason,omitempty"`
+	Usage      *provider.Usage    `json:"usage,omitempty"`
+	Cost       float64            `json:"cost_usd,omitempty"`
+	DurationMs int64              `json:"duration_ms,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// Store keeps transcripts somewhere other than files, e.g. a database.
+type Store interface {
+	// Append adds e to the transcript of run e.Run.
+	Append(e Entry) error
+}
+
+// Writer creates a transcript file per run in a directory, or records
+// runs in a Store. A nil Writer records nothing.
+type Writer struct {
+	dir      string
+	store    Store
+	redactor *redact.Redactor
+}
+
+// New writes transcripts to dir, creating it on first use.
+func New(dir string) *Writer {
+	return &Writer{dir: dir}
+}
+
+// NewStore records transcripts in s instead of files.
+func NewStore(s Store) *Writer {
+	return &Writer{store: s}
+}
+
+// SetRedactor masks secrets in every entry written from now on.
+func (w *Writer) SetRedactor(r *redact.Redactor) {
+	w.redactor = r
+}
+
+// Start opens the transcript of a new run and records its prompt. If the
+// file can't be created the error is logged and the returned Run (like a
+// nil Run) discards entries, so a full disk never fails a run.
+func (w *Writer) Start(session, intent string, prompt provider.Message) *Run {
+	if w == nil {
+		return nil
+	}
+	id := newID()
+	if w.store != nil {
+		r := &Run{id: id, redactor: w.redactor, store: w.store, start: time.Now()}
+		r.write(Entry{Type: TypeStart, Session: session, Intent: intent, Message: stripAttachments(prompt)})
+		return r
+	}
+	if err := os.MkdirAll(w.dir, 0o700); err != nil {
+		log.Printf("[transcript] %v", err)
+		return nil
+	}
+	path := filepath.Join(w.dir, id+".jsonl")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		log.Printf("[transcript] %v", err)
+		return nil
+	}
+	r := &Run{id: id, path: path, redactor: w.redactor, f: f, enc: json.NewEncoder(f), start: time.Now()}
+	r.write(Entry{Type: TypeStart, Session: session, Intent: intent, Message: stripAttachments(prompt)})
+	return r
+}
+
+// Run is the transcript of one run. Its methods are safe for concurrent
+// use and do nothing on a nil Run.
+type Run struct {
+	id       string
+	path     string
+	start    time.Time
+	redactor *redact.Redactor
+
+	mu     sync.Mutex
+	f      *os.File // nil once closed or after a write error
+	enc    *json.Encoder
+	store  Store // Instead of f
+	closed bool  // Once ended or after a write error
+	seq    int
+	usage  provider.Usage
+	cost   float64
+}
+
+// ID returns the run ID, or "" for a nil Run.
+func (r *Run) ID() string {
+	if r == nil {
+		return ""
+	}
+	return r.id
+}
+
+// Path returns the transcript file, or "" for a nil Run or one recorded
+// in a Store.
+func (r *Run) Path() string {
+	if r == nil {
+		return ""
+	}
+	return r.path
+}
+
+// Message records a message added to the conversation mid-run.
+func (r *Run) Message(iteration int, msg provider.Message) {
+	r.write(Entry{Type: TypeMessage, Iteration: iteration, Message: stripAttachments(msg)})
+}
+
+// LLM records an LLM call that took d. On success resp holds the reply and
+// usd its estimated cost; otherwise err is the failure.
+func (r *Run) LLM(iteration int, model string, resp *provider.ChatResponse, usd float64, d time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	e := Entry{Type: TypeLLM, Iteration: iteration, Model: model, DurationMs: d.Milliseconds()}
+	if err != nil {
+		e.Error = err.Error()
+	} else {
+		if resp.Model != "" {
+			e.Model = resp.Model
+		}
+		e.Message = &provider.Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls, Thinking: resp.Thinking}
+		e.StopReason = resp.StopReason
+		e.Usage = &resp.Usage
+		e.Cost = usd
+	}
+	r.mu.Lock()
+	if err == nil {
+		r.usage.PromptTokens += resp.Usage.PromptTokens
+		r.usage.CompletionTokens += resp.Usage.CompletionTokens
+		r.cost += usd
+	}
+	r.mu.Unlock()
+	r.write(e)
+}
+
+// Tool records a tool call that took d. result is the output passed back
+// to the model.
+func (r *Run) Tool(iteration int, tc provider.ToolCall, result string, exitCode int, d time.Duration, err error) {
+	e := Entry{Type: TypeTool, Iteration: iteration, ToolCall: &tc, Result: result, ExitCode: exitCode, DurationMs: d.Milliseconds()}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.write(e)
+}
+
+// Quarantined records a tool call whose output a guardrail withheld from
+// the model, which read notice instead.
+func (r *Run) Quarantined(iteration int, tc provider.ToolCall, notice, output string, exitCode int, d time.Duration) {
+	r.write(Entry{Type: TypeTool, Iteration: iteration, ToolCall: &tc, Result: notice, Withheld: output, ExitCode: exitCode, DurationMs: d.Milliseconds()})
+}
+
+// End records the run's outcome and closes the transcript.
+func (r *Run) End(result string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	usage, usd := r.usage, r.cost
+	r.mu.Unlock()
+	e := Entry{Type: TypeEnd, Result: result, Usage: &usage, Cost: usd, DurationMs: time.Since(r.start).Milliseconds()}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.write(e)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.f != nil {
+		if err := r.f.Close(); err != nil {
+			log.Printf("[transcript] %s: %v", r.id, err)
+		}
+		r.f = nil
+	}
+}
+
+func (r *Run) write(e Entry) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.seq++
+	e.Run, e.Seq, e.Time = r.id, r.seq, time.Now()
+	r.redact(&e)
+	var err error
+	if r.store != nil {
+		err = r.store.Append(e)
+	} else {
+		err = r.enc.Encode(e)
+	}
+	if err != nil {
+		log.Printf("[transcript] %s: %v; no longer recording this run", r.id, err)
+		r.closed = true
+		if r.f != nil {
+			r.f.Close()
+			r.f = nil
+		}
+	}
+}
+
+// redact masks secrets in the free-text fields of e.
+func (r *Run) redact(e *Entry) {
+	if r.redactor == nil {
+		return
+	}
+	if e.Message != nil {
+		msg := r.redactor.Message(*e.Message)
+		e.Message = &msg
+	}
+	if e.ToolCall != nil {
+		tc := *e.ToolCall
+		tc.Arguments = r.redactor.String(tc.Arguments)
+		e.ToolCall = &tc
+	}
+	e.Result = r.redactor.String(e.Result)
+	e.Withheld = r.redactor.String(e.Withheld)
+	e.Error = r.redactor.String(e.Error)
+}
+
+// Read loads the entries of a transcript file.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("transcript: %s:%d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// Summary condenses a transcript, e.g. to turn a past run into a
+// benchmark case (eval.Case) from its Prompt and Result.
+type Summary struct {
+	Run        string         `json:"run"`
+	Session    string         `json:"session"`
+	Prompt     string         `json:"prompt"`
+	Result     string         `json:"result,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	LLMCalls   int            `json:"llm_calls"`
+	ToolCalls  map[string]int `json:"tool_calls,omitempty"` // Calls per tool name
+	Usage      provider.Usage `json:"usage"`
+	Cost       float64        `json:"cost_usd,omitempty"`
+	DurationMs int64          `json:"duration_ms"`
+	Finished   bool           `json:"finished"` // The transcript has its end entry
+}
+
+// Summarize condenses the entries of one run.
+func Summarize(entries []Entry) Summary {
+	var s Summary
+	for _, e := range entries {
+		s.Run = e.Run
+		switch e.Type {
+		case TypeStart:
+			s.Session = e.Session
+			if e.Message != nil {
+				s.Prompt = e.Message.Content
+			}
+		case TypeLLM:
+			s.LLMCalls++
+		case TypeTool:
+			if e.ToolCall == nil {
+				continue
+			}
+			if s.ToolCalls == nil {
+				s.ToolCalls = make(map[string]int)
+			}
+			s.ToolCalls[e.ToolCall.Name]++
+		case TypeEnd:
+			s.Result, s.Error, s.Cost, s.DurationMs, s.Finished = e.Result, e.Error, e.Cost, e.DurationMs, true
+			if e.Usage != nil {
+				s.Usage = *e.Usage
+			}
+		}
+	}
+	return s
+}
+
+// newID returns a run ID that sorts by start time.
+func newID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+// stripAttachments drops image and document data, which would bloat the
+// transcript, keeping a note of how many there were.
+func stripAttachments(msg provider.Message) *provider.Message {
+	if n := len(msg.Images) + len(msg.Documents); n > 0 {
+		msg.Content += fmt.Sprintf("\n[%d attachment(s) not recorded]", n)
+		msg.Images, msg.Documents = nil, nil
+	}
+	return &msg
+}
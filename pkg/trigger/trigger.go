@@ -0,0 +1,275 @@
+// Package trigger starts agent runs when watched files change, e.g. "a
+// new file landed in inbox/, process it".
+package trigger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long a trigger waits for changes to settle.
+const DefaultDebounce = 2 * time.Second
+
+// RunFunc starts an agent run. It matches scheduler.RunFunc.
+type RunFunc func(ctx context.Context, sessionKey, prompt string) (string, error)
+
+// Trigger runs a prompt when files matching Paths change.
+type Trigger struct {
+	Name     string
+	Paths    []string      // Files, directories (any file directly in them), or globs like "inbox/*.pdf"
+	Events   []string      // "create", "write", "remove", "rename" (empty = create and write)
+	Session  string        // Session key template (default "trigger-<name>")
+	Prompt   string        // Prompt template rendered with Event
+	Debounce time.Duration // Quiet period that batches changes into one run (0 = DefaultDebounce)
+	Agent    string        // Named agent that runs the trigger, for the RunFunc ("" = default)
+}
+
+// Event is what a trigger's templates are rendered with.
+type Event struct {
+	Name  string   // Trigger name
+	Files []string // Changed paths, sorted
+}
+
+// templateFuncs are available in trigger templates, since a prompt
+// usually lists Files.
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"base": filepath.Base,
+}
+
+var eventOps = map[string]fsnotify.Op{
+	"create": fsnotify.Create,
+	"write":  fsnotify.Write,
+	"remove": fsnotify.Remove,
+	"rename": fsnotify.Rename,
+}
+
+type compiled struct {
+	Trigger
+	ops      fsnotify.Op
+	patterns []pattern
+	session  *template.Template
+	prompt   *template.Template
+
+	mu      sync.Mutex
+	pending map[string]bool
+	timer   *time.Timer
+}
+
+// pattern matches changed paths. Directories are watched, not walked, so
+// only files directly inside dir can match.
+type pattern struct {
+	dir  string
+	glob string // Empty matches any file in dir
+}
+
+func (p pattern) match(path string) bool {
+	if p.glob == "" {
+		return filepath.Dir(path) == p.dir
+	}
+	ok, _ := filepath.Match(p.glob, path)
+	return ok
+}
+
+// Watcher watches every trigger's paths and starts their runs.
+type Watcher struct {
+	ctx      context.Context // Runs are cancelled when this is done
+	run      RunFunc
+	verbose  bool
+	triggers []*compiled
+}
+
+// New compiles triggers. Runs inherit ctx rather than the one passed to
+// Run, so they can outlive the watch.
+func New(ctx context.Context, run RunFunc, verbose bool, triggers ...Trigger) (*Watcher, error) {
+	w := &Watcher{ctx: ctx, run: run, verbose: verbose}
+	for _, t := range triggers {
+		if t.Name == "" || t.Prompt == "" || len(t.Paths) == 0 {
+			return nil, fmt.Errorf("trigger: needs a name, paths, and prompt")
+		}
+		if t.Session == "" {
+			t.Session = "trigger-" + t.Name
+		}
+		if t.Debounce <= 0 {
+			t.Debounce = DefaultDebounce
+		}
+		c := &compiled{Trigger: t, pending: make(map[string]bool)}
+		events := t.Events
+		if len(events) == 0 {
+			events = []string{"create", "write"}
+		}
+		for _, e := range events {
+			op, ok := eventOps[e]
+			if !ok {
+				return nil, fmt.Errorf("trigger: %s: unknown event %q", t.Name, e)
+			}
+			c.ops |= op
+		}
+		for _, path := range t.Paths {
+			p, err := parsePattern(path)
+			if err != nil {
+				return nil, fmt.Errorf("trigger: %s: %w", t.Name, err)
+			}
+			c.patterns = append(c.patterns, p)
+		}
+		var err error
+		if c.session, err = template.New(t.Name + ".session").Funcs(templateFuncs).Parse(t.Session); err != nil {
+			return nil, fmt.Errorf("trigger: %s session: %w", t.Name, err)
+		}
+		if c.prompt, err = template.New(t.Name + ".prompt").Funcs(templateFuncs).Parse(t.Prompt); err != nil {
+			return nil, fmt.Errorf("trigger: %s prompt: %w", t.Name, err)
+		}
+		w.triggers = append(w.triggers, c)
+	}
+	return w, nil
+}
+
+func parsePattern(path string) (pattern, error) {
+	path = filepath.Clean(path)
+	if _, err := filepath.Match(path, ""); err != nil {
+		return pattern{}, fmt.Errorf("path %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	if strings.ContainsAny(dir, "*?[") {
+		return pattern{}, fmt.Errorf("path %s: only the last element may be a glob", path)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return pattern{dir: path}, nil
+	}
+	return pattern{dir: dir, glob: path}, nil
+}
+
+// Run watches until ctx is done. Changes that are still settling when it
+// returns are dropped.
+func (w *Watcher) Run(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("trigger: %w", err)
+	}
+	defer fw.Close()
+
+	dirs := make(map[string]bool)
+	for _, t := range w.triggers {
+		for _, p := range t.patterns {
+			dirs[p.dir] = true
+		}
+	}
+	for _, dir := range slices.Sorted(maps.Keys(dirs)) {
+		if err := fw.Add(dir); err != nil {
+			return fmt.Errorf("trigger: watch %s: %w", dir, err)
+		}
+	}
+	defer w.stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(ev)
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("[trigger] %v", err)
+		}
+	}
+}
+
+func (w *Watcher) handle(ev fsnotify.Event) {
+	path := filepath.Clean(ev.Name)
+	for _, t := range w.triggers {
+		if ev.Op&t.ops == 0 || !slices.ContainsFunc(t.patterns, func(p pattern) bool { return p.match(path) }) {
+			continue
+		}
+		t.mu.Lock()
+		t.pending[path] = true
+		if t.timer == nil {
+			t.timer = time.AfterFunc(t.Debounce, func() { w.fire(t) })
+		} else {
+			t.timer.Reset(t.Debounce)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// stop drops changes that have not settled yet.
+func (w *Watcher) stop() {
+	for _, t := range w.triggers {
+		t.mu.Lock()
+		if t.timer != nil {
+			t.timer.Stop()
+			t.timer = nil
+		}
+		clear(t.pending)
+		t.mu.Unlock()
+	}
+}
+
+// fire starts a run for the changes t has collected.
+func (w *Watcher) fire(t *compiled) {
+	t.mu.Lock()
+	files := slices.Sorted(maps.Keys(t.pending))
+	clear(t.pending)
+	t.timer = nil
+	t.mu.Unlock()
+	if len(files) == 0 {
+		return
+	}
+
+	ev := Event{Name: t.Name, Files: files}
+	session, err := render(t.session, ev)
+	if err != nil {
+		log.Printf("[trigger] %s: %v", t.Name, err)
+		return
+	}
+	prompt, err := render(t.prompt, ev)
+	if err != nil {
+		log.Printf("[trigger] %s: %v", t.Name, err)
+		return
+	}
+	if w.verbose {
+		log.Printf("[trigger] %s: %d changed files → session %s", t.Name, len(files), session)
+	}
+	go func() {
+		if _, err := w.run(withTrigger(w.ctx, t.Trigger), session, prompt); err != nil {
+			log.Printf("[trigger] %s run failed: %v", t.Name, err)
+		}
+	}()
+}
+
+type triggerKey struct{}
+
+func withTrigger(ctx context.Context, t Trigger) context.Context {
+	return context.WithValue(ctx, triggerKey{}, t)
+}
+
+// From returns the trigger a RunFunc call was started for. It reports
+// false outside a trigger run.
+func From(ctx context.Context) (Trigger, bool) {
+	t, ok := ctx.Value(triggerKey{}).(Trigger)
+	return t, ok
+}
+
+func render(t *template.Template, data any) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("render %s: %w", t.Name(), err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
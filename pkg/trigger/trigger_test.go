@@ -0,0 +1,122 @@
+package trigger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type run struct{ session, prompt, agent string }
+
+func startWatcher(t *testing.T, triggers ...Trigger) chan run {
+	t.Helper()
+	runs := make(chan run, 4)
+	w, err := New(context.Background(), func(ctx context.Context, session, prompt string) (string, error) {
+		tr, _ := From(ctx)
+		runs <- run{session, prompt, tr.Agent}
+		return "", nil
+	}, false, triggers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	time.Sleep(50 * time.Millisecond) // Let the watch start
+	return runs
+}
+
+func write(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTriggerBatchesChanges(t *testing.T) {
+	dir := t.TempDir()
+	runs := startWatcher(t, Trigger{
+		Name:     "inbox",
+		Paths:    []string{filepath.Join(dir, "*.txt")},
+		Prompt:   `New files: {{range .Files}}{{base .}} {{end}}`,
+		Debounce: 100 * time.Millisecond,
+		Agent:    "clerk",
+	})
+
+	write(t, filepath.Join(dir, "a.txt"))
+	write(t, filepath.Join(dir, "b.txt"))
+	write(t, filepath.Join(dir, "ignored.pdf"))
+
+	select {
+	case r := <-runs:
+		if r.session != "trigger-inbox" || r.prompt != "New files: a.txt b.txt" || r.agent != "clerk" {
+			t.Errorf("run = %+v", r)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("trigger did not fire")
+	}
+	select {
+	case r := <-runs:
+		t.Errorf("extra run %+v", r)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestTriggerDirectoryAndEvents(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "old"))
+	runs := startWatcher(t, Trigger{
+		Name:     "gone",
+		Paths:    []string{dir},
+		Events:   []string{"remove"},
+		Session:  "{{.Name}}-session",
+		Prompt:   `Removed {{join .Files ","}}`,
+		Debounce: 50 * time.Millisecond,
+	})
+
+	write(t, filepath.Join(dir, "new")) // A create, which this trigger ignores
+	if err := os.Remove(filepath.Join(dir, "old")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-runs:
+		if r.session != "gone-session" || r.prompt != "Removed "+filepath.Join(dir, "old") {
+			t.Errorf("run = %+v", r)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("trigger did not fire")
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	run := func(context.Context, string, string) (string, error) { return "", nil }
+	tests := []struct {
+		name string
+		t    Trigger
+		want string
+	}{
+		{"missing paths", Trigger{Name: "x", Prompt: "p"}, "needs a name"},
+		{"bad event", Trigger{Name: "x", Prompt: "p", Paths: []string{"/tmp"}, Events: []string{"touch"}}, `unknown event "touch"`},
+		{"bad glob", Trigger{Name: "x", Prompt: "p", Paths: []string{"/tmp/[a"}}, "syntax error"},
+		{"glob dir", Trigger{Name: "x", Prompt: "p", Paths: []string{"/tmp/*/in"}}, "only the last element"},
+		{"bad template", Trigger{Name: "x", Prompt: "{{.Files", Paths: []string{"/tmp"}}, "prompt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(context.Background(), run, false, tt.t)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -6,7 +6,7 @@ set -euo pipefail
 
 PASS=0
 FAIL=0
-BINARY="./teeny-orchestrator"
+BINARY="./teeny"
 
 pass() { PASS=$((PASS + 1)); echo "  ✅ $1"; }
 fail() { FAIL=$((FAIL + 1)); echo "  ❌ $1: $2"; }
@@ -14,7 +14,7 @@ fail() { FAIL=$((FAIL + 1)); echo "  ❌ $1: $2"; }
 cd "$(dirname "$0")/.."
 
 echo "Building..."
-go build -o "$BINARY" ./cmd/teeny-orchestrator/
+go build -o "$BINARY" ./cmd/teeny/
 
 echo ""
 echo "=== Plumbing Tests (no API key needed) ==="